@@ -0,0 +1,142 @@
+package main
+
+import (
+	"errors"
+	"github.com/go-chi/chi/v5"
+	mkerror "github.com/rengas/pdfgen/pkg/errors"
+	"github.com/rengas/pdfgen/pkg/httputils"
+	"github.com/rengas/pdfgen/pkg/lockout"
+	"github.com/rengas/pdfgen/pkg/logging"
+	"github.com/rengas/pdfgen/pkg/usage"
+	"net/http"
+	"time"
+)
+
+type AdminAPI struct {
+	guard LoginGuard
+	plans PlanRepository
+}
+
+func NewAdminAPI(guard LoginGuard, plans PlanRepository) *AdminAPI {
+	return &AdminAPI{
+		guard: guard,
+		plans: plans,
+	}
+}
+
+// ListLockouts func for listing locked accounts and ips.
+// @Description  List accounts and client ips that are currently locked after failed logins.
+// @Summary      List lockouts
+// @Tags         Admin
+// @Produce      json
+// @Success      200  {object}  ListLockoutResponse
+// @Failure      401  {object}  httputils.ErrorResponse  "Unauthorized"
+// @Failure      403  {object}  httputils.ErrorResponse  "Forbidden"
+// @Failure      500  {object}  httputils.ErrorResponse  "Internal Server Error"
+// @Security     BearerAuth
+// @Router       /admin/lockouts [get]
+func (a *AdminAPI) ListLockouts(w http.ResponseWriter, req *http.Request) {
+	ctx := req.Context()
+	es, err := a.guard.Locked(ctx)
+	if err != nil {
+		logging.WithContext(ctx).WithError(err).Error("unable to list lockouts")
+		httputils.InternalServerError(ctx, w, mkerror.ErrInternalError)
+		return
+	}
+	if es == nil {
+		es = []lockout.Entry{}
+	}
+	httputils.OK(ctx, w, ListLockoutResponse{Lockouts: es})
+}
+
+// Unlock func for lifting a lockout.
+// @Description  Clear the failed login counter of an account or a client ip.
+// @Summary      Unlock
+// @Tags         Admin
+// @Accept       json
+// @Produce      json
+// @Param        data  body      UnlockRequest            true  "Lockout key"
+// @Success      200   {object}  UnlockResponse
+// @Failure      400   {object}  httputils.ErrorResponse  "Bad Request"
+// @Failure      401   {object}  httputils.ErrorResponse  "Unauthorized"
+// @Failure      403   {object}  httputils.ErrorResponse  "Forbidden"
+// @Failure      404   {object}  httputils.ErrorResponse  "Not Found"
+// @Failure      422   {object}  httputils.ErrorResponse  "Validation errors"
+// @Failure      500   {object}  httputils.ErrorResponse  "Internal Server Error"
+// @Security     BearerAuth
+// @Router       /admin/lockouts/unlock [post]
+func (a *AdminAPI) Unlock(w http.ResponseWriter, req *http.Request) {
+	ctx := req.Context()
+	var ur UnlockRequest
+	err := httputils.ReadJson(req, &ur)
+	if err != nil {
+		logging.WithContext(ctx).WithError(err).Debug("unable to read request")
+		httputils.BadRequest(ctx, w, err)
+		return
+	}
+	err = ur.Validate()
+	if err != nil {
+		httputils.UnProcessableEntity(ctx, w, err)
+		return
+	}
+
+	err = a.guard.Unlock(ctx, ur.Key)
+	if err != nil {
+		if errors.Is(err, lockout.ErrEntryNotFound) {
+			httputils.NotFound(ctx, w, ErrAdminLockoutNotFound)
+			return
+		}
+		logging.WithContext(ctx).WithError(err).Error("unable to unlock")
+		httputils.InternalServerError(ctx, w, mkerror.ErrInternalError)
+		return
+	}
+
+	httputils.OK(ctx, w, UnlockResponse{Key: ur.Key})
+}
+
+// SetPlan func for changing the plan of a user.
+// @Description  Move a user to another plan, the new limits apply to the current month.
+// @Summary      Set plan
+// @Tags         Admin
+// @Accept       json
+// @Produce      json
+// @Param        userId  path      string          true  "user id"
+// @Param        data    body      SetPlanRequest  true  "Plan"
+// @Success      200     {object}  SetPlanResponse
+// @Failure      400     {object}  httputils.ErrorResponse  "Bad Request"
+// @Failure      401     {object}  httputils.ErrorResponse  "Unauthorized"
+// @Failure      403     {object}  httputils.ErrorResponse  "Forbidden"
+// @Failure      404     {object}  httputils.ErrorResponse  "Not Found"
+// @Failure      422     {object}  httputils.ErrorResponse  "Validation errors"
+// @Failure      500     {object}  httputils.ErrorResponse  "Internal Server Error"
+// @Security     BearerAuth
+// @Router       /admin/users/{userId}/plan [put]
+func (a *AdminAPI) SetPlan(w http.ResponseWriter, req *http.Request) {
+	ctx := req.Context()
+	var pr SetPlanRequest
+	err := httputils.ReadJson(req, &pr)
+	if err != nil {
+		logging.WithContext(ctx).WithError(err).Debug("unable to read request")
+		httputils.BadRequest(ctx, w, err)
+		return
+	}
+	err = pr.Validate()
+	if err != nil {
+		httputils.UnProcessableEntity(ctx, w, err)
+		return
+	}
+
+	userId := chi.URLParam(req, "userId")
+	err = a.plans.SetPlan(ctx, userId, pr.Plan, time.Now().UTC())
+	if err != nil {
+		if errors.Is(err, usage.ErrUserNotFound) {
+			httputils.NotFound(ctx, w, ErrAdminUserNotFound)
+			return
+		}
+		logging.WithContext(ctx).WithError(err).Error("unable to set plan")
+		httputils.InternalServerError(ctx, w, mkerror.ErrInternalError)
+		return
+	}
+
+	httputils.OK(ctx, w, SetPlanResponse{UserId: userId, Plan: pr.Plan})
+}
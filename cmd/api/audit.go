@@ -0,0 +1,123 @@
+package main
+
+import (
+	"github.com/rengas/pdfgen/pkg/audit"
+	mkerror "github.com/rengas/pdfgen/pkg/errors"
+	"github.com/rengas/pdfgen/pkg/httputils"
+	"github.com/rengas/pdfgen/pkg/logging"
+	"github.com/rengas/pdfgen/pkg/user"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+const (
+	auditDefaultCount = 50
+	auditMaxCount     = 500
+)
+
+type AuditAPI struct {
+	auditRepo AuditRepository
+	userRepo  UserRepository
+}
+
+func NewAuditAPI(auditRepo AuditRepository, userRepo UserRepository) *AuditAPI {
+	return &AuditAPI{
+		auditRepo: auditRepo,
+		userRepo:  userRepo,
+	}
+}
+
+// ListAuditEvents func for reading the audit log.
+// @Description  List audit events, newest first. Admins see every event, other users only the events they are the actor of.
+// @Summary      List audit events
+// @Tags         Audit
+// @Produce      json
+// @Param        actor   query     string  false  "user id, or the attempted email of failed logins"
+// @Param        action  query     string  false  "action, e.g. login.failed or design.deleted"
+// @Param        from    query     string  false  "RFC 3339 time, inclusive"
+// @Param        to      query     string  false  "RFC 3339 time, exclusive"
+// @Param        count   query     int     false  "events per page, at most 500"
+// @Param        page    query     int     false  "page, starting at 1"
+// @Success      200     {object}  ListAuditResponse
+// @Failure      400     {object}  httputils.ErrorResponse  "Bad Request"
+// @Failure      401     {object}  httputils.ErrorResponse  "Unauthorized"
+// @Failure      403     {object}  httputils.ErrorResponse  "Forbidden"
+// @Failure      500     {object}  httputils.ErrorResponse  "Internal Server Error"
+// @Security     BearerAuth
+// @Router       /audit [get]
+func (a *AuditAPI) ListAuditEvents(w http.ResponseWriter, req *http.Request) {
+	ctx := req.Context()
+	userId, ok := userIdFromRequest(w, req)
+	if !ok {
+		return
+	}
+
+	lq, err := auditListQuery(req)
+	if err != nil {
+		httputils.BadRequest(ctx, w, err)
+		return
+	}
+
+	u, err := a.userRepo.GetById(ctx, userId)
+	if err != nil {
+		logging.WithContext(ctx).WithError(err).Debug("unable to get user")
+		httputils.UnAuthorized(ctx, w, mkerror.ErrUnAuthorizedError)
+		return
+	}
+	if u.Role != user.RoleAdmin {
+		if lq.Actor != "" && lq.Actor != userId {
+			httputils.Forbidden(ctx, w, ErrAuditOtherActor)
+			return
+		}
+		lq.Actor = userId
+	}
+
+	es, pagi, err := a.auditRepo.List(ctx, lq)
+	if err != nil {
+		logging.WithContext(ctx).WithError(err).Error("unable to list audit events")
+		httputils.InternalServerError(ctx, w, mkerror.ErrInternalError)
+		return
+	}
+
+	httputils.OK(ctx, w, ListAuditResponse{Events: es, Pagination: pagi})
+}
+
+func auditListQuery(req *http.Request) (audit.ListQuery, error) {
+	q := req.URL.Query()
+	lq := audit.ListQuery{
+		Actor:  q.Get("actor"),
+		Action: q.Get("action"),
+		Limit:  auditDefaultCount,
+		Page:   1,
+	}
+
+	var err error
+	if v := q.Get("from"); v != "" {
+		lq.From, err = time.Parse(time.RFC3339, v)
+		if err != nil {
+			return audit.ListQuery{}, ErrAuditFromInvalid
+		}
+		lq.From = lq.From.UTC()
+	}
+	if v := q.Get("to"); v != "" {
+		lq.To, err = time.Parse(time.RFC3339, v)
+		if err != nil {
+			return audit.ListQuery{}, ErrAuditToInvalid
+		}
+		lq.To = lq.To.UTC()
+	}
+	if v := q.Get("count"); v != "" {
+		lq.Limit, err = strconv.ParseInt(v, 10, 64)
+		if err != nil || lq.Limit < 1 || lq.Limit > auditMaxCount {
+			return audit.ListQuery{}, ErrDesignCountInvalid
+		}
+	}
+	if v := q.Get("page"); v != "" {
+		lq.Page, err = strconv.ParseInt(v, 10, 64)
+		if err != nil || lq.Page < 1 {
+			return audit.ListQuery{}, ErrDesignPageInvalid
+		}
+	}
+	return lq, nil
+}
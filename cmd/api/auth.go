@@ -4,9 +4,11 @@ import (
 	"errors"
 	"fmt"
 	"github.com/google/uuid"
+	"github.com/rengas/pdfgen/pkg/audit"
 	mkerror "github.com/rengas/pdfgen/pkg/errors"
 	"github.com/rengas/pdfgen/pkg/httputils"
 	"github.com/rengas/pdfgen/pkg/logging"
+	"github.com/rengas/pdfgen/pkg/mfa"
 	"github.com/rengas/pdfgen/pkg/user"
 	"net/http"
 	"time"
@@ -16,15 +18,27 @@ type AuthAPI struct {
 	userRepo UserRepository
 	bcrypt   Bcrypt
 	jwt      JWTToken
+	mfaRepo  MFARepository
+	totp     TOTP
+	guard    LoginGuard
+	auditor  Auditor
 }
 
 func NewAuthAPI(userRepo UserRepository,
 	bcrypt Bcrypt,
-	jwt JWTToken) *AuthAPI {
+	jwt JWTToken,
+	mfaRepo MFARepository,
+	totp TOTP,
+	guard LoginGuard,
+	auditor Auditor) *AuthAPI {
 	return &AuthAPI{
 		userRepo: userRepo,
 		bcrypt:   bcrypt,
 		jwt:      jwt,
+		mfaRepo:  mfaRepo,
+		totp:     totp,
+		guard:    guard,
+		auditor:  auditor,
 	}
 }
 
@@ -45,7 +59,7 @@ func (a *AuthAPI) Register(w http.ResponseWriter, req *http.Request) {
 	var rr RegisterRequest
 	err := httputils.ReadJson(req, &rr)
 	if err != nil {
-		logging.WithContext(ctx).WithError(err)
+		logging.WithContext(ctx).WithError(err).Debug("unable to read request")
 		httputils.BadRequest(ctx, w, err)
 		return
 	}
@@ -69,7 +83,7 @@ func (a *AuthAPI) Register(w http.ResponseWriter, req *http.Request) {
 
 	b, err := a.bcrypt.GetHashedPassword(rr.Password)
 	if err != nil {
-		logging.WithContext(ctx).WithError(err)
+		logging.WithContext(ctx).WithError(err).Error("unable to hash password")
 		httputils.InternalServerError(ctx, w, mkerror.ErrInternalError)
 		return
 	}
@@ -86,32 +100,35 @@ func (a *AuthAPI) Register(w http.ResponseWriter, req *http.Request) {
 
 	err = a.userRepo.SaveNewUser(ctx, us)
 	if err != nil {
-		logging.WithContext(ctx).WithError(err)
+		logging.WithContext(ctx).WithError(err).Error("unable to save user")
 		httputils.InternalServerError(ctx, w, mkerror.ErrInternalError)
 		return
 	}
+	a.auditor.Record(ctx, audit.Event{Actor: id, Action: audit.ActionRegistered, TargetType: audit.TargetUser, TargetId: id})
 
 	httputils.OK(ctx, w, &RegisterResponse{Id: id})
 }
 
 // Login func for login.
-// @Description  Login as a user.
+// @Description  Login as a user. When two-factor authentication is enabled no token pair is returned,
+// @Description  instead mfaRequired is set and mfaToken must be exchanged at /login/mfa.
 // @Summary      Login
 // @Tags         Auth
 // @Accept       json
 // @Produce      json
 // @Param        data  body      LoginRequest               true  "Credentials"
-// @Success      200   {object}  LoginResponse              "User account and token pair"
+// @Success      200   {object}  LoginResponse              "User account and token pair or mfa challenge"
 // @Failure      400   {object}  httputils.ErrorResponse  "		 "Bad Request"
 // @Failure      422   {object}  httputils.ErrorResponse         "Validation errors"
 // @Failure      403   {object}  httputils.ErrorResponse         "Forbidden"
+// @Failure      429   {object}  httputils.ErrorResponse         "Too many failed attempts, see Retry-After"
 // @Router       /login [post]
 func (a *AuthAPI) Login(w http.ResponseWriter, req *http.Request) {
 	ctx := req.Context()
 	var lr LoginRequest
 	err := httputils.ReadJson(req, &lr)
 	if err != nil {
-		logging.WithContext(ctx).WithError(err)
+		logging.WithContext(ctx).WithError(err).Debug("unable to read request")
 		httputils.BadRequest(ctx, w, err)
 		return
 	}
@@ -122,25 +139,200 @@ func (a *AuthAPI) Login(w http.ResponseWriter, req *http.Request) {
 		return
 	}
 
+	if isLockedOut(w, req, a.guard, lr.Email) {
+		return
+	}
+
 	u, err := a.userRepo.GetByEmail(ctx, lr.Email)
 	if err != nil && errors.Is(err, user.ErrUserNotFound) {
-		logging.WithContext(ctx).WithError(err)
+		logging.WithContext(ctx).WithError(err).Info("login with unknown email")
+		if recordFailure(w, req, a.guard, a.auditor, lr.Email, "unknown email") {
+			return
+		}
 		httputils.UnAuthorized(ctx, w, err)
 		return
 	}
 
 	err = a.bcrypt.CompareHashedPassword(u.PasswordHash, lr.Password)
 	if err != nil {
-		logging.WithContext(ctx).WithError(err)
+		logging.WithContext(ctx).WithError(err).Info("login with wrong password")
+		if recordFailure(w, req, a.guard, a.auditor, lr.Email, "wrong password") {
+			return
+		}
 		httputils.Forbidden(ctx, w, mkerror.ErrForbidden)
 		return
 	}
 
+	if requireMFA(w, req, a.jwt, a.mfaRepo, u) {
+		return
+	}
+
+	a.writeTokenPair(w, req, u)
+}
+
+// requireMFA answers with an mfa challenge instead of a token pair when u
+// has two-factor authentication enabled, the login is completed at
+// /login/mfa. It reports whether it wrote the response.
+func requireMFA(w http.ResponseWriter, req *http.Request, jwt JWTToken, mfaRepo MFARepository, u user.User) bool {
+	ctx := req.Context()
+	m, err := mfaRepo.GetByUserId(ctx, u.Id)
+	if err != nil && !errors.Is(err, mfa.ErrMFANotFound) {
+		logging.WithContext(ctx).WithError(err).Error("unable to get mfa")
+		httputils.InternalServerError(ctx, w, mkerror.ErrInternalError)
+		return true
+	}
+	if !m.Enabled {
+		return false
+	}
+
+	challenge, err := jwt.MFAChallenge(u.Id)
+	if err != nil {
+		logging.WithContext(ctx).WithError(err).Error("unable to create mfa challenge")
+		httputils.InternalServerError(ctx, w, mkerror.ErrInternalError)
+		return true
+	}
+	httputils.OK(ctx, w, LoginResponse{
+		User: User{
+			Id:    u.Id,
+			Email: u.Email,
+		},
+		MFARequired: true,
+		MFAToken:    challenge,
+	})
+	return true
+}
+
+// LoginMFA func for the second step of login.
+// @Description  Complete a login for a user with two-factor authentication enabled using either
+// @Description  a code from the authenticator app or a single use recovery code.
+// @Summary      Login second factor
+// @Tags         Auth
+// @Accept       json
+// @Produce      json
+// @Param        data  body      LoginMFARequest            true  "Challenge and code"
+// @Success      200   {object}  LoginResponse              "User account and token pair"
+// @Failure      400   {object}  httputils.ErrorResponse    "Bad Request"
+// @Failure      401   {object}  httputils.ErrorResponse    "Unauthorized"
+// @Failure      422   {object}  httputils.ErrorResponse    "Validation errors"
+// @Failure      403   {object}  httputils.ErrorResponse    "Forbidden"
+// @Failure      429   {object}  httputils.ErrorResponse    "Too many failed attempts, see Retry-After"
+// @Router       /login/mfa [post]
+func (a *AuthAPI) LoginMFA(w http.ResponseWriter, req *http.Request) {
+	ctx := req.Context()
+	var lr LoginMFARequest
+	err := httputils.ReadJson(req, &lr)
+	if err != nil {
+		logging.WithContext(ctx).WithError(err).Debug("unable to read request")
+		httputils.BadRequest(ctx, w, err)
+		return
+	}
+	err = lr.Validate()
+	if err != nil {
+		logging.WithField(logging.Field{Label: "validation", Value: err.Error()}).Debug("validation failed")
+		httputils.UnProcessableEntity(ctx, w, err)
+		return
+	}
+
+	userId, err := a.jwt.VerifyMFAChallenge(lr.MFAToken)
+	if err != nil {
+		logging.WithContext(ctx).WithError(err).Debug("invalid mfa challenge")
+		httputils.UnAuthorized(ctx, w, mkerror.ErrUnAuthorizedError)
+		return
+	}
+
+	u, err := a.userRepo.GetById(ctx, userId)
+	if err != nil {
+		logging.WithContext(ctx).WithError(err).Debug("unable to get user")
+		httputils.UnAuthorized(ctx, w, mkerror.ErrUnAuthorizedError)
+		return
+	}
+
+	if isLockedOut(w, req, a.guard, u.Email) {
+		return
+	}
+
+	m, err := a.mfaRepo.GetByUserId(ctx, userId)
+	if err != nil || !m.Enabled {
+		logging.WithContext(ctx).WithError(err).Debug("mfa not enabled")
+		httputils.UnAuthorized(ctx, w, mkerror.ErrUnAuthorizedError)
+		return
+	}
+
+	err = verifySecondFactor(ctx, a.mfaRepo, a.totp, m, lr.Code, lr.RecoveryCode)
+	if err != nil {
+		logging.WithContext(ctx).WithError(err).Debug("second factor rejected")
+		if recordFailure(w, req, a.guard, a.auditor, u.Email, "invalid second factor") {
+			return
+		}
+		httputils.Forbidden(ctx, w, ErrMFAInvalidCode)
+		return
+	}
+
+	a.writeTokenPair(w, req, u)
+}
+
+// isLockedOut writes a 429 when the account or the client ip is locked.
+func isLockedOut(w http.ResponseWriter, req *http.Request, guard LoginGuard, account string) bool {
+	ctx := req.Context()
+	wait, err := guard.Check(ctx, account, httputils.ClientIP(req))
+	if err != nil {
+		logging.WithContext(ctx).WithError(err).Error("unable to check lockout")
+		httputils.InternalServerError(ctx, w, mkerror.ErrInternalError)
+		return true
+	}
+	if wait > 0 {
+		httputils.TooManyRequests(ctx, w, ErrAuthTooManyAttempts, wait)
+		return true
+	}
+	return false
+}
+
+// recordFailure counts a failed attempt and writes a 429 when it caused a lockout.
+func recordFailure(w http.ResponseWriter, req *http.Request, guard LoginGuard, auditor Auditor, account, reason string) bool {
+	ctx := req.Context()
+	auditor.Record(ctx, audit.Event{
+		Actor:      account,
+		Action:     audit.ActionLoginFailed,
+		TargetType: audit.TargetUser,
+		Metadata:   audit.Metadata{"reason": reason},
+	})
+
+	wait, err := guard.Fail(ctx, account, httputils.ClientIP(req))
+	if err != nil {
+		logging.WithContext(ctx).WithError(err).Error("unable to record failed login")
+		return false
+	}
+	if wait > 0 {
+		httputils.TooManyRequests(ctx, w, ErrAuthTooManyAttempts, wait)
+		return true
+	}
+	return false
+}
+
+func (a *AuthAPI) writeTokenPair(w http.ResponseWriter, req *http.Request, u user.User) {
+	ctx := req.Context()
+	err := a.guard.Succeed(ctx, u.Email)
+	if err != nil {
+		logging.WithContext(ctx).WithError(err).Error("unable to reset failed logins")
+	}
+	a.auditor.Record(ctx, audit.Event{Actor: u.Id, Action: audit.ActionLoginSucceeded, TargetType: audit.TargetUser, TargetId: u.Id})
+
+	writeTokenPair(w, req, a.jwt, u, "")
+}
+
+// writeTokenPair completes a login by issuing an access and refresh token for u.
+// A non empty organizationId is added as orgId claim and makes that
+// organization the active one for requests with the token.
+func writeTokenPair(w http.ResponseWriter, req *http.Request, jwt JWTToken, u user.User, organizationId string) {
+	ctx := req.Context()
 	claims := make(map[string]interface{}, 0)
 	claims["userId"] = u.Id
-	token, err := a.jwt.TokePair(claims)
+	if organizationId != "" {
+		claims["orgId"] = organizationId
+	}
+	token, err := jwt.TokePair(claims)
 	if err != nil {
-		logging.WithContext(ctx).WithError(err)
+		logging.WithContext(ctx).WithError(err).Error("unable to create token pair")
 		httputils.InternalServerError(ctx, w, mkerror.ErrInternalError)
 		return
 	}
@@ -150,13 +342,27 @@ func (a *AuthAPI) Login(w http.ResponseWriter, req *http.Request) {
 			Id:    u.Id,
 			Email: u.Email,
 		},
-		AccessToken:  token.AccessToken,
-		RefreshToken: token.RefreshToken,
+		AccessToken:    token.AccessToken,
+		RefreshToken:   token.RefreshToken,
+		OrganizationId: organizationId,
 	}
 
 	httputils.OK(ctx, w, rs)
 }
 
+// JWKS func for publishing token verification keys.
+// @Description  Public keys access tokens are signed with, in JSON Web Key Set format.
+// @Description  Keys are identified by the kid header of a token.
+// @Summary      JSON Web Key Set
+// @Tags         Auth
+// @Produce      json
+// @Success      200  {object}  token.JWKS
+// @Router       /.well-known/jwks.json [get]
+func (a *AuthAPI) JWKS(w http.ResponseWriter, req *http.Request) {
+	w.Header().Set("Cache-Control", "public, max-age=300")
+	httputils.OK(req.Context(), w, a.jwt.JWKS())
+}
+
 func (p *AuthAPI) Health(w http.ResponseWriter, req *http.Request) {
 	fmt.Fprintf(w, "I'm ok")
 }
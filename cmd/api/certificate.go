@@ -0,0 +1,164 @@
+package main
+
+import (
+	"errors"
+	"github.com/go-chi/chi/v5"
+	"github.com/google/uuid"
+	"github.com/rengas/pdfgen/pkg/audit"
+	"github.com/rengas/pdfgen/pkg/certificate"
+	mkerror "github.com/rengas/pdfgen/pkg/errors"
+	"github.com/rengas/pdfgen/pkg/httputils"
+	"github.com/rengas/pdfgen/pkg/logging"
+	"net/http"
+	"time"
+)
+
+type CertificateAPI struct {
+	certRepo CertificateRepository
+	vault    CertificateVault
+	auditor  Auditor
+}
+
+func NewCertificateAPI(certRepo CertificateRepository, vault CertificateVault, auditor Auditor) *CertificateAPI {
+	return &CertificateAPI{
+		certRepo: certRepo,
+		vault:    vault,
+		auditor:  auditor,
+	}
+}
+
+// CreateCertificate func for uploading a signing certificate.
+// @Description  Upload a PKCS#12 file with a private key and its certificate chain to sign generated pdfs.
+// @Description  The key is stored encrypted, the password of the file is not stored.
+// @Summary      Create certificate
+// @Tags         User
+// @Accept       json
+// @Produce      json
+// @Param        CreateCertificateRequest body  CreateCertificateRequest  true  "pkcs12 file"
+// @Success      200  {object}  certificate.Certificate
+// @Failure      400  {object}  httputils.ErrorResponse  "Bad Request"
+// @Failure      401  {object}  httputils.ErrorResponse  "Unauthorized"
+// @Failure      500  {object}  httputils.ErrorResponse  "Internal Server Error"
+// @Security     BearerAuth
+// @Router       /user/certificate [post]
+func (c *CertificateAPI) CreateCertificate(w http.ResponseWriter, req *http.Request) {
+	ctx := req.Context()
+	userId, ok := userIdFromRequest(w, req)
+	if !ok {
+		return
+	}
+
+	var t CreateCertificateRequest
+	err := httputils.ReadJson(req, &t)
+	if err != nil {
+		httputils.BadRequest(ctx, w, errors.New("unable to read request"))
+		return
+	}
+	err = t.Validate()
+	if err != nil {
+		httputils.BadRequest(ctx, w, err)
+		return
+	}
+
+	key, err := certificate.ParsePKCS12(t.PKCS12, t.Password)
+	switch {
+	case errors.Is(err, certificate.ErrPKCS12Password):
+		httputils.BadRequest(ctx, w, ErrCertificatePKCS12Password)
+		return
+	case errors.Is(err, certificate.ErrPKCS12Unsupported):
+		httputils.BadRequest(ctx, w, ErrCertificatePKCS12Unsupported)
+		return
+	case err != nil:
+		httputils.BadRequest(ctx, w, ErrCertificatePKCS12Invalid)
+		return
+	}
+
+	now := time.Now().UTC()
+	cert := key.Describe()
+	if !cert.Valid(now) {
+		httputils.BadRequest(ctx, w, ErrCertificateExpired)
+		return
+	}
+	cert.Sealed, err = c.vault.Seal(key)
+	if err != nil {
+		logging.WithContext(ctx).WithError(err).Error("unable to seal certificate")
+		httputils.InternalServerError(ctx, w, mkerror.ErrInternalError)
+		return
+	}
+	cert.Id = uuid.NewString()
+	cert.UserId = userId
+	cert.Name = t.Name
+	cert.CreatedAt = now
+
+	err = c.certRepo.Save(ctx, cert)
+	if err != nil {
+		logging.WithContext(ctx).WithError(err).Error("unable to save certificate")
+		httputils.InternalServerError(ctx, w, mkerror.ErrInternalError)
+		return
+	}
+
+	c.auditor.Record(ctx, audit.Event{Action: audit.ActionCertificateAdded, TargetType: audit.TargetCertificate, TargetId: cert.Id, Metadata: audit.Metadata{"subject": cert.Subject}})
+	httputils.OK(ctx, w, cert)
+}
+
+// ListCertificates func for listing signing certificates.
+// @Description  List the signing certificates of the user.
+// @Summary      List certificates
+// @Tags         User
+// @Produce      json
+// @Success      200  {object}  ListCertificateResponse
+// @Failure      401  {object}  httputils.ErrorResponse  "Unauthorized"
+// @Failure      500  {object}  httputils.ErrorResponse  "Internal Server Error"
+// @Security     BearerAuth
+// @Router       /user/certificate [get]
+func (c *CertificateAPI) ListCertificates(w http.ResponseWriter, req *http.Request) {
+	ctx := req.Context()
+	userId, ok := userIdFromRequest(w, req)
+	if !ok {
+		return
+	}
+
+	certs, err := c.certRepo.ListByUserId(ctx, userId)
+	if err != nil {
+		logging.WithContext(ctx).WithError(err).Error("unable to list certificates")
+		httputils.InternalServerError(ctx, w, mkerror.ErrInternalError)
+		return
+	}
+
+	httputils.OK(ctx, w, ListCertificateResponse{Certificates: certs})
+}
+
+// DeleteCertificate func for removing a signing certificate.
+// @Description  Delete a signing certificate and its stored key.
+// @Summary      Delete certificate
+// @Tags         User
+// @Produce      json
+// @Param        certificateId  path  string  true  "certificate id"
+// @Success      200  {object}  DeleteCertificateResponse
+// @Failure      401  {object}  httputils.ErrorResponse  "Unauthorized"
+// @Failure      404  {object}  httputils.ErrorResponse  "Not Found"
+// @Failure      500  {object}  httputils.ErrorResponse  "Internal Server Error"
+// @Security     BearerAuth
+// @Router       /user/certificate/{certificateId} [delete]
+func (c *CertificateAPI) DeleteCertificate(w http.ResponseWriter, req *http.Request) {
+	ctx := req.Context()
+	userId, ok := userIdFromRequest(w, req)
+	if !ok {
+		return
+	}
+
+	id := chi.URLParam(req, "certificateId")
+	err := c.certRepo.Delete(ctx, userId, id)
+	if errors.Is(err, certificate.ErrCertificateNotFound) {
+		httputils.NotFound(ctx, w, ErrCertificateNotFound)
+		return
+	}
+	if err != nil {
+		logging.WithContext(ctx).WithError(err).Error("unable to delete certificate")
+		httputils.InternalServerError(ctx, w, mkerror.ErrInternalError)
+		return
+	}
+
+	c.auditor.Record(ctx, audit.Event{Action: audit.ActionCertificateDeleted, TargetType: audit.TargetCertificate, TargetId: id})
+	httputils.OK(ctx, w, DeleteCertificateResponse{Id: id})
+}
@@ -7,38 +7,56 @@ import (
 	"errors"
 	"github.com/go-chi/chi/v5"
 	"github.com/google/uuid"
+	"github.com/rengas/pdfgen/pkg/audit"
+	"github.com/rengas/pdfgen/pkg/barcode"
 	"github.com/rengas/pdfgen/pkg/contexts"
 	"github.com/rengas/pdfgen/pkg/design"
 	pgerror "github.com/rengas/pdfgen/pkg/errors"
+	"github.com/rengas/pdfgen/pkg/htmlrender"
 	"github.com/rengas/pdfgen/pkg/httputils"
 	"github.com/rengas/pdfgen/pkg/logging"
+	"github.com/rengas/pdfgen/pkg/organization"
 	"github.com/rengas/pdfgen/pkg/pagination"
-	"html/template"
+	"github.com/rengas/pdfgen/pkg/pdfops"
 	"net/http"
 	"strconv"
+	"strings"
 	"time"
 )
 
 type DesignAPI struct {
-	designRepo DesignRepository
-	minifier   Minifier
+	designRepo  DesignRepository
+	minifier    Minifier
+	auditor     Auditor
+	thumbnailer Thumbnailer
+	// renderEngine renders designs whose options name no engine.
+	renderEngine string
 }
 
 func NewDesignAPI(designRepo DesignRepository,
-	minifier Minifier) *DesignAPI {
+	minifier Minifier,
+	auditor Auditor,
+	thumbnailer Thumbnailer,
+	renderEngine string) *DesignAPI {
 	return &DesignAPI{
-		designRepo: designRepo,
-		minifier:   minifier,
+		designRepo:   designRepo,
+		minifier:     minifier,
+		auditor:      auditor,
+		thumbnailer:  thumbnailer,
+		renderEngine: renderEngine,
 	}
 }
 
 // CreateDesign func for register.
 // @Description  Create a new Design.
+// @Description  Designs of type pdf-form are a base64 pdf with form fields instead of an html template, their render options may only set metadata and flattenForms.
+// @Description  Html designs can draw barcodes of fields with the template functions qrcode, code128, ean13, datamatrix and pdf417, e.g. {{qrcode .url "size=30" "level=H"}} or {{ean13 .gtin "format=png"}}. Sizes are in mm.
 // @Summary      Create Design
 // @Tags         Design
 // @Accept       json
 // @Produce      json
 // @Param        CreateDesignRequest body  CreateDesignRequest  true  "register details"
+// @Param        Idempotency-Key header string  false  "repeats with the same key within 24h replay the first response"
 // @Success      200           {object}  CreateDesignResponse 		"Created"
 // @Failure      400           {object}  httputils.ErrorResponse    "Bad Request"
 // @Failure      422           {object}  httputils.ErrorResponse    "Validation errors"
@@ -49,7 +67,7 @@ func (d *DesignAPI) CreateDesign(w http.ResponseWriter, r *http.Request) {
 	var t CreateDesignRequest
 	err := httputils.ReadJson(r, &t)
 	if err != nil {
-		logging.WithContext(ctx).WithError(err)
+		logging.WithContext(ctx).WithError(err).Debug("unable to read request")
 		httputils.BadRequest(context.TODO(), w, errors.New("unable to read request"))
 		return
 	}
@@ -62,6 +80,9 @@ func (d *DesignAPI) CreateDesign(w http.ResponseWriter, r *http.Request) {
 	}
 
 	err = t.Validate()
+	if err == nil {
+		err = validateDesign(t.Type, t.Render, t.Invoice, t.Draft, d.renderEngine)
+	}
 	if err != nil {
 		logging.WithField(logging.Field{Label: "validation", Value: err.Error()}).Debug("validation failed")
 		httputils.BadRequest(ctx, w, err)
@@ -69,36 +90,56 @@ func (d *DesignAPI) CreateDesign(w http.ResponseWriter, r *http.Request) {
 	}
 
 	ds := design.Design{
-		Id:     uuid.NewString(),
-		UserId: t.UserId,
-		Name:   t.Name,
-		Fields: nil,
+		Id:      uuid.NewString(),
+		UserId:  t.UserId,
+		Name:    t.Name,
+		Type:    t.Type,
+		Fields:  nil,
+		Render:  t.Render,
+		Invoice: t.Invoice,
+		Draft:   t.Draft,
+	}
+
+	// designs created while an organization is active belong to it
+	if orgId, err := contexts.OrganizationIdFromContext(ctx); err == nil {
+		role, _ := contexts.OrganizationRoleFromContext(ctx)
+		if !organization.Role(role).CanEdit() {
+			httputils.Forbidden(ctx, w, ErrOrganizationNotEditor)
+			return
+		}
+		ds.OrganizationId = &orgId
 	}
 
 	dt, err := base64.StdEncoding.DecodeString(t.Design)
 	if err != nil {
-		logging.WithContext(ctx).WithError(err)
+		logging.WithContext(ctx).WithError(err).Debug("design is not base64 encoded")
 		httputils.BadRequest(context.TODO(), w, ErrDesignMustBeBase64Encoded)
 		return
 	}
 
-	ws := string(dt)
-	//validate if valid design
-	_, err = template.New(t.Name).Parse(ws)
-	if err != nil {
-		logging.WithContext(ctx).WithError(err)
-		httputils.BadRequest(context.TODO(), w, ErrDesignInvalidHTML)
-		return
-	}
+	if ds.IsForm() {
+		if !formDesign(ctx, w, &ds, dt) {
+			return
+		}
+	} else {
+		ws := string(dt)
+		//validate if valid design
+		_, err = design.Parse(t.Name, ws)
+		if err != nil {
+			logging.WithContext(ctx).WithError(err).Debug("invalid html design")
+			httputils.BadRequest(context.TODO(), w, ErrDesignInvalidHTML)
+			return
+		}
 
-	mt, err := d.minifier.HTML(ws)
-	if err != nil {
-		logging.WithContext(ctx).WithError(err)
-		httputils.BadRequest(context.TODO(), w, ErrDesignUnableToMinify)
-		return
-	}
+		mt, err := d.minifier.HTML(ws)
+		if err != nil {
+			logging.WithContext(ctx).WithError(err).Error("unable to minify design")
+			httputils.BadRequest(context.TODO(), w, ErrDesignUnableToMinify)
+			return
+		}
 
-	ds.Template = mt
+		ds.Template = mt
+	}
 
 	if t.Fields != nil {
 		ds.Fields = &t.Fields
@@ -106,16 +147,20 @@ func (d *DesignAPI) CreateDesign(w http.ResponseWriter, r *http.Request) {
 
 	err = d.designRepo.Save(context.Background(), ds)
 	if err != nil {
-		logging.WithContext(ctx).WithError(err)
+		logging.WithContext(ctx).WithError(err).Error("unable to save design")
 		httputils.BadRequest(context.TODO(), w, ErrDesignUnableToUpdate)
 		return
 	}
+	d.auditor.Record(ctx, audit.Event{Action: audit.ActionDesignCreated, TargetType: audit.TargetDesign, TargetId: ds.Id, Metadata: audit.Metadata{"name": ds.Name}})
+	d.thumbnailer.Refresh(ds)
 
 	httputils.OK(context.TODO(), w, CreateDesignResponse{Id: ds.Id})
 }
 
 // UpdateDesign func for updating new design.
 // @Description  Update a Design.
+// @Description  Designs of type pdf-form are a base64 pdf with form fields instead of an html template, their render options may only set metadata and flattenForms.
+// @Description  Html designs can draw barcodes of fields with the template functions qrcode, code128, ean13, datamatrix and pdf417, e.g. {{qrcode .url "size=30" "level=H"}} or {{ean13 .gtin "format=png"}}. Sizes are in mm.
 // @Summary      Update Design
 // @Tags         Design
 // @Accept       json
@@ -134,22 +179,27 @@ func (d *DesignAPI) UpdateDesign(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	ds, err := d.designRepo.GetById(context.TODO(), userId, designId)
-	if err != nil {
-		logging.WithContext(ctx).WithError(err)
-		httputils.InternalServerError(context.TODO(), w, ErrDesignUnableToGetDesign)
+	ds, ok := d.getDesign(w, r, userId, designId)
+	if !ok {
+		return
+	}
+	if !ds.Access.CanEdit() {
+		httputils.Forbidden(ctx, w, ErrDesignReadOnly)
 		return
 	}
 
 	var t UpdateDesignRequest
-	err = httputils.ReadJson(r, &t)
+	err := httputils.ReadJson(r, &t)
 	if err != nil {
-		logging.WithContext(ctx).WithError(err)
+		logging.WithContext(ctx).WithError(err).Debug("unable to read request")
 		httputils.BadRequest(context.TODO(), w, ErrDesignUnableToReadRequest)
 		return
 	}
 
 	err = t.Validate()
+	if err == nil {
+		err = validateDesign(t.Type, t.Render, t.Invoice, t.Draft, d.renderEngine)
+	}
 	if err != nil {
 		logging.WithField(logging.Field{Label: "validation", Value: err.Error()}).Debug("validation failed")
 		httputils.BadRequest(context.TODO(), w, err)
@@ -157,53 +207,70 @@ func (d *DesignAPI) UpdateDesign(w http.ResponseWriter, r *http.Request) {
 	}
 
 	ds = design.Design{
-		Id:     designId,
-		Name:   t.Name,
-		Fields: nil,
+		Id:      designId,
+		Name:    t.Name,
+		Type:    t.Type,
+		Fields:  nil,
+		Render:  t.Render,
+		Invoice: t.Invoice,
+		Draft:   t.Draft,
 	}
 
 	dt, err := base64.StdEncoding.DecodeString(t.Design)
 	if err != nil {
-		logging.WithContext(ctx).WithError(err)
+		logging.WithContext(ctx).WithError(err).Debug("design is not base64 encoded")
 		httputils.BadRequest(context.TODO(), w, ErrDesignMustBeBase64Encoded)
 		return
 	}
 
-	//validate if valid design
-	ws := string(dt)
-	_, err = template.New(t.Name).Parse(ws)
-	if err != nil {
-		logging.WithContext(ctx).WithError(err)
-		httputils.BadRequest(context.TODO(), w, ErrDesignInvalidHTML)
-		return
-	}
+	if ds.IsForm() {
+		if !formDesign(ctx, w, &ds, dt) {
+			return
+		}
+	} else {
+		//validate if valid design
+		ws := string(dt)
+		_, err = design.Parse(t.Name, ws)
+		if err != nil {
+			logging.WithContext(ctx).WithError(err).Debug("invalid html design")
+			httputils.BadRequest(context.TODO(), w, ErrDesignInvalidHTML)
+			return
+		}
 
-	mt, err := d.minifier.HTML(ws)
-	if err != nil {
-		logging.WithContext(ctx).WithError(err)
-		httputils.InternalServerError(context.TODO(), w, ErrDesignUnableToMinify)
-		return
-	}
+		mt, err := d.minifier.HTML(ws)
+		if err != nil {
+			logging.WithContext(ctx).WithError(err).Error("unable to minify design")
+			httputils.InternalServerError(context.TODO(), w, ErrDesignUnableToMinify)
+			return
+		}
 
-	ds.Template = mt
+		ds.Template = mt
+	}
 
 	if t.Fields != nil {
 		ds.Fields = &t.Fields
 	}
 	ds.UpdatedAt = time.Now().UTC()
 
-	err = d.designRepo.Update(context.Background(), ds)
+	err = d.designRepo.Update(ctx, userId, ds)
+	if errors.Is(err, design.ErrDesignNotFound) {
+		httputils.Forbidden(ctx, w, ErrDesignReadOnly)
+		return
+	}
 	if err != nil {
-		logging.WithContext(ctx).WithError(err)
+		logging.WithContext(ctx).WithError(err).Error("unable to update design")
 		httputils.InternalServerError(context.TODO(), w, ErrDesignUnableToUpdate)
 		return
 	}
+	d.auditor.Record(ctx, audit.Event{Action: audit.ActionDesignUpdated, TargetType: audit.TargetDesign, TargetId: ds.Id, Metadata: audit.Metadata{"name": ds.Name}})
+	d.thumbnailer.Refresh(ds)
 
 	httputils.OK(context.TODO(), w, UpdateDesignResponse{Id: ds.Id})
 }
 
 // GetDesign func for updating new design.
 // @Description  Get a Design.
+// @Description  Designs of type pdf-form list the fields of their pdf as schema.
 // @Summary      Get Design
 // @Tags         Design
 // @Accept       json
@@ -222,14 +289,27 @@ func (d *DesignAPI) GetDesign(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	ds, err := d.designRepo.GetById(context.TODO(), userId, designId)
-	if err != nil {
-		logging.WithContext(ctx).WithError(err)
-		httputils.InternalServerError(context.TODO(), w, ErrDesignUnableToGetDesign)
+	ds, ok := d.getDesign(w, r, userId, designId)
+	if !ok {
 		return
 	}
 
-	httputils.OK(context.TODO(), w, GetDesignResponse(ds))
+	if ds.IsForm() {
+		ds.Schema, _ = pdfops.FormFields(ds.Form)
+	}
+
+	httputils.OK(ctx, w, GetDesignResponse(ds))
+}
+
+// formDesign keeps the pdf of a pdf-form design, it must have form fields.
+func formDesign(ctx context.Context, w http.ResponseWriter, ds *design.Design, b []byte) bool {
+	if _, err := pdfops.FormFields(b); err != nil {
+		logging.WithContext(ctx).WithError(err).Debug("invalid pdf form")
+		httputils.BadRequest(ctx, w, ErrDesignInvalidForm)
+		return false
+	}
+	ds.Form = b
+	return true
 }
 
 // ListDesign func for updating new design.
@@ -286,6 +366,7 @@ func (d *DesignAPI) ListDesign(w http.ResponseWriter, r *http.Request) {
 		Limit:  c,
 		Page:   p,
 	}
+	lq.OrganizationId, _ = contexts.OrganizationIdFromContext(ctx)
 
 	var ds []design.Design
 	var pagi pagination.Pagination
@@ -336,25 +417,33 @@ func (d *DesignAPI) DeleteDesign(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	_, err := d.designRepo.GetById(context.TODO(), userId, designId)
-	if err != nil {
-		logging.WithContext(ctx).WithError(err)
-		httputils.InternalServerError(context.TODO(), w, ErrDesignUnableToGetDesign)
+	ds, ok := d.getDesign(w, r, userId, designId)
+	if !ok {
+		return
+	}
+	if !ds.CanManage() {
+		httputils.Forbidden(ctx, w, ErrDesignReadOnly)
 		return
 	}
 
-	err = d.designRepo.Delete(context.TODO(), userId, designId)
+	err := d.designRepo.Delete(ctx, userId, designId)
+	if errors.Is(err, design.ErrDesignNotFound) {
+		httputils.Forbidden(ctx, w, ErrDesignReadOnly)
+		return
+	}
 	if err != nil {
 		logging.WithContext(ctx).Error(err.Error())
 		httputils.InternalServerError(context.TODO(), w, errors.New("unable to get design by id"))
 		return
 	}
+	d.auditor.Record(ctx, audit.Event{Action: audit.ActionDesignDeleted, TargetType: audit.TargetDesign, TargetId: designId, Metadata: audit.Metadata{"name": ds.Name}})
 	httputils.OK(context.TODO(), w, DeleteDesignResponse{Id: designId})
 
 }
 
 // ValidateDesign func for updating new design.
 // @Description  Validate a Design.
+// @Description  Warnings list accessibility problems of the html: images without alt text, a missing <html lang> and text of low contrast.
 // @Summary      Validate Design
 // @Tags         Design
 // @Accept       json
@@ -391,7 +480,7 @@ func (d *DesignAPI) ValidateDesign(w http.ResponseWriter, req *http.Request) {
 
 	ws := string(dt)
 	//validate if valid design
-	_, err = template.New(t.Name).Parse(ws)
+	_, err = design.Parse(t.Name, ws)
 	if err != nil {
 		logging.WithContext(ctx).Error(err.Error())
 		httputils.BadRequest(context.TODO(), w, ErrDesignInvalidHTML)
@@ -399,7 +488,7 @@ func (d *DesignAPI) ValidateDesign(w http.ResponseWriter, req *http.Request) {
 	}
 
 	if t.Fields != nil {
-		tl, err := template.New(t.Name).Parse(t.Design)
+		tl, err := design.Parse(t.Name, ws)
 		if err != nil {
 			logging.WithContext(ctx).Error(err.Error())
 			httputils.BadRequest(context.TODO(), w, ErrDesignUnableToParseDesign)
@@ -411,12 +500,24 @@ func (d *DesignAPI) ValidateDesign(w http.ResponseWriter, req *http.Request) {
 		err = tl.Execute(&buf, t.Fields)
 		if err != nil {
 			logging.WithContext(ctx).Error(err.Error())
+			var code *barcode.Error
+			if errors.As(err, &code) {
+				httputils.BadRequest(context.TODO(), w, pgerror.ValidationError(code.Error()))
+				return
+			}
 			httputils.BadRequest(context.TODO(), w, ErrDesignUnableToMatchFieldsToDesign)
 			return
 		}
 
 	}
-	httputils.OK(context.TODO(), w, ValidateDesignResponse{Message: "design is good to go"})
+
+	warnings, err := htmlrender.Lint(strings.NewReader(ws))
+	if err != nil {
+		logging.WithContext(ctx).Error(err.Error())
+		httputils.BadRequest(context.TODO(), w, ErrDesignInvalidHTML)
+		return
+	}
+	httputils.OK(context.TODO(), w, ValidateDesignResponse{Message: "design is good to go", Warnings: warnings})
 }
 
 // getUserIdAndDesignId get userId from context
@@ -447,5 +548,22 @@ func (d *DesignAPI) getUserIdAndDesignId(w http.ResponseWriter, req *http.Reques
 		httputils.BadRequest(context.TODO(), w, pgerror.ErrUnableToGetUserIdFromContext)
 		return "", ""
 	}
-	return designId, userId
+	return userId, designId
+}
+
+// getDesign gets a design the user has access to, designs of other users
+// and organizations are reported as not found.
+func (d *DesignAPI) getDesign(w http.ResponseWriter, req *http.Request, userId, designId string) (design.Design, bool) {
+	ctx := req.Context()
+	ds, err := d.designRepo.GetById(ctx, userId, designId)
+	if err != nil {
+		if errors.Is(err, design.ErrDesignNotFound) {
+			httputils.NotFound(ctx, w, ErrDesignNotFound)
+			return design.Design{}, false
+		}
+		logging.WithContext(ctx).WithError(err).Error("unable to get design")
+		httputils.InternalServerError(ctx, w, ErrDesignUnableToGetDesign)
+		return design.Design{}, false
+	}
+	return ds, true
 }
@@ -1,9 +1,14 @@
 package main
 
 import (
+	"encoding/base64"
 	"github.com/google/uuid"
 	"github.com/rengas/pdfgen/pkg/design"
+	"github.com/rengas/pdfgen/pkg/pdfrender"
+	"net/http"
+	"net/http/httptest"
 	"reflect"
+	"strings"
 	"testing"
 )
 
@@ -63,3 +68,31 @@ func TestGetDesignModel(t *testing.T) {
 
 	}
 }
+
+func TestValidateDesign(t *testing.T) {
+	tests := []struct {
+		name     string
+		design   string
+		fields   string
+		wantCode int
+		wantBody string
+	}{
+		{name: "barcode", design: `<p>{{ean13 .gtin}}</p>`, fields: `{"gtin": "4006381333931"}`, wantCode: http.StatusOK},
+		{name: "wrong check digit", design: `<p>{{ean13 .gtin}}</p>`, fields: `{"gtin": "4006381333932"}`, wantCode: http.StatusBadRequest, wantBody: "ean13: check digit does not match"},
+		{name: "unknown function", design: `<p>{{aztec .gtin}}</p>`, fields: `{"gtin": "4006381333931"}`, wantCode: http.StatusBadRequest, wantBody: string(ErrDesignInvalidHTML)},
+	}
+
+	api := NewDesignAPI(nil, nil, nil, nil, pdfrender.EngineWkhtmltopdf)
+	for _, tc := range tests {
+		body := `{"name": "label", "design": "` + base64.StdEncoding.EncodeToString([]byte(tc.design)) + `", "fields": ` + tc.fields + `}`
+		rec := httptest.NewRecorder()
+		api.ValidateDesign(rec, httptest.NewRequest(http.MethodPost, "/design/validate", strings.NewReader(body)))
+
+		if rec.Code != tc.wantCode {
+			t.Fatalf("%s: expected: %v, got: %v %s", tc.name, tc.wantCode, rec.Code, rec.Body)
+		}
+		if !strings.Contains(rec.Body.String(), tc.wantBody) {
+			t.Fatalf("%s: expected: %v, got: %v", tc.name, tc.wantBody, rec.Body)
+		}
+	}
+}
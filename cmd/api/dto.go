@@ -3,11 +3,21 @@ package main
 import (
 	"errors"
 	"fmt"
+	"github.com/rengas/pdfgen/pkg/audit"
+	"github.com/rengas/pdfgen/pkg/certificate"
 	"github.com/rengas/pdfgen/pkg/design"
 	pgerrror "github.com/rengas/pdfgen/pkg/errors"
+	"github.com/rengas/pdfgen/pkg/facturx"
+	"github.com/rengas/pdfgen/pkg/htmlrender"
+	"github.com/rengas/pdfgen/pkg/lockout"
+	"github.com/rengas/pdfgen/pkg/organization"
 	"github.com/rengas/pdfgen/pkg/pagination"
+	"github.com/rengas/pdfgen/pkg/pdfops"
+	"github.com/rengas/pdfgen/pkg/pdfrender"
+	"github.com/rengas/pdfgen/pkg/usage"
 	"github.com/rengas/pdfgen/pkg/user"
 	"reflect"
+	"strings"
 	"time"
 )
 
@@ -16,6 +26,7 @@ const (
 	ErrAuthPasswordInvalidLength         pgerrror.ValidationError = "password is less than 8 characters"
 	ErrAuthEmailIsEmpty                  pgerrror.ValidationError = "email is empty"
 	ErrAuthEmailExists                   pgerrror.ValidationError = "user with email exists"
+	ErrAuthTooManyAttempts               pgerrror.ValidationError = "too many failed login attempts, try again later"
 	ErrUserEmailIsEmpty                  pgerrror.ValidationError = "email is empty"
 	ErrUserWithEmailExists               pgerrror.ValidationError = "user with this email exists"
 	ErrDesignNameIsEmpty                 pgerrror.ValidationError = "name is empty"
@@ -36,6 +47,119 @@ const (
 	ErrDesignUnableToGetDesign           pgerrror.ValidationError = "unable to get design"
 	ErrDesignUnableToParseDesign         pgerrror.ValidationError = "unable to parse design"
 	ErrDesignUnableToMatchFieldsToDesign pgerrror.ValidationError = "unable to match fields to design"
+	ErrMFATokenIsEmpty                   pgerrror.ValidationError = "mfaToken is empty"
+	ErrMFACodeIsEmpty                    pgerrror.ValidationError = "code or recoveryCode is required"
+	ErrMFAInvalidCode                    pgerrror.ValidationError = "invalid two-factor code"
+	ErrMFAAlreadyEnabled                 pgerrror.ValidationError = "two-factor authentication is already enabled"
+	ErrMFANotEnrolled                    pgerrror.ValidationError = "two-factor authentication is not enrolled"
+	ErrMFANotEnabled                     pgerrror.ValidationError = "two-factor authentication is not enabled"
+	ErrSSOStateIsEmpty                   pgerrror.ValidationError = "state is empty"
+	ErrSSOCodeIsEmpty                    pgerrror.ValidationError = "code is empty"
+	ErrSSOLoginExpired                   pgerrror.ValidationError = "login expired, start again"
+	ErrSSOProviderError                  pgerrror.ValidationError = "identity provider rejected the login"
+	ErrSSOEmailMissing                   pgerrror.ValidationError = "identity provider did not return an email"
+	ErrSSOEmailNotVerified               pgerrror.ValidationError = "a user with this email exists and the provider did not verify it"
+	ErrOrganizationNameIsEmpty           pgerrror.ValidationError = "name is empty"
+	ErrOrganizationEmailIsEmpty          pgerrror.ValidationError = "email is empty"
+	ErrOrganizationNotFound              pgerrror.ValidationError = "organization not found"
+	ErrOrganizationNotOwner              pgerrror.ValidationError = "only owners can manage members"
+	ErrOrganizationNotEditor             pgerrror.ValidationError = "viewers can not create or change designs"
+	ErrOrganizationInvalidRole           pgerrror.ValidationError = "role must be one of owner, editor or viewer"
+	ErrOrganizationMemberNotFound        pgerrror.ValidationError = "member not found"
+	ErrOrganizationMemberExists          pgerrror.ValidationError = "user is already a member"
+	ErrOrganizationLastOwner             pgerrror.ValidationError = "organization must keep at least one owner"
+	ErrOrganizationUserNotFound          pgerrror.ValidationError = "no user with this email"
+	ErrDesignNotFound                    pgerrror.ValidationError = "design not found"
+	ErrDesignReadOnly                    pgerrror.ValidationError = "no permission to change this design"
+	ErrShareEmailIsEmpty                 pgerrror.ValidationError = "email is empty"
+	ErrShareInvalidPermission            pgerrror.ValidationError = "permission must be one of read, generate or edit"
+	ErrShareNotAllowed                   pgerrror.ValidationError = "no permission to share this design"
+	ErrShareWithSelf                     pgerrror.ValidationError = "can not share a design with yourself"
+	ErrShareExists                       pgerrror.ValidationError = "design is already shared with this user"
+	ErrShareNotFound                     pgerrror.ValidationError = "share not found"
+	ErrAuditFromInvalid                  pgerrror.ValidationError = "from must be an RFC 3339 time"
+	ErrAuditToInvalid                    pgerrror.ValidationError = "to must be an RFC 3339 time"
+	ErrAuditOtherActor                   pgerrror.ValidationError = "only admins can read events of other users"
+	ErrAdminLockoutKeyIsEmpty            pgerrror.ValidationError = "key is empty"
+	ErrAdminLockoutNotFound              pgerrror.ValidationError = "lockout not found"
+	ErrAdminUserNotFound                 pgerrror.ValidationError = "user not found"
+	ErrAdminPlanInvalid                  pgerrror.ValidationError = "plan must be one of free, starter or business"
+	ErrUsageDocumentLimit                pgerrror.ValidationError = "monthly document limit of your plan reached"
+	ErrRenderQueueFull                   pgerrror.ValidationError = "too many documents are being rendered, try again shortly"
+	ErrRenderTimeout                     pgerrror.ValidationError = "rendering the document took too long"
+	ErrRenderEngineUnavailable           pgerrror.ValidationError = "render engine of the design is not enabled on this server"
+	ErrRenderImageUnsupported            pgerrror.ValidationError = "render engine of the design can not render this image format"
+	ErrRenderPageOutOfRange              pgerrror.ValidationError = "page is out of range"
+	ErrGenerateWidthInvalid              pgerrror.ValidationError = "width must be between 0 and 4000"
+	ErrGenerateDPIInvalid                pgerrror.ValidationError = "dpi must be between 0 and 600"
+	ErrGeneratePageInvalid               pgerrror.ValidationError = "page can not be negative"
+	ErrGenerateQualityInvalid            pgerrror.ValidationError = "quality must be between 0 and 100"
+	ErrThumbnailNotFound                 pgerrror.ValidationError = "thumbnail is not generated yet"
+	ErrDesignRenderEngineInvalid         pgerrror.ValidationError = "render engine must be one of wkhtmltopdf, builtin or chromium"
+	ErrDesignPageSizeInvalid             pgerrror.ValidationError = "page size must be one of A3, A4, A5, Letter or Legal"
+	ErrDesignMarginInvalid               pgerrror.ValidationError = "margins can not be negative"
+	ErrUsagePageLimit                    pgerrror.ValidationError = "monthly page limit of your plan reached"
+	ErrComposePartsEmpty                 pgerrror.ValidationError = "parts are empty"
+	ErrComposeTooManyParts               pgerrror.ValidationError = "at most 20 parts can be composed"
+	ErrWatermarkEmpty                    pgerrror.ValidationError = "watermark needs a text or an image"
+	ErrWatermarkPositionInvalid          pgerrror.ValidationError = "watermark position must be one of center, top, bottom, top-left, top-right, bottom-left or bottom-right"
+	ErrWatermarkOpacityInvalid           pgerrror.ValidationError = "watermark opacity must be between 0 and 1"
+	ErrWatermarkPagesInvalid             pgerrror.ValidationError = "watermark pages must be like 1-3,5 or 2-"
+	ErrWatermarkColorInvalid             pgerrror.ValidationError = "watermark color must be #rrggbb"
+	ErrWatermarkSizeInvalid              pgerrror.ValidationError = "watermark sizes can not be negative"
+	ErrWatermarkImageInvalid             pgerrror.ValidationError = "watermark image must be a base64 encoded png, jpeg or gif"
+	ErrWatermarkTooMany                  pgerrror.ValidationError = "at most 5 watermarks can be applied"
+	ErrWatermarkImageOutput              pgerrror.ValidationError = "watermarks apply to pdf output only"
+	ErrEncryptionAlgorithmInvalid        pgerrror.ValidationError = "encryption algorithm must be aes-128 or aes-256"
+	ErrEncryptionPasswordInvalid         pgerrror.ValidationError = "unable to read the password from the fields of the design"
+	ErrEncryptionPasswordEmpty           pgerrror.ValidationError = "password from the fields is empty"
+	ErrEncryptionImageOutput             pgerrror.ValidationError = "encryption applies to pdf output only"
+	ErrCertificateNameIsEmpty            pgerrror.ValidationError = "name is empty"
+	ErrCertificatePKCS12IsEmpty          pgerrror.ValidationError = "pkcs12 is empty"
+	ErrCertificatePKCS12TooLarge         pgerrror.ValidationError = "pkcs12 file is larger than 64KB"
+	ErrCertificatePKCS12Invalid          pgerrror.ValidationError = "pkcs12 must be a base64 encoded pkcs12 file with a private key and its certificate"
+	ErrCertificatePKCS12Password         pgerrror.ValidationError = "pkcs12 password is incorrect"
+	ErrCertificatePKCS12Unsupported      pgerrror.ValidationError = "pkcs12 encryption is not supported, export the file with 3DES or RC2, e.g. openssl pkcs12 -legacy"
+	ErrCertificateExpired                pgerrror.ValidationError = "certificate is expired or not yet valid"
+	ErrCertificateNotFound               pgerrror.ValidationError = "certificate not found"
+	ErrSignatureCertificateIdIsEmpty     pgerrror.ValidationError = "signature certificateId is empty"
+	ErrSignatureBoxInvalid               pgerrror.ValidationError = "signature box needs a page of at least 0 and a positive width and height"
+	ErrSignaturePageOutOfRange           pgerrror.ValidationError = "signature page is out of range"
+	ErrSignatureEncryption               pgerrror.ValidationError = "signed pdfs can not be encrypted"
+	ErrSignatureImageOutput              pgerrror.ValidationError = "signatures apply to pdf output only"
+	ErrDesignPDFAInvalid                 pgerrror.ValidationError = "pdfa must be 2b or 3b"
+	ErrDesignPDFAEngine                  pgerrror.ValidationError = "pdfa needs the chromium or wkhtmltopdf engine, the builtin engine does not embed fonts"
+	ErrPDFAEncryption                    pgerrror.ValidationError = "pdf/a documents can not be encrypted"
+	ErrPDFASignatureBox                  pgerrror.ValidationError = "signatures of pdf/a documents must be invisible"
+	ErrInvoiceProfileInvalid             pgerrror.ValidationError = "invoice profile must be one of MINIMUM, BASIC WL, BASIC or EN 16931"
+	ErrInvoiceItemsRequired              pgerrror.ValidationError = "invoice profiles BASIC and EN 16931 need the items of the invoice"
+	ErrInvoiceTemplateInvalid            pgerrror.ValidationError = "invoice mapping has an invalid template"
+	ErrInvoicePDFA                       pgerrror.ValidationError = "invoices are pdf/a-3b, pdfa can not be 2b"
+	ErrInvoiceEngine                     pgerrror.ValidationError = "invoices need the chromium or wkhtmltopdf engine, the builtin engine does not embed fonts"
+	ErrAttachmentNameIsEmpty             pgerrror.ValidationError = "attachment name is empty"
+	ErrAttachmentDataIsEmpty             pgerrror.ValidationError = "attachment data is empty"
+	ErrAttachmentMediaTypeInvalid        pgerrror.ValidationError = "attachment media type must be like text/xml"
+	ErrAttachmentRelationshipInvalid     pgerrror.ValidationError = "attachment relationship must be one of Source, Data, Alternative, Supplement or Unspecified"
+	ErrAttachmentTooMany                 pgerrror.ValidationError = "at most 10 files can be attached"
+	ErrAttachmentTooLarge                pgerrror.ValidationError = "attachments can be at most 10MB together"
+	ErrAttachmentImageOutput             pgerrror.ValidationError = "attachments apply to pdf output only"
+	ErrAttachmentPDFA2B                  pgerrror.ValidationError = "pdf/a-2b documents can not have attachments"
+	ErrDesignMetadataInvalid             pgerrror.ValidationError = "metadata has an invalid template"
+	ErrDesignPDFATOC                     pgerrror.ValidationError = "pdf/a documents can not have a table of contents, it does not embed fonts"
+	ErrPDFADraft                         pgerrror.ValidationError = "draft designs can not be pdf/a or have an invoice, the DRAFT watermark does not embed its font"
+	ErrPDFAWatermarkText                 pgerrror.ValidationError = "watermarks of pdf/a documents must be images, text watermarks do not embed their font"
+	ErrInvoiceTOC                        pgerrror.ValidationError = "invoices are pdf/a-3b and can not have a table of contents"
+	ErrMetadataFields                    pgerrror.ValidationError = "metadata does not match the fields of the design"
+	ErrDesignAccessibleEngine            pgerrror.ValidationError = "accessible pdfs need the chromium or builtin engine"
+	ErrDesignAccessibleTOC               pgerrror.ValidationError = "accessible pdfs can not have a table of contents, it is not tagged"
+	ErrDesignFormsEngine                 pgerrror.ValidationError = "form fields need the builtin or wkhtmltopdf engine"
+	ErrDesignFlattenForms                pgerrror.ValidationError = "flattenForms needs forms"
+	ErrDesignAccessibleForms             pgerrror.ValidationError = "accessible pdfs can not have form fields, they are not tagged"
+	ErrDesignTypeInvalid                 pgerrror.ValidationError = "type must be html or pdf-form"
+	ErrDesignInvalidForm                 pgerrror.ValidationError = "pdf-form design must be a pdf with form fields"
+	ErrDesignFormRender                  pgerrror.ValidationError = "pdf-form designs can only have metadata and flattenForms render options"
+	ErrDesignFormInvoice                 pgerrror.ValidationError = "pdf-form designs can not have an invoice mapping, filled fields do not embed fonts"
+	ErrFormImageOutput                   pgerrror.ValidationError = "pdf-form designs generate pdf output only"
 )
 
 type LoginRequest struct {
@@ -59,9 +183,73 @@ type User struct {
 }
 
 type LoginResponse struct {
-	User         User   `json:"user"`
-	AccessToken  string `json:"accessToken" example:"JWT token format"`
-	RefreshToken string `json:"refreshToken"  example:"JWT token format"`
+	User           User   `json:"user"`
+	AccessToken    string `json:"accessToken,omitempty" example:"JWT token format"`
+	RefreshToken   string `json:"refreshToken,omitempty"  example:"JWT token format"`
+	MFARequired    bool   `json:"mfaRequired,omitempty"`
+	MFAToken       string `json:"mfaToken,omitempty" example:"JWT token format"`
+	OrganizationId string `json:"organizationId,omitempty" example:"5b0d3a4e-54c2-4c4a-9a57-4f2d0b1c8e21"`
+}
+
+type LoginMFARequest struct {
+	MFAToken     string `json:"mfaToken" validate:"required" example:"JWT token format"`
+	Code         string `json:"code" example:"123456"`
+	RecoveryCode string `json:"recoveryCode" example:"abcd-efgh"`
+}
+
+func (r LoginMFARequest) Validate() error {
+	if r.MFAToken == "" {
+		return ErrMFATokenIsEmpty
+	}
+	if r.Code == "" && r.RecoveryCode == "" {
+		return ErrMFACodeIsEmpty
+	}
+	return nil
+}
+
+type EnrolTOTPResponse struct {
+	Secret string `json:"secret" example:"JBSWY3DPEHPK3PXP"`
+	URI    string `json:"uri" example:"otpauth://totp/pdfgen:John@email.com?secret=JBSWY3DPEHPK3PXP&issuer=pdfgen"`
+	QRCode string `json:"qrCode" example:"data:image/png;base64,iVBORw0KGgo..."`
+}
+
+type MFACodeRequest struct {
+	Code         string `json:"code" example:"123456"`
+	RecoveryCode string `json:"recoveryCode" example:"abcd-efgh"`
+}
+
+func (r MFACodeRequest) Validate() error {
+	if r.Code == "" && r.RecoveryCode == "" {
+		return ErrMFACodeIsEmpty
+	}
+	return nil
+}
+
+type RecoveryCodesResponse struct {
+	RecoveryCodes []string `json:"recoveryCodes" example:"abcd-efgh"`
+}
+
+type ListLockoutResponse struct {
+	Lockouts []lockout.Entry `json:"lockouts"`
+}
+
+type UnlockRequest struct {
+	Key string `json:"key" validate:"required" example:"account:John@email.com"`
+}
+
+func (r UnlockRequest) Validate() error {
+	if r.Key == "" {
+		return ErrAdminLockoutKeyIsEmpty
+	}
+	return nil
+}
+
+type UnlockResponse struct {
+	Key string `json:"key" example:"account:John@email.com"`
+}
+
+type DisableMFAResponse struct {
+	Message string `json:"message" example:"two-factor authentication disabled"`
 }
 
 type RegisterRequest struct {
@@ -108,7 +296,7 @@ func (c ValidateDesignRequest) Validate() error {
 			switch v.Kind() {
 			case reflect.Int, reflect.Int8, reflect.Int32, reflect.Int64, reflect.Uint, reflect.Uint8,
 				reflect.Uint32, reflect.Uint64, reflect.Float32, reflect.Float64, reflect.String, reflect.Slice,
-				reflect.Array, reflect.Map:
+				reflect.Array, reflect.Map, reflect.Bool:
 				continue
 			default:
 				return ErrDesignUnsupportedFieldType
@@ -120,14 +308,24 @@ func (c ValidateDesignRequest) Validate() error {
 }
 
 type ValidateDesignResponse struct {
-	Message string `json:"id" example:"99d15987-e06f-492c-a520-e54185e5b80b"`
+	Message  string               `json:"id" example:"99d15987-e06f-492c-a520-e54185e5b80b"`
+	Warnings []htmlrender.Warning `json:"warnings"`
 }
 
 type CreateDesignRequest struct {
-	Name   string       `json:"name"`
-	UserId string       `json:"userId"`
-	Design string       `json:"design"`
-	Fields design.Attrs `json:"fields"`
+	Name string `json:"name"`
+	// Type is html or pdf-form, empty is html.
+	Type   string             `json:"type" example:"html"`
+	UserId string             `json:"userId"`
+	Design string             `json:"design"`
+	Fields design.Attrs       `json:"fields"`
+	Render *pdfrender.Options `json:"render"`
+	// Invoice maps the fields to a Factur-X invoice, generated pdfs embed it
+	// and are PDF/A-3b.
+	Invoice *facturx.Mapping `json:"invoice,omitempty"`
+	// Draft designs are generated with a DRAFT watermark, they can not be
+	// PDF/A or have an invoice.
+	Draft bool `json:"draft"`
 }
 
 func (c CreateDesignRequest) Validate() error {
@@ -150,7 +348,7 @@ func (c CreateDesignRequest) Validate() error {
 			switch v.Kind() {
 			case reflect.Int, reflect.Int8, reflect.Int32, reflect.Int64, reflect.Uint, reflect.Uint8,
 				reflect.Uint32, reflect.Uint64, reflect.Float32, reflect.Float64, reflect.String, reflect.Slice,
-				reflect.Array, reflect.Map:
+				reflect.Array, reflect.Map, reflect.Bool:
 				continue
 			default:
 				return ErrDesignUnsupportedFieldType
@@ -161,14 +359,120 @@ func (c CreateDesignRequest) Validate() error {
 	return nil
 }
 
+// validateDesign checks the render options and invoice mapping of a design
+// of the type, pdf-form designs are not rendered so most options do not
+// apply to them. Options without engine are checked against defaultEngine.
+// Draft designs can not be PDF/A.
+func validateDesign(typ string, o *pdfrender.Options, m *facturx.Mapping, draft bool, defaultEngine string) error {
+	switch typ {
+	case "", design.TypeHTML:
+	case design.TypePDFForm:
+		if m != nil {
+			return ErrDesignFormInvoice
+		}
+		if o == nil {
+			return nil
+		}
+		if *o != (pdfrender.Options{Metadata: o.Metadata, FlattenForms: o.FlattenForms}) {
+			return ErrDesignFormRender
+		}
+		return validateRender(&pdfrender.Options{Metadata: o.Metadata})
+	default:
+		return ErrDesignTypeInvalid
+	}
+	if o != nil {
+		resolved := o.WithDefaultEngine(defaultEngine)
+		o = &resolved
+	}
+	if err := validateRender(o); err != nil {
+		return err
+	}
+	if draft && (m != nil || o != nil && o.PDFA != "") {
+		return ErrPDFADraft
+	}
+	return validateInvoice(m, o)
+}
+
+// validateRender checks the render options of a design, no options render
+// with the defaults.
+func validateRender(o *pdfrender.Options) error {
+	if o == nil {
+		return nil
+	}
+	switch o.Validate() {
+	case nil:
+		return nil
+	case pdfrender.ErrUnknownEngine:
+		return ErrDesignRenderEngineInvalid
+	case pdfrender.ErrUnknownPageSize:
+		return ErrDesignPageSizeInvalid
+	case pdfrender.ErrUnknownPDFA:
+		return ErrDesignPDFAInvalid
+	case pdfrender.ErrPDFAEngine:
+		return ErrDesignPDFAEngine
+	case pdfrender.ErrPDFATOC:
+		return ErrDesignPDFATOC
+	case pdfrender.ErrMetadata:
+		return ErrDesignMetadataInvalid
+	case pdfrender.ErrAccessible:
+		return ErrDesignAccessibleEngine
+	case pdfrender.ErrAccessibleTOC:
+		return ErrDesignAccessibleTOC
+	case pdfrender.ErrForms:
+		return ErrDesignFormsEngine
+	case pdfrender.ErrFlattenForms:
+		return ErrDesignFlattenForms
+	case pdfrender.ErrAccessibleForms:
+		return ErrDesignAccessibleForms
+	default:
+		return ErrDesignMarginInvalid
+	}
+}
+
+// validateInvoice checks the invoice mapping of a design, invoices are
+// PDF/A-3b so they need fonts embedded.
+func validateInvoice(m *facturx.Mapping, o *pdfrender.Options) error {
+	if m == nil {
+		return nil
+	}
+	switch m.Validate() {
+	case nil:
+	case facturx.ErrProfile:
+		return ErrInvoiceProfileInvalid
+	case facturx.ErrItemsRequired:
+		return ErrInvoiceItemsRequired
+	default:
+		return ErrInvoiceTemplateInvalid
+	}
+	if o != nil && o.PDFA == pdfops.PDFA2B {
+		return ErrInvoicePDFA
+	}
+	if o != nil && o.Engine == pdfrender.EngineBuiltin {
+		return ErrInvoiceEngine
+	}
+	if o != nil && o.TOC {
+		return ErrInvoiceTOC
+	}
+	return nil
+}
+
 type CreateDesignResponse struct {
 	Id string `json:"id" example:"99d15987-e06f-492c-a520-e54185e5b80b"`
 }
 
 type UpdateDesignRequest struct {
-	Name   string       `json:"name"`
-	Design string       `json:"design"`
-	Fields design.Attrs `json:"fields"`
+	Name string `json:"name"`
+	// Type is html or pdf-form, empty is html.
+	Type   string             `json:"type" example:"html"`
+	Design string             `json:"design"`
+	Fields design.Attrs       `json:"fields"`
+	Render *pdfrender.Options `json:"render"`
+	// Invoice maps the fields to a Factur-X invoice, generated pdfs embed it
+	// and are PDF/A-3b.
+	Invoice *facturx.Mapping `json:"invoice,omitempty"`
+	// Draft designs are generated with a DRAFT watermark, they can not be
+	// PDF/A or have an invoice.
+	Draft bool `json:"draft"`
 }
 
 func (c UpdateDesignRequest) Validate() error {
@@ -187,7 +491,7 @@ func (c UpdateDesignRequest) Validate() error {
 			switch v.Kind() {
 			case reflect.Int, reflect.Int8, reflect.Int32, reflect.Int64, reflect.Uint, reflect.Uint8,
 				reflect.Uint32, reflect.Uint64, reflect.Float32, reflect.Float64, reflect.String, reflect.Slice,
-				reflect.Array, reflect.Map:
+				reflect.Array, reflect.Map, reflect.Bool:
 				continue
 			default:
 				return errors.New(fmt.Sprintf("%s has unsupported type for value", k))
@@ -263,8 +567,46 @@ type DeleteDesignResponse struct {
 }
 
 type GeneratePDFRequest struct {
-	DesignId string       `json:"DesignId"`
-	Fields   design.Attrs `json:"fields"`
+	DesignId string `json:"DesignId"`
+	// Fields are laid over the stored fields of the design to fill its
+	// template, objects merge key by key and other values replace the stored
+	// ones. Designs of type pdf-form fill their form fields with them,
+	// checkboxes take true or false, radio groups and choices one of their
+	// options.
+	Fields design.Attrs `json:"fields"`
+	// Width in pixels or DPI, Page and Quality apply to image output.
+	Width   int `json:"width,omitempty"`
+	DPI     int `json:"dpi,omitempty"`
+	Page    int `json:"page,omitempty"`
+	Quality int `json:"quality,omitempty"`
+	// Watermarks are drawn over the pages of the pdf, those of PDF/A
+	// documents must be images. Documents and images of draft designs also
+	// get a DRAFT watermark.
+	Watermarks []pdfops.Watermark `json:"watermarks,omitempty"`
+	// Encryption protects the pdf with AES and passwords, they may be
+	// templates like {{.employee.dob}} reading a field of the design. PDF/A
+	// and signed documents can not be encrypted.
+	Encryption *pdfops.Encryption `json:"encryption,omitempty"`
+	// Signature signs the pdf with an uploaded certificate as PAdES-B-B,
+	// signatures of PDF/A documents must be invisible.
+	Signature *GenerateSignature `json:"signature,omitempty"`
+	// Attachments are files embedded in the pdf.
+	Attachments []pdfops.Attachment `json:"attachments,omitempty"`
+}
+
+type GenerateSignature struct {
+	CertificateId string `json:"certificateId"`
+	pdfops.Signature
+}
+
+func (g GeneratePDFRequest) imageOptions(contentType string) pdfrender.ImageOptions {
+	return pdfrender.ImageOptions{
+		Format:  strings.TrimPrefix(contentType, "image/"),
+		Width:   g.Width,
+		DPI:     g.DPI,
+		Page:    g.Page,
+		Quality: g.Quality,
+	}
 }
 
 func (g GeneratePDFRequest) Validate() error {
@@ -272,13 +614,46 @@ func (g GeneratePDFRequest) Validate() error {
 		return ErrDesignDesignIdIsEmpty
 	}
 
+	if g.Width < 0 || g.Width > pdfrender.MaxImageWidth {
+		return ErrGenerateWidthInvalid
+	}
+	if g.DPI < 0 || g.DPI > pdfrender.MaxDPI {
+		return ErrGenerateDPIInvalid
+	}
+	if g.Page < 0 {
+		return ErrGeneratePageInvalid
+	}
+	if g.Quality < 0 || g.Quality > 100 {
+		return ErrGenerateQualityInvalid
+	}
+	if err := validateWatermarks(g.Watermarks); err != nil {
+		return err
+	}
+	if g.Encryption != nil && g.Encryption.Validate() != nil {
+		return ErrEncryptionAlgorithmInvalid
+	}
+	if err := validateAttachments(g.Attachments); err != nil {
+		return err
+	}
+	if g.Signature != nil {
+		if g.Signature.CertificateId == "" {
+			return ErrSignatureCertificateIdIsEmpty
+		}
+		if g.Signature.Validate() != nil {
+			return ErrSignatureBoxInvalid
+		}
+		if g.Encryption != nil {
+			return ErrSignatureEncryption
+		}
+	}
+
 	if g.Fields != nil {
 		for _, v := range g.Fields {
 			v := reflect.ValueOf(v)
 			switch v.Kind() {
 			case reflect.Int, reflect.Int8, reflect.Int32, reflect.Int64, reflect.Uint, reflect.Uint8,
 				reflect.Uint32, reflect.Uint64, reflect.Float32, reflect.Float64, reflect.String, reflect.Slice,
-				reflect.Array, reflect.Map:
+				reflect.Array, reflect.Map, reflect.Bool:
 				continue
 			default:
 				return ErrDesignUnsupportedFieldType
@@ -288,3 +663,254 @@ func (g GeneratePDFRequest) Validate() error {
 
 	return nil
 }
+
+// maxComposeParts bounds the designs merged by one compose request.
+const maxComposeParts = 20
+
+type ComposePart struct {
+	DesignId string `json:"designId"`
+	// Fields are laid over the stored fields of the design like those of
+	// GeneratePDFRequest, parts of pdf-form designs are filled with them.
+	Fields design.Attrs `json:"fields,omitempty"`
+	// Title of the bookmark of the part, the design name when empty.
+	Title string `json:"title,omitempty"`
+}
+
+type ComposePDFRequest struct {
+	// Parts render with the options of their designs, parts of draft designs
+	// get a DRAFT watermark. The composed pdf is PDF/A at the level of the
+	// first part with the pdfa option and has the metadata of the first
+	// part. Bookmarks and tables of contents are replaced by the bookmarks
+	// of the parts, invoices are not embedded, the pdf is not tagged and
+	// form fields are flattened. Page numbers and totals in headers and
+	// footers run on across the parts.
+	Parts []ComposePart `json:"parts"`
+}
+
+func (c ComposePDFRequest) Validate() error {
+	if len(c.Parts) == 0 {
+		return ErrComposePartsEmpty
+	}
+	if len(c.Parts) > maxComposeParts {
+		return ErrComposeTooManyParts
+	}
+	for _, p := range c.Parts {
+		err := GeneratePDFRequest{DesignId: p.DesignId, Fields: p.Fields}.Validate()
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// maxWatermarks bounds the watermarks of a request.
+const maxWatermarks = 5
+
+// maxAttachments and maxAttachmentsSize bound the files of a request.
+const (
+	maxAttachments     = 10
+	maxAttachmentsSize = 10 << 20
+)
+
+func validateAttachments(as []pdfops.Attachment) error {
+	if len(as) > maxAttachments {
+		return ErrAttachmentTooMany
+	}
+	size := 0
+	for _, a := range as {
+		size += len(a.Data)
+		switch a.Validate() {
+		case nil:
+			continue
+		case pdfops.ErrAttachmentName:
+			return ErrAttachmentNameIsEmpty
+		case pdfops.ErrAttachmentEmpty:
+			return ErrAttachmentDataIsEmpty
+		case pdfops.ErrAttachmentMediaType:
+			return ErrAttachmentMediaTypeInvalid
+		default:
+			return ErrAttachmentRelationshipInvalid
+		}
+	}
+	if size > maxAttachmentsSize {
+		return ErrAttachmentTooLarge
+	}
+	return nil
+}
+
+func validateWatermarks(ws []pdfops.Watermark) error {
+	if len(ws) > maxWatermarks {
+		return ErrWatermarkTooMany
+	}
+	for _, w := range ws {
+		switch w.Validate() {
+		case nil:
+			continue
+		case pdfops.ErrWatermarkEmpty:
+			return ErrWatermarkEmpty
+		case pdfops.ErrWatermarkPosition:
+			return ErrWatermarkPositionInvalid
+		case pdfops.ErrWatermarkOpacity:
+			return ErrWatermarkOpacityInvalid
+		case pdfops.ErrWatermarkPageRange:
+			return ErrWatermarkPagesInvalid
+		case pdfops.ErrWatermarkColor:
+			return ErrWatermarkColorInvalid
+		case pdfops.ErrWatermarkNegativeSize:
+			return ErrWatermarkSizeInvalid
+		default:
+			return ErrWatermarkImageInvalid
+		}
+	}
+	return nil
+}
+
+// maxPKCS12Size bounds uploaded certificates, chains of a few certificates
+// take a few KB.
+const maxPKCS12Size = 64 << 10
+
+type CreateCertificateRequest struct {
+	Name string `json:"name" example:"Invoicing"`
+	// PKCS12 is the base64 encoded file with the private key and its chain.
+	PKCS12   []byte `json:"pkcs12"`
+	Password string `json:"password"`
+}
+
+func (r CreateCertificateRequest) Validate() error {
+	if r.Name == "" {
+		return ErrCertificateNameIsEmpty
+	}
+	if len(r.PKCS12) == 0 {
+		return ErrCertificatePKCS12IsEmpty
+	}
+	if len(r.PKCS12) > maxPKCS12Size {
+		return ErrCertificatePKCS12TooLarge
+	}
+	return nil
+}
+
+type ListCertificateResponse struct {
+	Certificates []certificate.Certificate `json:"certificates"`
+}
+
+type DeleteCertificateResponse struct {
+	Id string `json:"id"`
+}
+
+type CreateOrganizationRequest struct {
+	Name string `json:"name" validate:"required" example:"Acme Ltd"`
+}
+
+func (r CreateOrganizationRequest) Validate() error {
+	if r.Name == "" {
+		return ErrOrganizationNameIsEmpty
+	}
+	return nil
+}
+
+type CreateOrganizationResponse struct {
+	Id string `json:"id" example:"5b0d3a4e-54c2-4c4a-9a57-4f2d0b1c8e21"`
+}
+
+type ListOrganizationResponse struct {
+	Organizations []organization.Organization `json:"organizations"`
+}
+
+type SwitchOrganizationRequest struct {
+	OrganizationId string `json:"organizationId" example:"5b0d3a4e-54c2-4c4a-9a57-4f2d0b1c8e21"`
+}
+
+type ListMemberResponse struct {
+	Members []organization.Member `json:"members"`
+}
+
+type AddMemberRequest struct {
+	Email string            `json:"email" validate:"required" example:"John@email.com"`
+	Role  organization.Role `json:"role" validate:"required" example:"editor"`
+}
+
+func (r AddMemberRequest) Validate() error {
+	if r.Email == "" {
+		return ErrOrganizationEmailIsEmpty
+	}
+	if !r.Role.Valid() {
+		return ErrOrganizationInvalidRole
+	}
+	return nil
+}
+
+type UpdateMemberRequest struct {
+	Role organization.Role `json:"role" validate:"required" example:"viewer"`
+}
+
+func (r UpdateMemberRequest) Validate() error {
+	if !r.Role.Valid() {
+		return ErrOrganizationInvalidRole
+	}
+	return nil
+}
+
+type MemberResponse organization.Member
+
+type RemoveMemberResponse struct {
+	UserId string `json:"userId" example:"99d15987-e06f-492c-a520-e54185e5b80b"`
+}
+
+type ShareDesignRequest struct {
+	Email      string            `json:"email" validate:"required" example:"contractor@email.com"`
+	Permission design.Permission `json:"permission" validate:"required" example:"generate"`
+}
+
+func (r ShareDesignRequest) Validate() error {
+	if r.Email == "" {
+		return ErrShareEmailIsEmpty
+	}
+	if !r.Permission.Valid() {
+		return ErrShareInvalidPermission
+	}
+	return nil
+}
+
+type ShareResponse design.Share
+
+type ListShareResponse struct {
+	Shares []design.Share `json:"shares"`
+}
+
+type ListInvitationResponse struct {
+	Invitations []design.Share `json:"invitations"`
+}
+
+type RevokeShareResponse struct {
+	Id string `json:"id" example:"0c1f5f36-3a3e-4b8e-9d51-7f1d9a1e2b44"`
+}
+
+type ListAuditResponse struct {
+	Events     []audit.Event         `json:"events"`
+	Pagination pagination.Pagination `json:"pagination"`
+}
+
+type UsageResponse struct {
+	Plan        usage.Plan `json:"plan"`
+	PeriodStart time.Time  `json:"periodStart"`
+	PeriodEnd   time.Time  `json:"periodEnd"`
+	Documents   int64      `json:"documents" example:"12"`
+	Pages       int64      `json:"pages" example:"30"`
+	Bytes       int64      `json:"bytes" example:"482133"`
+}
+
+type SetPlanRequest struct {
+	Plan string `json:"plan" validate:"required" example:"starter"`
+}
+
+func (r SetPlanRequest) Validate() error {
+	if _, ok := usage.Plans[r.Plan]; !ok {
+		return ErrAdminPlanInvalid
+	}
+	return nil
+}
+
+type SetPlanResponse struct {
+	UserId string `json:"userId" example:"c0a8e4a2-2b47-4b8e-9d6f-1f0e6c1c2b11"`
+	Plan   string `json:"plan" example:"starter"`
+}
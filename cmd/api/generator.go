@@ -1,40 +1,70 @@
 package main
 
 import (
-	"bytes"
 	"context"
 	"errors"
+	"github.com/rengas/pdfgen/pkg/audit"
+	"github.com/rengas/pdfgen/pkg/barcode"
+	"github.com/rengas/pdfgen/pkg/certificate"
 	"github.com/rengas/pdfgen/pkg/contexts"
+	"github.com/rengas/pdfgen/pkg/design"
 	pgerror "github.com/rengas/pdfgen/pkg/errors"
 	"github.com/rengas/pdfgen/pkg/httputils"
 	"github.com/rengas/pdfgen/pkg/logging"
-	"html/template"
+	"github.com/rengas/pdfgen/pkg/pdfops"
+	"github.com/rengas/pdfgen/pkg/pdfrender"
+	"github.com/rengas/pdfgen/pkg/usage"
+	"io"
 	"net/http"
 	"strings"
+	"time"
 )
 
+// renderRetryAfter is suggested to clients when the render queue is full.
+const renderRetryAfter = 5 * time.Second
+
 type GeneratorAPI struct {
 	designRepo DesignRepository
+	userRepo   UserRepository
 	renderer   Renderer
+	auditor    Auditor
+	meter      UsageMeter
+	certRepo   CertificateRepository
+	vault      CertificateVault
 }
 
-func NewGeneratorAPI(designRepo DesignRepository, renderer Renderer) *GeneratorAPI {
+func NewGeneratorAPI(designRepo DesignRepository, userRepo UserRepository, renderer Renderer, auditor Auditor, meter UsageMeter, certRepo CertificateRepository, vault CertificateVault) *GeneratorAPI {
 	return &GeneratorAPI{
 		designRepo: designRepo,
+		userRepo:   userRepo,
 		renderer:   renderer,
+		auditor:    auditor,
+		meter:      meter,
+		certRepo:   certRepo,
+		vault:      vault,
 	}
 }
 
+// generateTypes are the media types /generate can answer with, the pdf
+// comes first as the default.
+var generateTypes = []string{"application/pdf", "image/png", "image/jpeg", "image/webp"}
+
 // GeneratePDF func for updating new design.
-// @Description  Generate a pdf
+// @Description  Generate the pdf of a design, or an image of a single page when the Accept header prefers image/png, image/jpeg or image/webp.
+// @Description  The render options of the design and the options of the request shape the pdf, see their fields.
 // @Summary      GeneratePDF
 // @Tags         Design
 // @Accept       json
-// @Produce      json
+// @Produce      application/pdf,image/png,image/jpeg,image/webp
 // @Param        GeneratePDFRequest body  GeneratePDFRequest  true  "register details"
+// @Param        Idempotency-Key header string  false  "repeats with the same key within 24h replay the first response"
+// @Success      200           {file}    file "pdf or image"
 // @Failure      400           {object}  httputils.ErrorResponse "Bad Request"
-// @Failure      422           {object}  httputils.ErrorResponse "Validation errors"
+// @Failure      406           {object}  httputils.ErrorResponse "Render engine of the design can not render the image format"
+// @Failure      422           {object}  httputils.ErrorResponse "Validation errors, page out of range, render engine not enabled, not PDF/A conformant or barcodes that can not be made"
+// @Failure      429           {object}  httputils.ErrorResponse  "Monthly plan limit reached or the document exceeds the pages left, see Retry-After"
 // @Failure      500           {object}  httputils.ErrorResponse  "Internal Server Error"
+// @Failure      503           {object}  httputils.ErrorResponse  "Render queue full or render timed out"
 // @Router       /generate [post]
 func (d *GeneratorAPI) GeneratePDF(w http.ResponseWriter, req *http.Request) {
 	ctx := req.Context()
@@ -51,6 +81,28 @@ func (d *GeneratorAPI) GeneratePDF(w http.ResponseWriter, req *http.Request) {
 		return
 	}
 
+	w.Header().Add("Vary", "Accept")
+	contentType, ok := httputils.Negotiate(req.Header.Get("Accept"), generateTypes...)
+	if !ok {
+		contentType = generateTypes[0]
+	}
+	if contentType != generateTypes[0] && len(t.Watermarks) > 0 {
+		httputils.BadRequest(ctx, w, ErrWatermarkImageOutput)
+		return
+	}
+	if contentType != generateTypes[0] && t.Encryption != nil {
+		httputils.BadRequest(ctx, w, ErrEncryptionImageOutput)
+		return
+	}
+	if contentType != generateTypes[0] && t.Signature != nil {
+		httputils.BadRequest(ctx, w, ErrSignatureImageOutput)
+		return
+	}
+	if contentType != generateTypes[0] && len(t.Attachments) > 0 {
+		httputils.BadRequest(ctx, w, ErrAttachmentImageOutput)
+		return
+	}
+
 	userId, err := contexts.UserIdFromContext(ctx)
 	if err != nil {
 		logging.Debug("unable to get userId from context")
@@ -63,43 +115,562 @@ func (d *GeneratorAPI) GeneratePDF(w http.ResponseWriter, req *http.Request) {
 		httputils.BadRequest(context.TODO(), w, errors.New("unable to get design"))
 		return
 	}
+	if !design.Access.CanGenerate() {
+		httputils.Forbidden(ctx, w, ErrDesignReadOnly)
+		return
+	}
+	if design.IsForm() && contentType != generateTypes[0] {
+		httputils.BadRequest(ctx, w, ErrFormImageOutput)
+		return
+	}
+	design = design.WithFields(t.Fields)
+	// PDF/A forbids encryption, visible signatures and text watermarks would
+	// draw fonts that are not embedded
+	pdfa := design.RenderOptions().PDFA
+	if design.Invoice != nil {
+		pdfa = pdfops.PDFA3B
+	}
+	if pdfa == pdfops.PDFA2B && len(t.Attachments) > 0 {
+		httputils.BadRequest(ctx, w, ErrAttachmentPDFA2B)
+		return
+	}
+	if pdfa != "" && t.Encryption != nil {
+		httputils.BadRequest(ctx, w, ErrPDFAEncryption)
+		return
+	}
+	if pdfa != "" && t.Signature != nil && t.Signature.Box != nil {
+		httputils.BadRequest(ctx, w, ErrPDFASignatureBox)
+		return
+	}
+	if pdfa != "" {
+		if err := pdfaWatermarks(design.Draft, t.Watermarks); err != nil {
+			httputils.BadRequest(ctx, w, err)
+			return
+		}
+	}
 
-	if design.Fields != nil {
-		tl, err := template.New(design.Name).Parse(design.Template)
-		if err != nil {
-			httputils.BadRequest(context.TODO(), w, errors.New("unable to parse template"))
+	var html io.Reader
+	if !design.IsForm() {
+		if html, err = design.HTML(); err != nil {
+			httputils.BadRequest(context.TODO(), w, htmlError(err))
 			return
 		}
+	}
 
-		var buf bytes.Buffer
+	var info pdfops.Info
+	if contentType == generateTypes[0] {
+		if info, err = d.documentInfo(ctx, design); err != nil {
+			httputils.BadRequest(ctx, w, err)
+			return
+		}
+	}
 
-		err = tl.Execute(&buf, design.Fields)
-		if err != nil {
-			httputils.BadRequest(context.TODO(), w, errors.New("unable to match fields to design"))
+	var invoice []byte
+	if design.Invoice != nil && contentType == generateTypes[0] {
+		if invoice, err = design.InvoiceXML(); err != nil {
+			httputils.BadRequest(ctx, w, pgerror.ValidationError(err.Error()))
 			return
 		}
+	}
 
-		pb, err := d.renderer.HTML(&buf)
+	// passwords only live in this request, they are neither logged nor stored
+	var enc *pdfops.Encryption
+	if t.Encryption != nil {
+		e, err := expandPasswords(*t.Encryption, design)
 		if err != nil {
-			httputils.BadRequest(context.TODO(), w, errors.New("unable to renderer pdf"))
+			httputils.BadRequest(ctx, w, err)
+			return
+		}
+		enc = &e
+	}
+
+	var key certificate.Key
+	if t.Signature != nil {
+		var ok bool
+		if key, ok = d.signingKey(w, req, userId, t.Signature.CertificateId); !ok {
 			return
 		}
+	}
 
+	res, err := d.meter.Reserve(ctx, userId)
+	if err != nil {
+		if errors.Is(err, usage.ErrDocumentLimit) {
+			httputils.TooManyRequests(ctx, w, ErrUsageDocumentLimit, time.Until(d.meter.ResetsAt()))
+			return
+		}
+		if errors.Is(err, usage.ErrPageLimit) {
+			httputils.TooManyRequests(ctx, w, ErrUsagePageLimit, time.Until(d.meter.ResetsAt()))
+			return
+		}
+		logging.WithContext(ctx).WithError(err).Error("unable to reserve usage")
+		httputils.InternalServerError(ctx, w, pgerror.ErrInternalError)
+		return
+	}
+
+	started := time.Now()
+	var b []byte
+	var pages int64
+	if contentType == generateTypes[0] {
+		if design.IsForm() {
+			b, err = fillForm(design)
+		} else {
+			b, err = d.renderer.Render(ctx, html, design.RenderOptions())
+			if err == nil && design.RenderOptions().FlattenForms {
+				b, err = pdfops.FlattenForm(b)
+			}
+		}
+		if err == nil {
+			b, err = outline(b, design.RenderOptions())
+		}
+		if err == nil {
+			b, err = pdfops.SetInfo(b, info)
+		}
+		if err == nil {
+			b, err = stamp(b, design, t.Watermarks)
+		}
+		if err == nil && len(t.Attachments) > 0 {
+			b, err = pdfops.Attach(b, time.Now(), t.Attachments...)
+		}
+		if err == nil && invoice != nil {
+			b, err = pdfops.FacturX(b, invoice, design.Invoice.Profile, time.Now())
+		} else if err == nil && pdfa != "" {
+			b, err = pdfops.PDFA(b, pdfa, time.Now())
+		}
+		if err == nil && enc != nil {
+			b, err = pdfops.Encrypt(b, *enc)
+		}
+		if err == nil && t.Signature != nil {
+			b, err = pdfops.Sign(b, key.Signer, key.Chain, t.Signature.Signature, time.Now())
+		}
+		pages = usage.CountPages(b)
+	} else {
+		img := t.imageOptions(contentType)
+		if design.Draft {
+			html = pdfrender.DraftOverlay(html, design.RenderOptions(), img)
+		}
+		b, err = d.renderer.RenderImage(ctx, html, design.RenderOptions(), img)
+		pages = 1
+	}
+	if err != nil {
+		if rerr := d.meter.Release(ctx, res); rerr != nil {
+			logging.WithContext(ctx).WithError(rerr).Error("unable to release usage")
+		}
+		renderError(ctx, w, err)
+		return
+	}
+
+	err = d.meter.Commit(ctx, res, usage.Record{
+		DesignId:   design.Id,
+		Pages:      pages,
+		Bytes:      int64(len(b)),
+		RenderTime: time.Since(started),
+	})
+	if errors.Is(err, usage.ErrPageLimit) {
+		if rerr := d.meter.Release(ctx, res); rerr != nil {
+			logging.WithContext(ctx).WithError(rerr).Error("unable to release usage")
+		}
+		httputils.TooManyRequests(ctx, w, ErrUsagePageLimit, time.Until(d.meter.ResetsAt()))
+		return
+	}
+	if err != nil {
+		logging.WithContext(ctx).WithError(err).Error("unable to record usage")
+	}
+
+	metadata := audit.Metadata{"contentType": contentType}
+	if t.Signature != nil {
+		metadata["certificateId"] = t.Signature.CertificateId
+	}
+	if invoice != nil {
+		metadata["invoice"] = design.Invoice.Profile
+	}
+	d.auditor.Record(ctx, audit.Event{Action: audit.ActionGenerated, TargetType: audit.TargetDesign, TargetId: design.Id, Metadata: metadata})
+	if contentType == generateTypes[0] {
 		httputils.WriteFile(w,
-			pb,
+			b,
 			http.StatusOK)
 		return
 	}
+	httputils.WriteContent(w, contentType, b, http.StatusOK)
+}
+
+// ComposePDF func for merging several designs into one pdf.
+// @Description  Render the designs of the parts in order and merge them into one pdf with a bookmark per part.
+// @Description  The composed pdf counts as one document of the plan.
+// @Summary      ComposePDF
+// @Tags         Design
+// @Accept       json
+// @Produce      application/pdf
+// @Param        ComposePDFRequest body  ComposePDFRequest  true  "parts in order"
+// @Param        Idempotency-Key header string  false  "repeats with the same key within 24h replay the first response"
+// @Success      200           {file}    file "pdf"
+// @Failure      400           {object}  httputils.ErrorResponse "Bad Request"
+// @Failure      403           {object}  httputils.ErrorResponse "No permission to generate a design"
+// @Failure      422           {object}  httputils.ErrorResponse "Render engine not enabled or not PDF/A conformant"
+// @Failure      429           {object}  httputils.ErrorResponse  "Monthly plan limit reached or the document exceeds the pages left, see Retry-After"
+// @Failure      500           {object}  httputils.ErrorResponse  "Internal Server Error"
+// @Failure      503           {object}  httputils.ErrorResponse  "Render queue full or render timed out"
+// @Router       /generate/compose [post]
+func (d *GeneratorAPI) ComposePDF(w http.ResponseWriter, req *http.Request) {
+	ctx := req.Context()
+	var t ComposePDFRequest
+	err := httputils.ReadJson(req, &t)
+	if err != nil {
+		httputils.BadRequest(ctx, w, errors.New("unable to read request"))
+		return
+	}
+
+	err = t.Validate()
+	if err != nil {
+		httputils.BadRequest(ctx, w, err)
+		return
+	}
+
+	userId, err := contexts.UserIdFromContext(ctx)
+	if err != nil {
+		logging.Debug("unable to get userId from context")
+		httputils.BadRequest(ctx, w, pgerror.ErrUnableToGetUserIdFromContext)
+		return
+	}
+
+	designs := make([]design.Design, len(t.Parts))
+	for i, p := range t.Parts {
+		ds, err := d.designRepo.GetById(ctx, userId, p.DesignId)
+		if err != nil {
+			httputils.BadRequest(ctx, w, errors.New("unable to get design"))
+			return
+		}
+		if !ds.Access.CanGenerate() {
+			httputils.Forbidden(ctx, w, ErrDesignReadOnly)
+			return
+		}
+		designs[i] = ds.WithFields(p.Fields)
+	}
+	pdfa := ""
+	for _, ds := range designs {
+		if pdfa = ds.RenderOptions().PDFA; pdfa != "" {
+			break
+		}
+	}
+	if pdfa != "" {
+		for _, ds := range designs {
+			if err := pdfaWatermarks(ds.Draft, nil); err != nil {
+				httputils.BadRequest(ctx, w, err)
+				return
+			}
+		}
+	}
+	info, err := d.documentInfo(ctx, designs[0])
+	if err != nil {
+		httputils.BadRequest(ctx, w, err)
+		return
+	}
+
+	res, err := d.meter.Reserve(ctx, userId)
+	if err != nil {
+		if errors.Is(err, usage.ErrDocumentLimit) {
+			httputils.TooManyRequests(ctx, w, ErrUsageDocumentLimit, time.Until(d.meter.ResetsAt()))
+			return
+		}
+		if errors.Is(err, usage.ErrPageLimit) {
+			httputils.TooManyRequests(ctx, w, ErrUsagePageLimit, time.Until(d.meter.ResetsAt()))
+			return
+		}
+		logging.WithContext(ctx).WithError(err).Error("unable to reserve usage")
+		httputils.InternalServerError(ctx, w, pgerror.ErrInternalError)
+		return
+	}
+	release := func() {
+		if rerr := d.meter.Release(ctx, res); rerr != nil {
+			logging.WithContext(ctx).WithError(rerr).Error("unable to release usage")
+		}
+	}
+
+	started := time.Now()
+	parts := make([]pdfops.Part, len(designs))
+	total := 0
+	for i, ds := range designs {
+		var html io.Reader
+		if !ds.IsForm() {
+			if html, err = ds.HTML(); err != nil {
+				release()
+				httputils.BadRequest(ctx, w, htmlError(err))
+				return
+			}
+		}
+		b, err := d.renderPart(ctx, ds, html, ds.RenderOptions())
+		if err != nil {
+			release()
+			renderError(ctx, w, err)
+			return
+		}
+		title := t.Parts[i].Title
+		if title == "" {
+			title = ds.Name
+		}
+		parts[i] = pdfops.Part{Title: title, PDF: b}
+		total += int(usage.CountPages(b))
+	}
+	// parts printing page numbers are rendered again with the pages before
+	// them and the pages of the document, so the numbers run on
+	offset := 0
+	for i, ds := range designs {
+		o := ds.RenderOptions()
+		o.PageOffset, o.TotalPages = offset, total
+		offset += int(usage.CountPages(parts[i].PDF))
+		if ds.IsForm() || !o.Renumbered() {
+			continue
+		}
+		html, err := ds.HTML()
+		if err == nil {
+			parts[i].PDF, err = d.renderPart(ctx, ds, html, o)
+		}
+		if err != nil {
+			release()
+			renderError(ctx, w, err)
+			return
+		}
+	}
 
-	pb, err := d.renderer.HTML(strings.NewReader(design.Template))
+	b, err := pdfops.Merge(parts)
+	if err == nil {
+		b, err = pdfops.SetInfo(b, info)
+	}
 	if err != nil {
-		httputils.InternalServerError(context.TODO(), w, errors.New("unable to renderer pdf"))
+		release()
+		logging.WithContext(ctx).WithError(err).Error("unable to merge pdfs")
+		httputils.InternalServerError(ctx, w, errors.New("unable to merge pdfs"))
+		return
+	}
+	if pdfa != "" {
+		b, err = pdfops.PDFA(b, pdfa, time.Now())
+	}
+	if err != nil {
+		release()
+		renderError(ctx, w, err)
 		return
 	}
 
-	httputils.WriteFile(w,
-		pb,
-		http.StatusOK)
-	return
+	// the usage event keeps one design, the first part stands for the document
+	err = d.meter.Commit(ctx, res, usage.Record{
+		DesignId:   designs[0].Id,
+		Pages:      usage.CountPages(b),
+		Bytes:      int64(len(b)),
+		RenderTime: time.Since(started),
+	})
+	if errors.Is(err, usage.ErrPageLimit) {
+		release()
+		httputils.TooManyRequests(ctx, w, ErrUsagePageLimit, time.Until(d.meter.ResetsAt()))
+		return
+	}
+	if err != nil {
+		logging.WithContext(ctx).WithError(err).Error("unable to record usage")
+	}
 
+	for _, ds := range designs {
+		d.auditor.Record(ctx, audit.Event{Action: audit.ActionGenerated, TargetType: audit.TargetDesign, TargetId: ds.Id, Metadata: audit.Metadata{"contentType": generateTypes[0], "composed": len(designs)}})
+	}
+	httputils.WriteFile(w, b, http.StatusOK)
+}
+
+// stamp draws the watermarks of the request over a rendered pdf, draft
+// designs get the draft watermark on top.
+func stamp(b []byte, ds design.Design, marks []pdfops.Watermark) ([]byte, error) {
+	if ds.Draft {
+		marks = append(marks, pdfops.DraftWatermark)
+	}
+	return pdfops.Stamp(b, marks...)
+}
+
+// renderPart renders a part of a composed document with the options o, html
+// is not read for pdf-form designs.
+func (d *GeneratorAPI) renderPart(ctx context.Context, ds design.Design, html io.Reader, o pdfrender.Options) ([]byte, error) {
+	var b []byte
+	var err error
+	if ds.IsForm() {
+		b, err = fillForm(ds)
+	} else {
+		b, err = d.renderer.Render(ctx, html, o)
+	}
+	// merged pages keep no form, so the fields of parts are flattened
+	if err == nil && (ds.IsForm() || o.Forms) {
+		b, err = pdfops.FlattenForm(b)
+	}
+	if err == nil {
+		b, err = stamp(b, ds, nil)
+	}
+	return b, err
+}
+
+// pdfaWatermarks rejects the watermarks of PDF/A documents that draw text,
+// their font is not embedded so conversion would fail.
+func pdfaWatermarks(draft bool, marks []pdfops.Watermark) error {
+	if draft {
+		return ErrPDFADraft
+	}
+	for _, wm := range marks {
+		if wm.Text != "" {
+			return ErrPDFAWatermarkText
+		}
+	}
+	return nil
+}
+
+// fillForm fills the pdf of a pdf-form design with its fields.
+func fillForm(ds design.Design) ([]byte, error) {
+	b, err := pdfops.FillForm(ds.Form, ds.FormValues())
+	if err == nil && ds.RenderOptions().FlattenForms {
+		b, err = pdfops.FlattenForm(b)
+	}
+	return b, err
+}
+
+// outline inserts the table of contents of a rendered pdf and cuts its
+// outline to the headings the options ask for, engines outline the headings
+// for tables of contents even without bookmarks.
+func outline(b []byte, o pdfrender.Options) ([]byte, error) {
+	if !o.Outline() {
+		return b, nil
+	}
+	var err error
+	if o.TOC {
+		title := o.TOCTitle
+		if title == "" {
+			title = pdfrender.DefaultTOCTitle
+		}
+		if b, err = pdfops.TableOfContents(b, title, pdfrender.OutlineDepth); err != nil {
+			return nil, err
+		}
+	}
+	depth := pdfrender.OutlineDepth
+	if !o.Bookmarks {
+		depth = 0
+	}
+	return pdfops.Bookmarks(b, depth)
+}
+
+// documentInfo reads the metadata of the design from its fields, title and
+// author default to the name of the design and its owner.
+func (d *GeneratorAPI) documentInfo(ctx context.Context, ds design.Design) (pdfops.Info, error) {
+	var info pdfops.Info
+	if m := ds.RenderOptions().Metadata; m != nil {
+		info = pdfops.Info(*m)
+	}
+	for _, v := range []*string{&info.Title, &info.Author, &info.Subject, &info.Keywords, &info.Creator} {
+		if *v == "" {
+			continue
+		}
+		s, err := ds.Expand(*v)
+		if err != nil {
+			return pdfops.Info{}, ErrMetadataFields
+		}
+		*v = strings.TrimSpace(s)
+	}
+	if info.Title == "" {
+		info.Title = ds.Name
+	}
+	if info.Author == "" {
+		info.Author = d.ownerName(ctx, ds.UserId)
+	}
+	return info, nil
+}
+
+// ownerName is the name of the user owning a design, documents of owners
+// without name or that can not be read have no author.
+func (d *GeneratorAPI) ownerName(ctx context.Context, userId string) string {
+	u, err := d.userRepo.GetById(ctx, userId)
+	if err != nil {
+		logging.WithContext(ctx).WithError(err).Error("unable to get design owner")
+		return ""
+	}
+	var name []string
+	for _, s := range []*string{u.FirstName, u.LastName} {
+		if s != nil && strings.TrimSpace(*s) != "" {
+			name = append(name, strings.TrimSpace(*s))
+		}
+	}
+	return strings.Join(name, " ")
+}
+
+// expandPasswords reads the passwords of e from the fields of the design,
+// which already have the fields of the request laid over them.
+func expandPasswords(e pdfops.Encryption, ds design.Design) (pdfops.Encryption, error) {
+	for _, pw := range []*string{&e.UserPassword, &e.OwnerPassword} {
+		if *pw == "" {
+			continue
+		}
+		v, err := ds.Expand(*pw)
+		if err != nil {
+			return pdfops.Encryption{}, ErrEncryptionPasswordInvalid
+		}
+		if v == "" {
+			return pdfops.Encryption{}, ErrEncryptionPasswordEmpty
+		}
+		*pw = v
+	}
+	return e, nil
+}
+
+// signingKey opens the key of a certificate of the user, it answers the
+// request when the certificate can not sign.
+func (d *GeneratorAPI) signingKey(w http.ResponseWriter, req *http.Request, userId, certificateId string) (certificate.Key, bool) {
+	ctx := req.Context()
+	cert, err := d.certRepo.GetById(ctx, userId, certificateId)
+	if errors.Is(err, certificate.ErrCertificateNotFound) {
+		httputils.BadRequest(ctx, w, ErrCertificateNotFound)
+		return certificate.Key{}, false
+	}
+	if err != nil {
+		logging.WithContext(ctx).WithError(err).Error("unable to get certificate")
+		httputils.InternalServerError(ctx, w, pgerror.ErrInternalError)
+		return certificate.Key{}, false
+	}
+	if !cert.Valid(time.Now()) {
+		httputils.BadRequest(ctx, w, ErrCertificateExpired)
+		return certificate.Key{}, false
+	}
+	key, err := d.vault.Open(cert.Sealed)
+	if err != nil {
+		logging.WithContext(ctx).WithError(err).Error("unable to open certificate")
+		httputils.InternalServerError(ctx, w, pgerror.ErrInternalError)
+		return certificate.Key{}, false
+	}
+	return key, true
+}
+
+// htmlError returns barcodes a design could not make as validation errors,
+// which name the template function and why.
+func htmlError(err error) error {
+	var code *barcode.Error
+	if errors.As(err, &code) {
+		return pgerror.ValidationError(code.Error())
+	}
+	return err
+}
+
+// renderError answers a failed render.
+func renderError(ctx context.Context, w http.ResponseWriter, err error) {
+	var conformance *pdfops.ConformanceError
+	var field *pdfops.FormError
+	switch {
+	case errors.As(err, &conformance):
+		httputils.UnProcessableEntity(ctx, w, pgerror.ValidationError(conformance.Error()))
+	case errors.As(err, &field):
+		httputils.BadRequest(ctx, w, pgerror.ValidationError(field.Error()))
+	case errors.Is(err, pdfrender.ErrQueueFull):
+		httputils.ServiceUnavailable(ctx, w, ErrRenderQueueFull, renderRetryAfter)
+	case errors.Is(err, pdfrender.ErrUnknownEngine):
+		httputils.UnProcessableEntity(ctx, w, ErrRenderEngineUnavailable)
+	case errors.Is(err, pdfrender.ErrImageUnsupported), errors.Is(err, pdfrender.ErrFormatUnsupported):
+		httputils.NotAcceptable(ctx, w, ErrRenderImageUnsupported)
+	case errors.Is(err, pdfrender.ErrPageOutOfRange):
+		httputils.UnProcessableEntity(ctx, w, ErrRenderPageOutOfRange)
+	case errors.Is(err, pdfops.ErrSignaturePage):
+		httputils.UnProcessableEntity(ctx, w, ErrSignaturePageOutOfRange)
+	case errors.Is(err, context.DeadlineExceeded):
+		logging.WithContext(ctx).WithError(err).Error("render timed out")
+		httputils.ServiceUnavailable(ctx, w, ErrRenderTimeout, 0)
+	default:
+		logging.WithContext(ctx).WithError(err).Error("unable to render pdf")
+		httputils.InternalServerError(ctx, w, errors.New("unable to renderer pdf"))
+	}
 }
@@ -0,0 +1,228 @@
+package main
+
+import (
+	"context"
+	"github.com/rengas/pdfgen/pkg/contexts"
+	"github.com/rengas/pdfgen/pkg/design"
+	"github.com/rengas/pdfgen/pkg/facturx"
+	"github.com/rengas/pdfgen/pkg/htmlrender"
+	"github.com/rengas/pdfgen/pkg/pdfops"
+	"github.com/rengas/pdfgen/pkg/pdfrender"
+	"github.com/rengas/pdfgen/pkg/usage"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+)
+
+type fakeDesigns struct {
+	DesignRepository
+	designs map[string]design.Design
+}
+
+func (f fakeDesigns) GetById(ctx context.Context, userId, designId string) (design.Design, error) {
+	ds, ok := f.designs[designId]
+	if !ok {
+		return design.Design{}, design.ErrDesignNotFound
+	}
+	return ds, nil
+}
+
+type fakeMeter struct {
+	UsageMeter
+}
+
+func (fakeMeter) Reserve(ctx context.Context, userId string) (usage.Reservation, error) {
+	return usage.Reservation{UserId: userId}, nil
+}
+
+func (fakeMeter) Commit(ctx context.Context, res usage.Reservation, r usage.Record) error {
+	return nil
+}
+
+type recordingRenderer struct {
+	Renderer
+	html *string
+}
+
+func (r recordingRenderer) RenderImage(ctx context.Context, in io.Reader, o pdfrender.Options, img pdfrender.ImageOptions) ([]byte, error) {
+	b, _ := io.ReadAll(in)
+	*r.html = string(b)
+	return []byte("png"), nil
+}
+
+// optionsRenderer renders with the builtin engine and records the options of
+// every render.
+type optionsRenderer struct {
+	Renderer
+	options *[]pdfrender.Options
+}
+
+func (r optionsRenderer) Render(ctx context.Context, in io.Reader, o pdfrender.Options) ([]byte, error) {
+	*r.options = append(*r.options, o)
+	return htmlrender.NewRenderer().Render(ctx, in, o)
+}
+
+func TestPDFAWatermarks(t *testing.T) {
+	tests := []struct {
+		name    string
+		draft   bool
+		marks   []pdfops.Watermark
+		wantErr error
+	}{
+		{name: "no watermarks"},
+		{name: "image watermark", marks: []pdfops.Watermark{{Image: []byte("png")}}},
+		{name: "draft design", draft: true, wantErr: ErrPDFADraft},
+		{name: "text watermark", marks: []pdfops.Watermark{{Image: []byte("png")}, {Text: "PAID"}}, wantErr: ErrPDFAWatermarkText},
+	}
+
+	for _, tc := range tests {
+		if err := pdfaWatermarks(tc.draft, tc.marks); err != tc.wantErr {
+			t.Fatalf("%s: expected: %v, got: %v", tc.name, tc.wantErr, err)
+		}
+	}
+}
+
+func TestValidateDesignDefaultEngine(t *testing.T) {
+	tests := []struct {
+		name    string
+		engine  string
+		render  *pdfrender.Options
+		wantErr error
+	}{
+		{name: "accessible on wkhtmltopdf", engine: pdfrender.EngineWkhtmltopdf, render: &pdfrender.Options{Accessible: true}, wantErr: ErrDesignAccessibleEngine},
+		{name: "accessible on builtin", engine: pdfrender.EngineBuiltin, render: &pdfrender.Options{Accessible: true}},
+		{name: "pdfa on builtin", engine: pdfrender.EngineBuiltin, render: &pdfrender.Options{PDFA: pdfops.PDFA2B}, wantErr: ErrDesignPDFAEngine},
+		{name: "pdfa on chromium", engine: pdfrender.EngineBuiltin, render: &pdfrender.Options{Engine: pdfrender.EngineChromium, PDFA: pdfops.PDFA2B}},
+	}
+
+	for _, tc := range tests {
+		if err := validateDesign(design.TypeHTML, tc.render, nil, false, tc.engine); err != tc.wantErr {
+			t.Fatalf("%s: expected: %v, got: %v", tc.name, tc.wantErr, err)
+		}
+	}
+}
+
+func TestValidateDraftDesign(t *testing.T) {
+	invoice := &facturx.Mapping{Profile: facturx.ProfileMinimum}
+
+	tests := []struct {
+		name    string
+		render  *pdfrender.Options
+		invoice *facturx.Mapping
+		draft   bool
+		wantErr error
+	}{
+		{name: "draft", draft: true},
+		{name: "pdfa", render: &pdfrender.Options{PDFA: pdfops.PDFA2B}},
+		{name: "draft pdfa", render: &pdfrender.Options{PDFA: pdfops.PDFA2B}, draft: true, wantErr: ErrPDFADraft},
+		{name: "draft invoice", invoice: invoice, draft: true, wantErr: ErrPDFADraft},
+	}
+
+	for _, tc := range tests {
+		if err := validateDesign(design.TypeHTML, tc.render, tc.invoice, tc.draft, pdfrender.EngineWkhtmltopdf); err != tc.wantErr {
+			t.Fatalf("%s: expected: %v, got: %v", tc.name, tc.wantErr, err)
+		}
+	}
+}
+
+func TestGenerateImage(t *testing.T) {
+	stored := design.Attrs{"name": "Ada", "city": "London"}
+	designs := fakeDesigns{designs: map[string]design.Design{
+		"design-1": {Id: "design-1", Template: `<p>{{.name}} {{.city}}</p>`, Fields: &stored, Access: design.AccessOwner},
+		"draft-1":  {Id: "draft-1", Template: `<p>{{.name}} {{.city}}</p>`, Fields: &stored, Access: design.AccessOwner, Draft: true},
+	}}
+
+	tests := []struct {
+		name      string
+		body      string
+		wantHTML  string
+		wantDraft bool
+	}{
+		{name: "stored fields", body: `{"DesignId":"design-1"}`, wantHTML: "<p>Ada London</p>"},
+		{name: "request fields over stored ones", body: `{"DesignId":"design-1","fields":{"city":"Paris"}}`, wantHTML: "<p>Ada Paris</p>"},
+		{name: "draft", body: `{"DesignId":"draft-1"}`, wantHTML: "<p>Ada London</p>", wantDraft: true},
+	}
+
+	for _, tc := range tests {
+		var html string
+		api := NewGeneratorAPI(designs, fakeUsers{}, recordingRenderer{html: &html}, fakeAuditor{}, fakeMeter{}, nil, nil)
+		req := httptest.NewRequest(http.MethodPost, "/generate", strings.NewReader(tc.body))
+		req.Header.Set("Accept", "image/png")
+		req = req.WithContext(contexts.WithUserId(req.Context(), "user-1"))
+		rec := httptest.NewRecorder()
+		api.GeneratePDF(rec, req)
+
+		if rec.Code != http.StatusOK {
+			t.Fatalf("%s: expected: %v, got: %v %s", tc.name, http.StatusOK, rec.Code, rec.Body)
+		}
+		if !strings.HasPrefix(html, tc.wantHTML) || strings.Contains(html, ">DRAFT<") != tc.wantDraft {
+			t.Fatalf("%s: expected: %v with draft mark %v, got: %s", tc.name, tc.wantHTML, tc.wantDraft, html)
+		}
+	}
+}
+
+func TestGenerateEncryptedFields(t *testing.T) {
+	stored := design.Attrs{"name": "Ada"}
+	designs := fakeDesigns{designs: map[string]design.Design{
+		"design-1": {Id: "design-1", Name: "payslip", Template: `<p>{{.name}}</p>`, Fields: &stored, Access: design.AccessOwner},
+	}}
+	engines := pdfrender.NewEngines(pdfrender.EngineBuiltin)
+	engines.Register(pdfrender.EngineBuiltin, htmlrender.NewRenderer())
+	api := NewGeneratorAPI(designs, fakeUsers{}, engines, fakeAuditor{}, fakeMeter{}, nil, nil)
+
+	tests := []struct {
+		name     string
+		body     string
+		wantCode int
+	}{
+		{name: "password from request fields", body: `{"DesignId":"design-1","fields":{"dob":"1990-01-31"},"encryption":{"userPassword":"{{.dob}}"}}`, wantCode: http.StatusOK},
+		{name: "password from stored fields", body: `{"DesignId":"design-1","encryption":{"userPassword":"{{.name}}"}}`, wantCode: http.StatusOK},
+		{name: "password field missing", body: `{"DesignId":"design-1","encryption":{"userPassword":"{{.dob}}"}}`, wantCode: http.StatusBadRequest},
+	}
+
+	for _, tc := range tests {
+		req := httptest.NewRequest(http.MethodPost, "/generate", strings.NewReader(tc.body))
+		req = req.WithContext(contexts.WithUserId(req.Context(), "user-1"))
+		rec := httptest.NewRecorder()
+		api.GeneratePDF(rec, req)
+
+		if rec.Code != tc.wantCode {
+			t.Fatalf("%s: expected: %v, got: %v %s", tc.name, tc.wantCode, rec.Code, rec.Body)
+		}
+		if tc.wantCode == http.StatusOK && !strings.Contains(rec.Body.String(), "/Encrypt") {
+			t.Fatalf("%s: expected: %v, got: %v", tc.name, "encrypted pdf", "no /Encrypt")
+		}
+	}
+}
+
+func TestComposePDFPageNumbers(t *testing.T) {
+	numbered := &pdfrender.Options{Footer: `<span class="pageNumber"></span> / <span class="totalPages"></span>`}
+	designs := fakeDesigns{designs: map[string]design.Design{
+		"invoice": {Id: "invoice", Name: "invoice", Template: strings.Repeat("<p>line</p>", 60), Render: numbered, Access: design.AccessOwner},
+		"terms":   {Id: "terms", Name: "terms", Template: "<p>terms</p>", Render: numbered, Access: design.AccessOwner},
+		"plain":   {Id: "plain", Name: "plain", Template: "<p>plain</p>", Access: design.AccessOwner},
+	}}
+	var options []pdfrender.Options
+	api := NewGeneratorAPI(designs, fakeUsers{}, optionsRenderer{options: &options}, fakeAuditor{}, fakeMeter{}, nil, nil)
+
+	body := `{"parts":[{"designId":"invoice"},{"designId":"plain"},{"designId":"terms"}]}`
+	req := httptest.NewRequest(http.MethodPost, "/generate/compose", strings.NewReader(body))
+	req = req.WithContext(contexts.WithUserId(req.Context(), "user-1"))
+	rec := httptest.NewRecorder()
+	api.ComposePDF(rec, req)
+	if rec.Code != http.StatusOK {
+		t.Fatalf("expected: %v, got: %v %s", http.StatusOK, rec.Code, rec.Body)
+	}
+
+	total := int(usage.CountPages(rec.Body.Bytes()))
+	if len(options) != 5 || total < 4 {
+		t.Fatalf("expected: %v, got: %v renders of %v pages", "3 renders and 2 renumbered ones of at least 4 pages", len(options), total)
+	}
+	invoice, terms := options[3], options[4]
+	if invoice.PageOffset != 0 || terms.PageOffset != total-1 || invoice.TotalPages != total || terms.TotalPages != total {
+		t.Fatalf("expected: %v, got: %+v %+v", "offsets 0 and "+strconv.Itoa(total-1)+" of "+strconv.Itoa(total), invoice, terms)
+	}
+}
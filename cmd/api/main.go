@@ -4,25 +4,40 @@ import (
 	"context"
 	"encoding/json"
 	"flag"
+	"fmt"
 	"github.com/go-chi/chi/v5"
 	m "github.com/go-chi/chi/v5/middleware"
 	"github.com/go-chi/cors"
 	_ "github.com/golang-migrate/migrate/v4/source/file"
+	"github.com/rengas/pdfgen/pkg/audit"
+	"github.com/rengas/pdfgen/pkg/certificate"
+	"github.com/rengas/pdfgen/pkg/chromerender"
 	"github.com/rengas/pdfgen/pkg/dbutils"
 	"github.com/rengas/pdfgen/pkg/design"
+	"github.com/rengas/pdfgen/pkg/htmlrender"
+	"github.com/rengas/pdfgen/pkg/idempotency"
+	"github.com/rengas/pdfgen/pkg/lockout"
 	"github.com/rengas/pdfgen/pkg/logging"
+	"github.com/rengas/pdfgen/pkg/mfa"
 	cmiddleware "github.com/rengas/pdfgen/pkg/middleware"
 	"github.com/rengas/pdfgen/pkg/minifier"
+	"github.com/rengas/pdfgen/pkg/oidc"
+	"github.com/rengas/pdfgen/pkg/organization"
 	"github.com/rengas/pdfgen/pkg/pagination"
 	"github.com/rengas/pdfgen/pkg/password"
 	"github.com/rengas/pdfgen/pkg/pdfrender"
+	"github.com/rengas/pdfgen/pkg/ratelimit"
 	"github.com/rengas/pdfgen/pkg/server"
 	"github.com/rengas/pdfgen/pkg/service"
+	"github.com/rengas/pdfgen/pkg/thumbnail"
 	"github.com/rengas/pdfgen/pkg/token"
+	"github.com/rengas/pdfgen/pkg/totp"
+	"github.com/rengas/pdfgen/pkg/usage"
 	"github.com/rengas/pdfgen/pkg/user"
 	"io"
 	"log"
 	"os"
+	"strings"
 	"syscall"
 	"time"
 )
@@ -37,6 +52,33 @@ var (
 	jwtRefreshSecretKey   = flag.String("jwt-secret-key", "secret-refresh-access-key", "some random refresh secret key")
 	jwtAccessTokenExpiry  = flag.Int("jwt-access-expiry", 30, "some access token expiry in minutes")
 	jwtRefreshTokenExpiry = flag.Int("jwt-refresh-expiry", 2, "some refresh token expiry in hours")
+	jwtKeyFiles           = flag.String("jwt-key-files", "", "comma separated PEM RSA or Ed25519 keys, the file name is the kid; shared secrets are used when empty")
+	jwtSigningKeyId       = flag.String("jwt-signing-kid", "", "kid of the key new tokens are signed with")
+	jwtLegacyTokens       = flag.Bool("jwt-legacy-tokens", true, "accept HS256 tokens without typ claim or kid issued by older releases, only while -jwt-access-key and -jwt-secret-key are set")
+	oidcIssuer            = flag.String("oidc-issuer", "", "OpenID Connect issuer url, single sign-on is disabled when empty")
+	oidcClientId          = flag.String("oidc-client-id", "", "OpenID Connect client id")
+	oidcClientSecret      = flag.String("oidc-client-secret", "", "OpenID Connect client secret")
+	oidcRedirectURL       = flag.String("oidc-redirect-url", "", "OpenID Connect redirect url, must point to /login/oidc/callback")
+	mfaIssuer             = flag.String("mfa-issuer", "pdfgen", "issuer shown in authenticator apps")
+	lockoutStore          = flag.String("lockout-store", "postgres", "failed login counter store, postgres or memory")
+	lockoutAccountMax     = flag.Int("lockout-account-max-failures", 5, "failed logins per account before a lockout")
+	lockoutIPMax          = flag.Int("lockout-ip-max-failures", 20, "failed logins per client ip before a lockout")
+	lockoutWindow         = flag.Duration("lockout-window", 15*time.Minute, "window in which failed logins are counted")
+	lockoutBase           = flag.Duration("lockout-base", time.Minute, "first lockout duration, doubled on every further lockout")
+	lockoutMax            = flag.Duration("lockout-max", time.Hour, "maximum lockout duration")
+	rateLimitStore        = flag.String("rate-limit-store", "postgres", "rate limit bucket store, postgres or memory")
+	rateLimitAuth         = flag.String("rate-limit-auth", "10/1m", "requests per client ip to login and register")
+	rateLimitAPI          = flag.String("rate-limit-api", "300/1m", "requests per user to the authenticated api")
+	rateLimitGenerate     = flag.String("rate-limit-generate", "30/1m", "pdf generations per user")
+	renderEngine          = flag.String("render-engine", "wkhtmltopdf", "default pdf engine, wkhtmltopdf, builtin for the pure go renderer or chromium, designs may choose another")
+	chromiumURL           = flag.String("chromium-url", "", "remote debugging address of a chromium browser, e.g. http://localhost:9222, enables the chromium engine")
+	renderConcurrency     = flag.Int("render-concurrency", 4, "pdfs rendered at the same time")
+	renderQueueDepth      = flag.Int("render-queue-depth", 16, "renders waiting for a free slot before requests are rejected with 503")
+	renderTimeout         = flag.Duration("render-timeout", 60*time.Second, "maximum time a single render may take")
+	idempotencyStore      = flag.String("idempotency-store", "postgres", "idempotency key store, postgres or memory")
+	trustedProxies        = flag.String("trusted-proxies", "127.0.0.0/8,::1/128", "comma separated ips and cidr ranges of proxies whose X-Forwarded-For and X-Real-IP headers are trusted, list the load balancer in front of the api, empty to trust none")
+	certificateKey        = flag.String("certificate-key", "", "secret the keys of uploaded signing certificates are encrypted with, required")
+	mfaKey                = flag.String("mfa-key", "", "secret the totp secrets of two-factor authentication are encrypted with, required")
 )
 
 type UserRepository interface {
@@ -53,23 +95,127 @@ type Bcrypt interface {
 
 type JWTToken interface {
 	TokePair(claims map[string]interface{}) (token.TokenDetails, error)
+	MFAChallenge(userId string) (string, error)
+	VerifyMFAChallenge(tkn string) (string, error)
+	JWKS() token.JWKS
+}
+
+type MFARepository interface {
+	Save(ctx context.Context, m mfa.MFA) error
+	GetByUserId(ctx context.Context, userId string) (mfa.MFA, error)
+	Enable(ctx context.Context, userId string, step int64, codeHashes []string, at time.Time) error
+	ReplaceRecoveryCodes(ctx context.Context, userId string, codeHashes []string, at time.Time) error
+	UseStep(ctx context.Context, userId string, step int64) error
+	UseRecoveryCode(ctx context.Context, userId, codeHash string, at time.Time) error
+	Delete(ctx context.Context, userId string) error
+}
+
+type IdentityRepository interface {
+	GetByIdentity(ctx context.Context, issuer, subject string) (user.User, error)
+	SaveIdentity(ctx context.Context, i user.Identity) error
+	SaveNewUserWithIdentity(ctx context.Context, u user.User, i user.Identity) error
+}
+
+type OIDCClient interface {
+	Issuer() string
+	AuthCodeURL(ctx context.Context, state, nonce, verifier string) (string, error)
+	Exchange(ctx context.Context, code, verifier string) (oidc.Tokens, error)
+	VerifyIDToken(ctx context.Context, raw, nonce string) (oidc.Identity, error)
+}
+
+type LoginStateRepository interface {
+	Save(ctx context.Context, s oidc.LoginState) error
+	Consume(ctx context.Context, state string, notBefore time.Time) (oidc.LoginState, error)
+}
+
+type LoginGuard interface {
+	Check(ctx context.Context, account, ip string) (time.Duration, error)
+	Fail(ctx context.Context, account, ip string) (time.Duration, error)
+	Succeed(ctx context.Context, account string) error
+	Unlock(ctx context.Context, key string) error
+	Locked(ctx context.Context) ([]lockout.Entry, error)
+}
+
+type TOTP interface {
+	GenerateSecret() (string, error)
+	URI(account, secret string) string
+	Validate(secret, code string) (int64, error)
 }
 
 type DesignRepository interface {
 	Save(ctx context.Context, d design.Design) error
-	Update(ctx context.Context, p design.Design) error
+	Update(ctx context.Context, userId string, p design.Design) error
 	GetById(ctx context.Context, userId, designId string) (design.Design, error)
 	Delete(ctx context.Context, userId string, designId string) error
 	ListByUserId(ctx context.Context, lq design.ListQuery) ([]design.Design, pagination.Pagination, error)
 	Search(ctx context.Context, lq design.ListQuery) ([]design.Design, pagination.Pagination, error)
 }
 
+type ShareRepository interface {
+	Save(ctx context.Context, s design.Share) error
+	ListByDesignId(ctx context.Context, designId string) ([]design.Share, error)
+	ListPending(ctx context.Context, email string) ([]design.Share, error)
+	Accept(ctx context.Context, shareId, userId, email string, at time.Time) (design.Share, error)
+	Revoke(ctx context.Context, designId, shareId string, at time.Time) error
+}
+
+type OrganizationRepository interface {
+	Save(ctx context.Context, o organization.Organization, owner organization.Member) error
+	ListByUserId(ctx context.Context, userId string) ([]organization.Organization, error)
+	GetMember(ctx context.Context, organizationId, userId string) (organization.Member, error)
+	ListMembers(ctx context.Context, organizationId string) ([]organization.Member, error)
+	AddMember(ctx context.Context, m organization.Member) error
+	UpdateMemberRole(ctx context.Context, m organization.Member) error
+	RemoveMember(ctx context.Context, organizationId, userId string) error
+}
+
+type Auditor interface {
+	Record(ctx context.Context, e audit.Event)
+}
+
+type AuditRepository interface {
+	List(ctx context.Context, lq audit.ListQuery) ([]audit.Event, pagination.Pagination, error)
+}
+
+type UsageMeter interface {
+	Reserve(ctx context.Context, userId string) (usage.Reservation, error)
+	Commit(ctx context.Context, res usage.Reservation, r usage.Record) error
+	Release(ctx context.Context, res usage.Reservation) error
+	Usage(ctx context.Context, userId string) (usage.Period, usage.Plan, error)
+	ResetsAt() time.Time
+}
+
+type PlanRepository interface {
+	SetPlan(ctx context.Context, userId, plan string, at time.Time) error
+}
+
+type CertificateRepository interface {
+	Save(ctx context.Context, c certificate.Certificate) error
+	ListByUserId(ctx context.Context, userId string) ([]certificate.Certificate, error)
+	GetById(ctx context.Context, userId, id string) (certificate.Certificate, error)
+	Delete(ctx context.Context, userId, id string) error
+}
+
+type CertificateVault interface {
+	Seal(k certificate.Key) ([]byte, error)
+	Open(b []byte) (certificate.Key, error)
+}
+
 type Minifier interface {
 	HTML(s string) (string, error)
 }
 
 type Renderer interface {
-	HTML(r io.Reader) ([]byte, error)
+	Render(ctx context.Context, r io.Reader, o pdfrender.Options) ([]byte, error)
+	RenderImage(ctx context.Context, r io.Reader, o pdfrender.Options, img pdfrender.ImageOptions) ([]byte, error)
+}
+
+type Thumbnailer interface {
+	Refresh(d design.Design)
+}
+
+type ThumbnailRepository interface {
+	Get(ctx context.Context, designId string) (thumbnail.Thumbnail, error)
 }
 
 // @title                       Pdfgen.pro API
@@ -84,6 +230,9 @@ type Renderer interface {
 // @name                        Authorization
 // @BasePath                    /
 func main() {
+	if err := parseFlags(flag.CommandLine, os.Args[1:]); err != nil {
+		log.Fatal(err)
+	}
 
 	log.Println("initialising api...")
 	logging.InitDefaultLogger(context.Background())
@@ -108,19 +257,102 @@ func main() {
 
 	db := dbutils.MustOpenPostgres(*connString)
 	designRepo := design.NewDesignRepository(db)
+	shareRepo := design.NewShareRepository(db)
 	minify := minifier.NewMinifier()
-	renderer := pdfrender.NewPDFRenderer()
+	engines := pdfrender.NewEngines(*renderEngine)
+	engines.Register(pdfrender.EngineWkhtmltopdf, pdfrender.NewPDFRenderer())
+	engines.Register(pdfrender.EngineBuiltin, htmlrender.NewRenderer())
+	if *chromiumURL != "" {
+		engines.Register(pdfrender.EngineChromium, chromerender.NewRenderer(*chromiumURL))
+	}
+	if !engines.Has(*renderEngine) {
+		log.Fatalf("render engine %q is not available", *renderEngine)
+	}
+	renderer := pdfrender.NewPool(engines, *renderConcurrency, *renderQueueDepth, *renderTimeout)
 	userRepo := user.NewRepository(db)
+	mfaVault, err := certificate.NewVault(*mfaKey)
+	if err != nil {
+		log.Fatal(err)
+	}
+	mfaRepo := mfa.NewRepository(db, mfaVault)
+	orgRepo := organization.NewRepository(db)
+	auditRepo := audit.NewRepository(db)
+	auditor := audit.NewRecorder(auditRepo, func() time.Time { return time.Now().UTC() })
+	usageRepo := usage.NewRepository(db)
+	meter := usage.NewMeter(usageRepo, usage.Plans, func() time.Time { return time.Now().UTC() })
+	otp := totp.NewTOTP(*mfaIssuer, time.Now)
+
+	var attempts lockout.Store = lockout.NewRepository(db)
+	if *lockoutStore == "memory" {
+		attempts = lockout.NewMemoryStore()
+	}
+	guard := lockout.NewGuard(attempts,
+		lockout.Policy{MaxFailures: *lockoutAccountMax, Window: *lockoutWindow, BaseLockout: *lockoutBase, MaxLockout: *lockoutMax},
+		lockout.Policy{MaxFailures: *lockoutIPMax, Window: *lockoutWindow, BaseLockout: *lockoutBase, MaxLockout: *lockoutMax},
+		func() time.Time { return time.Now().UTC() })
+	guard.OnEvent(func(ctx context.Context, e lockout.Event) {
+		ae := audit.Event{Action: audit.ActionLoginLocked, TargetType: audit.TargetLockout, TargetId: e.Key}
+		if e.Action == lockout.ActionUnlocked {
+			ae.Action = audit.ActionLoginUnlocked
+		} else {
+			ae.Metadata = audit.Metadata{"until": e.Until}
+		}
+		auditor.Record(ctx, ae)
+	})
+
+	var buckets ratelimit.Store = ratelimit.NewRepository(db)
+	if *rateLimitStore == "memory" {
+		buckets = ratelimit.NewMemoryStore()
+	}
+	var idempotencyKeys idempotency.Store = idempotency.NewRepository(db)
+	if *idempotencyStore == "memory" {
+		idempotencyKeys = idempotency.NewMemoryStore()
+	}
+	authLimit, apiLimit, generateLimit := mustParseLimit(*rateLimitAuth), mustParseLimit(*rateLimitAPI), mustParseLimit(*rateLimitGenerate)
+
+	thumbnailRepo := thumbnail.NewRepository(db)
+	thumbnails := thumbnail.NewGenerator(thumbnailRepo, renderer, *renderTimeout, func() time.Time { return time.Now().UTC() })
 
-	designAPI := NewDesignAPI(designRepo, minify)
-	generatorAPI := NewGeneratorAPI(designRepo, renderer)
+	designAPI := NewDesignAPI(designRepo, minify, auditor, thumbnails, *renderEngine)
+	thumbnailAPI := NewThumbnailAPI(designRepo, thumbnailRepo)
+	shareAPI := NewShareAPI(designRepo, shareRepo, userRepo, auditor)
+	certRepo := certificate.NewRepository(db)
+	vault, err := certificate.NewVault(*certificateKey)
+	if err != nil {
+		log.Fatal(err)
+	}
+	generatorAPI := NewGeneratorAPI(designRepo, userRepo, renderer, auditor, meter, certRepo, vault)
 
 	bcrypt := password.NewBcrypt(*passwordPepper)
 	jwt := token.NewJWT(*jwtAccessSecretKey, *jwtRefreshSecretKey, *jwtAccessTokenExpiry, *jwtRefreshTokenExpiry)
+	if *jwtKeyFiles != "" {
+		keys, err := token.LoadKeySet(*jwtSigningKeyId, strings.Split(*jwtKeyFiles, ",")...)
+		if err != nil {
+			log.Fatal(err)
+		}
+		jwt = token.NewJWTWithKeys(keys, *jwtAccessSecretKey, *jwtRefreshSecretKey, *jwtAccessTokenExpiry, *jwtRefreshTokenExpiry)
+	}
+	if !*jwtLegacyTokens || !secretsSet(flag.CommandLine, "jwt-access-key", "jwt-secret-key") {
+		jwt.RejectLegacy()
+	}
 	tokenMiddleware := cmiddleware.NewJWTToken(jwt)
+	adminMiddleware := cmiddleware.NewAdmin(userRepo)
+	orgMiddleware := cmiddleware.NewOrganization(orgRepo)
+	idempotent := idempotency.NewMiddleware(idempotencyKeys, idempotency.DefaultConfig, func() time.Time { return time.Now().UTC() })
+	rateLimit := cmiddleware.NewRateLimit(ratelimit.NewLimiter(buckets, func() time.Time { return time.Now().UTC() }))
+
+	proxies, err := cmiddleware.ParseProxies(*trustedProxies)
+	if err != nil {
+		log.Fatalf("invalid trusted proxies %q: %v", *trustedProxies, err)
+	}
+	realIP := cmiddleware.NewRealIP(proxies)
 
 	r := chi.NewRouter()
 	r.Use(m.RequestID)
+	// the api runs behind a proxy, client ips are taken from X-Forwarded-For
+	// of requests the proxy sent
+	r.Use(realIP.RealIP)
+	r.Use(audit.Middleware)
 
 	// for more ideas, see: https://developer.github.com/v3/#cross-origin-resource-sharing
 	r.Use(cors.Handler(cors.Options{
@@ -128,50 +360,129 @@ func main() {
 		AllowedOrigins: []string{"https://*", "http://*"},
 		// AllowOriginFunc:  func(r *http.Request, origin string) bool { return true },
 		AllowedMethods:   []string{"GET", "POST", "PUT", "DELETE", "OPTIONS", "PATCH"},
-		AllowedHeaders:   []string{"Accept", "Authorization", "Content-Type", "X-CSRF-Token"},
-		ExposedHeaders:   []string{"Link"},
+		AllowedHeaders:   []string{"Accept", "Authorization", "Content-Type", "X-CSRF-Token", cmiddleware.OrganizationHeader, idempotency.Header},
+		ExposedHeaders:   []string{"Link", "ETag", cmiddleware.RateLimitLimitHeader, cmiddleware.RateLimitRemainingHeader, cmiddleware.RateLimitResetHeader, idempotency.ReplayedHeader},
 		AllowCredentials: false,
 		MaxAge:           300, // Maximum value not ignored by any of major browsers
 	}))
 
 	logging.Info("initialising routes...")
 
-	authAPI := NewAuthAPI(userRepo, bcrypt, jwt)
+	authAPI := NewAuthAPI(userRepo, bcrypt, jwt, mfaRepo, otp, guard, auditor)
 	r.Route("/", func(r chi.Router) {
+		r.Use(rateLimit.Limit("auth", authLimit))
 		r.Post("/register", authAPI.Register)
 		r.Post("/login", authAPI.Login)
+		r.Post("/login/mfa", authAPI.LoginMFA)
 	})
 
-	userAPI := NewUserAPI(userRepo)
+	if *oidcIssuer != "" {
+		oidcClient := oidc.NewClient(oidc.Config{
+			IssuerURL:    *oidcIssuer,
+			ClientID:     *oidcClientId,
+			ClientSecret: *oidcClientSecret,
+			RedirectURL:  *oidcRedirectURL,
+		}, nil, time.Now)
+		ssoAPI := NewSSOAPI(oidcClient, oidc.NewRepository(db), userRepo, userRepo, mfaRepo, jwt, auditor)
+		r.With(rateLimit.Limit("auth", authLimit)).Get("/login/oidc", ssoAPI.Login)
+		r.With(rateLimit.Limit("auth", authLimit)).Get("/login/oidc/callback", ssoAPI.Callback)
+	}
+
+	userAPI := NewUserAPI(userRepo, auditor)
+	mfaAPI := NewMFAAPI(userRepo, mfaRepo, otp, guard, auditor)
+	usageAPI := NewUsageAPI(meter)
+	certAPI := NewCertificateAPI(certRepo, vault, auditor)
 
 	r.Route("/user", func(r chi.Router) {
 		r.Use(tokenMiddleware.VerifyToken)
+		r.Use(rateLimit.Limit("api", apiLimit))
 		r.Get("/", userAPI.GetUser)
 		r.Put("/", userAPI.UpdateUser)
+		r.Get("/usage", usageAPI.GetUsage)
+
+		r.Route("/mfa", func(r chi.Router) {
+			r.Post("/totp", mfaAPI.EnrolTOTP)
+			r.Post("/totp/confirm", mfaAPI.ConfirmTOTP)
+			r.Post("/totp/disable", mfaAPI.DisableTOTP)
+			r.Post("/recovery-codes", mfaAPI.RegenerateRecoveryCodes)
+		})
+
+		r.Route("/certificate", func(r chi.Router) {
+			r.Post("/", certAPI.CreateCertificate)
+			r.Get("/", certAPI.ListCertificates)
+			r.Delete("/{certificateId}", certAPI.DeleteCertificate)
+		})
+	})
+
+	orgAPI := NewOrganizationAPI(orgRepo, userRepo, jwt, auditor)
+
+	r.Route("/organization", func(r chi.Router) {
+		r.Use(tokenMiddleware.VerifyToken)
+		r.Use(rateLimit.Limit("api", apiLimit))
+		r.Post("/", orgAPI.CreateOrganization)
+		r.Get("/", orgAPI.ListOrganizations)
+		r.Post("/switch", orgAPI.SwitchOrganization)
+
+		r.Route("/{organizationId}/member", func(r chi.Router) {
+			r.Get("/", orgAPI.ListMembers)
+			r.Post("/", orgAPI.AddMember)
+			r.Put("/{userId}", orgAPI.UpdateMember)
+			r.Delete("/{userId}", orgAPI.RemoveMember)
+		})
 	})
 
 	r.Group(func(r chi.Router) {
 		r.Use(m.Logger)
 		r.Use(tokenMiddleware.VerifyToken)
+		r.Use(rateLimit.Limit("api", apiLimit))
+		r.Use(orgMiddleware.ActiveOrganization)
 		r.Route("/design", func(r chi.Router) {
 
-			r.Post("/", designAPI.CreateDesign)
+			r.With(idempotent.Handle).Post("/", designAPI.CreateDesign)
 			r.Get("/", designAPI.ListDesign)
 
+			r.Get("/share/invitation", shareAPI.ListInvitations)
+			r.Post("/share/{shareId}/accept", shareAPI.AcceptInvitation)
+
 			r.Route("/{designId}", func(r chi.Router) {
 				r.Get("/", designAPI.GetDesign)
 				r.Put("/", designAPI.UpdateDesign)
 				r.Delete("/", designAPI.DeleteDesign)
+				r.Get("/thumbnail", thumbnailAPI.GetThumbnail)
+
+				r.Get("/share", shareAPI.ListShares)
+				r.Post("/share", shareAPI.ShareDesign)
+				r.Delete("/share/{shareId}", shareAPI.RevokeShare)
 			})
 		})
 
-		r.Post("/generate", generatorAPI.GeneratePDF)
+		r.With(rateLimit.Limit("generate", generateLimit), idempotent.Handle).Post("/generate", generatorAPI.GeneratePDF)
+		r.With(rateLimit.Limit("generate", generateLimit), idempotent.Handle).Post("/generate/compose", generatorAPI.ComposePDF)
 		r.Post("/validate", designAPI.ValidateDesign)
 
 	})
 
+	auditAPI := NewAuditAPI(auditRepo, userRepo)
+
+	r.Route("/audit", func(r chi.Router) {
+		r.Use(tokenMiddleware.VerifyToken)
+		r.Use(rateLimit.Limit("api", apiLimit))
+		r.Get("/", auditAPI.ListAuditEvents)
+	})
+
+	adminAPI := NewAdminAPI(guard, usageRepo)
+
+	r.Route("/admin", func(r chi.Router) {
+		r.Use(tokenMiddleware.VerifyToken)
+		r.Use(adminMiddleware.RequireAdmin)
+		r.Get("/lockouts", adminAPI.ListLockouts)
+		r.Post("/lockouts/unlock", adminAPI.Unlock)
+		r.Put("/users/{userId}/plan", adminAPI.SetPlan)
+	})
+
 	r.Group(func(r chi.Router) {
 		r.Get("/health", authAPI.Health)
+		r.Get("/.well-known/jwks.json", authAPI.JWKS)
 	})
 
 	log.Println("starting api...")
@@ -184,4 +495,47 @@ func main() {
 	logging.WithField(logging.Field{Label: "received signal", Value: sig.String()})
 
 	s.Stop()
+	// thumbnails of the last saves are still rendering
+	thumbnails.Wait()
+}
+
+// requiredSecrets have no default, the api does not start without them.
+var requiredSecrets = []string{"certificate-key", "mfa-key"}
+
+// parseFlags parses the command line into the flags of fs and checks the
+// required secrets are set.
+func parseFlags(fs *flag.FlagSet, args []string) error {
+	err := fs.Parse(args)
+	if err != nil {
+		return err
+	}
+	for _, name := range requiredSecrets {
+		if !secretsSet(fs, name) || fs.Lookup(name).Value.String() == "" {
+			return fmt.Errorf("-%s must be set", name)
+		}
+	}
+	return nil
+}
+
+// secretsSet reports whether all named flags were set, their defaults are
+// public and must not be trusted.
+func secretsSet(fs *flag.FlagSet, names ...string) bool {
+	set := make(map[string]bool)
+	fs.Visit(func(f *flag.Flag) {
+		set[f.Name] = true
+	})
+	for _, n := range names {
+		if !set[n] {
+			return false
+		}
+	}
+	return true
+}
+
+func mustParseLimit(s string) ratelimit.Limit {
+	l, err := ratelimit.ParseLimit(s)
+	if err != nil {
+		log.Fatalf("invalid rate limit %q: %v", s, err)
+	}
+	return l
 }
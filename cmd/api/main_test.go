@@ -0,0 +1,68 @@
+package main
+
+import (
+	"flag"
+	"io"
+	"strings"
+	"testing"
+)
+
+// commandLine returns a flag set with the flags of the api, values parsed
+// into it are reset to their defaults when the test ends.
+func commandLine(t *testing.T) *flag.FlagSet {
+	fs := flag.NewFlagSet("api", flag.ContinueOnError)
+	fs.SetOutput(io.Discard)
+	flag.CommandLine.VisitAll(func(f *flag.Flag) {
+		if !strings.HasPrefix(f.Name, "test.") {
+			fs.Var(f.Value, f.Name, f.Usage)
+		}
+	})
+	t.Cleanup(func() {
+		fs.VisitAll(func(f *flag.Flag) {
+			f.Value.Set(flag.CommandLine.Lookup(f.Name).DefValue)
+		})
+	})
+	return fs
+}
+
+func TestParseFlags(t *testing.T) {
+	fs := commandLine(t)
+	err := parseFlags(fs, []string{
+		"-jwt-key-files", "keys/rsa-2022-09.pem,keys/ed-2022-10.pem",
+		"-jwt-signing-kid", "ed-2022-10",
+		"-jwt-access-key", "access-secret",
+		"-render-engine", "builtin",
+		"-lockout-window", "5m",
+		"-certificate-key", "certificate-secret",
+		"-mfa-key", "mfa-secret",
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if *jwtKeyFiles != "keys/rsa-2022-09.pem,keys/ed-2022-10.pem" || *jwtSigningKeyId != "ed-2022-10" || *renderEngine != "builtin" || lockoutWindow.String() != "5m0s" {
+		t.Fatalf("expected: %v, got: %v %v %v %v", "parsed flags", *jwtKeyFiles, *jwtSigningKeyId, *renderEngine, *lockoutWindow)
+	}
+	if !secretsSet(fs, "jwt-access-key") {
+		t.Fatalf("expected: %v, got: %v", "jwt-access-key set", false)
+	}
+	if secretsSet(fs, "jwt-access-key", "jwt-secret-key") {
+		t.Fatalf("expected: %v, got: %v", "jwt-secret-key unset", true)
+	}
+
+	tests := []struct {
+		name string
+		args []string
+	}{
+		{name: "invalid value", args: []string{"-certificate-key", "certificate-secret", "-mfa-key", "mfa-secret", "-lockout-window", "soon"}},
+		{name: "certificate key missing", args: []string{"-mfa-key", "mfa-secret"}},
+		{name: "certificate key empty", args: []string{"-certificate-key", "", "-mfa-key", "mfa-secret"}},
+		{name: "mfa key missing", args: []string{"-certificate-key", "certificate-secret"}},
+	}
+
+	for _, tc := range tests {
+		if err := parseFlags(commandLine(t), tc.args); err == nil {
+			t.Fatalf("%s: expected: %v, got: %v", tc.name, "error", err)
+		}
+	}
+}
@@ -0,0 +1,370 @@
+package main
+
+import (
+	"context"
+	"encoding/base64"
+	"errors"
+	"github.com/rengas/pdfgen/pkg/audit"
+	"github.com/rengas/pdfgen/pkg/contexts"
+	mkerror "github.com/rengas/pdfgen/pkg/errors"
+	"github.com/rengas/pdfgen/pkg/httputils"
+	"github.com/rengas/pdfgen/pkg/logging"
+	"github.com/rengas/pdfgen/pkg/mfa"
+	"github.com/rengas/pdfgen/pkg/qrcode"
+	"net/http"
+	"time"
+)
+
+const qrCodeScale = 6
+
+type MFAAPI struct {
+	userRepo UserRepository
+	mfaRepo  MFARepository
+	totp     TOTP
+	guard    LoginGuard
+	auditor  Auditor
+}
+
+func NewMFAAPI(userRepo UserRepository, mfaRepo MFARepository, totp TOTP, guard LoginGuard, auditor Auditor) *MFAAPI {
+	return &MFAAPI{
+		userRepo: userRepo,
+		mfaRepo:  mfaRepo,
+		totp:     totp,
+		guard:    guard,
+		auditor:  auditor,
+	}
+}
+
+// EnrolTOTP func for starting two-factor enrolment.
+// @Description  Create a new TOTP secret for the user. It only takes effect once confirmed with a code
+// @Description  from the authenticator app. Enrolling again before confirming replaces the secret.
+// @Summary      Enrol TOTP
+// @Tags         User
+// @Produce      json
+// @Success      200  {object}  EnrolTOTPResponse
+// @Failure      400  {object}  httputils.ErrorResponse  "Bad Request"
+// @Failure      401  {object}  httputils.ErrorResponse  "Unauthorized"
+// @Failure      409  {object}  httputils.ErrorResponse  "Already enabled"
+// @Failure      500  {object}  httputils.ErrorResponse  "Internal Server Error"
+// @Security     BearerAuth
+// @Router       /user/mfa/totp [post]
+func (m *MFAAPI) EnrolTOTP(w http.ResponseWriter, req *http.Request) {
+	ctx := req.Context()
+	userId, err := contexts.UserIdFromContext(ctx)
+	if err != nil {
+		logging.Debug("unable to get userId from context")
+		httputils.BadRequest(ctx, w, mkerror.ErrUnableToGetUserIdFromContext)
+		return
+	}
+
+	usr, err := m.userRepo.GetById(ctx, userId)
+	if err != nil {
+		logging.WithContext(ctx).WithError(err).Debug("unable to get user")
+		httputils.NotFound(ctx, w, mkerror.ErrNotFound)
+		return
+	}
+
+	current, err := m.mfaRepo.GetByUserId(ctx, userId)
+	if err != nil && !errors.Is(err, mfa.ErrMFANotFound) {
+		logging.WithContext(ctx).WithError(err).Error("unable to get mfa")
+		httputils.InternalServerError(ctx, w, mkerror.ErrInternalError)
+		return
+	}
+	if current.Enabled {
+		httputils.Conflict(ctx, w, ErrMFAAlreadyEnabled)
+		return
+	}
+
+	secret, err := m.totp.GenerateSecret()
+	if err != nil {
+		logging.WithContext(ctx).WithError(err).Error("unable to generate totp secret")
+		httputils.InternalServerError(ctx, w, mkerror.ErrInternalError)
+		return
+	}
+
+	now := time.Now().UTC()
+	err = m.mfaRepo.Save(ctx, mfa.MFA{
+		UserId:    userId,
+		Secret:    secret,
+		CreatedAt: now,
+		UpdatedAt: now,
+	})
+	if err != nil {
+		logging.WithContext(ctx).WithError(err).Error("unable to save mfa")
+		httputils.InternalServerError(ctx, w, mkerror.ErrInternalError)
+		return
+	}
+
+	uri := m.totp.URI(usr.Email, secret)
+	code, err := qrcode.EncodeString(uri, qrcode.Medium)
+	if err != nil {
+		logging.WithContext(ctx).WithError(err).Error("unable to encode qr code")
+		httputils.InternalServerError(ctx, w, mkerror.ErrInternalError)
+		return
+	}
+	png, err := code.PNG(qrCodeScale)
+	if err != nil {
+		logging.WithContext(ctx).WithError(err).Error("unable to render qr code")
+		httputils.InternalServerError(ctx, w, mkerror.ErrInternalError)
+		return
+	}
+
+	httputils.OK(ctx, w, EnrolTOTPResponse{
+		Secret: secret,
+		URI:    uri,
+		QRCode: "data:image/png;base64," + base64.StdEncoding.EncodeToString(png),
+	})
+}
+
+// ConfirmTOTP func for completing two-factor enrolment.
+// @Description  Confirm the pending TOTP enrolment with a code from the authenticator app.
+// @Description  Returns recovery codes, they are shown only once.
+// @Summary      Confirm TOTP
+// @Tags         User
+// @Accept       json
+// @Produce      json
+// @Param        data  body      MFACodeRequest           true  "Code"
+// @Success      200   {object}  RecoveryCodesResponse
+// @Failure      400   {object}  httputils.ErrorResponse  "Bad Request"
+// @Failure      401   {object}  httputils.ErrorResponse  "Unauthorized"
+// @Failure      403   {object}  httputils.ErrorResponse  "Invalid code"
+// @Failure      404   {object}  httputils.ErrorResponse  "Not enrolled"
+// @Failure      409   {object}  httputils.ErrorResponse  "Already enabled"
+// @Failure      422   {object}  httputils.ErrorResponse  "Validation errors"
+// @Failure      500   {object}  httputils.ErrorResponse  "Internal Server Error"
+// @Security     BearerAuth
+// @Router       /user/mfa/totp/confirm [post]
+func (m *MFAAPI) ConfirmTOTP(w http.ResponseWriter, req *http.Request) {
+	ctx := req.Context()
+	userId, err := contexts.UserIdFromContext(ctx)
+	if err != nil {
+		logging.Debug("unable to get userId from context")
+		httputils.BadRequest(ctx, w, mkerror.ErrUnableToGetUserIdFromContext)
+		return
+	}
+
+	var cr MFACodeRequest
+	err = httputils.ReadJson(req, &cr)
+	if err != nil {
+		logging.WithContext(ctx).WithError(err).Debug("unable to read request")
+		httputils.BadRequest(ctx, w, err)
+		return
+	}
+	if cr.Code == "" {
+		httputils.UnProcessableEntity(ctx, w, ErrMFACodeIsEmpty)
+		return
+	}
+
+	current, err := m.mfaRepo.GetByUserId(ctx, userId)
+	if err != nil {
+		if errors.Is(err, mfa.ErrMFANotFound) {
+			httputils.NotFound(ctx, w, ErrMFANotEnrolled)
+			return
+		}
+		logging.WithContext(ctx).WithError(err).Error("unable to get mfa")
+		httputils.InternalServerError(ctx, w, mkerror.ErrInternalError)
+		return
+	}
+	if current.Enabled {
+		httputils.Conflict(ctx, w, ErrMFAAlreadyEnabled)
+		return
+	}
+
+	step, err := m.totp.Validate(current.Secret, cr.Code)
+	if err != nil {
+		logging.WithContext(ctx).WithError(err).Debug("totp code rejected")
+		httputils.Forbidden(ctx, w, ErrMFAInvalidCode)
+		return
+	}
+
+	codes, hashes, err := newRecoveryCodes()
+	if err != nil {
+		logging.WithContext(ctx).WithError(err).Error("unable to generate recovery codes")
+		httputils.InternalServerError(ctx, w, mkerror.ErrInternalError)
+		return
+	}
+
+	err = m.mfaRepo.Enable(ctx, userId, step, hashes, time.Now().UTC())
+	if err != nil {
+		logging.WithContext(ctx).WithError(err).Error("unable to enable mfa")
+		httputils.InternalServerError(ctx, w, mkerror.ErrInternalError)
+		return
+	}
+
+	m.auditor.Record(ctx, audit.Event{Action: audit.ActionMFAEnabled, TargetType: audit.TargetUser, TargetId: userId})
+	httputils.OK(ctx, w, RecoveryCodesResponse{RecoveryCodes: codes})
+}
+
+// DisableTOTP func for turning off two-factor authentication.
+// @Description  Disable two-factor authentication, requires a current code or a recovery code.
+// @Summary      Disable TOTP
+// @Tags         User
+// @Accept       json
+// @Produce      json
+// @Param        data  body      MFACodeRequest           true  "Code"
+// @Success      200   {object}  DisableMFAResponse
+// @Failure      400   {object}  httputils.ErrorResponse  "Bad Request"
+// @Failure      401   {object}  httputils.ErrorResponse  "Unauthorized"
+// @Failure      403   {object}  httputils.ErrorResponse  "Invalid code"
+// @Failure      404   {object}  httputils.ErrorResponse  "Not enabled"
+// @Failure      422   {object}  httputils.ErrorResponse  "Validation errors"
+// @Failure      500   {object}  httputils.ErrorResponse  "Internal Server Error"
+// @Security     BearerAuth
+// @Router       /user/mfa/totp/disable [post]
+func (m *MFAAPI) DisableTOTP(w http.ResponseWriter, req *http.Request) {
+	ctx := req.Context()
+	userId, current, cr, ok := m.readEnabled(w, req)
+	if !ok {
+		return
+	}
+
+	if !m.verify(w, req, userId, current, cr) {
+		return
+	}
+
+	err := m.mfaRepo.Delete(ctx, userId)
+	if err != nil {
+		logging.WithContext(ctx).WithError(err).Error("unable to delete mfa")
+		httputils.InternalServerError(ctx, w, mkerror.ErrInternalError)
+		return
+	}
+
+	m.auditor.Record(ctx, audit.Event{Action: audit.ActionMFADisabled, TargetType: audit.TargetUser, TargetId: userId})
+	httputils.OK(ctx, w, DisableMFAResponse{Message: "two-factor authentication disabled"})
+}
+
+// RegenerateRecoveryCodes func for replacing recovery codes.
+// @Description  Replace all recovery codes, requires a current code or a recovery code.
+// @Summary      Regenerate recovery codes
+// @Tags         User
+// @Accept       json
+// @Produce      json
+// @Param        data  body      MFACodeRequest           true  "Code"
+// @Success      200   {object}  RecoveryCodesResponse
+// @Failure      400   {object}  httputils.ErrorResponse  "Bad Request"
+// @Failure      401   {object}  httputils.ErrorResponse  "Unauthorized"
+// @Failure      403   {object}  httputils.ErrorResponse  "Invalid code"
+// @Failure      404   {object}  httputils.ErrorResponse  "Not enabled"
+// @Failure      422   {object}  httputils.ErrorResponse  "Validation errors"
+// @Failure      500   {object}  httputils.ErrorResponse  "Internal Server Error"
+// @Security     BearerAuth
+// @Router       /user/mfa/recovery-codes [post]
+func (m *MFAAPI) RegenerateRecoveryCodes(w http.ResponseWriter, req *http.Request) {
+	ctx := req.Context()
+	userId, current, cr, ok := m.readEnabled(w, req)
+	if !ok {
+		return
+	}
+
+	if !m.verify(w, req, userId, current, cr) {
+		return
+	}
+
+	codes, hashes, err := newRecoveryCodes()
+	if err != nil {
+		logging.WithContext(ctx).WithError(err).Error("unable to generate recovery codes")
+		httputils.InternalServerError(ctx, w, mkerror.ErrInternalError)
+		return
+	}
+
+	err = m.mfaRepo.ReplaceRecoveryCodes(ctx, userId, hashes, time.Now().UTC())
+	if err != nil {
+		logging.WithContext(ctx).WithError(err).Error("unable to save recovery codes")
+		httputils.InternalServerError(ctx, w, mkerror.ErrInternalError)
+		return
+	}
+
+	m.auditor.Record(ctx, audit.Event{Action: audit.ActionRecoveryCodesReset, TargetType: audit.TargetUser, TargetId: userId})
+	httputils.OK(ctx, w, RecoveryCodesResponse{RecoveryCodes: codes})
+}
+
+// readEnabled reads the code request and the enabled enrolment of the
+// current user, writing the error response when either is missing.
+func (m *MFAAPI) readEnabled(w http.ResponseWriter, req *http.Request) (string, mfa.MFA, MFACodeRequest, bool) {
+	ctx := req.Context()
+	userId, err := contexts.UserIdFromContext(ctx)
+	if err != nil {
+		logging.Debug("unable to get userId from context")
+		httputils.BadRequest(ctx, w, mkerror.ErrUnableToGetUserIdFromContext)
+		return "", mfa.MFA{}, MFACodeRequest{}, false
+	}
+
+	var cr MFACodeRequest
+	err = httputils.ReadJson(req, &cr)
+	if err != nil {
+		logging.WithContext(ctx).WithError(err).Debug("unable to read request")
+		httputils.BadRequest(ctx, w, err)
+		return "", mfa.MFA{}, MFACodeRequest{}, false
+	}
+	err = cr.Validate()
+	if err != nil {
+		httputils.UnProcessableEntity(ctx, w, err)
+		return "", mfa.MFA{}, MFACodeRequest{}, false
+	}
+
+	current, err := m.mfaRepo.GetByUserId(ctx, userId)
+	if err != nil && !errors.Is(err, mfa.ErrMFANotFound) {
+		logging.WithContext(ctx).WithError(err).Error("unable to get mfa")
+		httputils.InternalServerError(ctx, w, mkerror.ErrInternalError)
+		return "", mfa.MFA{}, MFACodeRequest{}, false
+	}
+	if !current.Enabled {
+		httputils.NotFound(ctx, w, ErrMFANotEnabled)
+		return "", mfa.MFA{}, MFACodeRequest{}, false
+	}
+
+	return userId, current, cr, true
+}
+
+// verify checks the second factor of the current user, a session token
+// alone must not allow guessing codes so failures count towards the same
+// lockout as logins.
+func (m *MFAAPI) verify(w http.ResponseWriter, req *http.Request, userId string, current mfa.MFA, cr MFACodeRequest) bool {
+	ctx := req.Context()
+	usr, err := m.userRepo.GetById(ctx, userId)
+	if err != nil {
+		logging.WithContext(ctx).WithError(err).Error("unable to get user")
+		httputils.InternalServerError(ctx, w, mkerror.ErrInternalError)
+		return false
+	}
+
+	if isLockedOut(w, req, m.guard, usr.Email) {
+		return false
+	}
+
+	err = verifySecondFactor(ctx, m.mfaRepo, m.totp, current, cr.Code, cr.RecoveryCode)
+	if err != nil {
+		logging.WithContext(ctx).WithError(err).Debug("second factor rejected")
+		if recordFailure(w, req, m.guard, m.auditor, usr.Email, "invalid second factor") {
+			return false
+		}
+		httputils.Forbidden(ctx, w, ErrMFAInvalidCode)
+		return false
+	}
+	return true
+}
+
+// verifySecondFactor accepts either a TOTP code, which may only be used once,
+// or an unused recovery code.
+func verifySecondFactor(ctx context.Context, repo MFARepository, otp TOTP, m mfa.MFA, code, recoveryCode string) error {
+	if code != "" {
+		step, err := otp.Validate(m.Secret, code)
+		if err != nil {
+			return err
+		}
+		return repo.UseStep(ctx, m.UserId, step)
+	}
+	return repo.UseRecoveryCode(ctx, m.UserId, mfa.HashRecoveryCode(recoveryCode), time.Now().UTC())
+}
+
+func newRecoveryCodes() ([]string, []string, error) {
+	codes, err := mfa.GenerateRecoveryCodes()
+	if err != nil {
+		return nil, nil, err
+	}
+	hashes := make([]string, 0, len(codes))
+	for _, c := range codes {
+		hashes = append(hashes, mfa.HashRecoveryCode(c))
+	}
+	return codes, hashes, nil
+}
@@ -0,0 +1,48 @@
+package main
+
+import (
+	"github.com/rengas/pdfgen/pkg/contexts"
+	"github.com/rengas/pdfgen/pkg/lockout"
+	"github.com/rengas/pdfgen/pkg/totp"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+type fakeTOTP struct {
+	TOTP
+}
+
+func (fakeTOTP) Validate(secret, code string) (int64, error) {
+	return 0, totp.ErrInvalidCode
+}
+
+func TestMFACodeLockout(t *testing.T) {
+	policy := lockout.Policy{MaxFailures: 3, Window: time.Hour, BaseLockout: time.Minute, MaxLockout: time.Hour}
+	guard := lockout.NewGuard(lockout.NewMemoryStore(), policy, lockout.Policy{MaxFailures: 100, Window: time.Hour, BaseLockout: time.Minute, MaxLockout: time.Hour},
+		func() time.Time { return time.Now().UTC() })
+	api := NewMFAAPI(fakeUsers{}, fakeMFA{enabled: map[string]bool{"user-1": true}}, fakeTOTP{}, guard, fakeAuditor{})
+
+	tests := []struct {
+		name     string
+		handler  http.HandlerFunc
+		wantCode int
+	}{
+		{name: "disable, first wrong code", handler: api.DisableTOTP, wantCode: http.StatusForbidden},
+		{name: "regenerate, second wrong code", handler: api.RegenerateRecoveryCodes, wantCode: http.StatusForbidden},
+		{name: "disable, third wrong code locks", handler: api.DisableTOTP, wantCode: http.StatusTooManyRequests},
+		{name: "regenerate while locked", handler: api.RegenerateRecoveryCodes, wantCode: http.StatusTooManyRequests},
+	}
+
+	for _, tc := range tests {
+		req := httptest.NewRequest(http.MethodPost, "/user/mfa/totp/disable", strings.NewReader(`{"code":"000000"}`))
+		req = req.WithContext(contexts.WithUserId(req.Context(), "user-1"))
+		rec := httptest.NewRecorder()
+		tc.handler(rec, req)
+		if rec.Code != tc.wantCode {
+			t.Fatalf("%s: expected: %v, got: %v", tc.name, tc.wantCode, rec.Code)
+		}
+	}
+}
@@ -0,0 +1,446 @@
+package main
+
+import (
+	"errors"
+	"github.com/go-chi/chi/v5"
+	"github.com/google/uuid"
+	"github.com/rengas/pdfgen/pkg/audit"
+	"github.com/rengas/pdfgen/pkg/contexts"
+	mkerror "github.com/rengas/pdfgen/pkg/errors"
+	"github.com/rengas/pdfgen/pkg/httputils"
+	"github.com/rengas/pdfgen/pkg/logging"
+	"github.com/rengas/pdfgen/pkg/organization"
+	"github.com/rengas/pdfgen/pkg/user"
+	"net/http"
+	"time"
+)
+
+type OrganizationAPI struct {
+	orgRepo  OrganizationRepository
+	userRepo UserRepository
+	jwt      JWTToken
+	auditor  Auditor
+}
+
+func NewOrganizationAPI(orgRepo OrganizationRepository,
+	userRepo UserRepository,
+	jwt JWTToken,
+	auditor Auditor) *OrganizationAPI {
+	return &OrganizationAPI{
+		orgRepo:  orgRepo,
+		userRepo: userRepo,
+		jwt:      jwt,
+		auditor:  auditor,
+	}
+}
+
+// CreateOrganization func for creating an organization.
+// @Description  Create an organization, the caller becomes its first owner.
+// @Summary      Create organization
+// @Tags         Organization
+// @Accept       json
+// @Produce      json
+// @Param        data  body      CreateOrganizationRequest  true  "Organization"
+// @Success      200   {object}  CreateOrganizationResponse
+// @Failure      400   {object}  httputils.ErrorResponse  "Bad Request"
+// @Failure      401   {object}  httputils.ErrorResponse  "Unauthorized"
+// @Failure      422   {object}  httputils.ErrorResponse  "Validation errors"
+// @Failure      500   {object}  httputils.ErrorResponse  "Internal Server Error"
+// @Security     BearerAuth
+// @Router       /organization [post]
+func (o *OrganizationAPI) CreateOrganization(w http.ResponseWriter, req *http.Request) {
+	ctx := req.Context()
+	userId, ok := userIdFromRequest(w, req)
+	if !ok {
+		return
+	}
+
+	var cr CreateOrganizationRequest
+	err := httputils.ReadJson(req, &cr)
+	if err != nil {
+		logging.WithContext(ctx).WithError(err).Debug("unable to read request")
+		httputils.BadRequest(ctx, w, err)
+		return
+	}
+	err = cr.Validate()
+	if err != nil {
+		httputils.UnProcessableEntity(ctx, w, err)
+		return
+	}
+
+	now := time.Now().UTC()
+	org := organization.Organization{
+		Id:        uuid.NewString(),
+		Name:      cr.Name,
+		CreatedAt: now,
+		UpdatedAt: now,
+	}
+	owner := organization.Member{
+		OrganizationId: org.Id,
+		UserId:         userId,
+		Role:           organization.RoleOwner,
+		CreatedAt:      now,
+		UpdatedAt:      now,
+	}
+
+	err = o.orgRepo.Save(ctx, org, owner)
+	if err != nil {
+		logging.WithContext(ctx).WithError(err).Error("unable to save organization")
+		httputils.InternalServerError(ctx, w, mkerror.ErrInternalError)
+		return
+	}
+
+	httputils.OK(ctx, w, CreateOrganizationResponse{Id: org.Id})
+}
+
+// ListOrganizations func for listing organizations of the user.
+// @Description  List the organizations the caller is a member of, with the role of the caller.
+// @Summary      List organizations
+// @Tags         Organization
+// @Produce      json
+// @Success      200  {object}  ListOrganizationResponse
+// @Failure      401  {object}  httputils.ErrorResponse  "Unauthorized"
+// @Failure      500  {object}  httputils.ErrorResponse  "Internal Server Error"
+// @Security     BearerAuth
+// @Router       /organization [get]
+func (o *OrganizationAPI) ListOrganizations(w http.ResponseWriter, req *http.Request) {
+	ctx := req.Context()
+	userId, ok := userIdFromRequest(w, req)
+	if !ok {
+		return
+	}
+
+	orgs, err := o.orgRepo.ListByUserId(ctx, userId)
+	if err != nil {
+		logging.WithContext(ctx).WithError(err).Error("unable to list organizations")
+		httputils.InternalServerError(ctx, w, mkerror.ErrInternalError)
+		return
+	}
+	if orgs == nil {
+		orgs = []organization.Organization{}
+	}
+
+	httputils.OK(ctx, w, ListOrganizationResponse{Organizations: orgs})
+}
+
+// SwitchOrganization func for changing the active organization.
+// @Description  Issue a token pair whose orgId claim makes the organization the active one.
+// @Description  An empty organizationId switches back to the personal workspace.
+// @Description  The X-Organization-Id header overrides the claim for a single request.
+// @Summary      Switch organization
+// @Tags         Organization
+// @Accept       json
+// @Produce      json
+// @Param        data  body      SwitchOrganizationRequest  true  "Organization"
+// @Success      200   {object}  LoginResponse
+// @Failure      400   {object}  httputils.ErrorResponse  "Bad Request"
+// @Failure      401   {object}  httputils.ErrorResponse  "Unauthorized"
+// @Failure      404   {object}  httputils.ErrorResponse  "Not Found"
+// @Failure      500   {object}  httputils.ErrorResponse  "Internal Server Error"
+// @Security     BearerAuth
+// @Router       /organization/switch [post]
+func (o *OrganizationAPI) SwitchOrganization(w http.ResponseWriter, req *http.Request) {
+	ctx := req.Context()
+	userId, ok := userIdFromRequest(w, req)
+	if !ok {
+		return
+	}
+
+	var sr SwitchOrganizationRequest
+	err := httputils.ReadJson(req, &sr)
+	if err != nil {
+		logging.WithContext(ctx).WithError(err).Debug("unable to read request")
+		httputils.BadRequest(ctx, w, err)
+		return
+	}
+
+	if sr.OrganizationId != "" {
+		_, ok = o.member(w, req, sr.OrganizationId, userId)
+		if !ok {
+			return
+		}
+	}
+
+	u, err := o.userRepo.GetById(ctx, userId)
+	if err != nil {
+		logging.WithContext(ctx).WithError(err).Debug("unable to get user")
+		httputils.UnAuthorized(ctx, w, mkerror.ErrUnAuthorizedError)
+		return
+	}
+
+	writeTokenPair(w, req, o.jwt, u, sr.OrganizationId)
+}
+
+// ListMembers func for listing members of an organization.
+// @Description  List the members of an organization, any member may list them.
+// @Summary      List members
+// @Tags         Organization
+// @Produce      json
+// @Param        organizationId  path      string  true  "organization id"
+// @Success      200             {object}  ListMemberResponse
+// @Failure      400             {object}  httputils.ErrorResponse  "Organization id is not a uuid"
+// @Failure      401             {object}  httputils.ErrorResponse  "Unauthorized"
+// @Failure      404             {object}  httputils.ErrorResponse  "Not Found"
+// @Failure      500             {object}  httputils.ErrorResponse  "Internal Server Error"
+// @Security     BearerAuth
+// @Router       /organization/{organizationId}/member [get]
+func (o *OrganizationAPI) ListMembers(w http.ResponseWriter, req *http.Request) {
+	ctx := req.Context()
+	userId, ok := userIdFromRequest(w, req)
+	if !ok {
+		return
+	}
+	orgId := chi.URLParam(req, "organizationId")
+	_, ok = o.member(w, req, orgId, userId)
+	if !ok {
+		return
+	}
+
+	ms, err := o.orgRepo.ListMembers(ctx, orgId)
+	if err != nil {
+		logging.WithContext(ctx).WithError(err).Error("unable to list members")
+		httputils.InternalServerError(ctx, w, mkerror.ErrInternalError)
+		return
+	}
+
+	httputils.OK(ctx, w, ListMemberResponse{Members: ms})
+}
+
+// AddMember func for adding a user to an organization.
+// @Description  Add a registered user to the organization by email, only owners can add members.
+// @Summary      Add member
+// @Tags         Organization
+// @Accept       json
+// @Produce      json
+// @Param        organizationId  path      string            true  "organization id"
+// @Param        data            body      AddMemberRequest  true  "Member"
+// @Success      200             {object}  MemberResponse
+// @Failure      400             {object}  httputils.ErrorResponse  "Bad Request"
+// @Failure      401             {object}  httputils.ErrorResponse  "Unauthorized"
+// @Failure      403             {object}  httputils.ErrorResponse  "Forbidden"
+// @Failure      404             {object}  httputils.ErrorResponse  "Not Found"
+// @Failure      409             {object}  httputils.ErrorResponse  "Conflict"
+// @Failure      422             {object}  httputils.ErrorResponse  "Validation errors"
+// @Failure      500             {object}  httputils.ErrorResponse  "Internal Server Error"
+// @Security     BearerAuth
+// @Router       /organization/{organizationId}/member [post]
+func (o *OrganizationAPI) AddMember(w http.ResponseWriter, req *http.Request) {
+	ctx := req.Context()
+	orgId, ok := o.owner(w, req)
+	if !ok {
+		return
+	}
+
+	var ar AddMemberRequest
+	err := httputils.ReadJson(req, &ar)
+	if err != nil {
+		logging.WithContext(ctx).WithError(err).Debug("unable to read request")
+		httputils.BadRequest(ctx, w, err)
+		return
+	}
+	err = ar.Validate()
+	if err != nil {
+		httputils.UnProcessableEntity(ctx, w, err)
+		return
+	}
+
+	u, err := o.userRepo.GetByEmail(ctx, ar.Email)
+	if err != nil {
+		if errors.Is(err, user.ErrUserNotFound) {
+			httputils.NotFound(ctx, w, ErrOrganizationUserNotFound)
+			return
+		}
+		logging.WithContext(ctx).WithError(err).Error("unable to get user by email")
+		httputils.InternalServerError(ctx, w, mkerror.ErrInternalError)
+		return
+	}
+
+	now := time.Now().UTC()
+	m := organization.Member{
+		OrganizationId: orgId,
+		UserId:         u.Id,
+		Email:          u.Email,
+		Role:           ar.Role,
+		CreatedAt:      now,
+		UpdatedAt:      now,
+	}
+	err = o.orgRepo.AddMember(ctx, m)
+	if err != nil {
+		if errors.Is(err, organization.ErrMemberExists) {
+			httputils.Conflict(ctx, w, ErrOrganizationMemberExists)
+			return
+		}
+		logging.WithContext(ctx).WithError(err).Error("unable to add member")
+		httputils.InternalServerError(ctx, w, mkerror.ErrInternalError)
+		return
+	}
+
+	o.auditor.Record(ctx, audit.Event{Action: audit.ActionMemberAdded, TargetType: audit.TargetOrganization, TargetId: orgId,
+		Metadata: audit.Metadata{"userId": m.UserId, "role": m.Role}})
+	httputils.OK(ctx, w, MemberResponse(m))
+}
+
+// UpdateMember func for changing the role of a member.
+// @Description  Change the role of a member, only owners can change roles.
+// @Description  The last owner of an organization can not be demoted.
+// @Summary      Update member
+// @Tags         Organization
+// @Accept       json
+// @Produce      json
+// @Param        organizationId  path      string               true  "organization id"
+// @Param        userId          path      string               true  "user id"
+// @Param        data            body      UpdateMemberRequest  true  "Role"
+// @Success      200             {object}  MemberResponse
+// @Failure      400             {object}  httputils.ErrorResponse  "Bad Request"
+// @Failure      401             {object}  httputils.ErrorResponse  "Unauthorized"
+// @Failure      403             {object}  httputils.ErrorResponse  "Forbidden"
+// @Failure      404             {object}  httputils.ErrorResponse  "Not Found"
+// @Failure      409             {object}  httputils.ErrorResponse  "Conflict"
+// @Failure      422             {object}  httputils.ErrorResponse  "Validation errors"
+// @Failure      500             {object}  httputils.ErrorResponse  "Internal Server Error"
+// @Security     BearerAuth
+// @Router       /organization/{organizationId}/member/{userId} [put]
+func (o *OrganizationAPI) UpdateMember(w http.ResponseWriter, req *http.Request) {
+	ctx := req.Context()
+	orgId, ok := o.owner(w, req)
+	if !ok {
+		return
+	}
+
+	var ur UpdateMemberRequest
+	err := httputils.ReadJson(req, &ur)
+	if err != nil {
+		logging.WithContext(ctx).WithError(err).Debug("unable to read request")
+		httputils.BadRequest(ctx, w, err)
+		return
+	}
+	err = ur.Validate()
+	if err != nil {
+		httputils.UnProcessableEntity(ctx, w, err)
+		return
+	}
+
+	m := organization.Member{
+		OrganizationId: orgId,
+		UserId:         chi.URLParam(req, "userId"),
+		Role:           ur.Role,
+		UpdatedAt:      time.Now().UTC(),
+	}
+	err = o.orgRepo.UpdateMemberRole(ctx, m)
+	if err != nil {
+		o.memberChangeFailed(w, req, err)
+		return
+	}
+
+	o.auditor.Record(ctx, audit.Event{Action: audit.ActionMemberRoleChanged, TargetType: audit.TargetOrganization, TargetId: orgId,
+		Metadata: audit.Metadata{"userId": m.UserId, "role": m.Role}})
+	httputils.OK(ctx, w, MemberResponse(m))
+}
+
+// RemoveMember func for removing a member from an organization.
+// @Description  Remove a member, owners can remove anyone and every member can leave.
+// @Description  The last owner of an organization can not be removed.
+// @Summary      Remove member
+// @Tags         Organization
+// @Produce      json
+// @Param        organizationId  path      string  true  "organization id"
+// @Param        userId          path      string  true  "user id"
+// @Success      200             {object}  RemoveMemberResponse
+// @Failure      400             {object}  httputils.ErrorResponse  "Organization id is not a uuid"
+// @Failure      401             {object}  httputils.ErrorResponse  "Unauthorized"
+// @Failure      403             {object}  httputils.ErrorResponse  "Forbidden"
+// @Failure      404             {object}  httputils.ErrorResponse  "Not Found"
+// @Failure      409             {object}  httputils.ErrorResponse  "Conflict"
+// @Failure      500             {object}  httputils.ErrorResponse  "Internal Server Error"
+// @Security     BearerAuth
+// @Router       /organization/{organizationId}/member/{userId} [delete]
+func (o *OrganizationAPI) RemoveMember(w http.ResponseWriter, req *http.Request) {
+	ctx := req.Context()
+	userId, ok := userIdFromRequest(w, req)
+	if !ok {
+		return
+	}
+	orgId := chi.URLParam(req, "organizationId")
+	memberId := chi.URLParam(req, "userId")
+
+	caller, ok := o.member(w, req, orgId, userId)
+	if !ok {
+		return
+	}
+	if memberId != userId && !caller.Role.CanManage() {
+		httputils.Forbidden(ctx, w, ErrOrganizationNotOwner)
+		return
+	}
+
+	err := o.orgRepo.RemoveMember(ctx, orgId, memberId)
+	if err != nil {
+		o.memberChangeFailed(w, req, err)
+		return
+	}
+
+	o.auditor.Record(ctx, audit.Event{Action: audit.ActionMemberRemoved, TargetType: audit.TargetOrganization, TargetId: orgId, Metadata: audit.Metadata{"userId": memberId}})
+	httputils.OK(ctx, w, RemoveMemberResponse{UserId: memberId})
+}
+
+// member returns the membership of the user, organizations the user is not
+// a member of are reported as not found.
+func (o *OrganizationAPI) member(w http.ResponseWriter, req *http.Request, orgId, userId string) (organization.Member, bool) {
+	ctx := req.Context()
+	if !organization.ValidId(orgId) {
+		httputils.BadRequest(ctx, w, mkerror.ErrOrganizationIdInvalid)
+		return organization.Member{}, false
+	}
+	m, err := o.orgRepo.GetMember(ctx, orgId, userId)
+	if err != nil {
+		if errors.Is(err, organization.ErrMemberNotFound) {
+			httputils.NotFound(ctx, w, ErrOrganizationNotFound)
+			return organization.Member{}, false
+		}
+		logging.WithContext(ctx).WithError(err).Error("unable to get member")
+		httputils.InternalServerError(ctx, w, mkerror.ErrInternalError)
+		return organization.Member{}, false
+	}
+	return m, true
+}
+
+// owner checks the caller owns the organization in the path.
+func (o *OrganizationAPI) owner(w http.ResponseWriter, req *http.Request) (string, bool) {
+	userId, ok := userIdFromRequest(w, req)
+	if !ok {
+		return "", false
+	}
+	orgId := chi.URLParam(req, "organizationId")
+	m, ok := o.member(w, req, orgId, userId)
+	if !ok {
+		return "", false
+	}
+	if !m.Role.CanManage() {
+		httputils.Forbidden(req.Context(), w, ErrOrganizationNotOwner)
+		return "", false
+	}
+	return orgId, true
+}
+
+func (o *OrganizationAPI) memberChangeFailed(w http.ResponseWriter, req *http.Request, err error) {
+	ctx := req.Context()
+	switch {
+	case errors.Is(err, organization.ErrMemberNotFound), errors.Is(err, organization.ErrOrganizationNotFound):
+		httputils.NotFound(ctx, w, ErrOrganizationMemberNotFound)
+	case errors.Is(err, organization.ErrLastOwner):
+		httputils.Conflict(ctx, w, ErrOrganizationLastOwner)
+	default:
+		logging.WithContext(ctx).WithError(err).Error("unable to change member")
+		httputils.InternalServerError(ctx, w, mkerror.ErrInternalError)
+	}
+}
+
+func userIdFromRequest(w http.ResponseWriter, req *http.Request) (string, bool) {
+	ctx := req.Context()
+	userId, err := contexts.UserIdFromContext(ctx)
+	if err != nil {
+		logging.Debug("unable to get userId from context")
+		httputils.BadRequest(ctx, w, mkerror.ErrUnableToGetUserIdFromContext)
+		return "", false
+	}
+	return userId, true
+}
@@ -0,0 +1,151 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"github.com/go-chi/chi/v5"
+	"github.com/rengas/pdfgen/pkg/audit"
+	"github.com/rengas/pdfgen/pkg/contexts"
+	cmiddleware "github.com/rengas/pdfgen/pkg/middleware"
+	"github.com/rengas/pdfgen/pkg/organization"
+	"github.com/rengas/pdfgen/pkg/token"
+	"github.com/rengas/pdfgen/pkg/user"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+type fakeOrganizations struct {
+	OrganizationRepository
+	members map[string]organization.Role
+}
+
+func (f fakeOrganizations) GetMember(ctx context.Context, organizationId, userId string) (organization.Member, error) {
+	role, ok := f.members[organizationId+"/"+userId]
+	if !ok {
+		return organization.Member{}, organization.ErrMemberNotFound
+	}
+	return organization.Member{OrganizationId: organizationId, UserId: userId, Role: role}, nil
+}
+
+func (f fakeOrganizations) RemoveMember(ctx context.Context, organizationId, userId string) error {
+	return nil
+}
+
+type recordingAuditor struct {
+	events *[]audit.Event
+}
+
+func (r recordingAuditor) Record(ctx context.Context, e audit.Event) {
+	*r.events = append(*r.events, e)
+}
+
+type fakeUsers struct {
+	UserRepository
+}
+
+func (fakeUsers) GetById(ctx context.Context, id string) (user.User, error) {
+	return user.User{Id: id, Email: id + "@example.com"}, nil
+}
+
+// orgA is the id of the organization of the tests.
+const orgA = "5b0d3a4e-54c2-4c4a-9a57-4f2d0b1c8e21"
+
+func TestSwitchOrganization(t *testing.T) {
+	orgs := fakeOrganizations{members: map[string]organization.Role{orgA + "/user-1": organization.RoleEditor}}
+	jwt := token.NewJWT("access-secret", "refresh-secret", 30, 2)
+	api := NewOrganizationAPI(orgs, fakeUsers{}, jwt, fakeAuditor{})
+
+	tests := []struct {
+		name     string
+		body     string
+		wantCode int
+		wantOrg  string
+		wantRole string
+	}{
+		{name: "organization", body: `{"organizationId": "` + orgA + `"}`, wantCode: http.StatusOK, wantOrg: orgA, wantRole: "editor"},
+		{name: "personal workspace", body: `{}`, wantCode: http.StatusOK},
+		{name: "not a uuid", body: `{"organizationId": "org-a"}`, wantCode: http.StatusBadRequest},
+	}
+
+	for _, tc := range tests {
+		req := httptest.NewRequest(http.MethodPost, "/organization/switch", strings.NewReader(tc.body))
+		req = req.WithContext(contexts.WithUserId(req.Context(), "user-1"))
+		rec := httptest.NewRecorder()
+		api.SwitchOrganization(rec, req)
+		if rec.Code != tc.wantCode {
+			t.Fatalf("%s: expected: %v, got: %v %s", tc.name, tc.wantCode, rec.Code, rec.Body)
+		}
+		if tc.wantCode != http.StatusOK {
+			continue
+		}
+		var rs LoginResponse
+		if err := json.Unmarshal(rec.Body.Bytes(), &rs); err != nil {
+			t.Fatalf("%s: %v", tc.name, err)
+		}
+
+		var gotOrg, gotRole string
+		next := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			gotOrg, _ = contexts.OrganizationIdFromContext(r.Context())
+			gotRole, _ = contexts.OrganizationRoleFromContext(r.Context())
+		})
+		handler := cmiddleware.NewJWTToken(jwt).VerifyToken(cmiddleware.NewOrganization(orgs).ActiveOrganization(next))
+
+		req = httptest.NewRequest(http.MethodGet, "/design", nil)
+		req.Header.Set("Authorization", "Bearer "+rs.AccessToken)
+		rec = httptest.NewRecorder()
+		handler.ServeHTTP(rec, req)
+		if rec.Code != http.StatusOK {
+			t.Fatalf("%s: expected: %v, got: %v", tc.name, http.StatusOK, rec.Code)
+		}
+		if gotOrg != tc.wantOrg || gotRole != tc.wantRole {
+			t.Fatalf("%s: expected: %s/%s, got: %s/%s", tc.name, tc.wantOrg, tc.wantRole, gotOrg, gotRole)
+		}
+	}
+}
+
+func TestRemoveMemberAudit(t *testing.T) {
+	orgs := fakeOrganizations{members: map[string]organization.Role{
+		orgA + "/owner-1":  organization.RoleOwner,
+		orgA + "/viewer-1": organization.RoleViewer,
+	}}
+
+	tests := []struct {
+		name      string
+		caller    string
+		member    string
+		wantCode  int
+		wantEvent bool
+	}{
+		{name: "owner removes member", caller: "owner-1", member: "viewer-1", wantCode: http.StatusOK, wantEvent: true},
+		{name: "member leaves", caller: "viewer-1", member: "viewer-1", wantCode: http.StatusOK, wantEvent: true},
+		{name: "viewer removes owner", caller: "viewer-1", member: "owner-1", wantCode: http.StatusForbidden},
+	}
+
+	for _, tc := range tests {
+		var events []audit.Event
+		api := NewOrganizationAPI(orgs, fakeUsers{}, nil, recordingAuditor{events: &events})
+
+		rctx := chi.NewRouteContext()
+		rctx.URLParams.Add("organizationId", orgA)
+		rctx.URLParams.Add("userId", tc.member)
+		req := httptest.NewRequest(http.MethodDelete, "/organization/"+orgA+"/member/"+tc.member, nil)
+		ctx := context.WithValue(contexts.WithUserId(req.Context(), tc.caller), chi.RouteCtxKey, rctx)
+		rec := httptest.NewRecorder()
+		api.RemoveMember(rec, req.WithContext(ctx))
+
+		if rec.Code != tc.wantCode {
+			t.Fatalf("%s: expected: %v, got: %v %s", tc.name, tc.wantCode, rec.Code, rec.Body)
+		}
+		if !tc.wantEvent {
+			if len(events) != 0 {
+				t.Fatalf("%s: expected: no event, got: %+v", tc.name, events)
+			}
+			continue
+		}
+		if len(events) != 1 || events[0].Action != audit.ActionMemberRemoved || events[0].TargetId != orgA || events[0].Metadata["userId"] != tc.member {
+			t.Fatalf("%s: expected: %v of %v, got: %+v", tc.name, audit.ActionMemberRemoved, tc.member, events)
+		}
+	}
+}
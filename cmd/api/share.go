@@ -0,0 +1,276 @@
+package main
+
+import (
+	"errors"
+	"github.com/go-chi/chi/v5"
+	"github.com/google/uuid"
+	"github.com/rengas/pdfgen/pkg/audit"
+	"github.com/rengas/pdfgen/pkg/design"
+	mkerror "github.com/rengas/pdfgen/pkg/errors"
+	"github.com/rengas/pdfgen/pkg/httputils"
+	"github.com/rengas/pdfgen/pkg/logging"
+	"net/http"
+	"strings"
+	"time"
+)
+
+type ShareAPI struct {
+	designRepo DesignRepository
+	shareRepo  ShareRepository
+	userRepo   UserRepository
+	auditor    Auditor
+}
+
+func NewShareAPI(designRepo DesignRepository,
+	shareRepo ShareRepository,
+	userRepo UserRepository,
+	auditor Auditor) *ShareAPI {
+	return &ShareAPI{
+		designRepo: designRepo,
+		shareRepo:  shareRepo,
+		userRepo:   userRepo,
+		auditor:    auditor,
+	}
+}
+
+// ShareDesign func for inviting a user to a design.
+// @Description  Invite a user by email to read, generate or edit a single design.
+// @Description  The invitee gets access once the invitation is accepted, the email does not need to be registered yet.
+// @Summary      Share design
+// @Tags         Design
+// @Accept       json
+// @Produce      json
+// @Param        designId  path      string              true  "design id"
+// @Param        data      body      ShareDesignRequest  true  "Invitation"
+// @Success      200       {object}  ShareResponse
+// @Failure      400       {object}  httputils.ErrorResponse  "Bad Request"
+// @Failure      403       {object}  httputils.ErrorResponse  "Forbidden"
+// @Failure      404       {object}  httputils.ErrorResponse  "Not Found"
+// @Failure      409       {object}  httputils.ErrorResponse  "Conflict"
+// @Failure      422       {object}  httputils.ErrorResponse  "Validation errors"
+// @Failure      500       {object}  httputils.ErrorResponse  "Internal Server Error"
+// @Security     BearerAuth
+// @Router       /design/{designId}/share [post]
+func (s *ShareAPI) ShareDesign(w http.ResponseWriter, req *http.Request) {
+	ctx := req.Context()
+	userId, ds, ok := s.manageable(w, req)
+	if !ok {
+		return
+	}
+
+	var sr ShareDesignRequest
+	err := httputils.ReadJson(req, &sr)
+	if err != nil {
+		logging.WithContext(ctx).WithError(err).Debug("unable to read request")
+		httputils.BadRequest(ctx, w, err)
+		return
+	}
+	err = sr.Validate()
+	if err != nil {
+		httputils.UnProcessableEntity(ctx, w, err)
+		return
+	}
+
+	u, err := s.userRepo.GetById(ctx, userId)
+	if err != nil {
+		logging.WithContext(ctx).WithError(err).Debug("unable to get user")
+		httputils.UnAuthorized(ctx, w, mkerror.ErrUnAuthorizedError)
+		return
+	}
+	if strings.EqualFold(u.Email, sr.Email) {
+		httputils.UnProcessableEntity(ctx, w, ErrShareWithSelf)
+		return
+	}
+
+	sh := design.Share{
+		Id:         uuid.NewString(),
+		DesignId:   ds.Id,
+		DesignName: ds.Name,
+		Email:      sr.Email,
+		Permission: sr.Permission,
+		InvitedBy:  userId,
+		CreatedAt:  time.Now().UTC(),
+	}
+	err = s.shareRepo.Save(ctx, sh)
+	if err != nil {
+		if errors.Is(err, design.ErrShareExists) {
+			httputils.Conflict(ctx, w, ErrShareExists)
+			return
+		}
+		logging.WithContext(ctx).WithError(err).Error("unable to save share")
+		httputils.InternalServerError(ctx, w, mkerror.ErrInternalError)
+		return
+	}
+
+	s.auditor.Record(ctx, audit.Event{Action: audit.ActionShareCreated, TargetType: audit.TargetShare, TargetId: sh.Id,
+		Metadata: audit.Metadata{"designId": sh.DesignId, "email": sh.Email, "permission": sh.Permission}})
+	httputils.OK(ctx, w, ShareResponse(sh))
+}
+
+// ListShares func for listing who a design is shared with.
+// @Description  List accepted shares and pending invitations of a design.
+// @Summary      List design shares
+// @Tags         Design
+// @Produce      json
+// @Param        designId  path      string  true  "design id"
+// @Success      200       {object}  ListShareResponse
+// @Failure      403       {object}  httputils.ErrorResponse  "Forbidden"
+// @Failure      404       {object}  httputils.ErrorResponse  "Not Found"
+// @Failure      500       {object}  httputils.ErrorResponse  "Internal Server Error"
+// @Security     BearerAuth
+// @Router       /design/{designId}/share [get]
+func (s *ShareAPI) ListShares(w http.ResponseWriter, req *http.Request) {
+	ctx := req.Context()
+	_, ds, ok := s.manageable(w, req)
+	if !ok {
+		return
+	}
+
+	ss, err := s.shareRepo.ListByDesignId(ctx, ds.Id)
+	if err != nil {
+		logging.WithContext(ctx).WithError(err).Error("unable to list shares")
+		httputils.InternalServerError(ctx, w, mkerror.ErrInternalError)
+		return
+	}
+
+	httputils.OK(ctx, w, ListShareResponse{Shares: ss})
+}
+
+// RevokeShare func for revoking access to a design.
+// @Description  Revoke a share or withdraw a pending invitation.
+// @Summary      Revoke design share
+// @Tags         Design
+// @Produce      json
+// @Param        designId  path      string  true  "design id"
+// @Param        shareId   path      string  true  "share id"
+// @Success      200       {object}  RevokeShareResponse
+// @Failure      403       {object}  httputils.ErrorResponse  "Forbidden"
+// @Failure      404       {object}  httputils.ErrorResponse  "Not Found"
+// @Failure      500       {object}  httputils.ErrorResponse  "Internal Server Error"
+// @Security     BearerAuth
+// @Router       /design/{designId}/share/{shareId} [delete]
+func (s *ShareAPI) RevokeShare(w http.ResponseWriter, req *http.Request) {
+	ctx := req.Context()
+	_, ds, ok := s.manageable(w, req)
+	if !ok {
+		return
+	}
+
+	shareId := chi.URLParam(req, "shareId")
+	err := s.shareRepo.Revoke(ctx, ds.Id, shareId, time.Now().UTC())
+	if err != nil {
+		if errors.Is(err, design.ErrShareNotFound) {
+			httputils.NotFound(ctx, w, ErrShareNotFound)
+			return
+		}
+		logging.WithContext(ctx).WithError(err).Error("unable to revoke share")
+		httputils.InternalServerError(ctx, w, mkerror.ErrInternalError)
+		return
+	}
+
+	s.auditor.Record(ctx, audit.Event{Action: audit.ActionShareRevoked, TargetType: audit.TargetShare, TargetId: shareId, Metadata: audit.Metadata{"designId": ds.Id}})
+	httputils.OK(ctx, w, RevokeShareResponse{Id: shareId})
+}
+
+// ListInvitations func for listing invitations of the user.
+// @Description  List pending design invitations addressed to the email of the caller.
+// @Summary      List design invitations
+// @Tags         Design
+// @Produce      json
+// @Success      200  {object}  ListInvitationResponse
+// @Failure      401  {object}  httputils.ErrorResponse  "Unauthorized"
+// @Failure      500  {object}  httputils.ErrorResponse  "Internal Server Error"
+// @Security     BearerAuth
+// @Router       /design/share/invitation [get]
+func (s *ShareAPI) ListInvitations(w http.ResponseWriter, req *http.Request) {
+	ctx := req.Context()
+	userId, ok := userIdFromRequest(w, req)
+	if !ok {
+		return
+	}
+	u, err := s.userRepo.GetById(ctx, userId)
+	if err != nil {
+		logging.WithContext(ctx).WithError(err).Debug("unable to get user")
+		httputils.UnAuthorized(ctx, w, mkerror.ErrUnAuthorizedError)
+		return
+	}
+
+	ss, err := s.shareRepo.ListPending(ctx, u.Email)
+	if err != nil {
+		logging.WithContext(ctx).WithError(err).Error("unable to list invitations")
+		httputils.InternalServerError(ctx, w, mkerror.ErrInternalError)
+		return
+	}
+
+	httputils.OK(ctx, w, ListInvitationResponse{Invitations: ss})
+}
+
+// AcceptInvitation func for accepting a design invitation.
+// @Description  Accept an invitation addressed to the email of the caller, the design then shows up in the design list flagged as shared.
+// @Summary      Accept design invitation
+// @Tags         Design
+// @Produce      json
+// @Param        shareId  path      string  true  "share id"
+// @Success      200      {object}  ShareResponse
+// @Failure      401      {object}  httputils.ErrorResponse  "Unauthorized"
+// @Failure      404      {object}  httputils.ErrorResponse  "Not Found"
+// @Failure      409      {object}  httputils.ErrorResponse  "Conflict"
+// @Failure      500      {object}  httputils.ErrorResponse  "Internal Server Error"
+// @Security     BearerAuth
+// @Router       /design/share/{shareId}/accept [post]
+func (s *ShareAPI) AcceptInvitation(w http.ResponseWriter, req *http.Request) {
+	ctx := req.Context()
+	userId, ok := userIdFromRequest(w, req)
+	if !ok {
+		return
+	}
+	u, err := s.userRepo.GetById(ctx, userId)
+	if err != nil {
+		logging.WithContext(ctx).WithError(err).Debug("unable to get user")
+		httputils.UnAuthorized(ctx, w, mkerror.ErrUnAuthorizedError)
+		return
+	}
+
+	sh, err := s.shareRepo.Accept(ctx, chi.URLParam(req, "shareId"), u.Id, u.Email, time.Now().UTC())
+	if err != nil {
+		switch {
+		case errors.Is(err, design.ErrShareNotFound):
+			httputils.NotFound(ctx, w, ErrShareNotFound)
+		case errors.Is(err, design.ErrShareExists):
+			httputils.Conflict(ctx, w, ErrShareExists)
+		default:
+			logging.WithContext(ctx).WithError(err).Error("unable to accept invitation")
+			httputils.InternalServerError(ctx, w, mkerror.ErrInternalError)
+		}
+		return
+	}
+
+	s.auditor.Record(ctx, audit.Event{Action: audit.ActionShareAccepted, TargetType: audit.TargetShare, TargetId: sh.Id, Metadata: audit.Metadata{"designId": sh.DesignId}})
+	httputils.OK(ctx, w, ShareResponse(sh))
+}
+
+// manageable gets the design in the path if the caller may share it, users a
+// design is shared with can not share it further.
+func (s *ShareAPI) manageable(w http.ResponseWriter, req *http.Request) (string, design.Design, bool) {
+	ctx := req.Context()
+	userId, ok := userIdFromRequest(w, req)
+	if !ok {
+		return "", design.Design{}, false
+	}
+
+	ds, err := s.designRepo.GetById(ctx, userId, chi.URLParam(req, "designId"))
+	if err != nil {
+		if errors.Is(err, design.ErrDesignNotFound) {
+			httputils.NotFound(ctx, w, ErrDesignNotFound)
+			return "", design.Design{}, false
+		}
+		logging.WithContext(ctx).WithError(err).Error("unable to get design")
+		httputils.InternalServerError(ctx, w, ErrDesignUnableToGetDesign)
+		return "", design.Design{}, false
+	}
+	if !ds.CanManage() {
+		httputils.Forbidden(ctx, w, ErrShareNotAllowed)
+		return "", design.Design{}, false
+	}
+	return userId, ds, true
+}
@@ -0,0 +1,253 @@
+package main
+
+import (
+	"errors"
+	"github.com/google/uuid"
+	"github.com/rengas/pdfgen/pkg/audit"
+	mkerror "github.com/rengas/pdfgen/pkg/errors"
+	"github.com/rengas/pdfgen/pkg/httputils"
+	"github.com/rengas/pdfgen/pkg/logging"
+	"github.com/rengas/pdfgen/pkg/oidc"
+	"github.com/rengas/pdfgen/pkg/user"
+	"net/http"
+	"time"
+)
+
+const (
+	oidcStateBytes    = 32
+	oidcVerifierBytes = 48
+	oidcLoginTimeout  = 10 * time.Minute
+)
+
+type SSOAPI struct {
+	client     OIDCClient
+	states     LoginStateRepository
+	identities IdentityRepository
+	userRepo   UserRepository
+	mfaRepo    MFARepository
+	jwt        JWTToken
+	auditor    Auditor
+}
+
+func NewSSOAPI(client OIDCClient,
+	states LoginStateRepository,
+	identities IdentityRepository,
+	userRepo UserRepository,
+	mfaRepo MFARepository,
+	jwt JWTToken,
+	auditor Auditor) *SSOAPI {
+	return &SSOAPI{
+		client:     client,
+		states:     states,
+		identities: identities,
+		userRepo:   userRepo,
+		mfaRepo:    mfaRepo,
+		jwt:        jwt,
+		auditor:    auditor,
+	}
+}
+
+// Login func for starting single sign-on.
+// @Description  Redirect to the identity provider using the authorization code flow with PKCE.
+// @Summary      Single sign-on
+// @Tags         Auth
+// @Success      302
+// @Failure      500  {object}  httputils.ErrorResponse  "Internal Server Error"
+// @Router       /login/oidc [get]
+func (s *SSOAPI) Login(w http.ResponseWriter, req *http.Request) {
+	ctx := req.Context()
+
+	var ls oidc.LoginState
+	var err error
+	for _, v := range []*string{&ls.State, &ls.Nonce} {
+		*v, err = oidc.RandomString(oidcStateBytes)
+		if err != nil {
+			break
+		}
+	}
+	if err == nil {
+		ls.Verifier, err = oidc.RandomString(oidcVerifierBytes)
+	}
+	if err != nil {
+		logging.WithContext(ctx).WithError(err).Error("unable to generate login state")
+		httputils.InternalServerError(ctx, w, mkerror.ErrInternalError)
+		return
+	}
+	ls.CreatedAt = time.Now().UTC()
+
+	u, err := s.client.AuthCodeURL(ctx, ls.State, ls.Nonce, ls.Verifier)
+	if err != nil {
+		logging.WithContext(ctx).WithError(err).Error("unable to build authorization url")
+		httputils.InternalServerError(ctx, w, mkerror.ErrInternalError)
+		return
+	}
+
+	err = s.states.Save(ctx, ls)
+	if err != nil {
+		logging.WithContext(ctx).WithError(err).Error("unable to save login state")
+		httputils.InternalServerError(ctx, w, mkerror.ErrInternalError)
+		return
+	}
+
+	http.Redirect(w, req, u, http.StatusFound)
+}
+
+// Callback func for completing single sign-on.
+// @Description  Exchange the authorization code, validate the id token and log in the linked user.
+// @Description  A user is created on first login, an existing user with the same verified email is linked.
+// @Description  Users with two-factor authentication enabled get an mfa challenge instead of a token pair, as from /login.
+// @Summary      Single sign-on callback
+// @Tags         Auth
+// @Produce      json
+// @Param        code   query     string  true  "authorization code"
+// @Param        state  query     string  true  "state"
+// @Success      200    {object}  LoginResponse            "User account and token pair or mfa challenge"
+// @Failure      400    {object}  httputils.ErrorResponse  "Bad Request"
+// @Failure      401    {object}  httputils.ErrorResponse  "Unauthorized"
+// @Failure      409    {object}  httputils.ErrorResponse  "Conflict"
+// @Failure      422    {object}  httputils.ErrorResponse  "Validation errors"
+// @Failure      500    {object}  httputils.ErrorResponse  "Internal Server Error"
+// @Router       /login/oidc/callback [get]
+func (s *SSOAPI) Callback(w http.ResponseWriter, req *http.Request) {
+	ctx := req.Context()
+	q := req.URL.Query()
+
+	if e := q.Get("error"); e != "" {
+		logging.WithContext(ctx).
+			WithField(logging.Field{Label: "error", Value: e}).
+			WithField(logging.Field{Label: "description", Value: q.Get("error_description")}).
+			Info("identity provider returned an error")
+		httputils.UnAuthorized(ctx, w, ErrSSOProviderError)
+		return
+	}
+	if q.Get("state") == "" {
+		httputils.BadRequest(ctx, w, ErrSSOStateIsEmpty)
+		return
+	}
+	if q.Get("code") == "" {
+		httputils.BadRequest(ctx, w, ErrSSOCodeIsEmpty)
+		return
+	}
+
+	ls, err := s.states.Consume(ctx, q.Get("state"), time.Now().UTC().Add(-oidcLoginTimeout))
+	if err != nil {
+		if errors.Is(err, oidc.ErrLoginStateNotFound) {
+			httputils.UnAuthorized(ctx, w, ErrSSOLoginExpired)
+			return
+		}
+		logging.WithContext(ctx).WithError(err).Error("unable to get login state")
+		httputils.InternalServerError(ctx, w, mkerror.ErrInternalError)
+		return
+	}
+
+	tokens, err := s.client.Exchange(ctx, q.Get("code"), ls.Verifier)
+	if err != nil {
+		logging.WithContext(ctx).WithError(err).Info("unable to exchange code")
+		httputils.UnAuthorized(ctx, w, ErrSSOProviderError)
+		return
+	}
+
+	id, err := s.client.VerifyIDToken(ctx, tokens.IDToken, ls.Nonce)
+	if err != nil {
+		logging.WithContext(ctx).WithError(err).Info("invalid id token")
+		httputils.UnAuthorized(ctx, w, mkerror.ErrUnAuthorizedError)
+		return
+	}
+
+	u, err := s.identities.GetByIdentity(ctx, id.Issuer, id.Subject)
+	if err == nil {
+		s.loggedIn(w, req, u, id)
+		return
+	}
+	if !errors.Is(err, user.ErrUserNotFound) {
+		logging.WithContext(ctx).WithError(err).Error("unable to get identity")
+		httputils.InternalServerError(ctx, w, mkerror.ErrInternalError)
+		return
+	}
+
+	u, ok := s.linkOrCreate(w, req, id)
+	if !ok {
+		return
+	}
+	s.loggedIn(w, req, u, id)
+}
+
+// loggedIn issues the token pair of a user the identity provider
+// authenticated, users with two-factor authentication must still pass it.
+func (s *SSOAPI) loggedIn(w http.ResponseWriter, req *http.Request, u user.User, id oidc.Identity) {
+	if requireMFA(w, req, s.jwt, s.mfaRepo, u) {
+		return
+	}
+	s.auditor.Record(req.Context(), audit.Event{
+		Actor:      u.Id,
+		Action:     audit.ActionLoginSucceeded,
+		TargetType: audit.TargetUser,
+		TargetId:   u.Id,
+		Metadata:   audit.Metadata{"issuer": id.Issuer},
+	})
+	writeTokenPair(w, req, s.jwt, u, "")
+}
+
+// linkOrCreate maps a first time identity to a user. Linking to an existing
+// account requires the provider to have verified the email, otherwise anyone
+// able to register the address at the provider could take over the account.
+func (s *SSOAPI) linkOrCreate(w http.ResponseWriter, req *http.Request, id oidc.Identity) (user.User, bool) {
+	ctx := req.Context()
+	if id.Email == "" {
+		httputils.UnProcessableEntity(ctx, w, ErrSSOEmailMissing)
+		return user.User{}, false
+	}
+
+	now := time.Now().UTC()
+	identity := user.Identity{
+		Issuer:    id.Issuer,
+		Subject:   id.Subject,
+		Email:     id.Email,
+		CreatedAt: now,
+	}
+
+	existing, err := s.userRepo.GetByEmail(ctx, id.Email)
+	if err != nil && !errors.Is(err, user.ErrUserNotFound) {
+		logging.WithContext(ctx).WithError(err).Error("unable to get user by email")
+		httputils.InternalServerError(ctx, w, mkerror.ErrInternalError)
+		return user.User{}, false
+	}
+
+	if existing.Id != "" {
+		if !id.EmailVerified {
+			httputils.Conflict(ctx, w, ErrSSOEmailNotVerified)
+			return user.User{}, false
+		}
+		identity.UserId = existing.Id
+		err = s.identities.SaveIdentity(ctx, identity)
+		if err != nil {
+			logging.WithContext(ctx).WithError(err).Error("unable to link identity")
+			httputils.InternalServerError(ctx, w, mkerror.ErrInternalError)
+			return user.User{}, false
+		}
+		return existing, true
+	}
+
+	// single sign-on users have no password, an empty hash never matches
+	u := user.User{
+		Id:        uuid.NewString(),
+		Email:     id.Email,
+		Role:      user.RoleNormal,
+		CreatedAt: now,
+		UpdatedAt: now,
+	}
+	if id.GivenName != "" {
+		u.FirstName = &id.GivenName
+	}
+	if id.FamilyName != "" {
+		u.LastName = &id.FamilyName
+	}
+
+	err = s.identities.SaveNewUserWithIdentity(ctx, u, identity)
+	if err != nil {
+		logging.WithContext(ctx).WithError(err).Error("unable to create user")
+		httputils.InternalServerError(ctx, w, mkerror.ErrInternalError)
+		return user.User{}, false
+	}
+	return u, true
+}
@@ -0,0 +1,109 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"github.com/rengas/pdfgen/pkg/audit"
+	"github.com/rengas/pdfgen/pkg/mfa"
+	"github.com/rengas/pdfgen/pkg/oidc"
+	"github.com/rengas/pdfgen/pkg/token"
+	"github.com/rengas/pdfgen/pkg/user"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+type fakeOIDC struct {
+	OIDCClient
+	identity oidc.Identity
+}
+
+func (f fakeOIDC) Exchange(ctx context.Context, code, verifier string) (oidc.Tokens, error) {
+	return oidc.Tokens{IDToken: "id-token"}, nil
+}
+
+func (f fakeOIDC) VerifyIDToken(ctx context.Context, raw, nonce string) (oidc.Identity, error) {
+	return f.identity, nil
+}
+
+type fakeLoginStates struct {
+	LoginStateRepository
+}
+
+func (fakeLoginStates) Consume(ctx context.Context, state string, notBefore time.Time) (oidc.LoginState, error) {
+	return oidc.LoginState{State: state}, nil
+}
+
+type fakeIdentities struct {
+	IdentityRepository
+	users map[string]user.User
+}
+
+func (f fakeIdentities) GetByIdentity(ctx context.Context, issuer, subject string) (user.User, error) {
+	u, ok := f.users[subject]
+	if !ok {
+		return user.User{}, user.ErrUserNotFound
+	}
+	return u, nil
+}
+
+type fakeMFA struct {
+	MFARepository
+	enabled map[string]bool
+}
+
+func (f fakeMFA) GetByUserId(ctx context.Context, userId string) (mfa.MFA, error) {
+	if !f.enabled[userId] {
+		return mfa.MFA{}, mfa.ErrMFANotFound
+	}
+	return mfa.MFA{UserId: userId, Enabled: true}, nil
+}
+
+type fakeAuditor struct{}
+
+func (fakeAuditor) Record(ctx context.Context, e audit.Event) {}
+
+func TestSSOCallbackMFA(t *testing.T) {
+	identities := fakeIdentities{users: map[string]user.User{
+		"sub-1": {Id: "user-1", Email: "ada@example.com"},
+		"sub-2": {Id: "user-2", Email: "alan@example.com"},
+	}}
+	mfaRepo := fakeMFA{enabled: map[string]bool{"user-2": true}}
+	jwt := token.NewJWT("access-secret", "refresh-secret", 30, 2)
+
+	tests := []struct {
+		name       string
+		subject    string
+		wantTokens bool
+		wantMFA    bool
+	}{
+		{name: "without second factor", subject: "sub-1", wantTokens: true},
+		{name: "with second factor", subject: "sub-2", wantMFA: true},
+	}
+
+	for _, tc := range tests {
+		client := fakeOIDC{identity: oidc.Identity{Issuer: "https://idp.example.com", Subject: tc.subject}}
+		api := NewSSOAPI(client, fakeLoginStates{}, identities, fakeUsers{}, mfaRepo, jwt, fakeAuditor{})
+
+		req := httptest.NewRequest(http.MethodGet, "/login/oidc/callback?code=abc&state=xyz", nil)
+		rec := httptest.NewRecorder()
+		api.Callback(rec, req)
+		if rec.Code != http.StatusOK {
+			t.Fatalf("%s: expected: %v, got: %v %s", tc.name, http.StatusOK, rec.Code, rec.Body)
+		}
+
+		var rs LoginResponse
+		if err := json.Unmarshal(rec.Body.Bytes(), &rs); err != nil {
+			t.Fatalf("%s: %v", tc.name, err)
+		}
+		if (rs.AccessToken != "") != tc.wantTokens || rs.MFARequired != tc.wantMFA {
+			t.Fatalf("%s: expected: tokens %v mfa %v, got: %+v", tc.name, tc.wantTokens, tc.wantMFA, rs)
+		}
+		if tc.wantMFA {
+			if _, err := jwt.VerifyMFAChallenge(rs.MFAToken); err != nil {
+				t.Fatalf("%s: expected: mfa challenge, got: %v", tc.name, err)
+			}
+		}
+	}
+}
@@ -0,0 +1,76 @@
+package main
+
+import (
+	"errors"
+	"github.com/go-chi/chi/v5"
+	"github.com/rengas/pdfgen/pkg/design"
+	mkerror "github.com/rengas/pdfgen/pkg/errors"
+	"github.com/rengas/pdfgen/pkg/httputils"
+	"github.com/rengas/pdfgen/pkg/logging"
+	"github.com/rengas/pdfgen/pkg/thumbnail"
+	"net/http"
+)
+
+type ThumbnailAPI struct {
+	designRepo    DesignRepository
+	thumbnailRepo ThumbnailRepository
+}
+
+func NewThumbnailAPI(designRepo DesignRepository, thumbnailRepo ThumbnailRepository) *ThumbnailAPI {
+	return &ThumbnailAPI{
+		designRepo:    designRepo,
+		thumbnailRepo: thumbnailRepo,
+	}
+}
+
+// GetThumbnail func for reading the preview of a design.
+// @Description  Get a png of the first page of a design, it is rendered in the background after every save.
+// @Description  Answers 304 when If-None-Match has the ETag of the current thumbnail.
+// @Summary      Get design thumbnail
+// @Tags         Design
+// @Produce      image/png
+// @Param        designId  path      string  true  "design id"
+// @Success      200       {file}    file
+// @Failure      401       {object}  httputils.ErrorResponse  "Unauthorized"
+// @Failure      404       {object}  httputils.ErrorResponse  "Design not found or thumbnail not generated yet"
+// @Failure      500       {object}  httputils.ErrorResponse  "Internal Server Error"
+// @Security     BearerAuth
+// @Router       /design/{designId}/thumbnail [get]
+func (t *ThumbnailAPI) GetThumbnail(w http.ResponseWriter, req *http.Request) {
+	ctx := req.Context()
+	userId, ok := userIdFromRequest(w, req)
+	if !ok {
+		return
+	}
+
+	ds, err := t.designRepo.GetById(ctx, userId, chi.URLParam(req, "designId"))
+	if err != nil {
+		if errors.Is(err, design.ErrDesignNotFound) {
+			httputils.NotFound(ctx, w, ErrDesignNotFound)
+			return
+		}
+		logging.WithContext(ctx).WithError(err).Error("unable to get design")
+		httputils.InternalServerError(ctx, w, ErrDesignUnableToGetDesign)
+		return
+	}
+
+	th, err := t.thumbnailRepo.Get(ctx, ds.Id)
+	if err != nil {
+		if errors.Is(err, thumbnail.ErrThumbnailNotFound) {
+			httputils.NotFound(ctx, w, ErrThumbnailNotFound)
+			return
+		}
+		logging.WithContext(ctx).WithError(err).Error("unable to get thumbnail")
+		httputils.InternalServerError(ctx, w, mkerror.ErrInternalError)
+		return
+	}
+
+	etag := th.ETag()
+	w.Header().Set("ETag", etag)
+	w.Header().Set("Cache-Control", "private, no-cache")
+	if req.Header.Get("If-None-Match") == etag {
+		w.WriteHeader(http.StatusNotModified)
+		return
+	}
+	httputils.WriteContent(w, th.ContentType, th.Image, http.StatusOK)
+}
@@ -0,0 +1,53 @@
+package main
+
+import (
+	mkerror "github.com/rengas/pdfgen/pkg/errors"
+	"github.com/rengas/pdfgen/pkg/httputils"
+	"github.com/rengas/pdfgen/pkg/logging"
+	"github.com/rengas/pdfgen/pkg/usage"
+	"net/http"
+)
+
+type UsageAPI struct {
+	meter UsageMeter
+}
+
+func NewUsageAPI(meter UsageMeter) *UsageAPI {
+	return &UsageAPI{
+		meter: meter,
+	}
+}
+
+// GetUsage func for reading the usage of the current month.
+// @Description  Documents, pages and bytes generated in the current calendar month (UTC) and the limits of the plan, a limit of 0 is unlimited.
+// @Summary      Get usage
+// @Tags         User
+// @Produce      json
+// @Success      200  {object}  UsageResponse
+// @Failure      400  {object}  httputils.ErrorResponse  "Bad Request"
+// @Failure      500  {object}  httputils.ErrorResponse  "Internal Server Error"
+// @Security     BearerAuth
+// @Router       /user/usage [get]
+func (u *UsageAPI) GetUsage(w http.ResponseWriter, req *http.Request) {
+	ctx := req.Context()
+	userId, ok := userIdFromRequest(w, req)
+	if !ok {
+		return
+	}
+
+	used, plan, err := u.meter.Usage(ctx, userId)
+	if err != nil {
+		logging.WithContext(ctx).WithError(err).Error("unable to get usage")
+		httputils.InternalServerError(ctx, w, mkerror.ErrInternalError)
+		return
+	}
+
+	httputils.OK(ctx, w, UsageResponse{
+		Plan:        plan,
+		PeriodStart: used.Start,
+		PeriodEnd:   usage.PeriodEnd(used.Start),
+		Documents:   used.Documents,
+		Pages:       used.Pages,
+		Bytes:       used.Bytes,
+	})
+}
@@ -2,6 +2,8 @@ package main
 
 import (
 	"errors"
+	"github.com/rengas/pdfgen/pkg/audit"
+	"github.com/rengas/pdfgen/pkg/contexts"
 	mkerror "github.com/rengas/pdfgen/pkg/errors"
 	"github.com/rengas/pdfgen/pkg/httputils"
 	"github.com/rengas/pdfgen/pkg/logging"
@@ -12,11 +14,13 @@ import (
 
 type UserAPI struct {
 	userRepo UserRepository
+	auditor  Auditor
 }
 
-func NewUserAPI(userRepo UserRepository) *UserAPI {
+func NewUserAPI(userRepo UserRepository, auditor Auditor) *UserAPI {
 	return &UserAPI{
 		userRepo: userRepo,
+		auditor:  auditor,
 	}
 }
 
@@ -35,8 +39,8 @@ func NewUserAPI(userRepo UserRepository) *UserAPI {
 // @Router       /user [get]
 func (u *UserAPI) GetUser(w http.ResponseWriter, req *http.Request) {
 	ctx := req.Context()
-	userId, ok := ctx.Value("userId").(string)
-	if !ok {
+	userId, err := contexts.UserIdFromContext(ctx)
+	if err != nil {
 		logging.WithContext(ctx).Info("cannot find user id")
 		httputils.InternalServerError(ctx, w, mkerror.ErrInternalError)
 		return
@@ -46,6 +50,7 @@ func (u *UserAPI) GetUser(w http.ResponseWriter, req *http.Request) {
 		logging.Error("cannot find user id")
 		if errors.Is(err, user.ErrUserNotFound) {
 			httputils.NotFound(ctx, w, mkerror.ErrNotFound)
+			return
 		}
 		httputils.InternalServerError(ctx, w, mkerror.ErrInternalError)
 		return
@@ -94,8 +99,8 @@ func (u UpdateUserRequest) GetUser() user.User {
 // @Router       /user [put]
 func (u *UserAPI) UpdateUser(w http.ResponseWriter, req *http.Request) {
 	ctx := req.Context()
-	userId, ok := ctx.Value("userId").(string)
-	if !ok {
+	userId, err := contexts.UserIdFromContext(ctx)
+	if err != nil {
 		logging.Debug("unable to get userId from context")
 		httputils.InternalServerError(ctx, w, mkerror.ErrInternalError)
 		return
@@ -106,6 +111,7 @@ func (u *UserAPI) UpdateUser(w http.ResponseWriter, req *http.Request) {
 		logging.WithContext(ctx).Error(err.Error())
 		if errors.Is(err, user.ErrUserNotFound) {
 			httputils.NotFound(ctx, w, mkerror.ErrNotFound)
+			return
 		}
 		httputils.InternalServerError(ctx, w, mkerror.ErrInternalError)
 		return
@@ -155,6 +161,12 @@ func (u *UserAPI) UpdateUser(w http.ResponseWriter, req *http.Request) {
 		httputils.InternalServerError(ctx, w, mkerror.ErrInternalError)
 		return
 	}
+	u.auditor.Record(ctx, audit.Event{
+		Action:     audit.ActionUserUpdated,
+		TargetType: audit.TargetUser,
+		TargetId:   userId,
+		Metadata:   audit.Metadata{"emailChanged": usr.Email != updateUser.Email},
+	})
 	user := &UpdateUserResponse{
 		Id:        updateUser.Id,
 		Email:     updateUser.Email,
@@ -0,0 +1,2 @@
+DROP table user_recovery_code;
+DROP table user_mfa;
@@ -0,0 +1,20 @@
+-- totp second factor, one enrolment per user
+CREATE TABLE IF NOT EXISTS user_mfa (
+    user_id uuid PRIMARY KEY REFERENCES users(id),
+    secret VARCHAR(256) NOT NULL,
+    enabled BOOLEAN NOT NULL DEFAULT FALSE,
+    last_used_step BIGINT NOT NULL DEFAULT 0,
+    confirmed_at timestamp without time zone default NULL,
+    created_at timestamp without time zone default (now() at time zone 'utc'),
+    updated_at timestamp without time zone default (now() at time zone 'utc')
+);
+
+CREATE TABLE IF NOT EXISTS user_recovery_code (
+    id uuid PRIMARY KEY,
+    user_id uuid NOT NULL REFERENCES users(id),
+    code_hash VARCHAR(64) NOT NULL,
+    used_at timestamp without time zone default NULL,
+    created_at timestamp without time zone default (now() at time zone 'utc')
+);
+
+CREATE INDEX IF NOT EXISTS user_recovery_code_user_id_idx ON user_recovery_code(user_id);
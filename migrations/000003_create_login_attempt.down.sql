@@ -0,0 +1 @@
+DROP table login_attempt;
@@ -0,0 +1,10 @@
+-- failed login counters keyed by account or client ip
+CREATE TABLE IF NOT EXISTS login_attempt (
+    key VARCHAR(320) PRIMARY KEY,
+    failures INTEGER NOT NULL DEFAULT 0,
+    lockouts INTEGER NOT NULL DEFAULT 0,
+    locked_until timestamp without time zone default NULL,
+    last_failure_at timestamp without time zone NOT NULL
+);
+
+CREATE INDEX IF NOT EXISTS login_attempt_locked_until_idx ON login_attempt(locked_until);
@@ -0,0 +1,2 @@
+DROP table user_identity;
+DROP table oidc_login_state;
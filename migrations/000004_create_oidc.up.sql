@@ -0,0 +1,17 @@
+-- pending single sign-on logins
+CREATE TABLE IF NOT EXISTS oidc_login_state (
+    state VARCHAR(64) PRIMARY KEY,
+    nonce VARCHAR(64) NOT NULL,
+    verifier VARCHAR(128) NOT NULL,
+    created_at timestamp without time zone NOT NULL
+);
+
+-- identity provider accounts linked to users
+CREATE TABLE IF NOT EXISTS user_identity (
+    issuer VARCHAR(512) NOT NULL,
+    subject VARCHAR(256) NOT NULL,
+    user_id uuid NOT NULL REFERENCES users(id),
+    email VARCHAR(256) DEFAULT NULL,
+    created_at timestamp without time zone default (now() at time zone 'utc'),
+    PRIMARY KEY (issuer, subject)
+);
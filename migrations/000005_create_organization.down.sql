@@ -0,0 +1,4 @@
+ALTER TABLE design DROP COLUMN organization_id;
+DROP table organization_member;
+DROP table organization;
+DROP TYPE organization_role;
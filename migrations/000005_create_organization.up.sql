@@ -0,0 +1,25 @@
+CREATE TYPE organization_role AS ENUM ('owner', 'editor', 'viewer');
+
+-- shared workspaces
+CREATE TABLE IF NOT EXISTS organization (
+    id uuid PRIMARY KEY,
+    name VARCHAR(256) NOT NULL,
+    created_at timestamp without time zone default (now() at time zone 'utc'),
+    updated_at timestamp without time zone default (now() at time zone 'utc')
+);
+
+CREATE TABLE IF NOT EXISTS organization_member (
+    organization_id uuid NOT NULL REFERENCES organization(id) ON DELETE CASCADE,
+    user_id uuid NOT NULL REFERENCES users(id),
+    role organization_role NOT NULL,
+    created_at timestamp without time zone default (now() at time zone 'utc'),
+    updated_at timestamp without time zone default (now() at time zone 'utc'),
+    PRIMARY KEY (organization_id, user_id)
+);
+
+CREATE INDEX organization_member_user_id_idx ON organization_member(user_id);
+
+-- designs owned by an organization, user_id stays the creator
+ALTER TABLE design ADD COLUMN organization_id uuid DEFAULT NULL REFERENCES organization(id);
+
+CREATE INDEX design_organization_id_idx ON design(organization_id);
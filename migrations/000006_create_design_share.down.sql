@@ -0,0 +1,2 @@
+DROP table design_share;
+DROP TYPE share_permission;
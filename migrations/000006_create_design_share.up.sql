@@ -0,0 +1,18 @@
+CREATE TYPE share_permission AS ENUM ('read', 'generate', 'edit');
+
+-- designs shared with single users, user_id is set once the invitation is accepted
+CREATE TABLE IF NOT EXISTS design_share (
+    id uuid PRIMARY KEY,
+    design_id uuid NOT NULL REFERENCES design(id),
+    email VARCHAR(256) NOT NULL,
+    user_id uuid DEFAULT NULL REFERENCES users(id),
+    permission share_permission NOT NULL,
+    invited_by uuid NOT NULL REFERENCES users(id),
+    created_at timestamp without time zone default (now() at time zone 'utc'),
+    accepted_at timestamp without time zone default NULL,
+    revoked_at timestamp without time zone default NULL
+);
+
+CREATE UNIQUE INDEX design_share_email_idx ON design_share(design_id, LOWER(email)) WHERE revoked_at IS NULL;
+CREATE UNIQUE INDEX design_share_user_id_idx ON design_share(design_id, user_id) WHERE revoked_at IS NULL;
+CREATE INDEX design_share_user_idx ON design_share(user_id) WHERE revoked_at IS NULL;
@@ -0,0 +1,26 @@
+-- append-only log of security and design events
+CREATE TABLE IF NOT EXISTS audit_event (
+    id uuid PRIMARY KEY,
+    actor VARCHAR(256) NOT NULL,
+    action VARCHAR(64) NOT NULL,
+    target_type VARCHAR(64) NOT NULL DEFAULT '',
+    target_id VARCHAR(256) NOT NULL DEFAULT '',
+    ip VARCHAR(64) NOT NULL DEFAULT '',
+    user_agent VARCHAR(512) NOT NULL DEFAULT '',
+    request_id VARCHAR(128) NOT NULL DEFAULT '',
+    metadata json DEFAULT NULL,
+    created_at timestamp without time zone NOT NULL
+);
+
+CREATE INDEX audit_event_created_at_idx ON audit_event(created_at);
+CREATE INDEX audit_event_actor_idx ON audit_event(actor, created_at);
+CREATE INDEX audit_event_action_idx ON audit_event(action, created_at);
+
+CREATE FUNCTION audit_event_append_only() RETURNS trigger AS $$
+BEGIN
+    RAISE EXCEPTION 'audit_event is append-only';
+END;
+$$ LANGUAGE plpgsql;
+
+CREATE TRIGGER audit_event_append_only BEFORE UPDATE OR DELETE ON audit_event
+    FOR EACH ROW EXECUTE PROCEDURE audit_event_append_only();
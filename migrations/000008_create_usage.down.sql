@@ -0,0 +1,3 @@
+DROP table usage_period;
+DROP table usage_event;
+DROP table user_plan;
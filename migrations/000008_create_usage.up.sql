@@ -0,0 +1,29 @@
+-- plan of a user, users without a row are on the free plan
+CREATE TABLE IF NOT EXISTS user_plan (
+    user_id uuid PRIMARY KEY REFERENCES users(id),
+    plan VARCHAR(32) NOT NULL,
+    updated_at timestamp without time zone default (now() at time zone 'utc')
+);
+
+-- every generated document
+CREATE TABLE IF NOT EXISTS usage_event (
+    id uuid PRIMARY KEY,
+    user_id uuid NOT NULL REFERENCES users(id),
+    design_id uuid DEFAULT NULL,
+    pages BIGINT NOT NULL,
+    bytes BIGINT NOT NULL,
+    render_ms BIGINT NOT NULL,
+    created_at timestamp without time zone NOT NULL
+);
+
+CREATE INDEX usage_event_user_id_idx ON usage_event(user_id, created_at);
+
+-- totals per user and calendar month, documents are counted when reserved
+CREATE TABLE IF NOT EXISTS usage_period (
+    user_id uuid NOT NULL REFERENCES users(id),
+    period_start timestamp without time zone NOT NULL,
+    documents BIGINT NOT NULL DEFAULT 0,
+    pages BIGINT NOT NULL DEFAULT 0,
+    bytes BIGINT NOT NULL DEFAULT 0,
+    PRIMARY KEY (user_id, period_start)
+);
@@ -0,0 +1 @@
+DROP table rate_limit;
@@ -0,0 +1,6 @@
+-- token buckets keyed by route group and user id or client ip
+CREATE TABLE IF NOT EXISTS rate_limit (
+    key VARCHAR(320) PRIMARY KEY,
+    tokens DOUBLE PRECISION NOT NULL,
+    updated_at timestamp without time zone default NULL
+);
@@ -0,0 +1 @@
+DROP table idempotency_key;
@@ -0,0 +1,12 @@
+-- first responses of requests with an Idempotency-Key, keyed by user id and key
+CREATE TABLE IF NOT EXISTS idempotency_key (
+    key VARCHAR(320) PRIMARY KEY,
+    request_hash VARCHAR(64) NOT NULL,
+    status INTEGER DEFAULT NULL,
+    header JSONB DEFAULT NULL,
+    body BYTEA DEFAULT NULL,
+    created_at timestamp without time zone NOT NULL,
+    locked_at timestamp without time zone NOT NULL
+);
+
+CREATE INDEX IF NOT EXISTS idempotency_key_created_at_idx ON idempotency_key(created_at);
@@ -0,0 +1 @@
+ALTER TABLE design DROP COLUMN render_options;
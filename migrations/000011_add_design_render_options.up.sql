@@ -0,0 +1,2 @@
+-- page setup and engine of a design, NULL renders with the defaults
+ALTER TABLE design ADD COLUMN render_options JSONB DEFAULT NULL;
@@ -0,0 +1 @@
+DROP table design_thumbnail;
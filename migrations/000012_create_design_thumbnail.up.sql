@@ -0,0 +1,7 @@
+-- preview of the first page of a design, replaced on every save
+CREATE TABLE IF NOT EXISTS design_thumbnail (
+    design_id uuid PRIMARY KEY REFERENCES design(id) ON DELETE CASCADE,
+    content_type VARCHAR(64) NOT NULL,
+    image BYTEA NOT NULL,
+    requested_at timestamp without time zone NOT NULL
+);
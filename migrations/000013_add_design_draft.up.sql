@@ -0,0 +1,2 @@
+-- documents of draft designs are generated with a DRAFT watermark
+ALTER TABLE design ADD COLUMN draft BOOLEAN NOT NULL DEFAULT false;
@@ -0,0 +1 @@
+DROP table signing_certificate;
@@ -0,0 +1,15 @@
+-- pkcs12 certificates for signing pdfs, the key and chain are sealed with a server secret
+CREATE TABLE IF NOT EXISTS signing_certificate (
+    id uuid PRIMARY KEY,
+    user_id uuid NOT NULL REFERENCES users(id),
+    name VARCHAR(256) NOT NULL,
+    subject VARCHAR(1024) NOT NULL,
+    issuer VARCHAR(1024) NOT NULL,
+    serial_number VARCHAR(64) NOT NULL,
+    not_before timestamp without time zone NOT NULL,
+    not_after timestamp without time zone NOT NULL,
+    sealed BYTEA NOT NULL,
+    created_at timestamp without time zone default (now() at time zone 'utc')
+);
+
+CREATE INDEX IF NOT EXISTS signing_certificate_user_id_idx ON signing_certificate(user_id);
@@ -0,0 +1,2 @@
+-- factur-x mapping of the fields of a design, NULL generates plain pdfs
+ALTER TABLE design ADD COLUMN invoice_mapping JSONB DEFAULT NULL;
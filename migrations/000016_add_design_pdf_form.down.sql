@@ -0,0 +1,2 @@
+ALTER TABLE design DROP COLUMN form_pdf;
+ALTER TABLE design DROP COLUMN type;
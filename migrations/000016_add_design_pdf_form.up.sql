@@ -0,0 +1,3 @@
+-- pdf-form designs fill the fields of an uploaded pdf instead of rendering a template
+ALTER TABLE design ADD COLUMN type TEXT NOT NULL DEFAULT 'html';
+ALTER TABLE design ADD COLUMN form_pdf BYTEA DEFAULT NULL;
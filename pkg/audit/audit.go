@@ -0,0 +1,144 @@
+package audit
+
+import (
+	"context"
+	"database/sql/driver"
+	"encoding/json"
+	"errors"
+	"github.com/go-chi/chi/v5/middleware"
+	"github.com/google/uuid"
+	"github.com/rengas/pdfgen/pkg/contexts"
+	"github.com/rengas/pdfgen/pkg/httputils"
+	"github.com/rengas/pdfgen/pkg/logging"
+	"net/http"
+	"time"
+)
+
+const (
+	ActionRegistered         = "user.registered"
+	ActionUserUpdated        = "user.updated"
+	ActionLoginSucceeded     = "login.succeeded"
+	ActionLoginFailed        = "login.failed"
+	ActionLoginLocked        = "login.locked"
+	ActionLoginUnlocked      = "login.unlocked"
+	ActionDesignCreated      = "design.created"
+	ActionDesignUpdated      = "design.updated"
+	ActionDesignDeleted      = "design.deleted"
+	ActionGenerated          = "document.generated"
+	ActionCertificateAdded   = "certificate.added"
+	ActionCertificateDeleted = "certificate.deleted"
+	ActionMFAEnabled         = "mfa.enabled"
+	ActionMFADisabled        = "mfa.disabled"
+	ActionRecoveryCodesReset = "mfa.recovery_codes_regenerated"
+	ActionShareCreated       = "share.created"
+	ActionShareRevoked       = "share.revoked"
+	ActionShareAccepted      = "share.accepted"
+	ActionMemberAdded        = "member.added"
+	ActionMemberRemoved      = "member.removed"
+	ActionMemberRoleChanged  = "member.role_changed"
+)
+
+const (
+	TargetUser         = "user"
+	TargetDesign       = "design"
+	TargetLockout      = "lockout"
+	TargetCertificate  = "certificate"
+	TargetShare        = "share"
+	TargetOrganization = "organization"
+)
+
+// Event is a single entry of the audit log. Actor is the id of the user that
+// acted, or the attempted account when no user is known such as for a failed
+// login.
+type Event struct {
+	Id         string    `json:"id"`
+	Actor      string    `json:"actor"`
+	Action     string    `json:"action"`
+	TargetType string    `json:"targetType,omitempty"`
+	TargetId   string    `json:"targetId,omitempty"`
+	IP         string    `json:"ip,omitempty"`
+	UserAgent  string    `json:"userAgent,omitempty"`
+	RequestId  string    `json:"requestId,omitempty"`
+	Metadata   Metadata  `json:"metadata,omitempty"`
+	CreatedAt  time.Time `json:"createdAt"`
+}
+
+type Metadata map[string]interface{}
+
+func (m Metadata) Value() (driver.Value, error) {
+	if m == nil {
+		return nil, nil
+	}
+	return json.Marshal(m)
+}
+
+func (m *Metadata) Scan(value interface{}) error {
+	if value == nil {
+		return nil
+	}
+	b, ok := value.([]byte)
+	if !ok {
+		return errors.New("type assertion to []byte failed")
+	}
+	return json.Unmarshal(b, m)
+}
+
+type Store interface {
+	Save(ctx context.Context, e Event) error
+}
+
+// Recorder writes audit events. Recording never fails the request that
+// triggered it, errors are logged instead.
+type Recorder struct {
+	store Store
+	clock func() time.Time
+}
+
+func NewRecorder(store Store, clock func() time.Time) *Recorder {
+	return &Recorder{
+		store: store,
+		clock: clock,
+	}
+}
+
+// Record saves e, filling in the id, time, the request details captured by
+// Middleware and, when no actor is given, the authenticated user.
+func (r *Recorder) Record(ctx context.Context, e Event) {
+	e.Id = uuid.NewString()
+	e.CreatedAt = r.clock()
+	if e.Actor == "" {
+		e.Actor, _ = contexts.UserIdFromContext(ctx)
+	}
+	if rd, ok := ctx.Value(requestKey{}).(request); ok {
+		e.IP, e.UserAgent, e.RequestId = rd.ip, rd.userAgent, rd.requestId
+	}
+
+	err := r.store.Save(ctx, e)
+	if err != nil {
+		logging.WithContext(ctx).
+			WithError(err).
+			WithField(logging.Field{Label: "action", Value: e.Action}).
+			Error("unable to record audit event")
+	}
+}
+
+type requestKey struct{}
+
+type request struct {
+	ip        string
+	userAgent string
+	requestId string
+}
+
+// Middleware captures the client ip, user agent and request id for events
+// recorded while handling the request. It must run after RequestID and RealIP.
+func Middleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		ctx := context.WithValue(r.Context(), requestKey{}, request{
+			ip:        httputils.ClientIP(r),
+			userAgent: r.UserAgent(),
+			requestId: middleware.GetReqID(r.Context()),
+		})
+		next.ServeHTTP(w, r.WithContext(ctx))
+	})
+}
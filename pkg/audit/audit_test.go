@@ -0,0 +1,85 @@
+package audit
+
+import (
+	"context"
+	"github.com/go-chi/chi/v5/middleware"
+	"github.com/rengas/pdfgen/pkg/contexts"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"testing"
+	"time"
+)
+
+type memoryStore []Event
+
+func (m *memoryStore) Save(ctx context.Context, e Event) error {
+	*m = append(*m, e)
+	return nil
+}
+
+func TestRecordCapturesRequest(t *testing.T) {
+	now := time.Date(2022, 10, 1, 12, 0, 0, 0, time.UTC)
+	store := &memoryStore{}
+	rec := NewRecorder(store, func() time.Time { return now })
+
+	h := middleware.RequestID(Middleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		ctx := contexts.WithUserId(r.Context(), "99d15987-e06f-492c-a520-e54185e5b80b")
+		rec.Record(ctx, Event{Action: ActionDesignDeleted, TargetType: TargetDesign, TargetId: "d1"})
+		rec.Record(ctx, Event{Actor: "John@email.com", Action: ActionLoginFailed})
+	})))
+
+	req := httptest.NewRequest(http.MethodDelete, "/design/d1", nil)
+	req.RemoteAddr = "203.0.113.7:51234"
+	req.Header.Set("User-Agent", "curl/7.84.0")
+	h.ServeHTTP(httptest.NewRecorder(), req)
+
+	if len(*store) != 2 {
+		t.Fatalf("expected: 2 events, got: %d", len(*store))
+	}
+	e := (*store)[0]
+	if e.Id == "" || e.RequestId == "" {
+		t.Fatalf("expected id and request id to be set: %+v", e)
+	}
+	want := Event{
+		Id:         e.Id,
+		Actor:      "99d15987-e06f-492c-a520-e54185e5b80b",
+		Action:     ActionDesignDeleted,
+		TargetType: TargetDesign,
+		TargetId:   "d1",
+		IP:         "203.0.113.7",
+		UserAgent:  "curl/7.84.0",
+		RequestId:  e.RequestId,
+		CreatedAt:  now,
+	}
+	if !reflect.DeepEqual(want, e) {
+		t.Fatalf("expected: %+v, got: %+v", want, e)
+	}
+	if (*store)[1].Actor != "John@email.com" {
+		t.Fatalf("explicit actor should be kept, got: %s", (*store)[1].Actor)
+	}
+}
+
+func TestListQueryWhere(t *testing.T) {
+	from := time.Date(2022, 10, 1, 0, 0, 0, 0, time.UTC)
+
+	tests := []struct {
+		name      string
+		lq        ListQuery
+		wantWhere string
+		wantArgs  []interface{}
+	}{
+		{name: "no filter"},
+		{name: "actor and action", lq: ListQuery{Actor: "u1", Action: ActionLoginFailed},
+			wantWhere: "WHERE actor = $1 AND action = $2", wantArgs: []interface{}{"u1", ActionLoginFailed}},
+		{name: "time range", lq: ListQuery{From: from, To: from.Add(time.Hour)},
+			wantWhere: "WHERE created_at >= $1 AND created_at < $2", wantArgs: []interface{}{from, from.Add(time.Hour)}},
+	}
+
+	for _, tc := range tests {
+		where, args := tc.lq.where()
+		if where != tc.wantWhere || !reflect.DeepEqual(args, tc.wantArgs) {
+			t.Fatalf("%s: expected: %q %v, got: %q %v", tc.name, tc.wantWhere, tc.wantArgs, where, args)
+		}
+	}
+}
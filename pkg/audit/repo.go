@@ -0,0 +1,103 @@
+package audit
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"github.com/rengas/pdfgen/pkg/pagination"
+	"strings"
+	"time"
+)
+
+type Repository struct {
+	db *sql.DB
+}
+
+func NewRepository(db *sql.DB) *Repository {
+	return &Repository{
+		db: db,
+	}
+}
+
+// Save appends an event, the table rejects updates and deletes.
+func (r *Repository) Save(ctx context.Context, e Event) error {
+	q := `INSERT INTO audit_event(id, actor, action, target_type, target_id, ip, user_agent, request_id, metadata, created_at)
+		  values($1, $2, $3, $4, $5, $6, $7, $8, $9, $10)`
+	_, err := r.db.ExecContext(ctx, q, e.Id, e.Actor, e.Action, e.TargetType, e.TargetId, e.IP, e.UserAgent, e.RequestId, e.Metadata, e.CreatedAt)
+	return err
+}
+
+type ListQuery struct {
+	Actor  string
+	Action string
+	From   time.Time
+	To     time.Time
+	Limit  int64
+	Page   int64
+}
+
+// where builds the filter of the query, zero values do not filter.
+func (lq ListQuery) where() (string, []interface{}) {
+	var conds []string
+	var args []interface{}
+	add := func(cond string, arg interface{}) {
+		args = append(args, arg)
+		conds = append(conds, fmt.Sprintf(cond, len(args)))
+	}
+	if lq.Actor != "" {
+		add("actor = $%d", lq.Actor)
+	}
+	if lq.Action != "" {
+		add("action = $%d", lq.Action)
+	}
+	if !lq.From.IsZero() {
+		add("created_at >= $%d", lq.From)
+	}
+	if !lq.To.IsZero() {
+		add("created_at < $%d", lq.To)
+	}
+	if len(conds) == 0 {
+		return "", nil
+	}
+	return "WHERE " + strings.Join(conds, " AND "), args
+}
+
+// List returns matching events, newest first.
+func (r *Repository) List(ctx context.Context, lq ListQuery) ([]Event, pagination.Pagination, error) {
+	where, args := lq.where()
+	q := fmt.Sprintf(`SELECT id, actor, action, target_type, target_id, ip, user_agent, request_id, metadata, created_at
+		  FROM audit_event %s
+		  ORDER BY created_at DESC, id
+		  Limit $%d Offset $%d`, where, len(args)+1, len(args)+2)
+
+	offset := lq.Limit * (lq.Page - 1)
+	rows, err := r.db.QueryContext(ctx, q, append(args, lq.Limit, offset)...)
+	if err != nil {
+		return nil, pagination.Pagination{}, err
+	}
+	defer rows.Close()
+
+	es := []Event{}
+	for rows.Next() {
+		var e Event
+		err = rows.Scan(&e.Id, &e.Actor, &e.Action, &e.TargetType, &e.TargetId, &e.IP, &e.UserAgent, &e.RequestId, &e.Metadata, &e.CreatedAt)
+		if err != nil {
+			return nil, pagination.Pagination{}, err
+		}
+		es = append(es, e)
+	}
+	if err = rows.Err(); err != nil {
+		return nil, pagination.Pagination{}, err
+	}
+
+	var count int64
+	err = r.db.QueryRowContext(ctx, `SELECT count(id) FROM audit_event `+where, args...).Scan(&count)
+	if err != nil {
+		return nil, pagination.Pagination{}, err
+	}
+
+	return es, pagination.Pagination{
+		Page:  lq.Page,
+		Total: count,
+	}, nil
+}
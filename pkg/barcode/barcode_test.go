@@ -0,0 +1,135 @@
+package barcode
+
+import (
+	"bytes"
+	"errors"
+	"html/template"
+	"strings"
+	"testing"
+)
+
+func TestEANCheckDigit(t *testing.T) {
+	tests := []struct {
+		digits string
+		want   byte
+	}{
+		{digits: "400638133393", want: '1'},
+		{digits: "590123412345", want: '7'},
+		{digits: "9638507", want: '4'},
+		{digits: "000000000000", want: '0'},
+	}
+
+	for _, tc := range tests {
+		if got := EANCheckDigit(tc.digits); got != tc.want {
+			t.Fatalf("%s: expected: %c, got: %c", tc.digits, tc.want, got)
+		}
+	}
+}
+
+func TestEncode(t *testing.T) {
+	tests := []struct {
+		name       string
+		encode     func() (*Code, error)
+		wantWidth  int
+		wantHeight int
+		wantErr    error
+	}{
+		{name: "ean13", encode: func() (*Code, error) { return EAN13("400638133393") }, wantWidth: 117, wantHeight: 1},
+		{name: "ean13 with check digit", encode: func() (*Code, error) { return EAN13("4006381333931") }, wantWidth: 117, wantHeight: 1},
+		{name: "ean13 wrong check digit", encode: func() (*Code, error) { return EAN13("4006381333932") }, wantErr: ErrChecksum},
+		{name: "ean13 letters", encode: func() (*Code, error) { return EAN13("40063813339a") }, wantErr: ErrEAN13Data},
+		{name: "ean13 short", encode: func() (*Code, error) { return EAN13("4006381") }, wantErr: ErrEAN13Data},
+		// start, 3 pairs of digits, checksum and stop
+		{name: "code128 digits", encode: func() (*Code, error) { return Code128("123456") }, wantWidth: 5*11 + 13 + 20, wantHeight: 1},
+		{name: "code128 text", encode: func() (*Code, error) { return Code128("Hi") }, wantWidth: 4*11 + 13 + 20, wantHeight: 1},
+		{name: "code128 not ascii", encode: func() (*Code, error) { return Code128("Grüße") }, wantErr: ErrCode128Data},
+		{name: "code128 empty", encode: func() (*Code, error) { return Code128("") }, wantErr: ErrEmpty},
+		{name: "datamatrix 10x10", encode: func() (*Code, error) { return DataMatrix("123456") }, wantWidth: 12, wantHeight: 12},
+		{name: "datamatrix 12x12", encode: func() (*Code, error) { return DataMatrix("Hello") }, wantWidth: 14, wantHeight: 14},
+		{name: "datamatrix 144x144", encode: func() (*Code, error) { return DataMatrix(strings.Repeat("a", 1558)) }, wantWidth: 146, wantHeight: 146},
+		{name: "datamatrix too long", encode: func() (*Code, error) { return DataMatrix(strings.Repeat("a", 1559)) }, wantErr: ErrDataTooLong},
+		// 8 rows of a column, with start, stop and row indicators
+		{name: "pdf417", encode: func() (*Code, error) { return PDF417("PDF417", 0) }, wantWidth: 17*5 + 1 + 4, wantHeight: 8*3 + 4},
+		{name: "pdf417 too long", encode: func() (*Code, error) { return PDF417(strings.Repeat("\x00", 1200), 8) }, wantErr: ErrDataTooLong},
+	}
+
+	for _, tc := range tests {
+		c, err := tc.encode()
+		if !errors.Is(err, tc.wantErr) {
+			t.Fatalf("%s: expected: %v, got: %v", tc.name, tc.wantErr, err)
+		}
+		if err != nil {
+			continue
+		}
+		if c.Width() != tc.wantWidth || c.Height() != tc.wantHeight {
+			t.Fatalf("%s: expected: %dx%d, got: %dx%d", tc.name, tc.wantWidth, tc.wantHeight, c.Width(), c.Height())
+		}
+	}
+}
+
+func TestPDF417ErrorCorrection(t *testing.T) {
+	data := []int{5, 453, 178, 121, 239, 900, 12, 928, 0}
+	for level := 0; level <= 8; level++ {
+		n := 2 << level
+		codewords := append(append([]int{}, data...), pdf417ErrorCorrection(data, n)...)
+		// the codewords are a polynomial with the roots 3, 3^2 ... 3^n
+		root := 1
+		for i := 0; i < n; i++ {
+			root = root * 3 % 929
+			v := 0
+			for _, cw := range codewords {
+				v = (v*root + cw) % 929
+			}
+			if v != 0 {
+				t.Fatalf("level %d: expected: root 3^%d, got: %d", level, i+1, v)
+			}
+		}
+	}
+}
+
+func TestFuncs(t *testing.T) {
+	tests := []struct {
+		name     string
+		template string
+		want     string
+		wantErr  error
+	}{
+		{name: "qrcode", template: `{{qrcode .url}}`, want: `<svg xmlns="http://www.w3.org/2000/svg" width="30mm" height="30mm"`},
+		{name: "qrcode level", template: `{{qrcode .url "size=12mm" "level=h"}}`, want: `width="12mm" height="12mm"`},
+		{name: "qrcode png", template: `{{qrcode .url "format=png"}}`, want: `<img src="data:image/png;base64,`},
+		{name: "code128 height", template: `{{code128 .parcel "height=10"}}`, want: `height="10mm"`},
+		{name: "ean13 number", template: `{{ean13 .gtin}}`, want: `aria-label="4006381333931"`},
+		{name: "datamatrix", template: `{{datamatrix .parcel "size=8"}}`, want: `width="8mm" height="8mm"`},
+		{name: "pdf417 width", template: `{{pdf417 .url "width=80" "level=5"}}`, want: `width="80mm"`},
+		{name: "label escaped", template: `{{code128 .tag}}`, want: `aria-label="a&lt;b&gt;"`},
+		{name: "ean13 check digit", template: `{{ean13 "4006381333932"}}`, wantErr: ErrChecksum},
+		{name: "qrcode unknown level", template: `{{qrcode .url "level=X"}}`, wantErr: ErrLevel},
+		{name: "code128 level", template: `{{code128 .parcel "level=H"}}`, wantErr: ErrLevel},
+		{name: "pdf417 level", template: `{{pdf417 .url "level=9"}}`, wantErr: ErrLevel},
+		{name: "invalid size", template: `{{datamatrix .parcel "size=big"}}`, wantErr: ErrOption},
+		{name: "unknown option", template: `{{datamatrix .parcel "color=red"}}`, wantErr: ErrOption},
+		{name: "empty data", template: `{{qrcode .missing}}`, wantErr: ErrEmpty},
+	}
+	fields := map[string]interface{}{
+		"url":    "https://example.com/invoices/42",
+		"parcel": "RI476394652CH",
+		"gtin":   4006381333931.0,
+		"tag":    "a<b>",
+	}
+
+	for _, tc := range tests {
+		tl := template.Must(template.New(tc.name).Funcs(Funcs()).Parse(tc.template))
+		var buf bytes.Buffer
+		err := tl.Execute(&buf, fields)
+		var code *Error
+		if tc.wantErr != nil && !errors.As(err, &code) {
+			t.Fatalf("%s: expected: barcode error, got: %v", tc.name, err)
+		}
+		if !errors.Is(err, tc.wantErr) {
+			t.Fatalf("%s: expected: %v, got: %v", tc.name, tc.wantErr, err)
+		}
+		if !strings.Contains(buf.String(), tc.want) {
+			t.Fatalf("%s: expected: %s, got: %s", tc.name, tc.want, buf.String())
+		}
+	}
+}
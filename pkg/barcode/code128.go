@@ -0,0 +1,121 @@
+package barcode
+
+import (
+	"errors"
+	"strings"
+)
+
+var ErrCode128Data = errors.New("code128 encodes ascii only")
+
+// code128Patterns are the bar and space widths of the symbols by value, the
+// last is the stop pattern. Values are from ISO/IEC 15417.
+var code128Patterns = [...]string{
+	"212222", "222122", "222221", "121223", "121322", "131222", "122213", "122312", "132212", "221213",
+	"221312", "231212", "112232", "122132", "122231", "113222", "123122", "123221", "223211", "221132",
+	"221231", "213212", "223112", "312131", "311222", "321122", "321221", "312212", "322112", "322211",
+	"212123", "212321", "232121", "111323", "131123", "131321", "112313", "132113", "132311", "211313",
+	"231113", "231311", "112133", "112331", "132131", "113123", "113321", "133121", "313121", "211331",
+	"231131", "213113", "213311", "213131", "311123", "311321", "331121", "312113", "312311", "332111",
+	"314111", "221411", "431111", "111224", "111422", "121124", "121421", "141122", "141221", "112214",
+	"112412", "122114", "122411", "142112", "142211", "241211", "221114", "413111", "241112", "134111",
+	"111242", "121142", "121241", "114212", "124112", "124211", "411212", "421112", "421211", "212141",
+	"214121", "412121", "111143", "111341", "131141", "114113", "114311", "411113", "411311", "113141",
+	"114131", "311141", "411131", "211412", "211214", "211232", "2331112",
+}
+
+// Values that switch to the code sets, codes start with 103, 104 or 105 to
+// start in set A, B or C instead.
+const (
+	code128A    = 101
+	code128B    = 100
+	code128C    = 99
+	code128Stop = 106
+)
+
+// Code128 encodes ascii data as Code 128, runs of digits are packed in pairs
+// by code set C.
+func Code128(data string) (*Code, error) {
+	if data == "" {
+		return nil, ErrEmpty
+	}
+	for i := 0; i < len(data); i++ {
+		if data[i] > 127 {
+			return nil, ErrCode128Data
+		}
+	}
+
+	var values []int
+	set := 0
+	switchTo := func(s int) {
+		switch {
+		case set == 0 && s == code128A:
+			values = append(values, 103)
+		case set == 0 && s == code128B:
+			values = append(values, 104)
+		case set == 0:
+			values = append(values, 105)
+		default:
+			values = append(values, s)
+		}
+		set = s
+	}
+	for i := 0; i < len(data); {
+		n := digits(data[i:])
+		// set C pays off for 4 digits at the ends and 6 in between
+		if set != code128C && (n >= 6 || n >= 4 && (i == 0 || i+n == len(data)) || n == len(data) && n%2 == 0) {
+			if n%2 == 1 {
+				if set == 0 {
+					switchTo(code128B)
+				}
+				values = append(values, int(data[i])-32)
+				i, n = i+1, n-1
+			}
+			switchTo(code128C)
+			for ; n >= 2; i, n = i+2, n-2 {
+				values = append(values, int(data[i]-'0')*10+int(data[i+1]-'0'))
+			}
+			continue
+		}
+
+		c := data[i]
+		switch {
+		case c < 32 && set != code128A:
+			switchTo(code128A)
+		case c >= 96 && set != code128B, set == 0, set == code128C:
+			switchTo(code128B)
+		}
+		if set == code128A && c < 32 {
+			values = append(values, int(c)+64)
+		} else {
+			values = append(values, int(c)-32)
+		}
+		i++
+	}
+
+	sum := values[0]
+	for i, v := range values {
+		sum += i * v
+	}
+	values = append(values, sum%103, code128Stop)
+
+	var modules strings.Builder
+	for _, v := range values {
+		for i, w := range code128Patterns[v] {
+			bit := "1"
+			if i%2 == 1 {
+				bit = "0"
+			}
+			modules.WriteString(strings.Repeat(bit, int(w-'0')))
+		}
+	}
+	return linear(modules.String(), 10), nil
+}
+
+// digits returns the number of digits s starts with.
+func digits(s string) int {
+	n := 0
+	for n < len(s) && s[n] >= '0' && s[n] <= '9' {
+		n++
+	}
+	return n
+}
@@ -0,0 +1,255 @@
+package barcode
+
+// dmSymbol is a square Data Matrix ECC 200 symbol, its data regions are
+// region modules wide and each has a finder border of one module.
+type dmSymbol struct {
+	size   int
+	region int
+	data   int
+	ecc    int
+	blocks int
+}
+
+// dmSymbols are the square symbols by size, values are from ISO/IEC 16022
+// table 7.
+var dmSymbols = []dmSymbol{
+	{10, 8, 3, 5, 1}, {12, 10, 5, 7, 1}, {14, 12, 8, 10, 1}, {16, 14, 12, 12, 1},
+	{18, 16, 18, 14, 1}, {20, 18, 22, 18, 1}, {22, 20, 30, 20, 1}, {24, 22, 36, 24, 1},
+	{26, 24, 44, 28, 1}, {32, 14, 62, 36, 1}, {36, 16, 86, 42, 1}, {40, 18, 114, 48, 1},
+	{44, 20, 144, 56, 1}, {48, 22, 174, 68, 1}, {52, 24, 204, 84, 2}, {64, 14, 280, 112, 2},
+	{72, 16, 368, 144, 4}, {80, 18, 456, 192, 4}, {88, 20, 576, 224, 4}, {96, 22, 696, 272, 4},
+	{104, 24, 816, 336, 6}, {120, 18, 1050, 408, 6}, {132, 20, 1304, 496, 8}, {144, 22, 1558, 620, 10},
+}
+
+// DataMatrix encodes data as the smallest square Data Matrix ECC 200 symbol
+// it fits in, pairs of digits take one codeword and other bytes one or two.
+func DataMatrix(data string) (*Code, error) {
+	if data == "" {
+		return nil, ErrEmpty
+	}
+	codewords := dmASCII([]byte(data))
+	var sym dmSymbol
+	for _, s := range dmSymbols {
+		if len(codewords) <= s.data {
+			sym = s
+			break
+		}
+	}
+	if sym.size == 0 {
+		return nil, ErrDataTooLong
+	}
+
+	// pads after the first are scrambled so they do not repeat
+	for i := len(codewords); i < sym.data; i++ {
+		if i == len(codewords) {
+			codewords = append(codewords, 129)
+			continue
+		}
+		v := 129 + (149*(i+1))%253 + 1
+		if v > 254 {
+			v -= 254
+		}
+		codewords = append(codewords, byte(v))
+	}
+	codewords = dmErrorCorrection(codewords, sym)
+
+	n := sym.size / (sym.region + 2) * sym.region
+	placement := dmPlacement(n, n)
+	c := newCode(sym.size+2, sym.size+2)
+	// position of a module of the mapping matrix in the symbol, after the
+	// quiet zone and the finder borders of the regions before it
+	at := func(i int) int {
+		return 1 + i/sym.region*(sym.region+2) + 1 + i%sym.region
+	}
+	for row := 0; row < n; row++ {
+		for col := 0; col < n; col++ {
+			p := placement[row*n+col]
+			if p < 0 || p > 0 && codewords[(p-1)/8]&(0x80>>((p-1)%8)) != 0 {
+				c.set(at(col), at(row))
+			}
+		}
+	}
+	for y := 0; y < sym.size; y++ {
+		for x := 0; x < sym.size; x++ {
+			rx, ry := x%(sym.region+2), y%(sym.region+2)
+			switch {
+			case rx == 0, ry == sym.region+1:
+				c.set(1+x, 1+y)
+			case ry == 0 && rx%2 == 0, rx == sym.region+1 && ry%2 == 1:
+				c.set(1+x, 1+y)
+			}
+		}
+	}
+	return c, nil
+}
+
+// dmASCII encodes data in ASCII encodation.
+func dmASCII(data []byte) []byte {
+	var out []byte
+	for i := 0; i < len(data); i++ {
+		c := data[i]
+		switch {
+		case digits(string(data[i:min(i+2, len(data))])) == 2:
+			out = append(out, 130+(c-'0')*10+data[i+1]-'0')
+			i++
+		case c < 128:
+			out = append(out, c+1)
+		default:
+			// upper shift
+			out = append(out, 235, c-127)
+		}
+	}
+	return out
+}
+
+// dmErrorCorrection appends the error correction codewords of the blocks of
+// the symbol, codewords are interleaved over the blocks.
+func dmErrorCorrection(data []byte, sym dmSymbol) []byte {
+	n := sym.ecc / sym.blocks
+	gen := dmGenerator(n)
+	out := make([]byte, sym.data+sym.ecc)
+	copy(out, data)
+	for b := 0; b < sym.blocks; b++ {
+		ecc := make([]byte, n)
+		for i := b; i < sym.data; i += sym.blocks {
+			f := data[i] ^ ecc[0]
+			copy(ecc, ecc[1:])
+			ecc[n-1] = 0
+			for j := range ecc {
+				ecc[j] ^= dmMultiply(gen[j+1], f)
+			}
+		}
+		// the interleaving goes on from the data, the error correction of the
+		// 144 by 144 symbol starts with block 8
+		first := (b - sym.data%sym.blocks + sym.blocks) % sym.blocks
+		for j, e := range ecc {
+			out[sym.data+first+j*sym.blocks] = e
+		}
+	}
+	return out
+}
+
+// dmGenerator returns the coefficients of the generator polynomial of
+// degree n, highest first.
+func dmGenerator(n int) []byte {
+	gen := []byte{1}
+	alpha := byte(1)
+	for i := 0; i < n; i++ {
+		alpha = dmMultiply(alpha, 2)
+		next := make([]byte, len(gen)+1)
+		for j, g := range gen {
+			next[j] ^= g
+			next[j+1] ^= dmMultiply(g, alpha)
+		}
+		gen = next
+	}
+	return gen
+}
+
+// dmMultiply multiplies in GF(256) with the polynomial 0x12d of Data Matrix.
+func dmMultiply(x, y byte) byte {
+	var z int
+	for i := 7; i >= 0; i-- {
+		z = (z << 1) ^ ((z >> 7) * 0x12d)
+		z ^= int((y>>i)&1) * int(x)
+	}
+	return byte(z)
+}
+
+// dmPlacement returns which codeword bit each module of the nrow by ncol
+// mapping matrix shows as 8 * codeword + bit, bits are numbered from 1 for
+// the most significant. Filler modules are -1 for dark and 0 for light, the
+// algorithm is from ISO/IEC 16022 annex F.
+func dmPlacement(nrow, ncol int) []int {
+	p := make([]int, nrow*ncol)
+	set := make([]bool, nrow*ncol)
+	module := func(row, col, chr, bit int) {
+		if row < 0 {
+			row += nrow
+			col += 4 - (nrow+4)%8
+		}
+		if col < 0 {
+			col += ncol
+			row += 4 - (ncol+4)%8
+		}
+		p[row*ncol+col] = 8*chr + bit
+		set[row*ncol+col] = true
+	}
+	utah := func(row, col, chr int) {
+		module(row-2, col-2, chr, 1)
+		module(row-2, col-1, chr, 2)
+		module(row-1, col-2, chr, 3)
+		module(row-1, col-1, chr, 4)
+		module(row-1, col, chr, 5)
+		module(row, col-2, chr, 6)
+		module(row, col-1, chr, 7)
+		module(row, col, chr, 8)
+	}
+	corner := func(chr int, rows, cols [8]int) {
+		for i := range rows {
+			r, c := rows[i], cols[i]
+			if r < 0 {
+				r += nrow
+			}
+			if c < 0 {
+				c += ncol
+			}
+			module(r, c, chr, i+1)
+		}
+	}
+
+	chr, row, col := 0, 4, 0
+	for row < nrow || col < ncol {
+		switch {
+		case row == nrow && col == 0:
+			corner(chr, [8]int{-1, -1, -1, 0, 0, 1, 2, 3}, [8]int{0, 1, 2, -2, -1, -1, -1, -1})
+			chr++
+		case row == nrow-2 && col == 0 && ncol%4 != 0:
+			corner(chr, [8]int{-3, -2, -1, 0, 0, 0, 0, 1}, [8]int{0, 0, 0, -4, -3, -2, -1, -1})
+			chr++
+		case row == nrow-2 && col == 0 && ncol%8 == 4:
+			corner(chr, [8]int{-3, -2, -1, 0, 0, 1, 2, 3}, [8]int{0, 0, 0, -2, -1, -1, -1, -1})
+			chr++
+		case row == nrow+4 && col == 2 && ncol%8 == 0:
+			corner(chr, [8]int{-1, -1, 0, 0, 0, 1, 1, 1}, [8]int{0, -1, -3, -2, -1, -3, -2, -1})
+			chr++
+		}
+		// sweep upward diagonally
+		for {
+			if row < nrow && col >= 0 && !set[row*ncol+col] {
+				utah(row, col, chr)
+				chr++
+			}
+			row, col = row-2, col+2
+			if row < 0 || col >= ncol {
+				break
+			}
+		}
+		row, col = row+1, col+3
+		// and downward
+		for {
+			if row >= 0 && col < ncol && !set[row*ncol+col] {
+				utah(row, col, chr)
+				chr++
+			}
+			row, col = row+2, col-2
+			if row >= nrow || col < 0 {
+				break
+			}
+		}
+		row, col = row+3, col+1
+	}
+	// the bottom right corner is filled when no codeword reaches it
+	if !set[nrow*ncol-1] {
+		p[nrow*ncol-1] = -1
+		p[(nrow-1)*ncol-2] = -1
+	}
+	return p
+}
+
+func min(a, b int) int {
+	if a < b {
+		return a
+	}
+	return b
+}
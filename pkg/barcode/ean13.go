@@ -0,0 +1,77 @@
+package barcode
+
+import (
+	"errors"
+	"strings"
+)
+
+var ErrEAN13Data = errors.New("ean13 needs 12 digits or 13 with the check digit")
+
+// eanL are the modules of the digits in the left half with odd parity, the
+// even parity G and the right half R patterns are derived from them.
+var eanL = [10]string{"0001101", "0011001", "0010011", "0111101", "0100011", "0110001", "0101111", "0111011", "0110111", "0001011"}
+
+// eanParity is the parity of the left digits by the first digit, which has
+// no bars of its own.
+var eanParity = [10]string{"LLLLLL", "LLGLGG", "LLGGLG", "LLGGGL", "LGLLGG", "LGGLLG", "LGGGLL", "LGLGLG", "LGLGGL", "LGGLGL"}
+
+// EAN13 encodes 12 digits and their check digit as EAN-13, a 13th digit must
+// be the check digit.
+func EAN13(data string) (*Code, error) {
+	if len(data) != 12 && len(data) != 13 || digits(data) != len(data) {
+		return nil, ErrEAN13Data
+	}
+	check := EANCheckDigit(data[:12])
+	if len(data) == 13 && data[12] != check {
+		return nil, ErrChecksum
+	}
+	data = data[:12] + string(check)
+
+	var modules strings.Builder
+	modules.WriteString("101")
+	for i := 1; i < 7; i++ {
+		l := eanL[data[i]-'0']
+		if eanParity[data[0]-'0'][i-1] == 'G' {
+			l = reverse(invert(l))
+		}
+		modules.WriteString(l)
+	}
+	modules.WriteString("01010")
+	for i := 7; i < 13; i++ {
+		modules.WriteString(invert(eanL[data[i]-'0']))
+	}
+	modules.WriteString("101")
+	return linear(modules.String(), 11), nil
+}
+
+// EANCheckDigit returns the check digit of the digits of an EAN or GTIN
+// without it.
+func EANCheckDigit(digits string) byte {
+	sum := 0
+	for i := len(digits) - 1; i >= 0; i-- {
+		d := int(digits[i] - '0')
+		// weights alternate 3 and 1 from the right
+		if (len(digits)-i)%2 == 1 {
+			d *= 3
+		}
+		sum += d
+	}
+	return byte('0' + (10-sum%10)%10)
+}
+
+func invert(modules string) string {
+	return strings.Map(func(r rune) rune {
+		if r == '1' {
+			return '0'
+		}
+		return '1'
+	}, modules)
+}
+
+func reverse(s string) string {
+	b := []byte(s)
+	for i, j := 0, len(b)-1; i < j; i, j = i+1, j-1 {
+		b[i], b[j] = b[j], b[i]
+	}
+	return string(b)
+}
@@ -0,0 +1,202 @@
+package barcode
+
+import (
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"github.com/rengas/pdfgen/pkg/qrcode"
+	"html"
+	"html/template"
+	"math"
+	"strconv"
+	"strings"
+)
+
+var (
+	ErrOption = errors.New("options are size, width and height in mm, format svg or png and level")
+	ErrLevel  = errors.New("level is L, M, Q or H for qrcode and 0 to 8 for pdf417")
+)
+
+// Error is a barcode a template function could not make.
+type Error struct {
+	Func string
+	Err  error
+}
+
+func (e *Error) Error() string {
+	return e.Func + ": " + e.Err.Error()
+}
+
+func (e *Error) Unwrap() error {
+	return e.Err
+}
+
+// module is the width of a module in mm of barcodes without width.
+const module = 0.33
+
+// Funcs returns the template functions of barcodes for designs:
+//
+//	{{qrcode .url "size=30" "level=H"}}
+//	{{code128 .parcel.id "height=15mm"}}
+//	{{ean13 .product.gtin "format=png"}}
+//	{{datamatrix .serial "size=12"}}
+//	{{pdf417 .ticket.payload "width=80" "level=5"}}
+//
+// They return an inline svg, or an img of a PNG data uri with format=png
+// which every engine can draw. Options set the size of square codes and the
+// width and height of others in millimetres, and the error correction level
+// of qrcode and pdf417.
+func Funcs() template.FuncMap {
+	return template.FuncMap{
+		"qrcode": func(data interface{}, opts ...string) (template.HTML, error) {
+			return draw("qrcode", data, opts, 30, 0, func(s string, o options) (*Code, error) {
+				level := qrcode.Medium
+				switch o.level {
+				case "L":
+					level = qrcode.Low
+				case "", "M":
+				case "Q":
+					level = qrcode.Quartile
+				case "H":
+					level = qrcode.High
+				default:
+					return nil, ErrLevel
+				}
+				return QRCode(s, level)
+			})
+		},
+		"code128": func(data interface{}, opts ...string) (template.HTML, error) {
+			return draw("code128", data, opts, 0, 15, noLevel(Code128))
+		},
+		"ean13": func(data interface{}, opts ...string) (template.HTML, error) {
+			return draw("ean13", data, opts, 0, 22.85, noLevel(EAN13))
+		},
+		"datamatrix": func(data interface{}, opts ...string) (template.HTML, error) {
+			return draw("datamatrix", data, opts, 20, 0, noLevel(DataMatrix))
+		},
+		"pdf417": func(data interface{}, opts ...string) (template.HTML, error) {
+			return draw("pdf417", data, opts, 0, 0, func(s string, o options) (*Code, error) {
+				level := -1
+				if o.level != "" {
+					l, err := strconv.Atoi(o.level)
+					if err != nil || l < 0 || l > 8 {
+						return nil, ErrLevel
+					}
+					level = l
+				}
+				return PDF417(s, level)
+			})
+		},
+	}
+}
+
+type options struct {
+	width, height float64
+	format        string
+	level         string
+}
+
+func noLevel(encode func(string) (*Code, error)) func(string, options) (*Code, error) {
+	return func(s string, o options) (*Code, error) {
+		if o.level != "" {
+			return nil, ErrLevel
+		}
+		return encode(s)
+	}
+}
+
+// draw encodes the data as barcode of the options. The width is the default
+// in mm, 0 for modules of 0.33 mm, and the height the default of linear
+// barcodes. Codes without height keep the aspect of their modules.
+func draw(name string, data interface{}, opts []string, width, height float64, encode func(string, options) (*Code, error)) (template.HTML, error) {
+	o, err := parseOptions(opts)
+	if err != nil {
+		return "", &Error{Func: name, Err: err}
+	}
+	s := text(data)
+	c, err := encode(s, o)
+	if err != nil {
+		return "", &Error{Func: name, Err: err}
+	}
+
+	aspect := float64(c.Height()) / float64(c.Width())
+	if o.width == 0 && o.height != 0 && height == 0 {
+		o.width = o.height / aspect
+	}
+	if o.width == 0 {
+		o.width = width
+	}
+	if o.width == 0 {
+		o.width = float64(c.Width()) * module
+	}
+	if o.height == 0 {
+		o.height = height
+	}
+	if o.height == 0 {
+		o.height = o.width * aspect
+	}
+
+	if o.format != "png" {
+		return template.HTML(c.SVG(o.width, o.height, s)), nil
+	}
+	// modules are drawn at 300 dpi at least, in images of at most about
+	// 4000 pixels
+	scale := int(math.Ceil(o.width / 25.4 * 300 / float64(c.Width())))
+	if limit := 4000 / c.Width(); scale > limit {
+		scale = limit
+	}
+	b, err := c.PNG(scale)
+	if err != nil {
+		return "", &Error{Func: name, Err: err}
+	}
+	return template.HTML(fmt.Sprintf(`<img src="data:image/png;base64,%s" alt="%s" style="width:%smm;height:%smm;image-rendering:pixelated">`,
+		base64.StdEncoding.EncodeToString(b), html.EscapeString(s), mm(o.width), mm(o.height))), nil
+}
+
+func parseOptions(opts []string) (options, error) {
+	var o options
+	for _, opt := range opts {
+		k, v, ok := strings.Cut(opt, "=")
+		if !ok {
+			return o, ErrOption
+		}
+		switch k {
+		case "size", "width", "height":
+			f, err := strconv.ParseFloat(strings.TrimSuffix(v, "mm"), 64)
+			if err != nil || f <= 0 || f > 1000 {
+				return o, ErrOption
+			}
+			if k != "height" {
+				o.width = f
+			}
+			if k != "width" {
+				o.height = f
+			}
+		case "format":
+			if v != "svg" && v != "png" {
+				return o, ErrOption
+			}
+			o.format = v
+		case "level":
+			o.level = strings.ToUpper(v)
+		default:
+			return o, ErrOption
+		}
+	}
+	return o, nil
+}
+
+// text returns the data of a field as text, numbers of json fields are
+// written without exponent so long article numbers keep their digits.
+func text(data interface{}) string {
+	switch v := data.(type) {
+	case string:
+		return v
+	case float64:
+		return strconv.FormatFloat(v, 'f', -1, 64)
+	case nil:
+		return ""
+	default:
+		return fmt.Sprint(v)
+	}
+}
@@ -0,0 +1,253 @@
+package barcode
+
+import "strings"
+
+const (
+	pdf417Start = 0x1fea8
+	pdf417Stop  = 0x3fa29
+	// pdf417Max is the number of codewords a symbol can have
+	pdf417Max = 928
+)
+
+// Codewords that switch the compaction mode, pad symbols or start byte
+// compaction of a multiple of 6 bytes.
+const (
+	pdf417Text    = 900
+	pdf417Byte    = 901
+	pdf417Byte6   = 924
+	pdf417Padding = 900
+)
+
+// Submodes of text compaction.
+const (
+	pdf417Alpha = iota
+	pdf417Lower
+	pdf417Mixed
+	pdf417Punct
+)
+
+// Characters of the mixed and punctuation submodes by value.
+const (
+	pdf417MixedChars = "0123456789&\r\t,:#-.$/+%*=^"
+	pdf417PunctChars = ";<>@[\\]_`~!\r\t,:\n-.$/\"|*()?{}'"
+)
+
+// PDF417 encodes data as PDF417 with the error correction level, 0 to 8, or
+// the level ISO/IEC 15438 recommends for the data when level is negative.
+// Printable ascii is compacted as text, other data as bytes.
+func PDF417(data string, level int) (*Code, error) {
+	if data == "" {
+		return nil, ErrEmpty
+	}
+	codewords, ok := pdf417TextCompaction(data)
+	if !ok {
+		codewords = pdf417ByteCompaction([]byte(data))
+	}
+	n := len(codewords) + 1
+	if level < 0 || level > 8 {
+		switch {
+		case n <= 40:
+			level = 2
+		case n <= 160:
+			level = 3
+		case n <= 320:
+			level = 4
+		default:
+			level = 5
+		}
+	}
+	ecc := 2 << level
+	if n+ecc > pdf417Max {
+		return nil, ErrDataTooLong
+	}
+
+	// columns make the symbol about twice as wide as high
+	cols, rows := 1, 0
+	for c := 1; c <= 30; c++ {
+		r := (n + ecc + c - 1) / c
+		if r < 3 {
+			r = 3
+		}
+		if r > 90 {
+			continue
+		}
+		cols, rows = c, r
+		if 17*c+69 >= 2*3*r {
+			break
+		}
+	}
+	if rows == 0 || rows*cols > pdf417Max {
+		return nil, ErrDataTooLong
+	}
+	pad := rows*cols - n - ecc
+	codewords = append([]int{n + pad}, codewords...)
+	for i := 0; i < pad; i++ {
+		codewords = append(codewords, pdf417Padding)
+	}
+	codewords = append(codewords, pdf417ErrorCorrection(codewords, ecc)...)
+
+	// rows are 3 modules high with a quiet zone of 2 modules
+	width := 17*(cols+4) + 1
+	c := newCode(width+4, 3*rows+4)
+	for y := 0; y < rows; y++ {
+		cluster := y % 3
+		left, right := 30*(y/3), 30*(y/3)
+		switch cluster {
+		case 0:
+			left += (rows - 1) / 3
+			right += cols - 1
+		case 1:
+			left += level*3 + (rows-1)%3
+			right += (rows - 1) / 3
+		case 2:
+			left += cols - 1
+			right += level*3 + (rows-1)%3
+		}
+
+		x := 2
+		draw := func(pattern uint32, bits int) {
+			for i := bits - 1; i >= 0; i-- {
+				if pattern>>i&1 == 1 {
+					for dy := 0; dy < 3; dy++ {
+						c.set(x, 2+3*y+dy)
+					}
+				}
+				x++
+			}
+		}
+		draw(pdf417Start, 17)
+		draw(pdf417Patterns[cluster][left], 17)
+		for _, cw := range codewords[y*cols : (y+1)*cols] {
+			draw(pdf417Patterns[cluster][cw], 17)
+		}
+		draw(pdf417Patterns[cluster][right], 17)
+		draw(pdf417Stop, 18)
+	}
+	return c, nil
+}
+
+// pdf417TextCompaction encodes printable ascii in text compaction mode, it
+// reports false for other data.
+func pdf417TextCompaction(data string) ([]int, bool) {
+	var values []int
+	mode := pdf417Alpha
+	for i := 0; i < len(data); i++ {
+		c := data[i]
+		mixed := strings.IndexByte(pdf417MixedChars, c)
+		punct := strings.IndexByte(pdf417PunctChars, c)
+		upper, lower := c >= 'A' && c <= 'Z', c >= 'a' && c <= 'z'
+		if !upper && !lower && c != ' ' && mixed < 0 && punct < 0 {
+			return nil, false
+		}
+		if mode == pdf417Punct && punct < 0 {
+			// latch to alpha
+			values = append(values, 29)
+			mode = pdf417Alpha
+		}
+
+		switch {
+		case c == ' ' && mode != pdf417Punct:
+			values = append(values, 26)
+		case mode == pdf417Punct:
+			values = append(values, punct)
+		case mode == pdf417Mixed && mixed >= 0:
+			values = append(values, mixed)
+		case upper && mode == pdf417Lower:
+			// shift to alpha
+			values = append(values, 27, int(c-'A'))
+		case upper:
+			if mode == pdf417Mixed {
+				// latch to alpha
+				values = append(values, 28)
+			}
+			mode = pdf417Alpha
+			values = append(values, int(c-'A'))
+		case lower:
+			if mode != pdf417Lower {
+				// latch to lower case
+				values = append(values, 27)
+			}
+			mode = pdf417Lower
+			values = append(values, int(c-'a'))
+		case mixed >= 0:
+			// latch to mixed
+			values = append(values, 28, mixed)
+			mode = pdf417Mixed
+		case mode == pdf417Mixed && i+1 < len(data) && strings.IndexByte(pdf417PunctChars, data[i+1]) >= 0:
+			// latch to punctuation
+			values = append(values, 25, punct)
+			mode = pdf417Punct
+		default:
+			// shift to punctuation
+			values = append(values, 29, punct)
+		}
+	}
+	if len(values)%2 == 1 {
+		values = append(values, 29)
+	}
+
+	codewords := []int{pdf417Text}
+	for i := 0; i < len(values); i += 2 {
+		codewords = append(codewords, values[i]*30+values[i+1])
+	}
+	return codewords, true
+}
+
+// pdf417ByteCompaction encodes data in byte compaction mode, 6 bytes take 5
+// codewords.
+func pdf417ByteCompaction(data []byte) []int {
+	codewords := []int{pdf417Byte}
+	if len(data)%6 == 0 {
+		codewords[0] = pdf417Byte6
+	}
+	for ; len(data) >= 6; data = data[6:] {
+		var v uint64
+		for _, b := range data[:6] {
+			v = v<<8 | uint64(b)
+		}
+		var group [5]int
+		for i := 4; i >= 0; i-- {
+			group[i] = int(v % 900)
+			v /= 900
+		}
+		codewords = append(codewords, group[:]...)
+	}
+	for _, b := range data {
+		codewords = append(codewords, int(b))
+	}
+	return codewords
+}
+
+// pdf417ErrorCorrection returns the n error correction codewords of the
+// codewords, computed in GF(929) with the generator of ISO/IEC 15438 annex A.
+func pdf417ErrorCorrection(codewords []int, n int) []int {
+	// coefficients of the generator (x - 3)(x - 3^2)...(x - 3^n), lowest first
+	gen := []int{1}
+	power := 1
+	for i := 0; i < n; i++ {
+		power = power * 3 % 929
+		next := make([]int, len(gen)+1)
+		for j, g := range gen {
+			next[j+1] = (next[j+1] + g) % 929
+			next[j] = (next[j] + 929 - g*power%929) % 929
+		}
+		gen = next
+	}
+
+	ecc := make([]int, n)
+	for _, cw := range codewords {
+		t := (cw + ecc[n-1]) % 929
+		for j := n - 1; j > 0; j-- {
+			ecc[j] = (ecc[j-1] + 929 - t*gen[j]%929) % 929
+		}
+		ecc[0] = (929 - t*gen[0]%929) % 929
+	}
+	out := make([]int, n)
+	for j := range ecc {
+		if ecc[j] != 0 {
+			ecc[j] = 929 - ecc[j]
+		}
+		out[n-1-j] = ecc[j]
+	}
+	return out
+}
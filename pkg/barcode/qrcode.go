@@ -0,0 +1,25 @@
+package barcode
+
+import "github.com/rengas/pdfgen/pkg/qrcode"
+
+// QRCode encodes data as QR code at the error correction level, with the
+// quiet zone of 4 modules.
+func QRCode(data string, level qrcode.Level) (*Code, error) {
+	if data == "" {
+		return nil, ErrEmpty
+	}
+	q, err := qrcode.EncodeString(data, level)
+	if err != nil {
+		return nil, err
+	}
+	const quiet = 4
+	c := newCode(q.Size+2*quiet, q.Size+2*quiet)
+	for y := 0; y < q.Size; y++ {
+		for x := 0; x < q.Size; x++ {
+			if q.Black(x, y) {
+				c.set(quiet+x, quiet+y)
+			}
+		}
+	}
+	return c, nil
+}
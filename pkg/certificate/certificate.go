@@ -0,0 +1,206 @@
+package certificate
+
+import (
+	"bytes"
+	"crypto"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/ecdsa"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/pem"
+	"errors"
+	"golang.org/x/crypto/pkcs12"
+	"io"
+	"time"
+)
+
+var (
+	ErrCertificateNotFound = errors.New("certificate not found")
+	ErrPKCS12Invalid       = errors.New("invalid pkcs12 file")
+	ErrPKCS12Password      = errors.New("pkcs12 password incorrect")
+	ErrPKCS12Unsupported   = errors.New("pkcs12 encryption not supported, export it with 3DES or RC2")
+	ErrNoPrivateKey        = errors.New("pkcs12 holds no rsa or ecdsa private key")
+	ErrNoCertificate       = errors.New("pkcs12 holds no certificate of the private key")
+	ErrSealed              = errors.New("unable to open sealed certificate")
+	ErrVaultSecret         = errors.New("vault secret is empty")
+)
+
+// Certificate is a signing certificate uploaded by a user. Its private key
+// and chain are kept sealed, only the details are shown.
+type Certificate struct {
+	Id           string    `json:"id"`
+	UserId       string    `json:"-"`
+	Name         string    `json:"name"`
+	Subject      string    `json:"subject"`
+	Issuer       string    `json:"issuer"`
+	SerialNumber string    `json:"serialNumber"`
+	NotBefore    time.Time `json:"notBefore"`
+	NotAfter     time.Time `json:"notAfter"`
+	Sealed       []byte    `json:"-"`
+	CreatedAt    time.Time `json:"createdAt"`
+}
+
+// Valid reports whether the certificate can sign at t.
+func (c Certificate) Valid(t time.Time) bool {
+	return !t.Before(c.NotBefore) && !t.After(c.NotAfter)
+}
+
+// Key is a private key with its certificate chain, the certificate of the
+// key comes first.
+type Key struct {
+	Signer crypto.Signer
+	Chain  []*x509.Certificate
+}
+
+// Describe returns the details of the certificate of the key.
+func (k Key) Describe() Certificate {
+	c := k.Chain[0]
+	return Certificate{
+		Subject:      c.Subject.String(),
+		Issuer:       c.Issuer.String(),
+		SerialNumber: c.SerialNumber.Text(16),
+		NotBefore:    c.NotBefore.UTC(),
+		NotAfter:     c.NotAfter.UTC(),
+	}
+}
+
+// ParsePKCS12 reads the private key and the certificates of a PKCS#12 file.
+func ParsePKCS12(data []byte, password string) (Key, error) {
+	blocks, err := pkcs12.ToPEM(data, password)
+	if err != nil {
+		var ni pkcs12.NotImplementedError
+		switch {
+		case errors.Is(err, pkcs12.ErrIncorrectPassword):
+			return Key{}, ErrPKCS12Password
+		case errors.As(err, &ni):
+			return Key{}, ErrPKCS12Unsupported
+		}
+		return Key{}, ErrPKCS12Invalid
+	}
+	return parsePEM(blocks)
+}
+
+// parsePEM reads a key and its chain from PEM blocks. PKCS#12 files carry
+// RSA keys as PKCS#1 and EC keys as SEC 1.
+func parsePEM(blocks []*pem.Block) (Key, error) {
+	var k Key
+	var certs []*x509.Certificate
+	for _, b := range blocks {
+		switch b.Type {
+		case "CERTIFICATE":
+			c, err := x509.ParseCertificate(b.Bytes)
+			if err != nil {
+				return Key{}, ErrPKCS12Invalid
+			}
+			certs = append(certs, c)
+		case "PRIVATE KEY", "RSA PRIVATE KEY", "EC PRIVATE KEY":
+			if rk, err := x509.ParsePKCS1PrivateKey(b.Bytes); err == nil {
+				k.Signer = rk
+			} else if ek, err := x509.ParseECPrivateKey(b.Bytes); err == nil {
+				k.Signer = ek
+			}
+		}
+	}
+	if k.Signer == nil {
+		return Key{}, ErrNoPrivateKey
+	}
+
+	pub, ok := k.Signer.Public().(interface{ Equal(crypto.PublicKey) bool })
+	if !ok {
+		return Key{}, ErrNoPrivateKey
+	}
+	for i, c := range certs {
+		if pub.Equal(c.PublicKey) {
+			k.Chain = append([]*x509.Certificate{c}, append(certs[:i:i], certs[i+1:]...)...)
+			return k, nil
+		}
+	}
+	return Key{}, ErrNoCertificate
+}
+
+// Vault seals keys with a server secret so they are stored encrypted.
+type Vault struct {
+	aead cipher.AEAD
+}
+
+// NewVault returns a vault with an AES-256-GCM key derived from secret.
+func NewVault(secret string) (*Vault, error) {
+	if secret == "" {
+		return nil, ErrVaultSecret
+	}
+	key := sha256.Sum256([]byte(secret))
+	block, err := aes.NewCipher(key[:])
+	if err != nil {
+		return nil, err
+	}
+	aead, err := cipher.NewGCM(block)
+	if err != nil {
+		return nil, err
+	}
+	return &Vault{aead: aead}, nil
+}
+
+// Seal encrypts the key and its chain, the nonce comes first.
+func (v *Vault) Seal(k Key) ([]byte, error) {
+	var plain bytes.Buffer
+	switch key := k.Signer.(type) {
+	case *rsa.PrivateKey:
+		pem.Encode(&plain, &pem.Block{Type: "RSA PRIVATE KEY", Bytes: x509.MarshalPKCS1PrivateKey(key)})
+	case *ecdsa.PrivateKey:
+		b, err := x509.MarshalECPrivateKey(key)
+		if err != nil {
+			return nil, err
+		}
+		pem.Encode(&plain, &pem.Block{Type: "EC PRIVATE KEY", Bytes: b})
+	default:
+		return nil, ErrNoPrivateKey
+	}
+	for _, c := range k.Chain {
+		pem.Encode(&plain, &pem.Block{Type: "CERTIFICATE", Bytes: c.Raw})
+	}
+
+	return v.SealBytes(plain.Bytes())
+}
+
+// Open decrypts a key sealed by Seal.
+func (v *Vault) Open(b []byte) (Key, error) {
+	plain, err := v.OpenBytes(b)
+	if err != nil {
+		return Key{}, err
+	}
+	var blocks []*pem.Block
+	for {
+		var block *pem.Block
+		block, plain = pem.Decode(plain)
+		if block == nil {
+			break
+		}
+		blocks = append(blocks, block)
+	}
+	return parsePEM(blocks)
+}
+
+// SealBytes encrypts other secrets with the vault key, the nonce comes first.
+func (v *Vault) SealBytes(plain []byte) ([]byte, error) {
+	nonce := make([]byte, v.aead.NonceSize())
+	if _, err := io.ReadFull(rand.Reader, nonce); err != nil {
+		return nil, err
+	}
+	return v.aead.Seal(nonce, nonce, plain, nil), nil
+}
+
+// OpenBytes decrypts a secret sealed by SealBytes.
+func (v *Vault) OpenBytes(b []byte) ([]byte, error) {
+	n := v.aead.NonceSize()
+	if len(b) < n {
+		return nil, ErrSealed
+	}
+	plain, err := v.aead.Open(nil, b[:n], b[n:], nil)
+	if err != nil {
+		return nil, ErrSealed
+	}
+	return plain, nil
+}
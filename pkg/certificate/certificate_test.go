@@ -0,0 +1,79 @@
+package certificate
+
+import (
+	"crypto"
+	"os"
+	"testing"
+	"time"
+)
+
+func TestParsePKCS12(t *testing.T) {
+	data, err := os.ReadFile("testdata/signer.p12")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name     string
+		data     []byte
+		password string
+		wantErr  error
+	}{
+		{name: "valid", data: data, password: "secret"},
+		{name: "wrong password", data: data, password: "wrong", wantErr: ErrPKCS12Password},
+		{name: "not a pkcs12 file", data: []byte("%PDF-1.7"), password: "secret", wantErr: ErrPKCS12Invalid},
+	}
+
+	for _, tc := range tests {
+		k, err := ParsePKCS12(tc.data, tc.password)
+		if err != tc.wantErr {
+			t.Fatalf("%s: expected: %v, got: %v", tc.name, tc.wantErr, err)
+		}
+		if err != nil {
+			continue
+		}
+		c := k.Describe()
+		if c.Subject != "CN=Acme Test Signer,O=Acme Ltd" || !c.Valid(time.Now()) {
+			t.Fatalf("%s: expected: %v, got: %v", tc.name, "valid certificate of Acme Test Signer", c)
+		}
+	}
+}
+
+func TestVault(t *testing.T) {
+	data, err := os.ReadFile("testdata/signer.p12")
+	if err != nil {
+		t.Fatal(err)
+	}
+	k, err := ParsePKCS12(data, "secret")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	v, err := NewVault("server secret")
+	if err != nil {
+		t.Fatal(err)
+	}
+	sealed, err := v.Seal(k)
+	if err != nil {
+		t.Fatal(err)
+	}
+	got, err := v.Open(sealed)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !got.Chain[0].Equal(k.Chain[0]) || !k.Signer.Public().(interface{ Equal(crypto.PublicKey) bool }).Equal(got.Signer.Public()) {
+		t.Fatalf("expected: %v, got: %v", "the sealed key", got.Describe())
+	}
+
+	other, err := NewVault("other secret")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := other.Open(sealed); err != ErrSealed {
+		t.Fatalf("expected: %v, got: %v", ErrSealed, err)
+	}
+	sealed[len(sealed)-1] ^= 1
+	if _, err := v.Open(sealed); err != ErrSealed {
+		t.Fatalf("expected: %v, got: %v", ErrSealed, err)
+	}
+}
@@ -0,0 +1,76 @@
+package certificate
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+)
+
+type Repository struct {
+	db *sql.DB
+}
+
+func NewRepository(db *sql.DB) *Repository {
+	return &Repository{
+		db: db,
+	}
+}
+
+func (r *Repository) Save(ctx context.Context, c Certificate) error {
+	q := `INSERT INTO signing_certificate(id, user_id, name, subject, issuer, serial_number, not_before, not_after, sealed, created_at)
+		  values($1, $2, $3, $4, $5, $6, $7, $8, $9, $10)`
+	_, err := r.db.ExecContext(ctx, q, c.Id, c.UserId, c.Name, c.Subject, c.Issuer, c.SerialNumber, c.NotBefore, c.NotAfter, c.Sealed, c.CreatedAt)
+	return err
+}
+
+// ListByUserId returns the certificates of a user without their sealed keys.
+func (r *Repository) ListByUserId(ctx context.Context, userId string) ([]Certificate, error) {
+	q := `SELECT id, user_id, name, subject, issuer, serial_number, not_before, not_after, created_at
+		  FROM signing_certificate WHERE user_id = $1 ORDER BY created_at`
+	rows, err := r.db.QueryContext(ctx, q, userId)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	certs := make([]Certificate, 0)
+	for rows.Next() {
+		var c Certificate
+		err = rows.Scan(&c.Id, &c.UserId, &c.Name, &c.Subject, &c.Issuer, &c.SerialNumber, &c.NotBefore, &c.NotAfter, &c.CreatedAt)
+		if err != nil {
+			return nil, err
+		}
+		certs = append(certs, c)
+	}
+	return certs, rows.Err()
+}
+
+func (r *Repository) GetById(ctx context.Context, userId, id string) (Certificate, error) {
+	var c Certificate
+	q := `SELECT id, user_id, name, subject, issuer, serial_number, not_before, not_after, sealed, created_at
+		  FROM signing_certificate WHERE id = $1 and user_id = $2`
+	err := r.db.QueryRowContext(ctx, q, id, userId).
+		Scan(&c.Id, &c.UserId, &c.Name, &c.Subject, &c.Issuer, &c.SerialNumber, &c.NotBefore, &c.NotAfter, &c.Sealed, &c.CreatedAt)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return Certificate{}, ErrCertificateNotFound
+		}
+		return Certificate{}, err
+	}
+	return c, nil
+}
+
+func (r *Repository) Delete(ctx context.Context, userId, id string) error {
+	res, err := r.db.ExecContext(ctx, `DELETE FROM signing_certificate WHERE id = $1 and user_id = $2`, id, userId)
+	if err != nil {
+		return err
+	}
+	n, err := res.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if n == 0 {
+		return ErrCertificateNotFound
+	}
+	return nil
+}
@@ -0,0 +1,369 @@
+// Package chromerender renders pdfs and images with a Chromium compatible
+// browser over the DevTools protocol, so designs may use modern css like
+// flexbox and grid.
+//
+// Every render connects to the browser, loads the html in a new page of a
+// fresh browser context, prints it with Page.printToPDF or takes a
+// screenshot and disconnects, which disposes the context and its page.
+package chromerender
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/rengas/pdfgen/pkg/pdf"
+	"github.com/rengas/pdfgen/pkg/pdfops"
+	"github.com/rengas/pdfgen/pkg/pdfrender"
+	"io"
+	"math"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+)
+
+// mmPerInch converts the millimetres of the options to the inches of the
+// protocol.
+const mmPerInch = 25.4
+
+// waitForLoad resolves once the document and its fonts and images loaded.
+const waitForLoad = `new Promise(resolve => {
+	const ready = () => document.fonts.ready.then(() => resolve(true));
+	if (document.readyState === 'complete') ready(); else window.addEventListener('load', ready);
+})`
+
+// documentHeight is the height of the document in css pixels.
+const documentHeight = `document.documentElement.scrollHeight`
+
+// emptyTemplate replaces a missing header or footer, chromium prints the
+// date and title when a template is empty.
+const emptyTemplate = "<span></span>"
+
+var ErrNoDebuggerURL = errors.New("browser did not return a debugger url")
+
+type Renderer struct {
+	endpoint string
+	client   *http.Client
+}
+
+// NewRenderer returns a renderer for the browser at endpoint, the address
+// of its remote debugging port like http://localhost:9222 or the websocket
+// url of the browser like ws://localhost:9222/devtools/browser/<id>.
+func NewRenderer(endpoint string) *Renderer {
+	return &Renderer{
+		endpoint: strings.TrimSuffix(endpoint, "/"),
+		client:   http.DefaultClient,
+	}
+}
+
+func (r *Renderer) HTML(in io.Reader) ([]byte, error) {
+	return r.Render(context.Background(), in, pdfrender.Options{})
+}
+
+func (r *Renderer) Render(ctx context.Context, in io.Reader, o pdfrender.Options) ([]byte, error) {
+	return r.run(ctx, in, func(c *client, session string) ([]byte, error) {
+		b, err := printPDF(c, session, printParams(o))
+		if err != nil || !o.Renumbered() {
+			return b, err
+		}
+		return renumber(c, session, o, b)
+	})
+}
+
+// printPDF prints the loaded page with the params of Page.printToPDF.
+func printPDF(c *client, session string, p params) ([]byte, error) {
+	var printed struct {
+		Data string `json:"data"`
+	}
+	err := c.call(session, "Page.printToPDF", p, &printed)
+	if err != nil {
+		return nil, err
+	}
+	return base64.StdEncoding.DecodeString(printed.Data)
+}
+
+// renumber prints the pages of the printed pdf b again one by one, with
+// their numbers and the total written into the header and footer, and
+// concatenates them. Chromium numbers the pages of every print from 1, so
+// the offset can not be passed on. The pages keep no outline and no tags.
+func renumber(c *client, session string, o pdfrender.Options, b []byte) ([]byte, error) {
+	r, err := pdf.NewReader(b)
+	if err != nil {
+		return nil, err
+	}
+	pages, err := r.Pages()
+	if err != nil {
+		return nil, err
+	}
+	total := o.TotalPages
+	if total == 0 {
+		total = o.PageOffset + len(pages)
+	}
+
+	printed := make([][]byte, len(pages))
+	for i := range pages {
+		p := printParams(o)
+		p["pageRanges"] = strconv.Itoa(i + 1)
+		p["headerTemplate"] = numberTemplate(p["headerTemplate"].(string), o.PageOffset+i+1, total)
+		p["footerTemplate"] = numberTemplate(p["footerTemplate"].(string), o.PageOffset+i+1, total)
+		delete(p, "generateDocumentOutline")
+		delete(p, "generateTaggedPDF")
+		if printed[i], err = printPDF(c, session, p); err != nil {
+			return nil, err
+		}
+	}
+	return pdfops.Concat(printed...)
+}
+
+// numberTemplate renames the pageNumber and totalPages classes of a header
+// or footer template, so chromium does not fill them in, and shows page and
+// total in their place.
+func numberTemplate(t string, page, total int) string {
+	t = strings.NewReplacer("pageNumber", "pdfgen-page-number", "totalPages", "pdfgen-total-pages").Replace(t)
+	return fmt.Sprintf(`<style>.pdfgen-page-number::after{content:"%d"}.pdfgen-total-pages::after{content:"%d"}</style>`, page, total) + t
+}
+
+// RenderImage takes a screenshot of a page. The viewport is as wide as the
+// page in css pixels and scaled to the width of the image, pages are cut
+// from the screen rendering at the height of the page size.
+func (r *Renderer) RenderImage(ctx context.Context, in io.Reader, o pdfrender.Options, img pdfrender.ImageOptions) ([]byte, error) {
+	return r.run(ctx, in, func(c *client, session string) ([]byte, error) {
+		cssW, cssH := pdfrender.CSSPage(o)
+		scale := float64(img.PixelWidth(o)) / cssW
+
+		err := c.call(session, "Emulation.setDeviceMetricsOverride", params{
+			"width":             int(math.Round(cssW)),
+			"height":            int(math.Round(cssH)),
+			"deviceScaleFactor": scale,
+			"mobile":            false,
+		}, nil)
+		if err != nil {
+			return nil, err
+		}
+		err = c.call(session, "Emulation.setEmulatedMedia", params{"media": "print"}, nil)
+		if err != nil {
+			return nil, err
+		}
+
+		var height struct {
+			Result struct {
+				Value float64 `json:"value"`
+			} `json:"result"`
+		}
+		err = c.call(session, "Runtime.evaluate", params{"expression": documentHeight, "returnByValue": true}, &height)
+		if err != nil {
+			return nil, err
+		}
+		y := float64(img.Page) * cssH
+		if img.Page > 0 && y >= height.Result.Value {
+			return nil, pdfrender.ErrPageOutOfRange
+		}
+
+		p := params{
+			"format":                img.Format,
+			"clip":                  params{"x": 0, "y": y, "width": cssW, "height": cssH, "scale": 1},
+			"captureBeyondViewport": true,
+			"fromSurface":           true,
+		}
+		if img.Quality > 0 && img.Format != pdfrender.ImagePNG {
+			p["quality"] = img.Quality
+		}
+		if o.OmitBackground && img.Format != pdfrender.ImageJPEG {
+			err = c.call(session, "Emulation.setDefaultBackgroundColorOverride", params{"color": params{"r": 0, "g": 0, "b": 0, "a": 0}}, nil)
+			if err != nil {
+				return nil, err
+			}
+		}
+
+		var shot struct {
+			Data string `json:"data"`
+		}
+		err = c.call(session, "Page.captureScreenshot", p, &shot)
+		if err != nil {
+			return nil, err
+		}
+		return base64.StdEncoding.DecodeString(shot.Data)
+	})
+}
+
+// run loads the html in a new page and hands the session of the page to
+// output.
+func (r *Renderer) run(ctx context.Context, in io.Reader, output func(c *client, session string) ([]byte, error)) ([]byte, error) {
+	doc, err := io.ReadAll(in)
+	if err != nil {
+		return nil, err
+	}
+
+	wsURL, err := r.debuggerURL(ctx)
+	if err != nil {
+		return nil, err
+	}
+	conn, err := dial(ctx, wsURL)
+	if err != nil {
+		return nil, err
+	}
+	defer conn.Close()
+
+	// reads block on the connection, closing it ends a render when ctx is
+	// done
+	done := make(chan struct{})
+	defer close(done)
+	go func() {
+		select {
+		case <-ctx.Done():
+			conn.nc.Close()
+		case <-done:
+		}
+	}()
+
+	c := &client{conn: conn}
+	session, err := load(c, string(doc))
+	if err == nil {
+		var b []byte
+		b, err = output(c, session)
+		if err == nil {
+			return b, nil
+		}
+	}
+	if ctx.Err() != nil {
+		return nil, ctx.Err()
+	}
+	return nil, err
+}
+
+// load opens a page in a new browser context, sets its html and waits for
+// it to load.
+func load(c *client, doc string) (string, error) {
+	var bc struct {
+		BrowserContextId string `json:"browserContextId"`
+	}
+	err := c.call("", "Target.createBrowserContext", params{"disposeOnDetach": true}, &bc)
+	if err != nil {
+		return "", err
+	}
+
+	var target struct {
+		TargetId string `json:"targetId"`
+	}
+	err = c.call("", "Target.createTarget", params{"url": "about:blank", "browserContextId": bc.BrowserContextId}, &target)
+	if err != nil {
+		return "", err
+	}
+
+	var attached struct {
+		SessionId string `json:"sessionId"`
+	}
+	err = c.call("", "Target.attachToTarget", params{"targetId": target.TargetId, "flatten": true}, &attached)
+	if err != nil {
+		return "", err
+	}
+	session := attached.SessionId
+
+	var tree struct {
+		FrameTree struct {
+			Frame struct {
+				Id string `json:"id"`
+			} `json:"frame"`
+		} `json:"frameTree"`
+	}
+	err = c.call(session, "Page.getFrameTree", nil, &tree)
+	if err != nil {
+		return "", err
+	}
+
+	err = c.call(session, "Page.setDocumentContent", params{"frameId": tree.FrameTree.Frame.Id, "html": doc}, nil)
+	if err != nil {
+		return "", err
+	}
+
+	var loaded struct {
+		ExceptionDetails *struct {
+			Text string `json:"text"`
+		} `json:"exceptionDetails"`
+	}
+	err = c.call(session, "Runtime.evaluate", params{"expression": waitForLoad, "awaitPromise": true}, &loaded)
+	if err != nil {
+		return "", err
+	}
+	if loaded.ExceptionDetails != nil {
+		return "", fmt.Errorf("waiting for the document to load: %s", loaded.ExceptionDetails.Text)
+	}
+	return session, nil
+}
+
+// printParams maps the options to Page.printToPDF. The page size is already
+// swapped for landscape, so landscape is not passed on.
+func printParams(o pdfrender.Options) params {
+	w, h := o.Dimensions()
+	m := o.Margins()
+	p := params{
+		"paperWidth":        w / mmPerInch,
+		"paperHeight":       h / mmPerInch,
+		"marginTop":         m.Top / mmPerInch,
+		"marginRight":       m.Right / mmPerInch,
+		"marginBottom":      m.Bottom / mmPerInch,
+		"marginLeft":        m.Left / mmPerInch,
+		"printBackground":   !o.OmitBackground,
+		"preferCSSPageSize": false,
+	}
+	if o.Header != "" || o.Footer != "" {
+		p["displayHeaderFooter"] = true
+		p["headerTemplate"] = orEmptyTemplate(o.Header)
+		p["footerTemplate"] = orEmptyTemplate(o.Footer)
+	}
+	// the outline has every heading level, it is cut to OutlineDepth after
+	// rendering
+	if o.Outline() {
+		p["generateDocumentOutline"] = true
+	}
+	if o.Accessible {
+		p["generateTaggedPDF"] = true
+	}
+	return p
+}
+
+func orEmptyTemplate(t string) string {
+	if t == "" {
+		return emptyTemplate
+	}
+	return t
+}
+
+// debuggerURL asks the browser for its websocket url unless the endpoint
+// already is one.
+func (r *Renderer) debuggerURL(ctx context.Context) (string, error) {
+	u, err := url.Parse(r.endpoint)
+	if err != nil {
+		return "", err
+	}
+	if u.Scheme == "ws" || u.Scheme == "wss" {
+		return r.endpoint, nil
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, r.endpoint+"/json/version", nil)
+	if err != nil {
+		return "", err
+	}
+	res, err := r.client.Do(req)
+	if err != nil {
+		return "", err
+	}
+	defer res.Body.Close()
+	if res.StatusCode != http.StatusOK {
+		return "", fmt.Errorf("browser version: %s", res.Status)
+	}
+
+	var v struct {
+		WebSocketDebuggerUrl string `json:"webSocketDebuggerUrl"`
+	}
+	err = json.NewDecoder(res.Body).Decode(&v)
+	if err != nil {
+		return "", err
+	}
+	if v.WebSocketDebuggerUrl == "" {
+		return "", ErrNoDebuggerURL
+	}
+	return v.WebSocketDebuggerUrl, nil
+}
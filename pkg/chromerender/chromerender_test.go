@@ -0,0 +1,356 @@
+package chromerender
+
+import (
+	"bufio"
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"github.com/rengas/pdfgen/pkg/htmlrender"
+	"github.com/rengas/pdfgen/pkg/pdf"
+	"github.com/rengas/pdfgen/pkg/pdfrender"
+	"math"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// fakeBrowser speaks enough of the DevTools protocol over a websocket to
+// print a document or take a screenshot. It sends an event and a ping before every response and
+// fragments the printed pdf, like a real browser may.
+type fakeBrowser struct {
+	data   []byte  // printed pdf or screenshot
+	ranged []byte  // pdf printed for a page range
+	height float64 // of the document in css pixels
+	fail   string  // method answered with an error
+	hang   string  // method never answered
+
+	mu    sync.Mutex
+	calls []request
+}
+
+func (f *fakeBrowser) server(t *testing.T) *httptest.Server {
+	var srv *httptest.Server
+	srv = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/json/version" {
+			json.NewEncoder(w).Encode(map[string]string{
+				"webSocketDebuggerUrl": "ws://" + srv.Listener.Addr().String() + "/devtools/browser/fake",
+			})
+			return
+		}
+		if r.Header.Get("Upgrade") != "websocket" {
+			http.NotFound(w, r)
+			return
+		}
+
+		nc, brw, err := w.(http.Hijacker).Hijack()
+		if err != nil {
+			t.Error(err)
+			return
+		}
+		defer nc.Close()
+		brw.WriteString("HTTP/1.1 101 Switching Protocols\r\nUpgrade: websocket\r\nConnection: Upgrade\r\n")
+		brw.WriteString("Sec-WebSocket-Accept: " + acceptKey(r.Header.Get("Sec-Websocket-Key")) + "\r\n\r\n")
+		brw.Flush()
+		f.serve(t, nc, brw.Reader)
+	}))
+	return srv
+}
+
+func (f *fakeBrowser) serve(t *testing.T, nc net.Conn, br *bufio.Reader) {
+	for {
+		_, op, p, err := readFrame(br)
+		if err != nil || op == opClose {
+			return
+		}
+		if op == opPong {
+			continue
+		}
+		var req struct {
+			request
+			Params json.RawMessage `json:"params"`
+		}
+		if err := json.Unmarshal(p, &req); err != nil {
+			t.Error(err)
+			return
+		}
+		var decoded params
+		json.Unmarshal(req.Params, &decoded)
+		f.mu.Lock()
+		f.calls = append(f.calls, request{Id: req.Id, SessionId: req.SessionId, Method: req.Method, Params: decoded})
+		f.mu.Unlock()
+
+		if req.Method == f.hang {
+			continue
+		}
+		writeFrame(nc, opText, []byte(`{"method":"Page.lifecycleEvent","params":{}}`), false)
+		writeFrame(nc, opPing, []byte("hi"), false)
+
+		var res interface{}
+		switch req.Method {
+		case "Target.createBrowserContext":
+			res = map[string]string{"browserContextId": "ctx-1"}
+		case "Target.createTarget":
+			res = map[string]string{"targetId": "target-1"}
+		case "Target.attachToTarget":
+			res = map[string]string{"sessionId": "session-1"}
+		case "Page.getFrameTree":
+			res = map[string]interface{}{"frameTree": map[string]interface{}{"frame": map[string]string{"id": "frame-1"}}}
+		case "Page.printToPDF", "Page.captureScreenshot":
+			data := f.data
+			if _, ok := decoded["pageRanges"]; ok {
+				data = f.ranged
+			}
+			res = map[string]string{"data": base64.StdEncoding.EncodeToString(data)}
+		case "Runtime.evaluate":
+			res = map[string]interface{}{"result": map[string]interface{}{"value": f.height}}
+		default:
+			res = map[string]interface{}{}
+		}
+		msg := map[string]interface{}{"id": req.Id, "result": res}
+		if req.Method == f.fail {
+			msg = map[string]interface{}{"id": req.Id, "error": map[string]interface{}{"code": -32000, "message": "printing failed"}}
+		}
+		b, _ := json.Marshal(msg)
+
+		if req.Method == "Page.printToPDF" && len(b) < 250 {
+			// first fragment without the fin bit, the rest as continuation
+			half := len(b) / 2
+			nc.Write(append([]byte{opText, byte(half)}, b[:half]...))
+			nc.Write(append([]byte{0x80, byte(len(b) - half)}, b[half:]...))
+			continue
+		}
+		writeFrame(nc, opText, b, false)
+	}
+}
+
+func (f *fakeBrowser) methods() []string {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	var ms []string
+	for _, c := range f.calls {
+		ms = append(ms, c.Method)
+	}
+	return ms
+}
+
+func (f *fakeBrowser) call(method string) request {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	for _, c := range f.calls {
+		if c.Method == method {
+			return c
+		}
+	}
+	return request{}
+}
+
+func TestRender(t *testing.T) {
+	f := &fakeBrowser{data: []byte("%PDF-1.4 fake")}
+	srv := f.server(t)
+	defer srv.Close()
+
+	doc := `<html><body><div style="display:flex">hi</div></body></html>`
+	o := pdfrender.Options{
+		PageSize:       "letter",
+		Landscape:      true,
+		Margin:         &pdfrender.Margin{Top: 25.4, Right: 12.7, Bottom: 25.4, Left: 12.7},
+		Footer:         `<span class="pageNumber"></span>`,
+		OmitBackground: true,
+	}
+	pb, err := NewRenderer(srv.URL).Render(context.Background(), strings.NewReader(doc), o)
+	if err != nil {
+		t.Fatalf("expected: %v, got: %v", nil, err)
+	}
+	if string(pb) != string(f.data) {
+		t.Fatalf("expected: %s, got: %s", f.data, pb)
+	}
+
+	want := []string{"Target.createBrowserContext", "Target.createTarget", "Target.attachToTarget",
+		"Page.getFrameTree", "Page.setDocumentContent", "Runtime.evaluate", "Page.printToPDF"}
+	if got := f.methods(); strings.Join(got, ",") != strings.Join(want, ",") {
+		t.Fatalf("expected: %v, got: %v", want, got)
+	}
+
+	set := f.call("Page.setDocumentContent")
+	sp := set.Params.(params)
+	if set.SessionId != "session-1" || sp["frameId"] != "frame-1" || sp["html"] != doc {
+		t.Fatalf("expected document set on frame-1 of session-1, got: %+v", set)
+	}
+
+	pp := f.call("Page.printToPDF").Params.(params)
+	tests := []struct {
+		name string
+		got  interface{}
+		want interface{}
+	}{
+		{name: "landscape letter width", got: pp["paperWidth"], want: 11.0},
+		{name: "landscape letter height", got: pp["paperHeight"], want: 8.5},
+		{name: "top margin", got: pp["marginTop"], want: 1.0},
+		{name: "left margin", got: pp["marginLeft"], want: 0.5},
+		{name: "background", got: pp["printBackground"], want: false},
+		{name: "header and footer", got: pp["displayHeaderFooter"], want: true},
+		{name: "empty header", got: pp["headerTemplate"], want: emptyTemplate},
+		{name: "footer", got: pp["footerTemplate"], want: o.Footer},
+	}
+	for _, tc := range tests {
+		got := tc.got
+		if f, ok := got.(float64); ok {
+			got = math.Round(f*1000) / 1000
+		}
+		if got != tc.want {
+			t.Fatalf("%s: expected: %v, got: %v", tc.name, tc.want, got)
+		}
+	}
+}
+
+func TestRenderDefaults(t *testing.T) {
+	f := &fakeBrowser{data: []byte("%PDF")}
+	srv := f.server(t)
+	defer srv.Close()
+
+	ws := "ws://" + srv.Listener.Addr().String() + "/devtools/browser/fake"
+	_, err := NewRenderer(ws).Render(context.Background(), strings.NewReader("<p>hi</p>"), pdfrender.Options{})
+	if err != nil {
+		t.Fatalf("expected: %v, got: %v", nil, err)
+	}
+
+	pp := f.call("Page.printToPDF").Params.(params)
+	if math.Round(pp["paperWidth"].(float64)*100) != 827 || pp["printBackground"] != true {
+		t.Fatalf("expected a4 with background, got: %v", pp)
+	}
+	if _, ok := pp["displayHeaderFooter"]; ok {
+		t.Fatalf("expected no header and footer, got: %v", pp)
+	}
+}
+
+func TestRenderRenumbered(t *testing.T) {
+	render := func(html string) []byte {
+		b, err := htmlrender.NewRenderer().Render(context.Background(), strings.NewReader(html), pdfrender.Options{})
+		if err != nil {
+			t.Fatal(err)
+		}
+		return b
+	}
+	f := &fakeBrowser{data: render(strings.Repeat("<p>line</p>", 60)), ranged: render("<p>page</p>")}
+	srv := f.server(t)
+	defer srv.Close()
+
+	o := pdfrender.Options{
+		Footer:     `<span class="pageNumber"></span> / <span class="totalPages"></span>`,
+		Bookmarks:  true,
+		PageOffset: 3,
+		TotalPages: 9,
+	}
+	b, err := NewRenderer(srv.URL).Render(context.Background(), strings.NewReader("<p>hi</p>"), o)
+	if err != nil {
+		t.Fatalf("expected: %v, got: %v", nil, err)
+	}
+	r, err := pdf.NewReader(b)
+	if err != nil {
+		t.Fatal(err)
+	}
+	pages, err := r.Pages()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	var footers []string
+	for _, c := range f.calls {
+		p, _ := c.Params.(params)
+		if c.Method != "Page.printToPDF" || p["pageRanges"] == nil {
+			continue
+		}
+		if p["pageRanges"] != strconv.Itoa(len(footers)+1) || p["generateDocumentOutline"] != nil {
+			t.Fatalf("expected: %v, got: %v", "page "+strconv.Itoa(len(footers)+1)+" without outline", p)
+		}
+		footers = append(footers, p["footerTemplate"].(string))
+	}
+	if len(footers) < 2 || len(pages) != len(footers) {
+		t.Fatalf("expected: %v, got: %v pages of %v prints", "a print per page", len(pages), len(footers))
+	}
+	want := numberTemplate(o.Footer, 5, 9)
+	if footers[1] != want || strings.Contains(footers[1], `"pageNumber"`) {
+		t.Fatalf("expected: %v, got: %v", want, footers[1])
+	}
+}
+
+func TestNumberTemplate(t *testing.T) {
+	got := numberTemplate(`<span class="pageNumber"></span> of <span class="totalPages"></span>`, 4, 7)
+	want := `<style>.pdfgen-page-number::after{content:"4"}.pdfgen-total-pages::after{content:"7"}</style>` +
+		`<span class="pdfgen-page-number"></span> of <span class="pdfgen-total-pages"></span>`
+	if got != want {
+		t.Fatalf("expected: %v, got: %v", want, got)
+	}
+}
+
+func TestRenderError(t *testing.T) {
+	f := &fakeBrowser{fail: "Page.printToPDF"}
+	srv := f.server(t)
+	defer srv.Close()
+
+	_, err := NewRenderer(srv.URL).Render(context.Background(), strings.NewReader("<p>hi</p>"), pdfrender.Options{})
+	var perr *ProtocolError
+	if !errors.As(err, &perr) || perr.Method != "Page.printToPDF" || perr.Message != "printing failed" {
+		t.Fatalf("expected: printing failed, got: %v", err)
+	}
+}
+
+func TestRenderTimeout(t *testing.T) {
+	f := &fakeBrowser{hang: "Runtime.evaluate"}
+	srv := f.server(t)
+	defer srv.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	_, err := NewRenderer(srv.URL).Render(ctx, strings.NewReader("<p>hi</p>"), pdfrender.Options{})
+	if !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("expected: %v, got: %v", context.DeadlineExceeded, err)
+	}
+}
+
+func TestRenderImage(t *testing.T) {
+	f := &fakeBrowser{data: []byte("png"), height: 2000}
+	srv := f.server(t)
+	defer srv.Close()
+
+	r := NewRenderer(srv.URL)
+	b, err := r.RenderImage(context.Background(), strings.NewReader("<p>hi</p>"), pdfrender.Options{},
+		pdfrender.ImageOptions{Format: pdfrender.ImageJPEG, Width: 397, Page: 1, Quality: 80})
+	if err != nil || string(b) != "png" {
+		t.Fatalf("expected: png, got: %s %v", b, err)
+	}
+
+	metrics := f.call("Emulation.setDeviceMetricsOverride").Params.(params)
+	shot := f.call("Page.captureScreenshot").Params.(params)
+	clip := shot["clip"].(map[string]interface{})
+	tests := []struct {
+		name string
+		got  interface{}
+		want interface{}
+	}{
+		{name: "viewport is an a4 page", got: metrics["width"], want: 794.0},
+		{name: "scaled to the image width", got: math.Round(metrics["deviceScaleFactor"].(float64) * 100), want: 50.0},
+		{name: "format", got: shot["format"], want: "jpeg"},
+		{name: "quality", got: shot["quality"], want: 80.0},
+		{name: "second page", got: math.Round(clip["y"].(float64)), want: 1123.0},
+	}
+	for _, tc := range tests {
+		if tc.got != tc.want {
+			t.Fatalf("%s: expected: %v, got: %v", tc.name, tc.want, tc.got)
+		}
+	}
+
+	_, err = r.RenderImage(context.Background(), strings.NewReader("<p>hi</p>"), pdfrender.Options{},
+		pdfrender.ImageOptions{Format: pdfrender.ImagePNG, Page: 2})
+	if err != pdfrender.ErrPageOutOfRange {
+		t.Fatalf("expected: %v, got: %v", pdfrender.ErrPageOutOfRange, err)
+	}
+}
@@ -0,0 +1,79 @@
+package chromerender
+
+import (
+	"encoding/json"
+	"fmt"
+)
+
+type params map[string]interface{}
+
+type request struct {
+	Id        int64       `json:"id"`
+	SessionId string      `json:"sessionId,omitempty"`
+	Method    string      `json:"method"`
+	Params    interface{} `json:"params,omitempty"`
+}
+
+// message is a response to a request, or an event when it has no id.
+type message struct {
+	Id     int64           `json:"id"`
+	Method string          `json:"method"`
+	Result json.RawMessage `json:"result"`
+	Error  *ProtocolError  `json:"error"`
+}
+
+type ProtocolError struct {
+	Method  string `json:"-"`
+	Code    int64  `json:"code"`
+	Message string `json:"message"`
+}
+
+func (e *ProtocolError) Error() string {
+	return fmt.Sprintf("%s: %s (%d)", e.Method, e.Message, e.Code)
+}
+
+// client sends one DevTools command at a time and skips the events that
+// arrive in between.
+type client struct {
+	conn   *conn
+	lastId int64
+}
+
+// call sends a command to the browser, or to the page of the session when
+// one is set, and decodes the result into v unless v is nil.
+func (c *client) call(session, method string, p params, v interface{}) error {
+	c.lastId++
+	req := request{Id: c.lastId, SessionId: session, Method: method}
+	if p != nil {
+		req.Params = p
+	}
+	b, err := json.Marshal(req)
+	if err != nil {
+		return err
+	}
+	if err := c.conn.WriteMessage(b); err != nil {
+		return err
+	}
+
+	for {
+		b, err := c.conn.ReadMessage()
+		if err != nil {
+			return err
+		}
+		var m message
+		if err := json.Unmarshal(b, &m); err != nil {
+			return err
+		}
+		if m.Id != req.Id {
+			continue
+		}
+		if m.Error != nil {
+			m.Error.Method = method
+			return m.Error
+		}
+		if v == nil {
+			return nil
+		}
+		return json.Unmarshal(m.Result, v)
+	}
+}
@@ -0,0 +1,270 @@
+package chromerender
+
+import (
+	"bufio"
+	"context"
+	"crypto/rand"
+	"crypto/sha1"
+	"crypto/tls"
+	"encoding/base64"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"sync"
+	"time"
+)
+
+// websocket opcodes
+const (
+	opText  = 0x1
+	opClose = 0x8
+	opPing  = 0x9
+	opPong  = 0xa
+)
+
+// maxMessage bounds a single message, printed pdfs arrive base64 encoded in
+// one message.
+const maxMessage = 512 << 20
+
+const websocketGUID = "258EAFA5-E914-47DA-95CA-C5AB0DC85B11"
+
+var (
+	ErrMessageTooLarge = errors.New("websocket message too large")
+	ErrHandshake       = errors.New("websocket handshake failed")
+)
+
+// conn is a websocket client connection with just what the DevTools
+// protocol needs: text messages, fragmentation, ping and close. Extensions
+// and subprotocols are not supported.
+type conn struct {
+	nc net.Conn
+	br *bufio.Reader
+	mu sync.Mutex
+}
+
+func dial(ctx context.Context, rawURL string) (*conn, error) {
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return nil, err
+	}
+
+	host := u.Host
+	if u.Port() == "" {
+		if u.Scheme == "wss" {
+			host += ":443"
+		} else {
+			host += ":80"
+		}
+	}
+
+	d := &net.Dialer{}
+	var nc net.Conn
+	switch u.Scheme {
+	case "ws":
+		nc, err = d.DialContext(ctx, "tcp", host)
+	case "wss":
+		td := &tls.Dialer{NetDialer: d, Config: &tls.Config{ServerName: u.Hostname()}}
+		nc, err = td.DialContext(ctx, "tcp", host)
+	default:
+		return nil, fmt.Errorf("unsupported websocket scheme %q", u.Scheme)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	if deadline, ok := ctx.Deadline(); ok {
+		nc.SetDeadline(deadline)
+	}
+	br, err := handshake(nc, u)
+	if err != nil {
+		nc.Close()
+		return nil, err
+	}
+	nc.SetDeadline(time.Time{})
+
+	return &conn{nc: nc, br: br}, nil
+}
+
+func handshake(nc net.Conn, u *url.URL) (*bufio.Reader, error) {
+	nonce := make([]byte, 16)
+	if _, err := rand.Read(nonce); err != nil {
+		return nil, err
+	}
+	key := base64.StdEncoding.EncodeToString(nonce)
+
+	req := &http.Request{
+		Method: http.MethodGet,
+		URL:    &url.URL{Path: u.Path, RawQuery: u.RawQuery},
+		Host:   u.Host,
+		Header: http.Header{
+			"Upgrade":               {"websocket"},
+			"Connection":            {"Upgrade"},
+			"Sec-Websocket-Key":     {key},
+			"Sec-Websocket-Version": {"13"},
+		},
+	}
+	if err := req.Write(nc); err != nil {
+		return nil, err
+	}
+
+	br := bufio.NewReader(nc)
+	res, err := http.ReadResponse(br, req)
+	if err != nil {
+		return nil, err
+	}
+	res.Body.Close()
+	if res.StatusCode != http.StatusSwitchingProtocols {
+		return nil, fmt.Errorf("%w: %s", ErrHandshake, res.Status)
+	}
+	if res.Header.Get("Sec-Websocket-Accept") != acceptKey(key) {
+		return nil, fmt.Errorf("%w: invalid accept key", ErrHandshake)
+	}
+	return br, nil
+}
+
+// acceptKey is the Sec-WebSocket-Accept a server answers to key.
+func acceptKey(key string) string {
+	h := sha1.Sum([]byte(key + websocketGUID))
+	return base64.StdEncoding.EncodeToString(h[:])
+}
+
+func (c *conn) WriteMessage(p []byte) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return writeFrame(c.nc, opText, p, true)
+}
+
+// ReadMessage reads the next text or binary message, answering pings on
+// the way. A close frame from the server ends with io.EOF.
+func (c *conn) ReadMessage() ([]byte, error) {
+	var msg []byte
+	for {
+		fin, op, p, err := readFrame(c.br)
+		if err != nil {
+			return nil, err
+		}
+		switch op {
+		case opPing:
+			c.mu.Lock()
+			err = writeFrame(c.nc, opPong, p, true)
+			c.mu.Unlock()
+			if err != nil {
+				return nil, err
+			}
+			continue
+		case opPong:
+			continue
+		case opClose:
+			c.mu.Lock()
+			writeFrame(c.nc, opClose, p, true)
+			c.mu.Unlock()
+			return nil, io.EOF
+		}
+
+		if len(msg)+len(p) > maxMessage {
+			return nil, ErrMessageTooLarge
+		}
+		msg = append(msg, p...)
+		if fin {
+			return msg, nil
+		}
+	}
+}
+
+func (c *conn) Close() error {
+	c.mu.Lock()
+	c.nc.SetWriteDeadline(time.Now().Add(time.Second))
+	writeFrame(c.nc, opClose, []byte{0x03, 0xe8}, true)
+	c.mu.Unlock()
+	return c.nc.Close()
+}
+
+// writeFrame writes a single final frame, clients must mask their frames
+// and servers must not.
+func writeFrame(w io.Writer, op byte, p []byte, mask bool) error {
+	header := make([]byte, 2, 14)
+	header[0] = 0x80 | op
+	switch {
+	case len(p) < 126:
+		header[1] = byte(len(p))
+	case len(p) <= 0xffff:
+		header[1] = 126
+		header = append(header, 0, 0)
+		binary.BigEndian.PutUint16(header[2:], uint16(len(p)))
+	default:
+		header[1] = 127
+		header = append(header, 0, 0, 0, 0, 0, 0, 0, 0)
+		binary.BigEndian.PutUint64(header[2:], uint64(len(p)))
+	}
+
+	payload := p
+	if mask {
+		header[1] |= 0x80
+		var key [4]byte
+		if _, err := rand.Read(key[:]); err != nil {
+			return err
+		}
+		header = append(header, key[:]...)
+		payload = make([]byte, len(p))
+		for i := range p {
+			payload[i] = p[i] ^ key[i%4]
+		}
+	}
+
+	if _, err := w.Write(header); err != nil {
+		return err
+	}
+	_, err := w.Write(payload)
+	return err
+}
+
+// readFrame reads a frame and unmasks its payload.
+func readFrame(r *bufio.Reader) (bool, byte, []byte, error) {
+	var header [2]byte
+	if _, err := io.ReadFull(r, header[:]); err != nil {
+		return false, 0, nil, err
+	}
+	fin := header[0]&0x80 != 0
+	op := header[0] & 0x0f
+	masked := header[1]&0x80 != 0
+
+	n := uint64(header[1] & 0x7f)
+	switch n {
+	case 126:
+		var ext [2]byte
+		if _, err := io.ReadFull(r, ext[:]); err != nil {
+			return false, 0, nil, err
+		}
+		n = uint64(binary.BigEndian.Uint16(ext[:]))
+	case 127:
+		var ext [8]byte
+		if _, err := io.ReadFull(r, ext[:]); err != nil {
+			return false, 0, nil, err
+		}
+		n = binary.BigEndian.Uint64(ext[:])
+	}
+	if n > maxMessage {
+		return false, 0, nil, ErrMessageTooLarge
+	}
+
+	var key [4]byte
+	if masked {
+		if _, err := io.ReadFull(r, key[:]); err != nil {
+			return false, 0, nil, err
+		}
+	}
+	p := make([]byte, n)
+	if _, err := io.ReadFull(r, p); err != nil {
+		return false, 0, nil, err
+	}
+	if masked {
+		for i := range p {
+			p[i] ^= key[i%4]
+		}
+	}
+	return fin, op, p, nil
+}
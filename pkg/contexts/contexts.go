@@ -12,12 +12,14 @@ var (
 type arguments string
 
 var (
-	userId   = arguments("userId")
-	designId = arguments("designId")
+	userId           = arguments("userId")
+	designId         = arguments("designId")
+	organizationId   = arguments("organizationId")
+	organizationRole = arguments("organizationRole")
 )
 
-func WithUserId(ctx context.Context, userId string) context.Context {
-	return context.WithValue(ctx, userId, userId)
+func WithUserId(ctx context.Context, id string) context.Context {
+	return context.WithValue(ctx, userId, id)
 }
 
 func UserIdFromContext(ctx context.Context) (string, error) {
@@ -28,8 +30,8 @@ func UserIdFromContext(ctx context.Context) (string, error) {
 	return id, nil
 }
 
-func WithDesignId(ctx context.Context, userId string) context.Context {
-	return context.WithValue(ctx, userId, userId)
+func WithDesignId(ctx context.Context, id string) context.Context {
+	return context.WithValue(ctx, designId, id)
 }
 
 func DesignIdFromContext(ctx context.Context) (string, error) {
@@ -39,3 +41,27 @@ func DesignIdFromContext(ctx context.Context) (string, error) {
 	}
 	return id, nil
 }
+
+func WithOrganizationId(ctx context.Context, id string) context.Context {
+	return context.WithValue(ctx, organizationId, id)
+}
+
+func OrganizationIdFromContext(ctx context.Context) (string, error) {
+	id, ok := ctx.Value(organizationId).(string)
+	if !ok {
+		return "", ErrNotInContext
+	}
+	return id, nil
+}
+
+func WithOrganizationRole(ctx context.Context, role string) context.Context {
+	return context.WithValue(ctx, organizationRole, role)
+}
+
+func OrganizationRoleFromContext(ctx context.Context) (string, error) {
+	role, ok := ctx.Value(organizationRole).(string)
+	if !ok {
+		return "", ErrNotInContext
+	}
+	return role, nil
+}
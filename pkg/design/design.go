@@ -1,23 +1,236 @@
 package design
 
 import (
+	"bytes"
 	"database/sql/driver"
 	"encoding/json"
 	"errors"
+	"fmt"
+	"github.com/rengas/pdfgen/pkg/barcode"
+	"github.com/rengas/pdfgen/pkg/facturx"
+	"github.com/rengas/pdfgen/pkg/pdfops"
+	"github.com/rengas/pdfgen/pkg/pdfrender"
+	"html/template"
+	"io"
+	"strings"
+	texttemplate "text/template"
 	"time"
 )
 
+var (
+	ErrUnableToParseTemplate = errors.New("unable to parse template")
+	ErrUnableToMatchFields   = errors.New("unable to match fields to design")
+	ErrNoInvoice             = errors.New("design has no invoice mapping")
+	ErrNotHTML               = errors.New("design is not an html template")
+)
+
+// Types of designs, html designs are templates rendered to pdf and pdf-form
+// designs are uploaded pdfs whose form fields are filled.
+const (
+	TypeHTML    = "html"
+	TypePDFForm = "pdf-form"
+)
+
 type Design struct {
-	Id        string    `json:"id"`
-	Name      string    `json:"name"`
-	UserId    string    `json:"userId"`
-	Fields    *Attrs    `json:"fields"`
-	Template  string    `json:"design"`
+	Id             string  `json:"id"`
+	Name           string  `json:"name"`
+	UserId         string  `json:"userId"`
+	OrganizationId *string `json:"organizationId,omitempty"`
+	Fields         *Attrs  `json:"fields"`
+	Type           string  `json:"type"`
+	Template       string  `json:"design"`
+	// Form is the pdf of pdf-form designs, Schema lists its fields.
+	Form   []byte             `json:"-"`
+	Schema []pdfops.FormField `json:"schema,omitempty"`
+	Render *pdfrender.Options `json:"render,omitempty"`
+	// Invoice maps the fields to a Factur-X invoice embedded in generated
+	// pdfs.
+	Invoice *facturx.Mapping `json:"invoice,omitempty"`
+	// Draft designs are watermarked when generated.
+	Draft     bool      `json:"draft"`
+	Access    Access    `json:"access,omitempty"`
+	Shared    bool      `json:"shared"`
 	CreatedAt time.Time `json:"createdAt"`
 	UpdatedAt time.Time `json:"updatedAt"`
 	DeletedAt time.Time `json:"deletedAt"`
 }
 
+// CanManage reports whether the user may delete and share the design. Users
+// a design is shared with can at most edit it.
+func (d Design) CanManage() bool {
+	return d.Access.CanEdit() && !d.Shared
+}
+
+// IsForm reports whether the design is an uploaded pdf form.
+func (d Design) IsForm() bool {
+	return d.Type == TypePDFForm
+}
+
+// WithFields returns the design with fields laid over its stored fields.
+// Objects in both are merged key by key, other values of fields replace the
+// stored ones. The stored fields are not modified.
+func (d Design) WithFields(fields Attrs) Design {
+	if fields == nil {
+		return d
+	}
+	var stored Attrs
+	if d.Fields != nil {
+		stored = *d.Fields
+	}
+	merged := Attrs(mergeFields(stored, fields))
+	d.Fields = &merged
+	return d
+}
+
+func mergeFields(stored, fields map[string]interface{}) map[string]interface{} {
+	merged := make(map[string]interface{}, len(stored)+len(fields))
+	for k, v := range stored {
+		merged[k] = v
+	}
+	for k, v := range fields {
+		sv, ok := merged[k].(map[string]interface{})
+		fv, isMap := v.(map[string]interface{})
+		if ok && isMap {
+			v = mergeFields(sv, fv)
+		}
+		merged[k] = v
+	}
+	return merged
+}
+
+// Parse parses text as the template of a design, with the barcode
+// functions of package barcode.
+func Parse(name, text string) (*template.Template, error) {
+	return template.New(name).Funcs(barcode.Funcs()).Parse(text)
+}
+
+// HTML executes the template of the design with its fields, a design without
+// fields is returned as is. Barcodes that cannot be made are a *barcode.Error.
+func (d Design) HTML() (io.Reader, error) {
+	if d.IsForm() {
+		return nil, ErrNotHTML
+	}
+	if d.Fields == nil {
+		return strings.NewReader(d.Template), nil
+	}
+
+	tl, err := Parse(d.Name, d.Template)
+	if err != nil {
+		return nil, ErrUnableToParseTemplate
+	}
+	var buf bytes.Buffer
+	err = tl.Execute(&buf, d.Fields)
+	var code *barcode.Error
+	if errors.As(err, &code) {
+		return nil, code
+	}
+	if err != nil {
+		return nil, ErrUnableToMatchFields
+	}
+	return &buf, nil
+}
+
+// Expand executes text as a template with the fields of the design, e.g. to
+// read a password from {{.employee.dob}}. Missing fields are an error.
+func (d Design) Expand(text string) (string, error) {
+	tl, err := texttemplate.New(d.Name).Option("missingkey=error").Parse(text)
+	if err != nil {
+		return "", ErrUnableToParseTemplate
+	}
+	var fields Attrs
+	if d.Fields != nil {
+		fields = *d.Fields
+	}
+	var buf strings.Builder
+	if err := tl.Execute(&buf, fields); err != nil {
+		return "", ErrUnableToMatchFields
+	}
+	return buf.String(), nil
+}
+
+// FormValues returns the fields of the design by the names of form fields,
+// nested fields are joined by periods as in {"applicant.name": "Ada"}.
+func (d Design) FormValues() map[string]string {
+	values := map[string]string{}
+	if d.Fields != nil {
+		formValues(values, "", *d.Fields)
+	}
+	return values
+}
+
+func formValues(values map[string]string, prefix string, fields map[string]interface{}) {
+	for k, v := range fields {
+		name := prefix + k
+		switch v := v.(type) {
+		case map[string]interface{}:
+			formValues(values, name+".", v)
+		case Attrs:
+			formValues(values, name+".", v)
+		case nil:
+		case string:
+			values[name] = v
+		default:
+			values[name] = fmt.Sprint(v)
+		}
+	}
+}
+
+// InvoiceXML returns the Factur-X invoice the mapping of the design makes of
+// its fields.
+func (d Design) InvoiceXML() ([]byte, error) {
+	if d.Invoice == nil {
+		return nil, ErrNoInvoice
+	}
+	var fields Attrs
+	if d.Fields != nil {
+		fields = *d.Fields
+	}
+	return facturx.Build(*d.Invoice, fields)
+}
+
+// RenderOptions returns the render options of the design, the defaults when
+// it has none.
+func (d Design) RenderOptions() pdfrender.Options {
+	if d.Render == nil {
+		return pdfrender.Options{}
+	}
+	return *d.Render
+}
+
+// Access is what the requesting user may do with a design. It is resolved
+// from ownership, organization membership or a share when the design is read.
+type Access string
+
+const (
+	AccessOwner    Access = "owner"
+	AccessEdit     Access = "edit"
+	AccessGenerate Access = "generate"
+	AccessRead     Access = "read"
+)
+
+func (a Access) CanEdit() bool {
+	return a == AccessOwner || a == AccessEdit
+}
+
+func (a Access) CanGenerate() bool {
+	return a == AccessOwner || a == AccessEdit || a == AccessGenerate
+}
+
+// rank orders access from none to owner.
+func (a Access) rank() int {
+	switch a {
+	case AccessOwner:
+		return 4
+	case AccessEdit:
+		return 3
+	case AccessGenerate:
+		return 2
+	case AccessRead:
+		return 1
+	}
+	return 0
+}
+
 type Attrs map[string]interface{}
 
 func (a Attrs) Value() (driver.Value, error) {
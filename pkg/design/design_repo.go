@@ -4,11 +4,39 @@ import (
 	"context"
 	"database/sql"
 	"errors"
+	"fmt"
 	"github.com/rengas/pdfgen/pkg/pagination"
 	"time"
 )
 
-var ErrUnableToSaveDesign = errors.New("unable to save profile")
+var (
+	ErrUnableToSaveDesign = errors.New("unable to save profile")
+	ErrDesignNotFound     = errors.New("design not found")
+)
+
+// selectDesign reads designs together with the access of the requesting
+// user, $1 must be the user id. Personal designs are visible to their
+// creator, organization designs to every member of the organization and
+// any design to the users it is shared with. The access is resolved by
+// scanDesign.
+const selectDesign = `SELECT d.id, d.name, d.user_id, d.organization_id, d.fields, d.type, d.template, d.form_pdf, d.render_options, d.invoice_mapping, d.draft, d.created_at, d.updated_at,
+		d.organization_id IS NULL AND d.user_id = $1, m.role, s.permission
+		` + fromDesign
+
+const fromDesign = `FROM design d
+		LEFT JOIN organization_member m ON m.organization_id = d.organization_id AND m.user_id = $1
+		LEFT JOIN design_share s ON s.design_id = d.id AND s.user_id = $1 AND s.accepted_at IS NOT NULL AND s.revoked_at IS NULL`
+
+const visible = `((d.organization_id IS NULL AND d.user_id = $1) OR m.user_id IS NOT NULL OR s.id IS NOT NULL)`
+
+// deletable limits deletes to the creator of a personal design and to owners
+// and editors of the organization of an organization design.
+const deletable = `((organization_id IS NULL AND user_id = $1) OR organization_id IN (
+		SELECT organization_id FROM organization_member WHERE user_id = $1 AND role IN ('owner', 'editor')))`
+
+// editable also lets users a design is shared with for editing change it.
+const editable = `(` + deletable + ` OR id IN (
+		SELECT design_id FROM design_share WHERE user_id = $1 AND permission = 'edit' AND accepted_at IS NOT NULL AND revoked_at IS NULL))`
 
 type DesignRepository struct {
 	db *sql.DB
@@ -21,12 +49,18 @@ func NewDesignRepository(db *sql.DB) *DesignRepository {
 }
 
 func (r *DesignRepository) Save(ctx context.Context, p Design) error {
-	_, err := r.db.ExecContext(ctx, "INSERT INTO design(id, user_id, name, fields, template ) values($1, $2, $3, $4, $5)",
+	_, err := r.db.ExecContext(ctx, "INSERT INTO design(id, user_id, organization_id, name, fields, template, render_options, invoice_mapping, draft, type, form_pdf) values($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11)",
 		p.Id,
 		p.UserId,
+		p.OrganizationId,
 		p.Name,
 		p.Fields,
-		p.Template)
+		p.Template,
+		p.Render,
+		p.Invoice,
+		p.Draft,
+		designType(p),
+		p.Form)
 	if err != nil {
 		return ErrUnableToSaveDesign
 	}
@@ -35,33 +69,41 @@ func (r *DesignRepository) Save(ctx context.Context, p Design) error {
 }
 
 func (r *DesignRepository) GetById(ctx context.Context, userId, designId string) (Design, error) {
-	var d Design
-	err := r.db.QueryRowContext(ctx, "SELECT id,name,user_id, fields, template FROM design WHERE user_id = $1 and id =$2 and deleted_at is NULL", userId, designId).
-		Scan(&d.Id, &d.UserId, &d.Name, &d.UserId, &d.Fields, &d.Template)
+	row := r.db.QueryRowContext(ctx, selectDesign+` WHERE d.id = $2 and d.deleted_at is NULL and `+visible, userId, designId)
+	d, err := scanDesign(row)
 	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return Design{}, ErrDesignNotFound
+		}
 		return Design{}, err
 	}
 
 	return d, nil
 }
 
-func (r *DesignRepository) Update(ctx context.Context, p Design) error {
-	_, err := r.db.ExecContext(ctx, "Update design set name=$2, fields=$3, template=$4, updated_at=$5 where id=$1",
+func (r *DesignRepository) Update(ctx context.Context, userId string, p Design) error {
+	res, err := r.db.ExecContext(ctx, "Update design set name=$3, fields=$4, template=$5, render_options=$6, invoice_mapping=$7, draft=$8, updated_at=$9, type=$10, form_pdf=$11 where id=$2 and deleted_at is NULL and "+editable,
+		userId,
 		p.Id,
 		p.Name,
 		p.Fields,
 		p.Template,
+		p.Render,
+		p.Invoice,
+		p.Draft,
 		p.UpdatedAt,
+		designType(p),
+		p.Form,
 	)
 	if err != nil {
 		return ErrUnableToSaveDesign
 	}
 
-	return nil
+	return affected(res)
 }
 
 func (r *DesignRepository) Delete(ctx context.Context, userId, designId string) error {
-	_, err := r.db.ExecContext(ctx, "Update design set deleted_at=$2 where user_id=$1 and id=$2",
+	res, err := r.db.ExecContext(ctx, "Update design set deleted_at=$3 where id=$2 and deleted_at is NULL and "+deletable,
 		userId,
 		designId,
 		time.Now().UTC(),
@@ -70,26 +112,58 @@ func (r *DesignRepository) Delete(ctx context.Context, userId, designId string)
 		return ErrUnableToSaveDesign
 	}
 
+	return affected(res)
+}
+
+func affected(res sql.Result) error {
+	n, err := res.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if n == 0 {
+		return ErrDesignNotFound
+	}
 	return nil
 }
 
 type ListQuery struct {
-	Query  string
-	UserId string
-	Limit  int64
-	Page   int64
+	Query          string
+	UserId         string
+	OrganizationId string
+	Limit          int64
+	Page           int64
+}
+
+// scope selects the personal designs of the user and the designs shared with
+// the user, or the designs of the organization when one is set and the user
+// is a member of it.
+func (lq ListQuery) scope() (string, []interface{}) {
+	if lq.OrganizationId != "" {
+		return "d.organization_id = $2 and m.user_id IS NOT NULL", []interface{}{lq.UserId, lq.OrganizationId}
+	}
+	return "((d.organization_id IS NULL and d.user_id = $1) OR s.id IS NOT NULL)", []interface{}{lq.UserId}
 }
 
 func (r *DesignRepository) ListByUserId(ctx context.Context, lq ListQuery) ([]Design, pagination.Pagination, error) {
-	query := `SELECT id, name, user_id, fields, template, created_at, updated_at 
-			FROM design 
-			WHERE user_id = $1 and deleted_at is NULL
-			Limit $2 Offset $3`
+	where, args := lq.scope()
+	return r.list(ctx, lq, "d.deleted_at is NULL and "+where, args)
+}
+
+func (r *DesignRepository) Search(ctx context.Context, lq ListQuery) ([]Design, pagination.Pagination, error) {
+	where, args := lq.scope()
+	args = append(args, lq.Query)
+	where = fmt.Sprintf("d.deleted_at is NULL and %s and LOWER(d.name) LIKE '%%' || LOWER($%d) || '%%'", where, len(args))
+	return r.list(ctx, lq, where, args)
+}
+
+func (r *DesignRepository) list(ctx context.Context, lq ListQuery, where string, args []interface{}) ([]Design, pagination.Pagination, error) {
+	query := fmt.Sprintf(`%s
+			WHERE %s
+			ORDER BY d.created_at DESC
+			Limit $%d Offset $%d`, selectDesign, where, len(args)+1, len(args)+2)
 
-	var rows *sql.Rows
-	var err error
 	offset := lq.Limit * (lq.Page - 1)
-	rows, err = r.db.QueryContext(ctx, query, lq.UserId, lq.Limit, offset)
+	rows, err := r.db.QueryContext(ctx, query, append(args, lq.Limit, offset)...)
 	if err != nil {
 		return nil, pagination.Pagination{}, err
 	}
@@ -97,21 +171,20 @@ func (r *DesignRepository) ListByUserId(ctx context.Context, lq ListQuery) ([]De
 
 	var ds []Design
 	for rows.Next() {
-		d := new(Design)
-		// works but I don't think it is good code for too many columns
-		err = rows.Scan(&d.Id, &d.Name, &d.UserId, &d.Fields, &d.Template, &d.CreatedAt, &d.UpdatedAt)
+		d, err := scanDesign(rows)
 		if err != nil {
 			return nil, pagination.Pagination{}, err
 		}
-		ds = append(ds, *d)
+		ds = append(ds, d)
+	}
+	if err = rows.Err(); err != nil {
+		return nil, pagination.Pagination{}, err
 	}
 
-	qCount := `SELECT count(id)
-	FROM design
-	WHERE user_id = $1 and deleted_at is NULL`
+	qCount := `SELECT count(d.id) ` + fromDesign + ` WHERE ` + where
 
 	var count int64
-	err = r.db.QueryRowContext(ctx, qCount, lq.UserId).Scan(&count)
+	err = r.db.QueryRowContext(ctx, qCount, args...).Scan(&count)
 	if err != nil {
 		return nil, pagination.Pagination{}, err
 	}
@@ -122,48 +195,45 @@ func (r *DesignRepository) ListByUserId(ctx context.Context, lq ListQuery) ([]De
 	}, nil
 }
 
-func (r *DesignRepository) Search(ctx context.Context, lq ListQuery) ([]Design, pagination.Pagination, error) {
-	query := `SELECT id, name, user_id, fields, template, created_at, updated_at
-			FROM design
-			WHERE user_id = $1
-			and  deleted_at is NULL
-			and LOWER(name) LIKE '%' || $2 || '%'
-			Limit $3 Offset $4`
-
-	var rows *sql.Rows
-	var err error
-	offset := lq.Limit * (lq.Page - 1)
-	rows, err = r.db.QueryContext(ctx, query, lq.UserId, lq.Query, lq.Limit, offset)
-	if err != nil {
-		return nil, pagination.Pagination{}, err
-	}
-	defer rows.Close()
+type scanner interface {
+	Scan(dest ...interface{}) error
+}
 
-	var ds []Design
-	for rows.Next() {
-		d := new(Design)
-		// works but I don't think it is good code for too many columns
-		err = rows.Scan(&d.Id, &d.Name, &d.UserId, &d.Fields, &d.Template, &d.CreatedAt, &d.UpdatedAt)
-		if err != nil {
-			return nil, pagination.Pagination{}, err
-		}
-		ds = append(ds, *d)
-	}
+func scanDesign(s scanner) (Design, error) {
+	var d Design
+	var owner bool
+	var role, share sql.NullString
+	err := s.Scan(&d.Id, &d.Name, &d.UserId, &d.OrganizationId, &d.Fields, &d.Type, &d.Template, &d.Form, &d.Render, &d.Invoice, &d.Draft, &d.CreatedAt, &d.UpdatedAt, &owner, &role, &share)
+	d.Access, d.Shared = resolveAccess(owner, role.String, Permission(share.String))
+	return d, err
+}
 
-	qCount := `SELECT count(id)
-	FROM design
-	WHERE user_id = $1
-	and  deleted_at is NULL
-	and LOWER(name) LIKE '%' || $2 || '%'
-	AND name like '%$2'`
+// resolveAccess gives the creator of a personal design owner access and
+// everybody else the stronger of their organization role and their share.
+// Shared is set when the access comes from the share.
+func resolveAccess(owner bool, role string, share Permission) (Access, bool) {
+	if owner {
+		return AccessOwner, false
+	}
+	var member Access
+	switch role {
+	case "owner":
+		member = AccessOwner
+	case "editor":
+		member = AccessEdit
+	case "viewer":
+		member = AccessGenerate
+	}
+	if shared := Access(share); shared.rank() > member.rank() {
+		return shared, true
+	}
+	return member, false
+}
 
-	var count int64
-	err = r.db.QueryRowContext(ctx, qCount, lq.UserId, lq.Query).Scan(&count)
-	if err != nil {
-		return nil, pagination.Pagination{}, err
+// designType stores designs without type as html designs.
+func designType(d Design) string {
+	if d.Type == "" {
+		return TypeHTML
 	}
-	return ds, pagination.Pagination{
-		Page:  lq.Page,
-		Total: count,
-	}, nil
+	return d.Type
 }
@@ -0,0 +1,164 @@
+package design
+
+import (
+	"errors"
+	"fmt"
+	"github.com/rengas/pdfgen/pkg/barcode"
+	"io"
+	"strings"
+	"testing"
+)
+
+func TestDesignAccess(t *testing.T) {
+	tests := []struct {
+		name         string
+		design       Design
+		wantEdit     bool
+		wantGenerate bool
+		wantManage   bool
+	}{
+		{name: "owner", design: Design{Access: AccessOwner}, wantEdit: true, wantGenerate: true, wantManage: true},
+		{name: "organization editor", design: Design{Access: AccessEdit}, wantEdit: true, wantGenerate: true, wantManage: true},
+		{name: "organization viewer", design: Design{Access: AccessGenerate}, wantGenerate: true},
+		{name: "shared for editing", design: Design{Access: AccessEdit, Shared: true}, wantEdit: true, wantGenerate: true},
+		{name: "shared for generating", design: Design{Access: AccessGenerate, Shared: true}, wantGenerate: true},
+		{name: "shared for reading", design: Design{Access: AccessRead, Shared: true}},
+	}
+
+	for _, tc := range tests {
+		if got := tc.design.Access.CanEdit(); got != tc.wantEdit {
+			t.Fatalf("%s: edit expected: %v, got: %v", tc.name, tc.wantEdit, got)
+		}
+		if got := tc.design.Access.CanGenerate(); got != tc.wantGenerate {
+			t.Fatalf("%s: generate expected: %v, got: %v", tc.name, tc.wantGenerate, got)
+		}
+		if got := tc.design.CanManage(); got != tc.wantManage {
+			t.Fatalf("%s: manage expected: %v, got: %v", tc.name, tc.wantManage, got)
+		}
+	}
+}
+
+func TestResolveAccess(t *testing.T) {
+	tests := []struct {
+		name       string
+		owner      bool
+		role       string
+		share      Permission
+		wantAccess Access
+		wantShared bool
+	}{
+		{name: "creator", owner: true, wantAccess: AccessOwner},
+		{name: "organization editor", role: "editor", wantAccess: AccessEdit},
+		{name: "shared for reading", share: PermissionRead, wantAccess: AccessRead, wantShared: true},
+		{name: "viewer shared for editing", role: "viewer", share: PermissionEdit, wantAccess: AccessEdit, wantShared: true},
+		{name: "editor shared for reading", role: "editor", share: PermissionRead, wantAccess: AccessEdit},
+		{name: "viewer shared for generating", role: "viewer", share: PermissionGenerate, wantAccess: AccessGenerate},
+	}
+
+	for _, tc := range tests {
+		access, shared := resolveAccess(tc.owner, tc.role, tc.share)
+		if access != tc.wantAccess || shared != tc.wantShared {
+			t.Fatalf("%s: expected: %v %v, got: %v %v", tc.name, tc.wantAccess, tc.wantShared, access, shared)
+		}
+	}
+}
+
+func TestExpand(t *testing.T) {
+	fields := Attrs{"employee": map[string]interface{}{"dob": "1990-01-31"}}
+
+	tests := []struct {
+		name    string
+		fields  *Attrs
+		text    string
+		want    string
+		wantErr error
+	}{
+		{name: "nested field", fields: &fields, text: "{{.employee.dob}}", want: "1990-01-31"},
+		{name: "no html escaping", fields: &Attrs{"pw": "a<b&c"}, text: "{{.pw}}", want: "a<b&c"},
+		{name: "plain text", text: "secret", want: "secret"},
+		{name: "missing field", fields: &fields, text: "{{.dob}}", wantErr: ErrUnableToMatchFields},
+		{name: "invalid template", text: "{{.dob", wantErr: ErrUnableToParseTemplate},
+	}
+
+	for _, tc := range tests {
+		got, err := Design{Fields: tc.fields}.Expand(tc.text)
+		if got != tc.want || err != tc.wantErr {
+			t.Fatalf("%s: expected: %v %v, got: %v %v", tc.name, tc.want, tc.wantErr, got, err)
+		}
+	}
+}
+
+func TestFormValues(t *testing.T) {
+	fields := Attrs{
+		"applicant": map[string]interface{}{"name": "Ada", "age": float64(36)},
+		"consent":   true,
+		"plan":      "pro",
+		"note":      nil,
+	}
+	expected := map[string]string{"applicant.age": "36", "applicant.name": "Ada", "consent": "true", "plan": "pro"}
+
+	got := Design{Fields: &fields}.FormValues()
+	if fmt.Sprint(got) != fmt.Sprint(expected) {
+		t.Fatalf("expected: %v, got: %v", expected, got)
+	}
+	if got := (Design{}).FormValues(); len(got) != 0 {
+		t.Fatalf("expected: %v, got: %v", "no values", got)
+	}
+	if _, err := (Design{Type: TypePDFForm}).HTML(); err != ErrNotHTML {
+		t.Fatalf("expected: %v, got: %v", ErrNotHTML, err)
+	}
+}
+
+func TestWithFields(t *testing.T) {
+	stored := Attrs{"employee": map[string]interface{}{"name": "Ada", "dob": "1990-01-31"}, "city": "London"}
+
+	tests := []struct {
+		name   string
+		stored *Attrs
+		fields Attrs
+		want   string
+	}{
+		{name: "no request fields", stored: &stored, want: "map[city:London employee:map[dob:1990-01-31 name:Ada]]"},
+		{name: "request fields win", stored: &stored, fields: Attrs{"city": "Paris"}, want: "map[city:Paris employee:map[dob:1990-01-31 name:Ada]]"},
+		{name: "objects merge", stored: &stored, fields: Attrs{"employee": map[string]interface{}{"dob": "1991-02-28"}}, want: "map[city:London employee:map[dob:1991-02-28 name:Ada]]"},
+		{name: "no stored fields", fields: Attrs{"city": "Paris"}, want: "map[city:Paris]"},
+	}
+
+	for _, tc := range tests {
+		got := Design{Fields: tc.stored}.WithFields(tc.fields)
+		if fmt.Sprint(*got.Fields) != tc.want {
+			t.Fatalf("%s: expected: %v, got: %v", tc.name, tc.want, *got.Fields)
+		}
+	}
+	if fmt.Sprint(stored) != "map[city:London employee:map[dob:1990-01-31 name:Ada]]" {
+		t.Fatalf("expected: %v, got: %v", "stored fields unchanged", stored)
+	}
+}
+
+func TestHTMLBarcodes(t *testing.T) {
+	tests := []struct {
+		name     string
+		template string
+		want     string
+		wantErr  error
+	}{
+		{name: "qrcode", template: `<p>{{qrcode .url "size=20"}}</p>`, want: `<p><svg xmlns="http://www.w3.org/2000/svg" width="20mm" height="20mm"`},
+		{name: "barcode error", template: `{{ean13 .gtin}}`, wantErr: barcode.ErrChecksum},
+		{name: "missing function", template: `{{aztec .url}}`, wantErr: ErrUnableToParseTemplate},
+	}
+	fields := Attrs{"url": "https://example.com", "gtin": "4006381333932"}
+
+	for _, tc := range tests {
+		html, err := Design{Template: tc.template, Fields: &fields}.HTML()
+		if !errors.Is(err, tc.wantErr) {
+			t.Fatalf("%s: expected: %v, got: %v", tc.name, tc.wantErr, err)
+		}
+		if err != nil {
+			continue
+		}
+		b, _ := io.ReadAll(html)
+		if !strings.HasPrefix(string(b), tc.want) {
+			t.Fatalf("%s: expected: %s, got: %s", tc.name, tc.want, b)
+		}
+	}
+}
@@ -0,0 +1,31 @@
+package design
+
+import "time"
+
+// Permission granted by a share, it is the Access the invitee gets once the
+// invitation is accepted.
+type Permission string
+
+const (
+	PermissionRead     Permission = "read"
+	PermissionGenerate Permission = "generate"
+	PermissionEdit     Permission = "edit"
+)
+
+func (p Permission) Valid() bool {
+	return p == PermissionRead || p == PermissionGenerate || p == PermissionEdit
+}
+
+// Share grants a single user access to a design. It is addressed to an email
+// and bound to the user that accepts it.
+type Share struct {
+	Id         string     `json:"id"`
+	DesignId   string     `json:"designId"`
+	DesignName string     `json:"designName,omitempty"`
+	Email      string     `json:"email"`
+	UserId     *string    `json:"userId,omitempty"`
+	Permission Permission `json:"permission"`
+	InvitedBy  string     `json:"invitedBy"`
+	CreatedAt  time.Time  `json:"createdAt"`
+	AcceptedAt *time.Time `json:"acceptedAt,omitempty"`
+}
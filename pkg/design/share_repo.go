@@ -0,0 +1,125 @@
+package design
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"github.com/lib/pq"
+	"time"
+)
+
+var (
+	ErrShareNotFound = errors.New("share not found")
+	ErrShareExists   = errors.New("design is already shared with this user")
+)
+
+// uniqueViolation is the postgres error code of a unique constraint violation.
+const uniqueViolation = "23505"
+
+type ShareRepository struct {
+	db *sql.DB
+}
+
+func NewShareRepository(db *sql.DB) *ShareRepository {
+	return &ShareRepository{
+		db: db,
+	}
+}
+
+// Save creates an invitation, a design can only have one active share per email.
+func (r *ShareRepository) Save(ctx context.Context, s Share) error {
+	q := `INSERT INTO design_share(id, design_id, email, permission, invited_by, created_at)
+		  values($1, $2, $3, $4, $5, $6)
+		  ON CONFLICT DO NOTHING`
+	res, err := r.db.ExecContext(ctx, q, s.Id, s.DesignId, s.Email, s.Permission, s.InvitedBy, s.CreatedAt)
+	if err != nil {
+		return err
+	}
+	n, err := res.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if n == 0 {
+		return ErrShareExists
+	}
+	return nil
+}
+
+// ListByDesignId returns the active shares and pending invitations of a design.
+func (r *ShareRepository) ListByDesignId(ctx context.Context, designId string) ([]Share, error) {
+	q := `SELECT s.id, s.design_id, d.name, s.email, s.user_id, s.permission, s.invited_by, s.created_at, s.accepted_at
+		  FROM design_share s
+		  JOIN design d ON d.id = s.design_id
+		  WHERE s.design_id = $1 AND s.revoked_at IS NULL
+		  ORDER BY s.created_at`
+	return r.list(ctx, q, designId)
+}
+
+// ListPending returns the invitations addressed to an email that are not
+// accepted yet.
+func (r *ShareRepository) ListPending(ctx context.Context, email string) ([]Share, error) {
+	q := `SELECT s.id, s.design_id, d.name, s.email, s.user_id, s.permission, s.invited_by, s.created_at, s.accepted_at
+		  FROM design_share s
+		  JOIN design d ON d.id = s.design_id
+		  WHERE LOWER(s.email) = LOWER($1) AND s.accepted_at IS NULL AND s.revoked_at IS NULL AND d.deleted_at IS NULL
+		  ORDER BY s.created_at`
+	return r.list(ctx, q, email)
+}
+
+func (r *ShareRepository) list(ctx context.Context, q string, args ...interface{}) ([]Share, error) {
+	rows, err := r.db.QueryContext(ctx, q, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	ss := []Share{}
+	for rows.Next() {
+		var s Share
+		err = rows.Scan(&s.Id, &s.DesignId, &s.DesignName, &s.Email, &s.UserId, &s.Permission, &s.InvitedBy, &s.CreatedAt, &s.AcceptedAt)
+		if err != nil {
+			return nil, err
+		}
+		ss = append(ss, s)
+	}
+	return ss, rows.Err()
+}
+
+// Accept binds a pending invitation to the user, only the user the
+// invitation was addressed to can accept it.
+func (r *ShareRepository) Accept(ctx context.Context, shareId, userId, email string, at time.Time) (Share, error) {
+	var s Share
+	q := `UPDATE design_share SET user_id=$2, accepted_at=$4
+		  WHERE id=$1 AND LOWER(email)=LOWER($3) AND accepted_at IS NULL AND revoked_at IS NULL
+		  RETURNING id, design_id, email, user_id, permission, invited_by, created_at, accepted_at`
+	err := r.db.QueryRowContext(ctx, q, shareId, userId, email, at).
+		Scan(&s.Id, &s.DesignId, &s.Email, &s.UserId, &s.Permission, &s.InvitedBy, &s.CreatedAt, &s.AcceptedAt)
+	if err != nil {
+		var pqErr *pq.Error
+		if errors.As(err, &pqErr) && pqErr.Code == uniqueViolation {
+			return Share{}, ErrShareExists
+		}
+		if errors.Is(err, sql.ErrNoRows) {
+			return Share{}, ErrShareNotFound
+		}
+		return Share{}, err
+	}
+	return s, nil
+}
+
+// Revoke ends a share or withdraws a pending invitation.
+func (r *ShareRepository) Revoke(ctx context.Context, designId, shareId string, at time.Time) error {
+	res, err := r.db.ExecContext(ctx, `UPDATE design_share SET revoked_at=$3 WHERE id=$2 AND design_id=$1 AND revoked_at IS NULL`,
+		designId, shareId, at)
+	if err != nil {
+		return err
+	}
+	n, err := res.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if n == 0 {
+		return ErrShareNotFound
+	}
+	return nil
+}
@@ -4,6 +4,12 @@ const (
 	ErrUnableToGetUserIdFromContext ValidationError = "unable to get userId from context"
 	ErrNotAdminUser                 ValidationError = "not an admin user"
 	ErrAdminUserNotFound            ValidationError = "admin user not found"
+	ErrNotOrganizationMember        ValidationError = "not a member of the organization"
+	ErrOrganizationIdInvalid        ValidationError = "organization id must be a uuid"
+	ErrRateLimited                  ValidationError = "rate limit exceeded"
+	ErrIdempotencyKeyInvalid        ValidationError = "Idempotency-Key must be at most 255 characters"
+	ErrIdempotencyKeyReused         ValidationError = "Idempotency-Key was already used for a different request"
+	ErrIdempotencyKeyInProgress     ValidationError = "a request with this Idempotency-Key is still in progress"
 )
 
 type ValidationError string
@@ -0,0 +1,310 @@
+package facturx
+
+import (
+	"encoding/xml"
+	"math/big"
+	"strconv"
+	"strings"
+)
+
+// invoice holds the values read from the fields, amounts are exact.
+type invoice struct {
+	profile        string
+	number         string
+	typeCode       string
+	issued         string
+	due            string
+	currency       string
+	buyerReference string
+	seller, buyer  party
+	lines          []line
+	// totals of invoices without lines
+	basis, taxTotal *big.Rat
+	headerTax       *tax
+}
+
+type party struct {
+	name, vatId, street, postCode, city, country string
+}
+
+type line struct {
+	name            string
+	quantity, price *big.Rat
+	unit            string
+	tax             tax
+}
+
+type tax struct {
+	rate     *big.Rat
+	category string
+}
+
+// round returns r rounded to cents, halves away from zero.
+func round(r *big.Rat) *big.Rat {
+	n, _ := new(big.Rat).SetString(r.FloatString(2))
+	return n
+}
+
+func amount(r *big.Rat) string {
+	return r.FloatString(2)
+}
+
+// decimal formats quantities and rates without trailing zeros.
+func decimal(r *big.Rat) string {
+	s := r.FloatString(4)
+	s = strings.TrimRight(s, "0")
+	return strings.TrimSuffix(s, ".")
+}
+
+// breakdown is the tax of one category and rate.
+type breakdown struct {
+	tax
+	basis *big.Rat
+}
+
+// taxes sums the lines by category and rate in the order they first
+// appear, or returns the tax of an invoice without lines.
+func (inv invoice) taxes() []breakdown {
+	if inv.lines == nil {
+		if inv.headerTax == nil {
+			return nil
+		}
+		return []breakdown{{tax: *inv.headerTax, basis: inv.basis}}
+	}
+	var out []breakdown
+	for _, l := range inv.lines {
+		i := 0
+		for i < len(out) && (out[i].category != l.tax.category || out[i].rate.Cmp(l.tax.rate) != 0) {
+			i++
+		}
+		if i == len(out) {
+			out = append(out, breakdown{tax: l.tax, basis: new(big.Rat)})
+		}
+		out[i].basis.Add(out[i].basis, l.total())
+	}
+	return out
+}
+
+func (l line) total() *big.Rat {
+	return round(new(big.Rat).Mul(l.quantity, l.price))
+}
+
+func (b breakdown) amount() *big.Rat {
+	return round(new(big.Rat).Quo(new(big.Rat).Mul(b.basis, b.rate), big.NewRat(100, 1)))
+}
+
+func (inv invoice) xml() ([]byte, error) {
+	minimum := inv.profile == ProfileMinimum
+	doc := ciiInvoice{
+		RSM: "urn:un:unece:uncefact:data:standard:CrossIndustryInvoice:100",
+		RAM: "urn:un:unece:uncefact:data:standard:ReusableAggregateBusinessInformationEntity:100",
+		UDT: "urn:un:unece:uncefact:data:standard:UnqualifiedDataType:100",
+		QDT: "urn:un:unece:uncefact:data:standard:QualifiedDataType:100",
+	}
+	doc.Context.Guideline.ID = guidelines[inv.profile]
+	doc.Document.ID = inv.number
+	doc.Document.TypeCode = inv.typeCode
+	doc.Document.IssueDate = ciiDate{Format: "102", Value: inv.issued}
+
+	tr := &doc.Transaction
+	lineTotal := new(big.Rat)
+	for i, l := range inv.lines {
+		total := l.total()
+		lineTotal.Add(lineTotal, total)
+		if !hasLines(inv.profile) {
+			continue
+		}
+		item := ciiLine{}
+		item.Document.LineID = strconv.Itoa(i + 1)
+		item.Product.Name = l.name
+		item.Agreement.NetPrice.ChargeAmount = decimal(l.price)
+		item.Delivery.BilledQuantity = ciiQuantity{UnitCode: l.unit, Value: decimal(l.quantity)}
+		item.Settlement.Tax = ciiLineTax{TypeCode: "VAT", CategoryCode: l.tax.category, Rate: decimal(l.tax.rate)}
+		item.Settlement.Summation.LineTotalAmount = amount(total)
+		tr.Lines = append(tr.Lines, item)
+	}
+
+	tr.Agreement.BuyerReference = inv.buyerReference
+	tr.Agreement.Seller = inv.seller.cii(minimum, true)
+	tr.Agreement.Buyer = inv.buyer.cii(minimum, false)
+
+	st := &tr.Settlement
+	st.Currency = inv.currency
+	basis, taxTotal := inv.basis, inv.taxTotal
+	if inv.lines != nil {
+		basis, taxTotal = lineTotal, new(big.Rat)
+	}
+	for _, b := range inv.taxes() {
+		calculated := b.amount()
+		if inv.lines == nil {
+			calculated = taxTotal
+		} else {
+			taxTotal.Add(taxTotal, calculated)
+		}
+		if minimum {
+			continue
+		}
+		st.Taxes = append(st.Taxes, ciiTax{
+			CalculatedAmount: amount(calculated),
+			TypeCode:         "VAT",
+			BasisAmount:      amount(b.basis),
+			CategoryCode:     b.category,
+			Rate:             decimal(b.rate),
+		})
+	}
+	if inv.due != "" && !minimum {
+		st.Terms = &ciiTerms{DueDate: ciiDate{Format: "102", Value: inv.due}}
+	}
+	grand := new(big.Rat).Add(basis, taxTotal)
+	sum := &st.Summation
+	if !minimum {
+		sum.LineTotalAmount = amount(basis)
+	}
+	sum.TaxBasisTotalAmount = amount(basis)
+	sum.TaxTotalAmount = ciiAmount{CurrencyID: inv.currency, Value: amount(taxTotal)}
+	sum.GrandTotalAmount = amount(grand)
+	sum.DuePayableAmount = amount(grand)
+
+	out, err := xml.MarshalIndent(doc, "", "  ")
+	if err != nil {
+		return nil, err
+	}
+	return append([]byte(xml.Header), out...), nil
+}
+
+// cii returns the trade party, parties of MINIMUM invoices only have the
+// country of the seller as address.
+func (p party) cii(minimum, seller bool) ciiParty {
+	out := ciiParty{Name: p.name}
+	switch {
+	case minimum && seller:
+		out.Address = &ciiAddress{CountryID: p.country}
+	case !minimum && (p.country != "" || p.city != "" || p.street != "" || p.postCode != ""):
+		out.Address = &ciiAddress{PostcodeCode: p.postCode, LineOne: p.street, CityName: p.city, CountryID: p.country}
+	}
+	if p.vatId != "" && (seller || !minimum) {
+		out.TaxRegistration = &ciiTaxRegistration{ID: ciiID{SchemeID: "VA", Value: p.vatId}}
+	}
+	return out
+}
+
+// The elements of the Cross Industry Invoice, in the order of the schema.
+
+type ciiInvoice struct {
+	XMLName xml.Name `xml:"rsm:CrossIndustryInvoice"`
+	RSM     string   `xml:"xmlns:rsm,attr"`
+	QDT     string   `xml:"xmlns:qdt,attr"`
+	RAM     string   `xml:"xmlns:ram,attr"`
+	UDT     string   `xml:"xmlns:udt,attr"`
+	Context struct {
+		Guideline struct {
+			ID string `xml:"ram:ID"`
+		} `xml:"ram:GuidelineSpecifiedDocumentContextParameter"`
+	} `xml:"rsm:ExchangedDocumentContext"`
+	Document struct {
+		ID        string  `xml:"ram:ID"`
+		TypeCode  string  `xml:"ram:TypeCode"`
+		IssueDate ciiDate `xml:"ram:IssueDateTime>udt:DateTimeString"`
+	} `xml:"rsm:ExchangedDocument"`
+	Transaction ciiTransaction `xml:"rsm:SupplyChainTradeTransaction"`
+}
+
+type ciiTransaction struct {
+	Lines     []ciiLine `xml:"ram:IncludedSupplyChainTradeLineItem"`
+	Agreement struct {
+		BuyerReference string   `xml:"ram:BuyerReference,omitempty"`
+		Seller         ciiParty `xml:"ram:SellerTradeParty"`
+		Buyer          ciiParty `xml:"ram:BuyerTradeParty"`
+	} `xml:"ram:ApplicableHeaderTradeAgreement"`
+	Delivery   struct{} `xml:"ram:ApplicableHeaderTradeDelivery"`
+	Settlement struct {
+		Currency  string    `xml:"ram:InvoiceCurrencyCode"`
+		Taxes     []ciiTax  `xml:"ram:ApplicableTradeTax"`
+		Terms     *ciiTerms `xml:"ram:SpecifiedTradePaymentTerms"`
+		Summation struct {
+			LineTotalAmount     string    `xml:"ram:LineTotalAmount,omitempty"`
+			TaxBasisTotalAmount string    `xml:"ram:TaxBasisTotalAmount"`
+			TaxTotalAmount      ciiAmount `xml:"ram:TaxTotalAmount"`
+			GrandTotalAmount    string    `xml:"ram:GrandTotalAmount"`
+			DuePayableAmount    string    `xml:"ram:DuePayableAmount"`
+		} `xml:"ram:SpecifiedTradeSettlementHeaderMonetarySummation"`
+	} `xml:"ram:ApplicableHeaderTradeSettlement"`
+}
+
+type ciiLine struct {
+	Document struct {
+		LineID string `xml:"ram:LineID"`
+	} `xml:"ram:AssociatedDocumentLineDocument"`
+	Product struct {
+		Name string `xml:"ram:Name"`
+	} `xml:"ram:SpecifiedTradeProduct"`
+	Agreement struct {
+		NetPrice struct {
+			ChargeAmount string `xml:"ram:ChargeAmount"`
+		} `xml:"ram:NetPriceProductTradePrice"`
+	} `xml:"ram:SpecifiedLineTradeAgreement"`
+	Delivery struct {
+		BilledQuantity ciiQuantity `xml:"ram:BilledQuantity"`
+	} `xml:"ram:SpecifiedLineTradeDelivery"`
+	Settlement struct {
+		Tax       ciiLineTax `xml:"ram:ApplicableTradeTax"`
+		Summation struct {
+			LineTotalAmount string `xml:"ram:LineTotalAmount"`
+		} `xml:"ram:SpecifiedTradeSettlementLineMonetarySummation"`
+	} `xml:"ram:SpecifiedLineTradeSettlement"`
+}
+
+type ciiParty struct {
+	Name            string              `xml:"ram:Name"`
+	Address         *ciiAddress         `xml:"ram:PostalTradeAddress"`
+	TaxRegistration *ciiTaxRegistration `xml:"ram:SpecifiedTaxRegistration"`
+}
+
+type ciiAddress struct {
+	PostcodeCode string `xml:"ram:PostcodeCode,omitempty"`
+	LineOne      string `xml:"ram:LineOne,omitempty"`
+	CityName     string `xml:"ram:CityName,omitempty"`
+	CountryID    string `xml:"ram:CountryID"`
+}
+
+type ciiTaxRegistration struct {
+	ID ciiID `xml:"ram:ID"`
+}
+
+type ciiID struct {
+	SchemeID string `xml:"schemeID,attr"`
+	Value    string `xml:",chardata"`
+}
+
+type ciiTax struct {
+	CalculatedAmount string `xml:"ram:CalculatedAmount"`
+	TypeCode         string `xml:"ram:TypeCode"`
+	BasisAmount      string `xml:"ram:BasisAmount"`
+	CategoryCode     string `xml:"ram:CategoryCode"`
+	Rate             string `xml:"ram:RateApplicablePercent"`
+}
+
+type ciiLineTax struct {
+	TypeCode     string `xml:"ram:TypeCode"`
+	CategoryCode string `xml:"ram:CategoryCode"`
+	Rate         string `xml:"ram:RateApplicablePercent"`
+}
+
+type ciiTerms struct {
+	DueDate ciiDate `xml:"ram:DueDateDateTime>udt:DateTimeString"`
+}
+
+type ciiDate struct {
+	Format string `xml:"format,attr"`
+	Value  string `xml:",chardata"`
+}
+
+type ciiQuantity struct {
+	UnitCode string `xml:"unitCode,attr"`
+	Value    string `xml:",chardata"`
+}
+
+type ciiAmount struct {
+	CurrencyID string `xml:"currencyID,attr"`
+	Value      string `xml:",chardata"`
+}
@@ -0,0 +1,306 @@
+// Package facturx builds Factur-X / ZUGFeRD invoices, the Cross Industry
+// Invoice XML of EN 16931, from the fields of a design.
+package facturx
+
+import (
+	"database/sql/driver"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math/big"
+	"strings"
+	"text/template"
+	"time"
+)
+
+// Profiles of Factur-X, named as in the XMP metadata of the PDF. MINIMUM and
+// BASIC WL only carry the totals, BASIC and EN 16931 also the lines.
+const (
+	ProfileMinimum = "MINIMUM"
+	ProfileBasicWL = "BASIC WL"
+	ProfileBasic   = "BASIC"
+	ProfileEN16931 = "EN 16931"
+)
+
+// FileName is the name the invoice must be embedded with.
+const FileName = "factur-x.xml"
+
+var (
+	ErrProfile       = errors.New("profile must be one of MINIMUM, BASIC WL, BASIC or EN 16931")
+	ErrTemplate      = errors.New("invoice mapping has an invalid template")
+	ErrItemsRequired = errors.New("profiles BASIC and EN 16931 need the items of the invoice")
+)
+
+// guidelines identify the profile in the invoice.
+var guidelines = map[string]string{
+	ProfileMinimum: "urn:factur-x.eu:1p0:minimum",
+	ProfileBasicWL: "urn:factur-x.eu:1p0:basicwl",
+	ProfileBasic:   "urn:cen.eu:en16931:2017#compliant#urn:factur-x.eu:1p0:basic",
+	ProfileEN16931: "urn:cen.eu:en16931:2017",
+}
+
+// Mapping declares how the fields of a design make an invoice. Values are
+// templates executed with the fields like {{.invoice.number}}, those of Item
+// with each element of the list Items names, e.g. {{.price}}. Dates are
+// 2006-01-02 or 20060102, amounts and rates decimal numbers.
+type Mapping struct {
+	Profile string `json:"profile" example:"EN 16931"`
+	Number  string `json:"number" example:"{{.invoice.number}}"`
+	// TypeCode is 380 for invoices when empty, 381 for credit notes.
+	TypeCode       string `json:"typeCode,omitempty" example:"380"`
+	IssueDate      string `json:"issueDate" example:"{{.invoice.date}}"`
+	DueDate        string `json:"dueDate,omitempty" example:"{{.invoice.due}}"`
+	Currency       string `json:"currency" example:"EUR"`
+	BuyerReference string `json:"buyerReference,omitempty"`
+	Seller         Party  `json:"seller"`
+	Buyer          Party  `json:"buyer"`
+	// Items is the path of the list of lines in the fields, e.g.
+	// invoice.items. Totals and taxes are calculated from the lines.
+	Items string `json:"items,omitempty" example:"invoice.items"`
+	Item  Line   `json:"item"`
+	// Totals of invoices without items, taxed at one rate.
+	TaxBasisTotal string `json:"taxBasisTotal,omitempty" example:"{{.invoice.net}}"`
+	TaxTotal      string `json:"taxTotal,omitempty" example:"{{.invoice.vat}}"`
+	TaxRate       string `json:"taxRate,omitempty" example:"20"`
+	TaxCategory   string `json:"taxCategory,omitempty" example:"S"`
+}
+
+type Party struct {
+	Name     string `json:"name"`
+	VATId    string `json:"vatId,omitempty"`
+	Street   string `json:"street,omitempty"`
+	PostCode string `json:"postCode,omitempty"`
+	City     string `json:"city,omitempty"`
+	// Country is the ISO 3166-1 alpha-2 code.
+	Country string `json:"country,omitempty" example:"FR"`
+}
+
+type Line struct {
+	Name     string `json:"name" example:"{{.name}}"`
+	Quantity string `json:"quantity" example:"{{.qty}}"`
+	// UnitCode is a UN/ECE Recommendation 20 code, C62 (one) when empty.
+	UnitCode string `json:"unitCode,omitempty" example:"C62"`
+	NetPrice string `json:"netPrice" example:"{{.price}}"`
+	VATRate  string `json:"vatRate" example:"20"`
+	// VATCategory is S (standard rate) when empty.
+	VATCategory string `json:"vatCategory,omitempty" example:"S"`
+}
+
+// templates returns the templates of the mapping by the name errors report.
+func (m Mapping) templates() map[string]string {
+	return map[string]string{
+		"number": m.Number, "typeCode": m.TypeCode, "issueDate": m.IssueDate, "dueDate": m.DueDate,
+		"currency": m.Currency, "buyerReference": m.BuyerReference,
+		"seller.name": m.Seller.Name, "seller.vatId": m.Seller.VATId, "seller.street": m.Seller.Street,
+		"seller.postCode": m.Seller.PostCode, "seller.city": m.Seller.City, "seller.country": m.Seller.Country,
+		"buyer.name": m.Buyer.Name, "buyer.vatId": m.Buyer.VATId, "buyer.street": m.Buyer.Street,
+		"buyer.postCode": m.Buyer.PostCode, "buyer.city": m.Buyer.City, "buyer.country": m.Buyer.Country,
+		"item.name": m.Item.Name, "item.quantity": m.Item.Quantity, "item.unitCode": m.Item.UnitCode,
+		"item.netPrice": m.Item.NetPrice, "item.vatRate": m.Item.VATRate, "item.vatCategory": m.Item.VATCategory,
+		"taxBasisTotal": m.TaxBasisTotal, "taxTotal": m.TaxTotal, "taxRate": m.TaxRate, "taxCategory": m.TaxCategory,
+	}
+}
+
+func (m Mapping) Validate() error {
+	if _, ok := guidelines[m.Profile]; !ok {
+		return ErrProfile
+	}
+	if m.Items == "" && hasLines(m.Profile) {
+		return ErrItemsRequired
+	}
+	for _, text := range m.templates() {
+		if _, err := parse(text); err != nil {
+			return ErrTemplate
+		}
+	}
+	return nil
+}
+
+// hasLines reports whether invoices of the profile list their lines.
+func hasLines(profile string) bool {
+	return profile == ProfileBasic || profile == ProfileEN16931
+}
+
+func (m Mapping) Value() (driver.Value, error) {
+	return json.Marshal(m)
+}
+
+func (m *Mapping) Scan(value interface{}) error {
+	b, ok := value.([]byte)
+	if !ok {
+		return errors.New("type assertion to []byte failed")
+	}
+
+	return json.Unmarshal(b, m)
+}
+
+// FieldError is a value of the invoice that could not be read from the
+// fields.
+type FieldError struct {
+	Field  string
+	Reason string
+}
+
+func (e *FieldError) Error() string {
+	return fmt.Sprintf("invoice %s %s", e.Field, e.Reason)
+}
+
+func parse(text string) (*template.Template, error) {
+	return template.New("invoice").Option("missingkey=error").Parse(text)
+}
+
+// values executes the templates of a mapping, the first error is kept.
+type values struct {
+	err error
+}
+
+func (v *values) text(field, text string, data interface{}) string {
+	if v.err != nil || text == "" {
+		return ""
+	}
+	tl, err := parse(text)
+	if err != nil {
+		v.err = &FieldError{Field: field, Reason: "has an invalid template"}
+		return ""
+	}
+	var buf strings.Builder
+	if err := tl.Execute(&buf, data); err != nil {
+		v.err = &FieldError{Field: field, Reason: "does not match the fields"}
+		return ""
+	}
+	return strings.TrimSpace(buf.String())
+}
+
+func (v *values) required(field, text string, data interface{}) string {
+	s := v.text(field, text, data)
+	if v.err == nil && s == "" {
+		v.err = &FieldError{Field: field, Reason: "is empty"}
+	}
+	return s
+}
+
+func (v *values) number(field, text string, data interface{}) *big.Rat {
+	s := v.required(field, text, data)
+	if v.err != nil {
+		return new(big.Rat)
+	}
+	n, ok := new(big.Rat).SetString(s)
+	if !ok {
+		v.err = &FieldError{Field: field, Reason: "is not a number: " + s}
+		return new(big.Rat)
+	}
+	return n
+}
+
+func (v *values) date(field, text string, data interface{}, required bool) string {
+	s := v.text(field, text, data)
+	if v.err != nil || (s == "" && !required) {
+		return ""
+	}
+	for _, layout := range []string{"2006-01-02", "20060102"} {
+		if t, err := time.Parse(layout, s); err == nil {
+			return t.Format("20060102")
+		}
+	}
+	v.err = &FieldError{Field: field, Reason: "is not a date like 2006-01-02: " + s}
+	return ""
+}
+
+// lookup returns the value of a dotted path in the fields.
+func lookup(fields map[string]interface{}, path string) (interface{}, bool) {
+	var v interface{} = fields
+	for _, k := range strings.Split(path, ".") {
+		m, ok := v.(map[string]interface{})
+		if !ok {
+			return nil, false
+		}
+		if v, ok = m[k]; !ok {
+			return nil, false
+		}
+	}
+	return v, true
+}
+
+// Build returns the invoice XML the mapping makes of the fields. Values that
+// are missing or malformed are returned as *FieldError.
+func Build(m Mapping, fields map[string]interface{}) ([]byte, error) {
+	if err := m.Validate(); err != nil {
+		return nil, err
+	}
+	v := &values{}
+	inv := invoice{profile: m.Profile}
+	inv.number = v.required("number", m.Number, fields)
+	inv.typeCode = v.text("typeCode", m.TypeCode, fields)
+	if inv.typeCode == "" {
+		inv.typeCode = "380"
+	}
+	inv.issued = v.date("issueDate", m.IssueDate, fields, true)
+	inv.due = v.date("dueDate", m.DueDate, fields, false)
+	inv.currency = v.required("currency", m.Currency, fields)
+	inv.buyerReference = v.text("buyerReference", m.BuyerReference, fields)
+	inv.seller = v.party("seller", m.Seller, fields)
+	inv.buyer = v.party("buyer", m.Buyer, fields)
+	if v.err == nil && inv.seller.country == "" {
+		v.err = &FieldError{Field: "seller.country", Reason: "is empty"}
+	}
+	if v.err == nil && inv.buyer.country == "" && m.Profile != ProfileMinimum {
+		v.err = &FieldError{Field: "buyer.country", Reason: "is empty"}
+	}
+
+	if m.Items != "" {
+		list, ok := lookup(fields, m.Items)
+		items, _ := list.([]interface{})
+		if !ok || (list != nil && items == nil) {
+			return nil, &FieldError{Field: "items", Reason: "is not a list in the fields"}
+		}
+		for i, item := range items {
+			l := line{
+				name:     v.required(fmt.Sprintf("item %d name", i+1), m.Item.Name, item),
+				quantity: v.number(fmt.Sprintf("item %d quantity", i+1), m.Item.Quantity, item),
+				unit:     v.text(fmt.Sprintf("item %d unitCode", i+1), m.Item.UnitCode, item),
+				price:    v.number(fmt.Sprintf("item %d netPrice", i+1), m.Item.NetPrice, item),
+				tax: tax{
+					rate:     v.number(fmt.Sprintf("item %d vatRate", i+1), m.Item.VATRate, item),
+					category: v.text(fmt.Sprintf("item %d vatCategory", i+1), m.Item.VATCategory, item),
+				},
+			}
+			if l.unit == "" {
+				l.unit = "C62"
+			}
+			if l.tax.category == "" {
+				l.tax.category = "S"
+			}
+			inv.lines = append(inv.lines, l)
+		}
+		if v.err == nil && len(inv.lines) == 0 {
+			v.err = &FieldError{Field: "items", Reason: "is empty"}
+		}
+	} else {
+		inv.basis = v.number("taxBasisTotal", m.TaxBasisTotal, fields)
+		inv.taxTotal = v.number("taxTotal", m.TaxTotal, fields)
+		if m.Profile == ProfileBasicWL {
+			inv.headerTax = &tax{
+				rate:     v.number("taxRate", m.TaxRate, fields),
+				category: v.text("taxCategory", m.TaxCategory, fields),
+			}
+			if inv.headerTax.category == "" {
+				inv.headerTax.category = "S"
+			}
+		}
+	}
+	if v.err != nil {
+		return nil, v.err
+	}
+	return inv.xml()
+}
+
+func (v *values) party(name string, p Party, fields map[string]interface{}) party {
+	return party{
+		name:     v.required(name+".name", p.Name, fields),
+		vatId:    v.text(name+".vatId", p.VATId, fields),
+		street:   v.text(name+".street", p.Street, fields),
+		postCode: v.text(name+".postCode", p.PostCode, fields),
+		city:     v.text(name+".city", p.City, fields),
+		country:  strings.ToUpper(v.text(name+".country", p.Country, fields)),
+	}
+}
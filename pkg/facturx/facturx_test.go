@@ -0,0 +1,172 @@
+package facturx
+
+import (
+	"bytes"
+	"encoding/json"
+	"encoding/xml"
+	"errors"
+	"io"
+	"strings"
+	"testing"
+)
+
+const fieldsJSON = `{
+	"invoice": {"number": "F-2024-07", "date": "2024-01-31", "due": "20240229", "net": "100", "vat": "20"},
+	"seller": {"name": "Acme SARL", "vat": "FR32123456789", "city": "Lyon", "zip": "69001", "country": "fr"},
+	"customer": {"name": "Globex & Co", "country": "DE"},
+	"items": [
+		{"name": "Consulting", "qty": 2, "price": 100.125, "rate": 20},
+		{"name": "Hosting", "qty": 1, "price": "49.90", "rate": "20"},
+		{"name": "Book", "qty": 3, "price": "10", "rate": "5.5"}
+	]
+}`
+
+func testFields(t *testing.T) map[string]interface{} {
+	var fields map[string]interface{}
+	if err := json.Unmarshal([]byte(fieldsJSON), &fields); err != nil {
+		t.Fatal(err)
+	}
+	return fields
+}
+
+func testMapping(profile string) Mapping {
+	m := Mapping{
+		Profile:   profile,
+		Number:    "{{.invoice.number}}",
+		IssueDate: "{{.invoice.date}}",
+		DueDate:   "{{.invoice.due}}",
+		Currency:  "EUR",
+		Seller:    Party{Name: "{{.seller.name}}", VATId: "{{.seller.vat}}", City: "{{.seller.city}}", PostCode: "{{.seller.zip}}", Country: "{{.seller.country}}"},
+		Buyer:     Party{Name: "{{.customer.name}}", Country: "{{.customer.country}}"},
+	}
+	if hasLines(profile) {
+		m.Items = "items"
+		m.Item = Line{Name: "{{.name}}", Quantity: "{{.qty}}", NetPrice: "{{.price}}", VATRate: "{{.rate}}"}
+		return m
+	}
+	m.TaxBasisTotal = "{{.invoice.net}}"
+	m.TaxTotal = "{{.invoice.vat}}"
+	m.TaxRate = "20"
+	return m
+}
+
+// elements returns the text of the elements of the XML by their local name,
+// it fails for XML that is not well formed.
+func elements(t *testing.T, b []byte) map[string][]string {
+	out := map[string][]string{}
+	d := xml.NewDecoder(bytes.NewReader(b))
+	var name string
+	for {
+		tok, err := d.Token()
+		if err == io.EOF {
+			return out
+		}
+		if err != nil {
+			t.Fatalf("expected: %v, got: %v", "well formed xml", err)
+		}
+		switch tok := tok.(type) {
+		case xml.StartElement:
+			name = tok.Name.Local
+		case xml.CharData:
+			if s := strings.TrimSpace(string(tok)); s != "" {
+				out[name] = append(out[name], s)
+			}
+		}
+	}
+}
+
+func TestBuild(t *testing.T) {
+	tests := []struct {
+		profile string
+		want    map[string]string
+		absent  []string
+	}{
+		{
+			profile: ProfileEN16931,
+			want: map[string]string{
+				"ID":                    "urn:cen.eu:en16931:2017 F-2024-07 FR32123456789",
+				"DateTimeString":        "20240131 20240229",
+				"LineTotalAmount":       "200.25 49.90 30.00 280.15",
+				"BasisAmount":           "250.15 30.00",
+				"CalculatedAmount":      "50.03 1.65",
+				"RateApplicablePercent": "20 20 5.5 20 5.5",
+				"TaxTotalAmount":        "51.68",
+				"GrandTotalAmount":      "331.83",
+				"Name":                  "Consulting Hosting Book Acme SARL Globex & Co",
+				"CountryID":             "FR DE",
+			},
+		},
+		{
+			profile: ProfileMinimum,
+			want: map[string]string{
+				"ID":                  "urn:factur-x.eu:1p0:minimum F-2024-07 FR32123456789",
+				"DateTimeString":      "20240131",
+				"TaxBasisTotalAmount": "100.00",
+				"GrandTotalAmount":    "120.00",
+				"CountryID":           "FR",
+			},
+			absent: []string{"LineTotalAmount", "ApplicableTradeTax", "CityName"},
+		},
+		{
+			profile: ProfileBasicWL,
+			want: map[string]string{
+				"BasisAmount":      "100.00",
+				"CalculatedAmount": "20.00",
+				"LineTotalAmount":  "100.00",
+				"CategoryCode":     "S",
+			},
+			absent: []string{"IncludedSupplyChainTradeLineItem"},
+		},
+	}
+
+	for _, tc := range tests {
+		b, err := Build(testMapping(tc.profile), testFields(t))
+		if err != nil {
+			t.Fatalf("%s: unexpected error: %v", tc.profile, err)
+		}
+		got := elements(t, b)
+		for name, want := range tc.want {
+			if s := strings.Join(got[name], " "); s != want {
+				t.Fatalf("%s: %s expected: %v, got: %v", tc.profile, name, want, s)
+			}
+		}
+		for _, name := range tc.absent {
+			if bytes.Contains(b, []byte("<ram:"+name+">")) {
+				t.Fatalf("%s: expected: %v, got: %s", tc.profile, "no "+name, b)
+			}
+		}
+	}
+}
+
+func TestBuildErrors(t *testing.T) {
+	tests := []struct {
+		name    string
+		mapping func(m *Mapping)
+		want    string
+		wantErr error
+	}{
+		{name: "unknown profile", mapping: func(m *Mapping) { m.Profile = "XRECHNUNG" }, wantErr: ErrProfile},
+		{name: "lines without items", mapping: func(m *Mapping) { m.Items = "" }, wantErr: ErrItemsRequired},
+		{name: "invalid template", mapping: func(m *Mapping) { m.Number = "{{.invoice.number" }, wantErr: ErrTemplate},
+		{name: "missing field", mapping: func(m *Mapping) { m.Number = "{{.number}}" }, want: "invoice number does not match the fields"},
+		{name: "malformed date", mapping: func(m *Mapping) { m.IssueDate = "31.01.2024" }, want: "invoice issueDate is not a date like 2006-01-02: 31.01.2024"},
+		{name: "malformed amount", mapping: func(m *Mapping) { m.Item.NetPrice = "{{.name}}" }, want: "invoice item 1 netPrice is not a number: Consulting"},
+		{name: "items not a list", mapping: func(m *Mapping) { m.Items = "invoice.number" }, want: "invoice items is not a list in the fields"},
+		{name: "seller without country", mapping: func(m *Mapping) { m.Seller.Country = "" }, want: "invoice seller.country is empty"},
+	}
+
+	for _, tc := range tests {
+		m := testMapping(ProfileEN16931)
+		tc.mapping(&m)
+		_, err := Build(m, testFields(t))
+		var fe *FieldError
+		switch {
+		case tc.wantErr != nil:
+			if err != tc.wantErr {
+				t.Fatalf("%s: expected: %v, got: %v", tc.name, tc.wantErr, err)
+			}
+		case !errors.As(err, &fe) || err.Error() != tc.want:
+			t.Fatalf("%s: expected: %v, got: %v", tc.name, tc.want, err)
+		}
+	}
+}
@@ -0,0 +1,33 @@
+package htmlrender
+
+import "github.com/rengas/pdfgen/pkg/pdf"
+
+type font = pdf.Font
+
+const (
+	familySans  = "sans"
+	familySerif = "serif"
+	familyMono  = "mono"
+)
+
+// fonts by family, bold and italic.
+var fonts = map[string][2][2]*font{
+	familySans:  {{pdf.Helvetica, pdf.HelveticaOblique}, {pdf.HelveticaBold, pdf.HelveticaBoldOblique}},
+	familySerif: {{pdf.TimesRoman, pdf.TimesItalic}, {pdf.TimesBold, pdf.TimesBoldItalic}},
+	familyMono:  {{pdf.Courier, pdf.CourierOblique}, {pdf.CourierBold, pdf.CourierBoldOblique}},
+}
+
+func fontFor(family string, bold, italic bool) *font {
+	f, ok := fonts[family]
+	if !ok {
+		f = fonts[familySerif]
+	}
+	b, i := 0, 0
+	if bold {
+		b = 1
+	}
+	if italic {
+		i = 1
+	}
+	return f[b][i]
+}
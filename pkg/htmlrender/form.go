@@ -0,0 +1,365 @@
+package htmlrender
+
+import (
+	"fmt"
+	"github.com/rengas/pdfgen/pkg/pdf"
+	"golang.org/x/net/html"
+	"math"
+	"strconv"
+	"strings"
+)
+
+type fieldKind int
+
+const (
+	fieldText fieldKind = iota
+	fieldCheckbox
+	fieldRadio
+	fieldChoice
+)
+
+// Flags of form fields.
+const (
+	flagReadOnly      = 1
+	flagRequired      = 1 << 1
+	flagMultiline     = 1 << 12
+	flagNoToggleToOff = 1 << 14
+	flagRadio         = 1 << 15
+	flagCombo         = 1 << 17
+)
+
+// fieldPadding is the space between the border of a field and its text.
+const fieldPadding = 2
+
+// zapfDingbats draws the check marks of buttons, '4' is a check and 'l' a
+// filled circle.
+var zapfDingbats = pdf.Dict{
+	"Type":     pdf.Name("Font"),
+	"Subtype":  pdf.Name("Type1"),
+	"BaseFont": pdf.Name("ZapfDingbats"),
+}
+
+// form collects the fields of the document.
+type form struct {
+	fields  []*formField
+	widgets []*widget
+	// radios are the radio groups by the name of their inputs
+	radios map[string]*formField
+	names  map[string]bool
+	// fonts are the resources of the appearances, set when writing
+	fonts pdf.Dict
+}
+
+func newForm() *form {
+	return &form{radios: map[string]*formField{}, names: map[string]bool{}}
+}
+
+// formField is a field of the form, the radio buttons of a name share one.
+// Value is the text of text fields, the export value of the selected option
+// of choices and the state of checked buttons.
+type formField struct {
+	kind    fieldKind
+	name    string
+	value   string
+	options [][2]string
+	flags   int
+	size    float64
+	widgets []*widget
+	ref     pdf.Ref
+}
+
+// widget is the box of a field on a page, on is the state of a checked
+// button.
+type widget struct {
+	field *formField
+	on    string
+	page  int
+	rect  [4]float64
+	ref   pdf.Ref
+}
+
+// field lays out an input, textarea or select as a box of its field,
+// buttons and hidden inputs are not drawn.
+func (b *builder) field(n *html.Node, st style, bl *block) {
+	fm := b.form
+	kind, typ := fieldText, strings.ToLower(attr(n, "type"))
+	switch n.Data {
+	case "textarea":
+	case "select":
+		kind = fieldChoice
+	default:
+		switch typ {
+		case "hidden", "submit", "reset", "button", "image", "file":
+			return
+		case "checkbox":
+			kind = fieldCheckbox
+		case "radio":
+			kind = fieldRadio
+		}
+	}
+
+	f := &formField{kind: kind, size: st.size}
+	if kind == fieldRadio {
+		name := attr(n, "name")
+		if g, ok := fm.radios[name]; ok && name != "" {
+			f = g
+		} else {
+			f.name = fm.unique(name)
+			f.flags = flagRadio | flagNoToggleToOff
+			fm.radios[name] = f
+			fm.fields = append(fm.fields, f)
+		}
+	} else {
+		f.name = fm.unique(attr(n, "name"))
+		fm.fields = append(fm.fields, f)
+	}
+	if hasAttr(n, "readonly") || hasAttr(n, "disabled") {
+		f.flags |= flagReadOnly
+	}
+	if hasAttr(n, "required") {
+		f.flags |= flagRequired
+	}
+
+	wd := &widget{field: f}
+	lineH := st.size*1.2 + 2*fieldPadding
+	charW := st.size / 2
+	var w, h float64
+	switch kind {
+	case fieldCheckbox, fieldRadio:
+		w, h = st.size, st.size
+		wd.on = strings.TrimSpace(attr(n, "value"))
+		if wd.on == "" || wd.on == "Off" {
+			wd.on = "Yes"
+			if kind == fieldRadio {
+				wd.on = "Choice" + strconv.Itoa(len(f.widgets)+1)
+			}
+		}
+		if hasAttr(n, "checked") {
+			f.value = wd.on
+		}
+	case fieldChoice:
+		walk(n, func(c *html.Node) {
+			if c.Type != html.ElementNode || c.Data != "option" {
+				return
+			}
+			label := strings.Join(strings.Fields(textContent(c)), " ")
+			value := label
+			if hasAttr(c, "value") {
+				value = attr(c, "value")
+			}
+			f.options = append(f.options, [2]string{value, label})
+			if hasAttr(c, "selected") || len(f.options) == 1 {
+				f.value = value
+			}
+			w = math.Max(w, pdf.Helvetica.Width(pdf.WinAnsi(label), st.size))
+		})
+		f.flags |= flagCombo
+		w, h = w+st.size+2*fieldPadding, lineH
+	default:
+		cols := 20
+		if v, err := strconv.Atoi(attr(n, "size")); err == nil && v > 0 {
+			cols = v
+		}
+		f.value = attr(n, "value")
+		w, h = float64(cols)*charW+2*fieldPadding, lineH
+		if n.Data == "textarea" {
+			cols, rows := 20, 2
+			if v, err := strconv.Atoi(attr(n, "cols")); err == nil && v > 0 {
+				cols = v
+			}
+			if v, err := strconv.Atoi(attr(n, "rows")); err == nil && v > 0 {
+				rows = v
+			}
+			f.value = textContent(n)
+			f.flags |= flagMultiline
+			w, h = float64(cols)*charW+2*fieldPadding, float64(rows)*st.size*1.2+2*fieldPadding
+		}
+	}
+	if st.width.set {
+		w = st.width.resolve(bl.w)
+	}
+	if st.height.set {
+		h = st.height.resolve(bl.w)
+	}
+	w = math.Min(w, bl.w)
+
+	f.widgets = append(f.widgets, wd)
+	fm.widgets = append(fm.widgets, wd)
+	bl.items = append(bl.items, item{kind: itemField, st: st, width: w, height: h, widget: wd})
+}
+
+// unique returns the name of a new field, periods separate the names of
+// nested fields so they are replaced.
+func (fm *form) unique(name string) string {
+	name = strings.ReplaceAll(strings.TrimSpace(name), ".", "_")
+	if name == "" {
+		name = "field"
+	}
+	out := name
+	for i := 2; fm.names[out]; i++ {
+		out = name + "_" + strconv.Itoa(i)
+	}
+	fm.names[out] = true
+	return out
+}
+
+// border draws the frame of a placed widget, radio buttons are round.
+func (wd *widget) border() string {
+	num := pdf.FormatReal
+	r := wd.rect
+	if wd.field.kind == fieldRadio {
+		return "0.6 G 0.75 w " + circle((r[0]+r[2])/2, (r[1]+r[3])/2, (r[2]-r[0])/2-0.375) + " S\n"
+	}
+	return fmt.Sprintf("0.6 G 0.75 w %s %s %s %s re S\n", num(r[0]+0.375), num(r[1]+0.375), num(r[2]-r[0]-0.75), num(r[3]-r[1]-0.75))
+}
+
+// circle returns the path of a circle made of four Bézier curves.
+func circle(x, y, r float64) string {
+	num := pdf.FormatReal
+	k := r * 0.5523
+	return fmt.Sprintf("%s %s m %s %s %s %s %s %s c %s %s %s %s %s %s c %s %s %s %s %s %s c %s %s %s %s %s %s c",
+		num(x+r), num(y),
+		num(x+r), num(y+k), num(x+k), num(y+r), num(x), num(y+r),
+		num(x-k), num(y+r), num(x-r), num(y+k), num(x-r), num(y),
+		num(x-r), num(y-k), num(x-k), num(y-r), num(x), num(y-r),
+		num(x+k), num(y-r), num(x+r), num(y-k), num(x+r), num(y))
+}
+
+// annotations returns the widgets placed on the n-th page.
+func (fm *form) annotations(w *pdf.Writer, n int, page pdf.Ref) pdf.Array {
+	var annots pdf.Array
+	for _, wd := range fm.widgets {
+		if wd.page != n || wd.rect == [4]float64{} {
+			continue
+		}
+		f := wd.field
+		if f.ref == (pdf.Ref{}) {
+			f.ref = w.Reserve()
+		}
+		d := pdf.Dict{
+			"Type":    pdf.Name("Annot"),
+			"Subtype": pdf.Name("Widget"),
+			"Rect":    pdf.Array{pdf.Real(wd.rect[0]), pdf.Real(wd.rect[1]), pdf.Real(wd.rect[2]), pdf.Real(wd.rect[3])},
+			"P":       page,
+			"Parent":  f.ref,
+			// printed
+			"F":  pdf.Integer(4),
+			"AP": fm.appearance(w, wd),
+		}
+		switch f.kind {
+		case fieldCheckbox, fieldRadio:
+			d["AS"] = pdf.Name("Off")
+			if f.value == wd.on {
+				d["AS"] = pdf.Name(wd.on)
+			}
+			d["MK"] = pdf.Dict{"CA": pdf.String(wd.mark())}
+		}
+		wd.ref = w.Add(d)
+		annots = append(annots, wd.ref)
+	}
+	return annots
+}
+
+func (wd *widget) mark() string {
+	if wd.field.kind == fieldRadio {
+		return "l"
+	}
+	return "4"
+}
+
+// appearance returns the appearance of a widget, checked and unchecked
+// for buttons.
+func (fm *form) appearance(w *pdf.Writer, wd *widget) pdf.Dict {
+	num := pdf.FormatReal
+	width, height := wd.rect[2]-wd.rect[0], wd.rect[3]-wd.rect[1]
+	xobject := func(content string) pdf.Ref {
+		return w.Add(pdf.Stream{Dict: pdf.Dict{
+			"Type":      pdf.Name("XObject"),
+			"Subtype":   pdf.Name("Form"),
+			"BBox":      pdf.Array{pdf.Integer(0), pdf.Integer(0), pdf.Real(width), pdf.Real(height)},
+			"Resources": pdf.Dict{"Font": fm.fonts},
+		}, Data: []byte(content)})
+	}
+
+	f := wd.field
+	if f.kind == fieldCheckbox || f.kind == fieldRadio {
+		// the marks are about as wide as high and 0.7 of the size high
+		size := 0.8 * math.Min(width, height)
+		on := fmt.Sprintf("q BT 0 g /ZaDb %s Tf %s %s Td (%s) Tj ET Q", num(size), num((width-0.8*size)/2), num((height-0.7*size)/2), wd.mark())
+		return pdf.Dict{"N": pdf.Dict{pdf.Name(wd.on): xobject(on), "Off": xobject("")}}
+	}
+
+	text := f.value
+	if f.kind == fieldChoice {
+		for _, o := range f.options {
+			if o[0] == f.value {
+				text = o[1]
+			}
+		}
+	}
+	h := pdf.Helvetica
+	var c strings.Builder
+	fmt.Fprintf(&c, "/Tx BMC q %s %s %s %s re W n BT 0 g /Helv %s Tf ", num(1), num(1), num(width-2), num(height-2), num(f.size))
+	if f.flags&flagMultiline != 0 {
+		y := height - fieldPadding - h.Ascent*f.size
+		fmt.Fprintf(&c, "%s TL %s %s Td", num(f.size*1.2), num(fieldPadding), num(y))
+		for i, line := range h.Wrap(text, f.size, width-2*fieldPadding) {
+			if i > 0 {
+				c.WriteString(" T*")
+			}
+			fmt.Fprintf(&c, " %s Tj", pdf.Format(pdf.String(line)))
+		}
+	} else {
+		y := (height-(h.Ascent+h.Descent)*f.size)/2 + h.Descent*f.size
+		fmt.Fprintf(&c, "%s %s Td %s Tj", num(fieldPadding), num(y), pdf.Format(pdf.String(pdf.WinAnsi(text))))
+	}
+	c.WriteString(" ET Q EMC")
+	return pdf.Dict{"N": xobject(c.String())}
+}
+
+// acroForm writes the fields of the placed widgets and returns the
+// interactive form, nil without fields.
+func (fm *form) acroForm(w *pdf.Writer) pdf.Object {
+	var fields pdf.Array
+	for _, f := range fm.fields {
+		if f.ref == (pdf.Ref{}) {
+			continue
+		}
+		var kids pdf.Array
+		for _, wd := range f.widgets {
+			if wd.ref != (pdf.Ref{}) {
+				kids = append(kids, wd.ref)
+			}
+		}
+		d := pdf.Dict{"T": pdf.Text(f.name), "Kids": kids}
+		da := pdf.String("/Helv " + pdf.FormatReal(f.size) + " Tf 0 g")
+		switch f.kind {
+		case fieldText:
+			d["FT"], d["V"], d["DA"] = pdf.Name("Tx"), pdf.Text(f.value), da
+		case fieldChoice:
+			var opts pdf.Array
+			for _, o := range f.options {
+				opts = append(opts, pdf.Array{pdf.Text(o[0]), pdf.Text(o[1])})
+			}
+			d["FT"], d["V"], d["DA"], d["Opt"] = pdf.Name("Ch"), pdf.Text(f.value), da, opts
+		default:
+			d["FT"], d["V"] = pdf.Name("Btn"), pdf.Name("Off")
+			if f.value != "" {
+				d["V"] = pdf.Name(f.value)
+			}
+		}
+		if f.flags != 0 {
+			d["Ff"] = pdf.Integer(f.flags)
+		}
+		w.Set(f.ref, d)
+		fields = append(fields, f.ref)
+	}
+	if len(fields) == 0 {
+		return nil
+	}
+	return pdf.Dict{
+		"Fields": fields,
+		"DR":     pdf.Dict{"Font": fm.fonts},
+		"DA":     pdf.String("/Helv 0 Tf 0 g"),
+	}
+}
@@ -0,0 +1,337 @@
+// Package htmlrender renders a subset of HTML and CSS to PDF in pure Go.
+//
+// Supported are block layout with margins, padding, borders and background
+// colors, text in the standard PDF fonts (Helvetica, Times and Courier for
+// sans-serif, serif and monospace) with size, weight, style, color,
+// underline and alignment, lists, tables with colspan, data uri images in
+// PNG, JPEG and GIF, and page breaks through page-break-before/after or
+// break-before/after. Stylesheets may use type, class, id and descendant
+// selectors. Page size, margins and omitted backgrounds come from the render
+// options, as do bookmarks of the h1 to h3 headings, tagging for screen
+// readers with the alt text of images and the language of <html lang>, and
+// form fields of input, textarea and select elements.
+//
+// Not supported are headers and footers, floats, positioning, flexbox and
+// grid, remote images, web fonts and text outside the WinAnsi character set.
+// Tables use the full available width and rows are not split across pages.
+package htmlrender
+
+import (
+	"context"
+	"fmt"
+	"github.com/rengas/pdfgen/pkg/pdf"
+	"github.com/rengas/pdfgen/pkg/pdfrender"
+	"golang.org/x/net/html"
+	"io"
+	"strings"
+)
+
+// mm is a millimetre in points.
+const mm = 72 / 25.4
+
+// page is the geometry of the pages in points.
+type page struct {
+	width, height            float64
+	top, right, bottom, left float64
+	omitBackground           bool
+}
+
+func pageOf(o pdfrender.Options) page {
+	w, h := o.Dimensions()
+	m := o.Margins()
+	return page{
+		width:          w * mm,
+		height:         h * mm,
+		top:            m.Top * mm,
+		right:          m.Right * mm,
+		bottom:         m.Bottom * mm,
+		left:           m.Left * mm,
+		omitBackground: o.OmitBackground,
+	}
+}
+
+type Renderer struct {
+}
+
+func NewRenderer() *Renderer {
+	return &Renderer{}
+}
+
+func (r *Renderer) HTML(in io.Reader) ([]byte, error) {
+	return r.Render(context.Background(), in, pdfrender.Options{})
+}
+
+// Render lays out the html on pages of the size and margins of the options,
+// headers and footers are not printed.
+func (r *Renderer) Render(ctx context.Context, in io.Reader, o pdfrender.Options) ([]byte, error) {
+	doc, err := html.Parse(in)
+	if err != nil {
+		return nil, err
+	}
+
+	b := &builder{ctx: ctx, images: newImageSet(), bookmarks: o.Outline()}
+	if o.Accessible {
+		b.tree = &structElem{role: "Document"}
+		b.elem = b.tree
+	}
+	if o.Forms {
+		b.form = newForm()
+	}
+	var root *html.Node
+	walk(doc, func(n *html.Node) {
+		if n.Type != html.ElementNode {
+			return
+		}
+		switch n.Data {
+		case "html":
+			if root == nil {
+				root = n
+				b.lang = strings.TrimSpace(attr(n, "lang"))
+			}
+		case "style":
+			b.sheet = append(b.sheet, parseStylesheet(textContent(n))...)
+		case "title":
+			if b.title == "" {
+				b.title = strings.TrimSpace(textContent(n))
+			}
+		}
+	})
+	for i := range b.sheet {
+		b.sheet[i].order = i
+	}
+
+	pg := pageOf(o)
+	f := &flow{}
+	if root != nil {
+		st := computeStyle(root, rootStyle, b.sheet)
+		st.display = displayBlock
+		if err := b.layoutBlock(root, st, pg.left, pg.width-pg.left-pg.right, f); err != nil {
+			return nil, err
+		}
+	}
+
+	pages, places := paginate(f, pg.height-pg.top-pg.bottom)
+	return b.write(pages, places, pg)
+}
+
+func walk(n *html.Node, fn func(*html.Node)) {
+	fn(n)
+	for c := n.FirstChild; c != nil; c = c.NextSibling {
+		walk(c, fn)
+	}
+}
+
+func textContent(n *html.Node) string {
+	var b strings.Builder
+	walk(n, func(c *html.Node) {
+		if c.Type == html.TextNode {
+			b.WriteString(c.Data)
+		}
+	})
+	return b.String()
+}
+
+// placement is where a slice ended up, y is from the top of the content
+// area.
+type placement struct {
+	page int
+	y, h float64
+}
+
+// paginate places slices on pages of the given content height and returns
+// the draw operations of every page, decorations first, and the placement
+// of every slice.
+func paginate(f *flow, height float64) ([][]drawOp, []placement) {
+	places := make([]placement, len(f.slices))
+	page, y := 0, 0.0
+	for i, s := range f.slices {
+		if s.breakBefore && y > 0 {
+			page, y = page+1, 0
+		}
+		if y+s.height > height && y > 0 {
+			page, y = page+1, 0
+		}
+		if s.spacer && y == 0 {
+			places[i] = placement{page: page, y: 0}
+			continue
+		}
+		places[i] = placement{page: page, y: y, h: s.height}
+		y += s.height
+	}
+
+	pages := make([][]drawOp, page+1)
+	for _, d := range f.decos {
+		if d.from >= d.to {
+			continue
+		}
+		first, last := places[d.from].page, places[d.to-1].page
+		for p := first; p <= last; p++ {
+			top, end := -1.0, 0.0
+			for i := d.from; i < d.to; i++ {
+				pl := places[i]
+				if pl.page != p || pl.h == 0 {
+					continue
+				}
+				if top < 0 {
+					top = pl.y
+				}
+				end = pl.y + pl.h
+			}
+			if top >= 0 {
+				pages[p] = append(pages[p], decoOps(d, top, end-top)...)
+			}
+		}
+	}
+	for i, s := range f.slices {
+		for _, op := range s.ops {
+			op.y += places[i].y
+			pages[places[i].page] = append(pages[places[i].page], op)
+		}
+	}
+	return pages, places
+}
+
+func (b *builder) write(pages [][]drawOp, places []placement, pg page) ([]byte, error) {
+	w := pdf.NewWriter()
+	catalog := w.Reserve()
+	pagesRef := w.Reserve()
+
+	fontRefs := map[*font]pdf.Name{}
+	fontDict := pdf.Dict{}
+	imageDict := pdf.Dict{}
+	for _, img := range b.images.list {
+		imageDict[pdf.Name(img.name)] = img.Add(w)
+	}
+
+	// documents without content are not tagged
+	if b.tree != nil && !b.tree.prune(w) {
+		b.tree = nil
+	}
+
+	if b.form != nil && len(b.form.widgets) > 0 {
+		b.form.fonts = pdf.Dict{"Helv": w.Add(pdf.Helvetica.Dict()), "ZaDb": w.Add(zapfDingbats)}
+	}
+
+	var kids pdf.Array
+	var parents [][]*structElem
+	for i, ops := range pages {
+		content, marked := b.content(ops, i, pg, fontRefs, fontDict, w)
+		stream, err := pdf.Deflate(nil, content)
+		if err != nil {
+			return nil, err
+		}
+		ref := w.Reserve()
+		page := pdf.Dict{
+			"Type":      pdf.Name("Page"),
+			"Parent":    pagesRef,
+			"MediaBox":  pdf.Array{pdf.Integer(0), pdf.Integer(0), pdf.Real(pg.width), pdf.Real(pg.height)},
+			"Contents":  w.Add(stream),
+			"Resources": pdf.Dict{"Font": fontDict, "XObject": imageDict},
+		}
+		if b.tree != nil {
+			page["StructParents"] = pdf.Integer(i)
+			page["Tabs"] = pdf.Name("S")
+			parents = append(parents, marked)
+		}
+		if b.form != nil {
+			if annots := b.form.annotations(w, i, ref); len(annots) > 0 {
+				page["Annots"] = annots
+			}
+		}
+		w.Set(ref, page)
+		kids = append(kids, ref)
+	}
+
+	w.Set(pagesRef, pdf.Dict{"Type": pdf.Name("Pages"), "Kids": kids, "Count": pdf.Integer(len(kids))})
+	root := pdf.Dict{"Type": pdf.Name("Catalog"), "Pages": pagesRef}
+	if outlines := b.outline(w, places, kids, pg); outlines != nil {
+		root["Outlines"] = outlines
+		root["PageMode"] = pdf.Name("UseOutlines")
+	}
+	if b.form != nil {
+		if form := b.form.acroForm(w); form != nil {
+			root["AcroForm"] = form
+		}
+	}
+	if b.lang != "" {
+		root["Lang"] = pdf.Text(b.lang)
+	}
+	if b.tree != nil {
+		tree := w.Reserve()
+		b.structTree(w, tree, kids, parents)
+		root["StructTreeRoot"] = tree
+		root["MarkInfo"] = pdf.Dict{"Marked": pdf.Boolean(true)}
+		root["ViewerPreferences"] = pdf.Dict{"DisplayDocTitle": pdf.Boolean(true)}
+	}
+	w.Set(catalog, root)
+
+	info := pdf.Dict{"Producer": pdf.String("pdfgen")}
+	if b.title != "" {
+		info["Title"] = pdf.String(pdf.WinAnsi(b.title))
+	}
+	return w.Bytes("1.4", pdf.Dict{"Root": catalog, "Info": w.Add(info)})
+}
+
+// content writes the draw operations of the n-th page as a content stream,
+// fonts are added to the shared font resources when first used. Tagged
+// output marks the operations and returns the structure elements of the
+// marked content by identifier, operations of no element are artifacts.
+func (b *builder) content(ops []drawOp, n int, pg page, fontRefs map[*font]pdf.Name, fontDict pdf.Dict, w *pdf.Writer) ([]byte, []*structElem) {
+	var c strings.Builder
+	var marked []*structElem
+	var open *markedContent
+	marking := false
+	num := pdf.FormatReal
+	// y of the top of the content area, pdf coordinates grow upwards
+	ty := pg.height - pg.top
+	color := func(c rgb) string {
+		return num(c.r) + " " + num(c.g) + " " + num(c.b)
+	}
+
+	for _, op := range ops {
+		if b.tree != nil && (!marking || op.mc != open) {
+			if marking {
+				c.WriteString("EMC\n")
+			}
+			if op.mc == nil {
+				c.WriteString("/Artifact BMC\n")
+			} else {
+				op.mc.page = n
+				op.mc.mcids = append(op.mc.mcids, len(marked))
+				fmt.Fprintf(&c, "/%s <</MCID %d>> BDC\n", op.mc.elem.role, len(marked))
+				marked = append(marked, op.mc.elem)
+			}
+			open, marking = op.mc, true
+		}
+		switch op.kind {
+		case opRect:
+			if op.fill != nil && !pg.omitBackground {
+				fmt.Fprintf(&c, "%s rg %s %s %s %s re f\n", color(*op.fill), num(op.x), num(ty-op.y-op.h), num(op.w), num(op.h))
+			}
+			if op.stroke != nil {
+				fmt.Fprintf(&c, "%s RG %s w %s %s %s %s re S\n", color(*op.stroke), num(op.lineWidth), num(op.x), num(ty-op.y-op.h), num(op.w), num(op.h))
+			}
+		case opImage:
+			fmt.Fprintf(&c, "q %s 0 0 %s %s %s cm /%s Do Q\n", num(op.w), num(op.h), num(op.x), num(ty-op.y-op.h), op.image.name)
+		case opField:
+			wd := op.widget
+			wd.page, wd.rect = n, [4]float64{op.x, ty - op.y - op.h, op.x + op.w, ty - op.y}
+			c.WriteString(wd.border())
+		case opText:
+			name, ok := fontRefs[op.font]
+			if !ok {
+				name = pdf.Name(fmt.Sprintf("F%d", len(fontRefs)+1))
+				fontRefs[op.font] = name
+				fontDict[name] = w.Add(op.font.Dict())
+			}
+			fmt.Fprintf(&c, "BT %s rg /%s %s Tf %s %s Td %s Tj ET\n", color(op.color), name, num(op.size), num(op.x), num(ty-op.y), pdf.Format(pdf.String(op.text)))
+			if op.underline {
+				fmt.Fprintf(&c, "%s RG %s w %s %s m %s %s l S\n", color(op.color), num(op.size/20), num(op.x), num(ty-op.y-op.size/10), num(op.x+op.w), num(ty-op.y-op.size/10))
+			}
+		}
+	}
+	if marking {
+		c.WriteString("EMC\n")
+	}
+	return []byte(c.String()), marked
+}
@@ -0,0 +1,387 @@
+package htmlrender
+
+import (
+	"bytes"
+	"compress/zlib"
+	"context"
+	"encoding/base64"
+	"github.com/rengas/pdfgen/pkg/pdfrender"
+	"golang.org/x/net/html"
+	"image"
+	"image/color"
+	"image/png"
+	"io"
+	"regexp"
+	"strings"
+	"testing"
+)
+
+// pageContents returns the decompressed content streams of a rendered pdf,
+// they are the only streams with just a filter and length.
+func pageContents(t *testing.T, b []byte) []string {
+	var pages []string
+	re := regexp.MustCompile(`(?s)/Filter /FlateDecode/Length \d+>>\nstream\n(.*?)\nendstream`)
+	for _, m := range re.FindAllSubmatch(b, -1) {
+		zr, err := zlib.NewReader(bytes.NewReader(m[1]))
+		if err != nil {
+			t.Fatal(err)
+		}
+		out, err := io.ReadAll(zr)
+		if err != nil {
+			t.Fatal(err)
+		}
+		pages = append(pages, string(out))
+	}
+	return pages
+}
+
+func render(t *testing.T, doc string) []byte {
+	b, err := NewRenderer().Render(context.Background(), strings.NewReader(doc), pdfrender.Options{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.HasPrefix(b, []byte("%PDF-1.4")) || !bytes.HasSuffix(b, []byte("%%EOF\n")) {
+		t.Fatalf("expected: %v, got: %q", "a pdf", b[:20])
+	}
+	return b
+}
+
+func TestRender(t *testing.T) {
+	tests := []struct {
+		name      string
+		doc       string
+		wantPages int
+		want      []string
+	}{
+		{
+			name:      "text styles",
+			doc:       `<p>Hello <b>bold</b> <i style="color: #ff0000">red</i> <u>under</u></p>`,
+			wantPages: 1,
+			want:      []string{"(Hello ) Tj", "(bold) Tj", "1 0 0 rg /F3 12 Tf", "(red) Tj", "(under) Tj", " l S"},
+		},
+		{
+			name:      "stylesheet and fonts",
+			doc:       `<style>.t { font-family: Arial; font-size: 20px } #c code { font-weight: bold }</style><h1 class="t">Title</h1><div id="c"><code>x</code></div>`,
+			wantPages: 1,
+			want:      []string{"/F1 15 Tf", "(Title) Tj", "/F2 12 Tf", "(x) Tj"},
+		},
+		{
+			name:      "page break",
+			doc:       `<p>one</p><p style="page-break-before: always">two</p><div style="break-before: page">three</div>`,
+			wantPages: 3,
+		},
+		{
+			name:      "overflowing content continues on the next page",
+			doc:       strings.Repeat(`<p>paragraph</p>`, 40),
+			wantPages: 2,
+		},
+		{
+			name:      "adjacent margins collapse",
+			doc:       strings.Repeat(`<p>paragraph</p>`, 29),
+			wantPages: 1,
+		},
+		{
+			name:      "table with background and borders",
+			doc:       `<table border="1"><tr><td style="background-color: #eeeeee">a</td><td>b</td></tr><tr><td colspan="2">c</td></tr></table>`,
+			wantPages: 1,
+			want:      []string{"0.9333 0.9333 0.9333 rg", "re f", "re S", "(a) Tj", "(b) Tj", "(c) Tj"},
+		},
+		{
+			name:      "list markers",
+			doc:       `<ul><li>a</li></ul><ol start="3"><li>b</li><li>c</li></ol>`,
+			wantPages: 1,
+			want:      []string{"(\x95) Tj", "(3.) Tj", "(4.) Tj"},
+		},
+		{
+			name:      "hidden elements",
+			doc:       `<p style="display: none">hidden</p><script>var x</script><p>shown</p>`,
+			wantPages: 1,
+			want:      []string{"(shown) Tj"},
+		},
+	}
+
+	for _, tc := range tests {
+		b := render(t, tc.doc)
+		pages := pageContents(t, b)
+		if len(pages) != tc.wantPages {
+			t.Fatalf("%s: expected: %v pages, got: %v", tc.name, tc.wantPages, len(pages))
+		}
+		all := strings.Join(pages, "")
+		for _, w := range tc.want {
+			if !strings.Contains(all, w) {
+				t.Fatalf("%s: expected: %q in content, got: %v", tc.name, w, all)
+			}
+		}
+		if strings.Contains(all, "hidden") || strings.Contains(all, "var x") {
+			t.Fatalf("%s: expected hidden content to be skipped, got: %v", tc.name, all)
+		}
+	}
+}
+
+func TestRenderWrapsLines(t *testing.T) {
+	b := render(t, `<p>`+strings.Repeat("word ", 100)+`</p>`)
+	page := pageContents(t, b)[0]
+	lines := strings.Count(page, " Tj ")
+	if lines < 3 {
+		t.Fatalf("expected: %v, got: %v", "at least 3 lines", lines)
+	}
+}
+
+func TestRenderImage(t *testing.T) {
+	img := image.NewNRGBA(image.Rect(0, 0, 4, 2))
+	img.Set(0, 0, color.NRGBA{R: 255, A: 128})
+	var buf bytes.Buffer
+	if err := png.Encode(&buf, img); err != nil {
+		t.Fatal(err)
+	}
+	src := "data:image/png;base64," + base64.StdEncoding.EncodeToString(buf.Bytes())
+
+	b := render(t, `<img src="`+src+`" width="40"><img src="`+src+`"><img src="https://example.com/logo.png">`)
+	if n := bytes.Count(b, []byte("/Subtype /Image")); n != 2 {
+		t.Fatalf("expected: %v, got: %v", "one image and its soft mask", n)
+	}
+	if !bytes.Contains(b, []byte("/SMask")) {
+		t.Fatalf("expected: %v, got: %s", "soft mask", b)
+	}
+	page := pageContents(t, b)[0]
+	if !strings.Contains(page, "q 30 0 0 15 ") || strings.Count(page, "/Im1 Do") != 2 {
+		t.Fatalf("expected: %v, got: %v", "image scaled to 40px and drawn twice", page)
+	}
+}
+
+func TestRenderBookmarks(t *testing.T) {
+	doc := `<h1>Terms</h1><h3>Late fees</h3><h4>Interest</h4><h2 style="page-break-before: always">Prices</h2><h1></h1>`
+	b, err := NewRenderer().Render(context.Background(), strings.NewReader(doc), pdfrender.Options{Bookmarks: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, want := range []string{"/Outlines", "/PageMode /UseOutlines", "/Title (Terms)", "/Title (Late fees)", "/Title (Prices)", "/Count 3"} {
+		if !bytes.Contains(b, []byte(want)) {
+			t.Fatalf("expected: %q, got: %s", want, b)
+		}
+	}
+	if bytes.Contains(b, []byte("Interest)")) {
+		t.Fatalf("expected: %v, got: %s", "no bookmark for h4", b)
+	}
+	if n := bytes.Count(b, []byte("/XYZ null")); n != 3 {
+		t.Fatalf("expected: %v, got: %v", 3, n)
+	}
+
+	if b := render(t, doc); bytes.Contains(b, []byte("/Outlines")) {
+		t.Fatalf("expected: %v, got: %s", "no outline", b)
+	}
+}
+
+func TestRenderForms(t *testing.T) {
+	doc := `<p>Name <input name="customer.name" value="Ada"> <input name="customer.name">` +
+		`<input type="checkbox" name="paid" checked> <input type="hidden" name="id" value="7">` +
+		`<input type="radio" name="plan" value="basic"><input type="radio" name="plan" value="pro" checked></p>` +
+		`<textarea name="notes" required>Due on receipt</textarea>` +
+		`<select name="currency"><option value="EUR">Euro</option><option value="USD" selected>Dollar</option></select>`
+	b, err := NewRenderer().Render(context.Background(), strings.NewReader(doc), pdfrender.Options{Forms: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, want := range []string{
+		"/T (customer_name)/V (Ada)", "/T (customer_name_2)/V ()", "/T (paid)/V /Yes", "/Ff 49152", "/T (plan)/V /pro",
+		"/Ff 4098", "(Due on receipt) Tj", "/Opt [[(EUR) (Euro)] [(USD) (Dollar)]]", "/T (currency)/V (USD)", "(Dollar) Tj",
+		"/AS /Off", "/AS /pro", "/DR <</Font <</Helv",
+	} {
+		if !bytes.Contains(b, []byte(want)) {
+			t.Fatalf("expected: %q, got: %s", want, b)
+		}
+	}
+	if n := bytes.Count(b, []byte("/Subtype /Widget")); n != 7 {
+		t.Fatalf("expected: %v, got: %v", 7, n)
+	}
+
+	if b := render(t, doc); bytes.Contains(b, []byte("/AcroForm")) {
+		t.Fatalf("expected: %v, got: %s", "no form", b)
+	}
+}
+
+func TestRenderTagged(t *testing.T) {
+	img := image.NewNRGBA(image.Rect(0, 0, 2, 2))
+	var buf bytes.Buffer
+	if err := png.Encode(&buf, img); err != nil {
+		t.Fatal(err)
+	}
+	src := "data:image/png;base64," + base64.StdEncoding.EncodeToString(buf.Bytes())
+	doc := `<html lang="de"><body><h1>Rechnung</h1><p>Text <img src="` + src + `" alt="Logo"><img src="` + src + `" alt=""></p>` +
+		`<ul><li>eins</li></ul><table><tr><th>a</th><td>b</td></tr></table><div style="background-color: #eeeeee"></div></body></html>`
+
+	b, err := NewRenderer().Render(context.Background(), strings.NewReader(doc), pdfrender.Options{Accessible: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, want := range []string{"/StructTreeRoot", "/MarkInfo <</Marked true>>", "/Lang (de)", "/DisplayDocTitle true",
+		"/S /H1", "/S /P", "/S /Figure", "/Alt (Logo)", "/S /L", "/S /LI", "/S /LBody", "/S /Table", "/S /TR", "/S /TH", "/S /TD",
+		"/StructParents 0", "/Tabs /S", "/ParentTreeNextKey 1"} {
+		if !bytes.Contains(b, []byte(want)) {
+			t.Fatalf("expected: %q, got: %s", want, b)
+		}
+	}
+	if n := bytes.Count(b, []byte("/S /Figure")); n != 1 {
+		t.Fatalf("expected: %v, got: %v", "decorative image not tagged", n)
+	}
+	if bytes.Contains(b, []byte("/S /Div")) {
+		t.Fatalf("expected: %v, got: %s", "empty elements dropped", b)
+	}
+
+	page := pageContents(t, b)[0]
+	for _, want := range []string{"/H1 <</MCID 0>> BDC", "/P <</MCID 1>> BDC", "/Figure <</MCID 2>> BDC", "/Artifact BMC", "/TD <</MCID"} {
+		if !strings.Contains(page, want) {
+			t.Fatalf("expected: %q in content, got: %v", want, page)
+		}
+	}
+	if strings.Count(page, "BDC")+strings.Count(page, "BMC") != strings.Count(page, "EMC") {
+		t.Fatalf("expected: %v, got: %v", "balanced marked content", page)
+	}
+
+	if b := render(t, doc); bytes.Contains(b, []byte("/StructTreeRoot")) || !bytes.Contains(b, []byte("/Lang (de)")) {
+		t.Fatalf("expected: %v, got: %s", "untagged with language", b)
+	}
+}
+
+func TestLint(t *testing.T) {
+	tests := []struct {
+		name string
+		doc  string
+		want []Warning
+	}{
+		{
+			name: "accessible",
+			doc:  `<html lang="en"><p style="color: #767676">grey enough</p><img src="a.png" alt=""><h1 style="color: #949494">large</h1></html>`,
+		},
+		{
+			name: "no language",
+			doc:  `<p>text</p>`,
+			want: []Warning{{Rule: RuleDocumentLang, Message: `document has no language, set it like <html lang="en">`}},
+		},
+		{
+			name: "image without alt",
+			doc:  `<html lang="en"><img src="logo.png" width="20"></html>`,
+			want: []Warning{{Rule: RuleImageAlt, Message: `image has no alt attribute, use alt="" for decorative images`, Element: `<img src="logo.png" width="20">`}},
+		},
+		{
+			name: "low contrast",
+			doc: `<html lang="en"><style>.note { color: #999999 }</style><p class="note">light</p>` +
+				`<div style="background-color: #000080"><span style="color: #333333">dark</span></div><p style="display: none; color: #fff">hidden</p></html>`,
+			want: []Warning{
+				{Rule: RuleContrast, Message: "text contrast is 2.84:1, at least 4.5:1 is needed", Element: `<p class="note">`},
+				{Rule: RuleContrast, Message: "text contrast is 1.26:1, at least 4.5:1 is needed", Element: `<span style="color: #333333">`},
+			},
+		},
+	}
+
+	for _, tc := range tests {
+		got, err := Lint(strings.NewReader(tc.doc))
+		if err != nil {
+			t.Fatalf("%s: unexpected error: %v", tc.name, err)
+		}
+		if len(got) != len(tc.want) {
+			t.Fatalf("%s: expected: %v, got: %v", tc.name, tc.want, got)
+		}
+		for i := range got {
+			if got[i] != tc.want[i] {
+				t.Fatalf("%s: expected: %v, got: %v", tc.name, tc.want[i], got[i])
+			}
+		}
+	}
+}
+
+func TestRenderCancelled(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	_, err := NewRenderer().Render(ctx, strings.NewReader(`<p>a</p>`), pdfrender.Options{})
+	if err != context.Canceled {
+		t.Fatalf("expected: %v, got: %v", context.Canceled, err)
+	}
+}
+
+func TestComputeStyle(t *testing.T) {
+	doc, err := html.Parse(strings.NewReader(`<div class="box"><p id="x" class="a b" style="margin-left: 2em">t</p><span>s</span></div>`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	sheet := parseStylesheet(`
+		/* comment */
+		@media print { p { color: blue } }
+		p { color: red; font-size: 10pt }
+		.box .a { color: #00ff00 }
+		p.a.b { text-align: center }
+		#x { font-weight: bold }
+		div > p { color: black }
+		p.a { color: #0000ff }
+	`)
+
+	var p, span *html.Node
+	walk(doc, func(n *html.Node) {
+		switch n.Data {
+		case "p":
+			p = n
+		case "span":
+			span = n
+		}
+	})
+
+	st := computeStyle(p, rootStyle, sheet)
+	tests := []struct {
+		name string
+		got  interface{}
+		want interface{}
+	}{
+		{name: "higher specificity wins", got: st.color, want: rgb{0, 1, 0}},
+		{name: "compound class selector", got: st.align, want: "center"},
+		{name: "id selector", got: st.bold, want: true},
+		{name: "size in points", got: st.size, want: 10.0},
+		{name: "inline style in em", got: st.margin[left], want: 20.0},
+		{name: "user agent margin", got: st.margin[top], want: 10.0},
+		{name: "block display", got: st.display, want: displayBlock},
+		{name: "inline display", got: computeStyle(span, rootStyle, sheet).display, want: displayInline},
+	}
+	for _, tc := range tests {
+		if tc.got != tc.want {
+			t.Fatalf("%s: expected: %v, got: %v", tc.name, tc.want, tc.got)
+		}
+	}
+}
+
+func TestParseValues(t *testing.T) {
+	lengths := []struct {
+		in   string
+		want length
+		ok   bool
+	}{
+		{in: "16px", want: length{value: 12, set: true}, ok: true},
+		{in: "1in", want: length{value: 72, set: true}, ok: true},
+		{in: "2em", want: length{value: 24, set: true}, ok: true},
+		{in: "50%", want: length{value: 50, percent: true, set: true}, ok: true},
+		{in: "0", want: length{set: true}, ok: true},
+		{in: "auto", ok: false},
+	}
+	for _, tc := range lengths {
+		got, ok := parseLength(tc.in, 12)
+		if ok != tc.ok || got != tc.want {
+			t.Fatalf("%s: expected: %v %v, got: %v %v", tc.in, tc.want, tc.ok, got, ok)
+		}
+	}
+
+	colors := []struct {
+		in   string
+		want rgb
+		ok   bool
+	}{
+		{in: "#fff", want: rgb{1, 1, 1}, ok: true},
+		{in: "#ff0000", want: rgb{1, 0, 0}, ok: true},
+		{in: "rgb(0, 255, 0)", want: rgb{0, 1, 0}, ok: true},
+		{in: "navy", want: rgb{0, 0, 0.5}, ok: true},
+		{in: "#ggg", ok: false},
+	}
+	for _, tc := range colors {
+		got, ok := parseColor(tc.in)
+		if ok != tc.ok || got != tc.want {
+			t.Fatalf("%s: expected: %v %v, got: %v %v", tc.in, tc.want, tc.ok, got, ok)
+		}
+	}
+}
@@ -0,0 +1,68 @@
+package htmlrender
+
+import (
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"github.com/rengas/pdfgen/pkg/pdf"
+	"net/url"
+	"strings"
+)
+
+var ErrUnsupportedImage = errors.New("only data uri images are supported")
+
+// pdfImage is an image with its resource name.
+type pdfImage struct {
+	*pdf.Image
+	name string
+}
+
+type imageSet struct {
+	bySrc map[string]*pdfImage
+	list  []*pdfImage
+}
+
+func newImageSet() *imageSet {
+	return &imageSet{bySrc: make(map[string]*pdfImage)}
+}
+
+// load decodes the image of a data uri once per document. Remote images are
+// not fetched so rendering never depends on the network.
+func (s *imageSet) load(src string) (*pdfImage, error) {
+	if img, ok := s.bySrc[src]; ok {
+		return img, nil
+	}
+	data, err := decodeDataURI(src)
+	if err != nil {
+		return nil, err
+	}
+	pi, err := pdf.NewImage(data)
+	if err != nil {
+		return nil, err
+	}
+	img := &pdfImage{Image: pi, name: fmt.Sprintf("Im%d", len(s.list)+1)}
+	s.bySrc[src] = img
+	s.list = append(s.list, img)
+	return img, nil
+}
+
+func decodeDataURI(src string) ([]byte, error) {
+	if !strings.HasPrefix(src, "data:") {
+		return nil, ErrUnsupportedImage
+	}
+	comma := strings.IndexByte(src, ',')
+	if comma < 0 {
+		return nil, ErrUnsupportedImage
+	}
+	meta, payload := src[len("data:"):comma], src[comma+1:]
+	if strings.HasSuffix(meta, ";base64") {
+		return base64.StdEncoding.DecodeString(strings.Map(func(r rune) rune {
+			if r == ' ' || r == '\n' || r == '\r' || r == '\t' {
+				return -1
+			}
+			return r
+		}, payload))
+	}
+	s, err := url.PathUnescape(payload)
+	return []byte(s), err
+}
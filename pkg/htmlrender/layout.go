@@ -0,0 +1,554 @@
+package htmlrender
+
+import (
+	"context"
+	"github.com/rengas/pdfgen/pkg/logging"
+	"github.com/rengas/pdfgen/pkg/pdf"
+	"golang.org/x/net/html"
+	"math"
+	"strconv"
+	"strings"
+	"unicode"
+)
+
+const (
+	opText = iota
+	opRect
+	opImage
+	opField
+)
+
+// drawOp is positioned relative to the top of its slice, y grows downwards.
+type drawOp struct {
+	kind int
+	x, y float64
+	w, h float64
+
+	// text, y is the baseline
+	text      string
+	font      *font
+	size      float64
+	color     rgb
+	underline bool
+
+	// mc tags the operation in tagged output, others are artifacts
+	mc *markedContent
+
+	// rect
+	fill      *rgb
+	stroke    *rgb
+	lineWidth float64
+
+	image *pdfImage
+
+	widget *widget
+}
+
+// slice is the unit of pagination, a line of text, a table row or the
+// vertical space of a margin. Slices are never split across pages.
+type slice struct {
+	height   float64
+	baseline float64
+	ops      []drawOp
+	// spacers are dropped at the top of a page
+	spacer      bool
+	breakBefore bool
+}
+
+// deco is the background and border of a block, drawn behind the slices
+// from..to on every page they end up on.
+type deco struct {
+	from, to int
+	x, w     float64
+	fill     *rgb
+	border   float64
+	color    rgb
+}
+
+type flow struct {
+	slices    []slice
+	decos     []deco
+	breakNext bool
+}
+
+func (f *flow) add(s slice) {
+	if f.breakNext {
+		s.breakBefore = true
+		f.breakNext = false
+	}
+	f.slices = append(f.slices, s)
+}
+
+// space adds vertical space, adjacent margins collapse into the larger one.
+func (f *flow) space(h float64, spacer bool) {
+	if h <= 0 {
+		return
+	}
+	if n := len(f.slices); spacer && n > 0 && f.slices[n-1].spacer && !f.breakNext {
+		f.slices[n-1].height = math.Max(f.slices[n-1].height, h)
+		return
+	}
+	f.add(slice{height: h, spacer: spacer})
+}
+
+type itemKind int
+
+const (
+	itemWord itemKind = iota
+	itemSpace
+	itemBreak
+	itemImage
+	itemField
+)
+
+// item is a piece of inline content.
+type item struct {
+	kind  itemKind
+	text  string
+	st    style
+	width float64
+	// images, decorative ones have an empty alt attribute
+	height float64
+	image  *pdfImage
+	alt    string
+	hasAlt bool
+	// form fields
+	widget *widget
+}
+
+type builder struct {
+	ctx    context.Context
+	sheet  []rule
+	images *imageSet
+	title  string
+	// bookmarks records the headings for the outline
+	bookmarks bool
+	headings  []heading
+	// tree is the structure of tagged output, elem the element content is
+	// added to
+	tree *structElem
+	elem *structElem
+	lang string
+	// form collects the form fields, it is nil when inputs are not fields
+	form *form
+}
+
+// block is a block container being filled with inline content.
+type block struct {
+	f     *flow
+	x, w  float64
+	st    style
+	items []item
+}
+
+func (b *builder) layoutChildren(n *html.Node, st style, bl *block) error {
+	for c := n.FirstChild; c != nil; c = c.NextSibling {
+		if err := b.ctx.Err(); err != nil {
+			return err
+		}
+		switch c.Type {
+		case html.TextNode:
+			b.text(c.Data, st, bl)
+		case html.ElementNode:
+			cs := computeStyle(c, st, b.sheet)
+			if cs.display == displayNone {
+				continue
+			}
+			if cs.display == displayInline {
+				if err := b.inline(c, cs, bl); err != nil {
+					return err
+				}
+				continue
+			}
+			b.flush(bl)
+			if err := b.layoutBlock(c, cs, bl.x, bl.w, bl.f); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+func (b *builder) inline(n *html.Node, st style, bl *block) error {
+	switch n.Data {
+	case "br":
+		bl.items = append(bl.items, item{kind: itemBreak, st: st})
+		return nil
+	case "img":
+		b.image(n, st, bl)
+		return nil
+	case "input", "textarea", "select":
+		if b.form != nil {
+			b.field(n, st, bl)
+			return nil
+		}
+	}
+	return b.layoutChildren(n, st, bl)
+}
+
+func (b *builder) image(n *html.Node, st style, bl *block) {
+	img, err := b.images.load(attr(n, "src"))
+	if err != nil {
+		logging.WithContext(b.ctx).WithError(err).Debug("skipping image")
+		return
+	}
+	w, h := float64(img.Width)*0.75, float64(img.Height)*0.75
+	switch {
+	case st.width.set && st.height.set:
+		w, h = st.width.resolve(bl.w), st.height.resolve(bl.w)
+	case st.width.set:
+		w, h = st.width.resolve(bl.w), h*st.width.resolve(bl.w)/w
+	case st.height.set:
+		w, h = w*st.height.resolve(bl.w)/h, st.height.resolve(bl.w)
+	}
+	if w > bl.w {
+		w, h = bl.w, h*bl.w/w
+	}
+	it := item{kind: itemImage, st: st, width: w, height: h, image: img}
+	for _, a := range n.Attr {
+		if a.Key == "alt" {
+			it.alt, it.hasAlt = strings.TrimSpace(a.Val), true
+		}
+	}
+	bl.items = append(bl.items, it)
+}
+
+// text splits text into words and collapsible spaces, or keeps spaces and
+// line breaks of preformatted text.
+func (b *builder) text(s string, st style, bl *block) {
+	f := st.font()
+	if st.pre {
+		for i, line := range strings.Split(s, "\n") {
+			if i > 0 {
+				bl.items = append(bl.items, item{kind: itemBreak, st: st})
+			}
+			if line != "" {
+				t := pdf.WinAnsi(strings.ReplaceAll(line, "\t", "    "))
+				bl.items = append(bl.items, item{kind: itemWord, text: t, st: st, width: f.Width(t, st.size)})
+			}
+		}
+		return
+	}
+
+	word := func(w string) {
+		t := pdf.WinAnsi(w)
+		bl.items = append(bl.items, item{kind: itemWord, text: t, st: st, width: f.Width(t, st.size)})
+	}
+	start := -1
+	for i, r := range s {
+		if unicode.IsSpace(r) && r != '\u00a0' {
+			if start >= 0 {
+				word(s[start:i])
+				start = -1
+			}
+			b.space(st, bl)
+			continue
+		}
+		if start < 0 {
+			start = i
+		}
+	}
+	if start >= 0 {
+		word(s[start:])
+	}
+}
+
+func (b *builder) space(st style, bl *block) {
+	if n := len(bl.items); n > 0 && bl.items[n-1].kind == itemSpace {
+		return
+	}
+	bl.items = append(bl.items, item{kind: itemSpace, text: " ", st: st, width: st.font().Width(" ", st.size)})
+}
+
+// flush breaks the pending inline content into lines.
+func (b *builder) flush(bl *block) {
+	items := bl.items
+	bl.items = nil
+	if !hasContent(items) {
+		return
+	}
+
+	var line []item
+	var lineW float64
+	for i := 0; i < len(items); i++ {
+		it := items[i]
+		switch it.kind {
+		case itemBreak:
+			b.line(bl, line, it.st)
+			line, lineW = nil, 0
+			continue
+		case itemSpace:
+			if len(line) == 0 && !it.st.pre {
+				continue
+			}
+		}
+
+		if it.kind != itemSpace && lineW+it.width > bl.w && !it.st.pre {
+			if len(line) > 0 {
+				b.line(bl, line, it.st)
+				line, lineW = nil, 0
+			}
+			// words wider than the line are split by character
+			if it.kind == itemWord && it.width > bl.w {
+				head, tail := splitWord(it, bl.w)
+				line = append(line, head)
+				b.line(bl, line, it.st)
+				line, lineW = nil, 0
+				if tail.text != "" {
+					items = append(items[:i+1], append([]item{tail}, items[i+1:]...)...)
+				}
+				continue
+			}
+		}
+		line = append(line, it)
+		lineW += it.width
+	}
+	if len(line) > 0 {
+		b.line(bl, line, line[len(line)-1].st)
+	}
+}
+
+func hasContent(items []item) bool {
+	for _, it := range items {
+		if it.kind != itemSpace {
+			return true
+		}
+	}
+	return false
+}
+
+func splitWord(it item, w float64) (item, item) {
+	f := it.st.font()
+	i := 1
+	for i < len(it.text) && f.Width(it.text[:i+1], it.st.size) <= w {
+		i++
+	}
+	head, tail := it, it
+	head.text, tail.text = it.text[:i], it.text[i:]
+	head.width, tail.width = f.Width(head.text, it.st.size), f.Width(tail.text, it.st.size)
+	return head, tail
+}
+
+// line places one line of items, st is used for the height of empty lines.
+func (b *builder) line(bl *block, line []item, st style) {
+	for len(line) > 0 && line[len(line)-1].kind == itemSpace && !line[len(line)-1].st.pre {
+		line = line[:len(line)-1]
+	}
+
+	var above, below, width float64
+	if len(line) == 0 {
+		above, below = textMetrics(st)
+	}
+	for _, it := range line {
+		a, d := textMetrics(it.st)
+		if it.kind == itemImage || it.kind == itemField {
+			a, d = it.height, 0
+		}
+		above, below = math.Max(above, a), math.Max(below, d)
+		width += it.width
+	}
+
+	x := bl.x
+	switch bl.st.align {
+	case "right":
+		x += bl.w - width
+	case "center":
+		x += (bl.w - width) / 2
+	}
+
+	s := slice{height: above + below, baseline: above}
+	var run *drawOp
+	var text *markedContent
+	for _, it := range line {
+		switch it.kind {
+		case itemImage:
+			run, text = nil, nil
+			op := drawOp{kind: opImage, x: x, y: above - it.height, w: it.width, h: it.height, image: it.image}
+			// images with an empty alt are decorative
+			if b.elem != nil && !(it.hasAlt && it.alt == "") {
+				fig := &structElem{role: "Figure", alt: it.alt}
+				b.elem.kids = append(b.elem.kids, fig)
+				op.mc = b.mark(fig)
+			}
+			s.ops = append(s.ops, op)
+		case itemField:
+			run, text = nil, nil
+			s.ops = append(s.ops, drawOp{kind: opField, x: x, y: above - it.height, w: it.width, h: it.height, widget: it.widget})
+		default:
+			if run != nil && sameText(run, it.st) {
+				run.text += it.text
+				run.w += it.width
+			} else {
+				if text == nil {
+					text = b.mark(b.elem)
+				}
+				s.ops = append(s.ops, drawOp{kind: opText, x: x, y: above, w: it.width, text: it.text,
+					font: it.st.font(), size: it.st.size, color: it.st.color, underline: it.st.underline, mc: text})
+				run = &s.ops[len(s.ops)-1]
+			}
+		}
+		x += it.width
+	}
+	bl.f.add(s)
+}
+
+func sameText(op *drawOp, st style) bool {
+	return op.font == st.font() && op.size == st.size && op.color == st.color && op.underline == st.underline
+}
+
+// textMetrics returns the space a line of text needs above and below the
+// baseline, the leading is split evenly.
+func textMetrics(st style) (float64, float64) {
+	f := st.font()
+	lh := st.size * st.lineH
+	half := (lh - (f.Ascent+f.Descent)*st.size) / 2
+	return half + f.Ascent*st.size, half + f.Descent*st.size
+}
+
+func (b *builder) layoutBlock(n *html.Node, st style, x, w float64, f *flow) error {
+	if st.breakBefore {
+		f.breakNext = true
+	}
+	f.space(st.margin[top], true)
+	b.addHeading(n, f)
+	parent := b.open(structRole(n))
+	if n.Data == "li" {
+		b.open("LBody")
+	}
+
+	outerX, outerW := x+st.margin[left], w-st.margin[left]-st.margin[right]
+	d := -1
+	if st.background != nil || st.border > 0 {
+		d = len(f.decos)
+		f.decos = append(f.decos, deco{from: len(f.slices), x: outerX, w: outerW, fill: st.background, border: st.border, color: st.borderColor})
+	}
+	f.space(st.border+st.padding[top], false)
+
+	cx := outerX + st.border + st.padding[left]
+	cw := outerW - 2*st.border - st.padding[left] - st.padding[right]
+	if st.width.set && n.Data != "hr" {
+		cw = math.Min(cw, st.width.resolve(w))
+		if d >= 0 {
+			f.decos[d].w = cw + 2*st.border + st.padding[left] + st.padding[right]
+		}
+	}
+
+	start := len(f.slices)
+	var err error
+	switch {
+	case n.Data == "hr":
+	case n.Data == "img":
+		bl := &block{f: f, x: cx, w: cw, st: st}
+		b.image(n, st, bl)
+		b.flush(bl)
+	case st.display == displayTable:
+		err = b.layoutTable(n, st, cx, cw, f)
+	default:
+		bl := &block{f: f, x: cx, w: cw, st: st}
+		err = b.layoutChildren(n, st, bl)
+		b.flush(bl)
+	}
+	if err != nil {
+		return err
+	}
+	if st.height.set {
+		used := 0.0
+		for _, s := range f.slices[start:] {
+			used += s.height
+		}
+		f.space(st.height.resolve(0)-used, false)
+	}
+	if st.display == displayListItem {
+		b.marker(n, st, cx, f, start)
+	}
+
+	f.space(st.border+st.padding[bottom], false)
+	if d >= 0 {
+		f.decos[d].to = len(f.slices)
+	}
+	f.space(st.margin[bottom], true)
+	if st.breakAfter {
+		f.breakNext = true
+	}
+	b.elem = parent
+	return nil
+}
+
+// marker draws the bullet or number of a list item left of its first line.
+func (b *builder) marker(n *html.Node, st style, x float64, f *flow, start int) {
+	var text string
+	switch st.listStyle {
+	case "none":
+		return
+	case "decimal":
+		text = strconv.Itoa(listIndex(n)) + "."
+	case "circle", "square", "disc":
+		text = "\x95"
+	default:
+		text = "\x95"
+	}
+	for i := start; i < len(f.slices); i++ {
+		s := &f.slices[i]
+		if s.spacer || len(s.ops) == 0 {
+			continue
+		}
+		fnt := st.font()
+		w := fnt.Width(text, st.size)
+		s.ops = append(s.ops, drawOp{kind: opText, x: x - w - st.size/2, y: s.baseline, w: w, text: text,
+			font: fnt, size: st.size, color: st.color})
+		return
+	}
+}
+
+// listIndex returns the position of a list item within its list.
+func listIndex(n *html.Node) int {
+	i := 1
+	if p := n.Parent; p != nil {
+		if v, err := strconv.Atoi(attr(p, "start")); err == nil {
+			i = v
+		}
+	}
+	for s := n.PrevSibling; s != nil; s = s.PrevSibling {
+		if s.Type == html.ElementNode && s.Data == "li" {
+			i++
+		}
+	}
+	return i
+}
+
+// flatten stacks the slices of a flow without pagination, it is used for
+// table cells which are kept on one page.
+func flatten(f *flow) ([]drawOp, float64) {
+	tops := make([]float64, len(f.slices)+1)
+	for i, s := range f.slices {
+		tops[i+1] = tops[i] + s.height
+	}
+
+	var ops []drawOp
+	for _, d := range f.decos {
+		ops = append(ops, decoOps(d, tops[d.from], tops[d.to]-tops[d.from])...)
+	}
+	for i, s := range f.slices {
+		for _, op := range s.ops {
+			op.y += tops[i]
+			ops = append(ops, op)
+		}
+	}
+	return ops, tops[len(f.slices)]
+}
+
+func decoOps(d deco, y, h float64) []drawOp {
+	if h <= 0 {
+		return nil
+	}
+	var ops []drawOp
+	if d.fill != nil {
+		ops = append(ops, drawOp{kind: opRect, x: d.x, y: y, w: d.w, h: h, fill: d.fill})
+	}
+	if d.border > 0 {
+		c := d.color
+		half := d.border / 2
+		ops = append(ops, drawOp{kind: opRect, x: d.x + half, y: y + half, w: d.w - d.border, h: h - d.border, stroke: &c, lineWidth: d.border})
+	}
+	return ops
+}
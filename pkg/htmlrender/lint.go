@@ -0,0 +1,147 @@
+package htmlrender
+
+import (
+	"fmt"
+	"golang.org/x/net/html"
+	"io"
+	"math"
+	"strings"
+)
+
+// Rules of the accessibility linter.
+const (
+	RuleImageAlt     = "image-alt"
+	RuleDocumentLang = "document-lang"
+	RuleContrast     = "text-contrast"
+)
+
+// Warning is an accessibility problem of a design, Element is the start tag
+// of the element it was found at.
+type Warning struct {
+	Rule    string `json:"rule" example:"image-alt"`
+	Message string `json:"message" example:"image has no alt attribute"`
+	Element string `json:"element,omitempty" example:"<img src=\"logo.png\">"`
+}
+
+// Lint checks html for problems of screen reader users and low vision:
+// images without alt attribute, a document without language and text with
+// less contrast to its background than WCAG 2 level AA asks for, 4.5:1 or
+// 3:1 for large text. Colors are read from the stylesheets the renderer
+// supports, backgrounds are white unless an element sets one.
+func Lint(in io.Reader) ([]Warning, error) {
+	doc, err := html.Parse(in)
+	if err != nil {
+		return nil, err
+	}
+
+	var sheet []rule
+	var root *html.Node
+	walk(doc, func(n *html.Node) {
+		if n.Type != html.ElementNode {
+			return
+		}
+		switch n.Data {
+		case "html":
+			if root == nil {
+				root = n
+			}
+		case "style":
+			sheet = append(sheet, parseStylesheet(textContent(n))...)
+		}
+	})
+	for i := range sheet {
+		sheet[i].order = i
+	}
+
+	var warnings []Warning
+	if root == nil || strings.TrimSpace(attr(root, "lang")) == "" {
+		warnings = append(warnings, Warning{Rule: RuleDocumentLang, Message: "document has no language, set it like <html lang=\"en\">"})
+	}
+	if root != nil {
+		lintNode(root, rootStyle, rgb{1, 1, 1}, sheet, &warnings)
+	}
+	return warnings, nil
+}
+
+func lintNode(n *html.Node, parent style, bg rgb, sheet []rule, warnings *[]Warning) {
+	st := computeStyle(n, parent, sheet)
+	if st.display == displayNone {
+		return
+	}
+	if st.background != nil {
+		bg = *st.background
+	}
+	if n.Data == "img" && !hasAttr(n, "alt") {
+		*warnings = append(*warnings, Warning{Rule: RuleImageAlt, Message: "image has no alt attribute, use alt=\"\" for decorative images", Element: startTag(n)})
+	}
+
+	checked := false
+	for c := n.FirstChild; c != nil; c = c.NextSibling {
+		switch c.Type {
+		case html.TextNode:
+			if checked || strings.TrimSpace(c.Data) == "" {
+				continue
+			}
+			checked = true
+			// large text is 18pt, or 14pt in bold
+			need := 4.5
+			if st.size >= 18 || (st.bold && st.size >= 14) {
+				need = 3
+			}
+			if ratio := contrast(st.color, bg); ratio < need {
+				*warnings = append(*warnings, Warning{
+					Rule:    RuleContrast,
+					Message: fmt.Sprintf("text contrast is %.2f:1, at least %g:1 is needed", math.Floor(ratio*100)/100, need),
+					Element: startTag(n),
+				})
+			}
+		case html.ElementNode:
+			lintNode(c, st, bg, sheet, warnings)
+		}
+	}
+}
+
+func hasAttr(n *html.Node, key string) bool {
+	for _, a := range n.Attr {
+		if a.Key == key {
+			return true
+		}
+	}
+	return false
+}
+
+// startTag writes the start tag of n, long attribute values like data uris
+// are cut.
+func startTag(n *html.Node) string {
+	var b strings.Builder
+	b.WriteString("<" + n.Data)
+	for _, a := range n.Attr {
+		v := a.Val
+		if len(v) > 40 {
+			v = v[:40] + "..."
+		}
+		fmt.Fprintf(&b, " %s=%q", a.Key, v)
+	}
+	b.WriteString(">")
+	return b.String()
+}
+
+// contrast returns the WCAG 2 contrast ratio of two colors.
+func contrast(a, b rgb) float64 {
+	la, lb := luminance(a), luminance(b)
+	if la < lb {
+		la, lb = lb, la
+	}
+	return (la + 0.05) / (lb + 0.05)
+}
+
+// luminance is the relative luminance of an sRGB color.
+func luminance(c rgb) float64 {
+	channel := func(v float64) float64 {
+		if v <= 0.03928 {
+			return v / 12.92
+		}
+		return math.Pow((v+0.055)/1.055, 2.4)
+	}
+	return 0.2126*channel(c.r) + 0.7152*channel(c.g) + 0.0722*channel(c.b)
+}
@@ -0,0 +1,106 @@
+package htmlrender
+
+import (
+	"github.com/rengas/pdfgen/pkg/pdf"
+	"golang.org/x/net/html"
+	"strings"
+)
+
+// heading is an h1 to h3 of the document, slice is the first slice laid out
+// for it.
+type heading struct {
+	level int
+	title string
+	slice int
+}
+
+// headingLevel returns the level of h1 to h3 elements, 0 for others.
+func headingLevel(n *html.Node) int {
+	switch n.Data {
+	case "h1":
+		return 1
+	case "h2":
+		return 2
+	case "h3":
+		return 3
+	}
+	return 0
+}
+
+// addHeading records n when it is a heading with text, the next slice of f
+// starts it.
+func (b *builder) addHeading(n *html.Node, f *flow) {
+	level := headingLevel(n)
+	if !b.bookmarks || level == 0 {
+		return
+	}
+	title := strings.Join(strings.Fields(textContent(n)), " ")
+	if title == "" {
+		return
+	}
+	b.headings = append(b.headings, heading{level: level, title: title, slice: len(f.slices)})
+}
+
+// outlineItem is a bookmark with the bookmarks of the headings below it.
+type outlineItem struct {
+	ref   pdf.Ref
+	level int
+	dict  pdf.Dict
+	kids  []*outlineItem
+}
+
+// outline adds a bookmark per heading pointing to its place on the pages
+// and returns the outline dictionary, nil without headings. Headings nest
+// under the closest heading of a higher level before them.
+func (b *builder) outline(w *pdf.Writer, places []placement, pages pdf.Array, pg page) pdf.Object {
+	var headings []heading
+	for _, h := range b.headings {
+		if h.slice < len(places) {
+			headings = append(headings, h)
+		}
+	}
+	if len(headings) == 0 {
+		return nil
+	}
+
+	root := &outlineItem{ref: w.Reserve(), dict: pdf.Dict{"Type": pdf.Name("Outlines")}}
+	stack := []*outlineItem{root}
+	for _, h := range headings {
+		pl := places[h.slice]
+		for len(stack) > 1 && stack[len(stack)-1].level >= h.level {
+			stack = stack[:len(stack)-1]
+		}
+		parent := stack[len(stack)-1]
+		item := &outlineItem{ref: w.Reserve(), level: h.level, dict: pdf.Dict{
+			"Title":  pdf.Text(h.title),
+			"Parent": parent.ref,
+			"Dest":   pdf.Array{pages[pl.page], pdf.Name("XYZ"), pdf.Null, pdf.Real(pg.height - pg.top - pl.y), pdf.Null},
+		}}
+		parent.kids = append(parent.kids, item)
+		stack = append(stack, item)
+	}
+	root.link(w)
+	return root.ref
+}
+
+// link sets the first, last and sibling entries of the items below it and
+// writes them, all items are open. It returns the number of items below it.
+func (it *outlineItem) link(w *pdf.Writer) int {
+	count := 0
+	for i, kid := range it.kids {
+		if i > 0 {
+			kid.dict["Prev"] = it.kids[i-1].ref
+		}
+		if i < len(it.kids)-1 {
+			kid.dict["Next"] = it.kids[i+1].ref
+		}
+		count += 1 + kid.link(w)
+	}
+	if count > 0 {
+		it.dict["First"] = it.kids[0].ref
+		it.dict["Last"] = it.kids[len(it.kids)-1].ref
+		it.dict["Count"] = pdf.Integer(count)
+	}
+	w.Set(it.ref, it.dict)
+	return count
+}
@@ -0,0 +1,132 @@
+package htmlrender
+
+import (
+	"github.com/rengas/pdfgen/pkg/pdf"
+	"golang.org/x/net/html"
+)
+
+// structElem is an element of the structure tree of tagged output, kids are
+// *structElem and *markedContent in reading order.
+type structElem struct {
+	role string
+	alt  string
+	kids []interface{}
+	ref  pdf.Ref
+}
+
+// markedContent is the content of a structure element on one line. It is
+// marked on its page with an identifier per run of drawing operations.
+type markedContent struct {
+	elem  *structElem
+	page  int
+	mcids []int
+}
+
+// structRole returns the standard structure type of a block element, ""
+// for elements whose content belongs to their parent. Images get their
+// figure when they are placed on a line.
+func structRole(n *html.Node) string {
+	switch n.Data {
+	case "html", "body", "img", "hr":
+		return ""
+	case "p", "dt", "dd", "address", "figcaption":
+		return "P"
+	case "h1", "h2", "h3", "h4", "h5", "h6":
+		return "H" + n.Data[1:]
+	case "ul", "ol", "dl":
+		return "L"
+	case "li":
+		return "LI"
+	case "table":
+		return "Table"
+	case "caption":
+		return "Caption"
+	case "blockquote":
+		return "BlockQuote"
+	case "section", "article":
+		return "Sect"
+	}
+	return "Div"
+}
+
+// open starts a structure element of the role below the current one and
+// returns the current one to restore when the element ends. Untagged
+// output and empty roles keep the current element.
+func (b *builder) open(role string) *structElem {
+	parent := b.elem
+	if parent == nil || role == "" {
+		return parent
+	}
+	e := &structElem{role: role}
+	parent.kids = append(parent.kids, e)
+	b.elem = e
+	return parent
+}
+
+// mark returns new marked content of e, nil for untagged output.
+func (b *builder) mark(e *structElem) *markedContent {
+	if e == nil {
+		return nil
+	}
+	mc := &markedContent{elem: e}
+	e.kids = append(e.kids, mc)
+	return mc
+}
+
+// prune drops the elements without content and reserves the references of
+// the others, it reports whether e has content.
+func (e *structElem) prune(w *pdf.Writer) bool {
+	kids := e.kids[:0]
+	for _, k := range e.kids {
+		if el, ok := k.(*structElem); ok && !el.prune(w) {
+			continue
+		}
+		kids = append(kids, k)
+	}
+	e.kids = kids
+	if len(kids) == 0 {
+		return false
+	}
+	e.ref = w.Reserve()
+	return true
+}
+
+func (e *structElem) write(w *pdf.Writer, parent pdf.Ref, pages pdf.Array) {
+	var k pdf.Array
+	for _, kid := range e.kids {
+		switch kid := kid.(type) {
+		case *structElem:
+			kid.write(w, e.ref, pages)
+			k = append(k, kid.ref)
+		case *markedContent:
+			for _, id := range kid.mcids {
+				k = append(k, pdf.Dict{"Type": pdf.Name("MCR"), "Pg": pages[kid.page], "MCID": pdf.Integer(id)})
+			}
+		}
+	}
+	d := pdf.Dict{"Type": pdf.Name("StructElem"), "S": pdf.Name(e.role), "P": parent, "K": k}
+	if e.alt != "" {
+		d["Alt"] = pdf.Text(e.alt)
+	}
+	w.Set(e.ref, d)
+}
+
+// structTree writes the structure tree below root, parents are the
+// structure elements of the marked content of every page by identifier.
+func (b *builder) structTree(w *pdf.Writer, root pdf.Ref, pages pdf.Array, parents [][]*structElem) {
+	b.tree.write(w, root, pages)
+	var nums pdf.Array
+	for i, ps := range parents {
+		refs := make(pdf.Array, len(ps))
+		for j, e := range ps {
+			refs[j] = e.ref
+		}
+		nums = append(nums, pdf.Integer(i), refs)
+	}
+	w.Set(root, pdf.Dict{
+		"Type":              pdf.Name("StructTreeRoot"),
+		"K":                 b.tree.ref,
+		"ParentTree":        pdf.Dict{"Nums": nums},
+		"ParentTreeNextKey": pdf.Integer(len(parents)),
+	})
+}
@@ -0,0 +1,698 @@
+package htmlrender
+
+import (
+	"golang.org/x/net/html"
+	"math"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+type rgb struct {
+	r, g, b float64
+}
+
+var black = rgb{}
+
+// length is a css length resolved to points, or a percentage of the
+// containing block.
+type length struct {
+	value   float64
+	percent bool
+	set     bool
+}
+
+func (l length) resolve(of float64) float64 {
+	if l.percent {
+		return l.value * of / 100
+	}
+	return l.value
+}
+
+type style struct {
+	// inherited
+	family    string
+	size      float64
+	bold      bool
+	italic    bool
+	underline bool
+	color     rgb
+	align     string
+	lineH     float64
+	pre       bool
+	listStyle string
+
+	// not inherited
+	display     string
+	background  *rgb
+	margin      [4]float64
+	padding     [4]float64
+	border      float64
+	borderColor rgb
+	width       length
+	height      length
+	breakBefore bool
+	breakAfter  bool
+}
+
+const (
+	top = iota
+	right
+	bottom
+	left
+)
+
+const (
+	displayBlock    = "block"
+	displayInline   = "inline"
+	displayNone     = "none"
+	displayListItem = "list-item"
+	displayTable    = "table"
+)
+
+// rootStyle matches the defaults of browsers, 16px Times.
+var rootStyle = style{
+	family:    familySerif,
+	size:      12,
+	color:     black,
+	align:     "left",
+	lineH:     1.2,
+	listStyle: "disc",
+	display:   displayBlock,
+}
+
+// inherit returns the style a child starts with.
+func (s style) inherit() style {
+	return style{
+		family:    s.family,
+		size:      s.size,
+		bold:      s.bold,
+		italic:    s.italic,
+		underline: s.underline,
+		color:     s.color,
+		align:     s.align,
+		lineH:     s.lineH,
+		pre:       s.pre,
+		listStyle: s.listStyle,
+		display:   displayInline,
+	}
+}
+
+func (s style) font() *font {
+	return fontFor(s.family, s.bold, s.italic)
+}
+
+// userAgent holds the default styles of elements, written as css.
+var userAgent = parseStylesheet(`
+html, body, div, p, h1, h2, h3, h4, h5, h6, ul, ol, li, blockquote, pre, hr,
+header, footer, main, section, article, aside, nav, address, figure, figcaption,
+dl, dt, dd, form, fieldset, center, table, caption { display: block }
+head, script, style, title, meta, link, template, noscript { display: none }
+li { display: list-item }
+table { display: table }
+body { margin: 8px }
+h1 { font-size: 2em; margin: 0.67em 0; font-weight: bold }
+h2 { font-size: 1.5em; margin: 0.83em 0; font-weight: bold }
+h3 { font-size: 1.17em; margin: 1em 0; font-weight: bold }
+h4 { margin: 1.33em 0; font-weight: bold }
+h5 { font-size: 0.83em; margin: 1.67em 0; font-weight: bold }
+h6 { font-size: 0.67em; margin: 2.33em 0; font-weight: bold }
+p, ul, ol, dl, pre, figure { margin: 1em 0 }
+blockquote { margin: 1em 40px }
+ul, ol { padding-left: 40px }
+ol { list-style-type: decimal }
+dd { margin-left: 40px }
+pre, code, kbd, samp, tt { font-family: monospace }
+pre { white-space: pre }
+hr { margin: 0.5em 0; border: 1px solid #808080 }
+b, strong, th, dt { font-weight: bold }
+i, em, cite, var, dfn, address { font-style: italic }
+u, ins { text-decoration: underline }
+a { color: #0000ee; text-decoration: underline }
+small { font-size: 0.83em }
+big { font-size: 1.2em }
+center, th, caption { text-align: center }
+td, th { padding: 1px }
+`)
+
+type selector struct {
+	// compounds from the outermost ancestor to the element itself
+	parts       []compound
+	specificity int
+}
+
+type compound struct {
+	tag     string
+	id      string
+	classes []string
+}
+
+type rule struct {
+	selector selector
+	decls    []decl
+	order    int
+}
+
+type decl struct {
+	property string
+	value    string
+}
+
+// parseStylesheet reads rules with type, class, id and descendant selectors,
+// at-rules are skipped.
+func parseStylesheet(css string) []rule {
+	css = stripComments(css)
+	var rules []rule
+	for {
+		open := strings.IndexByte(css, '{')
+		if open < 0 {
+			break
+		}
+		prelude := strings.TrimSpace(css[:open])
+		rest := css[open+1:]
+		if strings.HasPrefix(prelude, "@") {
+			css = skipBlock(rest)
+			continue
+		}
+		end := strings.IndexByte(rest, '}')
+		if end < 0 {
+			break
+		}
+		decls := parseDecls(rest[:end])
+		for _, s := range strings.Split(prelude, ",") {
+			sel, ok := parseSelector(strings.TrimSpace(s))
+			if !ok {
+				continue
+			}
+			rules = append(rules, rule{selector: sel, decls: decls, order: len(rules)})
+		}
+		css = rest[end+1:]
+	}
+	return rules
+}
+
+func stripComments(css string) string {
+	for {
+		i := strings.Index(css, "/*")
+		if i < 0 {
+			return css
+		}
+		j := strings.Index(css[i+2:], "*/")
+		if j < 0 {
+			return css[:i]
+		}
+		css = css[:i] + css[i+2+j+2:]
+	}
+}
+
+// skipBlock skips the rest of a block whose opening brace was consumed.
+func skipBlock(css string) string {
+	depth := 1
+	for i := 0; i < len(css); i++ {
+		switch css[i] {
+		case '{':
+			depth++
+		case '}':
+			depth--
+			if depth == 0 {
+				return css[i+1:]
+			}
+		}
+	}
+	return ""
+}
+
+func parseDecls(s string) []decl {
+	var ds []decl
+	for _, d := range strings.Split(s, ";") {
+		i := strings.IndexByte(d, ':')
+		if i < 0 {
+			continue
+		}
+		p := strings.ToLower(strings.TrimSpace(d[:i]))
+		v := strings.TrimSpace(strings.TrimSuffix(strings.TrimSpace(d[i+1:]), "!important"))
+		if p != "" && v != "" {
+			ds = append(ds, decl{property: p, value: v})
+		}
+	}
+	return ds
+}
+
+func parseSelector(s string) (selector, bool) {
+	if s == "" || strings.ContainsAny(s, ">+~[:") {
+		return selector{}, false
+	}
+	var sel selector
+	for _, part := range strings.Fields(s) {
+		var c compound
+		for part != "" {
+			i := strings.IndexAny(part[1:], ".#") + 1
+			if i == 0 {
+				i = len(part)
+			}
+			token := part[:i]
+			part = part[i:]
+			switch token[0] {
+			case '.':
+				c.classes = append(c.classes, token[1:])
+				sel.specificity += 10
+			case '#':
+				c.id = token[1:]
+				sel.specificity += 100
+			case '*':
+			default:
+				c.tag = strings.ToLower(token)
+				sel.specificity++
+			}
+		}
+		sel.parts = append(sel.parts, c)
+	}
+	return sel, true
+}
+
+func (c compound) matches(n *html.Node) bool {
+	if c.tag != "" && c.tag != n.Data {
+		return false
+	}
+	if c.id != "" && c.id != attr(n, "id") {
+		return false
+	}
+	classes := strings.Fields(attr(n, "class"))
+	for _, want := range c.classes {
+		found := false
+		for _, have := range classes {
+			if have == want {
+				found = true
+				break
+			}
+		}
+		if !found {
+			return false
+		}
+	}
+	return true
+}
+
+func (s selector) matches(n *html.Node) bool {
+	last := len(s.parts) - 1
+	if !s.parts[last].matches(n) {
+		return false
+	}
+	i := last - 1
+	for p := n.Parent; p != nil && i >= 0; p = p.Parent {
+		if p.Type == html.ElementNode && s.parts[i].matches(p) {
+			i--
+		}
+	}
+	return i < 0
+}
+
+func attr(n *html.Node, key string) string {
+	for _, a := range n.Attr {
+		if a.Key == key {
+			return a.Val
+		}
+	}
+	return ""
+}
+
+// computeStyle applies the user agent rules, the document rules, the
+// presentational attributes and the style attribute, in that order.
+func computeStyle(n *html.Node, parent style, sheet []rule) style {
+	s := parent.inherit()
+
+	var ds []decl
+	for _, r := range userAgent {
+		if r.selector.matches(n) {
+			ds = append(ds, r.decls...)
+		}
+	}
+	ds = append(ds, presentational(n)...)
+
+	var matched []rule
+	for _, r := range sheet {
+		if r.selector.matches(n) {
+			matched = append(matched, r)
+		}
+	}
+	sort.SliceStable(matched, func(i, j int) bool {
+		if matched[i].selector.specificity != matched[j].selector.specificity {
+			return matched[i].selector.specificity < matched[j].selector.specificity
+		}
+		return matched[i].order < matched[j].order
+	})
+	for _, r := range matched {
+		ds = append(ds, r.decls...)
+	}
+	if v := attr(n, "style"); v != "" {
+		ds = append(ds, parseDecls(v)...)
+	}
+
+	// the font size goes first, em lengths of the other properties are
+	// relative to the font size of the element itself.
+	var fonts, rest []decl
+	for _, d := range ds {
+		if d.property == "font-size" || d.property == "font" {
+			fonts = append(fonts, d)
+		} else {
+			rest = append(rest, d)
+		}
+	}
+	s.apply(fonts, parent)
+	s.apply(rest, parent)
+	return s
+}
+
+// presentational maps the html attributes still common in generated
+// documents to css.
+func presentational(n *html.Node) []decl {
+	var ds []decl
+	if v := attr(n, "align"); v != "" {
+		ds = append(ds, decl{"text-align", v})
+	}
+	if v := attr(n, "bgcolor"); v != "" {
+		ds = append(ds, decl{"background-color", v})
+	}
+	if v := attr(n, "width"); v != "" {
+		ds = append(ds, decl{"width", pxIfNumber(v)})
+	}
+	if v := attr(n, "height"); v != "" {
+		ds = append(ds, decl{"height", pxIfNumber(v)})
+	}
+	if n.Data == "font" {
+		if v := attr(n, "color"); v != "" {
+			ds = append(ds, decl{"color", v})
+		}
+		if v := attr(n, "face"); v != "" {
+			ds = append(ds, decl{"font-family", v})
+		}
+	}
+	if n.Data == "td" || n.Data == "th" {
+		if t := ancestor(n, "table"); t != nil {
+			if v := attr(t, "border"); v != "" && v != "0" {
+				ds = append(ds, decl{"border", "1px solid #000"})
+			}
+			if v := attr(t, "cellpadding"); v != "" {
+				ds = append(ds, decl{"padding", pxIfNumber(v)})
+			}
+		}
+	}
+	return ds
+}
+
+func pxIfNumber(v string) string {
+	if _, err := strconv.ParseFloat(v, 64); err == nil {
+		return v + "px"
+	}
+	return v
+}
+
+func ancestor(n *html.Node, tag string) *html.Node {
+	for p := n.Parent; p != nil; p = p.Parent {
+		if p.Type == html.ElementNode && p.Data == tag {
+			return p
+		}
+	}
+	return nil
+}
+
+func (s *style) apply(ds []decl, parent style) {
+	for _, d := range ds {
+		v := strings.ToLower(d.value)
+		switch d.property {
+		case "display":
+			switch v {
+			case displayBlock, displayInline, displayNone, displayListItem, displayTable:
+				s.display = v
+			case "inline-block":
+				s.display = displayInline
+			}
+		case "font-family":
+			if f := parseFamily(v); f != "" {
+				s.family = f
+			}
+		case "font-size":
+			if l, ok := parseLength(v, parent.size); ok {
+				s.size = l.resolve(parent.size)
+			} else if size, ok := fontSizes[v]; ok {
+				s.size = size
+			}
+		case "font-weight":
+			s.bold = v == "bold" || v == "bolder" || (len(v) == 3 && v >= "600")
+		case "font-style":
+			s.italic = v == "italic" || v == "oblique"
+		case "font":
+			s.applyFont(v, parent)
+		case "text-decoration", "text-decoration-line":
+			s.underline = strings.Contains(v, "underline")
+		case "color":
+			if c, ok := parseColor(v); ok {
+				s.color = c
+			}
+		case "background-color", "background":
+			if v == "none" || v == "transparent" {
+				s.background = nil
+			} else if c, ok := parseColor(strings.Fields(v)[0]); ok {
+				s.background = &c
+			}
+		case "text-align":
+			switch v {
+			case "left", "right", "center", "justify":
+				s.align = v
+			case "start":
+				s.align = "left"
+			case "end":
+				s.align = "right"
+			}
+		case "line-height":
+			if f, err := strconv.ParseFloat(v, 64); err == nil {
+				s.lineH = f
+			} else if l, ok := parseLength(v, s.size); ok && !l.percent {
+				s.lineH = l.value / s.size
+			} else if ok {
+				s.lineH = l.value / 100
+			} else if v == "normal" {
+				s.lineH = rootStyle.lineH
+			}
+		case "white-space":
+			s.pre = strings.HasPrefix(v, "pre")
+		case "list-style-type", "list-style":
+			s.listStyle = strings.Fields(v)[0]
+		case "margin":
+			s.margin = s.box(v, s.margin)
+		case "padding":
+			s.padding = s.box(v, s.padding)
+		case "margin-top", "margin-right", "margin-bottom", "margin-left":
+			s.margin[side(d.property)] = s.points(v)
+		case "padding-top", "padding-right", "padding-bottom", "padding-left":
+			s.padding[side(d.property)] = s.points(v)
+		case "border":
+			s.applyBorder(v)
+		case "border-width":
+			s.border = s.points(v)
+		case "border-color":
+			if c, ok := parseColor(v); ok {
+				s.borderColor = c
+			}
+		case "width":
+			s.width, _ = parseLength(v, s.size)
+		case "height":
+			s.height, _ = parseLength(v, s.size)
+		case "page-break-before", "break-before":
+			s.breakBefore = v == "always" || v == "page"
+		case "page-break-after", "break-after":
+			s.breakAfter = v == "always" || v == "page"
+		}
+	}
+}
+
+// applyFont reads the size and family of the font shorthand.
+func (s *style) applyFont(v string, parent style) {
+	fields := strings.Fields(v)
+	for i, f := range fields {
+		switch f {
+		case "bold", "bolder", "600", "700", "800", "900":
+			s.bold = true
+		case "italic", "oblique":
+			s.italic = true
+		default:
+			size := strings.SplitN(f, "/", 2)[0]
+			if l, ok := parseLength(size, parent.size); ok {
+				s.size = l.resolve(parent.size)
+				if fam := parseFamily(strings.Join(fields[i+1:], " ")); fam != "" {
+					s.family = fam
+				}
+				return
+			}
+		}
+	}
+}
+
+func (s *style) applyBorder(v string) {
+	if v == "none" || v == "0" {
+		s.border = 0
+		return
+	}
+	s.border = 0.75
+	s.borderColor = black
+	for _, f := range strings.Fields(v) {
+		if l, ok := parseLength(f, s.size); ok && !l.percent {
+			s.border = l.value
+		} else if c, ok := parseColor(f); ok {
+			s.borderColor = c
+		} else if f == "none" || f == "hidden" {
+			s.border = 0
+			return
+		}
+	}
+}
+
+// box reads the one to four value margin and padding shorthands.
+func (s *style) box(v string, current [4]float64) [4]float64 {
+	fields := strings.Fields(v)
+	var vs []float64
+	for _, f := range fields {
+		vs = append(vs, s.points(f))
+	}
+	switch len(vs) {
+	case 1:
+		return [4]float64{vs[0], vs[0], vs[0], vs[0]}
+	case 2:
+		return [4]float64{vs[0], vs[1], vs[0], vs[1]}
+	case 3:
+		return [4]float64{vs[0], vs[1], vs[2], vs[1]}
+	case 4:
+		return [4]float64{vs[0], vs[1], vs[2], vs[3]}
+	}
+	return current
+}
+
+// points resolves a length that can not be a percentage, auto is zero.
+func (s *style) points(v string) float64 {
+	l, ok := parseLength(v, s.size)
+	if !ok || l.percent {
+		return 0
+	}
+	return l.value
+}
+
+func side(property string) int {
+	switch {
+	case strings.HasSuffix(property, "top"):
+		return top
+	case strings.HasSuffix(property, "right"):
+		return right
+	case strings.HasSuffix(property, "bottom"):
+		return bottom
+	}
+	return left
+}
+
+var fontSizes = map[string]float64{
+	"xx-small": 7, "x-small": 7.5, "small": 10, "medium": 12, "large": 13.5, "x-large": 18, "xx-large": 24,
+}
+
+var units = map[string]float64{
+	"px": 0.75, "pt": 1, "pc": 12, "in": 72, "cm": 72 / 2.54, "mm": 72 / 25.4, "rem": 12,
+}
+
+// parseLength resolves a css length to points, em is relative to the given
+// font size.
+func parseLength(v string, em float64) (length, bool) {
+	v = strings.TrimSpace(v)
+	if v == "0" {
+		return length{set: true}, true
+	}
+	if strings.HasSuffix(v, "%") {
+		f, err := strconv.ParseFloat(strings.TrimSuffix(v, "%"), 64)
+		if err != nil {
+			return length{}, false
+		}
+		return length{value: f, percent: true, set: true}, true
+	}
+	if strings.HasSuffix(v, "em") && !strings.HasSuffix(v, "rem") {
+		f, err := strconv.ParseFloat(strings.TrimSuffix(v, "em"), 64)
+		if err != nil {
+			return length{}, false
+		}
+		return length{value: f * em, set: true}, true
+	}
+	for unit, factor := range units {
+		if strings.HasSuffix(v, unit) {
+			f, err := strconv.ParseFloat(strings.TrimSuffix(v, unit), 64)
+			if err != nil || math.IsNaN(f) {
+				return length{}, false
+			}
+			return length{value: f * factor, set: true}, true
+		}
+	}
+	return length{}, false
+}
+
+func parseFamily(v string) string {
+	for _, f := range strings.Split(v, ",") {
+		f = strings.Trim(strings.TrimSpace(f), `"'`)
+		switch {
+		case strings.Contains(f, "mono"), strings.Contains(f, "courier"), strings.Contains(f, "consol"):
+			return familyMono
+		case strings.Contains(f, "sans"), strings.Contains(f, "helvetica"), strings.Contains(f, "arial"), strings.Contains(f, "verdana"):
+			return familySans
+		case strings.Contains(f, "serif"), strings.Contains(f, "times"), strings.Contains(f, "georgia"):
+			return familySerif
+		}
+	}
+	return ""
+}
+
+var namedColors = map[string]rgb{
+	"black": {0, 0, 0}, "white": {1, 1, 1}, "red": {1, 0, 0}, "lime": {0, 1, 0},
+	"blue": {0, 0, 1}, "yellow": {1, 1, 0}, "aqua": {0, 1, 1}, "cyan": {0, 1, 1},
+	"fuchsia": {1, 0, 1}, "magenta": {1, 0, 1}, "silver": {0.75, 0.75, 0.75},
+	"gray": {0.5, 0.5, 0.5}, "grey": {0.5, 0.5, 0.5}, "maroon": {0.5, 0, 0},
+	"olive": {0.5, 0.5, 0}, "green": {0, 0.5, 0}, "purple": {0.5, 0, 0.5},
+	"teal": {0, 0.5, 0.5}, "navy": {0, 0, 0.5}, "orange": {1, 0.647, 0},
+	"lightgray": {0.827, 0.827, 0.827}, "lightgrey": {0.827, 0.827, 0.827},
+	"darkgray": {0.663, 0.663, 0.663}, "darkgrey": {0.663, 0.663, 0.663},
+	"whitesmoke": {0.961, 0.961, 0.961},
+}
+
+func parseColor(v string) (rgb, bool) {
+	if c, ok := namedColors[v]; ok {
+		return c, true
+	}
+	if strings.HasPrefix(v, "#") {
+		h := v[1:]
+		if len(h) == 3 {
+			h = string([]byte{h[0], h[0], h[1], h[1], h[2], h[2]})
+		}
+		if len(h) != 6 {
+			return rgb{}, false
+		}
+		n, err := strconv.ParseUint(h, 16, 32)
+		if err != nil {
+			return rgb{}, false
+		}
+		return rgb{float64(n>>16&0xff) / 255, float64(n>>8&0xff) / 255, float64(n&0xff) / 255}, true
+	}
+	if strings.HasPrefix(v, "rgb(") || strings.HasPrefix(v, "rgba(") {
+		inner := v[strings.IndexByte(v, '(')+1 : len(v)-1]
+		parts := strings.Split(inner, ",")
+		if len(parts) < 3 {
+			return rgb{}, false
+		}
+		var c [3]float64
+		for i := 0; i < 3; i++ {
+			p := strings.TrimSpace(parts[i])
+			f, err := strconv.ParseFloat(strings.TrimSuffix(p, "%"), 64)
+			if err != nil {
+				return rgb{}, false
+			}
+			if strings.HasSuffix(p, "%") {
+				f = f * 255 / 100
+			}
+			c[i] = math.Max(0, math.Min(255, f)) / 255
+		}
+		return rgb{c[0], c[1], c[2]}, true
+	}
+	return rgb{}, false
+}
@@ -0,0 +1,182 @@
+package htmlrender
+
+import (
+	"golang.org/x/net/html"
+	"math"
+	"strconv"
+	"strings"
+)
+
+type cell struct {
+	n    *html.Node
+	st   style
+	col  int
+	span int
+}
+
+type row struct {
+	st    style
+	cells []cell
+}
+
+// layoutTable lays out rows as single slices, so a row is never split
+// across pages. Columns share the table width equally unless cells of the
+// first row set a width.
+func (b *builder) layoutTable(n *html.Node, st style, x, w float64, f *flow) error {
+	var rows []row
+	var ncols int
+	var collect func(n *html.Node, st style) error
+	collect = func(n *html.Node, st style) error {
+		for c := n.FirstChild; c != nil; c = c.NextSibling {
+			if c.Type != html.ElementNode {
+				continue
+			}
+			cs := computeStyle(c, st, b.sheet)
+			if cs.display == displayNone {
+				continue
+			}
+			switch c.Data {
+			case "caption":
+				if err := b.layoutBlock(c, cs, x, w, f); err != nil {
+					return err
+				}
+			case "thead", "tbody", "tfoot":
+				if err := collect(c, cs); err != nil {
+					return err
+				}
+			case "tr":
+				r := row{st: cs}
+				col := 0
+				for td := c.FirstChild; td != nil; td = td.NextSibling {
+					if td.Type != html.ElementNode || (td.Data != "td" && td.Data != "th") {
+						continue
+					}
+					span, err := strconv.Atoi(attr(td, "colspan"))
+					if err != nil || span < 1 {
+						span = 1
+					}
+					r.cells = append(r.cells, cell{n: td, st: computeStyle(td, cs, b.sheet), col: col, span: span})
+					col += span
+				}
+				if col > ncols {
+					ncols = col
+				}
+				rows = append(rows, r)
+			}
+		}
+		return nil
+	}
+	if err := collect(n, st); err != nil {
+		return err
+	}
+	if ncols == 0 {
+		return nil
+	}
+
+	widths := columnWidths(rows[0], ncols, w)
+	lefts := make([]float64, ncols+1)
+	lefts[0] = x
+	for i, cw := range widths {
+		lefts[i+1] = lefts[i] + cw
+	}
+
+	for _, r := range rows {
+		if err := b.ctx.Err(); err != nil {
+			return err
+		}
+		type placed struct {
+			c      cell
+			ops    []drawOp
+			height float64
+		}
+		var cells []placed
+		rowH := 0.0
+		parent := b.open("TR")
+		for _, c := range r.cells {
+			end := c.col + c.span
+			if end > ncols {
+				end = ncols
+			}
+			cx, cw := lefts[c.col], lefts[end]-lefts[c.col]
+			ix := cx + c.st.border + c.st.padding[left]
+			iw := cw - 2*c.st.border - c.st.padding[left] - c.st.padding[right]
+
+			sub := &flow{}
+			bl := &block{f: sub, x: ix, w: iw, st: c.st}
+			row := b.open(strings.ToUpper(c.n.Data))
+			if err := b.layoutChildren(c.n, c.st, bl); err != nil {
+				return err
+			}
+			b.flush(bl)
+			b.elem = row
+			ops, h := flatten(sub)
+
+			h += 2*c.st.border + c.st.padding[top] + c.st.padding[bottom]
+			if c.st.height.set {
+				h = math.Max(h, c.st.height.value)
+			}
+			rowH = math.Max(rowH, h)
+			cells = append(cells, placed{c: c, ops: ops, height: h})
+		}
+		b.elem = parent
+
+		s := slice{height: rowH}
+		if r.st.background != nil {
+			s.ops = append(s.ops, drawOp{kind: opRect, x: x, y: 0, w: w, h: rowH, fill: r.st.background})
+		}
+		for _, p := range cells {
+			end := p.c.col + p.c.span
+			if end > ncols {
+				end = ncols
+			}
+			s.ops = append(s.ops, decoOps(deco{x: lefts[p.c.col], w: lefts[end] - lefts[p.c.col], fill: p.c.st.background, border: p.c.st.border, color: p.c.st.borderColor}, 0, rowH)...)
+			dy := p.c.st.border + p.c.st.padding[top]
+			for _, op := range p.ops {
+				op.y += dy
+				s.ops = append(s.ops, op)
+			}
+		}
+		f.add(s)
+	}
+	return nil
+}
+
+func columnWidths(first row, ncols int, w float64) []float64 {
+	widths := make([]float64, ncols)
+	fixed := make([]bool, ncols)
+	used := 0.0
+	for _, c := range first.cells {
+		if !c.st.width.set || c.col+c.span > ncols {
+			continue
+		}
+		cw := c.st.width.resolve(w) / float64(c.span)
+		for i := c.col; i < c.col+c.span; i++ {
+			widths[i], fixed[i] = cw, true
+			used += cw
+		}
+	}
+
+	free := 0
+	for _, f := range fixed {
+		if !f {
+			free++
+		}
+	}
+	if used > w || free == 0 {
+		// scale fixed columns to the table width
+		scale := w / used
+		if used == 0 {
+			scale = 1
+		}
+		for i := range widths {
+			widths[i] *= scale
+		}
+		return widths
+	}
+	for i := range widths {
+		if !fixed[i] {
+			widths[i] = (w - used) / float64(free)
+		}
+	}
+	return widths
+}
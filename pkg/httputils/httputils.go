@@ -6,7 +6,12 @@ import (
 	"fmt"
 	"github.com/go-chi/chi/v5/middleware"
 	"github.com/rengas/pdfgen/pkg/pagination"
+	"math"
+	"net"
 	"net/http"
+	"strconv"
+	"strings"
+	"time"
 )
 
 type OkResponse struct {
@@ -45,10 +50,39 @@ func NotFound(ctx context.Context, w http.ResponseWriter, err error) {
 	WriteJSON(ctx, w, ErrorResponse{Error: err}, http.StatusNotFound)
 }
 
+func NotAcceptable(ctx context.Context, w http.ResponseWriter, err error) {
+	WriteJSON(ctx, w, ErrorResponse{Error: err}, http.StatusNotAcceptable)
+}
+
 func Conflict(ctx context.Context, w http.ResponseWriter, err error) {
 	WriteJSON(ctx, w, ErrorResponse{Error: err}, http.StatusConflict)
 }
 
+// TooManyRequests writes a 429 with a Retry-After header rounded up to whole seconds.
+func TooManyRequests(ctx context.Context, w http.ResponseWriter, err error, retryAfter time.Duration) {
+	if retryAfter > 0 {
+		w.Header().Set("Retry-After", strconv.Itoa(int(math.Ceil(retryAfter.Seconds()))))
+	}
+	WriteJSON(ctx, w, ErrorResponse{Error: err}, http.StatusTooManyRequests)
+}
+
+// ServiceUnavailable writes a 503 with a Retry-After header rounded up to whole seconds.
+func ServiceUnavailable(ctx context.Context, w http.ResponseWriter, err error, retryAfter time.Duration) {
+	if retryAfter > 0 {
+		w.Header().Set("Retry-After", strconv.Itoa(int(math.Ceil(retryAfter.Seconds()))))
+	}
+	WriteJSON(ctx, w, ErrorResponse{Error: err}, http.StatusServiceUnavailable)
+}
+
+// ClientIP returns the host part of the request remote address.
+func ClientIP(r *http.Request) string {
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		return r.RemoteAddr
+	}
+	return host
+}
+
 func ReadJson(r *http.Request, v interface{}) error {
 	err := json.NewDecoder(r.Body).Decode(&v)
 	if err != nil {
@@ -76,6 +110,14 @@ func WriteFile(w http.ResponseWriter, b []byte, statusCode int) error {
 	return nil
 }
 
+// WriteContent writes b as the body of the given media type.
+func WriteContent(w http.ResponseWriter, contentType string, b []byte, statusCode int) error {
+	w.Header().Set("Content-Type", contentType)
+	w.WriteHeader(statusCode)
+	w.Write(b)
+	return nil
+}
+
 func WritePaginatedJSON(w http.ResponseWriter, pagination pagination.Pagination, v interface{}, statusCode int) error {
 	w.Header().Add("count", fmt.Sprintf("%d", pagination.Page))
 	w.Header().Add("total", fmt.Sprintf("%d", pagination.Total))
@@ -88,3 +130,52 @@ func WritePaginatedJSON(w http.ResponseWriter, pagination pagination.Pagination,
 	w.Write(b)
 	return nil
 }
+
+// Negotiate picks the offered media type the Accept header prefers, earlier
+// offers win ties. It returns the first offer when the header is empty and
+// false when no offer is acceptable.
+func Negotiate(accept string, offers ...string) (string, bool) {
+	if strings.TrimSpace(accept) == "" {
+		return offers[0], true
+	}
+
+	best, bestQ := "", 0.0
+	for _, offer := range offers {
+		q, specificity := 0.0, -1
+		for _, part := range strings.Split(accept, ",") {
+			fields := strings.Split(part, ";")
+			mediaRange := strings.ToLower(strings.TrimSpace(fields[0]))
+			s := matchMediaRange(mediaRange, offer)
+			if s <= specificity {
+				continue
+			}
+			specificity, q = s, 1
+			for _, f := range fields[1:] {
+				k, v, ok := strings.Cut(strings.TrimSpace(f), "=")
+				if ok && strings.TrimSpace(k) == "q" {
+					if pq, err := strconv.ParseFloat(strings.TrimSpace(v), 64); err == nil {
+						q = pq
+					}
+				}
+			}
+		}
+		if q > bestQ {
+			best, bestQ = offer, q
+		}
+	}
+	return best, best != ""
+}
+
+// matchMediaRange returns how specific the media range matches the media
+// type, -1 when it does not.
+func matchMediaRange(mediaRange, mediaType string) int {
+	switch {
+	case mediaRange == mediaType:
+		return 2
+	case mediaRange == "*/*":
+		return 0
+	case strings.HasSuffix(mediaRange, "/*") && strings.HasPrefix(mediaType, strings.TrimSuffix(mediaRange, "*")):
+		return 1
+	}
+	return -1
+}
@@ -0,0 +1,30 @@
+package httputils
+
+import "testing"
+
+func TestNegotiate(t *testing.T) {
+	offers := []string{"application/pdf", "image/png", "image/jpeg"}
+
+	tests := []struct {
+		name   string
+		accept string
+		want   string
+		wantOk bool
+	}{
+		{name: "no accept header", accept: "", want: "application/pdf", wantOk: true},
+		{name: "any type", accept: "*/*", want: "application/pdf", wantOk: true},
+		{name: "exact type", accept: "image/jpeg", want: "image/jpeg", wantOk: true},
+		{name: "type wildcard", accept: "image/*", want: "image/png", wantOk: true},
+		{name: "quality", accept: "image/png;q=0.5, image/jpeg", want: "image/jpeg", wantOk: true},
+		{name: "specific range overrides wildcard", accept: "image/*;q=0.9, image/png;q=0", want: "image/jpeg", wantOk: true},
+		{name: "case insensitive", accept: "Image/PNG", want: "image/png", wantOk: true},
+		{name: "nothing acceptable", accept: "application/json", wantOk: false},
+	}
+
+	for _, tc := range tests {
+		got, ok := Negotiate(tc.accept, offers...)
+		if got != tc.want || ok != tc.wantOk {
+			t.Fatalf("%s: expected: %v %v, got: %v %v", tc.name, tc.want, tc.wantOk, got, ok)
+		}
+	}
+}
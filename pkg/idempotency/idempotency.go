@@ -0,0 +1,308 @@
+package idempotency
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"github.com/rengas/pdfgen/pkg/contexts"
+	mkerror "github.com/rengas/pdfgen/pkg/errors"
+	"github.com/rengas/pdfgen/pkg/httputils"
+	"github.com/rengas/pdfgen/pkg/logging"
+	"io"
+	"net/http"
+	"sync"
+	"time"
+)
+
+const (
+	Header         = "Idempotency-Key"
+	ReplayedHeader = "Idempotent-Replayed"
+	maxKeyLength   = 255
+	// storeTimeout bounds storing the response, which outlives the request
+	storeTimeout = 5 * time.Second
+)
+
+var (
+	ErrRecordNotFound = errors.New("idempotency record not found")
+	errInProgress     = errors.New("idempotency key in progress")
+)
+
+// Record is the first response to a request with an idempotency key. Status
+// is zero while the request is still being handled.
+type Record struct {
+	Key         string
+	RequestHash string
+	Status      int
+	Header      http.Header
+	Body        []byte
+	CreatedAt   time.Time
+	LockedAt    time.Time
+}
+
+func (r Record) Done() bool {
+	return r.Status != 0
+}
+
+// Store keeps records. Acquire must be atomic: of concurrent calls for the
+// same key only one may acquire it.
+type Store interface {
+	// Acquire stores r as in progress and returns true, unless a record of
+	// the key already exists. Records created before expiredBefore and
+	// unfinished records locked before staleBefore are replaced.
+	Acquire(ctx context.Context, r Record, expiredBefore, staleBefore time.Time) (Record, bool, error)
+	// Complete and Delete only change the record while it is locked at
+	// lockedAt, a stale request must not touch the record of the request
+	// that replaced it. Complete returns ErrRecordNotFound otherwise.
+	Complete(ctx context.Context, key string, lockedAt time.Time, status int, header http.Header, body []byte) error
+	Delete(ctx context.Context, key string, lockedAt time.Time) error
+	DeleteExpired(ctx context.Context, before time.Time) error
+}
+
+type Config struct {
+	// TTL is how long a response is replayed.
+	TTL time.Duration
+	// LockTimeout is after how long an unfinished request is considered
+	// crashed and its key can be used again.
+	LockTimeout time.Duration
+	// Wait is how long a duplicate waits for the first request to finish.
+	Wait         time.Duration
+	PollInterval time.Duration
+}
+
+var DefaultConfig = Config{
+	TTL:          24 * time.Hour,
+	LockTimeout:  5 * time.Minute,
+	Wait:         30 * time.Second,
+	PollInterval: 100 * time.Millisecond,
+}
+
+type Middleware struct {
+	store  Store
+	config Config
+	clock  func() time.Time
+
+	mu       sync.Mutex
+	prunedAt time.Time
+}
+
+func NewMiddleware(store Store, config Config, clock func() time.Time) *Middleware {
+	if clock == nil {
+		clock = time.Now
+	}
+	return &Middleware{
+		store:  store,
+		config: config,
+		clock:  clock,
+	}
+}
+
+// Handle replays the first response of requests that repeat an
+// Idempotency-Key. Keys are scoped to the user, so it must run after
+// VerifyToken, requests without a key or user are passed through. Only
+// successful responses and client errors a retry would get again are
+// stored, other responses release the key so the request can be retried.
+func (m *Middleware) Handle(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		ctx := r.Context()
+		key := r.Header.Get(Header)
+		userId, err := contexts.UserIdFromContext(ctx)
+		if key == "" || err != nil {
+			next.ServeHTTP(w, r)
+			return
+		}
+		if len(key) > maxKeyLength {
+			httputils.UnProcessableEntity(ctx, w, mkerror.ErrIdempotencyKeyInvalid)
+			return
+		}
+
+		body, err := io.ReadAll(r.Body)
+		if err != nil {
+			logging.WithContext(ctx).WithError(err).Debug("unable to read request")
+			httputils.BadRequest(ctx, w, err)
+			return
+		}
+		r.Body = io.NopCloser(bytes.NewReader(body))
+
+		key = userId + ":" + key
+		hash := requestHash(r, body)
+		m.prune()
+
+		rec, acquired, err := m.acquire(ctx, key, hash)
+		if err != nil {
+			if errors.Is(err, errInProgress) {
+				httputils.Conflict(ctx, w, mkerror.ErrIdempotencyKeyInProgress)
+				return
+			}
+			logging.WithContext(ctx).WithError(err).Error("unable to acquire idempotency key")
+			httputils.InternalServerError(ctx, w, mkerror.ErrInternalError)
+			return
+		}
+		if !acquired {
+			if rec.RequestHash != hash {
+				httputils.UnProcessableEntity(ctx, w, mkerror.ErrIdempotencyKeyReused)
+				return
+			}
+			replay(w, rec)
+			return
+		}
+
+		before := w.Header().Clone()
+		rw := &recorder{ResponseWriter: w}
+		next.ServeHTTP(rw, r)
+
+		// the response is stored even when the client is gone, a lost
+		// response is what the retry is for
+		sctx, cancel := context.WithTimeout(detached{ctx}, storeTimeout)
+		defer cancel()
+		if storable(rw.status) {
+			err = m.store.Complete(sctx, key, rec.LockedAt, rw.status, handlerHeader(before, w.Header()), rw.body.Bytes())
+		} else {
+			err = m.store.Delete(sctx, key, rec.LockedAt)
+		}
+		if err != nil {
+			logging.WithContext(ctx).WithError(err).Error("unable to store idempotent response")
+		}
+	})
+}
+
+// acquire takes the key or returns its finished record, duplicates of a
+// request in progress wait for it to finish.
+func (m *Middleware) acquire(ctx context.Context, key, hash string) (Record, bool, error) {
+	deadline := m.clock().Add(m.config.Wait)
+	for {
+		// the lock time identifies the request holding the key, postgres
+		// keeps it in microseconds
+		now := m.clock().Truncate(time.Microsecond)
+		rec, acquired, err := m.store.Acquire(ctx,
+			Record{Key: key, RequestHash: hash, CreatedAt: now, LockedAt: now},
+			now.Add(-m.config.TTL),
+			now.Add(-m.config.LockTimeout))
+		if err == nil && (acquired || rec.Done() || rec.RequestHash != hash) {
+			return rec, acquired, nil
+		}
+		// the record was deleted after a failure between the insert and read
+		if err != nil && !errors.Is(err, ErrRecordNotFound) {
+			return Record{}, false, err
+		}
+		if now.After(deadline) {
+			return Record{}, false, errInProgress
+		}
+
+		select {
+		case <-ctx.Done():
+			return Record{}, false, ctx.Err()
+		case <-time.After(m.config.PollInterval):
+		}
+	}
+}
+
+// storable reports whether a response is replayed to retries. Server errors
+// and answers that depend on the moment, like conflicts and rate limits, are
+// not.
+func storable(status int) bool {
+	switch status {
+	case http.StatusRequestTimeout, http.StatusConflict, http.StatusLocked, http.StatusTooEarly, http.StatusTooManyRequests:
+		return false
+	}
+	return status >= 200 && status < 300 || status >= 400 && status < 500
+}
+
+// prune deletes expired records at most once per hour.
+func (m *Middleware) prune() {
+	now := m.clock()
+	m.mu.Lock()
+	if now.Sub(m.prunedAt) < time.Hour {
+		m.mu.Unlock()
+		return
+	}
+	m.prunedAt = now
+	m.mu.Unlock()
+
+	go func() {
+		err := m.store.DeleteExpired(context.Background(), now.Add(-m.config.TTL))
+		if err != nil {
+			logging.WithError(err).Error("unable to delete expired idempotency keys")
+		}
+	}()
+}
+
+// detached keeps the values of a context but not its cancellation.
+type detached struct {
+	context.Context
+}
+
+func (detached) Deadline() (time.Time, bool) {
+	return time.Time{}, false
+}
+
+func (detached) Done() <-chan struct{} {
+	return nil
+}
+
+func (detached) Err() error {
+	return nil
+}
+
+func requestHash(r *http.Request, body []byte) string {
+	h := sha256.New()
+	h.Write([]byte(r.Method + " " + r.URL.Path + "\n"))
+	h.Write(body)
+	return hex.EncodeToString(h.Sum(nil))
+}
+
+// handlerHeader returns the headers set by the handler itself, headers of
+// earlier middlewares and the request id belong to the request being handled.
+func handlerHeader(before, after http.Header) http.Header {
+	h := http.Header{}
+	for k, vs := range after {
+		if k == "X-Request-Id" || equal(before[k], vs) {
+			continue
+		}
+		h[k] = vs
+	}
+	return h
+}
+
+func equal(a, b []string) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
+
+func replay(w http.ResponseWriter, rec Record) {
+	for k, vs := range rec.Header {
+		w.Header()[k] = vs
+	}
+	w.Header().Set(ReplayedHeader, "true")
+	w.WriteHeader(rec.Status)
+	w.Write(rec.Body)
+}
+
+type recorder struct {
+	http.ResponseWriter
+	status int
+	body   bytes.Buffer
+}
+
+func (r *recorder) WriteHeader(status int) {
+	if r.status == 0 {
+		r.status = status
+	}
+	r.ResponseWriter.WriteHeader(status)
+}
+
+func (r *recorder) Write(b []byte) (int, error) {
+	if r.status == 0 {
+		r.status = http.StatusOK
+	}
+	r.body.Write(b)
+	return r.ResponseWriter.Write(b)
+}
@@ -0,0 +1,250 @@
+package idempotency
+
+import (
+	"context"
+	"github.com/rengas/pdfgen/pkg/contexts"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+func request(userId, key, body string) *http.Request {
+	ctx := context.Background()
+	if userId != "" {
+		ctx = contexts.WithUserId(ctx, userId)
+	}
+	req := httptest.NewRequest(http.MethodPost, "/design", strings.NewReader(body)).WithContext(ctx)
+	if key != "" {
+		req.Header.Set(Header, key)
+	}
+	return req
+}
+
+func TestMiddlewareReplay(t *testing.T) {
+	calls := 0
+	next := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		calls++
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusOK)
+		w.Write([]byte(`{"id":"` + strconv.Itoa(calls) + `"}`))
+	})
+	now := time.Date(2022, 9, 1, 10, 0, 0, 0, time.UTC)
+	handler := NewMiddleware(NewMemoryStore(), DefaultConfig, func() time.Time { return now }).Handle(next)
+
+	tests := []struct {
+		name         string
+		userId       string
+		key          string
+		body         string
+		advance      time.Duration
+		wantCode     int
+		wantBody     string
+		wantReplayed bool
+	}{
+		{name: "first request", userId: "user-1", key: "k1", body: `{"name":"a"}`, wantCode: http.StatusOK, wantBody: `{"id":"1"}`},
+		{name: "repeat is replayed", userId: "user-1", key: "k1", body: `{"name":"a"}`, wantCode: http.StatusOK, wantBody: `{"id":"1"}`, wantReplayed: true},
+		{name: "different body", userId: "user-1", key: "k1", body: `{"name":"b"}`, wantCode: http.StatusUnprocessableEntity},
+		{name: "keys are scoped to the user", userId: "user-2", key: "k1", body: `{"name":"a"}`, wantCode: http.StatusOK, wantBody: `{"id":"2"}`},
+		{name: "no key", userId: "user-1", body: `{"name":"a"}`, wantCode: http.StatusOK, wantBody: `{"id":"3"}`},
+		{name: "key too long", userId: "user-1", key: strings.Repeat("k", 256), wantCode: http.StatusUnprocessableEntity},
+		{name: "replayed within a day", userId: "user-1", key: "k1", body: `{"name":"a"}`, advance: 23 * time.Hour, wantCode: http.StatusOK, wantBody: `{"id":"1"}`, wantReplayed: true},
+		{name: "expired after a day", userId: "user-1", key: "k1", body: `{"name":"a"}`, advance: 2 * time.Hour, wantCode: http.StatusOK, wantBody: `{"id":"4"}`},
+	}
+
+	for _, tc := range tests {
+		now = now.Add(tc.advance)
+		rec := httptest.NewRecorder()
+		handler.ServeHTTP(rec, request(tc.userId, tc.key, tc.body))
+
+		if rec.Code != tc.wantCode {
+			t.Fatalf("%s: expected: %v, got: %v", tc.name, tc.wantCode, rec.Code)
+		}
+		if tc.wantBody != "" && rec.Body.String() != tc.wantBody {
+			t.Fatalf("%s: expected: %v, got: %v", tc.name, tc.wantBody, rec.Body.String())
+		}
+		if got := rec.Header().Get(ReplayedHeader) == "true"; got != tc.wantReplayed {
+			t.Fatalf("%s: expected replayed: %v, got: %v", tc.name, tc.wantReplayed, got)
+		}
+		if tc.wantReplayed && rec.Header().Get("Content-Type") != "application/json" {
+			t.Fatalf("%s: expected: %v, got: %v", tc.name, "application/json", rec.Header().Get("Content-Type"))
+		}
+	}
+}
+
+func TestMiddlewareTransientErrorIsNotStored(t *testing.T) {
+	tests := []struct {
+		name   string
+		status int
+		stored bool
+	}{
+		{name: "server error", status: http.StatusInternalServerError},
+		{name: "rate limited", status: http.StatusTooManyRequests},
+		{name: "conflict", status: http.StatusConflict},
+		{name: "validation error", status: http.StatusUnprocessableEntity, stored: true},
+	}
+
+	for _, tc := range tests {
+		calls := 0
+		next := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			calls++
+			if calls == 1 {
+				w.WriteHeader(tc.status)
+				return
+			}
+			w.Write([]byte("ok"))
+		})
+		handler := NewMiddleware(NewMemoryStore(), DefaultConfig, nil).Handle(next)
+
+		want := []int{tc.status, http.StatusOK, http.StatusOK}
+		wantCalls := 2
+		if tc.stored {
+			want = []int{tc.status, tc.status, tc.status}
+			wantCalls = 1
+		}
+		for _, code := range want {
+			rec := httptest.NewRecorder()
+			handler.ServeHTTP(rec, request("user-1", "k1", "{}"))
+			if rec.Code != code {
+				t.Fatalf("%s: expected: %v, got: %v", tc.name, code, rec.Code)
+			}
+		}
+		if calls != wantCalls {
+			t.Fatalf("%s: expected: %v, got: %v", tc.name, wantCalls, calls)
+		}
+	}
+}
+
+func TestMemoryStoreLockToken(t *testing.T) {
+	ctx := context.Background()
+	s := NewMemoryStore()
+	first := time.Date(2022, 9, 1, 10, 0, 0, 0, time.UTC)
+	second := first.Add(10 * time.Minute)
+
+	if _, ok, _ := s.Acquire(ctx, Record{Key: "k1", CreatedAt: first, LockedAt: first}, first, first); !ok {
+		t.Fatalf("expected: %v, got: %v", "first request acquires", ok)
+	}
+	// the first request is considered crashed and a retry takes the key over
+	if _, ok, _ := s.Acquire(ctx, Record{Key: "k1", CreatedAt: second, LockedAt: second}, first, second); !ok {
+		t.Fatalf("expected: %v, got: %v", "retry takes over the stale key", ok)
+	}
+
+	if err := s.Complete(ctx, "k1", first, http.StatusOK, nil, []byte("first")); err != ErrRecordNotFound {
+		t.Fatalf("expected: %v, got: %v", ErrRecordNotFound, err)
+	}
+	if err := s.Delete(ctx, "k1", first); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.Complete(ctx, "k1", second, http.StatusOK, nil, []byte("second")); err != nil {
+		t.Fatal(err)
+	}
+	rec, ok, _ := s.Acquire(ctx, Record{Key: "k1", CreatedAt: second, LockedAt: second}, first, second)
+	if ok || string(rec.Body) != "second" {
+		t.Fatalf("expected: %v, got: %v %s", "response of the retry", ok, rec.Body)
+	}
+}
+
+func TestMiddlewareConcurrentDuplicatesWait(t *testing.T) {
+	var mu sync.Mutex
+	calls := 0
+	release := make(chan struct{})
+	next := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		calls++
+		mu.Unlock()
+		<-release
+		w.Write([]byte("pdf"))
+	})
+	config := DefaultConfig
+	config.PollInterval = time.Millisecond
+	handler := NewMiddleware(NewMemoryStore(), config, nil).Handle(next)
+
+	var wg sync.WaitGroup
+	codes := make(chan int, 5)
+	for i := 0; i < 5; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			rec := httptest.NewRecorder()
+			handler.ServeHTTP(rec, request("user-1", "k1", "{}"))
+			if rec.Body.String() != "pdf" {
+				t.Errorf("expected: %v, got: %v", "pdf", rec.Body.String())
+			}
+			codes <- rec.Code
+		}()
+	}
+	time.Sleep(20 * time.Millisecond)
+	close(release)
+	wg.Wait()
+	close(codes)
+
+	for code := range codes {
+		if code != http.StatusOK {
+			t.Fatalf("expected: %v, got: %v", http.StatusOK, code)
+		}
+	}
+	if calls != 1 {
+		t.Fatalf("expected: %v, got: %v", 1, calls)
+	}
+}
+
+func TestMiddlewareDuplicateTimesOut(t *testing.T) {
+	store := NewMemoryStore()
+	config := DefaultConfig
+	config.Wait = 10 * time.Millisecond
+	config.PollInterval = time.Millisecond
+	handler := NewMiddleware(store, config, nil).Handle(http.NotFoundHandler())
+
+	// the first request is still in progress
+	req := request("user-1", "k1", "{}")
+	now := time.Now()
+	store.records["user-1:k1"] = Record{Key: "user-1:k1", RequestHash: requestHash(req, []byte("{}")), CreatedAt: now, LockedAt: now}
+
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, req)
+
+	if rec.Code != http.StatusConflict {
+		t.Fatalf("expected: %v, got: %v", http.StatusConflict, rec.Code)
+	}
+}
+
+// cancelAware fails like a database driver when the context is done.
+type cancelAware struct {
+	*MemoryStore
+}
+
+func (s cancelAware) Complete(ctx context.Context, key string, lockedAt time.Time, status int, header http.Header, body []byte) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	return s.MemoryStore.Complete(ctx, key, lockedAt, status, header, body)
+}
+
+func TestMiddlewareStoresResponseOfGoneClient(t *testing.T) {
+	calls := 0
+	var cancel context.CancelFunc
+	next := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		calls++
+		w.Write([]byte(`{"id":"` + strconv.Itoa(calls) + `"}`))
+		// the client drops the connection before the response is stored
+		cancel()
+	})
+	handler := NewMiddleware(cancelAware{NewMemoryStore()}, DefaultConfig, nil).Handle(next)
+
+	for _, want := range []string{`{"id":"1"}`, `{"id":"1"}`} {
+		req := request("user-1", "k1", "{}")
+		ctx, c := context.WithCancel(req.Context())
+		cancel = c
+		rec := httptest.NewRecorder()
+		handler.ServeHTTP(rec, req.WithContext(ctx))
+		if rec.Body.String() != want {
+			t.Fatalf("expected: %v, got: %v", want, rec.Body.String())
+		}
+	}
+	if calls != 1 {
+		t.Fatalf("expected: %v, got: %v", 1, calls)
+	}
+}
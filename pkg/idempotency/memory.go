@@ -0,0 +1,70 @@
+package idempotency
+
+import (
+	"context"
+	"net/http"
+	"sync"
+	"time"
+)
+
+// MemoryStore keeps records in process. A retry that reaches another replica,
+// or comes after a restart, is not recognised and runs the request again.
+type MemoryStore struct {
+	mu      sync.Mutex
+	records map[string]Record
+}
+
+func NewMemoryStore() *MemoryStore {
+	return &MemoryStore{
+		records: make(map[string]Record),
+	}
+}
+
+func (s *MemoryStore) Acquire(ctx context.Context, r Record, expiredBefore, staleBefore time.Time) (Record, bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	e, ok := s.records[r.Key]
+	if ok && !e.CreatedAt.Before(expiredBefore) && (e.Done() || !e.LockedAt.Before(staleBefore)) {
+		return e, false, nil
+	}
+	s.records[r.Key] = r
+	return r, true, nil
+}
+
+func (s *MemoryStore) Complete(ctx context.Context, key string, lockedAt time.Time, status int, header http.Header, body []byte) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	e, ok := s.records[key]
+	if !ok || !e.LockedAt.Equal(lockedAt) {
+		return ErrRecordNotFound
+	}
+	e.Status = status
+	e.Header = header
+	e.Body = body
+	s.records[key] = e
+	return nil
+}
+
+func (s *MemoryStore) Delete(ctx context.Context, key string, lockedAt time.Time) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if e, ok := s.records[key]; ok && e.LockedAt.Equal(lockedAt) {
+		delete(s.records, key)
+	}
+	return nil
+}
+
+func (s *MemoryStore) DeleteExpired(ctx context.Context, before time.Time) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for k, e := range s.records {
+		if e.CreatedAt.Before(before) {
+			delete(s.records, k)
+		}
+	}
+	return nil
+}
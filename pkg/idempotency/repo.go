@@ -0,0 +1,99 @@
+package idempotency
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"time"
+)
+
+// Repository is the Postgres Store, it lets duplicates hitting different api
+// replicas wait for each other.
+type Repository struct {
+	db *sql.DB
+}
+
+func NewRepository(db *sql.DB) *Repository {
+	return &Repository{
+		db: db,
+	}
+}
+
+func (r *Repository) Acquire(ctx context.Context, rec Record, expiredBefore, staleBefore time.Time) (Record, bool, error) {
+	q := `INSERT INTO idempotency_key(key, request_hash, created_at, locked_at) values($1, $2, $3, $4)
+		  ON CONFLICT (key) DO UPDATE SET
+		  	request_hash = $2, status = NULL, header = NULL, body = NULL, created_at = $3, locked_at = $4
+		  WHERE idempotency_key.created_at < $5 OR (idempotency_key.status IS NULL AND idempotency_key.locked_at < $6)`
+	res, err := r.db.ExecContext(ctx, q, rec.Key, rec.RequestHash, rec.CreatedAt, rec.LockedAt, expiredBefore, staleBefore)
+	if err != nil {
+		return Record{}, false, err
+	}
+	n, err := res.RowsAffected()
+	if err != nil {
+		return Record{}, false, err
+	}
+	if n == 1 {
+		return rec, true, nil
+	}
+
+	e, err := r.get(ctx, rec.Key)
+	if err != nil {
+		return Record{}, false, err
+	}
+	return e, false, nil
+}
+
+func (r *Repository) get(ctx context.Context, key string) (Record, error) {
+	q := `SELECT key, request_hash, status, header, body, created_at, locked_at FROM idempotency_key WHERE key = $1`
+
+	var e Record
+	var status sql.NullInt64
+	var header []byte
+	err := r.db.QueryRowContext(ctx, q, key).Scan(&e.Key, &e.RequestHash, &status, &header, &e.Body, &e.CreatedAt, &e.LockedAt)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return Record{}, ErrRecordNotFound
+		}
+		return Record{}, err
+	}
+	e.Status = int(status.Int64)
+	if header != nil {
+		err = json.Unmarshal(header, &e.Header)
+		if err != nil {
+			return Record{}, err
+		}
+	}
+	return e, nil
+}
+
+func (r *Repository) Complete(ctx context.Context, key string, lockedAt time.Time, status int, header http.Header, body []byte) error {
+	h, err := json.Marshal(header)
+	if err != nil {
+		return err
+	}
+	res, err := r.db.ExecContext(ctx, `UPDATE idempotency_key SET status = $3, header = $4, body = $5 WHERE key = $1 AND locked_at = $2`,
+		key, lockedAt, status, h, body)
+	if err != nil {
+		return err
+	}
+	n, err := res.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if n == 0 {
+		return ErrRecordNotFound
+	}
+	return nil
+}
+
+func (r *Repository) Delete(ctx context.Context, key string, lockedAt time.Time) error {
+	_, err := r.db.ExecContext(ctx, `DELETE FROM idempotency_key WHERE key = $1 AND locked_at = $2`, key, lockedAt)
+	return err
+}
+
+func (r *Repository) DeleteExpired(ctx context.Context, before time.Time) error {
+	_, err := r.db.ExecContext(ctx, `DELETE FROM idempotency_key WHERE created_at < $1`, before)
+	return err
+}
@@ -0,0 +1,219 @@
+package lockout
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"time"
+)
+
+var ErrEntryNotFound = errors.New("lockout entry not found")
+
+const (
+	accountPrefix = "account:"
+	ipPrefix      = "ip:"
+)
+
+// Entry is the failed attempt counter of a single key, an account or a client ip.
+type Entry struct {
+	Key           string    `json:"key"`
+	Failures      int       `json:"failures"`
+	Lockouts      int       `json:"lockouts"`
+	LockedUntil   time.Time `json:"lockedUntil"`
+	LastFailureAt time.Time `json:"lastFailureAt"`
+}
+
+// Store keeps failed attempt counters. Implementations must apply Fail
+// atomically per key so concurrent failures are all counted and lock the
+// key once.
+type Store interface {
+	// Fail applies Policy.Fail to the entry of key and returns the lockout
+	// duration, zero when the failure did not lock the key.
+	Fail(ctx context.Context, key string, p Policy, now time.Time) (time.Duration, error)
+	Get(ctx context.Context, key string) (Entry, error)
+	Reset(ctx context.Context, key string) error
+	ListLocked(ctx context.Context, now time.Time) ([]Entry, error)
+}
+
+// Policy configures when a key is locked and for how long. Every lockout of
+// the same key doubles the duration up to MaxLockout.
+type Policy struct {
+	MaxFailures int
+	Window      time.Duration
+	BaseLockout time.Duration
+	MaxLockout  time.Duration
+}
+
+func (p Policy) lockoutFor(lockouts int) time.Duration {
+	d := p.BaseLockout
+	for i := 0; i < lockouts && d < p.MaxLockout; i++ {
+		d *= 2
+	}
+	if d > p.MaxLockout {
+		d = p.MaxLockout
+	}
+	return d
+}
+
+// Fail records a failure at now, the failure count restarts when the
+// previous failure is older than Window. Reaching MaxFailures locks the entry
+// and starts a new count.
+func (p Policy) Fail(e Entry, now time.Time) (Entry, time.Duration) {
+	if now.Sub(e.LastFailureAt) > p.Window {
+		e.Failures = 0
+	}
+	e.Failures++
+	e.LastFailureAt = now
+	if e.Failures < p.MaxFailures {
+		return e, 0
+	}
+
+	d := p.lockoutFor(e.Lockouts)
+	e.Failures = 0
+	e.Lockouts++
+	e.LockedUntil = now.Add(d)
+	return e, d
+}
+
+// Event describes a lockout state change, it is passed to the listener so
+// lockouts and unlocks can be recorded.
+type Event struct {
+	Action string
+	Key    string
+	Until  time.Time
+}
+
+const (
+	ActionLocked   = "locked"
+	ActionUnlocked = "unlocked"
+)
+
+type Listener func(ctx context.Context, e Event)
+
+// Guard tracks failed logins per account and per client ip.
+type Guard struct {
+	store    Store
+	account  Policy
+	ip       Policy
+	clock    func() time.Time
+	listener Listener
+}
+
+func NewGuard(store Store, account, ip Policy, clock func() time.Time) *Guard {
+	if clock == nil {
+		clock = time.Now
+	}
+	return &Guard{
+		store:   store,
+		account: account,
+		ip:      ip,
+		clock:   clock,
+	}
+}
+
+// OnEvent registers a listener for lockouts and unlocks.
+func (g *Guard) OnEvent(l Listener) {
+	g.listener = l
+}
+
+func AccountKey(account string) string {
+	return accountPrefix + strings.ToLower(strings.TrimSpace(account))
+}
+
+func IPKey(ip string) string {
+	return ipPrefix + ip
+}
+
+// Check returns how long the caller has to wait when either the account or
+// the ip is locked, zero otherwise.
+func (g *Guard) Check(ctx context.Context, account, ip string) (time.Duration, error) {
+	now := g.clock()
+	var wait time.Duration
+	for _, key := range g.keys(account, ip) {
+		e, err := g.store.Get(ctx, key)
+		if err != nil {
+			if errors.Is(err, ErrEntryNotFound) {
+				continue
+			}
+			return 0, err
+		}
+		if d := e.LockedUntil.Sub(now); d > wait {
+			wait = d
+		}
+	}
+	return wait, nil
+}
+
+// Fail records a failed attempt and returns the lockout duration when it
+// caused the account or ip to be locked.
+func (g *Guard) Fail(ctx context.Context, account, ip string) (time.Duration, error) {
+	now := g.clock()
+	var wait time.Duration
+	for _, key := range g.keys(account, ip) {
+		d, err := g.store.Fail(ctx, key, g.policy(key), now)
+		if err != nil {
+			return 0, err
+		}
+		if d == 0 {
+			continue
+		}
+
+		g.emit(ctx, Event{Action: ActionLocked, Key: key, Until: now.Add(d)})
+		if d > wait {
+			wait = d
+		}
+	}
+	return wait, nil
+}
+
+// Succeed clears the account counter after a successful login. The ip counter
+// is kept so one valid account cannot be used to reset it.
+func (g *Guard) Succeed(ctx context.Context, account string) error {
+	if account == "" {
+		return nil
+	}
+	return g.store.Reset(ctx, AccountKey(account))
+}
+
+// Unlock clears a key, it is used by administrators.
+func (g *Guard) Unlock(ctx context.Context, key string) error {
+	_, err := g.store.Get(ctx, key)
+	if err != nil {
+		return err
+	}
+	err = g.store.Reset(ctx, key)
+	if err != nil {
+		return err
+	}
+	g.emit(ctx, Event{Action: ActionUnlocked, Key: key})
+	return nil
+}
+
+// Locked lists all keys that are currently locked.
+func (g *Guard) Locked(ctx context.Context) ([]Entry, error) {
+	return g.store.ListLocked(ctx, g.clock())
+}
+
+func (g *Guard) keys(account, ip string) []string {
+	keys := make([]string, 0, 2)
+	if account != "" {
+		keys = append(keys, AccountKey(account))
+	}
+	if ip != "" {
+		keys = append(keys, IPKey(ip))
+	}
+	return keys
+}
+
+func (g *Guard) policy(key string) Policy {
+	if strings.HasPrefix(key, ipPrefix) {
+		return g.ip
+	}
+	return g.account
+}
+
+func (g *Guard) emit(ctx context.Context, e Event) {
+	if g.listener != nil {
+		g.listener(ctx, e)
+	}
+}
@@ -0,0 +1,147 @@
+package lockout
+
+import (
+	"context"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestGuardExponentialLockout(t *testing.T) {
+	ctx := context.Background()
+	now := time.Date(2022, 9, 1, 10, 0, 0, 0, time.UTC)
+	clock := func() time.Time { return now }
+
+	account := Policy{MaxFailures: 3, Window: 15 * time.Minute, BaseLockout: time.Minute, MaxLockout: 3 * time.Minute}
+	ip := Policy{MaxFailures: 100, Window: 15 * time.Minute, BaseLockout: time.Minute, MaxLockout: time.Hour}
+
+	var events []Event
+	g := NewGuard(NewMemoryStore(), account, ip, clock)
+	g.OnEvent(func(ctx context.Context, e Event) { events = append(events, e) })
+
+	tests := []struct {
+		name     string
+		failures int
+		wantLock time.Duration
+	}{
+		{name: "first lockout uses base duration", failures: 3, wantLock: time.Minute},
+		{name: "second lockout doubles", failures: 3, wantLock: 2 * time.Minute},
+		{name: "third lockout is capped", failures: 3, wantLock: 3 * time.Minute},
+	}
+
+	for _, tc := range tests {
+		var got time.Duration
+		for i := 0; i < tc.failures; i++ {
+			d, err := g.Fail(ctx, "John@email.com", "10.0.0.1")
+			if err != nil {
+				t.Fatal(err)
+			}
+			if i < tc.failures-1 && d != 0 {
+				t.Fatalf("%s: locked after %d failures", tc.name, i+1)
+			}
+			got = d
+		}
+		if got != tc.wantLock {
+			t.Fatalf("%s: expected: %v, got: %v", tc.name, tc.wantLock, got)
+		}
+
+		wait, err := g.Check(ctx, "john@email.com", "10.0.0.2")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if wait != tc.wantLock {
+			t.Fatalf("%s: expected wait: %v, got: %v", tc.name, tc.wantLock, wait)
+		}
+		now = now.Add(wait)
+	}
+
+	if len(events) != 3 || events[0].Action != ActionLocked || events[0].Key != "account:john@email.com" {
+		t.Fatalf("unexpected events: %+v", events)
+	}
+}
+
+func TestGuardWindowAndUnlock(t *testing.T) {
+	ctx := context.Background()
+	now := time.Date(2022, 9, 1, 10, 0, 0, 0, time.UTC)
+	clock := func() time.Time { return now }
+
+	account := Policy{MaxFailures: 2, Window: time.Minute, BaseLockout: time.Minute, MaxLockout: time.Hour}
+	g := NewGuard(NewMemoryStore(), account, account, clock)
+
+	_, err := g.Fail(ctx, "john@email.com", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	now = now.Add(2 * time.Minute)
+	d, err := g.Fail(ctx, "john@email.com", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if d != 0 {
+		t.Fatalf("failures outside the window should not lock, got: %v", d)
+	}
+
+	d, err = g.Fail(ctx, "john@email.com", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if d != time.Minute {
+		t.Fatalf("expected: %v, got: %v", time.Minute, d)
+	}
+
+	locked, err := g.Locked(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(locked) != 1 {
+		t.Fatalf("expected one locked entry, got: %d", len(locked))
+	}
+
+	err = g.Unlock(ctx, locked[0].Key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	wait, err := g.Check(ctx, "john@email.com", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if wait != 0 {
+		t.Fatalf("expected no wait after unlock, got: %v", wait)
+	}
+
+	err = g.Unlock(ctx, "account:unknown@email.com")
+	if err != ErrEntryNotFound {
+		t.Fatalf("expected: %v, got: %v", ErrEntryNotFound, err)
+	}
+}
+
+func TestGuardConcurrentFailures(t *testing.T) {
+	now := time.Date(2022, 9, 1, 10, 0, 0, 0, time.UTC)
+	account := Policy{MaxFailures: 5, Window: time.Hour, BaseLockout: time.Minute, MaxLockout: time.Hour}
+	ip := Policy{MaxFailures: 1000, Window: time.Hour, BaseLockout: time.Minute, MaxLockout: time.Hour}
+	g := NewGuard(NewMemoryStore(), account, ip, func() time.Time { return now })
+
+	var mu sync.Mutex
+	locks := 0
+	g.OnEvent(func(ctx context.Context, e Event) {
+		mu.Lock()
+		locks++
+		mu.Unlock()
+	})
+
+	var wg sync.WaitGroup
+	for i := 0; i < 50; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if _, err := g.Fail(context.Background(), "john@email.com", "10.0.0.1"); err != nil {
+				t.Error(err)
+			}
+		}()
+	}
+	wg.Wait()
+
+	if locks != 10 {
+		t.Fatalf("expected: %v, got: %v", 10, locks)
+	}
+}
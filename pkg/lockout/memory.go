@@ -0,0 +1,68 @@
+package lockout
+
+import (
+	"context"
+	"sort"
+	"sync"
+	"time"
+)
+
+// MemoryStore keeps counters in process. Every replica counts only the
+// failures it sees, so attempts spread over replicas get MaxFailures once
+// per replica, and a restart unlocks all keys.
+type MemoryStore struct {
+	mu      sync.Mutex
+	entries map[string]Entry
+}
+
+func NewMemoryStore() *MemoryStore {
+	return &MemoryStore{
+		entries: make(map[string]Entry),
+	}
+}
+
+func (s *MemoryStore) Fail(ctx context.Context, key string, p Policy, now time.Time) (time.Duration, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	e, ok := s.entries[key]
+	if !ok {
+		e = Entry{Key: key}
+	}
+	e, d := p.Fail(e, now)
+	s.entries[key] = e
+	return d, nil
+}
+
+func (s *MemoryStore) Get(ctx context.Context, key string) (Entry, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	e, ok := s.entries[key]
+	if !ok {
+		return Entry{}, ErrEntryNotFound
+	}
+	return e, nil
+}
+
+func (s *MemoryStore) Reset(ctx context.Context, key string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	delete(s.entries, key)
+	return nil
+}
+
+func (s *MemoryStore) ListLocked(ctx context.Context, now time.Time) ([]Entry, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	var es []Entry
+	for _, e := range s.entries {
+		if e.LockedUntil.After(now) {
+			es = append(es, e)
+		}
+	}
+	sort.Slice(es, func(i, j int) bool { return es[i].LockedUntil.Before(es[j].LockedUntil) })
+	return es, nil
+}
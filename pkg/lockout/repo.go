@@ -0,0 +1,113 @@
+package lockout
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"time"
+)
+
+// Repository is the Postgres Store, it shares counters between api replicas.
+type Repository struct {
+	db *sql.DB
+}
+
+func NewRepository(db *sql.DB) *Repository {
+	return &Repository{
+		db: db,
+	}
+}
+
+// Fail locks the row of the key while the failure is counted, failures of the
+// same key on other replicas wait for each other.
+func (r *Repository) Fail(ctx context.Context, key string, p Policy, now time.Time) (time.Duration, error) {
+	tx, err := r.db.BeginTx(ctx, nil)
+	if err != nil {
+		return 0, err
+	}
+	defer tx.Rollback()
+
+	_, err = tx.ExecContext(ctx, `INSERT INTO login_attempt(key, failures, lockouts, locked_until, last_failure_at)
+		values($1, 0, 0, NULL, $2) ON CONFLICT DO NOTHING`, key, now)
+	if err != nil {
+		return 0, err
+	}
+
+	e, err := r.scan(tx.QueryRowContext(ctx, `SELECT key, failures, lockouts, locked_until, last_failure_at
+		FROM login_attempt WHERE key = $1 FOR UPDATE`, key))
+	// a row reset between the insert and the select starts a new count
+	if errors.Is(err, ErrEntryNotFound) {
+		e, err = Entry{Key: key}, nil
+	}
+	if err != nil {
+		return 0, err
+	}
+
+	e, d := p.Fail(e, now)
+	var lockedUntil sql.NullTime
+	if !e.LockedUntil.IsZero() {
+		lockedUntil = sql.NullTime{Time: e.LockedUntil, Valid: true}
+	}
+	_, err = tx.ExecContext(ctx, `INSERT INTO login_attempt(key, failures, lockouts, locked_until, last_failure_at)
+		values($1, $2, $3, $4, $5)
+		ON CONFLICT (key) DO UPDATE SET failures=$2, lockouts=$3, locked_until=$4, last_failure_at=$5`,
+		key, e.Failures, e.Lockouts, lockedUntil, e.LastFailureAt)
+	if err != nil {
+		return 0, err
+	}
+
+	return d, tx.Commit()
+}
+
+func (r *Repository) Get(ctx context.Context, key string) (Entry, error) {
+	q := `SELECT key, failures, lockouts, locked_until, last_failure_at FROM login_attempt WHERE key=$1`
+	return r.scan(r.db.QueryRowContext(ctx, q, key))
+}
+
+func (r *Repository) Reset(ctx context.Context, key string) error {
+	_, err := r.db.ExecContext(ctx, `DELETE FROM login_attempt WHERE key=$1`, key)
+	if err != nil {
+		return err
+	}
+	return nil
+}
+
+func (r *Repository) ListLocked(ctx context.Context, now time.Time) ([]Entry, error) {
+	q := `SELECT key, failures, lockouts, locked_until, last_failure_at
+		  FROM login_attempt WHERE locked_until > $1 ORDER BY locked_until`
+	rows, err := r.db.QueryContext(ctx, q, now)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var es []Entry
+	for rows.Next() {
+		e, err := r.scan(rows)
+		if err != nil {
+			return nil, err
+		}
+		es = append(es, e)
+	}
+	return es, rows.Err()
+}
+
+type scanner interface {
+	Scan(dest ...interface{}) error
+}
+
+func (r *Repository) scan(s scanner) (Entry, error) {
+	var e Entry
+	var lockedUntil sql.NullTime
+	err := s.Scan(&e.Key, &e.Failures, &e.Lockouts, &lockedUntil, &e.LastFailureAt)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return Entry{}, ErrEntryNotFound
+		}
+		return Entry{}, err
+	}
+	if lockedUntil.Valid {
+		e.LockedUntil = lockedUntil.Time
+	}
+	return e, nil
+}
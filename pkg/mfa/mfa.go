@@ -0,0 +1,53 @@
+package mfa
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base32"
+	"encoding/hex"
+	"strings"
+	"time"
+)
+
+const (
+	recoveryCodeCount = 10
+	recoveryCodeSize  = 5
+)
+
+var recoveryEncoding = base32.StdEncoding.WithPadding(base32.NoPadding)
+
+// MFA is the TOTP enrolment of a user. It only takes effect once Enabled is
+// set, which happens after the user confirms a first code.
+type MFA struct {
+	UserId       string     `json:"userId"`
+	Secret       string     `json:"-"`
+	Enabled      bool       `json:"enabled"`
+	LastUsedStep int64      `json:"-"`
+	ConfirmedAt  *time.Time `json:"confirmedAt"`
+	CreatedAt    time.Time  `json:"createdAt"`
+	UpdatedAt    time.Time  `json:"updatedAt"`
+}
+
+// GenerateRecoveryCodes returns a new set of single use recovery codes in
+// the form xxxx-xxxx. Only their hashes are stored.
+func GenerateRecoveryCodes() ([]string, error) {
+	codes := make([]string, 0, recoveryCodeCount)
+	for i := 0; i < recoveryCodeCount; i++ {
+		b := make([]byte, recoveryCodeSize)
+		_, err := rand.Read(b)
+		if err != nil {
+			return nil, err
+		}
+		s := strings.ToLower(recoveryEncoding.EncodeToString(b))
+		codes = append(codes, s[:4]+"-"+s[4:])
+	}
+	return codes, nil
+}
+
+// HashRecoveryCode normalises and hashes a recovery code. Codes carry 40 bits
+// of randomness and are single use, so a fast hash is sufficient.
+func HashRecoveryCode(code string) string {
+	c := strings.ToLower(strings.ReplaceAll(strings.TrimSpace(code), "-", ""))
+	sum := sha256.Sum256([]byte(c))
+	return hex.EncodeToString(sum[:])
+}
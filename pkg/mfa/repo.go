@@ -0,0 +1,214 @@
+package mfa
+
+import (
+	"context"
+	"database/sql"
+	"encoding/base64"
+	"errors"
+	"github.com/google/uuid"
+	"strings"
+	"time"
+)
+
+var (
+	ErrMFANotFound          = errors.New("mfa not found")
+	ErrRecoveryCodeNotFound = errors.New("recovery code not found")
+	ErrStepAlreadyUsed      = errors.New("totp code already used")
+)
+
+// sealedPrefix marks sealed secrets, secrets stored before they were sealed
+// are plain base32 and are sealed when they are read.
+const sealedPrefix = "sealed:"
+
+// Sealer encrypts the TOTP secrets at rest, certificate.Vault implements it.
+type Sealer interface {
+	SealBytes(plain []byte) ([]byte, error)
+	OpenBytes(b []byte) ([]byte, error)
+}
+
+type Repository struct {
+	db     *sql.DB
+	sealer Sealer
+}
+
+func NewRepository(db *sql.DB, sealer Sealer) *Repository {
+	return &Repository{
+		db:     db,
+		sealer: sealer,
+	}
+}
+
+// Save creates or replaces a pending enrolment for the user.
+func (r *Repository) Save(ctx context.Context, m MFA) error {
+	q := `INSERT INTO user_mfa(user_id, secret, enabled, last_used_step, created_at, updated_at)
+		  values($1, $2, false, 0, $3, $4)
+		  ON CONFLICT (user_id) DO UPDATE SET secret=$2, enabled=false, last_used_step=0, confirmed_at=NULL, updated_at=$4`
+	secret, err := r.seal(m.Secret)
+	if err != nil {
+		return err
+	}
+	_, err = r.db.ExecContext(ctx, q, m.UserId, secret, m.CreatedAt, m.UpdatedAt)
+	if err != nil {
+		return err
+	}
+	return nil
+}
+
+func (r *Repository) GetByUserId(ctx context.Context, userId string) (MFA, error) {
+	var m MFA
+	var stored string
+	q := `SELECT user_id, secret, enabled, last_used_step, confirmed_at, created_at, updated_at
+		  FROM user_mfa WHERE user_id = $1`
+	err := r.db.QueryRowContext(ctx, q, userId).
+		Scan(&m.UserId, &stored, &m.Enabled, &m.LastUsedStep, &m.ConfirmedAt, &m.CreatedAt, &m.UpdatedAt)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return MFA{}, ErrMFANotFound
+		}
+		return MFA{}, err
+	}
+
+	m.Secret, err = r.open(stored)
+	if err != nil {
+		return MFA{}, err
+	}
+	if !strings.HasPrefix(stored, sealedPrefix) {
+		sealed, err := r.seal(m.Secret)
+		if err != nil {
+			return MFA{}, err
+		}
+		_, err = r.db.ExecContext(ctx, `UPDATE user_mfa SET secret=$3 WHERE user_id=$1 and secret=$2`, userId, stored, sealed)
+		if err != nil {
+			return MFA{}, err
+		}
+	}
+	return m, nil
+}
+
+func (r *Repository) seal(secret string) (string, error) {
+	b, err := r.sealer.SealBytes([]byte(secret))
+	if err != nil {
+		return "", err
+	}
+	return sealedPrefix + base64.StdEncoding.EncodeToString(b), nil
+}
+
+func (r *Repository) open(stored string) (string, error) {
+	if !strings.HasPrefix(stored, sealedPrefix) {
+		return stored, nil
+	}
+	b, err := base64.StdEncoding.DecodeString(strings.TrimPrefix(stored, sealedPrefix))
+	if err != nil {
+		return "", err
+	}
+	secret, err := r.sealer.OpenBytes(b)
+	if err != nil {
+		return "", err
+	}
+	return string(secret), nil
+}
+
+// Enable marks the enrolment as confirmed and replaces the recovery codes.
+func (r *Repository) Enable(ctx context.Context, userId string, step int64, codeHashes []string, at time.Time) error {
+	tx, err := r.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	_, err = tx.ExecContext(ctx, `UPDATE user_mfa SET enabled=true, last_used_step=$2, confirmed_at=$3, updated_at=$3 WHERE user_id=$1`,
+		userId, step, at)
+	if err != nil {
+		return err
+	}
+
+	err = replaceRecoveryCodes(ctx, tx, userId, codeHashes, at)
+	if err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+// ReplaceRecoveryCodes invalidates all existing recovery codes of the user.
+func (r *Repository) ReplaceRecoveryCodes(ctx context.Context, userId string, codeHashes []string, at time.Time) error {
+	tx, err := r.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	err = replaceRecoveryCodes(ctx, tx, userId, codeHashes, at)
+	if err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+func replaceRecoveryCodes(ctx context.Context, tx *sql.Tx, userId string, codeHashes []string, at time.Time) error {
+	_, err := tx.ExecContext(ctx, `DELETE FROM user_recovery_code WHERE user_id=$1`, userId)
+	if err != nil {
+		return err
+	}
+	for _, h := range codeHashes {
+		_, err = tx.ExecContext(ctx, `INSERT INTO user_recovery_code(id, user_id, code_hash, created_at) values($1, $2, $3, $4)`,
+			uuid.NewString(), userId, h, at)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// UseStep records step as the last accepted TOTP time step. It fails when a
+// code for the same or a later step was already accepted, preventing replay.
+func (r *Repository) UseStep(ctx context.Context, userId string, step int64) error {
+	res, err := r.db.ExecContext(ctx, `UPDATE user_mfa SET last_used_step=$2 WHERE user_id=$1 and last_used_step < $2`, userId, step)
+	if err != nil {
+		return err
+	}
+	n, err := res.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if n == 0 {
+		return ErrStepAlreadyUsed
+	}
+	return nil
+}
+
+// UseRecoveryCode consumes an unused recovery code.
+func (r *Repository) UseRecoveryCode(ctx context.Context, userId, codeHash string, at time.Time) error {
+	res, err := r.db.ExecContext(ctx, `UPDATE user_recovery_code SET used_at=$3 WHERE user_id=$1 and code_hash=$2 and used_at is NULL`,
+		userId, codeHash, at)
+	if err != nil {
+		return err
+	}
+	n, err := res.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if n == 0 {
+		return ErrRecoveryCodeNotFound
+	}
+	return nil
+}
+
+func (r *Repository) Delete(ctx context.Context, userId string) error {
+	tx, err := r.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	_, err = tx.ExecContext(ctx, `DELETE FROM user_recovery_code WHERE user_id=$1`, userId)
+	if err != nil {
+		return err
+	}
+	_, err = tx.ExecContext(ctx, `DELETE FROM user_mfa WHERE user_id=$1`, userId)
+	if err != nil {
+		return err
+	}
+	return tx.Commit()
+}
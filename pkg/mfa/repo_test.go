@@ -0,0 +1,49 @@
+package mfa
+
+import (
+	"github.com/rengas/pdfgen/pkg/certificate"
+	"strings"
+	"testing"
+)
+
+func vault(t *testing.T, secret string) *certificate.Vault {
+	v, err := certificate.NewVault(secret)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return v
+}
+
+func TestSealSecret(t *testing.T) {
+	r := NewRepository(nil, vault(t, "server secret"))
+
+	sealed, err := r.seal("JBSWY3DPEHPK3PXP")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.HasPrefix(sealed, sealedPrefix) || strings.Contains(sealed, "JBSWY3DPEHPK3PXP") || len(sealed) > 256 {
+		t.Fatalf("expected: %v, got: %v", "sealed secret", sealed)
+	}
+
+	tests := []struct {
+		name    string
+		stored  string
+		want    string
+		wantErr error
+	}{
+		{name: "sealed", stored: sealed, want: "JBSWY3DPEHPK3PXP"},
+		{name: "stored before sealing", stored: "JBSWY3DPEHPK3PXP", want: "JBSWY3DPEHPK3PXP"},
+	}
+
+	for _, tc := range tests {
+		got, err := r.open(tc.stored)
+		if got != tc.want || err != tc.wantErr {
+			t.Fatalf("%s: expected: %v %v, got: %v %v", tc.name, tc.want, tc.wantErr, got, err)
+		}
+	}
+
+	other := NewRepository(nil, vault(t, "other secret"))
+	if _, err := other.open(sealed); err != certificate.ErrSealed {
+		t.Fatalf("expected: %v, got: %v", certificate.ErrSealed, err)
+	}
+}
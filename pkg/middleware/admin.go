@@ -0,0 +1,48 @@
+package middleware
+
+import (
+	"context"
+	"github.com/rengas/pdfgen/pkg/contexts"
+	mkerror "github.com/rengas/pdfgen/pkg/errors"
+	"github.com/rengas/pdfgen/pkg/httputils"
+	"github.com/rengas/pdfgen/pkg/user"
+	"net/http"
+)
+
+type UserRepository interface {
+	GetById(ctx context.Context, id string) (user.User, error)
+}
+
+type AdminMiddleware struct {
+	userRepo UserRepository
+}
+
+func NewAdmin(userRepo UserRepository) *AdminMiddleware {
+	return &AdminMiddleware{
+		userRepo: userRepo,
+	}
+}
+
+// RequireAdmin only lets requests of admin users through, it must run after VerifyToken.
+func (a AdminMiddleware) RequireAdmin(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		ctx := r.Context()
+		userId, err := contexts.UserIdFromContext(ctx)
+		if err != nil {
+			httputils.UnAuthorized(ctx, w, mkerror.ErrUnAuthorizedError)
+			return
+		}
+
+		u, err := a.userRepo.GetById(ctx, userId)
+		if err != nil {
+			httputils.Forbidden(ctx, w, mkerror.ErrAdminUserNotFound)
+			return
+		}
+		if u.Role != user.RoleAdmin {
+			httputils.Forbidden(ctx, w, mkerror.ErrNotAdminUser)
+			return
+		}
+
+		next.ServeHTTP(w, r)
+	})
+}
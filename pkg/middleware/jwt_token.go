@@ -49,6 +49,9 @@ func (j JWTMiddleware) VerifyToken(next http.Handler) http.Handler {
 		}
 
 		ctx = contexts.WithUserId(ctx, userId)
+		if orgId, ok := c["orgId"].(string); ok && orgId != "" {
+			ctx = contexts.WithOrganizationId(ctx, orgId)
+		}
 		next.ServeHTTP(w, r.WithContext(ctx))
 	})
 }
@@ -0,0 +1,72 @@
+package middleware
+
+import (
+	"context"
+	"errors"
+	"github.com/rengas/pdfgen/pkg/contexts"
+	mkerror "github.com/rengas/pdfgen/pkg/errors"
+	"github.com/rengas/pdfgen/pkg/httputils"
+	"github.com/rengas/pdfgen/pkg/logging"
+	"github.com/rengas/pdfgen/pkg/organization"
+	"net/http"
+)
+
+// OrganizationHeader selects the active organization of a request, it takes
+// precedence over the orgId claim of the token.
+const OrganizationHeader = "X-Organization-Id"
+
+type MemberRepository interface {
+	GetMember(ctx context.Context, organizationId, userId string) (organization.Member, error)
+}
+
+type OrganizationMiddleware struct {
+	members MemberRepository
+}
+
+func NewOrganization(members MemberRepository) *OrganizationMiddleware {
+	return &OrganizationMiddleware{
+		members: members,
+	}
+}
+
+// ActiveOrganization resolves the organization a request acts in and puts
+// the role of the user in it into the context. Requests without an
+// organization act in the personal workspace. It must run after VerifyToken.
+func (o OrganizationMiddleware) ActiveOrganization(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		ctx := r.Context()
+		userId, err := contexts.UserIdFromContext(ctx)
+		if err != nil {
+			httputils.UnAuthorized(ctx, w, mkerror.ErrUnAuthorizedError)
+			return
+		}
+
+		orgId := r.Header.Get(OrganizationHeader)
+		if orgId == "" {
+			orgId, _ = contexts.OrganizationIdFromContext(ctx)
+		}
+		if orgId == "" {
+			next.ServeHTTP(w, r)
+			return
+		}
+		if !organization.ValidId(orgId) {
+			httputils.BadRequest(ctx, w, mkerror.ErrOrganizationIdInvalid)
+			return
+		}
+
+		m, err := o.members.GetMember(ctx, orgId, userId)
+		if err != nil {
+			if errors.Is(err, organization.ErrMemberNotFound) {
+				httputils.Forbidden(ctx, w, mkerror.ErrNotOrganizationMember)
+				return
+			}
+			logging.WithContext(ctx).WithError(err).Error("unable to get organization member")
+			httputils.InternalServerError(ctx, w, mkerror.ErrInternalError)
+			return
+		}
+
+		ctx = contexts.WithOrganizationId(ctx, m.OrganizationId)
+		ctx = contexts.WithOrganizationRole(ctx, string(m.Role))
+		next.ServeHTTP(w, r.WithContext(ctx))
+	})
+}
@@ -0,0 +1,70 @@
+package middleware
+
+import (
+	"context"
+	"github.com/rengas/pdfgen/pkg/contexts"
+	"github.com/rengas/pdfgen/pkg/organization"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+type fakeMembers map[string]organization.Role
+
+func (f fakeMembers) GetMember(ctx context.Context, organizationId, userId string) (organization.Member, error) {
+	role, ok := f[organizationId+"/"+userId]
+	if !ok {
+		return organization.Member{}, organization.ErrMemberNotFound
+	}
+	return organization.Member{OrganizationId: organizationId, UserId: userId, Role: role}, nil
+}
+
+func TestActiveOrganization(t *testing.T) {
+	const orgA, orgB, orgC = "5b0d3a4e-54c2-4c4a-9a57-4f2d0b1c8e21", "0f6c3d1e-2b8a-4e55-9d3c-7a1b2c3d4e5f", "9a8b7c6d-5e4f-4a3b-8c2d-1e0f9a8b7c6d"
+	members := fakeMembers{
+		orgA + "/user-1": organization.RoleEditor,
+		orgB + "/user-1": organization.RoleViewer,
+	}
+
+	tests := []struct {
+		name     string
+		header   string
+		claim    string
+		wantCode int
+		wantOrg  string
+		wantRole string
+	}{
+		{name: "personal workspace", wantCode: http.StatusOK},
+		{name: "organization from claim", claim: orgA, wantCode: http.StatusOK, wantOrg: orgA, wantRole: "editor"},
+		{name: "header overrides claim", claim: orgA, header: orgB, wantCode: http.StatusOK, wantOrg: orgB, wantRole: "viewer"},
+		{name: "not a member", header: orgC, wantCode: http.StatusForbidden},
+		{name: "not a uuid", header: "org-a", wantCode: http.StatusBadRequest},
+	}
+
+	for _, tc := range tests {
+		var gotOrg, gotRole string
+		next := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			gotOrg, _ = contexts.OrganizationIdFromContext(r.Context())
+			gotRole, _ = contexts.OrganizationRoleFromContext(r.Context())
+		})
+
+		ctx := contexts.WithUserId(context.Background(), "user-1")
+		if tc.claim != "" {
+			ctx = contexts.WithOrganizationId(ctx, tc.claim)
+		}
+		req := httptest.NewRequest(http.MethodGet, "/design", nil).WithContext(ctx)
+		if tc.header != "" {
+			req.Header.Set(OrganizationHeader, tc.header)
+		}
+		rec := httptest.NewRecorder()
+
+		NewOrganization(members).ActiveOrganization(next).ServeHTTP(rec, req)
+
+		if rec.Code != tc.wantCode {
+			t.Fatalf("%s: expected: %v, got: %v", tc.name, tc.wantCode, rec.Code)
+		}
+		if gotOrg != tc.wantOrg || gotRole != tc.wantRole {
+			t.Fatalf("%s: expected: %s/%s, got: %s/%s", tc.name, tc.wantOrg, tc.wantRole, gotOrg, gotRole)
+		}
+	}
+}
@@ -0,0 +1,67 @@
+package middleware
+
+import (
+	"context"
+	"github.com/rengas/pdfgen/pkg/contexts"
+	mkerror "github.com/rengas/pdfgen/pkg/errors"
+	"github.com/rengas/pdfgen/pkg/httputils"
+	"github.com/rengas/pdfgen/pkg/logging"
+	"github.com/rengas/pdfgen/pkg/ratelimit"
+	"net/http"
+	"strconv"
+)
+
+const (
+	RateLimitLimitHeader     = "X-RateLimit-Limit"
+	RateLimitRemainingHeader = "X-RateLimit-Remaining"
+	RateLimitResetHeader     = "X-RateLimit-Reset"
+)
+
+type RateLimiter interface {
+	Allow(ctx context.Context, key string, limit ratelimit.Limit) (ratelimit.Result, error)
+}
+
+type RateLimitMiddleware struct {
+	limiter RateLimiter
+}
+
+func NewRateLimit(limiter RateLimiter) *RateLimitMiddleware {
+	return &RateLimitMiddleware{
+		limiter: limiter,
+	}
+}
+
+// Limit returns a middleware that limits requests of a route group. Requests
+// are counted per user when it runs after VerifyToken and per client ip
+// otherwise, every group has its own buckets. When the store is unavailable
+// requests are let through rather than failing the whole api.
+func (rl RateLimitMiddleware) Limit(group string, limit ratelimit.Limit) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			ctx := r.Context()
+			res, err := rl.limiter.Allow(ctx, group+":"+rateLimitKey(r), limit)
+			if err != nil {
+				logging.WithContext(ctx).WithError(err).Error("unable to check rate limit")
+				next.ServeHTTP(w, r)
+				return
+			}
+
+			w.Header().Set(RateLimitLimitHeader, strconv.Itoa(res.Limit))
+			w.Header().Set(RateLimitRemainingHeader, strconv.Itoa(res.Remaining))
+			w.Header().Set(RateLimitResetHeader, strconv.FormatInt(res.Reset.Unix(), 10))
+			if !res.Allowed {
+				httputils.TooManyRequests(ctx, w, mkerror.ErrRateLimited, res.RetryAfter)
+				return
+			}
+
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+func rateLimitKey(r *http.Request) string {
+	if userId, err := contexts.UserIdFromContext(r.Context()); err == nil && userId != "" {
+		return "user:" + userId
+	}
+	return "ip:" + httputils.ClientIP(r)
+}
@@ -0,0 +1,63 @@
+package middleware
+
+import (
+	"context"
+	"github.com/rengas/pdfgen/pkg/contexts"
+	"github.com/rengas/pdfgen/pkg/ratelimit"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestRateLimit(t *testing.T) {
+	now := time.Date(2022, 9, 1, 10, 0, 0, 0, time.UTC)
+	limiter := ratelimit.NewLimiter(ratelimit.NewMemoryStore(), func() time.Time { return now })
+	limit := NewRateLimit(limiter).Limit("generate", ratelimit.Limit{Requests: 2, Per: time.Minute})
+	handler := limit(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+
+	tests := []struct {
+		name          string
+		userId        string
+		ip            string
+		wantCode      int
+		wantRemaining string
+		wantRetry     string
+	}{
+		{name: "first request of user", userId: "user-1", ip: "10.0.0.1:1234", wantCode: http.StatusOK, wantRemaining: "1"},
+		{name: "user keyed across ips", userId: "user-1", ip: "10.0.0.2:1234", wantCode: http.StatusOK, wantRemaining: "0"},
+		{name: "user limited", userId: "user-1", ip: "10.0.0.3:1234", wantCode: http.StatusTooManyRequests, wantRemaining: "0", wantRetry: "30"},
+		{name: "other user", userId: "user-2", ip: "10.0.0.1:1234", wantCode: http.StatusOK, wantRemaining: "1"},
+		{name: "anonymous keyed by ip", ip: "10.0.0.1:1234", wantCode: http.StatusOK, wantRemaining: "1"},
+		{name: "anonymous same ip", ip: "10.0.0.1:4321", wantCode: http.StatusOK, wantRemaining: "0"},
+		{name: "anonymous limited", ip: "10.0.0.1:1234", wantCode: http.StatusTooManyRequests, wantRemaining: "0", wantRetry: "30"},
+	}
+
+	for _, tc := range tests {
+		ctx := context.Background()
+		if tc.userId != "" {
+			ctx = contexts.WithUserId(ctx, tc.userId)
+		}
+		req := httptest.NewRequest(http.MethodPost, "/generate", nil).WithContext(ctx)
+		req.RemoteAddr = tc.ip
+		rec := httptest.NewRecorder()
+
+		handler.ServeHTTP(rec, req)
+
+		if rec.Code != tc.wantCode {
+			t.Fatalf("%s: expected: %v, got: %v", tc.name, tc.wantCode, rec.Code)
+		}
+		if got := rec.Header().Get(RateLimitLimitHeader); got != "2" {
+			t.Fatalf("%s: expected limit: %v, got: %v", tc.name, "2", got)
+		}
+		if got := rec.Header().Get(RateLimitRemainingHeader); got != tc.wantRemaining {
+			t.Fatalf("%s: expected remaining: %v, got: %v", tc.name, tc.wantRemaining, got)
+		}
+		if got := rec.Header().Get(RateLimitResetHeader); got == "" {
+			t.Fatalf("%s: expected reset header, got none", tc.name)
+		}
+		if got := rec.Header().Get("Retry-After"); got != tc.wantRetry {
+			t.Fatalf("%s: expected retry after: %v, got: %v", tc.name, tc.wantRetry, got)
+		}
+	}
+}
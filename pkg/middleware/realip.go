@@ -0,0 +1,104 @@
+package middleware
+
+import (
+	"errors"
+	"net"
+	"net/http"
+	"strings"
+)
+
+var ErrInvalidProxy = errors.New("trusted proxies are ip addresses or cidr ranges")
+
+// RealIPMiddleware sets the remote address of requests to the client ip the
+// proxies in front of the api report. The headers are only trusted when the
+// request comes from a trusted proxy, anyone else could pick the ip the
+// lockout, rate limits and audit log see.
+type RealIPMiddleware struct {
+	trusted []*net.IPNet
+}
+
+func NewRealIP(trusted []*net.IPNet) *RealIPMiddleware {
+	return &RealIPMiddleware{
+		trusted: trusted,
+	}
+}
+
+// ParseProxies parses a comma separated list of ip addresses and cidr
+// ranges, e.g. "10.0.0.0/8,127.0.0.1".
+func ParseProxies(s string) ([]*net.IPNet, error) {
+	var nets []*net.IPNet
+	for _, p := range strings.Split(s, ",") {
+		p = strings.TrimSpace(p)
+		if p == "" {
+			continue
+		}
+		if !strings.Contains(p, "/") {
+			ip := net.ParseIP(p)
+			if ip == nil {
+				return nil, ErrInvalidProxy
+			}
+			bits := 8 * len(ip.To16())
+			if ip.To4() != nil {
+				ip, bits = ip.To4(), 32
+			}
+			nets = append(nets, &net.IPNet{IP: ip, Mask: net.CIDRMask(bits, bits)})
+			continue
+		}
+		_, n, err := net.ParseCIDR(p)
+		if err != nil {
+			return nil, ErrInvalidProxy
+		}
+		nets = append(nets, n)
+	}
+	return nets, nil
+}
+
+// RealIP takes the client ip from X-Forwarded-For, the last address that is
+// not a trusted proxy as proxies append the address they were reached from,
+// or from X-Real-IP. Requests from other peers keep their remote address.
+func (rip RealIPMiddleware) RealIP(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		host, _, err := net.SplitHostPort(r.RemoteAddr)
+		if err != nil {
+			host = r.RemoteAddr
+		}
+		if !rip.isTrusted(host) {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		client := ""
+		if xff := r.Header.Get("X-Forwarded-For"); xff != "" {
+			hops := strings.Split(xff, ",")
+			for i := len(hops) - 1; i >= 0; i-- {
+				hop := strings.TrimSpace(hops[i])
+				if net.ParseIP(hop) == nil {
+					break
+				}
+				client = hop
+				if !rip.isTrusted(hop) {
+					break
+				}
+			}
+		} else if xrip := strings.TrimSpace(r.Header.Get("X-Real-IP")); net.ParseIP(xrip) != nil {
+			client = xrip
+		}
+		if client != "" {
+			r.RemoteAddr = client
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+func (rip RealIPMiddleware) isTrusted(host string) bool {
+	ip := net.ParseIP(host)
+	if ip == nil {
+		return false
+	}
+	for _, n := range rip.trusted {
+		if n.Contains(ip) {
+			return true
+		}
+	}
+	return false
+}
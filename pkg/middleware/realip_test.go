@@ -0,0 +1,56 @@
+package middleware
+
+import (
+	"github.com/rengas/pdfgen/pkg/httputils"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestRealIP(t *testing.T) {
+	trusted, err := ParseProxies("10.0.0.0/8, 127.0.0.1")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name      string
+		peer      string
+		forwarded string
+		realIP    string
+		want      string
+	}{
+		{name: "direct client", peer: "203.0.113.7:4321", want: "203.0.113.7"},
+		{name: "spoofed by direct client", peer: "203.0.113.7:4321", forwarded: "198.51.100.1", realIP: "198.51.100.2", want: "203.0.113.7"},
+		{name: "forwarded by proxy", peer: "10.0.0.5:80", forwarded: "198.51.100.1", want: "198.51.100.1"},
+		{name: "client prepends spoofed hop", peer: "10.0.0.5:80", forwarded: "192.0.2.9, 198.51.100.1", want: "198.51.100.1"},
+		{name: "chain of proxies", peer: "127.0.0.1:80", forwarded: "198.51.100.1, 10.0.0.6", want: "198.51.100.1"},
+		{name: "real ip header", peer: "10.0.0.5:80", realIP: "198.51.100.2", want: "198.51.100.2"},
+		{name: "garbage header", peer: "10.0.0.5:80", forwarded: "not-an-ip", want: "10.0.0.5"},
+	}
+
+	for _, tc := range tests {
+		var got string
+		next := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			got = httputils.ClientIP(r)
+		})
+		req := httptest.NewRequest(http.MethodPost, "/login", nil)
+		req.RemoteAddr = tc.peer
+		if tc.forwarded != "" {
+			req.Header.Set("X-Forwarded-For", tc.forwarded)
+		}
+		if tc.realIP != "" {
+			req.Header.Set("X-Real-IP", tc.realIP)
+		}
+
+		NewRealIP(trusted).RealIP(next).ServeHTTP(httptest.NewRecorder(), req)
+
+		if got != tc.want {
+			t.Fatalf("%s: expected: %v, got: %v", tc.name, tc.want, got)
+		}
+	}
+
+	if _, err := ParseProxies("10.0.0.0/33"); err != ErrInvalidProxy {
+		t.Fatalf("expected: %v, got: %v", ErrInvalidProxy, err)
+	}
+}
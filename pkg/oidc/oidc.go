@@ -0,0 +1,382 @@
+package oidc
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/golang-jwt/jwt/v4"
+	"math/big"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+)
+
+var (
+	ErrDiscovery       = errors.New("unable to discover openid provider")
+	ErrExchange        = errors.New("unable to exchange authorization code")
+	ErrInvalidIDToken  = errors.New("invalid id token")
+	ErrNonceMismatch   = errors.New("id token nonce mismatch")
+	ErrUnknownSigner   = errors.New("id token signed with unknown key")
+	ErrMissingIDToken  = errors.New("token response has no id token")
+	ErrUnsupportedJWK  = errors.New("unsupported json web key")
+	defaultScopes      = []string{"openid", "email", "profile"}
+	allowedAlgorithms  = []string{"RS256", "ES256", "EdDSA"}
+	clockSkewTolerance = time.Minute
+)
+
+// Config of the relying party registered at the identity provider.
+type Config struct {
+	IssuerURL    string
+	ClientID     string
+	ClientSecret string
+	RedirectURL  string
+	Scopes       []string
+}
+
+// Discovery is the subset of the provider metadata this client needs.
+type Discovery struct {
+	Issuer                string `json:"issuer"`
+	AuthorizationEndpoint string `json:"authorization_endpoint"`
+	TokenEndpoint         string `json:"token_endpoint"`
+	JWKSURI               string `json:"jwks_uri"`
+}
+
+// Tokens is the token endpoint response.
+type Tokens struct {
+	AccessToken string `json:"access_token"`
+	TokenType   string `json:"token_type"`
+	IDToken     string `json:"id_token"`
+	ExpiresIn   int    `json:"expires_in"`
+}
+
+// Identity is the verified content of an id token.
+type Identity struct {
+	Issuer        string
+	Subject       string
+	Email         string
+	EmailVerified bool
+	GivenName     string
+	FamilyName    string
+}
+
+// Client runs the authorization code flow with PKCE against one provider.
+// Provider metadata and keys are fetched on first use and cached, keys are
+// refetched when a token names an unknown key id.
+type Client struct {
+	cfg   Config
+	http  *http.Client
+	clock func() time.Time
+
+	mu        sync.Mutex
+	discovery *Discovery
+	keys      map[string]interface{}
+}
+
+func NewClient(cfg Config, httpClient *http.Client, clock func() time.Time) *Client {
+	if httpClient == nil {
+		httpClient = &http.Client{Timeout: 10 * time.Second}
+	}
+	if clock == nil {
+		clock = time.Now
+	}
+	if len(cfg.Scopes) == 0 {
+		cfg.Scopes = defaultScopes
+	}
+	return &Client{
+		cfg:   cfg,
+		http:  httpClient,
+		clock: clock,
+	}
+}
+
+// Issuer is the configured issuer, identities are unique per issuer and subject.
+func (c *Client) Issuer() string {
+	return strings.TrimSuffix(c.cfg.IssuerURL, "/")
+}
+
+// AuthCodeURL returns the url the user agent is redirected to.
+func (c *Client) AuthCodeURL(ctx context.Context, state, nonce, verifier string) (string, error) {
+	d, err := c.discover(ctx)
+	if err != nil {
+		return "", err
+	}
+
+	v := url.Values{}
+	v.Set("response_type", "code")
+	v.Set("client_id", c.cfg.ClientID)
+	v.Set("redirect_uri", c.cfg.RedirectURL)
+	v.Set("scope", strings.Join(c.cfg.Scopes, " "))
+	v.Set("state", state)
+	v.Set("nonce", nonce)
+	v.Set("code_challenge", S256Challenge(verifier))
+	v.Set("code_challenge_method", "S256")
+
+	sep := "?"
+	if strings.Contains(d.AuthorizationEndpoint, "?") {
+		sep = "&"
+	}
+	return d.AuthorizationEndpoint + sep + v.Encode(), nil
+}
+
+// Exchange redeems an authorization code at the token endpoint.
+func (c *Client) Exchange(ctx context.Context, code, verifier string) (Tokens, error) {
+	d, err := c.discover(ctx)
+	if err != nil {
+		return Tokens{}, err
+	}
+
+	v := url.Values{}
+	v.Set("grant_type", "authorization_code")
+	v.Set("code", code)
+	v.Set("redirect_uri", c.cfg.RedirectURL)
+	v.Set("code_verifier", verifier)
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, d.TokenEndpoint, strings.NewReader(v.Encode()))
+	if err != nil {
+		return Tokens{}, err
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	req.Header.Set("Accept", "application/json")
+	req.SetBasicAuth(url.QueryEscape(c.cfg.ClientID), url.QueryEscape(c.cfg.ClientSecret))
+
+	resp, err := c.http.Do(req)
+	if err != nil {
+		return Tokens{}, fmt.Errorf("%w: %s", ErrExchange, err.Error())
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return Tokens{}, fmt.Errorf("%w: status %d", ErrExchange, resp.StatusCode)
+	}
+
+	var t Tokens
+	err = json.NewDecoder(resp.Body).Decode(&t)
+	if err != nil {
+		return Tokens{}, fmt.Errorf("%w: %s", ErrExchange, err.Error())
+	}
+	if t.IDToken == "" {
+		return Tokens{}, ErrMissingIDToken
+	}
+	return t, nil
+}
+
+// VerifyIDToken checks the signature, issuer, audience, expiry and nonce of
+// an id token as required by OpenID Connect Core section 3.1.3.7.
+func (c *Client) VerifyIDToken(ctx context.Context, raw, nonce string) (Identity, error) {
+	d, err := c.discover(ctx)
+	if err != nil {
+		return Identity{}, err
+	}
+
+	var claims idTokenClaims
+	parser := jwt.NewParser(jwt.WithValidMethods(allowedAlgorithms), jwt.WithoutClaimsValidation())
+	_, err = parser.ParseWithClaims(raw, &claims, func(t *jwt.Token) (interface{}, error) {
+		kid, _ := t.Header["kid"].(string)
+		return c.key(ctx, d, kid)
+	})
+	if err != nil {
+		return Identity{}, fmt.Errorf("%w: %s", ErrInvalidIDToken, err.Error())
+	}
+
+	now := c.clock()
+	switch {
+	case claims.Issuer != d.Issuer:
+		return Identity{}, fmt.Errorf("%w: unexpected issuer %s", ErrInvalidIDToken, claims.Issuer)
+	case !claims.VerifyAudience(c.cfg.ClientID, true):
+		return Identity{}, fmt.Errorf("%w: unexpected audience", ErrInvalidIDToken)
+	case len(claims.Audience) > 1 && claims.AuthorizedParty != c.cfg.ClientID:
+		return Identity{}, fmt.Errorf("%w: unexpected authorized party", ErrInvalidIDToken)
+	case claims.ExpiresAt == nil || !claims.VerifyExpiresAt(now.Add(-clockSkewTolerance), true):
+		return Identity{}, fmt.Errorf("%w: expired", ErrInvalidIDToken)
+	case claims.IssuedAt != nil && !claims.VerifyIssuedAt(now.Add(clockSkewTolerance), true):
+		return Identity{}, fmt.Errorf("%w: issued in the future", ErrInvalidIDToken)
+	case claims.Subject == "":
+		return Identity{}, fmt.Errorf("%w: missing subject", ErrInvalidIDToken)
+	case claims.Nonce != nonce:
+		return Identity{}, ErrNonceMismatch
+	}
+
+	return Identity{
+		Issuer:        claims.Issuer,
+		Subject:       claims.Subject,
+		Email:         claims.Email,
+		EmailVerified: bool(claims.EmailVerified),
+		GivenName:     claims.GivenName,
+		FamilyName:    claims.FamilyName,
+	}, nil
+}
+
+type idTokenClaims struct {
+	jwt.RegisteredClaims
+	Nonce           string       `json:"nonce"`
+	AuthorizedParty string       `json:"azp"`
+	Email           string       `json:"email"`
+	EmailVerified   flexibleBool `json:"email_verified"`
+	GivenName       string       `json:"given_name"`
+	FamilyName      string       `json:"family_name"`
+}
+
+// flexibleBool accepts "true" as well, some providers send email_verified as a string.
+type flexibleBool bool
+
+func (b *flexibleBool) UnmarshalJSON(data []byte) error {
+	s := strings.Trim(string(data), `"`)
+	*b = flexibleBool(s == "true")
+	return nil
+}
+
+func (c *Client) discover(ctx context.Context) (*Discovery, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.discovery != nil {
+		return c.discovery, nil
+	}
+
+	var d Discovery
+	err := c.getJSON(ctx, c.Issuer()+"/.well-known/openid-configuration", &d)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %s", ErrDiscovery, err.Error())
+	}
+	if d.Issuer != c.Issuer() {
+		return nil, fmt.Errorf("%w: issuer %s does not match %s", ErrDiscovery, d.Issuer, c.Issuer())
+	}
+	if d.AuthorizationEndpoint == "" || d.TokenEndpoint == "" || d.JWKSURI == "" {
+		return nil, fmt.Errorf("%w: incomplete provider metadata", ErrDiscovery)
+	}
+	c.discovery = &d
+	return c.discovery, nil
+}
+
+func (c *Client) key(ctx context.Context, d *Discovery, kid string) (interface{}, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if k, ok := c.keys[kid]; ok {
+		return k, nil
+	}
+
+	var set struct {
+		Keys []jwk `json:"keys"`
+	}
+	err := c.getJSON(ctx, d.JWKSURI, &set)
+	if err != nil {
+		return nil, err
+	}
+
+	keys := make(map[string]interface{}, len(set.Keys))
+	for _, k := range set.Keys {
+		if k.Use != "" && k.Use != "sig" {
+			continue
+		}
+		pub, err := k.publicKey()
+		if err != nil {
+			continue
+		}
+		keys[k.Kid] = pub
+	}
+	c.keys = keys
+
+	k, ok := c.keys[kid]
+	if !ok {
+		// a provider with a single key may omit the kid header
+		if kid == "" && len(c.keys) == 1 {
+			for _, only := range c.keys {
+				return only, nil
+			}
+		}
+		return nil, ErrUnknownSigner
+	}
+	return k, nil
+}
+
+func (c *Client) getJSON(ctx context.Context, u string, v interface{}) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, u, nil)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Accept", "application/json")
+	resp, err := c.http.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("%s returned status %d", u, resp.StatusCode)
+	}
+	return json.NewDecoder(resp.Body).Decode(v)
+}
+
+type jwk struct {
+	Kty string `json:"kty"`
+	Kid string `json:"kid"`
+	Use string `json:"use"`
+	N   string `json:"n"`
+	E   string `json:"e"`
+	Crv string `json:"crv"`
+	X   string `json:"x"`
+	Y   string `json:"y"`
+}
+
+func (k jwk) publicKey() (interface{}, error) {
+	switch k.Kty {
+	case "RSA":
+		n, err := base64.RawURLEncoding.DecodeString(k.N)
+		if err != nil {
+			return nil, err
+		}
+		e, err := base64.RawURLEncoding.DecodeString(k.E)
+		if err != nil {
+			return nil, err
+		}
+		return &rsa.PublicKey{N: new(big.Int).SetBytes(n), E: int(new(big.Int).SetBytes(e).Int64())}, nil
+	case "EC":
+		if k.Crv != "P-256" {
+			return nil, ErrUnsupportedJWK
+		}
+		x, err := base64.RawURLEncoding.DecodeString(k.X)
+		if err != nil {
+			return nil, err
+		}
+		y, err := base64.RawURLEncoding.DecodeString(k.Y)
+		if err != nil {
+			return nil, err
+		}
+		return &ecdsa.PublicKey{Curve: elliptic.P256(), X: new(big.Int).SetBytes(x), Y: new(big.Int).SetBytes(y)}, nil
+	case "OKP":
+		if k.Crv != "Ed25519" {
+			return nil, ErrUnsupportedJWK
+		}
+		x, err := base64.RawURLEncoding.DecodeString(k.X)
+		if err != nil {
+			return nil, err
+		}
+		return ed25519.PublicKey(x), nil
+	}
+	return nil, ErrUnsupportedJWK
+}
+
+// RandomString returns a url safe random string with n bytes of entropy, it
+// is used for state, nonce and the PKCE code verifier.
+func RandomString(n int) (string, error) {
+	b := make([]byte, n)
+	_, err := rand.Read(b)
+	if err != nil {
+		return "", err
+	}
+	return base64.RawURLEncoding.EncodeToString(b), nil
+}
+
+// S256Challenge derives the RFC 7636 code challenge of a code verifier.
+func S256Challenge(verifier string) string {
+	sum := sha256.Sum256([]byte(verifier))
+	return base64.RawURLEncoding.EncodeToString(sum[:])
+}
@@ -0,0 +1,175 @@
+package oidc
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/rsa"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"github.com/golang-jwt/jwt/v4"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+	"time"
+)
+
+// fakeIdP is a minimal stand-in provider. It issues a code for every
+// authorization request and checks the PKCE verifier when it is redeemed.
+type fakeIdP struct {
+	t       *testing.T
+	srv     *httptest.Server
+	key     *rsa.PrivateKey
+	now     time.Time
+	claims  jwt.MapClaims
+	pending map[string]url.Values
+}
+
+func newFakeIdP(t *testing.T) *fakeIdP {
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	idp := &fakeIdP{t: t, key: key, now: time.Now(), pending: map[string]url.Values{}}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/.well-known/openid-configuration", func(w http.ResponseWriter, r *http.Request) {
+		json.NewEncoder(w).Encode(Discovery{
+			Issuer:                idp.srv.URL,
+			AuthorizationEndpoint: idp.srv.URL + "/authorize",
+			TokenEndpoint:         idp.srv.URL + "/token",
+			JWKSURI:               idp.srv.URL + "/jwks",
+		})
+	})
+	mux.HandleFunc("/jwks", func(w http.ResponseWriter, r *http.Request) {
+		json.NewEncoder(w).Encode(map[string]interface{}{"keys": []map[string]string{{
+			"kty": "RSA",
+			"kid": "idp-key",
+			"use": "sig",
+			"n":   base64.RawURLEncoding.EncodeToString(key.N.Bytes()),
+			"e":   base64.RawURLEncoding.EncodeToString(big.NewInt(int64(key.E)).Bytes()),
+		}}})
+	})
+	mux.HandleFunc("/token", func(w http.ResponseWriter, r *http.Request) {
+		r.ParseForm()
+		auth, ok := idp.pending[r.PostForm.Get("code")]
+		if !ok || S256Challenge(r.PostForm.Get("code_verifier")) != auth.Get("code_challenge") {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		if id, secret, _ := r.BasicAuth(); id != "pdfgen" || secret != "secret" {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		delete(idp.pending, r.PostForm.Get("code"))
+
+		claims := jwt.MapClaims{
+			"iss":            idp.srv.URL,
+			"aud":            "pdfgen",
+			"sub":            "248289761001",
+			"email":          "jane@example.com",
+			"email_verified": true,
+			"nonce":          auth.Get("nonce"),
+			"iat":            idp.now.Unix(),
+			"exp":            idp.now.Add(time.Hour).Unix(),
+		}
+		for k, v := range idp.claims {
+			claims[k] = v
+		}
+		tk := jwt.NewWithClaims(jwt.SigningMethodRS256, claims)
+		tk.Header["kid"] = "idp-key"
+		raw, err := tk.SignedString(key)
+		if err != nil {
+			t.Fatal(err)
+		}
+		json.NewEncoder(w).Encode(Tokens{AccessToken: "at", TokenType: "Bearer", IDToken: raw})
+	})
+	idp.srv = httptest.NewServer(mux)
+	t.Cleanup(idp.srv.Close)
+	return idp
+}
+
+// authorize simulates the user logging in at the provider and returns the code.
+func (idp *fakeIdP) authorize(authURL string) string {
+	u, err := url.Parse(authURL)
+	if err != nil {
+		idp.t.Fatal(err)
+	}
+	code := "code-" + u.Query().Get("state")
+	idp.pending[code] = u.Query()
+	return code
+}
+
+func TestAuthorizationCodeFlow(t *testing.T) {
+	ctx := context.Background()
+
+	tests := []struct {
+		name    string
+		claims  jwt.MapClaims
+		nonce   string
+		wantErr error
+	}{
+		{name: "valid login"},
+		{name: "nonce mismatch", nonce: "other", wantErr: ErrNonceMismatch},
+		{name: "wrong audience", claims: jwt.MapClaims{"aud": "other-client"}, wantErr: ErrInvalidIDToken},
+		{name: "wrong issuer", claims: jwt.MapClaims{"iss": "https://evil.example.com"}, wantErr: ErrInvalidIDToken},
+		{name: "expired", claims: jwt.MapClaims{"exp": time.Now().Add(-time.Hour).Unix()}, wantErr: ErrInvalidIDToken},
+	}
+
+	for _, tc := range tests {
+		idp := newFakeIdP(t)
+		idp.claims = tc.claims
+		c := NewClient(Config{
+			IssuerURL:    idp.srv.URL,
+			ClientID:     "pdfgen",
+			ClientSecret: "secret",
+			RedirectURL:  "https://api.pdfgen.pro/login/oidc/callback",
+		}, idp.srv.Client(), nil)
+
+		verifier, _ := RandomString(48)
+		authURL, err := c.AuthCodeURL(ctx, "state-1", "nonce-1", verifier)
+		if err != nil {
+			t.Fatalf("%s: %v", tc.name, err)
+		}
+
+		tokens, err := c.Exchange(ctx, idp.authorize(authURL), verifier)
+		if err != nil {
+			t.Fatalf("%s: %v", tc.name, err)
+		}
+
+		nonce := "nonce-1"
+		if tc.nonce != "" {
+			nonce = tc.nonce
+		}
+		id, err := c.VerifyIDToken(ctx, tokens.IDToken, nonce)
+		if tc.wantErr != nil {
+			if !errors.Is(err, tc.wantErr) {
+				t.Fatalf("%s: expected: %v, got: %v", tc.name, tc.wantErr, err)
+			}
+			continue
+		}
+		if err != nil {
+			t.Fatalf("%s: unexpected error: %v", tc.name, err)
+		}
+		if id.Subject != "248289761001" || id.Email != "jane@example.com" || !id.EmailVerified || id.Issuer != idp.srv.URL {
+			t.Fatalf("%s: unexpected identity: %+v", tc.name, id)
+		}
+	}
+}
+
+func TestExchangeRejectsWrongVerifier(t *testing.T) {
+	ctx := context.Background()
+	idp := newFakeIdP(t)
+	c := NewClient(Config{IssuerURL: idp.srv.URL, ClientID: "pdfgen", ClientSecret: "secret"}, idp.srv.Client(), nil)
+
+	authURL, err := c.AuthCodeURL(ctx, "state-1", "nonce-1", "right-verifier")
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = c.Exchange(ctx, idp.authorize(authURL), "wrong-verifier")
+	if !errors.Is(err, ErrExchange) {
+		t.Fatalf("expected: %v, got: %v", ErrExchange, err)
+	}
+}
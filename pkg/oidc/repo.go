@@ -0,0 +1,63 @@
+package oidc
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"time"
+)
+
+var ErrLoginStateNotFound = errors.New("login state not found or expired")
+
+// LoginState is kept between redirecting to the provider and the callback.
+type LoginState struct {
+	State     string
+	Nonce     string
+	Verifier  string
+	CreatedAt time.Time
+}
+
+type Repository struct {
+	db *sql.DB
+}
+
+func NewRepository(db *sql.DB) *Repository {
+	return &Repository{
+		db: db,
+	}
+}
+
+func (r *Repository) Save(ctx context.Context, s LoginState) error {
+	_, err := r.db.ExecContext(ctx, "INSERT INTO oidc_login_state(state, nonce, verifier, created_at) values($1, $2, $3, $4)",
+		s.State,
+		s.Nonce,
+		s.Verifier,
+		s.CreatedAt)
+	if err != nil {
+		return err
+	}
+	return nil
+}
+
+// Consume deletes and returns a state created after notBefore, so each state
+// can only complete one login.
+func (r *Repository) Consume(ctx context.Context, state string, notBefore time.Time) (LoginState, error) {
+	var s LoginState
+	err := r.db.QueryRowContext(ctx, `DELETE FROM oidc_login_state WHERE state=$1 RETURNING state, nonce, verifier, created_at`, state).
+		Scan(&s.State, &s.Nonce, &s.Verifier, &s.CreatedAt)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return LoginState{}, ErrLoginStateNotFound
+		}
+		return LoginState{}, err
+	}
+	if s.CreatedAt.Before(notBefore) {
+		return LoginState{}, ErrLoginStateNotFound
+	}
+
+	_, err = r.db.ExecContext(ctx, `DELETE FROM oidc_login_state WHERE created_at < $1`, notBefore)
+	if err != nil {
+		return LoginState{}, err
+	}
+	return s, nil
+}
@@ -0,0 +1,56 @@
+package organization
+
+import (
+	"github.com/google/uuid"
+	"time"
+)
+
+// Role of a member in an organization. Owners manage members, editors
+// create and change designs, viewers read and generate documents.
+type Role string
+
+const (
+	RoleOwner  Role = "owner"
+	RoleEditor Role = "editor"
+	RoleViewer Role = "viewer"
+)
+
+func (r Role) Valid() bool {
+	return r == RoleOwner || r == RoleEditor || r == RoleViewer
+}
+
+func (r Role) CanEdit() bool {
+	return r == RoleOwner || r == RoleEditor
+}
+
+func (r Role) CanManage() bool {
+	return r == RoleOwner
+}
+
+// Organization is a shared workspace, designs owned by it are visible to
+// every member. Designs, with their thumbnails, are all an organization
+// owns: generated documents are returned and not stored, and signing
+// certificates stay with the user who uploaded them.
+type Organization struct {
+	Id        string    `json:"id"`
+	Name      string    `json:"name"`
+	Role      Role      `json:"role,omitempty"`
+	CreatedAt time.Time `json:"createdAt"`
+	UpdatedAt time.Time `json:"updatedAt"`
+}
+
+// ValidId reports whether id can be an organization id, ids are uuids in
+// their canonical form.
+func ValidId(id string) bool {
+	_, err := uuid.Parse(id)
+	return err == nil && len(id) == 36
+}
+
+type Member struct {
+	OrganizationId string    `json:"organizationId"`
+	UserId         string    `json:"userId"`
+	Email          string    `json:"email,omitempty"`
+	Role           Role      `json:"role"`
+	CreatedAt      time.Time `json:"createdAt"`
+	UpdatedAt      time.Time `json:"updatedAt"`
+}
@@ -0,0 +1,194 @@
+package organization
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+)
+
+var (
+	ErrOrganizationNotFound = errors.New("organization not found")
+	ErrMemberNotFound       = errors.New("member not found")
+	ErrMemberExists         = errors.New("user is already a member")
+	ErrLastOwner            = errors.New("organization must keep at least one owner")
+)
+
+type Repository struct {
+	db *sql.DB
+}
+
+func NewRepository(db *sql.DB) *Repository {
+	return &Repository{
+		db: db,
+	}
+}
+
+// Save creates the organization with its first owner.
+func (r *Repository) Save(ctx context.Context, o Organization, owner Member) error {
+	tx, err := r.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	_, err = tx.ExecContext(ctx, `INSERT INTO organization(id, name, created_at, updated_at) values($1, $2, $3, $4)`,
+		o.Id, o.Name, o.CreatedAt, o.UpdatedAt)
+	if err != nil {
+		return err
+	}
+
+	_, err = tx.ExecContext(ctx, `INSERT INTO organization_member(organization_id, user_id, role, created_at, updated_at) values($1, $2, $3, $4, $5)`,
+		o.Id, owner.UserId, owner.Role, owner.CreatedAt, owner.UpdatedAt)
+	if err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+// ListByUserId returns every organization the user is a member of, with the
+// role of the user.
+func (r *Repository) ListByUserId(ctx context.Context, userId string) ([]Organization, error) {
+	q := `SELECT o.id, o.name, m.role, o.created_at, o.updated_at
+		  FROM organization o
+		  JOIN organization_member m ON m.organization_id = o.id
+		  WHERE m.user_id = $1
+		  ORDER BY o.name`
+	rows, err := r.db.QueryContext(ctx, q, userId)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var orgs []Organization
+	for rows.Next() {
+		var o Organization
+		err = rows.Scan(&o.Id, &o.Name, &o.Role, &o.CreatedAt, &o.UpdatedAt)
+		if err != nil {
+			return nil, err
+		}
+		orgs = append(orgs, o)
+	}
+	return orgs, rows.Err()
+}
+
+func (r *Repository) GetMember(ctx context.Context, organizationId, userId string) (Member, error) {
+	var m Member
+	q := `SELECT m.organization_id, m.user_id, u.email, m.role, m.created_at, m.updated_at
+		  FROM organization_member m
+		  JOIN users u ON u.id = m.user_id
+		  WHERE m.organization_id = $1 AND m.user_id = $2`
+	err := r.db.QueryRowContext(ctx, q, organizationId, userId).
+		Scan(&m.OrganizationId, &m.UserId, &m.Email, &m.Role, &m.CreatedAt, &m.UpdatedAt)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return Member{}, ErrMemberNotFound
+		}
+		return Member{}, err
+	}
+	return m, nil
+}
+
+func (r *Repository) ListMembers(ctx context.Context, organizationId string) ([]Member, error) {
+	q := `SELECT m.organization_id, m.user_id, u.email, m.role, m.created_at, m.updated_at
+		  FROM organization_member m
+		  JOIN users u ON u.id = m.user_id
+		  WHERE m.organization_id = $1
+		  ORDER BY u.email`
+	rows, err := r.db.QueryContext(ctx, q, organizationId)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var ms []Member
+	for rows.Next() {
+		var m Member
+		err = rows.Scan(&m.OrganizationId, &m.UserId, &m.Email, &m.Role, &m.CreatedAt, &m.UpdatedAt)
+		if err != nil {
+			return nil, err
+		}
+		ms = append(ms, m)
+	}
+	return ms, rows.Err()
+}
+
+func (r *Repository) AddMember(ctx context.Context, m Member) error {
+	q := `INSERT INTO organization_member(organization_id, user_id, role, created_at, updated_at)
+		  values($1, $2, $3, $4, $5)
+		  ON CONFLICT DO NOTHING`
+	res, err := r.db.ExecContext(ctx, q, m.OrganizationId, m.UserId, m.Role, m.CreatedAt, m.UpdatedAt)
+	if err != nil {
+		return err
+	}
+	n, err := res.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if n == 0 {
+		return ErrMemberExists
+	}
+	return nil
+}
+
+// UpdateMemberRole changes the role of a member. Demoting the last owner is
+// refused, the owner count is checked under a lock on the organization so
+// two owners can not demote each other at the same time.
+func (r *Repository) UpdateMemberRole(ctx context.Context, m Member) error {
+	return r.changeMember(ctx, m.OrganizationId, m.UserId, func(tx *sql.Tx) (sql.Result, error) {
+		return tx.ExecContext(ctx, `UPDATE organization_member SET role=$3, updated_at=$4 WHERE organization_id=$1 AND user_id=$2`,
+			m.OrganizationId, m.UserId, m.Role, m.UpdatedAt)
+	}, m.Role != RoleOwner)
+}
+
+// RemoveMember removes a member, the last owner can not be removed.
+func (r *Repository) RemoveMember(ctx context.Context, organizationId, userId string) error {
+	return r.changeMember(ctx, organizationId, userId, func(tx *sql.Tx) (sql.Result, error) {
+		return tx.ExecContext(ctx, `DELETE FROM organization_member WHERE organization_id=$1 AND user_id=$2`,
+			organizationId, userId)
+	}, true)
+}
+
+func (r *Repository) changeMember(ctx context.Context, organizationId, userId string,
+	change func(tx *sql.Tx) (sql.Result, error), dropsOwner bool) error {
+	tx, err := r.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	var id string
+	err = tx.QueryRowContext(ctx, `SELECT id FROM organization WHERE id=$1 FOR UPDATE`, organizationId).Scan(&id)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return ErrOrganizationNotFound
+		}
+		return err
+	}
+
+	res, err := change(tx)
+	if err != nil {
+		return err
+	}
+	n, err := res.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if n == 0 {
+		return ErrMemberNotFound
+	}
+
+	if dropsOwner {
+		var owners int
+		err = tx.QueryRowContext(ctx, `SELECT count(*) FROM organization_member WHERE organization_id=$1 AND role='owner'`,
+			organizationId).Scan(&owners)
+		if err != nil {
+			return err
+		}
+		if owners == 0 {
+			return ErrLastOwner
+		}
+	}
+
+	return tx.Commit()
+}
@@ -0,0 +1,82 @@
+package pdf
+
+// Copier copies objects of a Reader into a Writer. Every indirect object is
+// copied once and references to it are renumbered.
+type Copier struct {
+	r    *Reader
+	w    *Writer
+	refs map[int]Ref
+}
+
+func NewCopier(r *Reader, w *Writer) *Copier {
+	return &Copier{r: r, w: w, refs: map[int]Ref{}}
+}
+
+// Map makes references to src point to dst, e.g. to a page the caller
+// already created so the annotations of the page refer to the copy.
+func (c *Copier) Map(src, dst Ref) {
+	c.refs[src.Number] = dst
+}
+
+// Copy returns o with the objects it refers to copied into the writer.
+func (c *Copier) Copy(o Object) (Object, error) {
+	switch v := o.(type) {
+	case Ref:
+		return c.ref(v)
+	case Array:
+		a := make(Array, len(v))
+		for i, e := range v {
+			cp, err := c.Copy(e)
+			if err != nil {
+				return nil, err
+			}
+			a[i] = cp
+		}
+		return a, nil
+	case Dict:
+		return c.dict(v)
+	case Stream:
+		d, err := c.dict(v.Dict)
+		if err != nil {
+			return nil, err
+		}
+		return Stream{Dict: d, Data: v.Data}, nil
+	}
+	return o, nil
+}
+
+func (c *Copier) dict(d Dict) (Dict, error) {
+	out := make(Dict, len(d))
+	for k, v := range d {
+		cp, err := c.Copy(v)
+		if err != nil {
+			return nil, err
+		}
+		out[k] = cp
+	}
+	return out, nil
+}
+
+func (c *Copier) ref(src Ref) (Object, error) {
+	if dst, ok := c.refs[src.Number]; ok {
+		return dst, nil
+	}
+	o, err := c.r.Resolve(src)
+	if err != nil {
+		return nil, err
+	}
+	if o == Null {
+		return Null, nil
+	}
+
+	// the reference is mapped before copying so cycles, like the parent of
+	// an annotation, end here
+	dst := c.w.Reserve()
+	c.refs[src.Number] = dst
+	cp, err := c.Copy(o)
+	if err != nil {
+		return nil, err
+	}
+	c.w.Set(dst, cp)
+	return dst, nil
+}
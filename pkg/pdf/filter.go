@@ -0,0 +1,210 @@
+package pdf
+
+import (
+	"bytes"
+	"compress/zlib"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+)
+
+var ErrUnsupportedFilter = errors.New("unsupported pdf stream filter")
+
+// maxDecoded bounds the decoded size of a stream against compression bombs.
+const maxDecoded = 256 << 20
+
+// DecodeStream returns the data of s with its filters applied. FlateDecode
+// with predictors, ASCIIHexDecode and ASCII85Decode are supported, other
+// filters fail with ErrUnsupportedFilter.
+func DecodeStream(s Stream) ([]byte, error) {
+	var filters, params Array
+	switch f := s.Dict["Filter"].(type) {
+	case Name:
+		filters = Array{f}
+	case Array:
+		filters = f
+	}
+	switch p := s.Dict["DecodeParms"].(type) {
+	case Dict:
+		params = Array{p}
+	case Array:
+		params = p
+	}
+
+	data := s.Data
+	for i, f := range filters {
+		var p Dict
+		if i < len(params) {
+			p, _ = params[i].(Dict)
+		}
+
+		var err error
+		switch f {
+		case Name("FlateDecode"), Name("Fl"):
+			data, err = inflate(data, p)
+		case Name("ASCIIHexDecode"), Name("AHx"):
+			data, err = asciiHex(data)
+		case Name("ASCII85Decode"), Name("A85"):
+			data, err = ascii85(data)
+		default:
+			return nil, fmt.Errorf("%w: %s", ErrUnsupportedFilter, Format(f))
+		}
+		if err != nil {
+			return nil, err
+		}
+	}
+	return data, nil
+}
+
+func inflate(data []byte, p Dict) ([]byte, error) {
+	zr, err := zlib.NewReader(bytes.NewReader(data))
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrMalformed, err)
+	}
+	out, err := io.ReadAll(io.LimitReader(zr, maxDecoded+1))
+	// truncated streams are common, keep what was inflated
+	if err != nil && !errors.Is(err, io.ErrUnexpectedEOF) {
+		return nil, fmt.Errorf("%w: %v", ErrMalformed, err)
+	}
+	if len(out) > maxDecoded {
+		return nil, fmt.Errorf("%w: stream too large", ErrMalformed)
+	}
+
+	predictor, _ := p["Predictor"].(Integer)
+	if predictor < 10 {
+		if predictor == 2 {
+			return nil, fmt.Errorf("%w: tiff predictor", ErrUnsupportedFilter)
+		}
+		return out, nil
+	}
+	return unpredict(out, p)
+}
+
+// unpredict reverses the PNG predictors, every row starts with its filter
+// type.
+func unpredict(data []byte, p Dict) ([]byte, error) {
+	colors, bits, columns := 1, 8, 1
+	if v, ok := p["Colors"].(Integer); ok && v > 0 {
+		colors = int(v)
+	}
+	if v, ok := p["BitsPerComponent"].(Integer); ok && v > 0 {
+		bits = int(v)
+	}
+	if v, ok := p["Columns"].(Integer); ok && v > 0 {
+		columns = int(v)
+	}
+	bpp := (colors*bits + 7) / 8
+	row := (colors*bits*columns + 7) / 8
+
+	out := make([]byte, 0, len(data))
+	prev := make([]byte, row)
+	for len(data) > row {
+		kind, cur := data[0], append([]byte(nil), data[1:row+1]...)
+		data = data[row+1:]
+		for i := range cur {
+			var left, upLeft byte
+			if i >= bpp {
+				left, upLeft = cur[i-bpp], prev[i-bpp]
+			}
+			up := prev[i]
+			switch kind {
+			case 0:
+			case 1:
+				cur[i] += left
+			case 2:
+				cur[i] += up
+			case 3:
+				cur[i] += byte((int(left) + int(up)) / 2)
+			case 4:
+				cur[i] += paeth(left, up, upLeft)
+			default:
+				return nil, fmt.Errorf("%w: png predictor %d", ErrMalformed, kind)
+			}
+		}
+		out = append(out, cur...)
+		prev = cur
+	}
+	return out, nil
+}
+
+func paeth(a, b, c byte) byte {
+	p := int(a) + int(b) - int(c)
+	pa, pb, pc := abs(p-int(a)), abs(p-int(b)), abs(p-int(c))
+	if pa <= pb && pa <= pc {
+		return a
+	}
+	if pb <= pc {
+		return b
+	}
+	return c
+}
+
+func abs(i int) int {
+	if i < 0 {
+		return -i
+	}
+	return i
+}
+
+func asciiHex(data []byte) ([]byte, error) {
+	var digits []byte
+	for _, c := range data {
+		if c == '>' {
+			break
+		}
+		if !isWhite(c) {
+			digits = append(digits, c)
+		}
+	}
+	if len(digits)%2 == 1 {
+		digits = append(digits, '0')
+	}
+	out := make([]byte, len(digits)/2)
+	if _, err := hex.Decode(out, digits); err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrMalformed, err)
+	}
+	return out, nil
+}
+
+// ascii85 decodes the Adobe variant, z stands for four zero bytes and ~>
+// ends the data.
+func ascii85(data []byte) ([]byte, error) {
+	var out []byte
+	var group [5]byte
+	n := 0
+	flush := func(k int) {
+		var v uint32
+		for i := 0; i < 5; i++ {
+			v = v*85 + uint32(group[i]-'!')
+		}
+		b := []byte{byte(v >> 24), byte(v >> 16), byte(v >> 8), byte(v)}
+		out = append(out, b[:k]...)
+	}
+
+	for _, c := range data {
+		switch {
+		case c == '~':
+			if n > 0 {
+				for i := n; i < 5; i++ {
+					group[i] = 'u'
+				}
+				flush(n - 1)
+			}
+			return out, nil
+		case c == 'z' && n == 0:
+			out = append(out, 0, 0, 0, 0)
+		case c >= '!' && c <= 'u':
+			group[n] = c
+			n++
+			if n == 5 {
+				flush(4)
+				n = 0
+			}
+		case isWhite(c):
+		default:
+			return nil, fmt.Errorf("%w: invalid ascii85 data", ErrMalformed)
+		}
+	}
+	return nil, fmt.Errorf("%w: unterminated ascii85 data", ErrMalformed)
+}
@@ -0,0 +1,157 @@
+package pdf
+
+import "strings"
+
+// Font is one of the standard 14 PDF fonts, they need no embedding. Widths
+// are in thousandths of the font size for the characters 32 to 126, ascent
+// and descent in fractions of the font size.
+type Font struct {
+	Name     string
+	widths   *[95]int
+	fallback int
+	Ascent   float64
+	Descent  float64
+}
+
+// Dict returns the font dictionary with WinAnsiEncoding.
+func (f *Font) Dict() Dict {
+	return Dict{
+		"Type":     Name("Font"),
+		"Subtype":  Name("Type1"),
+		"BaseFont": Name(f.Name),
+		"Encoding": Name("WinAnsiEncoding"),
+	}
+}
+
+var helveticaWidths = [95]int{
+	278, 278, 355, 556, 556, 889, 667, 191, 333, 333, 389, 584, 278, 333, 278, 278,
+	556, 556, 556, 556, 556, 556, 556, 556, 556, 556, 278, 278, 584, 584, 584, 556,
+	1015, 667, 667, 722, 722, 667, 611, 778, 722, 278, 500, 667, 556, 833, 722, 778,
+	667, 778, 722, 667, 611, 722, 667, 944, 667, 667, 611, 278, 278, 278, 469, 556,
+	333, 556, 556, 500, 556, 556, 278, 556, 556, 222, 222, 500, 222, 833, 556, 556,
+	556, 556, 333, 500, 278, 556, 500, 722, 500, 500, 500, 334, 260, 334, 584,
+}
+
+var helveticaBoldWidths = [95]int{
+	278, 333, 474, 556, 556, 889, 722, 238, 333, 333, 389, 584, 278, 333, 278, 278,
+	556, 556, 556, 556, 556, 556, 556, 556, 556, 556, 333, 333, 584, 584, 584, 611,
+	975, 722, 722, 722, 722, 667, 611, 778, 722, 278, 556, 722, 611, 833, 722, 778,
+	667, 778, 722, 667, 611, 722, 667, 944, 667, 667, 611, 333, 278, 333, 584, 556,
+	333, 556, 611, 556, 611, 556, 333, 611, 611, 278, 278, 556, 278, 889, 611, 611,
+	611, 611, 389, 556, 333, 611, 556, 778, 556, 556, 500, 389, 280, 389, 584,
+}
+
+var timesWidths = [95]int{
+	250, 333, 408, 500, 500, 833, 778, 180, 333, 333, 500, 564, 250, 333, 250, 278,
+	500, 500, 500, 500, 500, 500, 500, 500, 500, 500, 278, 278, 564, 564, 564, 444,
+	921, 722, 667, 667, 722, 611, 556, 722, 722, 333, 389, 722, 611, 889, 722, 722,
+	556, 722, 667, 556, 611, 722, 722, 944, 722, 722, 611, 333, 278, 333, 469, 500,
+	333, 444, 500, 444, 500, 444, 333, 500, 500, 278, 278, 500, 278, 778, 500, 500,
+	500, 500, 333, 389, 278, 500, 500, 722, 500, 500, 444, 480, 200, 480, 541,
+}
+
+var timesBoldWidths = [95]int{
+	250, 333, 555, 500, 500, 1000, 833, 278, 333, 333, 500, 570, 250, 333, 250, 278,
+	500, 500, 500, 500, 500, 500, 500, 500, 500, 500, 333, 333, 570, 570, 570, 500,
+	930, 722, 667, 722, 722, 667, 611, 778, 778, 389, 500, 778, 667, 944, 722, 778,
+	611, 778, 722, 556, 667, 722, 722, 1000, 722, 722, 667, 333, 278, 333, 581, 500,
+	333, 500, 556, 444, 556, 444, 333, 500, 556, 278, 333, 556, 278, 833, 556, 500,
+	556, 556, 444, 389, 333, 556, 500, 722, 500, 500, 444, 394, 220, 394, 520,
+}
+
+var courierWidths = func() *[95]int {
+	var w [95]int
+	for i := range w {
+		w[i] = 600
+	}
+	return &w
+}()
+
+// The standard fonts. Oblique and italic faces are measured with the upright
+// widths, which is exact for Helvetica and Courier and close for Times.
+var (
+	Helvetica            = &Font{Name: "Helvetica", widths: &helveticaWidths, fallback: 556, Ascent: 0.718, Descent: 0.207}
+	HelveticaOblique     = &Font{Name: "Helvetica-Oblique", widths: &helveticaWidths, fallback: 556, Ascent: 0.718, Descent: 0.207}
+	HelveticaBold        = &Font{Name: "Helvetica-Bold", widths: &helveticaBoldWidths, fallback: 611, Ascent: 0.718, Descent: 0.207}
+	HelveticaBoldOblique = &Font{Name: "Helvetica-BoldOblique", widths: &helveticaBoldWidths, fallback: 611, Ascent: 0.718, Descent: 0.207}
+	TimesRoman           = &Font{Name: "Times-Roman", widths: &timesWidths, fallback: 500, Ascent: 0.683, Descent: 0.217}
+	TimesItalic          = &Font{Name: "Times-Italic", widths: &timesWidths, fallback: 500, Ascent: 0.683, Descent: 0.217}
+	TimesBold            = &Font{Name: "Times-Bold", widths: &timesBoldWidths, fallback: 500, Ascent: 0.683, Descent: 0.217}
+	TimesBoldItalic      = &Font{Name: "Times-BoldItalic", widths: &timesBoldWidths, fallback: 500, Ascent: 0.683, Descent: 0.217}
+	Courier              = &Font{Name: "Courier", widths: courierWidths, fallback: 600, Ascent: 0.629, Descent: 0.157}
+	CourierOblique       = &Font{Name: "Courier-Oblique", widths: courierWidths, fallback: 600, Ascent: 0.629, Descent: 0.157}
+	CourierBold          = &Font{Name: "Courier-Bold", widths: courierWidths, fallback: 600, Ascent: 0.629, Descent: 0.157}
+	CourierBoldOblique   = &Font{Name: "Courier-BoldOblique", widths: courierWidths, fallback: 600, Ascent: 0.629, Descent: 0.157}
+)
+
+// Width measures WinAnsi encoded text.
+func (f *Font) Width(s string, size float64) float64 {
+	var w int
+	for i := 0; i < len(s); i++ {
+		c := s[i]
+		switch {
+		case c >= 32 && c <= 126:
+			w += f.widths[c-32]
+		case c == 0xa0:
+			w += f.widths[0]
+		case c == 0x95:
+			w += 350
+		case c == 0x85 || c == 0x97:
+			w += 1000
+		default:
+			w += f.fallback
+		}
+	}
+	return float64(w) * size / 1000
+}
+
+// Wrap breaks text at spaces and line breaks into WinAnsi encoded lines no
+// wider than width, words wider than width are lines of their own.
+func (f *Font) Wrap(s string, size, width float64) []string {
+	var lines []string
+	for _, para := range strings.Split(strings.ReplaceAll(s, "\r\n", "\n"), "\n") {
+		line := ""
+		for _, word := range strings.Fields(WinAnsi(para)) {
+			if line != "" && f.Width(line+" "+word, size) > width {
+				lines = append(lines, line)
+				line = ""
+			}
+			if line != "" {
+				line += " "
+			}
+			line += word
+		}
+		lines = append(lines, line)
+	}
+	return lines
+}
+
+// winAnsi maps the characters of the WinAnsiEncoding that differ from
+// Latin-1 to their byte.
+var winAnsi = map[rune]byte{
+	'€': 0x80, '‚': 0x82, 'ƒ': 0x83, '„': 0x84, '…': 0x85, '†': 0x86, '‡': 0x87,
+	'ˆ': 0x88, '‰': 0x89, 'Š': 0x8a, '‹': 0x8b, 'Œ': 0x8c, 'Ž': 0x8e, '‘': 0x91,
+	'’': 0x92, '“': 0x93, '”': 0x94, '•': 0x95, '–': 0x96, '—': 0x97, '˜': 0x98,
+	'™': 0x99, 'š': 0x9a, '›': 0x9b, 'œ': 0x9c, 'ž': 0x9e, 'Ÿ': 0x9f,
+}
+
+// WinAnsi converts text to WinAnsiEncoding, characters it does not have are
+// replaced with a question mark.
+func WinAnsi(s string) string {
+	var b strings.Builder
+	for _, r := range s {
+		switch {
+		case r >= 32 && r <= 126, r >= 0xa0 && r <= 0xff:
+			b.WriteByte(byte(r))
+		case r == '\t':
+			b.WriteByte(' ')
+		default:
+			if c, ok := winAnsi[r]; ok {
+				b.WriteByte(c)
+			} else {
+				b.WriteByte('?')
+			}
+		}
+	}
+	return b.String()
+}
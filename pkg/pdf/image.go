@@ -0,0 +1,109 @@
+package pdf
+
+import (
+	"bytes"
+	"image"
+	"image/color"
+	_ "image/gif"
+	"image/jpeg"
+	_ "image/png"
+)
+
+// Image is an image XObject, width and height are in pixels. Images with
+// transparency have a soft mask.
+type Image struct {
+	Width  int
+	Height int
+	Stream Stream
+	SMask  *Stream
+}
+
+// NewImage decodes a PNG, JPEG or GIF. Baseline JPEGs are embedded as they
+// are, other images are deflated.
+func NewImage(data []byte) (*Image, error) {
+	cfg, format, err := image.DecodeConfig(bytes.NewReader(data))
+	if err != nil {
+		return nil, err
+	}
+
+	if format == "jpeg" && cfg.ColorModel != color.CMYKModel {
+		space := Name("DeviceRGB")
+		if cfg.ColorModel == color.GrayModel {
+			space = "DeviceGray"
+		}
+		return &Image{
+			Width:  cfg.Width,
+			Height: cfg.Height,
+			Stream: Stream{Dict: imageDict(cfg.Width, cfg.Height, space, "DCTDecode"), Data: data},
+		}, nil
+	}
+
+	img, _, err := image.Decode(bytes.NewReader(data))
+	if err != nil {
+		return nil, err
+	}
+	if format == "jpeg" {
+		// cmyk jpegs are re-encoded as rgb
+		var buf bytes.Buffer
+		if err := jpeg.Encode(&buf, img, &jpeg.Options{Quality: 90}); err != nil {
+			return nil, err
+		}
+		return NewImage(buf.Bytes())
+	}
+
+	b := img.Bounds()
+	rgbData := make([]byte, 0, b.Dx()*b.Dy()*3)
+	alpha := make([]byte, 0, b.Dx()*b.Dy())
+	opaque := true
+	for y := b.Min.Y; y < b.Max.Y; y++ {
+		for x := b.Min.X; x < b.Max.X; x++ {
+			c := color.NRGBAModel.Convert(img.At(x, y)).(color.NRGBA)
+			rgbData = append(rgbData, c.R, c.G, c.B)
+			alpha = append(alpha, c.A)
+			if c.A != 0xff {
+				opaque = false
+			}
+		}
+	}
+
+	stream, err := Deflate(imageDict(b.Dx(), b.Dy(), "DeviceRGB", ""), rgbData)
+	if err != nil {
+		return nil, err
+	}
+	pi := &Image{Width: b.Dx(), Height: b.Dy(), Stream: stream}
+	if !opaque {
+		mask, err := Deflate(imageDict(b.Dx(), b.Dy(), "DeviceGray", ""), alpha)
+		if err != nil {
+			return nil, err
+		}
+		pi.SMask = &mask
+	}
+	return pi, nil
+}
+
+// Add stores the image with its soft mask in w.
+func (img *Image) Add(w *Writer) Ref {
+	st := Stream{Dict: Dict{}, Data: img.Stream.Data}
+	for k, v := range img.Stream.Dict {
+		st.Dict[k] = v
+	}
+	if img.SMask != nil {
+		st.Dict["SMask"] = w.Add(*img.SMask)
+	}
+	return w.Add(st)
+}
+
+func imageDict(w, h int, space Name, filter Name) Dict {
+	d := Dict{
+		"Type":             Name("XObject"),
+		"Subtype":          Name("Image"),
+		"Width":            Integer(w),
+		"Height":           Integer(h),
+		"ColorSpace":       space,
+		"BitsPerComponent": Integer(8),
+	}
+	if filter != "" {
+		d["Filter"] = filter
+	}
+	return d
+}
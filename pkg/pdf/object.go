@@ -0,0 +1,325 @@
+// Package pdf reads and writes PDF files with a small object model: names,
+// strings, numbers, arrays, dictionaries, streams and indirect references.
+package pdf
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+	"unicode/utf16"
+)
+
+type Object interface {
+	writePDF(w io.Writer) error
+}
+
+type Name string
+
+func (n Name) writePDF(w io.Writer) error {
+	var b bytes.Buffer
+	b.WriteByte('/')
+	for i := 0; i < len(n); i++ {
+		c := n[i]
+		if c <= ' ' || c >= 0x7f || bytes.IndexByte([]byte("/()<>[]{}%#"), c) >= 0 {
+			fmt.Fprintf(&b, "#%02X", c)
+			continue
+		}
+		b.WriteByte(c)
+	}
+	_, err := w.Write(b.Bytes())
+	return err
+}
+
+// String is a literal string, it is written with the special characters escaped.
+type String string
+
+func (s String) writePDF(w io.Writer) error {
+	var b bytes.Buffer
+	b.WriteByte('(')
+	for i := 0; i < len(s); i++ {
+		switch c := s[i]; c {
+		case '(', ')', '\\':
+			b.WriteByte('\\')
+			b.WriteByte(c)
+		case '\r':
+			b.WriteString(`\r`)
+		case '\n':
+			b.WriteString(`\n`)
+		default:
+			b.WriteByte(c)
+		}
+	}
+	b.WriteByte(')')
+	_, err := w.Write(b.Bytes())
+	return err
+}
+
+// HexString is written as <hex>, it is used for binary strings.
+type HexString []byte
+
+func (s HexString) writePDF(w io.Writer) error {
+	_, err := fmt.Fprintf(w, "<%X>", []byte(s))
+	return err
+}
+
+type Integer int64
+
+func (i Integer) writePDF(w io.Writer) error {
+	_, err := io.WriteString(w, strconv.FormatInt(int64(i), 10))
+	return err
+}
+
+type Real float64
+
+func (r Real) writePDF(w io.Writer) error {
+	_, err := io.WriteString(w, FormatReal(float64(r)))
+	return err
+}
+
+// FormatReal formats a number the way content streams expect it, without
+// exponent and with at most four decimals.
+func FormatReal(f float64) string {
+	s := strconv.FormatFloat(f, 'f', 4, 64)
+	s = trimZeros(s)
+	if s == "-0" {
+		return "0"
+	}
+	return s
+}
+
+func trimZeros(s string) string {
+	if bytes.IndexByte([]byte(s), '.') < 0 {
+		return s
+	}
+	i := len(s)
+	for i > 0 && s[i-1] == '0' {
+		i--
+	}
+	if i > 0 && s[i-1] == '.' {
+		i--
+	}
+	return s[:i]
+}
+
+type Boolean bool
+
+func (b Boolean) writePDF(w io.Writer) error {
+	_, err := io.WriteString(w, strconv.FormatBool(bool(b)))
+	return err
+}
+
+type null struct{}
+
+// Null is the PDF null object.
+var Null Object = null{}
+
+func (null) writePDF(w io.Writer) error {
+	_, err := io.WriteString(w, "null")
+	return err
+}
+
+type Array []Object
+
+func (a Array) writePDF(w io.Writer) error {
+	if _, err := io.WriteString(w, "["); err != nil {
+		return err
+	}
+	for i, o := range a {
+		if i > 0 {
+			if _, err := io.WriteString(w, " "); err != nil {
+				return err
+			}
+		}
+		if err := write(w, o); err != nil {
+			return err
+		}
+	}
+	_, err := io.WriteString(w, "]")
+	return err
+}
+
+// Dict is written with its keys sorted so output is reproducible.
+type Dict map[Name]Object
+
+func (d Dict) writePDF(w io.Writer) error {
+	keys := make([]string, 0, len(d))
+	for k := range d {
+		keys = append(keys, string(k))
+	}
+	sort.Strings(keys)
+
+	if _, err := io.WriteString(w, "<<"); err != nil {
+		return err
+	}
+	for _, k := range keys {
+		if err := Name(k).writePDF(w); err != nil {
+			return err
+		}
+		if _, err := io.WriteString(w, " "); err != nil {
+			return err
+		}
+		if err := write(w, d[Name(k)]); err != nil {
+			return err
+		}
+	}
+	_, err := io.WriteString(w, ">>")
+	return err
+}
+
+// Ref is an indirect reference to an object of a Writer.
+type Ref struct {
+	Number     int
+	Generation int
+}
+
+func (r Ref) writePDF(w io.Writer) error {
+	_, err := fmt.Fprintf(w, "%d %d R", r.Number, r.Generation)
+	return err
+}
+
+// Stream is a dictionary followed by data, Length is set when it is written.
+type Stream struct {
+	Dict Dict
+	Data []byte
+}
+
+func (s Stream) writePDF(w io.Writer) error {
+	d := Dict{}
+	for k, v := range s.Dict {
+		d[k] = v
+	}
+	d["Length"] = Integer(len(s.Data))
+	if err := d.writePDF(w); err != nil {
+		return err
+	}
+	if _, err := io.WriteString(w, "\nstream\n"); err != nil {
+		return err
+	}
+	if _, err := w.Write(s.Data); err != nil {
+		return err
+	}
+	_, err := io.WriteString(w, "\nendstream")
+	return err
+}
+
+func write(w io.Writer, o Object) error {
+	if o == nil {
+		return Null.writePDF(w)
+	}
+	return o.writePDF(w)
+}
+
+// Format returns the serialized form of o, e.g. to write operands of
+// content streams.
+func Format(o Object) string {
+	var b bytes.Buffer
+	write(&b, o)
+	return b.String()
+}
+
+// Text returns s as a text string, e.g. for titles and bookmarks. ASCII text
+// is written as is, other text as UTF-16 with a byte order mark.
+func Text(s string) Object {
+	ascii := true
+	for i := 0; i < len(s); i++ {
+		if s[i] >= 0x80 {
+			ascii = false
+			break
+		}
+	}
+	if ascii {
+		return String(s)
+	}
+	b := []byte{0xfe, 0xff}
+	for _, u := range utf16.Encode([]rune(s)) {
+		b = append(b, byte(u>>8), byte(u))
+	}
+	return HexString(b)
+}
+
+// pdfDocEncoding maps the bytes 0x80 to 0x9f of PDFDocEncoding, the other
+// bytes are Latin-1.
+var pdfDocEncoding = [32]rune{
+	0x2022, 0x2020, 0x2021, 0x2026, 0x2014, 0x2013, 0x0192, 0x2044,
+	0x2039, 0x203a, 0x2212, 0x2030, 0x201e, 0x201c, 0x201d, 0x2018,
+	0x2019, 0x201a, 0x2122, 0xfb01, 0xfb02, 0x0141, 0x0152, 0x0160,
+	0x0178, 0x017d, 0x0131, 0x0142, 0x0153, 0x0161, 0x017e, 0xfffd,
+}
+
+// DecodeText returns the text of a text string as Text writes it, UTF-16
+// with a byte order mark or PDFDocEncoding. Other objects have no text.
+func DecodeText(o Object) string {
+	var b []byte
+	switch s := o.(type) {
+	case String:
+		b = []byte(s)
+	case HexString:
+		b = s
+	default:
+		return ""
+	}
+	if len(b) >= 2 && b[0] == 0xfe && b[1] == 0xff {
+		u := make([]uint16, 0, len(b)/2)
+		for i := 2; i+1 < len(b); i += 2 {
+			u = append(u, uint16(b[i])<<8|uint16(b[i+1]))
+		}
+		return string(utf16.Decode(u))
+	}
+	r := make([]rune, len(b))
+	for i, c := range b {
+		r[i] = rune(c)
+		if c >= 0x80 && c < 0xa0 {
+			r[i] = pdfDocEncoding[c-0x80]
+		}
+	}
+	return string(r)
+}
+
+// Date returns t as a date string like D:20060102150405Z.
+func Date(t time.Time) String {
+	return String(t.UTC().Format("D:20060102150405Z"))
+}
+
+// ParseDate reads a date string, the parts after the year and the offset
+// are optional.
+func ParseDate(s string) (time.Time, error) {
+	s = strings.TrimPrefix(s, "D:")
+	fields := [6]int{0, 1, 1, 0, 0, 0}
+	widths := [6]int{4, 2, 2, 2, 2, 2}
+	for i, w := range widths {
+		if len(s) < w || s[0] < '0' || s[0] > '9' {
+			if i == 0 {
+				return time.Time{}, fmt.Errorf("invalid date %q", s)
+			}
+			break
+		}
+		n, err := strconv.Atoi(s[:w])
+		if err != nil {
+			return time.Time{}, fmt.Errorf("invalid date %q", s)
+		}
+		fields[i], s = n, s[w:]
+	}
+
+	loc := time.UTC
+	if len(s) > 0 && (s[0] == '+' || s[0] == '-') {
+		parts := strings.Split(strings.TrimSuffix(s[1:], "'"), "'")
+		h, err := strconv.Atoi(parts[0])
+		if err != nil {
+			return time.Time{}, fmt.Errorf("invalid date offset %q", s)
+		}
+		m := 0
+		if len(parts) > 1 {
+			m, _ = strconv.Atoi(parts[1])
+		}
+		offset := h*3600 + m*60
+		if s[0] == '-' {
+			offset = -offset
+		}
+		loc = time.FixedZone("", offset)
+	}
+	return time.Date(fields[0], time.Month(fields[1]), fields[2], fields[3], fields[4], fields[5], 0, loc), nil
+}
@@ -0,0 +1,395 @@
+package pdf
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"strconv"
+)
+
+var ErrMalformed = errors.New("malformed pdf")
+
+// parser reads objects from pdf syntax starting at pos.
+type parser struct {
+	data []byte
+	pos  int
+	// length resolves indirect stream lengths, it may be nil
+	length func(Object) (int, bool)
+}
+
+func isWhite(c byte) bool {
+	return c == ' ' || c == '\n' || c == '\r' || c == '\t' || c == '\f' || c == 0
+}
+
+func isDelim(c byte) bool {
+	return bytes.IndexByte([]byte("()<>[]{}/%"), c) >= 0
+}
+
+func isRegular(c byte) bool {
+	return !isWhite(c) && !isDelim(c)
+}
+
+func (p *parser) errorf(format string, args ...interface{}) error {
+	return fmt.Errorf("%w: %s at offset %d", ErrMalformed, fmt.Sprintf(format, args...), p.pos)
+}
+
+// skip moves past white space and comments.
+func (p *parser) skip() {
+	for p.pos < len(p.data) {
+		c := p.data[p.pos]
+		if isWhite(c) {
+			p.pos++
+			continue
+		}
+		if c == '%' {
+			for p.pos < len(p.data) && p.data[p.pos] != '\n' && p.data[p.pos] != '\r' {
+				p.pos++
+			}
+			continue
+		}
+		return
+	}
+}
+
+// keyword reads a run of regular characters, like true, obj or R.
+func (p *parser) keyword() string {
+	p.skip()
+	start := p.pos
+	for p.pos < len(p.data) && isRegular(p.data[p.pos]) {
+		p.pos++
+	}
+	return string(p.data[start:p.pos])
+}
+
+// peekKeyword reports whether the next token is kw without consuming it.
+func (p *parser) peekKeyword(kw string) bool {
+	pos := p.pos
+	ok := p.keyword() == kw
+	p.pos = pos
+	return ok
+}
+
+// object parses the next object, references included.
+func (p *parser) object() (Object, error) {
+	p.skip()
+	if p.pos >= len(p.data) {
+		return nil, p.errorf("unexpected end")
+	}
+
+	switch c := p.data[p.pos]; {
+	case c == '/':
+		return p.name()
+	case c == '(':
+		return p.literal()
+	case c == '<' && p.pos+1 < len(p.data) && p.data[p.pos+1] == '<':
+		return p.dictOrStream()
+	case c == '<':
+		return p.hex()
+	case c == '[':
+		return p.array()
+	case c == '+' || c == '-' || c == '.' || (c >= '0' && c <= '9'):
+		return p.numberOrRef()
+	}
+
+	switch kw := p.keyword(); kw {
+	case "true":
+		return Boolean(true), nil
+	case "false":
+		return Boolean(false), nil
+	case "null":
+		return Null, nil
+	case "":
+		return nil, p.errorf("unexpected %q", p.data[p.pos])
+	default:
+		return nil, p.errorf("unexpected keyword %q", kw)
+	}
+}
+
+func (p *parser) name() (Object, error) {
+	p.pos++
+	var b []byte
+	for p.pos < len(p.data) && isRegular(p.data[p.pos]) {
+		c := p.data[p.pos]
+		if c == '#' && p.pos+2 < len(p.data) {
+			if v, err := strconv.ParseUint(string(p.data[p.pos+1:p.pos+3]), 16, 8); err == nil {
+				b = append(b, byte(v))
+				p.pos += 3
+				continue
+			}
+		}
+		b = append(b, c)
+		p.pos++
+	}
+	return Name(b), nil
+}
+
+func (p *parser) literal() (Object, error) {
+	p.pos++
+	var b []byte
+	depth := 0
+	for p.pos < len(p.data) {
+		c := p.data[p.pos]
+		p.pos++
+		switch c {
+		case '(':
+			depth++
+		case ')':
+			if depth == 0 {
+				return String(b), nil
+			}
+			depth--
+		case '\r':
+			// end of line markers in strings read as \n
+			if p.pos < len(p.data) && p.data[p.pos] == '\n' {
+				p.pos++
+			}
+			c = '\n'
+		case '\\':
+			if p.pos >= len(p.data) {
+				return nil, p.errorf("unterminated string")
+			}
+			e := p.data[p.pos]
+			p.pos++
+			switch e {
+			case 'n':
+				c = '\n'
+			case 'r':
+				c = '\r'
+			case 't':
+				c = '\t'
+			case 'b':
+				c = '\b'
+			case 'f':
+				c = '\f'
+			case '\r':
+				if p.pos < len(p.data) && p.data[p.pos] == '\n' {
+					p.pos++
+				}
+				continue
+			case '\n':
+				continue
+			default:
+				if e >= '0' && e <= '7' {
+					v := int(e - '0')
+					for i := 0; i < 2 && p.pos < len(p.data) && p.data[p.pos] >= '0' && p.data[p.pos] <= '7'; i++ {
+						v = v*8 + int(p.data[p.pos]-'0')
+						p.pos++
+					}
+					c = byte(v)
+				} else {
+					c = e
+				}
+			}
+		}
+		b = append(b, c)
+	}
+	return nil, p.errorf("unterminated string")
+}
+
+func (p *parser) hex() (Object, error) {
+	p.pos++
+	var digits []byte
+	for p.pos < len(p.data) && p.data[p.pos] != '>' {
+		c := p.data[p.pos]
+		p.pos++
+		if isWhite(c) {
+			continue
+		}
+		digits = append(digits, c)
+	}
+	if p.pos >= len(p.data) {
+		return nil, p.errorf("unterminated hex string")
+	}
+	p.pos++
+	if len(digits)%2 == 1 {
+		digits = append(digits, '0')
+	}
+	b := make([]byte, len(digits)/2)
+	for i := range b {
+		v, err := strconv.ParseUint(string(digits[2*i:2*i+2]), 16, 8)
+		if err != nil {
+			return nil, p.errorf("invalid hex string")
+		}
+		b[i] = byte(v)
+	}
+	return HexString(b), nil
+}
+
+func (p *parser) array() (Object, error) {
+	p.pos++
+	a := Array{}
+	for {
+		p.skip()
+		if p.pos >= len(p.data) {
+			return nil, p.errorf("unterminated array")
+		}
+		if p.data[p.pos] == ']' {
+			p.pos++
+			return a, nil
+		}
+		o, err := p.object()
+		if err != nil {
+			return nil, err
+		}
+		a = append(a, o)
+	}
+}
+
+func (p *parser) dict() (Dict, error) {
+	p.pos += 2
+	d := Dict{}
+	for {
+		p.skip()
+		if p.pos+1 < len(p.data) && p.data[p.pos] == '>' && p.data[p.pos+1] == '>' {
+			p.pos += 2
+			return d, nil
+		}
+		if p.pos >= len(p.data) {
+			return nil, p.errorf("unterminated dictionary")
+		}
+		k, err := p.object()
+		if err != nil {
+			return nil, err
+		}
+		name, ok := k.(Name)
+		if !ok {
+			return nil, p.errorf("dictionary key is not a name")
+		}
+		v, err := p.object()
+		if err != nil {
+			return nil, err
+		}
+		// null values are the same as missing entries
+		if v != Null {
+			d[name] = v
+		}
+	}
+}
+
+func (p *parser) dictOrStream() (Object, error) {
+	d, err := p.dict()
+	if err != nil {
+		return nil, err
+	}
+	if !p.peekKeyword("stream") {
+		return d, nil
+	}
+	p.keyword()
+	// the keyword is followed by CRLF or LF, some writers only use CR
+	if p.pos < len(p.data) && p.data[p.pos] == '\r' {
+		p.pos++
+	}
+	if p.pos < len(p.data) && p.data[p.pos] == '\n' {
+		p.pos++
+	}
+
+	start := p.pos
+	n := -1
+	if l, ok := d["Length"].(Integer); ok {
+		n = int(l)
+	} else if p.length != nil {
+		if l, ok := p.length(d["Length"]); ok {
+			n = l
+		}
+	}
+	if n < 0 || start+n > len(p.data) || !bytes.HasPrefix(bytes.TrimLeft(p.data[start+n:], "\r\n \t"), []byte("endstream")) {
+		// wrong lengths are common, the data ends before endstream
+		end := bytes.Index(p.data[start:], []byte("endstream"))
+		if end < 0 {
+			return nil, p.errorf("unterminated stream")
+		}
+		n = end
+		for n > 0 && (p.data[start+n-1] == '\n' || p.data[start+n-1] == '\r') {
+			n--
+		}
+	}
+
+	data := p.data[start : start+n]
+	p.pos = start + n
+	if p.keyword() != "endstream" {
+		return nil, p.errorf("missing endstream")
+	}
+	delete(d, "Length")
+	return Stream{Dict: d, Data: data}, nil
+}
+
+func (p *parser) number() (Object, error) {
+	start := p.pos
+	real := false
+	for p.pos < len(p.data) {
+		c := p.data[p.pos]
+		if c == '.' {
+			real = true
+		} else if !(c >= '0' && c <= '9') && !((c == '+' || c == '-') && p.pos == start) {
+			break
+		}
+		p.pos++
+	}
+	s := string(p.data[start:p.pos])
+	if real {
+		f, err := strconv.ParseFloat(s, 64)
+		if err != nil {
+			return nil, p.errorf("invalid number %q", s)
+		}
+		return Real(f), nil
+	}
+	i, err := strconv.ParseInt(s, 10, 64)
+	if err != nil {
+		// some writers emit -0 or huge numbers, read them as reals
+		f, ferr := strconv.ParseFloat(s, 64)
+		if ferr != nil {
+			return nil, p.errorf("invalid number %q", s)
+		}
+		return Real(f), nil
+	}
+	return Integer(i), nil
+}
+
+// numberOrRef reads a number, or a reference when two integers are followed
+// by R.
+func (p *parser) numberOrRef() (Object, error) {
+	o, err := p.number()
+	if err != nil {
+		return nil, err
+	}
+	num, ok := o.(Integer)
+	if !ok || num < 0 {
+		return o, nil
+	}
+
+	pos := p.pos
+	p.skip()
+	if p.pos < len(p.data) && p.data[p.pos] >= '0' && p.data[p.pos] <= '9' {
+		g, err := p.number()
+		if gen, ok := g.(Integer); err == nil && ok {
+			if p.keyword() == "R" {
+				return Ref{Number: int(num), Generation: int(gen)}, nil
+			}
+		}
+	}
+	p.pos = pos
+	return o, nil
+}
+
+// indirect parses "n g obj ... endobj" at the current position.
+func (p *parser) indirect() (Ref, Object, error) {
+	n, err := p.number()
+	if err != nil {
+		return Ref{}, nil, err
+	}
+	p.skip()
+	g, err := p.number()
+	if err != nil {
+		return Ref{}, nil, err
+	}
+	num, ok1 := n.(Integer)
+	gen, ok2 := g.(Integer)
+	if !ok1 || !ok2 || p.keyword() != "obj" {
+		return Ref{}, nil, p.errorf("expected object header")
+	}
+	o, err := p.object()
+	if err != nil {
+		return Ref{}, nil, err
+	}
+	return Ref{Number: int(num), Generation: int(gen)}, o, nil
+}
@@ -0,0 +1,130 @@
+package pdf
+
+import (
+	"bytes"
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestFormat(t *testing.T) {
+	tests := []struct {
+		name string
+		obj  Object
+		want string
+	}{
+		{name: "name", obj: Name("Type"), want: "/Type"},
+		{name: "name with delimiters", obj: Name("A B/C"), want: "/A#20B#2FC"},
+		{name: "string", obj: String(`a (b) \c`), want: `(a \(b\) \\c)`},
+		{name: "hex string", obj: HexString{0x01, 0xab}, want: "<01AB>"},
+		{name: "real", obj: Real(1.50), want: "1.5"},
+		{name: "whole real", obj: Real(2), want: "2"},
+		{name: "negative zero", obj: Real(-0.00001), want: "0"},
+		{name: "array", obj: Array{Integer(1), Boolean(true), nil}, want: "[1 true null]"},
+		{name: "dict sorted", obj: Dict{"b": Integer(2), "a": Ref{Number: 3}}, want: "<</a 3 0 R/b 2>>"},
+		{name: "stream", obj: Stream{Dict: Dict{}, Data: []byte("abc")}, want: "<</Length 3>>\nstream\nabc\nendstream"},
+	}
+
+	for _, tc := range tests {
+		got := Format(tc.obj)
+		if got != tc.want {
+			t.Fatalf("%s: expected: %v, got: %v", tc.name, tc.want, got)
+		}
+	}
+}
+
+func TestWriterCrossReference(t *testing.T) {
+	w := NewWriter()
+	pages := w.Reserve()
+	catalog := w.Add(Dict{"Type": Name("Catalog"), "Pages": pages})
+	w.Set(pages, Dict{"Type": Name("Pages"), "Kids": Array{}, "Count": Integer(0)})
+
+	b, err := w.Bytes("1.4", Dict{"Root": catalog})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	m := regexp.MustCompile(`startxref\n(\d+)\n%%EOF\n$`).FindSubmatch(b)
+	if m == nil {
+		t.Fatalf("expected: %v, got: %s", "startxref", b)
+	}
+	xref, _ := strconv.Atoi(string(m[1]))
+	if !bytes.HasPrefix(b[xref:], []byte("xref\n0 3\n")) {
+		t.Fatalf("expected: %v, got: %q", "xref table", b[xref:xref+10])
+	}
+
+	entries := regexp.MustCompile(`(\d{10}) 00000 n `).FindAllSubmatch(b[xref:], -1)
+	if len(entries) != 2 {
+		t.Fatalf("expected: %v, got: %v", 2, len(entries))
+	}
+	for i, e := range entries {
+		off, _ := strconv.Atoi(string(e[1]))
+		want := fmt.Sprintf("%d 0 obj", i+1)
+		if !bytes.HasPrefix(b[off:], []byte(want)) {
+			t.Fatalf("expected: %v, got: %q", want, b[off:off+len(want)])
+		}
+	}
+	if !bytes.Contains(b, []byte("/Root 2 0 R/Size 3")) {
+		t.Fatalf("expected: %v, got: %s", "trailer", b)
+	}
+}
+
+func TestWriterUnsetObject(t *testing.T) {
+	w := NewWriter()
+	w.Reserve()
+	_, err := w.Bytes("1.4", Dict{})
+	if err != ErrUnsetObject {
+		t.Fatalf("expected: %v, got: %v", ErrUnsetObject, err)
+	}
+}
+
+func TestWinAnsi(t *testing.T) {
+	if got := WinAnsi("€ café ✓"); got != "\x80 caf\xe9 ?" {
+		t.Fatalf("expected: %q, got: %q", "\x80 caf\xe9 ?", got)
+	}
+}
+
+func TestFontWrap(t *testing.T) {
+	got := strings.Join(Helvetica.Wrap("Due on receipt, café\r\nthanks", 10, 60), "|")
+	if want := "Due on|receipt, caf\xe9|thanks"; got != want {
+		t.Fatalf("expected: %q, got: %q", want, got)
+	}
+}
+
+func TestDecodeText(t *testing.T) {
+	for _, s := range []string{"Invoice 42", "Jürgen – Ågren ✓"} {
+		if got := DecodeText(Text(s)); got != s {
+			t.Fatalf("expected: %q, got: %q", s, got)
+		}
+	}
+	if got := DecodeText(String("\x80 caf\xe9")); got != "• café" {
+		t.Fatalf("expected: %q, got: %q", "• café", got)
+	}
+}
+
+func TestParseDate(t *testing.T) {
+	tests := []struct {
+		in      string
+		want    time.Time
+		wantErr bool
+	}{
+		{in: "D:20261019093000Z", want: time.Date(2026, 10, 19, 9, 30, 0, 0, time.UTC)},
+		{in: "D:20261019113000+02'00'", want: time.Date(2026, 10, 19, 9, 30, 0, 0, time.UTC)},
+		{in: "D:20261019043000-05'00", want: time.Date(2026, 10, 19, 9, 30, 0, 0, time.UTC)},
+		{in: "D:2026", want: time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC)},
+		{in: "yesterday", wantErr: true},
+	}
+
+	for _, tc := range tests {
+		got, err := ParseDate(tc.in)
+		if (err != nil) != tc.wantErr || !got.Equal(tc.want) {
+			t.Fatalf("%s: expected: %v %v, got: %v %v", tc.in, tc.want, tc.wantErr, got, err)
+		}
+	}
+	if got, _ := ParseDate(string(Date(time.Date(2026, 10, 19, 9, 30, 0, 0, time.UTC)))); !got.Equal(time.Date(2026, 10, 19, 9, 30, 0, 0, time.UTC)) {
+		t.Fatalf("expected: %v, got: %v", "date written and read", got)
+	}
+}
@@ -0,0 +1,523 @@
+package pdf
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"regexp"
+	"strconv"
+)
+
+var (
+	ErrEncrypted      = errors.New("pdf is encrypted")
+	ErrObjectNotFound = errors.New("pdf object not found")
+)
+
+// maxDepth bounds reference chains and page tree depth of malformed files.
+const maxDepth = 64
+
+type xrefEntry struct {
+	offset int
+	// stream is the number of the object stream holding a compressed object,
+	// index its position in the stream
+	stream int
+	index  int
+}
+
+// Reader reads the objects of a PDF file. Cross reference tables, cross
+// reference streams and object streams are supported, damaged files are read
+// by scanning for objects.
+type Reader struct {
+	data    []byte
+	version string
+	xref    map[int]xrefEntry
+	trailer Dict
+	cache   map[int]Object
+}
+
+// NewReader reads the cross references of data. Encrypted files are not
+// supported and fail with ErrEncrypted.
+func NewReader(data []byte) (*Reader, error) {
+	r := &Reader{
+		data:  data,
+		xref:  map[int]xrefEntry{},
+		cache: map[int]Object{},
+	}
+
+	i := bytes.Index(data, []byte("%PDF-"))
+	if i < 0 {
+		return nil, fmt.Errorf("%w: missing header", ErrMalformed)
+	}
+	r.version = string(bytes.TrimRight(data[i+5:min(i+8, len(data))], "\r\n "))
+
+	if err := r.readXref(); err != nil || r.trailer["Root"] == nil {
+		r.xref, r.trailer, r.cache = map[int]xrefEntry{}, nil, map[int]Object{}
+		if err := r.scan(); err != nil {
+			return nil, err
+		}
+	}
+	if r.trailer["Encrypt"] != nil {
+		return nil, ErrEncrypted
+	}
+	return r, nil
+}
+
+func min(a, b int) int {
+	if a < b {
+		return a
+	}
+	return b
+}
+
+// Version returns the version of the header, e.g. 1.4.
+func (r *Reader) Version() string {
+	return r.version
+}
+
+// Trailer returns the trailer dictionary, for cross reference streams it is
+// the stream dictionary.
+func (r *Reader) Trailer() Dict {
+	return r.trailer
+}
+
+// Catalog returns the document catalog.
+func (r *Reader) Catalog() (Dict, error) {
+	return r.Dict(r.trailer["Root"])
+}
+
+// readXref reads the sections starting from the last startxref, following
+// Prev. Entries of newer sections take precedence.
+func (r *Reader) readXref() error {
+	i := bytes.LastIndex(r.data, []byte("startxref"))
+	if i < 0 {
+		return fmt.Errorf("%w: missing startxref", ErrMalformed)
+	}
+	p := &parser{data: r.data, pos: i + len("startxref")}
+	p.skip()
+	o, err := p.number()
+	if err != nil {
+		return err
+	}
+	offset, ok := o.(Integer)
+
+	seen := map[int]bool{}
+	for ok {
+		if offset < 0 || int(offset) >= len(r.data) || seen[int(offset)] {
+			return fmt.Errorf("%w: invalid xref offset %d", ErrMalformed, offset)
+		}
+		seen[int(offset)] = true
+
+		trailer, err := r.readSection(int(offset))
+		if err != nil {
+			return err
+		}
+		if r.trailer == nil {
+			r.trailer = trailer
+		}
+		// hybrid files keep the compressed objects in a stream next to the table
+		if stm, ok := trailer["XRefStm"].(Integer); ok && !seen[int(stm)] {
+			seen[int(stm)] = true
+			if _, err := r.readSection(int(stm)); err != nil {
+				return err
+			}
+		}
+		offset, ok = trailer["Prev"].(Integer)
+	}
+	return nil
+}
+
+func (r *Reader) readSection(offset int) (Dict, error) {
+	p := &parser{data: r.data, pos: offset}
+	if p.peekKeyword("xref") {
+		p.keyword()
+		return r.readTable(p)
+	}
+
+	_, o, err := p.indirect()
+	if err != nil {
+		return nil, err
+	}
+	s, ok := o.(Stream)
+	if !ok || s.Dict["Type"] != Name("XRef") {
+		return nil, fmt.Errorf("%w: xref offset %d is not a cross reference", ErrMalformed, offset)
+	}
+	return s.Dict, r.readStream(s)
+}
+
+func (r *Reader) readTable(p *parser) (Dict, error) {
+	for {
+		if p.peekKeyword("trailer") {
+			p.keyword()
+			p.skip()
+			if !bytes.HasPrefix(p.data[p.pos:], []byte("<<")) {
+				return nil, p.errorf("expected trailer dictionary")
+			}
+			return p.dict()
+		}
+
+		p.skip()
+		s, err := p.number()
+		if err != nil {
+			return nil, err
+		}
+		p.skip()
+		n, err := p.number()
+		if err != nil {
+			return nil, err
+		}
+		start, ok1 := s.(Integer)
+		count, ok2 := n.(Integer)
+		if !ok1 || !ok2 || start < 0 || count < 0 {
+			return nil, p.errorf("invalid xref subsection")
+		}
+
+		for i := 0; i < int(count); i++ {
+			p.skip()
+			off, err := p.number()
+			if err != nil {
+				return nil, err
+			}
+			p.skip()
+			if _, err := p.number(); err != nil {
+				return nil, err
+			}
+			kind := p.keyword()
+			num := int(start) + i
+			if _, ok := r.xref[num]; ok {
+				continue
+			}
+			v, _ := off.(Integer)
+			switch kind {
+			case "n":
+				r.xref[num] = xrefEntry{offset: int(v)}
+			case "f":
+				r.xref[num] = xrefEntry{offset: -1}
+			default:
+				return nil, p.errorf("invalid xref entry")
+			}
+		}
+	}
+}
+
+// readStream reads the entries of a cross reference stream.
+func (r *Reader) readStream(s Stream) error {
+	data, err := DecodeStream(s)
+	if err != nil {
+		return err
+	}
+
+	w, ok := s.Dict["W"].(Array)
+	if !ok || len(w) != 3 {
+		return fmt.Errorf("%w: invalid xref stream widths", ErrMalformed)
+	}
+	var widths [3]int
+	for i := range widths {
+		n, ok := w[i].(Integer)
+		if !ok || n < 0 || n > 8 {
+			return fmt.Errorf("%w: invalid xref stream widths", ErrMalformed)
+		}
+		widths[i] = int(n)
+	}
+
+	size, _ := s.Dict["Size"].(Integer)
+	index := Array{Integer(0), size}
+	if a, ok := s.Dict["Index"].(Array); ok {
+		index = a
+	}
+
+	field := func(b []byte) int {
+		v := 0
+		for _, c := range b {
+			v = v<<8 | int(c)
+		}
+		return v
+	}
+
+	row := widths[0] + widths[1] + widths[2]
+	for i := 0; i+1 < len(index); i += 2 {
+		start, ok1 := index[i].(Integer)
+		count, ok2 := index[i+1].(Integer)
+		if !ok1 || !ok2 {
+			return fmt.Errorf("%w: invalid xref stream index", ErrMalformed)
+		}
+		for j := 0; j < int(count) && len(data) >= row; j++ {
+			entry := data[:row]
+			data = data[row:]
+
+			// the type defaults to 1 when its field is missing
+			kind := 1
+			if widths[0] > 0 {
+				kind = field(entry[:widths[0]])
+			}
+			a := field(entry[widths[0] : widths[0]+widths[1]])
+			b := field(entry[widths[0]+widths[1]:])
+
+			num := int(start) + j
+			if _, ok := r.xref[num]; ok {
+				continue
+			}
+			switch kind {
+			case 0:
+				r.xref[num] = xrefEntry{offset: -1}
+			case 1:
+				r.xref[num] = xrefEntry{offset: a}
+			case 2:
+				r.xref[num] = xrefEntry{stream: a, index: b}
+			}
+		}
+	}
+	return nil
+}
+
+var objectHeader = regexp.MustCompile(`(?m)(?:^|[\r\n ])(\d+)\s+(\d+)\s+obj\b`)
+
+// scan rebuilds the cross references of damaged files from the object
+// headers, later objects replace earlier ones like incremental updates do.
+func (r *Reader) scan() error {
+	for _, m := range objectHeader.FindAllSubmatchIndex(r.data, -1) {
+		num, err := strconv.Atoi(string(r.data[m[2]:m[3]]))
+		if err != nil {
+			continue
+		}
+		r.xref[num] = xrefEntry{offset: m[2]}
+	}
+
+	// the trailer is the last trailer dictionary, or the catalog found among
+	// the objects
+	if i := bytes.LastIndex(r.data, []byte("trailer")); i >= 0 {
+		p := &parser{data: r.data, pos: i + len("trailer")}
+		p.skip()
+		if bytes.HasPrefix(r.data[p.pos:], []byte("<<")) {
+			if d, err := p.dict(); err == nil && d["Root"] != nil {
+				r.trailer = d
+			}
+		}
+	}
+	if r.trailer == nil {
+		for num := range r.xref {
+			o, err := r.object(num)
+			if err != nil {
+				continue
+			}
+			if s, ok := o.(Stream); ok && s.Dict["Type"] == Name("XRef") && s.Dict["Root"] != nil {
+				r.trailer = s.Dict
+				break
+			}
+			if d, ok := o.(Dict); ok && d["Type"] == Name("Catalog") {
+				r.trailer = Dict{"Root": Ref{Number: num}}
+			}
+		}
+	}
+	if r.trailer == nil {
+		return fmt.Errorf("%w: missing document catalog", ErrMalformed)
+	}
+	return nil
+}
+
+// object returns the object num, reading it on first use.
+func (r *Reader) object(num int) (Object, error) {
+	if o, ok := r.cache[num]; ok {
+		return o, nil
+	}
+	e, ok := r.xref[num]
+	if !ok || e.offset < 0 {
+		return nil, fmt.Errorf("%w: %d", ErrObjectNotFound, num)
+	}
+
+	var o Object
+	var err error
+	if e.stream > 0 {
+		o, err = r.compressed(e.stream, e.index)
+	} else {
+		p := &parser{data: r.data, pos: e.offset, length: r.length}
+		_, o, err = p.indirect()
+	}
+	if err != nil {
+		return nil, err
+	}
+	r.cache[num] = o
+	return o, nil
+}
+
+// length resolves indirect stream lengths.
+func (r *Reader) length(o Object) (int, bool) {
+	ref, ok := o.(Ref)
+	if !ok {
+		return 0, false
+	}
+	if v, ok := r.cache[ref.Number]; ok {
+		n, ok := v.(Integer)
+		return int(n), ok
+	}
+	e, ok := r.xref[ref.Number]
+	if !ok || e.offset < 0 || e.stream > 0 {
+		return 0, false
+	}
+	// lengths are plain integers, this parser reads no further lengths
+	p := &parser{data: r.data, pos: e.offset}
+	_, v, err := p.indirect()
+	if err != nil {
+		return 0, false
+	}
+	n, ok := v.(Integer)
+	return int(n), ok
+}
+
+// compressed reads the object at index of the object stream num.
+func (r *Reader) compressed(num, index int) (Object, error) {
+	o, err := r.object(num)
+	if err != nil {
+		return nil, err
+	}
+	s, ok := o.(Stream)
+	if !ok {
+		return nil, fmt.Errorf("%w: %d is not an object stream", ErrMalformed, num)
+	}
+	data, err := DecodeStream(s)
+	if err != nil {
+		return nil, err
+	}
+	n, _ := s.Dict["N"].(Integer)
+	first, _ := s.Dict["First"].(Integer)
+	if index < 0 || index >= int(n) || int(first) > len(data) {
+		return nil, fmt.Errorf("%w: invalid object stream %d", ErrMalformed, num)
+	}
+
+	p := &parser{data: data}
+	var offset Integer
+	for i := 0; i <= index; i++ {
+		p.skip()
+		if _, err := p.number(); err != nil {
+			return nil, err
+		}
+		p.skip()
+		o, err := p.number()
+		if err != nil {
+			return nil, err
+		}
+		offset, _ = o.(Integer)
+	}
+	p.pos = int(first) + int(offset)
+	if p.pos > len(data) {
+		return nil, fmt.Errorf("%w: invalid object stream %d", ErrMalformed, num)
+	}
+	return p.object()
+}
+
+// Resolve follows references until o is a direct object. Missing objects
+// resolve to Null.
+func (r *Reader) Resolve(o Object) (Object, error) {
+	for i := 0; i < maxDepth; i++ {
+		ref, ok := o.(Ref)
+		if !ok {
+			if o == nil {
+				return Null, nil
+			}
+			return o, nil
+		}
+		v, err := r.object(ref.Number)
+		if errors.Is(err, ErrObjectNotFound) {
+			return Null, nil
+		}
+		if err != nil {
+			return nil, err
+		}
+		o = v
+	}
+	return nil, fmt.Errorf("%w: reference loop", ErrMalformed)
+}
+
+// Dict resolves o to a dictionary, the dictionary of a stream included.
+func (r *Reader) Dict(o Object) (Dict, error) {
+	v, err := r.Resolve(o)
+	if err != nil {
+		return nil, err
+	}
+	switch d := v.(type) {
+	case Dict:
+		return d, nil
+	case Stream:
+		return d.Dict, nil
+	}
+	return nil, fmt.Errorf("%w: expected dictionary, got %s", ErrMalformed, Format(v))
+}
+
+// Page is a page object with the attributes inherited from the page tree
+// copied into Dict.
+type Page struct {
+	Ref  Ref
+	Dict Dict
+}
+
+// inherited are the page attributes a page takes from its ancestors.
+var inherited = []Name{"Resources", "MediaBox", "CropBox", "Rotate"}
+
+// Pages returns the pages in document order.
+func (r *Reader) Pages() ([]Page, error) {
+	catalog, err := r.Catalog()
+	if err != nil {
+		return nil, err
+	}
+	root, ok := catalog["Pages"].(Ref)
+	if !ok {
+		return nil, fmt.Errorf("%w: missing page tree", ErrMalformed)
+	}
+
+	var pages []Page
+	seen := map[int]bool{}
+	var walk func(ref Ref, attrs Dict, depth int) error
+	walk = func(ref Ref, attrs Dict, depth int) error {
+		if seen[ref.Number] || depth > maxDepth {
+			return fmt.Errorf("%w: page tree loop", ErrMalformed)
+		}
+		seen[ref.Number] = true
+
+		node, err := r.Dict(ref)
+		if err != nil {
+			return err
+		}
+		values := Dict{}
+		for k, v := range attrs {
+			values[k] = v
+		}
+		for _, k := range inherited {
+			if v, ok := node[k]; ok {
+				values[k] = v
+			}
+		}
+
+		kids, hasKids := node["Kids"]
+		if node["Type"] == Name("Page") || (!hasKids && node["Type"] != Name("Pages")) {
+			page := Dict{}
+			for k, v := range node {
+				page[k] = v
+			}
+			for k, v := range values {
+				page[k] = v
+			}
+			pages = append(pages, Page{Ref: ref, Dict: page})
+			return nil
+		}
+
+		v, err := r.Resolve(kids)
+		if err != nil {
+			return err
+		}
+		a, _ := v.(Array)
+		for _, kid := range a {
+			k, ok := kid.(Ref)
+			if !ok {
+				return fmt.Errorf("%w: page is not a reference", ErrMalformed)
+			}
+			if err := walk(k, values, depth+1); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+
+	if err := walk(root, Dict{}, 0); err != nil {
+		return nil, err
+	}
+	return pages, nil
+}
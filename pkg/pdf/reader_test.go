@@ -0,0 +1,228 @@
+package pdf
+
+import (
+	"bytes"
+	"compress/zlib"
+	"errors"
+	"fmt"
+	"reflect"
+	"testing"
+)
+
+func TestParseObject(t *testing.T) {
+	tests := []struct {
+		name string
+		in   string
+		want Object
+	}{
+		{name: "name with escape", in: "/A#20B", want: Name("A B")},
+		{name: "literal string", in: `(a (b) \(c\) \101\n)`, want: String("a (b) (c) A\n")},
+		{name: "hex string", in: "<01 ab f>", want: HexString{0x01, 0xab, 0xf0}},
+		{name: "integer", in: "-12", want: Integer(-12)},
+		{name: "real", in: ".5", want: Real(0.5)},
+		{name: "reference", in: "12 0 R", want: Ref{Number: 12}},
+		{name: "numbers in array", in: "[1 2 3 0 R]", want: Array{Integer(1), Integer(2), Ref{Number: 3}}},
+		{name: "dict without nulls", in: "<</A true/B null %comment\n/C[]>>", want: Dict{"A": Boolean(true), "C": Array{}}},
+		{name: "stream with wrong length", in: "<</Length 99>>stream\r\nabc\r\nendstream", want: Stream{Dict: Dict{}, Data: []byte("abc")}},
+	}
+
+	for _, tc := range tests {
+		p := &parser{data: []byte(tc.in)}
+		got, err := p.object()
+		if err != nil {
+			t.Fatalf("%s: unexpected error: %v", tc.name, err)
+		}
+		if !reflect.DeepEqual(got, tc.want) {
+			t.Fatalf("%s: expected: %#v, got: %#v", tc.name, tc.want, got)
+		}
+	}
+}
+
+// writeTestFile writes a file of two pages, the MediaBox of the second page
+// is inherited from the page tree.
+func writeTestFile(t *testing.T) []byte {
+	w := NewWriter()
+	pages := w.Reserve()
+	content, err := Deflate(nil, []byte("0 0 m 10 10 l S"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	c := w.Add(content)
+	p1 := w.Add(Dict{"Type": Name("Page"), "Parent": pages, "Contents": c, "MediaBox": Array{Integer(0), Integer(0), Integer(100), Integer(100)}})
+	p2 := w.Add(Dict{"Type": Name("Page"), "Parent": pages})
+	w.Set(pages, Dict{"Type": Name("Pages"), "Kids": Array{p1, p2}, "Count": Integer(2), "MediaBox": Array{Integer(0), Integer(0), Integer(595), Integer(842)}})
+	catalog := w.Add(Dict{"Type": Name("Catalog"), "Pages": pages})
+
+	b, err := w.Bytes("1.4", Dict{"Root": catalog})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return b
+}
+
+func deflate(t *testing.T, b []byte) []byte {
+	var out bytes.Buffer
+	zw := zlib.NewWriter(&out)
+	zw.Write(b)
+	if err := zw.Close(); err != nil {
+		t.Fatal(err)
+	}
+	return out.Bytes()
+}
+
+// writeCompressedFile writes a file with its page tree in an object stream
+// and a cross reference stream encoded with the PNG up predictor.
+func writeCompressedFile(t *testing.T) []byte {
+	var b bytes.Buffer
+	b.WriteString("%PDF-1.5\n")
+
+	pages := "<</Type/Pages/Kids[3 0 R]/Count 1>> "
+	page := "<</Type/Page/Parent 2 0 R/MediaBox[0 0 200 300]>>"
+	header := fmt.Sprintf("2 0 3 %d ", len(pages))
+	stm := deflate(t, []byte(header+pages+page))
+	catalog := b.Len()
+	b.WriteString("1 0 obj\n<</Type/Catalog/Pages 2 0 R>>\nendobj\n")
+	objstm := b.Len()
+	fmt.Fprintf(&b, "4 0 obj\n<</Type/ObjStm/N 2/First %d/Filter/FlateDecode/Length %d>>stream\n", len(header), len(stm))
+	b.Write(stm)
+	b.WriteString("\nendstream\nendobj\n")
+
+	rows := [][]byte{
+		{0, 0, 0, 0},
+		{1, byte(catalog >> 8), byte(catalog), 0},
+		{2, 0, 4, 0},
+		{2, 0, 4, 1},
+		{1, byte(objstm >> 8), byte(objstm), 0},
+		{1, 0, 0, 0},
+	}
+	xref := b.Len()
+	rows[5][1], rows[5][2] = byte(xref>>8), byte(xref)
+	var raw []byte
+	prev := make([]byte, 4)
+	for _, row := range rows {
+		raw = append(raw, 2)
+		for i := range row {
+			raw = append(raw, row[i]-prev[i])
+		}
+		prev = row
+	}
+	data := deflate(t, raw)
+	fmt.Fprintf(&b, "5 0 obj\n<</Type/XRef/Size 6/W[1 2 1]/Root 1 0 R/Filter/FlateDecode/DecodeParms<</Predictor 12/Columns 4>>/Length %d>>stream\n", len(data))
+	b.Write(data)
+	fmt.Fprintf(&b, "\nendstream\nendobj\nstartxref\n%d\n%%%%EOF\n", xref)
+	return b.Bytes()
+}
+
+func TestReaderPages(t *testing.T) {
+	file := writeTestFile(t)
+	broken := bytes.Replace(file, []byte("startxref\n"), []byte("startxref\n9"), 1)
+
+	tests := []struct {
+		name      string
+		data      []byte
+		wantBoxes []Object
+	}{
+		{
+			name: "cross reference table",
+			data: file,
+			wantBoxes: []Object{
+				Array{Integer(0), Integer(0), Integer(100), Integer(100)},
+				Array{Integer(0), Integer(0), Integer(595), Integer(842)},
+			},
+		},
+		{
+			name: "broken cross reference",
+			data: broken,
+			wantBoxes: []Object{
+				Array{Integer(0), Integer(0), Integer(100), Integer(100)},
+				Array{Integer(0), Integer(0), Integer(595), Integer(842)},
+			},
+		},
+		{
+			name:      "cross reference and object streams",
+			data:      writeCompressedFile(t),
+			wantBoxes: []Object{Array{Integer(0), Integer(0), Integer(200), Integer(300)}},
+		},
+	}
+
+	for _, tc := range tests {
+		r, err := NewReader(tc.data)
+		if err != nil {
+			t.Fatalf("%s: unexpected error: %v", tc.name, err)
+		}
+		pages, err := r.Pages()
+		if err != nil {
+			t.Fatalf("%s: unexpected error: %v", tc.name, err)
+		}
+		if len(pages) != len(tc.wantBoxes) {
+			t.Fatalf("%s: expected: %v, got: %v", tc.name, len(tc.wantBoxes), len(pages))
+		}
+		for i, p := range pages {
+			if !reflect.DeepEqual(p.Dict["MediaBox"], tc.wantBoxes[i]) {
+				t.Fatalf("%s: expected: %v, got: %v", tc.name, tc.wantBoxes[i], p.Dict["MediaBox"])
+			}
+		}
+	}
+}
+
+func TestReaderDecodeStream(t *testing.T) {
+	r, err := NewReader(writeTestFile(t))
+	if err != nil {
+		t.Fatal(err)
+	}
+	pages, err := r.Pages()
+	if err != nil {
+		t.Fatal(err)
+	}
+	o, err := r.Resolve(pages[0].Dict["Contents"])
+	if err != nil {
+		t.Fatal(err)
+	}
+	s, ok := o.(Stream)
+	if !ok {
+		t.Fatalf("expected: %v, got: %T", "stream", o)
+	}
+	got, err := DecodeStream(s)
+	if err != nil || string(got) != "0 0 m 10 10 l S" {
+		t.Fatalf("expected: %v, got: %q %v", "content", got, err)
+	}
+}
+
+func TestReaderEncrypted(t *testing.T) {
+	w := NewWriter()
+	catalog := w.Add(Dict{"Type": Name("Catalog")})
+	enc := w.Add(Dict{"Filter": Name("Standard")})
+	b, err := w.Bytes("1.4", Dict{"Root": catalog, "Encrypt": enc})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := NewReader(b); !errors.Is(err, ErrEncrypted) {
+		t.Fatalf("expected: %v, got: %v", ErrEncrypted, err)
+	}
+}
+
+func TestCopier(t *testing.T) {
+	r, err := NewReader(writeTestFile(t))
+	if err != nil {
+		t.Fatal(err)
+	}
+	pages, err := r.Pages()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	w := NewWriter()
+	c := NewCopier(r, w)
+	page := w.Reserve()
+	c.Map(pages[0].Ref, page)
+	d := Dict{"Contents": pages[0].Dict["Contents"], "Self": pages[0].Ref}
+	got, err := c.Copy(d)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	want := Dict{"Contents": Ref{Number: 2}, "Self": page}
+	if !reflect.DeepEqual(got, want) || w.Len() != 2 {
+		t.Fatalf("expected: %v with %v objects, got: %v with %v objects", Format(want), 2, Format(got), w.Len())
+	}
+}
@@ -0,0 +1,139 @@
+package pdf
+
+import (
+	"bufio"
+	"bytes"
+	"compress/zlib"
+	"errors"
+	"fmt"
+	"io"
+)
+
+var ErrUnsetObject = errors.New("reserved object was never set")
+
+// Writer collects indirect objects and writes them as a PDF file with a
+// cross reference table.
+type Writer struct {
+	objects []Object
+}
+
+func NewWriter() *Writer {
+	return &Writer{}
+}
+
+// Add stores o as a new indirect object.
+func (w *Writer) Add(o Object) Ref {
+	w.objects = append(w.objects, o)
+	return Ref{Number: len(w.objects)}
+}
+
+// Reserve allocates a reference before its object is known, e.g. for the
+// parent of pages that must refer back to it. It must be Set before writing.
+func (w *Writer) Reserve() Ref {
+	return w.Add(nil)
+}
+
+func (w *Writer) Set(r Ref, o Object) {
+	w.objects[r.Number-1] = o
+}
+
+// Get returns the object stored for r.
+func (w *Writer) Get(r Ref) Object {
+	if r.Number < 1 || r.Number > len(w.objects) {
+		return nil
+	}
+	return w.objects[r.Number-1]
+}
+
+// Len returns the number of objects.
+func (w *Writer) Len() int {
+	return len(w.objects)
+}
+
+// WriteTo writes the file, trailer must contain the Root and may contain Info
+// and ID. Size is set by the writer.
+func (w *Writer) WriteTo(out io.Writer, version string, trailer Dict) (int64, error) {
+	bw := bufio.NewWriter(out)
+	cw := &countWriter{w: bw}
+
+	// the binary comment marks the file as binary for transfer tools
+	fmt.Fprintf(cw, "%%PDF-%s\n%%\xe2\xe3\xcf\xd3\n", version)
+
+	offsets := make([]int64, len(w.objects))
+	for i, o := range w.objects {
+		if o == nil {
+			return cw.n, ErrUnsetObject
+		}
+		offsets[i] = cw.n
+		fmt.Fprintf(cw, "%d 0 obj\n", i+1)
+		if err := o.writePDF(cw); err != nil {
+			return cw.n, err
+		}
+		io.WriteString(cw, "\nendobj\n")
+	}
+
+	xref := cw.n
+	fmt.Fprintf(cw, "xref\n0 %d\n0000000000 65535 f \n", len(w.objects)+1)
+	for _, off := range offsets {
+		fmt.Fprintf(cw, "%010d 00000 n \n", off)
+	}
+
+	t := Dict{}
+	for k, v := range trailer {
+		t[k] = v
+	}
+	t["Size"] = Integer(len(w.objects) + 1)
+	io.WriteString(cw, "trailer\n")
+	if err := t.writePDF(cw); err != nil {
+		return cw.n, err
+	}
+	fmt.Fprintf(cw, "\nstartxref\n%d\n%%%%EOF\n", xref)
+
+	if cw.err != nil {
+		return cw.n, cw.err
+	}
+	return cw.n, bw.Flush()
+}
+
+// Bytes writes the file into memory.
+func (w *Writer) Bytes(version string, trailer Dict) ([]byte, error) {
+	var b bytes.Buffer
+	_, err := w.WriteTo(&b, version, trailer)
+	if err != nil {
+		return nil, err
+	}
+	return b.Bytes(), nil
+}
+
+// Deflate returns a FlateDecode stream of data.
+func Deflate(d Dict, data []byte) (Stream, error) {
+	var b bytes.Buffer
+	zw := zlib.NewWriter(&b)
+	if _, err := zw.Write(data); err != nil {
+		return Stream{}, err
+	}
+	if err := zw.Close(); err != nil {
+		return Stream{}, err
+	}
+	if d == nil {
+		d = Dict{}
+	}
+	d["Filter"] = Name("FlateDecode")
+	return Stream{Dict: d, Data: b.Bytes()}, nil
+}
+
+type countWriter struct {
+	w   io.Writer
+	n   int64
+	err error
+}
+
+func (c *countWriter) Write(p []byte) (int, error) {
+	if c.err != nil {
+		return 0, c.err
+	}
+	n, err := c.w.Write(p)
+	c.n += int64(n)
+	c.err = err
+	return n, err
+}
@@ -0,0 +1,180 @@
+package pdfops
+
+import (
+	"crypto/md5"
+	"errors"
+	"github.com/rengas/pdfgen/pkg/pdf"
+	"mime"
+	"sort"
+	"strings"
+	"time"
+)
+
+// Relationships of an attachment to the document, as PDF/A-3 requires them.
+const (
+	RelationshipSource      = "Source"
+	RelationshipData        = "Data"
+	RelationshipAlternative = "Alternative"
+	RelationshipSupplement  = "Supplement"
+	RelationshipUnspecified = "Unspecified"
+)
+
+var (
+	ErrAttachmentName         = errors.New("attachment needs a name")
+	ErrAttachmentEmpty        = errors.New("attachment is empty")
+	ErrAttachmentMediaType    = errors.New("attachment media type must be like text/xml")
+	ErrAttachmentRelationship = errors.New("attachment relationship must be one of Source, Data, Alternative, Supplement or Unspecified")
+)
+
+// Attachment is a file embedded in the document.
+type Attachment struct {
+	Name        string `json:"name" example:"timesheet.csv"`
+	Description string `json:"description,omitempty"`
+	// MediaType of the file, application/octet-stream when empty.
+	MediaType string `json:"mediaType,omitempty" example:"text/csv"`
+	// Relationship of the file to the document, Unspecified when empty.
+	Relationship string `json:"relationship,omitempty" example:"Supplement"`
+	// Data is base64 encoded in JSON.
+	Data []byte `json:"data"`
+}
+
+func (a Attachment) Validate() error {
+	if a.Name == "" {
+		return ErrAttachmentName
+	}
+	if len(a.Data) == 0 {
+		return ErrAttachmentEmpty
+	}
+	if a.MediaType != "" {
+		if t, _, err := mime.ParseMediaType(a.MediaType); err != nil || !strings.Contains(t, "/") {
+			return ErrAttachmentMediaType
+		}
+	}
+	switch a.Relationship {
+	case "", RelationshipSource, RelationshipData, RelationshipAlternative, RelationshipSupplement, RelationshipUnspecified:
+	default:
+		return ErrAttachmentRelationship
+	}
+	return nil
+}
+
+// Attach embeds the files in the PDF b. They are listed in the embedded
+// files of the document and as associated files of the catalog, files with
+// the name of an embedded file replace it.
+func Attach(b []byte, at time.Time, files ...Attachment) ([]byte, error) {
+	for _, f := range files {
+		if err := f.Validate(); err != nil {
+			return nil, err
+		}
+	}
+	doc, err := open(b)
+	if err != nil {
+		return nil, err
+	}
+	if err := doc.attach(at, files...); err != nil {
+		return nil, err
+	}
+	return doc.bytes()
+}
+
+func (d *document) attach(at time.Time, files ...Attachment) error {
+	root, ok := d.resolve(d.root).(pdf.Dict)
+	if !ok {
+		return pdf.ErrMalformed
+	}
+	names := d.dict(root["Names"])
+	entries := map[string]pdf.Object{}
+	d.nameTree(names["EmbeddedFiles"], entries, 0)
+	af, _ := d.resolve(root["AF"]).(pdf.Array)
+	af = append(pdf.Array{}, af...)
+
+	for _, f := range files {
+		mediaType, relationship := f.MediaType, f.Relationship
+		if mediaType == "" {
+			mediaType = "application/octet-stream"
+		}
+		if relationship == "" {
+			relationship = RelationshipUnspecified
+		}
+		sum := md5.Sum(f.Data)
+		stream, err := pdf.Deflate(pdf.Dict{
+			"Type":    pdf.Name("EmbeddedFile"),
+			"Subtype": pdf.Name(mediaType),
+			"Params": pdf.Dict{
+				"Size":     pdf.Integer(len(f.Data)),
+				"ModDate":  pdf.Date(at),
+				"CheckSum": pdf.HexString(sum[:]),
+			},
+		}, f.Data)
+		if err != nil {
+			return err
+		}
+		file := d.w.Add(stream)
+		spec := pdf.Dict{
+			"Type":           pdf.Name("Filespec"),
+			"F":              pdf.Text(f.Name),
+			"UF":             pdf.Text(f.Name),
+			"EF":             pdf.Dict{"F": file, "UF": file},
+			"AFRelationship": pdf.Name(relationship),
+		}
+		if f.Description != "" {
+			spec["Desc"] = pdf.Text(f.Description)
+		}
+		ref := d.w.Add(spec)
+		if old, ok := entries[f.Name]; ok {
+			af = without(af, old)
+		}
+		entries[f.Name] = ref
+		af = append(af, ref)
+	}
+
+	keys := make([]string, 0, len(entries))
+	for k := range entries {
+		keys = append(keys, k)
+	}
+	// name trees are sorted by name
+	sort.Strings(keys)
+	var tree pdf.Array
+	for _, k := range keys {
+		tree = append(tree, pdf.Text(k), entries[k])
+	}
+	names["EmbeddedFiles"] = pdf.Dict{"Names": tree}
+	root["Names"] = names
+	root["AF"] = af
+	if d.version < "1.7" {
+		d.version = "1.7"
+	}
+	return nil
+}
+
+// nameTree collects the entries of a name tree, depth bounds trees
+// that refer to themselves.
+func (d *document) nameTree(o pdf.Object, entries map[string]pdf.Object, depth int) {
+	node, ok := d.resolve(o).(pdf.Dict)
+	if !ok || depth > 32 {
+		return
+	}
+	names, _ := d.resolve(node["Names"]).(pdf.Array)
+	for i := 0; i+1 < len(names); i += 2 {
+		entries[pdf.DecodeText(d.resolve(names[i]))] = names[i+1]
+	}
+	kids, _ := d.resolve(node["Kids"]).(pdf.Array)
+	for _, kid := range kids {
+		d.nameTree(kid, entries, depth+1)
+	}
+}
+
+// without returns a without the reference o.
+func without(a pdf.Array, o pdf.Object) pdf.Array {
+	ref, ok := o.(pdf.Ref)
+	if !ok {
+		return a
+	}
+	out := a[:0]
+	for _, v := range a {
+		if v != pdf.Object(ref) {
+			out = append(out, v)
+		}
+	}
+	return out
+}
@@ -0,0 +1,136 @@
+package pdfops
+
+import (
+	"bytes"
+	"github.com/rengas/pdfgen/pkg/pdf"
+	"testing"
+	"time"
+)
+
+// attachments returns the embedded files of b by name and the associated
+// files of the catalog.
+func attachments(t *testing.T, b []byte) (map[string]pdf.Dict, pdf.Array) {
+	r, err := pdf.NewReader(b)
+	if err != nil {
+		t.Fatal(err)
+	}
+	root, err := r.Catalog()
+	if err != nil {
+		t.Fatal(err)
+	}
+	names, err := r.Dict(root["Names"])
+	if err != nil {
+		t.Fatal(err)
+	}
+	files, err := r.Dict(names["EmbeddedFiles"])
+	if err != nil {
+		t.Fatal(err)
+	}
+	tree, _ := files["Names"].(pdf.Array)
+	out := map[string]pdf.Dict{}
+	for i := 0; i+1 < len(tree); i += 2 {
+		spec, err := r.Dict(tree[i+1])
+		if err != nil {
+			t.Fatal(err)
+		}
+		ef, err := r.Dict(spec["EF"])
+		if err != nil {
+			t.Fatal(err)
+		}
+		o, err := r.Resolve(ef["F"])
+		if err != nil {
+			t.Fatal(err)
+		}
+		data, err := pdf.DecodeStream(o.(pdf.Stream))
+		if err != nil {
+			t.Fatal(err)
+		}
+		spec["data"] = pdf.String(data)
+		out[pdf.DecodeText(tree[i])] = spec
+	}
+	af, _ := root["AF"].(pdf.Array)
+	return out, af
+}
+
+func TestAttach(t *testing.T) {
+	doc := render(t, "<p>invoice</p>")
+	at := time.Date(2024, 1, 31, 12, 0, 0, 0, time.UTC)
+
+	b, err := Attach(doc, at,
+		Attachment{Name: "timesheet.csv", MediaType: "text/csv", Data: []byte("day,hours\n")},
+		Attachment{Name: "terms.txt", Relationship: RelationshipSupplement, Description: "Terms", Data: []byte("old")},
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+	b, err = Attach(b, at, Attachment{Name: "terms.txt", Relationship: RelationshipSupplement, Data: []byte("new")})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	files, af := attachments(t, b)
+	if len(files) != 2 || len(af) != 2 {
+		t.Fatalf("expected: %v, got: %v files and %v associated", 2, len(files), len(af))
+	}
+	tests := []struct {
+		name         string
+		data         string
+		relationship pdf.Name
+	}{
+		{name: "timesheet.csv", data: "day,hours\n", relationship: "Unspecified"},
+		{name: "terms.txt", data: "new", relationship: "Supplement"},
+	}
+	for _, tc := range tests {
+		spec, ok := files[tc.name]
+		if !ok {
+			t.Fatalf("%s: expected: %v, got: %v", tc.name, "embedded file", files)
+		}
+		if string(spec["data"].(pdf.String)) != tc.data || spec["AFRelationship"] != tc.relationship {
+			t.Fatalf("%s: expected: %v %v, got: %v", tc.name, tc.data, tc.relationship, pdf.Format(spec))
+		}
+	}
+
+	for _, a := range []Attachment{{Data: []byte("x")}, {Name: "a"}, {Name: "a", Data: []byte("x"), MediaType: "text"}, {Name: "a", Data: []byte("x"), Relationship: "Owner"}} {
+		if _, err := Attach(doc, at, a); err == nil {
+			t.Fatalf("expected: %v, got: %v", "error", err)
+		}
+	}
+}
+
+func TestFacturX(t *testing.T) {
+	invoice := []byte(`<?xml version="1.0" encoding="UTF-8"?><rsm:CrossIndustryInvoice/>`)
+	b, err := FacturX(handmade(t, "BT /F1 12 Tf (Invoice) Tj ET", nil, nil), invoice, "EN 16931", time.Now())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if v := CheckPDFA(b, PDFA3B); len(v) != 0 {
+		t.Fatalf("expected: %v, got: %v", "no violations", v)
+	}
+	files, af := attachments(t, b)
+	spec, ok := files["factur-x.xml"]
+	if !ok || len(af) != 1 || spec["AFRelationship"] != pdf.Name("Alternative") || string(spec["data"].(pdf.String)) != string(invoice) {
+		t.Fatalf("expected: %v, got: %v", "factur-x.xml as alternative", files)
+	}
+
+	r, err := pdf.NewReader(b)
+	if err != nil {
+		t.Fatal(err)
+	}
+	root, err := r.Catalog()
+	if err != nil {
+		t.Fatal(err)
+	}
+	o, err := r.Resolve(root["Metadata"])
+	if err != nil {
+		t.Fatal(err)
+	}
+	meta := o.(pdf.Stream).Data
+	for _, want := range []string{"<pdfaid:part>3</pdfaid:part>", "<fx:ConformanceLevel>EN 16931</fx:ConformanceLevel>", "<pdfaSchema:prefix>fx</pdfaSchema:prefix>"} {
+		if !bytes.Contains(meta, []byte(want)) {
+			t.Fatalf("expected: %v, got: %s", want, meta)
+		}
+	}
+	if err := xmlWellFormed(meta); err != nil {
+		t.Fatalf("expected: %v, got: %v", "well formed metadata", err)
+	}
+}
@@ -0,0 +1,138 @@
+package pdfops
+
+import "bytes"
+
+// scanContent calls fn for every operator of a content stream with its
+// operands as written, e.g. "/DeviceRGB" or "0.5". Strings, arrays and
+// dictionaries are single operands, inline images are skipped.
+func scanContent(data []byte, fn func(op string, operands []string)) {
+	var operands []string
+	i, n := 0, len(data)
+	for i < n {
+		c := data[i]
+		switch {
+		case isSpace(c):
+			i++
+		case c == '%':
+			for i < n && data[i] != '\n' && data[i] != '\r' {
+				i++
+			}
+		case c == '(':
+			start := i
+			i = skipString(data, i)
+			operands = append(operands, string(data[start:i]))
+		case c == '<' || c == '[':
+			start := i
+			i = skipNested(data, i)
+			operands = append(operands, string(data[start:i]))
+		case c == '/':
+			start := i
+			i++
+			for i < n && !isSpace(data[i]) && !isDelimiter(data[i]) {
+				i++
+			}
+			operands = append(operands, string(data[start:i]))
+		default:
+			start := i
+			for i < n && !isSpace(data[i]) && !isDelimiter(data[i]) {
+				i++
+			}
+			if i == start {
+				// a stray delimiter like ) or ]
+				i++
+				continue
+			}
+			tok := string(data[start:i])
+			if isOperand(tok) {
+				operands = append(operands, tok)
+				continue
+			}
+			if tok == "BI" {
+				i = skipInlineImage(data, i)
+				operands = operands[:0]
+				continue
+			}
+			fn(tok, operands)
+			operands = operands[:0]
+		}
+	}
+}
+
+func isSpace(c byte) bool {
+	return c == ' ' || c == '\n' || c == '\r' || c == '\t' || c == '\f' || c == 0
+}
+
+func isDelimiter(c byte) bool {
+	return bytes.IndexByte([]byte("()<>[]{}/%"), c) >= 0
+}
+
+func isOperand(tok string) bool {
+	if tok == "true" || tok == "false" || tok == "null" {
+		return true
+	}
+	c := tok[0]
+	return c == '+' || c == '-' || c == '.' || (c >= '0' && c <= '9')
+}
+
+// skipString returns the index after the literal string starting at i.
+func skipString(data []byte, i int) int {
+	depth := 0
+	for ; i < len(data); i++ {
+		switch data[i] {
+		case '\\':
+			i++
+		case '(':
+			depth++
+		case ')':
+			depth--
+			if depth == 0 {
+				return i + 1
+			}
+		}
+	}
+	return i
+}
+
+// skipNested returns the index after the array, dictionary or hex string
+// starting at i.
+func skipNested(data []byte, i int) int {
+	depth := 0
+	for i < len(data) {
+		switch data[i] {
+		case '(':
+			i = skipString(data, i)
+			continue
+		case '<', '[':
+			depth++
+		case '>', ']':
+			depth--
+			if depth == 0 {
+				return i + 1
+			}
+		}
+		i++
+	}
+	return i
+}
+
+// skipInlineImage returns the index after the EI of an inline image whose
+// BI ends at i.
+func skipInlineImage(data []byte, i int) int {
+	id := bytes.Index(data[i:], []byte("ID"))
+	if id < 0 {
+		return len(data)
+	}
+	i += id + 3
+	for i < len(data) {
+		ei := bytes.Index(data[i:], []byte("EI"))
+		if ei < 0 {
+			return len(data)
+		}
+		i += ei
+		if isSpace(data[i-1]) && (i+2 == len(data) || isSpace(data[i+2])) {
+			return i + 2
+		}
+		i += 2
+	}
+	return i
+}
@@ -0,0 +1,149 @@
+package pdfops
+
+import "github.com/rengas/pdfgen/pkg/pdf"
+
+// document is a PDF opened for changes, its objects are copied into a writer
+// so they can be changed and written again.
+type document struct {
+	w       *pdf.Writer
+	version string
+	root    pdf.Object
+	info    pdf.Object
+	// id is the file identifier, encryption keys depend on its first part
+	id         [2]pdf.HexString
+	encryption pdf.Object
+	// pages are the page objects in the writer, they hold their inherited
+	// attributes so every page can be changed on its own
+	pages []pdf.Ref
+}
+
+func open(b []byte) (*document, error) {
+	r, err := pdf.NewReader(b)
+	if err != nil {
+		return nil, err
+	}
+	pages, err := r.Pages()
+	if err != nil {
+		return nil, err
+	}
+
+	w := pdf.NewWriter()
+	c := pdf.NewCopier(r, w)
+	// transparency of watermarks needs 1.4
+	doc := &document{w: w, version: r.Version()}
+	if doc.version < "1.4" {
+		doc.version = "1.4"
+	}
+	if doc.root, err = c.Copy(r.Trailer()["Root"]); err != nil {
+		return nil, err
+	}
+	if info, ok := r.Trailer()["Info"]; ok {
+		if doc.info, err = c.Copy(info); err != nil {
+			return nil, err
+		}
+	}
+
+	if doc.id, err = fileID(r.Trailer()["ID"]); err != nil {
+		return nil, err
+	}
+
+	for _, p := range pages {
+		o, err := c.Copy(p.Ref)
+		if err != nil {
+			return nil, err
+		}
+		ref := o.(pdf.Ref)
+		d, ok := w.Get(ref).(pdf.Dict)
+		if !ok {
+			continue
+		}
+		for k, v := range p.Dict {
+			if _, ok := d[k]; ok || k == "Parent" {
+				continue
+			}
+			if d[k], err = c.Copy(v); err != nil {
+				return nil, err
+			}
+		}
+		doc.pages = append(doc.pages, ref)
+	}
+	return doc, nil
+}
+
+// resolve returns the object a reference of the writer points to.
+func (d *document) resolve(o pdf.Object) pdf.Object {
+	for i := 0; i < 8; i++ {
+		ref, ok := o.(pdf.Ref)
+		if !ok {
+			return o
+		}
+		o = d.w.Get(ref)
+	}
+	return nil
+}
+
+// dict returns a copy of the dictionary o resolves to, changes to it do not
+// affect objects shared with other pages.
+func (d *document) dict(o pdf.Object) pdf.Dict {
+	src, _ := d.resolve(o).(pdf.Dict)
+	out := pdf.Dict{}
+	for k, v := range src {
+		out[k] = v
+	}
+	return out
+}
+
+// box returns the visible area of a page as x0, y0, x1, y1.
+func (d *document) box(page pdf.Dict) [4]float64 {
+	box, ok := d.rect(page["CropBox"])
+	if !ok {
+		box, ok = d.rect(page["MediaBox"])
+	}
+	if !ok {
+		// a missing box is a Letter page
+		return [4]float64{0, 0, 612, 792}
+	}
+	return box
+}
+
+func (d *document) bytes() ([]byte, error) {
+	trailer := pdf.Dict{"Root": d.root}
+	if d.info != nil {
+		trailer["Info"] = d.info
+	}
+	if d.encryption != nil {
+		trailer["Encrypt"] = d.encryption
+	}
+	trailer["ID"] = pdf.Array{d.id[0], d.id[1]}
+	return d.w.Bytes(d.version, trailer)
+}
+
+// fileID keeps the identifier of a file, files without one get a random
+// identifier.
+func fileID(o pdf.Object) ([2]pdf.HexString, error) {
+	if a, ok := o.(pdf.Array); ok && len(a) == 2 {
+		var id [2]pdf.HexString
+		for i, v := range a {
+			switch s := v.(type) {
+			case pdf.String:
+				id[i] = pdf.HexString(s)
+			case pdf.HexString:
+				id[i] = s
+			}
+		}
+		if len(id[0]) > 0 {
+			return id, nil
+		}
+	}
+	b, err := randomBytes(16)
+	if err != nil {
+		return [2]pdf.HexString{}, err
+	}
+	return [2]pdf.HexString{b, b}, nil
+}
+
+// rotation returns the rotation of a page in degrees, 0, 90, 180 or 270.
+func (d *document) rotation(page pdf.Dict) int {
+	r, _ := d.resolve(page["Rotate"]).(pdf.Integer)
+	return ((int(r) % 360) + 360) % 360 / 90 * 90
+}
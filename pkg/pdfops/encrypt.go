@@ -0,0 +1,385 @@
+package pdfops
+
+import (
+	"bytes"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/md5"
+	"crypto/rand"
+	"crypto/rc4"
+	"crypto/sha256"
+	"crypto/sha512"
+	"encoding/binary"
+	"errors"
+	"github.com/rengas/pdfgen/pkg/pdf"
+	"hash"
+)
+
+// Encryption algorithms.
+const (
+	AES128 = "aes-128"
+	AES256 = "aes-256"
+)
+
+var ErrEncryptionAlgorithm = errors.New("encryption algorithm must be aes-128 or aes-256")
+
+// Encryption protects a PDF with the standard security handler. Readers ask
+// for the user password to open the file, the owner password lifts the
+// permissions. Without owner password a random one is used so the
+// permissions can not be lifted.
+type Encryption struct {
+	UserPassword  string `json:"userPassword,omitempty"`
+	OwnerPassword string `json:"ownerPassword,omitempty"`
+	// Algorithm is aes-128 or aes-256, aes-256 when empty.
+	Algorithm string `json:"algorithm,omitempty" example:"aes-256"`
+	// Permissions for users without the owner password, all are denied by
+	// default.
+	AllowPrint  bool `json:"allowPrint,omitempty"`
+	AllowCopy   bool `json:"allowCopy,omitempty"`
+	AllowModify bool `json:"allowModify,omitempty"`
+}
+
+func (e Encryption) Validate() error {
+	switch e.Algorithm {
+	case "", AES128, AES256:
+		return nil
+	}
+	return ErrEncryptionAlgorithm
+}
+
+// permissions returns the P value, bits 7, 8 and 13 to 32 must be set.
+func (e Encryption) permissions() int32 {
+	p := uint32(0xfffff0c0)
+	if e.AllowPrint {
+		p |= 1<<2 | 1<<11
+	}
+	if e.AllowModify {
+		p |= 1<<3 | 1<<5 | 1<<8 | 1<<10
+	}
+	if e.AllowCopy {
+		p |= 1 << 4
+	}
+	// extraction for accessibility is always allowed
+	p |= 1 << 9
+	return int32(p)
+}
+
+// Encrypt encrypts the strings and streams of the PDF b with AES.
+func Encrypt(b []byte, e Encryption) ([]byte, error) {
+	if err := e.Validate(); err != nil {
+		return nil, err
+	}
+	doc, err := open(b)
+	if err != nil {
+		return nil, err
+	}
+	if err := doc.encrypt(e); err != nil {
+		return nil, err
+	}
+	return doc.bytes()
+}
+
+// passwordPadding pads passwords of the RC4 based key derivation.
+var passwordPadding = []byte{
+	0x28, 0xbf, 0x4e, 0x5e, 0x4e, 0x75, 0x8a, 0x41, 0x64, 0x00, 0x4e, 0x56, 0xff, 0xfa, 0x01, 0x08,
+	0x2e, 0x2e, 0x00, 0xb6, 0xd0, 0x68, 0x3e, 0x80, 0x2f, 0x0c, 0xa9, 0xfe, 0x64, 0x53, 0x69, 0x7a,
+}
+
+func (d *document) encrypt(e Encryption) error {
+	owner := e.OwnerPassword
+	if owner == "" {
+		random, err := randomBytes(32)
+		if err != nil {
+			return err
+		}
+		owner = string(random)
+	}
+
+	var dict pdf.Dict
+	var objectKey func(ref pdf.Ref) []byte
+	if e.Algorithm == AES128 {
+		key, o, u, err := standardKeys(e.UserPassword, owner, e.permissions(), d.id[0])
+		if err != nil {
+			return err
+		}
+		dict = pdf.Dict{
+			"V": pdf.Integer(4), "R": pdf.Integer(4), "Length": pdf.Integer(128),
+			"CF": pdf.Dict{"StdCF": pdf.Dict{"CFM": pdf.Name("AESV2"), "AuthEvent": pdf.Name("DocOpen"), "Length": pdf.Integer(16)}},
+			"O":  pdf.HexString(o), "U": pdf.HexString(u),
+		}
+		objectKey = func(ref pdf.Ref) []byte { return aesV2Key(key, ref) }
+	} else {
+		key, values, err := aesV3Keys(e.UserPassword, owner, e.permissions())
+		if err != nil {
+			return err
+		}
+		dict = pdf.Dict{
+			"V": pdf.Integer(5), "R": pdf.Integer(6), "Length": pdf.Integer(256),
+			"CF": pdf.Dict{"StdCF": pdf.Dict{"CFM": pdf.Name("AESV3"), "AuthEvent": pdf.Name("DocOpen"), "Length": pdf.Integer(32)}},
+		}
+		for k, v := range values {
+			dict[k] = pdf.HexString(v)
+		}
+		objectKey = func(pdf.Ref) []byte { return key }
+
+		// revision 6 is part of PDF 2.0 and of the extension level 8 of 1.7
+		if d.version < "1.7" {
+			d.version = "1.7"
+		}
+		if catalog, ok := d.resolve(d.root).(pdf.Dict); ok && d.version < "2.0" {
+			catalog["Extensions"] = pdf.Dict{"ADBE": pdf.Dict{"BaseVersion": pdf.Name("1.7"), "ExtensionLevel": pdf.Integer(8)}}
+		}
+	}
+	dict["Filter"] = pdf.Name("Standard")
+	dict["StmF"] = pdf.Name("StdCF")
+	dict["StrF"] = pdf.Name("StdCF")
+	dict["P"] = pdf.Integer(e.permissions())
+
+	for n := 1; n <= d.w.Len(); n++ {
+		ref := pdf.Ref{Number: n}
+		o, err := encryptObject(d.w.Get(ref), objectKey(ref))
+		if err != nil {
+			return err
+		}
+		d.w.Set(ref, o)
+	}
+	d.encryption = d.w.Add(dict)
+	return nil
+}
+
+// encryptObject encrypts the strings and the stream data of o.
+func encryptObject(o pdf.Object, key []byte) (pdf.Object, error) {
+	switch v := o.(type) {
+	case pdf.String:
+		return encryptAES(key, []byte(v))
+	case pdf.HexString:
+		return encryptAES(key, v)
+	case pdf.Array:
+		a := make(pdf.Array, len(v))
+		for i, e := range v {
+			cp, err := encryptObject(e, key)
+			if err != nil {
+				return nil, err
+			}
+			a[i] = cp
+		}
+		return a, nil
+	case pdf.Dict:
+		d := make(pdf.Dict, len(v))
+		for k, e := range v {
+			cp, err := encryptObject(e, key)
+			if err != nil {
+				return nil, err
+			}
+			d[k] = cp
+		}
+		return d, nil
+	case pdf.Stream:
+		d, err := encryptObject(v.Dict, key)
+		if err != nil {
+			return nil, err
+		}
+		data, err := encryptAES(key, v.Data)
+		if err != nil {
+			return nil, err
+		}
+		return pdf.Stream{Dict: d.(pdf.Dict), Data: data}, nil
+	}
+	return o, nil
+}
+
+// encryptAES encrypts with a random IV in front and PKCS#5 padding.
+func encryptAES(key, data []byte) (pdf.HexString, error) {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	n := aes.BlockSize - len(data)%aes.BlockSize
+	padded := append(append([]byte(nil), data...), bytes.Repeat([]byte{byte(n)}, n)...)
+
+	out, err := randomBytes(aes.BlockSize)
+	if err != nil {
+		return nil, err
+	}
+	out = append(out, make([]byte, len(padded))...)
+	cipher.NewCBCEncrypter(block, out[:aes.BlockSize]).CryptBlocks(out[aes.BlockSize:], padded)
+	return out, nil
+}
+
+func randomBytes(n int) ([]byte, error) {
+	b := make([]byte, n)
+	_, err := rand.Read(b)
+	return b, err
+}
+
+func pad(password string) []byte {
+	b := []byte(password)
+	if len(b) > 32 {
+		b = b[:32]
+	}
+	return append(b, passwordPadding[:32-len(b)]...)
+}
+
+// rc4Rounds encrypts data with key and 19 more times with the key bytes
+// xored with the round.
+func rc4Rounds(key, data []byte) []byte {
+	out := append([]byte(nil), data...)
+	k := make([]byte, len(key))
+	for i := 0; i < 20; i++ {
+		for j := range key {
+			k[j] = key[j] ^ byte(i)
+		}
+		c, _ := rc4.NewCipher(k)
+		c.XORKeyStream(out, out)
+	}
+	return out
+}
+
+// standardKeys returns the file key and the O and U values of revision 4.
+func standardKeys(user, owner string, p int32, id []byte) (key, o, u []byte, err error) {
+	h := md5.Sum(pad(owner))
+	ownerKey := h[:]
+	for i := 0; i < 50; i++ {
+		h = md5.Sum(ownerKey)
+		ownerKey = h[:]
+	}
+	o = rc4Rounds(ownerKey, pad(user))
+
+	key = fileKey(user, o, p, id)
+	// the last 16 bytes of U are arbitrary
+	rest, err := randomBytes(16)
+	if err != nil {
+		return nil, nil, nil, err
+	}
+	return key, o, append(userCheck(key, id), rest...), nil
+}
+
+// fileKey derives the file key of revision 4 from the user password.
+func fileKey(user string, o []byte, p int32, id []byte) []byte {
+	m := md5.New()
+	m.Write(pad(user))
+	m.Write(o)
+	binary.Write(m, binary.LittleEndian, p)
+	m.Write(id)
+	key := m.Sum(nil)
+	for i := 0; i < 50; i++ {
+		h := md5.Sum(key)
+		key = h[:]
+	}
+	return key
+}
+
+// userCheck returns the first 16 bytes of U, readers compare them to check
+// the user password.
+func userCheck(key, id []byte) []byte {
+	m := md5.New()
+	m.Write(passwordPadding)
+	m.Write(id)
+	return rc4Rounds(key, m.Sum(nil))
+}
+
+// aesV2Key derives the key of an object for AESV2.
+func aesV2Key(key []byte, ref pdf.Ref) []byte {
+	m := md5.New()
+	m.Write(key)
+	m.Write([]byte{byte(ref.Number), byte(ref.Number >> 8), byte(ref.Number >> 16), byte(ref.Generation), byte(ref.Generation >> 8)})
+	m.Write([]byte("sAlT"))
+	return m.Sum(nil)
+}
+
+// aesV3Keys returns a random file key with the O, U, OE, UE and Perms values
+// of revision 6.
+func aesV3Keys(user, owner string, p int32) ([]byte, map[pdf.Name][]byte, error) {
+	random, err := randomBytes(32 + 4*8 + 4)
+	if err != nil {
+		return nil, nil, err
+	}
+	key := random[:32]
+	uSalt, ukSalt, oSalt, okSalt := random[32:40], random[40:48], random[48:56], random[56:64]
+
+	up, op := utf8Password(user), utf8Password(owner)
+	u := append(append(hash2B(up, uSalt, nil), uSalt...), ukSalt...)
+	o := append(append(hash2B(op, oSalt, u), oSalt...), okSalt...)
+	ue, err := encryptKey(hash2B(up, ukSalt, nil), key)
+	if err != nil {
+		return nil, nil, err
+	}
+	oe, err := encryptKey(hash2B(op, okSalt, u), key)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	perms := make([]byte, 16)
+	binary.LittleEndian.PutUint32(perms, uint32(p))
+	copy(perms[4:], []byte{0xff, 0xff, 0xff, 0xff, 'T', 'a', 'd', 'b'})
+	copy(perms[12:], random[64:])
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, nil, err
+	}
+	block.Encrypt(perms, perms)
+
+	return key, map[pdf.Name][]byte{"O": o, "U": u, "OE": oe, "UE": ue, "Perms": perms}, nil
+}
+
+// utf8Password truncates a password to the 127 bytes revision 6 uses.
+func utf8Password(s string) []byte {
+	b := []byte(s)
+	if len(b) > 127 {
+		b = b[:127]
+	}
+	return b
+}
+
+// encryptKey encrypts the file key with AES-256 without IV and padding.
+func encryptKey(k, key []byte) ([]byte, error) {
+	block, err := aes.NewCipher(k)
+	if err != nil {
+		return nil, err
+	}
+	out := make([]byte, len(key))
+	cipher.NewCBCEncrypter(block, make([]byte, aes.BlockSize)).CryptBlocks(out, key)
+	return out, nil
+}
+
+// hash2B is the password hash of revision 6, udata is the U value when
+// hashing the owner password.
+func hash2B(password, salt, udata []byte) []byte {
+	h := sha256.New()
+	h.Write(password)
+	h.Write(salt)
+	h.Write(udata)
+	k := h.Sum(nil)
+
+	for i := 0; ; i++ {
+		var k1 []byte
+		for j := 0; j < 64; j++ {
+			k1 = append(k1, password...)
+			k1 = append(k1, k...)
+			k1 = append(k1, udata...)
+		}
+		block, _ := aes.NewCipher(k[:16])
+		e := make([]byte, len(k1))
+		cipher.NewCBCEncrypter(block, k[16:32]).CryptBlocks(e, k1)
+
+		sum := 0
+		for _, c := range e[:16] {
+			sum += int(c)
+		}
+		var next hash.Hash
+		switch sum % 3 {
+		case 0:
+			next = sha256.New()
+		case 1:
+			next = sha512.New384()
+		default:
+			next = sha512.New()
+		}
+		next.Write(e)
+		k = next.Sum(nil)
+
+		if i >= 63 && int(e[len(e)-1]) <= i-31 {
+			return k[:32]
+		}
+	}
+}
@@ -0,0 +1,134 @@
+package pdfops
+
+import (
+	"bytes"
+	"crypto/aes"
+	"crypto/cipher"
+	"github.com/rengas/pdfgen/pkg/pdf"
+	"testing"
+)
+
+// openEncrypted reads an encrypted file by hiding its encryption from the
+// reader, strings and streams stay encrypted.
+func openEncrypted(t *testing.T, b []byte) (*pdf.Reader, pdf.Dict) {
+	r, err := pdf.NewReader(bytes.Replace(b, []byte("/Encrypt "), []byte("/Xncrypt "), 1))
+	if err != nil {
+		t.Fatal(err)
+	}
+	enc, err := r.Dict(r.Trailer()["Xncrypt"])
+	if err != nil {
+		t.Fatal(err)
+	}
+	return r, enc
+}
+
+func decryptAES(t *testing.T, key, data []byte) []byte {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(data) < 2*aes.BlockSize || len(data)%aes.BlockSize != 0 {
+		t.Fatalf("expected: %v, got: %v bytes", "iv and blocks", len(data))
+	}
+	out := make([]byte, len(data)-aes.BlockSize)
+	cipher.NewCBCDecrypter(block, data[:aes.BlockSize]).CryptBlocks(out, data[aes.BlockSize:])
+	return out[:len(out)-int(out[len(out)-1])]
+}
+
+func TestEncrypt(t *testing.T) {
+	doc := render(t, "<p>payslip</p>")
+	want := pageContent(t, doc)
+
+	tests := []struct {
+		name       string
+		enc        Encryption
+		wantV      pdf.Integer
+		wantPerms  int32
+		password   string
+		objectKeys bool
+	}{
+		{name: "aes-256", enc: Encryption{UserPassword: "1990-01-31", AllowPrint: true}, wantV: 5, wantPerms: -1340, password: "1990-01-31"},
+		{name: "aes-128", enc: Encryption{UserPassword: "1990-01-31", OwnerPassword: "owner", Algorithm: AES128, AllowCopy: true}, wantV: 4, wantPerms: -3376, password: "1990-01-31", objectKeys: true},
+	}
+
+	for _, tc := range tests {
+		b, err := Encrypt(doc, tc.enc)
+		if err != nil {
+			t.Fatalf("%s: unexpected error: %v", tc.name, err)
+		}
+		if bytes.Contains(b, []byte(tc.password)) {
+			t.Fatalf("%s: expected: %v, got: %v", tc.name, "no password in the file", "password")
+		}
+		r, enc := openEncrypted(t, b)
+		if enc["V"] != tc.wantV || enc["P"] != pdf.Integer(tc.wantPerms) {
+			t.Fatalf("%s: expected: V %v P %v, got: %v", tc.name, tc.wantV, tc.wantPerms, pdf.Format(enc))
+		}
+
+		u := []byte(enc["U"].(pdf.HexString))
+		var key []byte
+		if tc.wantV == 5 {
+			if !bytes.Equal(hash2B([]byte(tc.password), u[32:40], nil), u[:32]) {
+				t.Fatalf("%s: expected: %v, got: %v", tc.name, "user password accepted", "rejected")
+			}
+			if bytes.Equal(hash2B([]byte("wrong"), u[32:40], nil), u[:32]) {
+				t.Fatalf("%s: expected: %v, got: %v", tc.name, "wrong password rejected", "accepted")
+			}
+			block, _ := aes.NewCipher(hash2B([]byte(tc.password), u[40:48], nil))
+			ue := []byte(enc["UE"].(pdf.HexString))
+			key = make([]byte, 32)
+			cipher.NewCBCDecrypter(block, make([]byte, aes.BlockSize)).CryptBlocks(key, ue)
+
+			perms := []byte(enc["Perms"].(pdf.HexString))
+			block, _ = aes.NewCipher(key)
+			block.Decrypt(perms, perms)
+			if string(perms[9:12]) != "adb" {
+				t.Fatalf("%s: expected: %v, got: %q", tc.name, "adb", perms[9:12])
+			}
+		} else {
+			id := r.Trailer()["ID"].(pdf.Array)[0].(pdf.HexString)
+			key = fileKey(tc.password, enc["O"].(pdf.HexString), tc.wantPerms, id)
+			if !bytes.Equal(userCheck(key, id), u[:16]) {
+				t.Fatalf("%s: expected: %v, got: %v", tc.name, "user password accepted", "rejected")
+			}
+		}
+
+		pages, err := r.Pages()
+		if err != nil {
+			t.Fatal(err)
+		}
+		ref := pages[0].Dict["Contents"].(pdf.Ref)
+		o, err := r.Resolve(ref)
+		if err != nil {
+			t.Fatal(err)
+		}
+		s := o.(pdf.Stream)
+		if tc.objectKeys {
+			key = aesV2Key(key, ref)
+		}
+		s.Data = decryptAES(t, key, s.Data)
+		got, err := pdf.DecodeStream(s)
+		if err != nil || !bytes.Equal(got, want) {
+			t.Fatalf("%s: expected: %q, got: %q %v", tc.name, want, got, err)
+		}
+	}
+}
+
+func pageContent(t *testing.T, b []byte) []byte {
+	r, err := pdf.NewReader(b)
+	if err != nil {
+		t.Fatal(err)
+	}
+	pages, err := r.Pages()
+	if err != nil {
+		t.Fatal(err)
+	}
+	o, err := r.Resolve(pages[0].Dict["Contents"])
+	if err != nil {
+		t.Fatal(err)
+	}
+	data, err := pdf.DecodeStream(o.(pdf.Stream))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return data
+}
@@ -0,0 +1,60 @@
+package pdfops
+
+import (
+	"fmt"
+	"github.com/rengas/pdfgen/pkg/facturx"
+	"time"
+)
+
+// facturXNamespace is the XMP namespace of the Factur-X properties.
+const facturXNamespace = "urn:factur-x:pdfa:CrossIndustryDocument:invoice:1p0#"
+
+// FacturX embeds the Factur-X invoice XML in the PDF b and converts it to
+// PDF/A-3b, the hybrid invoice Factur-X and ZUGFeRD define. Profile is the
+// Factur-X profile of the invoice, e.g. facturx.ProfileEN16931.
+func FacturX(b, invoice []byte, profile string, at time.Time) ([]byte, error) {
+	// invoices of MINIMUM and BASIC WL are not complete, they are data of
+	// the PDF rather than an alternative to it
+	relationship := RelationshipAlternative
+	if profile == facturx.ProfileMinimum || profile == facturx.ProfileBasicWL {
+		relationship = RelationshipData
+	}
+	b, err := Attach(b, at, Attachment{
+		Name:         facturx.FileName,
+		Description:  "Factur-X invoice",
+		MediaType:    "text/xml",
+		Relationship: relationship,
+		Data:         invoice,
+	})
+	if err != nil {
+		return nil, err
+	}
+	return convertPDFA(b, PDFA3B, at, facturXMP(profile))
+}
+
+// facturXMP returns the XMP of the Factur-X properties and the extension
+// schema PDF/A needs to describe them.
+func facturXMP(profile string) []string {
+	property := func(name, description string) string {
+		return `<rdf:li rdf:parseType="Resource"><pdfaProperty:name>` + name + `</pdfaProperty:name>` +
+			`<pdfaProperty:valueType>Text</pdfaProperty:valueType><pdfaProperty:category>external</pdfaProperty:category>` +
+			`<pdfaProperty:description>` + description + `</pdfaProperty:description></rdf:li>`
+	}
+	schema := `<rdf:Description rdf:about="" xmlns:pdfaExtension="http://www.aiim.org/pdfa/ns/extension/" ` +
+		`xmlns:pdfaSchema="http://www.aiim.org/pdfa/ns/schema#" xmlns:pdfaProperty="http://www.aiim.org/pdfa/ns/property#">` +
+		`<pdfaExtension:schemas><rdf:Bag><rdf:li rdf:parseType="Resource">` +
+		`<pdfaSchema:schema>Factur-X PDFA Extension Schema</pdfaSchema:schema>` +
+		`<pdfaSchema:namespaceURI>` + facturXNamespace + `</pdfaSchema:namespaceURI>` +
+		`<pdfaSchema:prefix>fx</pdfaSchema:prefix>` +
+		`<pdfaSchema:property><rdf:Seq>` +
+		property("DocumentFileName", "name of the embedded XML invoice file") +
+		property("DocumentType", "INVOICE") +
+		property("Version", "The actual version of the Factur-X XML schema") +
+		property("ConformanceLevel", "The conformance level of the embedded Factur-X data") +
+		`</rdf:Seq></pdfaSchema:property></rdf:li></rdf:Bag></pdfaExtension:schemas></rdf:Description>`
+	values := fmt.Sprintf(`<rdf:Description rdf:about="" xmlns:fx="%s">`+
+		`<fx:DocumentType>INVOICE</fx:DocumentType><fx:DocumentFileName>%s</fx:DocumentFileName>`+
+		`<fx:Version>1.0</fx:Version><fx:ConformanceLevel>%s</fx:ConformanceLevel></rdf:Description>`,
+		facturXNamespace, facturx.FileName, escapeXML(profile))
+	return []string{schema, values}
+}
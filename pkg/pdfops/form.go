@@ -0,0 +1,639 @@
+package pdfops
+
+import (
+	"errors"
+	"fmt"
+	"github.com/rengas/pdfgen/pkg/pdf"
+	"math"
+	"strconv"
+	"strings"
+)
+
+var ErrNoForm = errors.New("pdf has no form fields")
+
+// Types of form fields.
+const (
+	FieldText     = "text"
+	FieldCheckbox = "checkbox"
+	FieldRadio    = "radio"
+	FieldChoice   = "choice"
+)
+
+// Flags of form fields.
+const (
+	fieldReadOnly   = 1
+	fieldRequired   = 1 << 1
+	fieldMultiline  = 1 << 12
+	fieldRadio      = 1 << 15
+	fieldPushButton = 1 << 16
+	fieldEdit       = 1 << 18
+)
+
+// FormField is a field of a form that can be filled.
+type FormField struct {
+	// Name is the full name of the field, the names of nested fields are
+	// joined by periods.
+	Name string `json:"name" example:"applicant.name"`
+	Type string `json:"type" example:"text"`
+	// Options are the values choices and radio groups accept and the
+	// checked value of checkboxes.
+	Options  []string `json:"options,omitempty"`
+	Value    string   `json:"value,omitempty"`
+	ReadOnly bool     `json:"readOnly,omitempty"`
+	Required bool     `json:"required,omitempty"`
+}
+
+// FormError is a value that does not fit its form field.
+type FormError struct {
+	Field  string
+	Reason string
+}
+
+func (e *FormError) Error() string {
+	return fmt.Sprintf("form field %s %s", e.Field, e.Reason)
+}
+
+// FormFields lists the text, checkbox, radio and choice fields of the form
+// of the PDF b, in the order of the form. Signature fields and push buttons
+// are not listed.
+func FormFields(b []byte) ([]FormField, error) {
+	doc, err := open(b)
+	if err != nil {
+		return nil, err
+	}
+	var out []FormField
+	for _, f := range doc.formFields() {
+		if ff, ok := doc.describe(f); ok {
+			out = append(out, ff)
+		}
+	}
+	if len(out) == 0 {
+		return nil, ErrNoForm
+	}
+	return out, nil
+}
+
+// FillForm sets the fields of the form of the PDF b to the values by the
+// full name of the fields and draws them in Helvetica. Checkboxes are
+// checked by true, yes, on, 1 or their checked value, radio groups and
+// choices take one of their options. Fields without value keep theirs,
+// values of no field are ignored and values that do not fit their field
+// are returned as *FormError.
+func FillForm(b []byte, values map[string]string) ([]byte, error) {
+	doc, err := open(b)
+	if err != nil {
+		return nil, err
+	}
+	fields := doc.formFields()
+	if len(fields) == 0 {
+		return nil, ErrNoForm
+	}
+	for _, f := range fields {
+		v, ok := values[f.name]
+		if !ok {
+			continue
+		}
+		if err := doc.fill(f, v); err != nil {
+			return nil, err
+		}
+	}
+
+	// viewers show the XFA of a form instead of its fields
+	root, _ := doc.resolve(doc.root).(pdf.Dict)
+	if form, ok := doc.resolve(root["AcroForm"]).(pdf.Dict); ok {
+		form = doc.dict(form)
+		delete(form, "XFA")
+		root["AcroForm"] = form
+	}
+	return doc.bytes()
+}
+
+// formField is a field of a form that holds a value, its widgets are the
+// boxes it is shown in.
+type formField struct {
+	name    string
+	dict    pdf.Dict
+	widgets []pdf.Dict
+}
+
+// formFields returns the fields of the form that hold values, fields
+// without name are part of their parent.
+func (d *document) formFields() []formField {
+	root, _ := d.resolve(d.root).(pdf.Dict)
+	form, _ := d.resolve(root["AcroForm"]).(pdf.Dict)
+	top, _ := d.resolve(form["Fields"]).(pdf.Array)
+
+	var out []formField
+	seen := map[pdf.Ref]bool{}
+	var walk func(o pdf.Object, parent string, depth int)
+	walk = func(o pdf.Object, parent string, depth int) {
+		if ref, ok := o.(pdf.Ref); ok {
+			if seen[ref] {
+				return
+			}
+			seen[ref] = true
+		}
+		f, ok := d.resolve(o).(pdf.Dict)
+		if !ok || depth > 32 {
+			return
+		}
+		name := parent
+		if t, ok := f["T"]; ok {
+			if name != "" {
+				name += "."
+			}
+			name += pdf.DecodeText(d.resolve(t))
+		}
+		kids, _ := d.resolve(f["Kids"]).(pdf.Array)
+		var widgets []pdf.Dict
+		var children []pdf.Object
+		for _, k := range kids {
+			kid, ok := d.resolve(k).(pdf.Dict)
+			if !ok {
+				continue
+			}
+			if _, ok := kid["T"]; ok {
+				children = append(children, k)
+			} else {
+				widgets = append(widgets, kid)
+			}
+		}
+		if len(children) > 0 {
+			for _, k := range children {
+				walk(k, name, depth+1)
+			}
+			return
+		}
+		if f["Subtype"] == pdf.Name("Widget") {
+			widgets = append(widgets, f)
+		}
+		out = append(out, formField{name: name, dict: f, widgets: widgets})
+	}
+	for _, o := range top {
+		walk(o, "", 0)
+	}
+	return out
+}
+
+// kind returns the type of a field, empty for signatures and push buttons.
+func (d *document) kind(f formField) string {
+	ft, _ := d.resolve(d.inherited(f.dict, "FT")).(pdf.Name)
+	ff, _ := d.resolve(d.inherited(f.dict, "Ff")).(pdf.Integer)
+	switch {
+	case ft == "Tx":
+		return FieldText
+	case ft == "Ch":
+		return FieldChoice
+	case ft == "Btn" && ff&fieldPushButton != 0:
+		return ""
+	case ft == "Btn" && ff&fieldRadio != 0:
+		return FieldRadio
+	case ft == "Btn":
+		return FieldCheckbox
+	}
+	return ""
+}
+
+func (d *document) describe(f formField) (FormField, bool) {
+	kind := d.kind(f)
+	if kind == "" {
+		return FormField{}, false
+	}
+	ff, _ := d.resolve(d.inherited(f.dict, "Ff")).(pdf.Integer)
+	out := FormField{
+		Name:     f.name,
+		Type:     kind,
+		ReadOnly: ff&fieldReadOnly != 0,
+		Required: ff&fieldRequired != 0,
+	}
+	switch kind {
+	case FieldChoice:
+		for _, o := range d.options(f) {
+			out.Options = append(out.Options, o[0])
+		}
+	case FieldRadio, FieldCheckbox:
+		out.Options = d.exports(f)
+	}
+	switch v := d.resolve(d.inherited(f.dict, "V")).(type) {
+	case pdf.Name:
+		if v != "Off" {
+			out.Value = d.export(f, string(v))
+		}
+	case pdf.Array:
+		values := make([]string, 0, len(v))
+		for _, o := range v {
+			values = append(values, pdf.DecodeText(d.resolve(o)))
+		}
+		out.Value = strings.Join(values, ",")
+	default:
+		out.Value = pdf.DecodeText(v)
+	}
+	return out, true
+}
+
+// options returns the export value and the text shown of the options of a
+// choice or of the buttons of a group.
+func (d *document) options(f formField) [][2]string {
+	opt, _ := d.resolve(d.inherited(f.dict, "Opt")).(pdf.Array)
+	out := make([][2]string, 0, len(opt))
+	for _, o := range opt {
+		switch o := d.resolve(o).(type) {
+		case pdf.Array:
+			if len(o) == 2 {
+				out = append(out, [2]string{pdf.DecodeText(d.resolve(o[0])), pdf.DecodeText(d.resolve(o[1]))})
+			}
+		default:
+			text := pdf.DecodeText(o)
+			out = append(out, [2]string{text, text})
+		}
+	}
+	return out
+}
+
+// state returns the appearance state of a checked button widget.
+func (d *document) state(widget pdf.Dict) string {
+	ap, _ := d.resolve(widget["AP"]).(pdf.Dict)
+	n, _ := d.resolve(ap["N"]).(pdf.Dict)
+	for k := range n {
+		if k != "Off" {
+			return string(k)
+		}
+	}
+	return ""
+}
+
+// exports returns the values of the buttons of a group, the states of their
+// widgets or the options of groups that have them.
+func (d *document) exports(f formField) []string {
+	opt := d.options(f)
+	var out []string
+	for i, w := range f.widgets {
+		v := d.state(w)
+		if i < len(opt) {
+			v = opt[i][0]
+		}
+		if v == "" {
+			continue
+		}
+		dup := false
+		for _, o := range out {
+			dup = dup || o == v
+		}
+		if !dup {
+			out = append(out, v)
+		}
+	}
+	return out
+}
+
+// export returns the value of the button state.
+func (d *document) export(f formField, state string) string {
+	opt := d.options(f)
+	for i, w := range f.widgets {
+		if d.state(w) == state && i < len(opt) {
+			return opt[i][0]
+		}
+	}
+	return state
+}
+
+// fill sets the value of a field and the appearance of its widgets.
+func (d *document) fill(f formField, v string) error {
+	switch d.kind(f) {
+	case FieldText:
+		if max, ok := d.resolve(d.inherited(f.dict, "MaxLen")).(pdf.Integer); ok && len([]rune(v)) > int(max) {
+			return &FormError{Field: f.name, Reason: fmt.Sprintf("is longer than %d characters", max)}
+		}
+		f.dict["V"] = pdf.Text(v)
+		return d.textAppearances(f, v)
+	case FieldChoice:
+		shown, found := v, v == ""
+		for _, o := range d.options(f) {
+			if o[0] == v {
+				shown, found = o[1], true
+			}
+		}
+		ff, _ := d.resolve(d.inherited(f.dict, "Ff")).(pdf.Integer)
+		if !found && ff&fieldEdit == 0 {
+			return &FormError{Field: f.name, Reason: "is not one of its options: " + v}
+		}
+		f.dict["V"] = pdf.Text(v)
+		delete(f.dict, "I")
+		return d.textAppearances(f, shown)
+	case FieldCheckbox:
+		on := false
+		switch strings.ToLower(v) {
+		case "true", "yes", "on", "1":
+			on = true
+		case "false", "no", "off", "0", "":
+		default:
+			exports := d.exports(f)
+			if len(exports) == 0 || exports[0] != v {
+				return &FormError{Field: f.name, Reason: "is not a checkbox value: " + v}
+			}
+			on = true
+		}
+		state := pdf.Name("Off")
+		for _, w := range f.widgets {
+			if on && d.state(w) != "" {
+				state = pdf.Name(d.state(w))
+				w["AS"] = state
+			} else {
+				w["AS"] = pdf.Name("Off")
+			}
+		}
+		f.dict["V"] = state
+	case FieldRadio:
+		state, found := pdf.Name("Off"), v == "" || v == "Off"
+		opt := d.options(f)
+		for i, w := range f.widgets {
+			s := d.state(w)
+			export := s
+			if i < len(opt) {
+				export = opt[i][0]
+			}
+			if !found && export == v && s != "" {
+				state, found = pdf.Name(s), true
+			}
+		}
+		if !found {
+			return &FormError{Field: f.name, Reason: "is not one of its options: " + v}
+		}
+		for _, w := range f.widgets {
+			w["AS"] = pdf.Name("Off")
+			if pdf.Name(d.state(w)) == state {
+				w["AS"] = state
+			}
+		}
+		f.dict["V"] = state
+	default:
+		return &FormError{Field: f.name, Reason: "can not be filled"}
+	}
+	return nil
+}
+
+// textAppearances draws the text in the widgets of a text field or choice.
+func (d *document) textAppearances(f formField, text string) error {
+	ff, _ := d.resolve(d.inherited(f.dict, "Ff")).(pdf.Integer)
+	for _, w := range f.widgets {
+		rect, ok := d.rect(w["Rect"])
+		if !ok {
+			continue
+		}
+		q, _ := d.resolve(d.inherited(w, "Q")).(pdf.Integer)
+		da := pdf.DecodeText(d.resolve(d.inherited(w, "DA")))
+		ap, err := d.textAppearance(text, fontSize(da), int(q), rect[2]-rect[0], rect[3]-rect[1], ff&fieldMultiline != 0)
+		if err != nil {
+			return err
+		}
+		w["AP"] = pdf.Dict{"N": ap}
+	}
+	return nil
+}
+
+// FlattenForm draws the fields of the form of the PDF b into its pages and
+// removes the form, the values can no longer be changed. Fields are drawn
+// with their appearance, text fields without one with their value in
+// Helvetica.
+func FlattenForm(b []byte) ([]byte, error) {
+	doc, err := open(b)
+	if err != nil {
+		return nil, err
+	}
+	root, ok := doc.resolve(doc.root).(pdf.Dict)
+	if !ok {
+		return nil, pdf.ErrMalformed
+	}
+	if _, ok := root["AcroForm"]; !ok {
+		return b, nil
+	}
+
+	var save pdf.Object
+	for _, ref := range doc.pages {
+		page := doc.w.Get(ref).(pdf.Dict)
+		annots, _ := doc.resolve(page["Annots"]).(pdf.Array)
+		res := doc.dict(page["Resources"])
+		xobjects := doc.dict(res["XObject"])
+
+		var keep pdf.Array
+		c := strings.Builder{}
+		flattened := false
+		for _, a := range annots {
+			annot, ok := doc.resolve(a).(pdf.Dict)
+			if !ok || annot["Subtype"] != pdf.Name("Widget") {
+				keep = append(keep, a)
+				continue
+			}
+			flattened = true
+			flags, _ := doc.resolve(annot["F"]).(pdf.Integer)
+			rect, ok := doc.rect(annot["Rect"])
+			if !ok || flags&(annotHidden|annotNoView) != 0 {
+				continue
+			}
+			ap, err := doc.widgetAppearance(annot, rect)
+			if err != nil {
+				return nil, err
+			}
+			if ap == nil {
+				continue
+			}
+			// the appearance is scaled from its box to the rectangle
+			bbox := [4]float64{0, 0, rect[2] - rect[0], rect[3] - rect[1]}
+			if s, ok := doc.resolve(ap).(pdf.Stream); ok {
+				if r, ok := doc.rect(s.Dict["BBox"]); ok && r[2] > r[0] && r[3] > r[1] {
+					bbox = r
+				}
+			}
+			sx, sy := (rect[2]-rect[0])/(bbox[2]-bbox[0]), (rect[3]-rect[1])/(bbox[3]-bbox[1])
+			name := uniqueName(xobjects, "Fm")
+			xobjects[name] = ap
+			num := pdf.FormatReal
+			fmt.Fprintf(&c, "q %s 0 0 %s %s %s cm /%s Do Q\n", num(sx), num(sy), num(rect[0]-bbox[0]*sx), num(rect[1]-bbox[1]*sy), name)
+		}
+		if !flattened {
+			continue
+		}
+		if len(keep) > 0 {
+			page["Annots"] = keep
+		} else {
+			delete(page, "Annots")
+		}
+		if c.Len() == 0 {
+			continue
+		}
+		res["XObject"] = xobjects
+		page["Resources"] = res
+
+		// the fields are drawn over the content in the initial graphics state
+		if save == nil {
+			save = doc.w.Add(pdf.Stream{Dict: pdf.Dict{}, Data: []byte("q\n")})
+		}
+		stream, err := pdf.Deflate(nil, []byte("Q\n"+c.String()))
+		if err != nil {
+			return nil, err
+		}
+		contents := pdf.Array{save}
+		switch v := doc.resolve(page["Contents"]).(type) {
+		case pdf.Array:
+			contents = append(contents, v...)
+		case pdf.Stream:
+			contents = append(contents, page["Contents"])
+		}
+		page["Contents"] = append(contents, doc.w.Add(stream))
+	}
+	delete(root, "AcroForm")
+	return doc.bytes()
+}
+
+// widgetAppearance returns the normal appearance of a widget in its current
+// state, text fields without one get an appearance of their value. It is
+// nil for widgets that draw nothing.
+func (d *document) widgetAppearance(annot pdf.Dict, rect [4]float64) (pdf.Object, error) {
+	if ap, ok := d.resolve(annot["AP"]).(pdf.Dict); ok {
+		n := ap["N"]
+		if states, ok := d.resolve(n).(pdf.Dict); ok {
+			state, _ := d.resolve(annot["AS"]).(pdf.Name)
+			n = states[state]
+		}
+		switch s := d.resolve(n).(type) {
+		case pdf.Stream:
+			if _, ok := n.(pdf.Ref); !ok {
+				return d.w.Add(s), nil
+			}
+			return n, nil
+		}
+		if _, ok := annot["AS"]; ok {
+			// buttons in a state without appearance are off
+			return nil, nil
+		}
+	}
+
+	ft, _ := d.resolve(d.inherited(annot, "FT")).(pdf.Name)
+	if ft != "Tx" && ft != "Ch" {
+		return nil, nil
+	}
+	var text string
+	switch v := d.resolve(d.inherited(annot, "V")).(type) {
+	case pdf.Array:
+		values := make([]string, 0, len(v))
+		for _, o := range v {
+			values = append(values, pdf.DecodeText(d.resolve(o)))
+		}
+		text = strings.Join(values, ", ")
+	default:
+		text = pdf.DecodeText(v)
+	}
+	if text == "" {
+		return nil, nil
+	}
+	ff, _ := d.resolve(d.inherited(annot, "Ff")).(pdf.Integer)
+	q, _ := d.resolve(d.inherited(annot, "Q")).(pdf.Integer)
+	da := pdf.DecodeText(d.resolve(d.inherited(annot, "DA")))
+	return d.textAppearance(text, fontSize(da), int(q), rect[2]-rect[0], rect[3]-rect[1], ff&fieldMultiline != 0)
+}
+
+// inherited returns the value of an attribute of a field, inheritable
+// attributes may be set on its ancestors or on the form.
+func (d *document) inherited(field pdf.Dict, key pdf.Name) pdf.Object {
+	for i := 0; i < 32 && field != nil; i++ {
+		if v, ok := field[key]; ok {
+			return v
+		}
+		field, _ = d.resolve(field["Parent"]).(pdf.Dict)
+	}
+	if key == "DA" || key == "Q" {
+		root, _ := d.resolve(d.root).(pdf.Dict)
+		form, _ := d.resolve(root["AcroForm"]).(pdf.Dict)
+		return form[key]
+	}
+	return nil
+}
+
+// fontSize returns the font size of a default appearance like
+// /Helv 10 Tf 0 g, 0 for text sized to fit.
+func fontSize(da string) float64 {
+	fields := strings.Fields(da)
+	for i := len(fields) - 1; i > 0; i-- {
+		if fields[i] == "Tf" {
+			size, _ := strconv.ParseFloat(fields[i-1], 64)
+			return math.Max(size, 0)
+		}
+	}
+	return 0
+}
+
+// textAppearance returns the appearance of the value of a text field in
+// Helvetica, left aligned, centered or right aligned by quadding q. Text of
+// size 0 fits the height of single lines.
+func (d *document) textAppearance(text string, size float64, q int, w, h float64, multiline bool) (pdf.Ref, error) {
+	const padding = 2.0
+	font := pdf.Helvetica
+	lines := []string{pdf.WinAnsi(strings.Join(strings.Fields(text), " "))}
+	if size == 0 {
+		size = 12
+		if !multiline {
+			size = math.Min(size, (h-2*padding)/(font.Ascent+font.Descent))
+			if lw := font.Width(lines[0], 1); lw > 0 {
+				size = math.Min(size, (w-2*padding)/lw)
+			}
+		}
+		size = math.Max(size, 4)
+	}
+	y := (h-(font.Ascent+font.Descent)*size)/2 + font.Descent*size
+	if multiline {
+		lines = font.Wrap(text, size, w-2*padding)
+		y = h - padding - font.Ascent*size
+	}
+
+	num := pdf.FormatReal
+	c := strings.Builder{}
+	fmt.Fprintf(&c, "/Tx BMC q 1 1 %s %s re W n BT 0 g /Helv %s Tf\n", num(w-2), num(h-2), num(size))
+	for _, l := range lines {
+		x := padding
+		switch q {
+		case 1:
+			x = (w - font.Width(l, size)) / 2
+		case 2:
+			x = w - padding - font.Width(l, size)
+		}
+		fmt.Fprintf(&c, "1 0 0 1 %s %s Tm %s Tj\n", num(x), num(y), pdf.Format(pdf.String(l)))
+		y -= size * 1.2
+	}
+	c.WriteString("ET Q EMC\n")
+
+	stream, err := pdf.Deflate(pdf.Dict{
+		"Type":      pdf.Name("XObject"),
+		"Subtype":   pdf.Name("Form"),
+		"BBox":      pdf.Array{pdf.Integer(0), pdf.Integer(0), pdf.Real(w), pdf.Real(h)},
+		"Resources": pdf.Dict{"Font": pdf.Dict{"Helv": d.w.Add(pdf.Helvetica.Dict())}},
+	}, []byte(c.String()))
+	if err != nil {
+		return pdf.Ref{}, err
+	}
+	return d.w.Add(stream), nil
+}
+
+// rect returns a rectangle as x0, y0, x1, y1 with the lower left corner
+// first.
+func (d *document) rect(o pdf.Object) ([4]float64, bool) {
+	a, _ := d.resolve(o).(pdf.Array)
+	var r [4]float64
+	if len(a) != 4 {
+		return r, false
+	}
+	for i, v := range a {
+		switch n := d.resolve(v).(type) {
+		case pdf.Integer:
+			r[i] = float64(n)
+		case pdf.Real:
+			r[i] = float64(n)
+		}
+	}
+	if r[0] > r[2] {
+		r[0], r[2] = r[2], r[0]
+	}
+	if r[1] > r[3] {
+		r[1], r[3] = r[3], r[1]
+	}
+	return r, true
+}
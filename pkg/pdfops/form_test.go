@@ -0,0 +1,169 @@
+package pdfops
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"github.com/rengas/pdfgen/pkg/htmlrender"
+	"github.com/rengas/pdfgen/pkg/pdf"
+	"github.com/rengas/pdfgen/pkg/pdfrender"
+	"strings"
+	"testing"
+)
+
+func TestFlattenForm(t *testing.T) {
+	doc := `<p>Name <input name="name" value="Ada"> <input type="checkbox" name="paid" checked></p>`
+	rendered, err := htmlrender.NewRenderer().Render(context.Background(), strings.NewReader(doc), pdfrender.Options{Forms: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	withoutAppearance := handmade(t, "", func(w *pdf.Writer) pdf.Dict {
+		return pdf.Dict{"AcroForm": pdf.Dict{"DA": pdf.String("/Helv 0 Tf 0 g")}}
+	}, pdf.Dict{
+		"Type": pdf.Name("Annot"), "Subtype": pdf.Name("Widget"), "FT": pdf.Name("Tx"), "T": pdf.String("name"),
+		"V": pdf.Text("Ada Lovelace"), "Rect": pdf.Array{pdf.Integer(50), pdf.Integer(700), pdf.Integer(250), pdf.Integer(720)},
+	})
+
+	tests := []struct {
+		name  string
+		in    []byte
+		forms []string
+	}{
+		{name: "rendered", in: rendered, forms: []string{"(Ada) Tj", "(4) Tj"}},
+		{name: "without appearance", in: withoutAppearance, forms: []string{"(Ada Lovelace) Tj"}},
+	}
+
+	for _, tc := range tests {
+		b, err := FlattenForm(tc.in)
+		if err != nil {
+			t.Fatalf("%s: unexpected error: %v", tc.name, err)
+		}
+		r, err := pdf.NewReader(b)
+		if err != nil {
+			t.Fatal(err)
+		}
+		root, _ := r.Catalog()
+		if _, ok := root["AcroForm"]; ok {
+			t.Fatalf("%s: expected: %v, got: %v", tc.name, "no form", root)
+		}
+		pages, _ := r.Pages()
+		if _, ok := pages[0].Dict["Annots"]; ok {
+			t.Fatalf("%s: expected: %v, got: %v", tc.name, "no widgets", pages[0].Dict)
+		}
+		res, _ := r.Dict(pages[0].Dict["Resources"])
+		xobjects, _ := r.Dict(res["XObject"])
+		var forms []byte
+		for name, o := range xobjects {
+			if !strings.HasPrefix(string(name), "Fm") {
+				continue
+			}
+			s, _ := r.Resolve(o)
+			data, err := pdf.DecodeStream(s.(pdf.Stream))
+			if err != nil {
+				t.Fatal(err)
+			}
+			forms = append(forms, data...)
+		}
+		for _, want := range tc.forms {
+			if !bytes.Contains(forms, []byte(want)) {
+				t.Fatalf("%s: expected: %q, got: %s", tc.name, want, forms)
+			}
+		}
+	}
+
+	plain := render(t, "<p>no fields</p>")
+	if b, err := FlattenForm(plain); err != nil || !bytes.Equal(b, plain) {
+		t.Fatalf("expected: %v, got: %v", "unchanged pdf", err)
+	}
+}
+
+func renderForm(t *testing.T) []byte {
+	doc := `<p>Name <input name="name" value="Ada"> <input type="checkbox" name="paid" checked>` +
+		`<input type="radio" name="plan" value="basic"><input type="radio" name="plan" value="pro" checked></p>` +
+		`<select name="currency"><option value="EUR">Euro</option><option value="USD" selected>Dollar</option></select>`
+	b, err := htmlrender.NewRenderer().Render(context.Background(), strings.NewReader(doc), pdfrender.Options{Forms: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return b
+}
+
+func TestFormFields(t *testing.T) {
+	fields, err := FormFields(renderForm(t))
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := []FormField{
+		{Name: "name", Type: FieldText, Value: "Ada"},
+		{Name: "paid", Type: FieldCheckbox, Options: []string{"Yes"}, Value: "Yes"},
+		{Name: "plan", Type: FieldRadio, Options: []string{"basic", "pro"}, Value: "pro"},
+		{Name: "currency", Type: FieldChoice, Options: []string{"EUR", "USD"}, Value: "USD"},
+	}
+	if fmt.Sprint(fields) != fmt.Sprint(expected) {
+		t.Fatalf("expected: %v, got: %v", expected, fields)
+	}
+
+	if _, err := FormFields(render(t, "<p>no fields</p>")); err != ErrNoForm {
+		t.Fatalf("expected: %v, got: %v", ErrNoForm, err)
+	}
+}
+
+func TestFillForm(t *testing.T) {
+	form := renderForm(t)
+	tests := []struct {
+		name     string
+		values   map[string]string
+		expected map[string]string
+		err      string
+	}{
+		{
+			name:     "filled",
+			values:   map[string]string{"name": "Grace Hopper", "paid": "false", "plan": "basic", "currency": "EUR", "unknown": "x"},
+			expected: map[string]string{"name": "Grace Hopper", "paid": "", "plan": "basic", "currency": "EUR"},
+		},
+		{
+			name:     "checked",
+			values:   map[string]string{"paid": "yes"},
+			expected: map[string]string{"name": "Ada", "paid": "Yes", "plan": "pro", "currency": "USD"},
+		},
+		{name: "unknown option", values: map[string]string{"plan": "enterprise"}, err: "form field plan is not one of its options: enterprise"},
+		{name: "unknown choice", values: map[string]string{"currency": "GBP"}, err: "form field currency is not one of its options: GBP"},
+		{name: "invalid checkbox", values: map[string]string{"paid": "maybe"}, err: "form field paid is not a checkbox value: maybe"},
+	}
+
+	for _, tc := range tests {
+		b, err := FillForm(form, tc.values)
+		if tc.err != "" {
+			if _, ok := err.(*FormError); !ok || err.Error() != tc.err {
+				t.Fatalf("%s: expected: %v, got: %v", tc.name, tc.err, err)
+			}
+			continue
+		}
+		if err != nil {
+			t.Fatalf("%s: unexpected error: %v", tc.name, err)
+		}
+		fields, err := FormFields(b)
+		if err != nil {
+			t.Fatal(err)
+		}
+		got := map[string]string{}
+		for _, f := range fields {
+			got[f.Name] = f.Value
+		}
+		if fmt.Sprint(got) != fmt.Sprint(tc.expected) {
+			t.Fatalf("%s: expected: %v, got: %v", tc.name, tc.expected, got)
+		}
+	}
+
+	// a filled form can be flattened
+	b, err := FillForm(form, map[string]string{"name": "Grace Hopper"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if b, err = FlattenForm(b); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := FormFields(b); err != ErrNoForm {
+		t.Fatalf("expected: %v, got: %v", ErrNoForm, err)
+	}
+}
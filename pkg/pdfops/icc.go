@@ -0,0 +1,111 @@
+package pdfops
+
+import (
+	"bytes"
+	"encoding/binary"
+	"math"
+)
+
+// srgbProfile returns an ICC version 2 display profile of sRGB IEC61966-2.1
+// for output intents. The primaries are adapted to D50 and the tone curve
+// is sampled from the sRGB transfer function.
+func srgbProfile() []byte {
+	type tag struct {
+		sig  string
+		data []byte
+	}
+	curve := iccCurve(func(v float64) float64 {
+		if v <= 0.04045 {
+			return v / 12.92
+		}
+		return math.Pow((v+0.055)/1.055, 2.4)
+	})
+	tags := []tag{
+		{"desc", iccDesc("sRGB IEC61966-2.1")},
+		{"cprt", iccText("No copyright, use freely")},
+		{"wtpt", iccXYZ(0.9505, 1, 1.0891)},
+		{"rXYZ", iccXYZ(0.4361, 0.2225, 0.0139)},
+		{"gXYZ", iccXYZ(0.3851, 0.7169, 0.0971)},
+		{"bXYZ", iccXYZ(0.1431, 0.0606, 0.7141)},
+		{"rTRC", curve},
+		{"gTRC", curve},
+		{"bTRC", curve},
+	}
+
+	offset := 128 + 4 + 12*len(tags)
+	var table, data bytes.Buffer
+	binary.Write(&table, binary.BigEndian, uint32(len(tags)))
+	shared := map[*byte]uint32{}
+	for _, t := range tags {
+		at, ok := shared[&t.data[0]]
+		if !ok {
+			at = uint32(offset + data.Len())
+			shared[&t.data[0]] = at
+			data.Write(t.data)
+			// tags start on 4 byte boundaries
+			for data.Len()%4 != 0 {
+				data.WriteByte(0)
+			}
+		}
+		table.WriteString(t.sig)
+		binary.Write(&table, binary.BigEndian, [2]uint32{at, uint32(len(t.data))})
+	}
+
+	size := offset + data.Len()
+	header := make([]byte, 128)
+	binary.BigEndian.PutUint32(header[0:], uint32(size))
+	binary.BigEndian.PutUint32(header[8:], 0x02100000)
+	copy(header[12:], "mntrRGB XYZ ")
+	for i, v := range []uint16{2022, 1, 1} {
+		binary.BigEndian.PutUint16(header[24+2*i:], v)
+	}
+	copy(header[36:], "acsp")
+	// the illuminant of the profile connection space is D50
+	copy(header[68:], iccXYZ(0.9642, 1, 0.8249)[8:])
+
+	out := make([]byte, 0, size)
+	out = append(append(append(out, header...), table.Bytes()...), data.Bytes()...)
+	return out
+}
+
+func s15Fixed16(v float64) uint32 {
+	return uint32(int32(math.Round(v * 65536)))
+}
+
+func iccXYZ(x, y, z float64) []byte {
+	b := make([]byte, 20)
+	copy(b, "XYZ ")
+	for i, v := range []float64{x, y, z} {
+		binary.BigEndian.PutUint32(b[8+4*i:], s15Fixed16(v))
+	}
+	return b
+}
+
+func iccText(s string) []byte {
+	return append([]byte("text\x00\x00\x00\x00"+s), 0)
+}
+
+// iccDesc is the version 2 description type, an ASCII description followed by
+// empty Unicode and ScriptCode descriptions.
+func iccDesc(s string) []byte {
+	var b bytes.Buffer
+	b.WriteString("desc\x00\x00\x00\x00")
+	binary.Write(&b, binary.BigEndian, uint32(len(s)+1))
+	b.WriteString(s)
+	b.WriteByte(0)
+	b.Write(make([]byte, 4+4+2+1+67))
+	return b.Bytes()
+}
+
+// iccCurve samples the transfer function f at 1024 points.
+func iccCurve(f func(float64) float64) []byte {
+	const n = 1024
+	b := make([]byte, 12+2*n)
+	copy(b, "curv")
+	binary.BigEndian.PutUint32(b[8:], n)
+	for i := 0; i < n; i++ {
+		v := math.Round(f(float64(i)/(n-1)) * 65535)
+		binary.BigEndian.PutUint16(b[12+2*i:], uint16(v))
+	}
+	return b
+}
@@ -0,0 +1,47 @@
+package pdfops
+
+import "github.com/rengas/pdfgen/pkg/pdf"
+
+// Info is the document information of a PDF, document management systems
+// index files by it.
+type Info struct {
+	Title    string
+	Author   string
+	Subject  string
+	Keywords string
+	Creator  string
+}
+
+// SetInfo writes the document information of the PDF b, empty values keep
+// those of the file. Viewers show the title of tagged files as PDF/UA asks.
+func SetInfo(b []byte, info Info) ([]byte, error) {
+	doc, err := open(b)
+	if err != nil {
+		return nil, err
+	}
+	d := doc.dict(doc.info)
+	for k, v := range map[pdf.Name]string{
+		"Title":    info.Title,
+		"Author":   info.Author,
+		"Subject":  info.Subject,
+		"Keywords": info.Keywords,
+		"Creator":  info.Creator,
+	} {
+		if v != "" {
+			d[k] = pdf.Text(v)
+		}
+	}
+	doc.info = doc.w.Add(d)
+
+	root, ok := doc.resolve(doc.root).(pdf.Dict)
+	if !ok {
+		return nil, pdf.ErrMalformed
+	}
+	mark, _ := doc.resolve(root["MarkInfo"]).(pdf.Dict)
+	if marked, _ := doc.resolve(mark["Marked"]).(pdf.Boolean); marked && info.Title != "" {
+		prefs := doc.dict(root["ViewerPreferences"])
+		prefs["DisplayDocTitle"] = pdf.Boolean(true)
+		root["ViewerPreferences"] = prefs
+	}
+	return doc.bytes()
+}
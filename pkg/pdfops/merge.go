@@ -0,0 +1,150 @@
+// Package pdfops changes rendered PDF files, e.g. merges several files into
+// one or draws watermarks over their pages.
+package pdfops
+
+import (
+	"errors"
+	"fmt"
+	"github.com/rengas/pdfgen/pkg/pdf"
+)
+
+var ErrNoParts = errors.New("nothing to merge")
+
+// Part is a PDF file to merge, Title names its bookmark.
+type Part struct {
+	Title string
+	PDF   []byte
+}
+
+// Merge appends the pages of the parts in order and adds a bookmark per part
+// pointing to its first page. The page labels of the parts are dropped so
+// viewers number the pages of the result continuously, numbers printed on
+// the pages are the ones the parts were rendered with.
+func Merge(parts []Part) ([]byte, error) {
+	return merge(parts, true)
+}
+
+// Concat appends the pages of the pdfs in order, without bookmarks.
+func Concat(pdfs ...[]byte) ([]byte, error) {
+	parts := make([]Part, len(pdfs))
+	for i, b := range pdfs {
+		parts[i] = Part{PDF: b}
+	}
+	return merge(parts, false)
+}
+
+func merge(parts []Part, bookmarks bool) ([]byte, error) {
+	if len(parts) == 0 {
+		return nil, ErrNoParts
+	}
+
+	w := pdf.NewWriter()
+	pagesRef := w.Reserve()
+	var outlinesRef pdf.Ref
+	if bookmarks {
+		outlinesRef = w.Reserve()
+	}
+	var kids pdf.Array
+	var items []pdf.Ref
+	version := "1.4"
+
+	for i, part := range parts {
+		r, err := pdf.NewReader(part.PDF)
+		if err != nil {
+			return nil, fmt.Errorf("part %d: %w", i+1, err)
+		}
+		if r.Version() > version {
+			version = r.Version()
+		}
+		pages, err := r.Pages()
+		if err != nil {
+			return nil, fmt.Errorf("part %d: %w", i+1, err)
+		}
+		if len(pages) == 0 {
+			continue
+		}
+
+		refs, err := copyPages(r, w, pages, pagesRef)
+		if err != nil {
+			return nil, fmt.Errorf("part %d: %w", i+1, err)
+		}
+		kids = append(kids, refs...)
+		if bookmarks {
+			items = append(items, w.Add(pdf.Dict{
+				"Title":  pdf.Text(part.Title),
+				"Parent": outlinesRef,
+				"Dest":   pdf.Array{refs[0], pdf.Name("Fit")},
+			}))
+		}
+	}
+	if len(kids) == 0 {
+		return nil, ErrNoParts
+	}
+
+	w.Set(pagesRef, pdf.Dict{"Type": pdf.Name("Pages"), "Kids": kids, "Count": pdf.Integer(len(kids))})
+	catalog := pdf.Dict{
+		"Type":       pdf.Name("Catalog"),
+		"Pages":      pagesRef,
+		"PageLabels": pdf.Dict{"Nums": pdf.Array{pdf.Integer(0), pdf.Dict{"S": pdf.Name("D")}}},
+	}
+	if bookmarks {
+		w.Set(outlinesRef, outline(w, items))
+		catalog["Outlines"] = outlinesRef
+		catalog["PageMode"] = pdf.Name("UseOutlines")
+	}
+	root := w.Add(catalog)
+	info := w.Add(pdf.Dict{"Producer": pdf.String("pdfgen")})
+	return w.Bytes(version, pdf.Dict{"Root": root, "Info": info})
+}
+
+// copyPages copies the pages of r under parent and returns their new
+// references.
+func copyPages(r *pdf.Reader, w *pdf.Writer, pages []pdf.Page, parent pdf.Ref) ([]pdf.Object, error) {
+	c := pdf.NewCopier(r, w)
+	refs := make([]pdf.Object, len(pages))
+	// pages are mapped first so links between pages of a part stay intact
+	for i, p := range pages {
+		ref := w.Reserve()
+		c.Map(p.Ref, ref)
+		refs[i] = ref
+	}
+
+	for i, p := range pages {
+		d := pdf.Dict{}
+		for k, v := range p.Dict {
+			// the parent would pull in the whole source page tree, structure
+			// tree entries have no tree in the result
+			if k == "Parent" || k == "StructParents" {
+				continue
+			}
+			d[k] = v
+		}
+		cp, err := c.Copy(d)
+		if err != nil {
+			return nil, err
+		}
+		page := cp.(pdf.Dict)
+		page["Parent"] = parent
+		w.Set(refs[i].(pdf.Ref), page)
+	}
+	return refs, nil
+}
+
+// outline links the bookmark items and returns the outline dictionary.
+func outline(w *pdf.Writer, items []pdf.Ref) pdf.Dict {
+	for i, ref := range items {
+		item := w.Get(ref).(pdf.Dict)
+		if i > 0 {
+			item["Prev"] = items[i-1]
+		}
+		if i < len(items)-1 {
+			item["Next"] = items[i+1]
+		}
+	}
+	return pdf.Dict{
+		"Type":  pdf.Name("Outlines"),
+		"First": items[0],
+		"Last":  items[len(items)-1],
+		"Count": pdf.Integer(len(items)),
+	}
+}
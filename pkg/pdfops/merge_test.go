@@ -0,0 +1,96 @@
+package pdfops
+
+import (
+	"context"
+	"github.com/rengas/pdfgen/pkg/htmlrender"
+	"github.com/rengas/pdfgen/pkg/pdf"
+	"github.com/rengas/pdfgen/pkg/pdfrender"
+	"strings"
+	"testing"
+)
+
+func render(t *testing.T, html string) []byte {
+	b, err := htmlrender.NewRenderer().Render(context.Background(), strings.NewReader(html), pdfrender.Options{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return b
+}
+
+func TestMerge(t *testing.T) {
+	long := strings.Repeat("<p>line</p>", 60)
+	parts := []Part{
+		{Title: "Invoice", PDF: render(t, "<p>invoice</p>")},
+		{Title: "Bedingungen für Käufer", PDF: render(t, long)},
+	}
+
+	b, err := Merge(parts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	r, err := pdf.NewReader(b)
+	if err != nil {
+		t.Fatal(err)
+	}
+	pages, err := r.Pages()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(pages) < 3 {
+		t.Fatalf("expected: %v, got: %v", "at least 3 pages", len(pages))
+	}
+	for i, p := range pages {
+		if _, ok := p.Dict["Resources"]; !ok {
+			t.Fatalf("page %d: expected: %v, got: %v", i, "resources", pdf.Format(p.Dict))
+		}
+	}
+
+	catalog, err := r.Catalog()
+	if err != nil {
+		t.Fatal(err)
+	}
+	outlines, err := r.Dict(catalog["Outlines"])
+	if err != nil {
+		t.Fatal(err)
+	}
+	if outlines["Count"] != pdf.Integer(2) {
+		t.Fatalf("expected: %v, got: %v", 2, outlines["Count"])
+	}
+
+	wantTitles := []pdf.Object{pdf.String("Invoice"), pdf.Text("Bedingungen für Käufer")}
+	wantPages := []pdf.Ref{pages[0].Ref, pages[1].Ref}
+	item := outlines["First"]
+	for i := range wantTitles {
+		d, err := r.Dict(item)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if pdf.Format(d["Title"]) != pdf.Format(wantTitles[i]) {
+			t.Fatalf("item %d: expected: %v, got: %v", i, pdf.Format(wantTitles[i]), pdf.Format(d["Title"]))
+		}
+		dest, _ := d["Dest"].(pdf.Array)
+		if len(dest) == 0 || dest[0] != wantPages[i] {
+			t.Fatalf("item %d: expected: %v, got: %v", i, wantPages[i], pdf.Format(dest))
+		}
+		item = d["Next"]
+	}
+	if item != nil {
+		t.Fatalf("expected: %v, got: %v", "last item", item)
+	}
+}
+
+func TestMergeErrors(t *testing.T) {
+	tests := []struct {
+		name  string
+		parts []Part
+	}{
+		{name: "no parts"},
+		{name: "not a pdf", parts: []Part{{Title: "a", PDF: []byte("<html>")}}},
+	}
+
+	for _, tc := range tests {
+		if _, err := Merge(tc.parts); err == nil {
+			t.Fatalf("%s: expected: %v, got: %v", tc.name, "error", err)
+		}
+	}
+}
@@ -0,0 +1,297 @@
+package pdfops
+
+import (
+	"fmt"
+	"github.com/rengas/pdfgen/pkg/pdf"
+	"strconv"
+	"strings"
+)
+
+// Geometry of tables of contents in points.
+const (
+	tocMargin    = 56
+	tocTitleSize = 18
+	tocSize      = 11
+	tocLeading   = 18
+	tocIndent    = 14
+	// tocGap separates the dot leaders from the title and the page number
+	tocGap = 6
+)
+
+// Bookmarks cuts the outline of the PDF b to its first depth levels, depth 0
+// removes the outline.
+func Bookmarks(b []byte, depth int) ([]byte, error) {
+	doc, err := open(b)
+	if err != nil {
+		return nil, err
+	}
+	root, ok := doc.resolve(doc.root).(pdf.Dict)
+	if !ok {
+		return nil, pdf.ErrMalformed
+	}
+	if _, ok := root["Outlines"]; !ok {
+		return b, nil
+	}
+	outlines, ok := doc.resolve(root["Outlines"]).(pdf.Dict)
+	if depth <= 0 || !ok {
+		delete(root, "Outlines")
+		if mode, _ := doc.resolve(root["PageMode"]).(pdf.Name); mode == "UseOutlines" {
+			delete(root, "PageMode")
+		}
+		return doc.bytes()
+	}
+	doc.cutOutline(outlines, 0, depth, map[pdf.Ref]bool{})
+	return doc.bytes()
+}
+
+// cutOutline removes the items more than depth levels below the outline
+// and returns the number of items shown below item. Closed items stay
+// closed.
+func (d *document) cutOutline(item pdf.Dict, level, depth int, seen map[pdf.Ref]bool) int {
+	count := 0
+	if level < depth {
+		for o := item["First"]; o != nil; {
+			ref, ok := o.(pdf.Ref)
+			if !ok || seen[ref] {
+				break
+			}
+			seen[ref] = true
+			kid, ok := d.resolve(ref).(pdf.Dict)
+			if !ok {
+				break
+			}
+			count += 1 + d.cutOutline(kid, level+1, depth, seen)
+			o = kid["Next"]
+		}
+	}
+	if count == 0 {
+		delete(item, "First")
+		delete(item, "Last")
+		delete(item, "Count")
+		return 0
+	}
+	if old, _ := d.resolve(item["Count"]).(pdf.Integer); old < 0 && level > 0 {
+		item["Count"] = pdf.Integer(-count)
+		return 0
+	}
+	item["Count"] = pdf.Integer(count)
+	return count
+}
+
+// tocEntry is an outline item listed in a table of contents, page is the
+// index of the page it points to.
+type tocEntry struct {
+	title string
+	level int
+	page  int
+	dest  pdf.Array
+}
+
+// outlineReader lists the items of an outline with their destinations.
+type outlineReader struct {
+	d     *document
+	dests pdf.Dict
+	named map[string]pdf.Object
+	pages map[pdf.Ref]int
+	seen  map[pdf.Ref]bool
+}
+
+func (r *outlineReader) entries(item pdf.Dict, level, depth int, out []tocEntry) []tocEntry {
+	for o := item["First"]; o != nil && level < depth; {
+		ref, ok := o.(pdf.Ref)
+		if !ok || r.seen[ref] {
+			break
+		}
+		r.seen[ref] = true
+		kid, ok := r.d.resolve(ref).(pdf.Dict)
+		if !ok {
+			break
+		}
+		dest := r.destination(kid)
+		if len(dest) > 0 {
+			if page, ok := dest[0].(pdf.Ref); ok {
+				if n, ok := r.pages[page]; ok {
+					title := strings.Join(strings.Fields(pdf.DecodeText(r.d.resolve(kid["Title"]))), " ")
+					out = append(out, tocEntry{title: title, level: level + 1, page: n, dest: dest})
+				}
+			}
+		}
+		out = r.entries(kid, level+1, depth, out)
+		o = kid["Next"]
+	}
+	return out
+}
+
+// destination returns the explicit destination of an outline item, named
+// destinations are looked up in the catalog.
+func (r *outlineReader) destination(item pdf.Dict) pdf.Array {
+	dest := item["Dest"]
+	if action, ok := r.d.resolve(item["A"]).(pdf.Dict); ok {
+		if s, _ := r.d.resolve(action["S"]).(pdf.Name); s == "GoTo" {
+			dest = action["D"]
+		}
+	}
+	dest = r.d.resolve(dest)
+	switch name := dest.(type) {
+	case pdf.Name:
+		dest = r.d.resolve(r.dests[name])
+	case pdf.String, pdf.HexString:
+		dest = r.d.resolve(r.named[pdf.DecodeText(name)])
+	}
+	if dict, ok := dest.(pdf.Dict); ok {
+		dest = r.d.resolve(dict["D"])
+	}
+	a, _ := dest.(pdf.Array)
+	return a
+}
+
+// TableOfContents inserts pages before the PDF b that list the first depth
+// levels of its outline with their page numbers, every line links to its
+// page. The pages of b keep their numbers, those of the contents are
+// labelled i, ii and so on. Files without outline are returned unchanged.
+func TableOfContents(b []byte, title string, depth int) ([]byte, error) {
+	doc, err := open(b)
+	if err != nil {
+		return nil, err
+	}
+	root, ok := doc.resolve(doc.root).(pdf.Dict)
+	if !ok {
+		return nil, pdf.ErrMalformed
+	}
+	outlines, ok := doc.resolve(root["Outlines"]).(pdf.Dict)
+	if !ok || len(doc.pages) == 0 {
+		return b, nil
+	}
+	r := &outlineReader{d: doc, named: map[string]pdf.Object{}, pages: map[pdf.Ref]int{}, seen: map[pdf.Ref]bool{}}
+	r.dests, _ = doc.resolve(root["Dests"]).(pdf.Dict)
+	if names, ok := doc.resolve(root["Names"]).(pdf.Dict); ok {
+		doc.nameTree(names["Dests"], r.named, 0)
+	}
+	for i, ref := range doc.pages {
+		r.pages[ref] = i
+	}
+	entries := r.entries(outlines, 0, depth, nil)
+	if len(entries) == 0 {
+		return b, nil
+	}
+
+	pagesRef := doc.w.Reserve()
+	toc, err := doc.contentsPages(entries, title, pagesRef)
+	if err != nil {
+		return nil, err
+	}
+	for _, ref := range doc.pages {
+		doc.w.Get(ref).(pdf.Dict)["Parent"] = pagesRef
+	}
+	doc.pages = append(toc, doc.pages...)
+	kids := make(pdf.Array, len(doc.pages))
+	for i, ref := range doc.pages {
+		kids[i] = ref
+	}
+	doc.w.Set(pagesRef, pdf.Dict{"Type": pdf.Name("Pages"), "Kids": kids, "Count": pdf.Integer(len(kids))})
+	root["Pages"] = pagesRef
+
+	// labels of the document move behind the contents
+	n := pdf.Integer(len(toc))
+	nums := pdf.Array{pdf.Integer(0), pdf.Dict{"S": pdf.Name("r")}}
+	labels, _ := doc.resolve(root["PageLabels"]).(pdf.Dict)
+	old, _ := doc.resolve(labels["Nums"]).(pdf.Array)
+	if len(old) == 0 {
+		nums = append(nums, n, pdf.Dict{"S": pdf.Name("D")})
+	}
+	for i := 0; i+1 < len(old); i += 2 {
+		if k, ok := doc.resolve(old[i]).(pdf.Integer); ok {
+			nums = append(nums, k+n, old[i+1])
+		}
+	}
+	root["PageLabels"] = pdf.Dict{"Nums": nums}
+	return doc.bytes()
+}
+
+// contentsPages lays out the entries on pages the size of the first page of
+// the document, level one entries are bold.
+func (d *document) contentsPages(entries []tocEntry, title string, parent pdf.Ref) ([]pdf.Ref, error) {
+	box := d.box(d.w.Get(d.pages[0]).(pdf.Dict))
+	fonts := pdf.Dict{"F1": d.w.Add(pdf.Helvetica.Dict()), "F2": d.w.Add(pdf.HelveticaBold.Dict())}
+	num := pdf.FormatReal
+	left, right, top := box[0]+tocMargin, box[2]-tocMargin, box[3]-tocMargin
+
+	var refs []pdf.Ref
+	var c *strings.Builder
+	var annots pdf.Array
+	finish := func() error {
+		stream, err := pdf.Deflate(nil, []byte(c.String()))
+		if err != nil {
+			return err
+		}
+		refs = append(refs, d.w.Add(pdf.Dict{
+			"Type":      pdf.Name("Page"),
+			"Parent":    parent,
+			"MediaBox":  pdf.Array{pdf.Real(box[0]), pdf.Real(box[1]), pdf.Real(box[2]), pdf.Real(box[3])},
+			"Resources": pdf.Dict{"Font": fonts},
+			"Contents":  d.w.Add(stream),
+			"Annots":    annots,
+		}))
+		return nil
+	}
+
+	y := 0.0
+	dot := pdf.Helvetica.Width(".", tocSize) + 2
+	for _, e := range entries {
+		if c == nil || y-pdf.Helvetica.Descent*tocSize < box[1]+tocMargin {
+			if c != nil {
+				if err := finish(); err != nil {
+					return nil, err
+				}
+			}
+			c, annots, y = &strings.Builder{}, pdf.Array{}, top-tocSize
+			if len(refs) == 0 {
+				fmt.Fprintf(c, "BT /F2 %d Tf %s %s Td %s Tj ET\n", tocTitleSize, num(left), num(top-tocTitleSize), pdf.Format(pdf.String(pdf.WinAnsi(title))))
+				y = top - tocTitleSize - 2*tocLeading
+			}
+		}
+
+		font, name := pdf.Helvetica, "F1"
+		if e.level == 1 {
+			font, name = pdf.HelveticaBold, "F2"
+		}
+		x := left + float64(e.level-1)*tocIndent
+		number := strconv.Itoa(e.page + 1)
+		nw := pdf.Helvetica.Width(number, tocSize)
+		text := fit(pdf.WinAnsi(e.title), font, right-nw-2*tocGap-x)
+		fmt.Fprintf(c, "BT /%s %d Tf %s %s Td %s Tj ET\n", name, tocSize, num(x), num(y), pdf.Format(pdf.String(text)))
+		// dot leaders fill the space between the title and the page number
+		from, to := x+font.Width(text, tocSize)+tocGap, right-nw-tocGap
+		if dots := int((to - from) / dot); dots > 0 {
+			fmt.Fprintf(c, "q BT /F1 %d Tf 2 Tc %s %s Td (%s) Tj ET Q\n", tocSize, num(to-float64(dots)*dot), num(y), strings.Repeat(".", dots))
+		}
+		fmt.Fprintf(c, "BT /F1 %d Tf %s %s Td (%s) Tj ET\n", tocSize, num(right-nw), num(y), number)
+		annots = append(annots, d.w.Add(pdf.Dict{
+			"Type":    pdf.Name("Annot"),
+			"Subtype": pdf.Name("Link"),
+			"Rect":    pdf.Array{pdf.Real(x), pdf.Real(y - pdf.Helvetica.Descent*tocSize), pdf.Real(right), pdf.Real(y + pdf.Helvetica.Ascent*tocSize)},
+			"Border":  pdf.Array{pdf.Integer(0), pdf.Integer(0), pdf.Integer(0)},
+			"Dest":    e.dest,
+		}))
+		y -= tocLeading
+	}
+	if err := finish(); err != nil {
+		return nil, err
+	}
+	return refs, nil
+}
+
+// fit shortens WinAnsi text with an ellipsis to the width at the size of
+// tables of contents.
+func fit(text string, font *pdf.Font, width float64) string {
+	if font.Width(text, tocSize) <= width {
+		return text
+	}
+	for text != "" {
+		text = text[:len(text)-1]
+		if font.Width(text+"\x85", tocSize) <= width {
+			return text + "\x85"
+		}
+	}
+	return ""
+}
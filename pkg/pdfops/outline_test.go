@@ -0,0 +1,156 @@
+package pdfops
+
+import (
+	"context"
+	"github.com/rengas/pdfgen/pkg/htmlrender"
+	"github.com/rengas/pdfgen/pkg/pdf"
+	"github.com/rengas/pdfgen/pkg/pdfrender"
+	"strings"
+	"testing"
+)
+
+const outlined = `<h1>Terms</h1><p>a</p><h2>Payment</h2><h3>Late fees</h3>` +
+	`<h1 style="page-break-before: always">Prices für Käufer</h1><h2>Discounts</h2>`
+
+// outlineTitles returns the titles of the outline of b in order, indented
+// by level.
+func outlineTitles(t *testing.T, b []byte) []string {
+	r, err := pdf.NewReader(b)
+	if err != nil {
+		t.Fatal(err)
+	}
+	root, err := r.Catalog()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := root["Outlines"]; !ok {
+		return nil
+	}
+	outlines, err := r.Dict(root["Outlines"])
+	if err != nil {
+		t.Fatal(err)
+	}
+	var out []string
+	var walk func(d pdf.Dict, indent string)
+	walk = func(d pdf.Dict, indent string) {
+		for o := d["First"]; o != nil; {
+			item, err := r.Dict(o)
+			if err != nil {
+				t.Fatal(err)
+			}
+			out = append(out, indent+pdf.DecodeText(item["Title"]))
+			walk(item, indent+" ")
+			o = item["Next"]
+		}
+	}
+	walk(outlines, "")
+	return out
+}
+
+func TestBookmarks(t *testing.T) {
+	doc, err := htmlrender.NewRenderer().Render(context.Background(), strings.NewReader(outlined), pdfrender.Options{Bookmarks: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		depth int
+		want  string
+	}{
+		{depth: 3, want: "Terms,  Payment,   Late fees, Prices für Käufer,  Discounts"},
+		{depth: 1, want: "Terms, Prices für Käufer"},
+		{depth: 0, want: ""},
+	}
+
+	for _, tc := range tests {
+		b, err := Bookmarks(doc, tc.depth)
+		if err != nil {
+			t.Fatalf("%d: unexpected error: %v", tc.depth, err)
+		}
+		if got := strings.Join(outlineTitles(t, b), ", "); got != tc.want {
+			t.Fatalf("%d: expected: %v, got: %v", tc.depth, tc.want, got)
+		}
+	}
+}
+
+func TestTableOfContents(t *testing.T) {
+	doc, err := htmlrender.NewRenderer().Render(context.Background(), strings.NewReader(outlined), pdfrender.Options{Bookmarks: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	b, err := TableOfContents(doc, "Contents", 2)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	r, err := pdf.NewReader(b)
+	if err != nil {
+		t.Fatal(err)
+	}
+	pages, err := r.Pages()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(pages) != 3 {
+		t.Fatalf("expected: %v, got: %v", 3, len(pages))
+	}
+	content := pageContent(t, b)
+	for _, want := range []string{"(Contents) Tj", "(Terms) Tj", "(Payment) Tj", "(Prices f\xfcr K\xe4ufer) Tj", "(1) Tj", "(2) Tj"} {
+		if !strings.Contains(string(content), want) {
+			t.Fatalf("expected: %q in content, got: %s", want, content)
+		}
+	}
+	if strings.Contains(string(content), "Late fees") {
+		t.Fatalf("expected: %v, got: %s", "no third level", content)
+	}
+
+	annots, _ := pages[0].Dict["Annots"].(pdf.Array)
+	if len(annots) != 4 {
+		t.Fatalf("expected: %v, got: %v", 4, len(annots))
+	}
+	link, err := r.Dict(annots[3])
+	if err != nil {
+		t.Fatal(err)
+	}
+	dest, _ := link["Dest"].(pdf.Array)
+	if len(dest) == 0 || dest[0] != pdf.Object(pages[2].Ref) {
+		t.Fatalf("expected: %v, got: %v", "link to the third page", pdf.Format(link))
+	}
+
+	root, err := r.Catalog()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, want := pdf.Format(root["PageLabels"]), "<</Nums [0 <</S /r>> 1 <</S /D>>]>>"; got != want {
+		t.Fatalf("expected: %v, got: %v", want, got)
+	}
+
+	plain := render(t, "<p>no headings</p>")
+	if b, err := TableOfContents(plain, "Contents", 3); err != nil || len(b) != len(plain) {
+		t.Fatalf("expected: %v, got: %v", "the file unchanged", err)
+	}
+}
+
+func TestSetInfo(t *testing.T) {
+	b, err := SetInfo(render(t, "<title>Page</title><p>a</p>"), Info{Title: "Rechnung Nº 7", Author: "Ada Lovelace"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	r, err := pdf.NewReader(b)
+	if err != nil {
+		t.Fatal(err)
+	}
+	info, err := r.Dict(r.Trailer()["Info"])
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := map[pdf.Name]string{"Title": "Rechnung Nº 7", "Author": "Ada Lovelace", "Producer": "pdfgen"}
+	for k, v := range want {
+		if got := pdf.DecodeText(info[k]); got != v {
+			t.Fatalf("%s: expected: %v, got: %v", k, v, got)
+		}
+	}
+	if _, ok := info["Subject"]; ok {
+		t.Fatalf("expected: %v, got: %v", "no subject", pdf.Format(info))
+	}
+}
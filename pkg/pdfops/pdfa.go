@@ -0,0 +1,635 @@
+package pdfops
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"github.com/rengas/pdfgen/pkg/pdf"
+	"sort"
+	"strings"
+	"time"
+)
+
+// Levels of PDF/A, both require the visual appearance to be preserved.
+// PDF/A-3 also allows embedding files of any type.
+const (
+	PDFA2B = "2b"
+	PDFA3B = "3b"
+)
+
+var ErrPDFALevel = errors.New("pdf/a level must be 2b or 3b")
+
+// Violation is a requirement of PDF/A a document does not meet, Clause
+// refers to ISO 19005-2 which ISO 19005-3 follows.
+type Violation struct {
+	Clause  string `json:"clause" example:"6.2.11.4.1"`
+	Message string `json:"message" example:"font Helvetica is not embedded"`
+}
+
+// ConformanceError is returned for documents that can not be made PDF/A.
+type ConformanceError struct {
+	Level      string
+	Violations []Violation
+}
+
+func (e *ConformanceError) Error() string {
+	msgs := make([]string, len(e.Violations))
+	for i, v := range e.Violations {
+		msgs[i] = fmt.Sprintf("%s (%s)", v.Message, v.Clause)
+	}
+	return fmt.Sprintf("document is not PDF/A-%s: %s", e.Level, strings.Join(msgs, "; "))
+}
+
+// forbiddenActions may not be used in PDF/A documents.
+var forbiddenActions = map[pdf.Name]bool{
+	"JavaScript": true, "Launch": true, "Sound": true, "Movie": true, "ResetForm": true, "ImportData": true,
+	"Hide": true, "SetOCGState": true, "Rendition": true, "Trans": true, "GoTo3DView": true,
+}
+
+// namedActions are the named actions PDF/A allows.
+var namedActions = map[pdf.Name]bool{"NextPage": true, "PrevPage": true, "FirstPage": true, "LastPage": true}
+
+// forbiddenAnnotations are annotation types PDF/A does not allow.
+var forbiddenAnnotations = map[pdf.Name]bool{"Sound": true, "Movie": true, "Screen": true, "3D": true, "RichMedia": true, "TrapNet": true}
+
+// Annotation flags.
+const (
+	annotInvisible    = 1
+	annotHidden       = 2
+	annotPrint        = 4
+	annotNoView       = 32
+	annotToggleNoView = 256
+)
+
+func pdfaPart(level string) (int, error) {
+	switch level {
+	case PDFA2B:
+		return 2, nil
+	case PDFA3B:
+		return 3, nil
+	}
+	return 0, ErrPDFALevel
+}
+
+// PDFA converts the PDF b to PDF/A-2b or PDF/A-3b. It adds XMP metadata
+// that mirrors the document information, an sRGB output intent when the
+// file has none, and removes JavaScript, trigger events and other features
+// PDF/A forbids. What can not be converted, like fonts that are not
+// embedded, is returned as a *ConformanceError instead of a file.
+func PDFA(b []byte, level string, at time.Time) ([]byte, error) {
+	return convertPDFA(b, level, at, nil)
+}
+
+// convertPDFA converts b, extra are further rdf:Description elements of the
+// XMP metadata.
+func convertPDFA(b []byte, level string, at time.Time, extra []string) ([]byte, error) {
+	part, err := pdfaPart(level)
+	if err != nil {
+		return nil, err
+	}
+	doc, err := open(b)
+	if errors.Is(err, pdf.ErrEncrypted) {
+		return nil, &ConformanceError{Level: level, Violations: []Violation{{"6.1.3", "document is encrypted"}}}
+	}
+	if err != nil {
+		return nil, err
+	}
+	root, ok := doc.resolve(doc.root).(pdf.Dict)
+	if !ok {
+		return nil, pdf.ErrMalformed
+	}
+	// PDF/A-2 and 3 are based on PDF 1.7
+	doc.version = "1.7"
+
+	for i := 1; i <= doc.w.Len(); i++ {
+		switch o := doc.w.Get(pdf.Ref{Number: i}).(type) {
+		case pdf.Dict:
+			doc.cleanPDFA(o)
+		case pdf.Stream:
+			doc.cleanPDFA(o.Dict)
+		}
+	}
+
+	delete(root, "AA")
+	if names, ok := doc.resolve(root["Names"]).(pdf.Dict); ok {
+		names = doc.dict(names)
+		delete(names, "JavaScript")
+		root["Names"] = names
+	}
+	if form, ok := doc.resolve(root["AcroForm"]).(pdf.Dict); ok {
+		form = doc.dict(form)
+		delete(form, "NeedAppearances")
+		delete(form, "XFA")
+		root["AcroForm"] = form
+	}
+
+	for _, ref := range doc.pages {
+		page := doc.w.Get(ref).(pdf.Dict)
+		annots, _ := doc.resolve(page["Annots"]).(pdf.Array)
+		for _, a := range annots {
+			annot, ok := doc.resolve(a).(pdf.Dict)
+			if !ok || annot["Subtype"] == pdf.Name("Popup") {
+				continue
+			}
+			flags, _ := doc.resolve(annot["F"]).(pdf.Integer)
+			annot["F"] = flags&^(annotInvisible|annotHidden|annotNoView|annotToggleNoView) | annotPrint
+			if ap, ok := doc.resolve(annot["AP"]).(pdf.Dict); ok {
+				annot["AP"] = pdf.Dict{"N": ap["N"]}
+			}
+		}
+	}
+
+	if !hasPDFAIntent(doc, root) {
+		profile, err := pdf.Deflate(pdf.Dict{"N": pdf.Integer(3)}, srgbProfile())
+		if err != nil {
+			return nil, err
+		}
+		root["OutputIntents"] = pdf.Array{pdf.Dict{
+			"Type":                      pdf.Name("OutputIntent"),
+			"S":                         pdf.Name("GTS_PDFA1"),
+			"OutputConditionIdentifier": pdf.String("sRGB IEC61966-2.1"),
+			"Info":                      pdf.String("sRGB IEC61966-2.1"),
+			"RegistryName":              pdf.String("http://www.color.org"),
+			"DestOutputProfile":         doc.w.Add(profile),
+		}}
+	}
+
+	info := doc.dict(doc.info)
+	meta := xmpMetadata{
+		part:        part,
+		conformance: "B",
+		title:       pdf.DecodeText(doc.resolve(info["Title"])),
+		author:      pdf.DecodeText(doc.resolve(info["Author"])),
+		subject:     pdf.DecodeText(doc.resolve(info["Subject"])),
+		keywords:    pdf.DecodeText(doc.resolve(info["Keywords"])),
+		creator:     pdf.DecodeText(doc.resolve(info["Creator"])),
+		producer:    pdf.DecodeText(doc.resolve(info["Producer"])),
+		created:     at.UTC().Truncate(time.Second),
+		modified:    at.UTC().Truncate(time.Second),
+		extra:       extra,
+	}
+	if created, err := pdf.ParseDate(pdf.DecodeText(doc.resolve(info["CreationDate"]))); err == nil {
+		meta.created = created.UTC()
+	}
+	if meta.producer == "" {
+		meta.producer = "pdfgen"
+	}
+	// the information dictionary is written again so it matches the
+	// metadata, e.g. dates in UTC
+	info = pdf.Dict{"Producer": pdf.Text(meta.producer), "CreationDate": pdf.Date(meta.created), "ModDate": pdf.Date(meta.modified)}
+	for k, v := range map[pdf.Name]string{"Title": meta.title, "Author": meta.author, "Subject": meta.subject, "Keywords": meta.keywords, "Creator": meta.creator} {
+		if v != "" {
+			info[k] = pdf.Text(v)
+		}
+	}
+	doc.info = doc.w.Add(info)
+	root["Metadata"] = doc.w.Add(pdf.Stream{Dict: pdf.Dict{"Type": pdf.Name("Metadata"), "Subtype": pdf.Name("XML")}, Data: meta.bytes()})
+
+	out, err := doc.bytes()
+	if err != nil {
+		return nil, err
+	}
+	if v := CheckPDFA(out, level); len(v) > 0 {
+		return nil, &ConformanceError{Level: level, Violations: v}
+	}
+	return out, nil
+}
+
+// cleanPDFA removes entries PDF/A forbids from a dictionary of any kind.
+func (d *document) cleanPDFA(o pdf.Dict) {
+	delete(o, "AA")
+	for _, k := range []pdf.Name{"A", "OpenAction", "Next"} {
+		if action, ok := d.resolve(o[k]).(pdf.Dict); ok && !allowedAction(action) {
+			delete(o, k)
+		}
+	}
+	switch o["Subtype"] {
+	case pdf.Name("Image"):
+		delete(o, "Interpolate")
+		delete(o, "Alternates")
+		delete(o, "OPI")
+	case pdf.Name("Form"):
+		delete(o, "OPI")
+		delete(o, "Ref")
+	}
+	if o["Type"] == pdf.Name("ExtGState") {
+		delete(o, "TR")
+		if o["TR2"] != pdf.Name("Default") {
+			delete(o, "TR2")
+		}
+	}
+}
+
+func allowedAction(action pdf.Dict) bool {
+	s, _ := action["S"].(pdf.Name)
+	if forbiddenActions[s] {
+		return false
+	}
+	if s == "Named" {
+		n, _ := action["N"].(pdf.Name)
+		return namedActions[n]
+	}
+	return true
+}
+
+func hasPDFAIntent(doc *document, root pdf.Dict) bool {
+	intents, _ := doc.resolve(root["OutputIntents"]).(pdf.Array)
+	for _, o := range intents {
+		intent, _ := doc.resolve(o).(pdf.Dict)
+		if _, ok := doc.resolve(intent["DestOutputProfile"]).(pdf.Stream); ok && intent["S"] == pdf.Name("GTS_PDFA1") {
+			return true
+		}
+	}
+	return false
+}
+
+// CheckPDFA returns the violations of PDF/A-2b or PDF/A-3b in the PDF b.
+// It checks the requirements of the file structure, fonts, colour,
+// annotations, actions and metadata, it does not validate font programs or
+// ICC profiles.
+func CheckPDFA(b []byte, level string) []Violation {
+	part, err := pdfaPart(level)
+	if err != nil {
+		return []Violation{{"6.6.4", err.Error()}}
+	}
+	c := &pdfaCheck{seen: map[Violation]bool{}}
+	if !bytes.HasPrefix(b, []byte("%PDF-1.")) {
+		c.add("6.1.2", "file header must be %PDF-1.n")
+	}
+	if end := bytes.IndexByte(b, '\n'); end < 0 || len(b) < end+6 || b[end+1] != '%' || b[end+2] < 128 || b[end+3] < 128 || b[end+4] < 128 || b[end+5] < 128 {
+		c.add("6.1.2", "file header must be followed by a comment of four binary bytes")
+	}
+
+	r, err := pdf.NewReader(b)
+	if errors.Is(err, pdf.ErrEncrypted) {
+		c.add("6.1.3", "document is encrypted")
+		return c.violations
+	}
+	if err != nil {
+		c.add("6.1.3", "file can not be read: "+err.Error())
+		return c.violations
+	}
+	if _, ok := r.Trailer()["ID"]; !ok {
+		c.add("6.1.3", "file trailer has no ID")
+	}
+	doc, err := open(b)
+	if err != nil {
+		c.add("6.1.3", "file can not be read: "+err.Error())
+		return c.violations
+	}
+	c.doc, c.part = doc, part
+	root, _ := doc.resolve(doc.root).(pdf.Dict)
+
+	c.metadata(root)
+	c.intent(root)
+	if _, ok := root["AA"]; ok {
+		c.add("6.5.2", "catalog has additional actions")
+	}
+	if names, ok := doc.resolve(root["Names"]).(pdf.Dict); ok {
+		if _, ok := names["JavaScript"]; ok {
+			c.add("6.5.1", "document has JavaScript")
+		}
+	}
+	if form, ok := doc.resolve(root["AcroForm"]).(pdf.Dict); ok {
+		if form["NeedAppearances"] == pdf.Boolean(true) {
+			c.add("6.4.1", "form fields need appearances generated by the reader")
+		}
+		if _, ok := form["XFA"]; ok {
+			c.add("6.4.2", "form is an XFA form")
+		}
+	}
+
+	for i := 1; i <= doc.w.Len(); i++ {
+		switch o := doc.w.Get(pdf.Ref{Number: i}).(type) {
+		case pdf.Dict:
+			c.walk(o)
+		case pdf.Stream:
+			c.walk(o.Dict)
+			c.stream(o)
+		}
+	}
+	for n, ref := range doc.pages {
+		page := doc.w.Get(ref).(pdf.Dict)
+		if _, ok := page["AA"]; ok {
+			c.add("6.5.2", fmt.Sprintf("page %d has additional actions", n+1))
+		}
+		c.annotations(page, n+1)
+		switch contents := doc.resolve(page["Contents"]).(type) {
+		case pdf.Stream:
+			c.content(contents)
+		case pdf.Array:
+			for _, s := range contents {
+				if s, ok := doc.resolve(s).(pdf.Stream); ok {
+					c.content(s)
+				}
+			}
+		}
+	}
+	c.colours()
+	return c.violations
+}
+
+// pdfaCheck collects violations, each is reported once.
+type pdfaCheck struct {
+	doc        *document
+	part       int
+	violations []Violation
+	seen       map[Violation]bool
+	// components of the output intent profile, 0 without an intent
+	intentComponents int
+	// device colour spaces used by images and content
+	deviceRGB, deviceCMYK bool
+}
+
+func (c *pdfaCheck) add(clause, message string) {
+	v := Violation{Clause: clause, Message: message}
+	if c.seen[v] {
+		return
+	}
+	c.seen[v] = true
+	c.violations = append(c.violations, v)
+}
+
+func (c *pdfaCheck) metadata(root pdf.Dict) {
+	s, ok := c.doc.resolve(root["Metadata"]).(pdf.Stream)
+	if !ok {
+		c.add("6.6.2.1", "catalog has no XMP metadata")
+		return
+	}
+	if _, ok := s.Dict["Filter"]; ok {
+		c.add("6.6.2.1", "metadata stream is compressed")
+		return
+	}
+	part := fmt.Sprintf("%d", c.part)
+	if !bytes.Contains(s.Data, []byte("<pdfaid:part>"+part+"</pdfaid:part>")) && !bytes.Contains(s.Data, []byte(`pdfaid:part="`+part+`"`)) {
+		c.add("6.6.4", "metadata does not identify the document as PDF/A-"+part)
+	}
+	if !bytes.Contains(s.Data, []byte("<pdfaid:conformance>B</pdfaid:conformance>")) && !bytes.Contains(s.Data, []byte(`pdfaid:conformance="B"`)) {
+		c.add("6.6.4", "metadata does not state conformance level B")
+	}
+}
+
+func (c *pdfaCheck) intent(root pdf.Dict) {
+	intents, _ := c.doc.resolve(root["OutputIntents"]).(pdf.Array)
+	var profile *pdf.Ref
+	for _, o := range intents {
+		intent, _ := c.doc.resolve(o).(pdf.Dict)
+		if intent["S"] != pdf.Name("GTS_PDFA1") {
+			continue
+		}
+		// profiles are streams, so always indirect
+		ref, _ := intent["DestOutputProfile"].(pdf.Ref)
+		s, ok := c.doc.w.Get(ref).(pdf.Stream)
+		if !ok {
+			continue
+		}
+		if profile != nil && *profile != ref {
+			c.add("6.2.2", "output intents have different profiles")
+		}
+		profile = &ref
+		n, _ := c.doc.resolve(s.Dict["N"]).(pdf.Integer)
+		c.intentComponents = int(n)
+	}
+}
+
+// walk checks o and the dictionaries written directly into it.
+func (c *pdfaCheck) walk(o pdf.Object) {
+	switch o := o.(type) {
+	case pdf.Dict:
+		c.object(o)
+		for _, v := range o {
+			c.walk(v)
+		}
+	case pdf.Array:
+		for _, v := range o {
+			c.walk(v)
+		}
+	}
+}
+
+// object checks a dictionary of any kind by the keys that identify it.
+func (c *pdfaCheck) object(o pdf.Dict) {
+	for _, k := range []pdf.Name{"A", "OpenAction", "Next"} {
+		if action, ok := c.doc.resolve(o[k]).(pdf.Dict); ok && !allowedAction(action) {
+			c.add("6.5.1", fmt.Sprintf("%s action is not allowed", pdf.Format(action["S"])))
+		}
+	}
+	if _, ok := o["AA"]; ok && o["Subtype"] == pdf.Name("Widget") {
+		c.add("6.5.2", "form field has additional actions")
+	}
+
+	switch o["Type"] {
+	case pdf.Name("Font"):
+		c.font(o)
+	case pdf.Name("ExtGState"):
+		if _, ok := o["TR"]; ok {
+			c.add("6.2.5", "graphics state has a transfer function")
+		}
+		if tr2, ok := o["TR2"]; ok && tr2 != pdf.Name("Default") {
+			c.add("6.2.5", "graphics state has a transfer function")
+		}
+	case pdf.Name("Filespec"):
+		c.fileSpec(o)
+	}
+
+	switch o["Subtype"] {
+	case pdf.Name("Image"):
+		if o["Interpolate"] == pdf.Boolean(true) {
+			c.add("6.2.8", "image is interpolated")
+		}
+		if _, ok := o["Alternates"]; ok {
+			c.add("6.2.8", "image has alternates")
+		}
+		if _, ok := o["OPI"]; ok {
+			c.add("6.2.8", "image has OPI")
+		}
+		c.colourSpace(o["ColorSpace"])
+	case pdf.Name("Form"):
+		if _, ok := o["Ref"]; ok {
+			c.add("6.2.9", "form refers to another file")
+		}
+		if _, ok := o["OPI"]; ok {
+			c.add("6.2.9", "form has OPI")
+		}
+		if o["Subtype2"] == pdf.Name("PS") {
+			c.add("6.2.9", "PostScript form")
+		}
+	case pdf.Name("PS"):
+		c.add("6.2.9", "PostScript XObject")
+	}
+
+	if res, ok := c.doc.resolve(o["Resources"]).(pdf.Dict); ok {
+		if spaces, ok := c.doc.resolve(res["ColorSpace"]).(pdf.Dict); ok {
+			for _, cs := range spaces {
+				c.colourSpace(cs)
+			}
+		}
+	}
+}
+
+func (c *pdfaCheck) font(o pdf.Dict) {
+	name, _ := o["BaseFont"].(pdf.Name)
+	switch o["Subtype"] {
+	case pdf.Name("Type3"):
+		return
+	case pdf.Name("Type0"):
+		// the descendant font is checked on its own
+		return
+	}
+	desc, ok := c.doc.resolve(o["FontDescriptor"]).(pdf.Dict)
+	embedded := false
+	if ok {
+		for _, k := range []pdf.Name{"FontFile", "FontFile2", "FontFile3"} {
+			if _, ok := c.doc.resolve(desc[k]).(pdf.Stream); ok {
+				embedded = true
+			}
+		}
+	}
+	if !embedded {
+		c.add("6.2.11.4.1", fmt.Sprintf("font %s is not embedded", name))
+		return
+	}
+	if o["Subtype"] == pdf.Name("CIDFontType2") {
+		if _, ok := o["CIDToGIDMap"]; !ok {
+			c.add("6.2.11.3.2", fmt.Sprintf("font %s has no CIDToGIDMap", name))
+		}
+	}
+}
+
+func (c *pdfaCheck) fileSpec(o pdf.Dict) {
+	if _, ok := o["EF"]; !ok {
+		return
+	}
+	name := pdf.DecodeText(c.doc.resolve(o["UF"]))
+	if name == "" {
+		name = pdf.DecodeText(c.doc.resolve(o["F"]))
+	}
+	if c.part == 2 {
+		c.add("6.8", fmt.Sprintf("embedded file %s needs PDF/A-3", name))
+		return
+	}
+	if _, ok := o["AFRelationship"]; !ok {
+		c.add("6.8", fmt.Sprintf("embedded file %s has no AFRelationship", name))
+	}
+}
+
+func (c *pdfaCheck) stream(s pdf.Stream) {
+	for _, k := range []pdf.Name{"F", "FFilter", "FDecodeParms"} {
+		if _, ok := s.Dict[k]; ok {
+			c.add("6.1.7.1", "stream refers to an external file")
+		}
+	}
+	if strings.Contains(pdf.Format(c.doc.resolve(s.Dict["Filter"])), "LZWDecode") {
+		c.add("6.1.7.2", "stream is LZW compressed")
+	}
+	if s.Dict["Subtype"] == pdf.Name("Form") || s.Dict["PatternType"] == pdf.Integer(1) {
+		c.content(s)
+	}
+}
+
+func (c *pdfaCheck) annotations(page pdf.Dict, n int) {
+	annots, _ := c.doc.resolve(page["Annots"]).(pdf.Array)
+	for _, a := range annots {
+		annot, ok := c.doc.resolve(a).(pdf.Dict)
+		if !ok {
+			continue
+		}
+		subtype, _ := annot["Subtype"].(pdf.Name)
+		if forbiddenAnnotations[subtype] {
+			c.add("6.3.1", fmt.Sprintf("%s annotation on page %d is not allowed", subtype, n))
+			continue
+		}
+		if subtype == "Popup" {
+			continue
+		}
+		flags, _ := c.doc.resolve(annot["F"]).(pdf.Integer)
+		if flags&annotPrint == 0 || flags&(annotInvisible|annotHidden|annotNoView|annotToggleNoView) != 0 {
+			c.add("6.3.2", fmt.Sprintf("%s annotation on page %d is hidden or not printed", subtype, n))
+		}
+		ap, hasAP := c.doc.resolve(annot["AP"]).(pdf.Dict)
+		if hasAP && len(ap) != 1 {
+			c.add("6.3.3", fmt.Sprintf("%s annotation on page %d has appearances besides the normal one", subtype, n))
+		}
+		if !hasAP && subtype != "Link" && !emptyRect(c.doc, annot["Rect"]) {
+			c.add("6.3.3", fmt.Sprintf("%s annotation on page %d has no appearance", subtype, n))
+		}
+	}
+}
+
+func emptyRect(doc *document, o pdf.Object) bool {
+	a, _ := doc.resolve(o).(pdf.Array)
+	if len(a) != 4 {
+		return true
+	}
+	var v [4]float64
+	for i, n := range a {
+		switch n := doc.resolve(n).(type) {
+		case pdf.Integer:
+			v[i] = float64(n)
+		case pdf.Real:
+			v[i] = float64(n)
+		}
+	}
+	return v[0] == v[2] && v[1] == v[3]
+}
+
+func (c *pdfaCheck) colourSpace(o pdf.Object) {
+	switch cs := c.doc.resolve(o).(type) {
+	case pdf.Name:
+		c.deviceColour(string(cs))
+	case pdf.Array:
+		// alternate and base spaces of Indexed, Separation and DeviceN
+		for _, v := range cs {
+			if n, ok := c.doc.resolve(v).(pdf.Name); ok {
+				c.deviceColour(string(n))
+			}
+		}
+	}
+}
+
+func (c *pdfaCheck) deviceColour(name string) {
+	switch name {
+	case "DeviceRGB", "RGB":
+		c.deviceRGB = true
+	case "DeviceCMYK", "CMYK":
+		c.deviceCMYK = true
+	}
+}
+
+// content records the device colours set by the operators of a content
+// stream.
+func (c *pdfaCheck) content(s pdf.Stream) {
+	data, err := pdf.DecodeStream(s)
+	if err != nil {
+		return
+	}
+	scanContent(data, func(op string, operands []string) {
+		switch op {
+		case "rg", "RG":
+			c.deviceRGB = true
+		case "k", "K":
+			c.deviceCMYK = true
+		case "cs", "CS":
+			if len(operands) > 0 {
+				c.deviceColour(strings.TrimPrefix(operands[len(operands)-1], "/"))
+			}
+		}
+	})
+}
+
+// colours checks the device colours against the output intent, device
+// colours are only defined by an output intent of the same kind.
+func (c *pdfaCheck) colours() {
+	switch {
+	case c.intentComponents == 0 && (c.deviceRGB || c.deviceCMYK):
+		c.add("6.2.2", "device colours are used without an output intent")
+	case c.intentComponents != 0 && c.intentComponents != 3 && c.deviceRGB:
+		c.add("6.2.4.3", "DeviceRGB is used with an output intent that is not RGB")
+	case c.intentComponents != 0 && c.intentComponents != 4 && c.deviceCMYK:
+		c.add("6.2.4.3", "DeviceCMYK is used with an output intent that is not CMYK")
+	}
+	if c.intentComponents == 0 {
+		c.add("6.2.2", "document has no PDF/A output intent")
+	}
+	sort.SliceStable(c.violations, func(i, j int) bool { return c.violations[i].Clause < c.violations[j].Clause })
+}
@@ -0,0 +1,258 @@
+package pdfops
+
+import (
+	"bytes"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"github.com/rengas/pdfgen/pkg/pdf"
+	"image"
+	"image/png"
+	"io"
+	"strings"
+	"testing"
+	"time"
+)
+
+// handmade returns a one page PDF with an embedded font and the content,
+// catalog adds entries to the catalog and annot is put on the page.
+func handmade(t *testing.T, content string, catalog func(w *pdf.Writer) pdf.Dict, annot pdf.Dict) []byte {
+	w := pdf.NewWriter()
+	fontFile, err := pdf.Deflate(pdf.Dict{}, []byte("not a real font program"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	font := w.Add(pdf.Dict{
+		"Type":     pdf.Name("Font"),
+		"Subtype":  pdf.Name("TrueType"),
+		"BaseFont": pdf.Name("Inter"),
+		"FontDescriptor": w.Add(pdf.Dict{
+			"Type":      pdf.Name("FontDescriptor"),
+			"FontName":  pdf.Name("Inter"),
+			"FontFile2": w.Add(fontFile),
+		}),
+	})
+	image := w.Add(pdf.Stream{Dict: pdf.Dict{
+		"Type": pdf.Name("XObject"), "Subtype": pdf.Name("Image"), "Width": pdf.Integer(1), "Height": pdf.Integer(1),
+		"ColorSpace": pdf.Name("DeviceRGB"), "BitsPerComponent": pdf.Integer(8), "Interpolate": pdf.Boolean(true),
+	}, Data: []byte{255, 0, 0}})
+
+	pages := w.Reserve()
+	page := pdf.Dict{
+		"Type":      pdf.Name("Page"),
+		"Parent":    pages,
+		"MediaBox":  pdf.Array{pdf.Integer(0), pdf.Integer(0), pdf.Integer(595), pdf.Integer(842)},
+		"Resources": pdf.Dict{"Font": pdf.Dict{"F1": font}, "XObject": pdf.Dict{"Im1": image}},
+		"Contents":  w.Add(pdf.Stream{Dict: pdf.Dict{}, Data: []byte(content)}),
+	}
+	if annot != nil {
+		page["Annots"] = pdf.Array{w.Add(annot)}
+	}
+	w.Set(pages, pdf.Dict{"Type": pdf.Name("Pages"), "Kids": pdf.Array{w.Add(page)}, "Count": pdf.Integer(1)})
+	root := pdf.Dict{}
+	if catalog != nil {
+		root = catalog(w)
+	}
+	root["Type"] = pdf.Name("Catalog")
+	root["Pages"] = pages
+
+	b, err := w.Bytes("1.4", pdf.Dict{
+		"Root": w.Add(root),
+		"Info": w.Add(pdf.Dict{"Title": pdf.Text("Invoice 7"), "CreationDate": pdf.String("D:20240102030405+01'00'")}),
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return b
+}
+
+func TestPDFA(t *testing.T) {
+	appearance := pdf.Stream{Dict: pdf.Dict{
+		"Type": pdf.Name("XObject"), "Subtype": pdf.Name("Form"),
+		"BBox": pdf.Array{pdf.Integer(0), pdf.Integer(0), pdf.Integer(10), pdf.Integer(10)},
+	}, Data: []byte("0 0 10 10 re S")}
+	b := handmade(t, "BT /F1 12 Tf 1 0 0 rg (total) Tj ET q 10 0 0 10 0 0 cm /Im1 Do Q",
+		func(w *pdf.Writer) pdf.Dict {
+			return pdf.Dict{"OpenAction": pdf.Dict{"S": pdf.Name("JavaScript"), "JS": pdf.String("app.alert(1)")}}
+		},
+		pdf.Dict{
+			"Type": pdf.Name("Annot"), "Subtype": pdf.Name("Square"), "F": pdf.Integer(annotHidden),
+			"Rect": pdf.Array{pdf.Integer(0), pdf.Integer(0), pdf.Integer(10), pdf.Integer(10)},
+			"AP":   pdf.Dict{"N": appearance, "D": appearance},
+		})
+	if v := CheckPDFA(b, PDFA2B); len(v) == 0 {
+		t.Fatalf("expected: %v, got: %v", "violations before conversion", v)
+	}
+
+	at := time.Date(2024, 5, 6, 7, 8, 9, 0, time.UTC)
+	for _, level := range []string{PDFA2B, PDFA3B} {
+		out, err := PDFA(b, level, at)
+		if err != nil {
+			t.Fatalf("%s: unexpected error: %v", level, err)
+		}
+		if v := CheckPDFA(out, level); len(v) != 0 {
+			t.Fatalf("%s: expected: %v, got: %v", level, "no violations", v)
+		}
+
+		r, err := pdf.NewReader(out)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if r.Version() != "1.7" {
+			t.Fatalf("%s: expected: %v, got: %v", level, "1.7", r.Version())
+		}
+		root, err := r.Catalog()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, ok := root["OpenAction"]; ok {
+			t.Fatalf("%s: expected: %v, got: %v", level, "no open action", pdf.Format(root["OpenAction"]))
+		}
+		o, err := r.Resolve(root["Metadata"])
+		if err != nil {
+			t.Fatal(err)
+		}
+		meta := o.(pdf.Stream).Data
+		if err := xmlWellFormed(meta); err != nil {
+			t.Fatalf("%s: expected: %v, got: %v", level, "well formed metadata", err)
+		}
+		for _, want := range []string{
+			"<pdfaid:part>" + level[:1] + "</pdfaid:part>",
+			"<rdf:li xml:lang=\"x-default\">Invoice 7</rdf:li>",
+			"<xmp:CreateDate>2024-01-02T02:04:05Z</xmp:CreateDate>",
+			"<xmp:ModifyDate>2024-05-06T07:08:09Z</xmp:ModifyDate>",
+		} {
+			if !bytes.Contains(meta, []byte(want)) {
+				t.Fatalf("%s: expected: %v, got: %s", level, want, meta)
+			}
+		}
+		info, err := r.Dict(r.Trailer()["Info"])
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got := pdf.DecodeText(info["CreationDate"]); got != "D:20240102020405Z" {
+			t.Fatalf("%s: expected: %v, got: %v", level, "D:20240102020405Z", got)
+		}
+
+		pages, err := r.Pages()
+		if err != nil {
+			t.Fatal(err)
+		}
+		annots, _ := pages[0].Dict["Annots"].(pdf.Array)
+		annot, err := r.Dict(annots[0])
+		if err != nil {
+			t.Fatal(err)
+		}
+		if annot["F"] != pdf.Integer(annotPrint) {
+			t.Fatalf("%s: expected: %v, got: %v", level, annotPrint, annot["F"])
+		}
+	}
+}
+
+func TestPDFAViolations(t *testing.T) {
+	attachment := func(w *pdf.Writer) pdf.Dict {
+		file := w.Add(pdf.Stream{Dict: pdf.Dict{"Type": pdf.Name("EmbeddedFile")}, Data: []byte("<xml/>")})
+		return pdf.Dict{"AF": pdf.Array{pdf.Dict{
+			"Type": pdf.Name("Filespec"), "F": pdf.String("factur-x.xml"), "UF": pdf.String("factur-x.xml"),
+			"EF": pdf.Dict{"F": file},
+		}}}
+	}
+	tests := []struct {
+		name  string
+		level string
+		in    []byte
+		want  string
+	}{
+		{name: "fonts not embedded", level: PDFA2B, in: render(t, "<p>invoice</p>"), want: "6.2.11.4.1"},
+		{name: "cmyk on an srgb intent", level: PDFA2B, in: handmade(t, "0 0 0 1 k 0 0 10 10 re f", nil, nil), want: "6.2.4.3"},
+		{name: "embedded file", level: PDFA2B, in: handmade(t, "", attachment, nil), want: "6.8"},
+		{name: "embedded file without relationship", level: PDFA3B, in: handmade(t, "", attachment, nil), want: "6.8"},
+		{name: "encrypted", level: PDFA2B, in: mustEncrypt(t, render(t, "<p>invoice</p>")), want: "6.1.3"},
+	}
+
+	for _, tc := range tests {
+		_, err := PDFA(tc.in, tc.level, time.Now())
+		var ce *ConformanceError
+		if !errors.As(err, &ce) {
+			t.Fatalf("%s: expected: %v, got: %v", tc.name, "conformance error", err)
+		}
+		found := false
+		for _, v := range ce.Violations {
+			found = found || v.Clause == tc.want
+		}
+		if !found {
+			t.Fatalf("%s: expected: %v, got: %v", tc.name, tc.want, ce)
+		}
+	}
+
+	if _, err := PDFA(render(t, "<p>invoice</p>"), "1a", time.Now()); err != ErrPDFALevel {
+		t.Fatalf("expected: %v, got: %v", ErrPDFALevel, err)
+	}
+}
+
+func mustEncrypt(t *testing.T, b []byte) []byte {
+	b, err := Encrypt(b, Encryption{UserPassword: "secret"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return b
+}
+
+func TestScanContent(t *testing.T) {
+	var got []string
+	scanContent([]byte("q /CS0 cs (a\\) so) Tj [(x) 2 (y)] TJ % 0 0 0 1 k\nBI /W 1 ID \x00EI\x01 EI 1 g <</MCID 0>> BDC Q"), func(op string, operands []string) {
+		got = append(got, op)
+		if op == "cs" && (len(operands) != 1 || operands[0] != "/CS0") {
+			t.Fatalf("expected: %v, got: %v", "/CS0", operands)
+		}
+	})
+	want := "q cs Tj TJ g BDC Q"
+	if s := fmt.Sprint(got); s != "["+want+"]" {
+		t.Fatalf("expected: %v, got: %v", want, got)
+	}
+}
+
+func xmlWellFormed(b []byte) error {
+	d := xml.NewDecoder(bytes.NewReader(b))
+	for {
+		_, err := d.Token()
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+	}
+}
+
+// Text watermarks draw Helvetica, which is not embedded, images are fine.
+func TestPDFAWatermarks(t *testing.T) {
+	var logo bytes.Buffer
+	if err := png.Encode(&logo, image.NewNRGBA(image.Rect(0, 0, 40, 20))); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name    string
+		mark    Watermark
+		wantErr bool
+	}{
+		{name: "draft", mark: DraftWatermark, wantErr: true},
+		{name: "image", mark: Watermark{Image: logo.Bytes()}},
+	}
+
+	for _, tc := range tests {
+		b, err := Stamp(handmade(t, "BT /F1 12 Tf (total) Tj ET", nil, nil), tc.mark)
+		if err != nil {
+			t.Fatal(err)
+		}
+		_, err = PDFA(b, PDFA2B, time.Now())
+		var ce *ConformanceError
+		if errors.As(err, &ce) != tc.wantErr {
+			t.Fatalf("%s: expected conformance error: %v, got: %v", tc.name, tc.wantErr, err)
+		}
+		if tc.wantErr && !strings.Contains(ce.Error(), "Helvetica-Bold is not embedded") {
+			t.Fatalf("%s: expected: %v, got: %v", tc.name, "Helvetica-Bold is not embedded", ce)
+		}
+	}
+}
@@ -0,0 +1,239 @@
+package pdfops
+
+import (
+	"bytes"
+	"crypto"
+	"crypto/x509"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"github.com/rengas/pdfgen/pkg/pdf"
+	"math"
+	"strings"
+	"time"
+)
+
+var (
+	ErrSignatureBox         = errors.New("signature box needs a positive width and height")
+	ErrSignaturePage        = errors.New("signature page out of range")
+	ErrSignatureKey         = errors.New("signing key must be rsa or ecdsa")
+	ErrSignatureCertificate = errors.New("signing certificate is missing")
+)
+
+const (
+	// byteRangePlaceholder keeps room for the offsets of the byte range,
+	// they are known once the file is written.
+	byteRangePlaceholder = 9999999999
+	// signatureReserve is the room for the CMS besides the certificates.
+	signatureReserve = 4096
+)
+
+// Signature describes a PAdES signature of a document.
+type Signature struct {
+	// Name of the signer, the common name of the certificate when empty.
+	Name     string `json:"name,omitempty" example:"Acme Ltd"`
+	Reason   string `json:"reason,omitempty" example:"Invoice issued"`
+	Location string `json:"location,omitempty" example:"Berlin"`
+	// Box shows the signature on a page, it is invisible without a box.
+	Box *SignatureBox `json:"box,omitempty"`
+}
+
+// SignatureBox places a visible signature, X and Y are the lower left
+// corner in points from the lower left corner of the page.
+type SignatureBox struct {
+	// Page starting at 1, the last page when 0.
+	Page   int     `json:"page,omitempty"`
+	X      float64 `json:"x"`
+	Y      float64 `json:"y"`
+	Width  float64 `json:"width" example:"200"`
+	Height float64 `json:"height" example:"50"`
+}
+
+func (s Signature) Validate() error {
+	if s.Box == nil {
+		return nil
+	}
+	if s.Box.Page < 0 {
+		return ErrSignaturePage
+	}
+	if s.Box.Width <= 0 || s.Box.Height <= 0 {
+		return ErrSignatureBox
+	}
+	return nil
+}
+
+// Sign adds a PAdES-B-B signature to the PDF b with the key and its
+// certificate chain. The CMS is detached and covers the whole file except
+// the signature itself, at is the signing time of the signature dictionary.
+// Encrypted files can not be signed.
+func Sign(b []byte, key crypto.Signer, chain []*x509.Certificate, s Signature, at time.Time) ([]byte, error) {
+	if err := s.Validate(); err != nil {
+		return nil, err
+	}
+	if len(chain) == 0 {
+		return nil, ErrSignatureCertificate
+	}
+	doc, err := open(b)
+	if err != nil {
+		return nil, err
+	}
+	if len(doc.pages) == 0 {
+		return nil, ErrSignaturePage
+	}
+	if s.Name == "" {
+		s.Name = chain[0].Subject.CommonName
+	}
+
+	size := signatureReserve
+	for _, c := range chain {
+		size += len(c.Raw)
+	}
+	sig := pdf.Dict{
+		"Type":      pdf.Name("Sig"),
+		"Filter":    pdf.Name("Adobe.PPKLite"),
+		"SubFilter": pdf.Name("ETSI.CAdES.detached"),
+		"ByteRange": pdf.Array{pdf.Integer(0), pdf.Integer(byteRangePlaceholder), pdf.Integer(byteRangePlaceholder), pdf.Integer(byteRangePlaceholder)},
+		"Contents":  pdf.HexString(make([]byte, size)),
+		"M":         pdf.Date(at),
+	}
+	for k, v := range map[pdf.Name]string{"Name": s.Name, "Reason": s.Reason, "Location": s.Location} {
+		if v != "" {
+			sig[k] = pdf.Text(v)
+		}
+	}
+
+	pageRef := doc.pages[0]
+	widget := pdf.Dict{
+		"Type":    pdf.Name("Annot"),
+		"Subtype": pdf.Name("Widget"),
+		"FT":      pdf.Name("Sig"),
+		"V":       doc.w.Add(sig),
+		// printed and locked
+		"F":    pdf.Integer(132),
+		"Rect": pdf.Array{pdf.Integer(0), pdf.Integer(0), pdf.Integer(0), pdf.Integer(0)},
+	}
+	if s.Box != nil {
+		n := s.Box.Page
+		if n == 0 {
+			n = len(doc.pages)
+		}
+		if n > len(doc.pages) {
+			return nil, ErrSignaturePage
+		}
+		pageRef = doc.pages[n-1]
+		box := doc.box(doc.w.Get(pageRef).(pdf.Dict))
+		x, y := box[0]+s.Box.X, box[1]+s.Box.Y
+		widget["Rect"] = pdf.Array{pdf.Real(x), pdf.Real(y), pdf.Real(x + s.Box.Width), pdf.Real(y + s.Box.Height)}
+		ap, err := appearance(doc, s, at)
+		if err != nil {
+			return nil, err
+		}
+		widget["AP"] = pdf.Dict{"N": ap}
+	}
+	widget["P"] = pageRef
+	page := doc.w.Get(pageRef).(pdf.Dict)
+
+	root, ok := doc.resolve(doc.root).(pdf.Dict)
+	if !ok {
+		return nil, pdf.ErrMalformed
+	}
+	form := doc.dict(root["AcroForm"])
+	fields, _ := doc.resolve(form["Fields"]).(pdf.Array)
+	widget["T"] = pdf.String(fmt.Sprintf("Signature%d", len(fields)+1))
+	ref := doc.w.Add(widget)
+	form["Fields"] = append(append(pdf.Array{}, fields...), ref)
+	form["SigFlags"] = pdf.Integer(3)
+	root["AcroForm"] = form
+
+	annots, _ := doc.resolve(page["Annots"]).(pdf.Array)
+	page["Annots"] = append(append(pdf.Array{}, annots...), ref)
+
+	// ETSI.CAdES.detached is an extension of PDF 1.7
+	if doc.version < "1.7" {
+		doc.version = "1.7"
+	}
+	ext := doc.dict(root["Extensions"])
+	ext["ESIC"] = pdf.Dict{"BaseVersion": pdf.Name("1.7"), "ExtensionLevel": pdf.Integer(2)}
+	root["Extensions"] = ext
+
+	out, err := doc.bytes()
+	if err != nil {
+		return nil, err
+	}
+	return sign(out, size, key, chain)
+}
+
+// sign fills the byte range and the signature into the written file.
+func sign(b []byte, size int, key crypto.Signer, chain []*x509.Certificate) ([]byte, error) {
+	placeholder := pdf.Format(pdf.Array{pdf.Integer(0), pdf.Integer(byteRangePlaceholder), pdf.Integer(byteRangePlaceholder), pdf.Integer(byteRangePlaceholder)})
+	r := bytes.LastIndex(b, []byte("/ByteRange "+placeholder))
+	if r < 0 {
+		return nil, pdf.ErrMalformed
+	}
+	r += len("/ByteRange ")
+	c := bytes.Index(b[r:], []byte("/Contents <"))
+	if c < 0 {
+		return nil, pdf.ErrMalformed
+	}
+	start := r + c + len("/Contents ")
+	end := start + 2*size + 2
+
+	byteRange := pdf.Format(pdf.Array{pdf.Integer(0), pdf.Integer(start), pdf.Integer(end), pdf.Integer(len(b) - end)})
+	copy(b[r:], byteRange+strings.Repeat(" ", len(placeholder)-len(byteRange)))
+
+	content := make([]byte, 0, len(b)-(end-start))
+	content = append(append(content, b[:start]...), b[end:]...)
+	cms, err := signCMS(content, key, chain)
+	if err != nil {
+		return nil, err
+	}
+	if len(cms) > size {
+		return nil, fmt.Errorf("signature of %d bytes exceeds the reserved %d bytes", len(cms), size)
+	}
+	// the rest of the placeholder stays zero
+	hex.Encode(b[start+1:], cms)
+	return b, nil
+}
+
+// appearance returns the form drawn in a visible signature box, it names
+// the signer and the signing time.
+func appearance(doc *document, s Signature, at time.Time) (pdf.Ref, error) {
+	lines := []string{"Digitally signed by " + s.Name, "Date: " + at.UTC().Format("2006-01-02 15:04:05 MST")}
+	if s.Reason != "" {
+		lines = append(lines, "Reason: "+s.Reason)
+	}
+	if s.Location != "" {
+		lines = append(lines, "Location: "+s.Location)
+	}
+
+	w, h := s.Box.Width, s.Box.Height
+	const padding, leading = 4.0, 1.2
+	size := math.Min((h-2*padding)/(float64(len(lines))*leading), 10)
+	for i, l := range lines {
+		lines[i] = pdf.WinAnsi(l)
+		if lw := pdf.Helvetica.Width(lines[i], 1); lw > 0 {
+			size = math.Min(size, (w-2*padding)/lw)
+		}
+	}
+	size = math.Max(size, 1)
+
+	num := pdf.FormatReal
+	c := strings.Builder{}
+	fmt.Fprintf(&c, "0.5 G 0.5 w 0.25 0.25 %s %s re S\n", num(w-0.5), num(h-0.5))
+	fmt.Fprintf(&c, "BT /F1 %s Tf %s TL %s %s Td\n", num(size), num(size*leading), num(padding), num(h-padding-size*pdf.Helvetica.Ascent))
+	for _, l := range lines {
+		fmt.Fprintf(&c, "%s Tj T*\n", pdf.Format(pdf.String(l)))
+	}
+	c.WriteString("ET\n")
+
+	stream, err := pdf.Deflate(pdf.Dict{
+		"Type":      pdf.Name("XObject"),
+		"Subtype":   pdf.Name("Form"),
+		"BBox":      pdf.Array{pdf.Integer(0), pdf.Integer(0), pdf.Real(w), pdf.Real(h)},
+		"Resources": pdf.Dict{"Font": pdf.Dict{"F1": doc.w.Add(pdf.Helvetica.Dict())}},
+	}, []byte(c.String()))
+	if err != nil {
+		return pdf.Ref{}, err
+	}
+	return doc.w.Add(stream), nil
+}
@@ -0,0 +1,214 @@
+package pdfops
+
+import (
+	"bytes"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/asn1"
+	"github.com/rengas/pdfgen/pkg/pdf"
+	"math/big"
+	"strings"
+	"testing"
+	"time"
+)
+
+// selfSigned returns a test certificate of the key.
+func selfSigned(t *testing.T, key crypto.Signer) *x509.Certificate {
+	tmpl := &x509.Certificate{
+		SerialNumber: big.NewInt(42),
+		Subject:      pkix.Name{CommonName: "Acme Test Signer", Organization: []string{"Acme Ltd"}},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+		KeyUsage:     x509.KeyUsageDigitalSignature | x509.KeyUsageContentCommitment,
+	}
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, tmpl, key.Public(), key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cert, err := x509.ParseCertificate(der)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return cert
+}
+
+// verifySignature checks the signature of a signed file like a reader
+// would and returns the signature dictionary.
+func verifySignature(t *testing.T, name string, b []byte, cert *x509.Certificate) pdf.Dict {
+	r, err := pdf.NewReader(b)
+	if err != nil {
+		t.Fatalf("%s: %v", name, err)
+	}
+	root, _ := r.Dict(r.Trailer()["Root"])
+	form, _ := r.Dict(root["AcroForm"])
+	fields, _ := form["Fields"].(pdf.Array)
+	if len(fields) != 1 || form["SigFlags"] != pdf.Integer(3) {
+		t.Fatalf("%s: expected: %v, got: %v", name, "one signature field", pdf.Format(form))
+	}
+	field, _ := r.Dict(fields[0])
+	sig, err := r.Dict(field["V"])
+	if err != nil || sig["SubFilter"] != pdf.Name("ETSI.CAdES.detached") {
+		t.Fatalf("%s: expected: %v, got: %v %v", name, "ETSI.CAdES.detached", pdf.Format(sig), err)
+	}
+
+	br, _ := sig["ByteRange"].(pdf.Array)
+	if len(br) != 4 {
+		t.Fatalf("%s: expected: %v, got: %v", name, "byte range", pdf.Format(sig["ByteRange"]))
+	}
+	var n [4]int
+	for i, v := range br {
+		n[i] = int(v.(pdf.Integer))
+	}
+	if n[0] != 0 || n[2]+n[3] != len(b) || b[n[1]] != '<' || b[n[2]-1] != '>' {
+		t.Fatalf("%s: expected: %v, got: %v", name, "range over the whole file but the contents", n)
+	}
+	signed := append(append([]byte{}, b[:n[1]]...), b[n[2]:]...)
+
+	var ci contentInfo
+	if _, err := asn1.Unmarshal([]byte(sig["Contents"].(pdf.HexString)), &ci); err != nil || !ci.ContentType.Equal(oidSignedData) {
+		t.Fatalf("%s: expected: %v, got: %v %v", name, "signed data", ci.ContentType, err)
+	}
+	var sd signedData
+	if _, err := asn1.Unmarshal(ci.Content.Bytes, &sd); err != nil {
+		t.Fatalf("%s: %v", name, err)
+	}
+	certs, err := x509.ParseCertificates(sd.Certificates.Bytes)
+	if err != nil || len(certs) != 1 || !certs[0].Equal(cert) {
+		t.Fatalf("%s: expected: %v, got: %v %v", name, "signing certificate", len(certs), err)
+	}
+	if len(sd.SignerInfos) != 1 {
+		t.Fatalf("%s: expected: %v, got: %v", name, 1, len(sd.SignerInfos))
+	}
+	si := sd.SignerInfos[0]
+
+	digest := sha256.Sum256(signed)
+	certHash := sha256.Sum256(cert.Raw)
+	rest := si.SignedAttrs.Bytes
+	found := map[string]bool{}
+	for len(rest) > 0 {
+		var a attribute
+		if rest, err = asn1.Unmarshal(rest, &a); err != nil {
+			t.Fatalf("%s: %v", name, err)
+		}
+		found[a.Type.String()] = true
+		switch {
+		case a.Type.Equal(oidMessageDigest):
+			var md []byte
+			asn1.Unmarshal(a.Values[0].FullBytes, &md)
+			if !bytes.Equal(md, digest[:]) {
+				t.Fatalf("%s: expected: %x, got: %x", name, digest, md)
+			}
+		case a.Type.Equal(oidSigningCertificateV2):
+			var sc signingCertificateV2
+			asn1.Unmarshal(a.Values[0].FullBytes, &sc)
+			if len(sc.Certs) != 1 || !bytes.Equal(sc.Certs[0].CertHash, certHash[:]) {
+				t.Fatalf("%s: expected: %v, got: %v", name, "hash of the signing certificate", sc)
+			}
+		}
+	}
+	for _, oid := range []asn1.ObjectIdentifier{oidContentType, oidMessageDigest, oidSigningCertificateV2} {
+		if !found[oid.String()] {
+			t.Fatalf("%s: expected: %v, got: %v", name, oid, found)
+		}
+	}
+
+	set, _ := asn1.Marshal(asn1.RawValue{Tag: asn1.TagSet, IsCompound: true, Bytes: si.SignedAttrs.Bytes})
+	alg := x509.SHA256WithRSA
+	if si.SignatureAlgorithm.Algorithm.Equal(oidECDSAWithSHA256) {
+		alg = x509.ECDSAWithSHA256
+	}
+	if err := cert.CheckSignature(alg, set, si.Signature); err != nil {
+		t.Fatalf("%s: expected: %v, got: %v", name, "valid signature", err)
+	}
+	return sig
+}
+
+func TestSign(t *testing.T) {
+	rsaKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ecKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	doc := render(t, strings.Repeat("<p>invoice line</p>", 60))
+	at := time.Date(2026, 10, 19, 9, 30, 0, 0, time.UTC)
+
+	tests := []struct {
+		name     string
+		key      crypto.Signer
+		sig      Signature
+		wantName string
+		wantLast bool
+	}{
+		{name: "invisible rsa", key: rsaKey, sig: Signature{Reason: "Invoice issued"}, wantName: "Acme Test Signer"},
+		{name: "visible ecdsa on the last page", key: ecKey, sig: Signature{Name: "Jürgen Ågren", Location: "Berlin", Box: &SignatureBox{X: 36, Y: 36, Width: 200, Height: 50}}, wantName: "Jürgen Ågren", wantLast: true},
+	}
+
+	for _, tc := range tests {
+		cert := selfSigned(t, tc.key)
+		b, err := Sign(doc, tc.key, []*x509.Certificate{cert}, tc.sig, at)
+		if err != nil {
+			t.Fatalf("%s: unexpected error: %v", tc.name, err)
+		}
+		sig := verifySignature(t, tc.name, b, cert)
+		if sig["M"] != pdf.String("D:20261019093000Z") || sig["Name"] == nil || pdf.Format(sig["Name"]) != pdf.Format(pdf.Text(tc.wantName)) {
+			t.Fatalf("%s: expected: %v, got: %v", tc.name, tc.wantName, pdf.Format(sig))
+		}
+
+		r, _ := pdf.NewReader(b)
+		pages, _ := r.Pages()
+		for i, p := range pages {
+			annots, _ := p.Dict["Annots"].(pdf.Array)
+			wantAnnots := 0
+			if (tc.wantLast && i == len(pages)-1) || (!tc.wantLast && i == 0) {
+				wantAnnots = 1
+			}
+			if len(annots) != wantAnnots {
+				t.Fatalf("%s: page %d expected: %v, got: %v", tc.name, i+1, wantAnnots, pdf.Format(annots))
+			}
+			if wantAnnots == 0 {
+				continue
+			}
+			widget, _ := r.Dict(annots[0])
+			_, visible := widget["AP"]
+			if visible != (tc.sig.Box != nil) {
+				t.Fatalf("%s: expected visible: %v, got: %v", tc.name, tc.sig.Box != nil, pdf.Format(widget))
+			}
+		}
+	}
+}
+
+func TestSignErrors(t *testing.T) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cert := selfSigned(t, key)
+	doc := render(t, "<p>invoice</p>")
+
+	tests := []struct {
+		name  string
+		chain []*x509.Certificate
+		sig   Signature
+		want  error
+	}{
+		{name: "no certificate", sig: Signature{}, want: ErrSignatureCertificate},
+		{name: "empty box", chain: []*x509.Certificate{cert}, sig: Signature{Box: &SignatureBox{Width: 100}}, want: ErrSignatureBox},
+		{name: "page out of range", chain: []*x509.Certificate{cert}, sig: Signature{Box: &SignatureBox{Page: 3, Width: 100, Height: 40}}, want: ErrSignaturePage},
+	}
+
+	for _, tc := range tests {
+		_, err := Sign(doc, key, tc.chain, tc.sig, time.Now())
+		if err != tc.want {
+			t.Fatalf("%s: expected: %v, got: %v", tc.name, tc.want, err)
+		}
+	}
+}
@@ -0,0 +1,346 @@
+package pdfops
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"github.com/rengas/pdfgen/pkg/pdf"
+	"image"
+	"math"
+	"strconv"
+	"strings"
+)
+
+// Positions of a watermark on the page.
+const (
+	PositionCenter      = "center"
+	PositionTop         = "top"
+	PositionBottom      = "bottom"
+	PositionTopLeft     = "top-left"
+	PositionTopRight    = "top-right"
+	PositionBottomLeft  = "bottom-left"
+	PositionBottomRight = "bottom-right"
+)
+
+const (
+	// DefaultOpacity applies to watermarks without opacity.
+	DefaultOpacity = 0.3
+	// watermarkMargin is the distance of watermarks from the page edges in
+	// points, except for centered ones.
+	watermarkMargin = 36
+	// maxFontSize bounds the font size chosen for text without font size.
+	maxFontSize = 144
+)
+
+var (
+	ErrWatermarkEmpty        = errors.New("watermark needs a text or an image")
+	ErrWatermarkPosition     = errors.New("invalid watermark position")
+	ErrWatermarkOpacity      = errors.New("watermark opacity must be between 0 and 1")
+	ErrWatermarkPageRange    = errors.New("invalid watermark page range")
+	ErrWatermarkColor        = errors.New("watermark color must be #rrggbb")
+	ErrWatermarkNegativeSize = errors.New("watermark sizes can not be negative")
+	ErrWatermarkImage        = errors.New("watermark image must be a png, jpeg or gif")
+)
+
+// DraftWatermark marks documents of draft designs.
+var DraftWatermark = Watermark{Text: "DRAFT", Rotation: 45, Opacity: 0.15}
+
+// Watermark is a text or an image drawn over the pages, e.g. DRAFT, PAID or
+// a logo.
+type Watermark struct {
+	Text string `json:"text,omitempty" example:"PAID"`
+	// Image is a PNG, JPEG or GIF, base64 encoded in JSON.
+	Image []byte `json:"image,omitempty"`
+	// FontSize of the text in points, by default the text spans most of the
+	// page width.
+	FontSize float64 `json:"fontSize,omitempty"`
+	// Color of the text as #rrggbb, gray by default.
+	Color string `json:"color,omitempty" example:"#cc0000"`
+	// Width of the image in points, by default its size at 96 dpi, the height
+	// keeps the aspect ratio.
+	Width float64 `json:"width,omitempty"`
+	// Opacity between 0 and 1, DefaultOpacity when 0.
+	Opacity float64 `json:"opacity,omitempty" example:"0.3"`
+	// Rotation in degrees counterclockwise around the center of the mark.
+	Rotation float64 `json:"rotation,omitempty" example:"45"`
+	Position string  `json:"position,omitempty" example:"center"`
+	// Pages like 1-3,5 or 2- for all pages from the second, all pages when
+	// empty.
+	Pages string `json:"pages,omitempty" example:"1"`
+}
+
+func (wm Watermark) Validate() error {
+	if wm.Text == "" && len(wm.Image) == 0 {
+		return ErrWatermarkEmpty
+	}
+	switch wm.Position {
+	case "", PositionCenter, PositionTop, PositionBottom, PositionTopLeft, PositionTopRight, PositionBottomLeft, PositionBottomRight:
+	default:
+		return ErrWatermarkPosition
+	}
+	if wm.Opacity < 0 || wm.Opacity > 1 {
+		return ErrWatermarkOpacity
+	}
+	if wm.FontSize < 0 || wm.Width < 0 {
+		return ErrWatermarkNegativeSize
+	}
+	if _, err := parseColor(wm.Color); err != nil {
+		return err
+	}
+	if len(wm.Image) > 0 {
+		if _, _, err := image.DecodeConfig(bytes.NewReader(wm.Image)); err != nil {
+			return ErrWatermarkImage
+		}
+	}
+	_, err := parsePages(wm.Pages)
+	return err
+}
+
+// Stamp draws the watermarks over the pages of the PDF b. Marks are placed
+// upright on pages shown rotated.
+func Stamp(b []byte, marks ...Watermark) ([]byte, error) {
+	if len(marks) == 0 {
+		return b, nil
+	}
+	for _, wm := range marks {
+		if err := wm.Validate(); err != nil {
+			return nil, err
+		}
+	}
+	doc, err := open(b)
+	if err != nil {
+		return nil, err
+	}
+
+	stamps := make([]stamp, len(marks))
+	for i, wm := range marks {
+		st := stamp{Watermark: wm}
+		st.pages, _ = parsePages(wm.Pages)
+		st.color, _ = parseColor(wm.Color)
+		opacity := wm.Opacity
+		if opacity == 0 {
+			opacity = DefaultOpacity
+		}
+		st.state = doc.w.Add(pdf.Dict{"Type": pdf.Name("ExtGState"), "ca": pdf.Real(opacity), "CA": pdf.Real(opacity)})
+		if len(wm.Image) > 0 {
+			if st.image, err = pdf.NewImage(wm.Image); err != nil {
+				return nil, ErrWatermarkImage
+			}
+			st.imageRef = st.image.Add(doc.w)
+		}
+		stamps[i] = st
+	}
+
+	// the content of a page is wrapped in q and Q so its graphics state does
+	// not leak into the marks, which are artifacts for screen readers
+	var save, font pdf.Object
+	for n, ref := range doc.pages {
+		page := doc.w.Get(ref).(pdf.Dict)
+		res := doc.dict(page["Resources"])
+		fonts, xobjects, states := doc.dict(res["Font"]), doc.dict(res["XObject"]), doc.dict(res["ExtGState"])
+
+		c := strings.Builder{}
+		c.WriteString("Q\n/Artifact BMC\n")
+		drawn := false
+		for i := range stamps {
+			st := &stamps[i]
+			if !inRanges(st.pages, n+1) {
+				continue
+			}
+			drawn = true
+
+			gs := uniqueName(states, "WmGS")
+			states[gs] = st.state
+			x, y, angle := place(st, doc.box(page), doc.rotation(page))
+			rad := angle * math.Pi / 180
+			cos, sin := math.Cos(rad), math.Sin(rad)
+			num := pdf.FormatReal
+			fmt.Fprintf(&c, "q /%s gs %s %s %s %s %s %s cm\n", gs, num(cos), num(sin), num(-sin), num(cos), num(x), num(y))
+
+			if st.image != nil {
+				name := uniqueName(xobjects, "WmIm")
+				xobjects[name] = st.imageRef
+				fmt.Fprintf(&c, "%s 0 0 %s %s %s cm /%s Do Q\n", num(st.w), num(st.h), num(-st.w/2), num(-st.h/2), name)
+				continue
+			}
+			if font == nil {
+				font = doc.w.Add(pdf.HelveticaBold.Dict())
+			}
+			name := uniqueName(fonts, "WmF")
+			fonts[name] = font
+			fmt.Fprintf(&c, "%s %s %s rg BT /%s %s Tf %s %s Td %s Tj ET Q\n",
+				num(st.color[0]), num(st.color[1]), num(st.color[2]), name, num(st.fontSize), num(-st.w/2), num(-st.h/2), pdf.Format(pdf.String(pdf.WinAnsi(st.Text))))
+		}
+		if !drawn {
+			continue
+		}
+		c.WriteString("EMC\n")
+
+		for k, d := range map[pdf.Name]pdf.Dict{"Font": fonts, "XObject": xobjects, "ExtGState": states} {
+			if len(d) > 0 {
+				res[k] = d
+			}
+		}
+		page["Resources"] = res
+
+		if save == nil {
+			save = doc.w.Add(pdf.Stream{Dict: pdf.Dict{}, Data: []byte("q\n")})
+		}
+		stream, err := pdf.Deflate(nil, []byte(c.String()))
+		if err != nil {
+			return nil, err
+		}
+		contents := pdf.Array{save}
+		switch v := doc.resolve(page["Contents"]).(type) {
+		case pdf.Array:
+			contents = append(contents, v...)
+		case pdf.Stream:
+			contents = append(contents, page["Contents"])
+		}
+		page["Contents"] = append(contents, doc.w.Add(stream))
+	}
+	return doc.bytes()
+}
+
+// stamp is a watermark prepared for drawing, w and h are the size of the
+// mark in points.
+type stamp struct {
+	Watermark
+	pages    []pageRange
+	color    [3]float64
+	state    pdf.Ref
+	image    *pdf.Image
+	imageRef pdf.Ref
+	fontSize float64
+	w, h     float64
+}
+
+// place returns the center of the mark in page coordinates and its angle.
+// Positions refer to the page as it is shown, so rotated pages swap their
+// sides.
+func place(st *stamp, box [4]float64, rotate int) (x, y, angle float64) {
+	width, height := box[2]-box[0], box[3]-box[1]
+	vw, vh := width, height
+	if rotate == 90 || rotate == 270 {
+		vw, vh = height, width
+	}
+	st.size(vw)
+
+	vx, vy := vw/2, vh/2
+	m := float64(watermarkMargin)
+	if strings.HasPrefix(st.Position, "top") {
+		vy = vh - m - st.h/2
+	}
+	if strings.HasPrefix(st.Position, "bottom") {
+		vy = m + st.h/2
+	}
+	if strings.HasSuffix(st.Position, "left") {
+		vx = m + st.w/2
+	}
+	if strings.HasSuffix(st.Position, "right") {
+		vx = vw - m - st.w/2
+	}
+
+	switch rotate {
+	case 90:
+		x, y = box[0]+width-vy, box[1]+vx
+	case 180:
+		x, y = box[2]-vx, box[3]-vy
+	case 270:
+		x, y = box[0]+vy, box[3]-vx
+	default:
+		x, y = box[0]+vx, box[1]+vy
+	}
+	return x, y, st.Rotation + float64(rotate)
+}
+
+// size sets the size of the mark for a page of the width.
+func (st *stamp) size(width float64) {
+	if st.image != nil {
+		st.w = st.Width
+		if st.w == 0 {
+			st.w = math.Min(float64(st.image.Width)*0.75, width/2)
+		}
+		st.h = st.w * float64(st.image.Height) / float64(st.image.Width)
+		return
+	}
+
+	text := pdf.WinAnsi(st.Text)
+	st.fontSize = st.FontSize
+	if st.fontSize == 0 {
+		st.fontSize = math.Min(0.7*width/pdf.HelveticaBold.Width(text, 1), maxFontSize)
+	}
+	st.w = pdf.HelveticaBold.Width(text, st.fontSize)
+	st.h = st.fontSize * pdf.HelveticaBold.Ascent
+}
+
+func uniqueName(d pdf.Dict, prefix string) pdf.Name {
+	for i := 1; ; i++ {
+		n := pdf.Name(prefix + strconv.Itoa(i))
+		if _, ok := d[n]; !ok {
+			return n
+		}
+	}
+}
+
+// pageRange is a range of page numbers starting at 1, to is 0 for ranges
+// up to the last page.
+type pageRange struct {
+	from, to int
+}
+
+func parsePages(s string) ([]pageRange, error) {
+	if strings.TrimSpace(s) == "" {
+		return nil, nil
+	}
+	var ranges []pageRange
+	for _, part := range strings.Split(s, ",") {
+		from, to, isRange := strings.Cut(strings.TrimSpace(part), "-")
+		var r pageRange
+		var err error
+		if r.from, err = strconv.Atoi(strings.TrimSpace(from)); err != nil || r.from < 1 {
+			return nil, ErrWatermarkPageRange
+		}
+		r.to = r.from
+		if isRange {
+			r.to = 0
+			if to = strings.TrimSpace(to); to != "" {
+				if r.to, err = strconv.Atoi(to); err != nil || r.to < r.from {
+					return nil, ErrWatermarkPageRange
+				}
+			}
+		}
+		ranges = append(ranges, r)
+	}
+	return ranges, nil
+}
+
+func inRanges(ranges []pageRange, page int) bool {
+	if ranges == nil {
+		return true
+	}
+	for _, r := range ranges {
+		if page >= r.from && (r.to == 0 || page <= r.to) {
+			return true
+		}
+	}
+	return false
+}
+
+func parseColor(s string) ([3]float64, error) {
+	if s == "" {
+		return [3]float64{0.5, 0.5, 0.5}, nil
+	}
+	if len(s) != 7 || s[0] != '#' {
+		return [3]float64{}, ErrWatermarkColor
+	}
+	var c [3]float64
+	for i := range c {
+		v, err := strconv.ParseUint(s[1+2*i:3+2*i], 16, 8)
+		if err != nil {
+			return [3]float64{}, ErrWatermarkColor
+		}
+		c[i] = float64(v) / 255
+	}
+	return c, nil
+}
@@ -0,0 +1,127 @@
+package pdfops
+
+import (
+	"bytes"
+	"github.com/rengas/pdfgen/pkg/pdf"
+	"image"
+	"image/png"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestStamp(t *testing.T) {
+	var logo bytes.Buffer
+	if err := png.Encode(&logo, image.NewNRGBA(image.Rect(0, 0, 40, 20))); err != nil {
+		t.Fatal(err)
+	}
+	doc := render(t, strings.Repeat("<p>line</p>", 60))
+
+	b, err := Stamp(doc,
+		Watermark{Text: "PAID", Color: "#cc0000", Pages: "2-"},
+		Watermark{Image: logo.Bytes(), Position: PositionTopRight, Opacity: 0.5},
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	r, err := pdf.NewReader(b)
+	if err != nil {
+		t.Fatal(err)
+	}
+	pages, err := r.Pages()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for i, p := range pages {
+		contents, _ := p.Dict["Contents"].(pdf.Array)
+		if len(contents) != 3 {
+			t.Fatalf("page %d: expected: %v, got: %v", i+1, "save, content and marks", pdf.Format(p.Dict["Contents"]))
+		}
+		o, err := r.Resolve(contents[2])
+		if err != nil {
+			t.Fatal(err)
+		}
+		marks, err := pdf.DecodeStream(o.(pdf.Stream))
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		wantText := i > 0
+		if got := strings.Contains(string(marks), "(PAID) Tj"); got != wantText {
+			t.Fatalf("page %d: expected text: %v, got: %s", i+1, wantText, marks)
+		}
+		if !strings.HasPrefix(string(marks), "Q\n") || !strings.Contains(string(marks), "/WmIm1 Do") {
+			t.Fatalf("page %d: expected: %v, got: %s", i+1, "image mark", marks)
+		}
+
+		res, err := r.Dict(p.Dict["Resources"])
+		if err != nil {
+			t.Fatal(err)
+		}
+		states, err := r.Dict(res["ExtGState"])
+		if err != nil {
+			t.Fatal(err)
+		}
+		wantStates := 1
+		if wantText {
+			wantStates = 2
+		}
+		if len(states) != wantStates {
+			t.Fatalf("page %d: expected: %v, got: %v", i+1, wantStates, pdf.Format(states))
+		}
+		if _, ok := res["Font"]; !ok {
+			t.Fatalf("page %d: expected: %v, got: %v", i+1, "fonts kept", pdf.Format(res))
+		}
+	}
+}
+
+func TestPlace(t *testing.T) {
+	a4 := [4]float64{0, 0, 600, 800}
+
+	tests := []struct {
+		name      string
+		position  string
+		rotate    int
+		wantX     float64
+		wantY     float64
+		wantAngle float64
+	}{
+		{name: "center", position: PositionCenter, wantX: 300, wantY: 400, wantAngle: 30},
+		{name: "bottom left", position: PositionBottomLeft, wantX: 36 + 50, wantY: 36 + 10, wantAngle: 30},
+		{name: "top of page shown rotated", position: PositionTop, rotate: 90, wantX: 36 + 10, wantY: 400, wantAngle: 120},
+		{name: "top of page shown upside down", position: PositionTop, rotate: 180, wantX: 300, wantY: 36 + 10, wantAngle: 210},
+	}
+
+	for _, tc := range tests {
+		st := &stamp{Watermark: Watermark{Position: tc.position, Rotation: 30, Width: 100}, image: &pdf.Image{Width: 10, Height: 2}}
+		x, y, angle := place(st, a4, tc.rotate)
+		if x != tc.wantX || y != tc.wantY || angle != tc.wantAngle {
+			t.Fatalf("%s: expected: %v %v %v, got: %v %v %v", tc.name, tc.wantX, tc.wantY, tc.wantAngle, x, y, angle)
+		}
+	}
+}
+
+func TestParsePages(t *testing.T) {
+	tests := []struct {
+		in      string
+		want    []pageRange
+		wantErr bool
+	}{
+		{in: ""},
+		{in: "1", want: []pageRange{{1, 1}}},
+		{in: "1-3, 5", want: []pageRange{{1, 3}, {5, 5}}},
+		{in: "2-", want: []pageRange{{2, 0}}},
+		{in: "0", wantErr: true},
+		{in: "3-2", wantErr: true},
+		{in: "a", wantErr: true},
+	}
+
+	for _, tc := range tests {
+		got, err := parsePages(tc.in)
+		if (err != nil) != tc.wantErr || !reflect.DeepEqual(got, tc.want) {
+			t.Fatalf("%q: expected: %v %v, got: %v %v", tc.in, tc.want, tc.wantErr, got, err)
+		}
+	}
+}
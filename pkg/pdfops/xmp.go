@@ -0,0 +1,86 @@
+package pdfops
+
+import (
+	"bytes"
+	"encoding/xml"
+	"fmt"
+	"strings"
+	"time"
+)
+
+// xmpMetadata is the XMP packet of a PDF/A file, its properties mirror the
+// document information dictionary as PDF/A requires.
+type xmpMetadata struct {
+	part        int
+	conformance string
+	title       string
+	author      string
+	subject     string
+	keywords    string
+	creator     string
+	producer    string
+	created     time.Time
+	modified    time.Time
+	// extra are rdf:Description elements of further schemas.
+	extra []string
+}
+
+func (m xmpMetadata) bytes() []byte {
+	var b bytes.Buffer
+	b.WriteString("<?xpacket begin=\"\ufeff\" id=\"W5M0MpCehiHzreSzNTczkc9d\"?>\n")
+	b.WriteString("<x:xmpmeta xmlns:x=\"adobe:ns:meta/\">\n")
+	b.WriteString("<rdf:RDF xmlns:rdf=\"http://www.w3.org/1999/02/22-rdf-syntax-ns#\">\n")
+
+	b.WriteString("<rdf:Description rdf:about=\"\" xmlns:pdfaid=\"http://www.aiim.org/pdfa/ns/id/\">\n")
+	fmt.Fprintf(&b, "<pdfaid:part>%d</pdfaid:part>\n<pdfaid:conformance>%s</pdfaid:conformance>\n", m.part, m.conformance)
+	b.WriteString("</rdf:Description>\n")
+
+	b.WriteString("<rdf:Description rdf:about=\"\" xmlns:dc=\"http://purl.org/dc/elements/1.1/\">\n")
+	b.WriteString("<dc:format>application/pdf</dc:format>\n")
+	if m.title != "" {
+		fmt.Fprintf(&b, "<dc:title><rdf:Alt><rdf:li xml:lang=\"x-default\">%s</rdf:li></rdf:Alt></dc:title>\n", escapeXML(m.title))
+	}
+	if m.author != "" {
+		fmt.Fprintf(&b, "<dc:creator><rdf:Seq><rdf:li>%s</rdf:li></rdf:Seq></dc:creator>\n", escapeXML(m.author))
+	}
+	if m.subject != "" {
+		fmt.Fprintf(&b, "<dc:description><rdf:Alt><rdf:li xml:lang=\"x-default\">%s</rdf:li></rdf:Alt></dc:description>\n", escapeXML(m.subject))
+	}
+	b.WriteString("</rdf:Description>\n")
+
+	b.WriteString("<rdf:Description rdf:about=\"\" xmlns:xmp=\"http://ns.adobe.com/xap/1.0/\">\n")
+	fmt.Fprintf(&b, "<xmp:CreateDate>%s</xmp:CreateDate>\n", m.created.Format(time.RFC3339))
+	fmt.Fprintf(&b, "<xmp:ModifyDate>%s</xmp:ModifyDate>\n", m.modified.Format(time.RFC3339))
+	fmt.Fprintf(&b, "<xmp:MetadataDate>%s</xmp:MetadataDate>\n", m.modified.Format(time.RFC3339))
+	if m.creator != "" {
+		fmt.Fprintf(&b, "<xmp:CreatorTool>%s</xmp:CreatorTool>\n", escapeXML(m.creator))
+	}
+	b.WriteString("</rdf:Description>\n")
+
+	b.WriteString("<rdf:Description rdf:about=\"\" xmlns:pdf=\"http://ns.adobe.com/pdf/1.3/\">\n")
+	if m.producer != "" {
+		fmt.Fprintf(&b, "<pdf:Producer>%s</pdf:Producer>\n", escapeXML(m.producer))
+	}
+	if m.keywords != "" {
+		fmt.Fprintf(&b, "<pdf:Keywords>%s</pdf:Keywords>\n", escapeXML(m.keywords))
+	}
+	b.WriteString("</rdf:Description>\n")
+
+	for _, e := range m.extra {
+		b.WriteString(e)
+		b.WriteString("\n")
+	}
+	b.WriteString("</rdf:RDF>\n</x:xmpmeta>\n")
+	// padding lets editors change the packet in place
+	for i := 0; i < 20; i++ {
+		b.WriteString(strings.Repeat(" ", 99) + "\n")
+	}
+	b.WriteString("<?xpacket end=\"w\"?>")
+	return b.Bytes()
+}
+
+func escapeXML(s string) string {
+	var b strings.Builder
+	xml.EscapeText(&b, []byte(s))
+	return b.String()
+}
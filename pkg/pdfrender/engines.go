@@ -0,0 +1,62 @@
+package pdfrender
+
+import (
+	"context"
+	"io"
+)
+
+// Engines renders with the engine named in the options, or with the
+// fallback engine when the options name none.
+type Engines struct {
+	engines  map[string]Engine
+	fallback string
+}
+
+func NewEngines(fallback string) *Engines {
+	return &Engines{
+		engines:  map[string]Engine{},
+		fallback: fallback,
+	}
+}
+
+func (e *Engines) Register(name string, engine Engine) {
+	e.engines[name] = engine
+}
+
+// Has reports whether an engine of the name is registered.
+func (e *Engines) Has(name string) bool {
+	_, ok := e.engines[name]
+	return ok
+}
+
+func (e *Engines) Render(ctx context.Context, r io.Reader, o Options) ([]byte, error) {
+	engine, err := e.engine(o)
+	if err != nil {
+		return nil, err
+	}
+	return engine.Render(ctx, r, o)
+}
+
+func (e *Engines) RenderImage(ctx context.Context, r io.Reader, o Options, img ImageOptions) ([]byte, error) {
+	engine, err := e.engine(o)
+	if err != nil {
+		return nil, err
+	}
+	ie, ok := engine.(ImageEngine)
+	if !ok {
+		return nil, ErrImageUnsupported
+	}
+	return ie.RenderImage(ctx, r, o, img)
+}
+
+func (e *Engines) engine(o Options) (Engine, error) {
+	name := o.Engine
+	if name == "" {
+		name = e.fallback
+	}
+	engine, ok := e.engines[name]
+	if !ok {
+		return nil, ErrUnknownEngine
+	}
+	return engine, nil
+}
@@ -0,0 +1,83 @@
+package pdfrender
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"strings"
+)
+
+const (
+	ImagePNG  = "png"
+	ImageJPEG = "jpeg"
+	ImageWebP = "webp"
+)
+
+const (
+	// DefaultDPI renders pages at css pixel size.
+	DefaultDPI    = 96
+	MaxImageWidth = 4000
+	MaxDPI        = 600
+)
+
+var (
+	ErrImageUnsupported  = errors.New("render engine can not render images")
+	ErrFormatUnsupported = errors.New("render engine does not support the image format")
+	ErrPageOutOfRange    = errors.New("page is out of range")
+)
+
+// ImageOptions selects a page of the document and the size and format of
+// its image. Width in pixels takes precedence over DPI.
+type ImageOptions struct {
+	Format string
+	Width  int
+	DPI    int
+	// Page is the zero based page index.
+	Page int
+	// Quality of jpeg and webp images from 1 to 100, engines choose when zero.
+	Quality int
+}
+
+// ContentType is the media type of the format.
+func (i ImageOptions) ContentType() string {
+	return "image/" + i.Format
+}
+
+// PixelWidth is the width of the image for pages of the options, at most
+// MaxImageWidth.
+func (i ImageOptions) PixelWidth(o Options) int {
+	if i.Width > 0 {
+		return i.Width
+	}
+	dpi := i.DPI
+	if dpi == 0 {
+		dpi = DefaultDPI
+	}
+	w, _ := o.Dimensions()
+	return int(math.Min(math.Round(w/25.4*float64(dpi)), MaxImageWidth))
+}
+
+// CSSPage is the size of a page in css pixels.
+func CSSPage(o Options) (float64, float64) {
+	w, h := o.Dimensions()
+	return w / 25.4 * DefaultDPI, h / 25.4 * DefaultDPI
+}
+
+// ImageEngine is an Engine that can also render a page as an image.
+type ImageEngine interface {
+	RenderImage(ctx context.Context, r io.Reader, o Options, img ImageOptions) ([]byte, error)
+}
+
+// DraftOverlay appends a DRAFT mark over the page of img to the html, the
+// image engines draw the html as is so drafts can not be stamped after
+// rendering like their pdfs. It matches pdfops.DraftWatermark.
+func DraftOverlay(r io.Reader, o Options, img ImageOptions) io.Reader {
+	cssW, cssH := CSSPage(o)
+	overlay := fmt.Sprintf(`<div style="position:absolute;left:0;top:%.2fpx;width:%.2fpx;height:%.2fpx;`+
+		`display:flex;align-items:center;justify-content:center;pointer-events:none;z-index:2147483647">`+
+		`<span style="transform:rotate(-45deg);font:bold %.2fpx Helvetica,Arial,sans-serif;color:#808080;opacity:0.15">DRAFT</span></div>`,
+		float64(img.Page)*cssH, cssW, cssH, cssW/4)
+	return io.MultiReader(r, strings.NewReader(overlay))
+}
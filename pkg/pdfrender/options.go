@@ -0,0 +1,248 @@
+package pdfrender
+
+import (
+	"database/sql/driver"
+	"encoding/json"
+	"errors"
+	"strings"
+	"text/template"
+)
+
+const (
+	EngineWkhtmltopdf = "wkhtmltopdf"
+	EngineBuiltin     = "builtin"
+	EngineChromium    = "chromium"
+)
+
+var (
+	ErrUnknownEngine   = errors.New("render engine is not available")
+	ErrUnknownPageSize = errors.New("unknown page size")
+	ErrNegativeMargin  = errors.New("margins can not be negative")
+	ErrUnknownPDFA     = errors.New("pdfa must be 2b or 3b")
+	ErrPDFAEngine      = errors.New("the builtin engine does not embed fonts as pdf/a requires")
+	ErrPDFATOC         = errors.New("the table of contents does not embed fonts as pdf/a requires")
+	ErrMetadata        = errors.New("metadata has an invalid template")
+	ErrAccessible      = errors.New("only the chromium and builtin engines tag pdfs")
+	ErrAccessibleTOC   = errors.New("the table of contents is not tagged")
+	ErrForms           = errors.New("only the builtin and wkhtmltopdf engines make form fields")
+	ErrFlattenForms    = errors.New("flattenForms needs forms")
+	ErrAccessibleForms = errors.New("form fields are not tagged")
+)
+
+// OutlineDepth is the number of heading levels, h1 to h3, in bookmarks and
+// tables of contents.
+const OutlineDepth = 3
+
+// DefaultTOCTitle heads tables of contents without title.
+const DefaultTOCTitle = "Contents"
+
+// pageSizes in millimetres, portrait.
+var pageSizes = map[string][2]float64{
+	"A3":     {297, 420},
+	"A4":     {210, 297},
+	"A5":     {148, 210},
+	"Letter": {215.9, 279.4},
+	"Legal":  {215.9, 355.6},
+}
+
+// DefaultMargin in millimetres, the margin of wkhtmltopdf.
+const DefaultMargin = 10
+
+// Options is how a design is rendered. The zero value renders A4 portrait
+// with the default margin and backgrounds on the default engine.
+type Options struct {
+	Engine    string  `json:"engine,omitempty" example:"chromium"`
+	PageSize  string  `json:"pageSize,omitempty" example:"A4"`
+	Landscape bool    `json:"landscape,omitempty"`
+	Margin    *Margin `json:"margin,omitempty"`
+	// Header and Footer are html repeated on every page, elements with the
+	// classes pageNumber, totalPages, date and title are filled in. Only the
+	// chromium engine prints them.
+	Header         string `json:"header,omitempty"`
+	Footer         string `json:"footer,omitempty"`
+	OmitBackground bool   `json:"omitBackground,omitempty"`
+	// PDFA is the PDF/A level of the output, 2b or 3b. Documents that can not
+	// be made conformant fail with the violations found.
+	PDFA string `json:"pdfa,omitempty" example:"2b"`
+	// Metadata is the document information of the pdf.
+	Metadata *Metadata `json:"metadata,omitempty"`
+	// Bookmarks adds an outline of the h1 to h3 headings.
+	Bookmarks bool `json:"bookmarks,omitempty"`
+	// TOC inserts pages before the document listing the h1 to h3 headings
+	// with their page numbers, headed by TOCTitle or DefaultTOCTitle. Its
+	// text is Helvetica, so it can not be combined with PDFA.
+	TOC      bool   `json:"toc,omitempty"`
+	TOCTitle string `json:"tocTitle,omitempty" example:"Contents"`
+	// Accessible tags the pdf for screen readers as PDF/UA asks, with the
+	// structure and reading order of the html, the alt text of images and
+	// the language of <html lang>. Only the chromium and builtin engines tag
+	// pdfs, options without engine need one of them as default engine.
+	// Watermarks are tagged as artifacts.
+	Accessible bool `json:"accessible,omitempty"`
+	// Forms makes the input, textarea and select elements fillable fields
+	// of the pdf, prefilled with their values. Only the builtin and
+	// wkhtmltopdf engines make form fields.
+	Forms bool `json:"forms,omitempty"`
+	// FlattenForms draws the values of the fields into the pages, they can
+	// no longer be changed.
+	FlattenForms bool `json:"flattenForms,omitempty"`
+	// PageOffset is added to the page numbers of the header and footer and
+	// TotalPages replaces their total when not 0, so documents merged from
+	// several renders are numbered continuously. They are not stored with
+	// designs.
+	PageOffset int `json:"-"`
+	TotalPages int `json:"-"`
+}
+
+// Metadata of a pdf. Values are templates that may read the fields of the
+// design like {{.invoice.number}}, title and author default to the name and
+// the owner of the design.
+type Metadata struct {
+	Title    string `json:"title,omitempty" example:"Invoice {{.invoice.number}}"`
+	Author   string `json:"author,omitempty" example:"Acme Billing"`
+	Subject  string `json:"subject,omitempty"`
+	Keywords string `json:"keywords,omitempty" example:"invoice, acme"`
+	Creator  string `json:"creator,omitempty"`
+}
+
+// Outline reports whether the engine should make an outline of the
+// headings, tables of contents are made from it.
+func (o Options) Outline() bool {
+	return o.Bookmarks || o.TOC
+}
+
+// Renumbered reports whether the header or footer print page numbers that
+// PageOffset or TotalPages change.
+func (o Options) Renumbered() bool {
+	if o.PageOffset == 0 && o.TotalPages == 0 {
+		return false
+	}
+	for _, t := range []string{o.Header, o.Footer} {
+		if strings.Contains(t, "pageNumber") || strings.Contains(t, "totalPages") {
+			return true
+		}
+	}
+	return false
+}
+
+// Margin in millimetres.
+type Margin struct {
+	Top    float64 `json:"top"`
+	Right  float64 `json:"right"`
+	Bottom float64 `json:"bottom"`
+	Left   float64 `json:"left"`
+}
+
+// WithDefaultEngine returns o with the engine it renders on when it names
+// none. Validate checks options without engine as wkhtmltopdf options, so
+// callers with another default engine validate the result.
+func (o Options) WithDefaultEngine(fallback string) Options {
+	if o.Engine == "" {
+		o.Engine = fallback
+	}
+	return o
+}
+
+func (o Options) Validate() error {
+	switch o.Engine {
+	case "", EngineWkhtmltopdf, EngineBuiltin, EngineChromium:
+	default:
+		return ErrUnknownEngine
+	}
+	if _, ok := o.pageSize(); !ok {
+		return ErrUnknownPageSize
+	}
+	if m := o.Margin; m != nil && (m.Top < 0 || m.Right < 0 || m.Bottom < 0 || m.Left < 0) {
+		return ErrNegativeMargin
+	}
+	switch o.PDFA {
+	case "", "2b", "3b":
+	default:
+		return ErrUnknownPDFA
+	}
+	if o.PDFA != "" && o.Engine == EngineBuiltin {
+		return ErrPDFAEngine
+	}
+	if o.PDFA != "" && o.TOC {
+		return ErrPDFATOC
+	}
+	if o.Accessible && o.Engine != EngineChromium && o.Engine != EngineBuiltin {
+		return ErrAccessible
+	}
+	if o.Accessible && o.TOC {
+		return ErrAccessibleTOC
+	}
+	if o.Forms && o.Engine == EngineChromium {
+		return ErrForms
+	}
+	if o.FlattenForms && !o.Forms {
+		return ErrFlattenForms
+	}
+	if o.Accessible && o.Forms {
+		return ErrAccessibleForms
+	}
+	if m := o.Metadata; m != nil {
+		for _, text := range []string{m.Title, m.Author, m.Subject, m.Keywords, m.Creator} {
+			if _, err := template.New("metadata").Parse(text); err != nil {
+				return ErrMetadata
+			}
+		}
+	}
+	return nil
+}
+
+// PageSizeName is the canonical name of the page size, A4 when none is set.
+func (o Options) PageSizeName() string {
+	for name := range pageSizes {
+		if strings.EqualFold(name, o.PageSize) {
+			return name
+		}
+	}
+	return "A4"
+}
+
+// Dimensions is the width and height of the page in millimetres, swapped in
+// landscape.
+func (o Options) Dimensions() (float64, float64) {
+	s, ok := o.pageSize()
+	if !ok {
+		s = pageSizes["A4"]
+	}
+	if o.Landscape {
+		return s[1], s[0]
+	}
+	return s[0], s[1]
+}
+
+func (o Options) pageSize() ([2]float64, bool) {
+	if o.PageSize == "" {
+		return pageSizes["A4"], true
+	}
+	for name, s := range pageSizes {
+		if strings.EqualFold(name, o.PageSize) {
+			return s, true
+		}
+	}
+	return [2]float64{}, false
+}
+
+// Margins returns the margin, or the default margin on every side.
+func (o Options) Margins() Margin {
+	if o.Margin == nil {
+		return Margin{Top: DefaultMargin, Right: DefaultMargin, Bottom: DefaultMargin, Left: DefaultMargin}
+	}
+	return *o.Margin
+}
+
+func (o Options) Value() (driver.Value, error) {
+	return json.Marshal(o)
+}
+
+func (o *Options) Scan(value interface{}) error {
+	b, ok := value.([]byte)
+	if !ok {
+		return errors.New("type assertion to []byte failed")
+	}
+
+	return json.Unmarshal(b, o)
+}
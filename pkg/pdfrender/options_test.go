@@ -0,0 +1,107 @@
+package pdfrender
+
+import (
+	"context"
+	"io"
+	"strings"
+	"testing"
+)
+
+func TestOptionsValidate(t *testing.T) {
+	tests := []struct {
+		name string
+		in   Options
+		want error
+	}{
+		{name: "defaults", in: Options{}},
+		{name: "page size ignores case", in: Options{Engine: EngineChromium, PageSize: "letter"}},
+		{name: "unknown engine", in: Options{Engine: "prince"}, want: ErrUnknownEngine},
+		{name: "unknown page size", in: Options{PageSize: "B5"}, want: ErrUnknownPageSize},
+		{name: "negative margin", in: Options{Margin: &Margin{Top: 10, Left: -1}}, want: ErrNegativeMargin},
+		{name: "pdfa", in: Options{Engine: EngineChromium, PDFA: "3b"}},
+		{name: "unknown pdfa", in: Options{PDFA: "1a"}, want: ErrUnknownPDFA},
+		{name: "pdfa on builtin engine", in: Options{Engine: EngineBuiltin, PDFA: "2b"}, want: ErrPDFAEngine},
+		{name: "metadata", in: Options{Metadata: &Metadata{Title: "Invoice {{.invoice.number}}"}, Bookmarks: true, TOC: true}},
+		{name: "invalid metadata", in: Options{Metadata: &Metadata{Author: "{{.owner"}}, want: ErrMetadata},
+		{name: "pdfa with toc", in: Options{Engine: EngineChromium, PDFA: "2b", TOC: true}, want: ErrPDFATOC},
+		{name: "accessible", in: Options{Engine: EngineBuiltin, Accessible: true}},
+		{name: "accessible on wkhtmltopdf", in: Options{Accessible: true}, want: ErrAccessible},
+		{name: "accessible on default builtin engine", in: Options{Accessible: true}.WithDefaultEngine(EngineBuiltin)},
+		{name: "accessible on default wkhtmltopdf engine", in: Options{Accessible: true}.WithDefaultEngine(EngineWkhtmltopdf), want: ErrAccessible},
+		{name: "engine is kept", in: Options{Engine: EngineWkhtmltopdf, Accessible: true}.WithDefaultEngine(EngineBuiltin), want: ErrAccessible},
+		{name: "accessible with toc", in: Options{Engine: EngineChromium, Accessible: true, TOC: true}, want: ErrAccessibleTOC},
+		{name: "forms", in: Options{Forms: true, FlattenForms: true}},
+		{name: "forms on chromium", in: Options{Engine: EngineChromium, Forms: true}, want: ErrForms},
+		{name: "flatten without forms", in: Options{FlattenForms: true}, want: ErrFlattenForms},
+		{name: "accessible forms", in: Options{Engine: EngineBuiltin, Accessible: true, Forms: true}, want: ErrAccessibleForms},
+	}
+
+	for _, tc := range tests {
+		if got := tc.in.Validate(); got != tc.want {
+			t.Fatalf("%s: expected: %v, got: %v", tc.name, tc.want, got)
+		}
+	}
+}
+
+func TestOptionsDimensions(t *testing.T) {
+	w, h := Options{}.Dimensions()
+	if w != 210 || h != 297 {
+		t.Fatalf("expected: 210x297, got: %vx%v", w, h)
+	}
+	w, h = Options{PageSize: "a5", Landscape: true}.Dimensions()
+	if w != 210 || h != 148 {
+		t.Fatalf("expected: 210x148, got: %vx%v", w, h)
+	}
+	if m := (Options{}).Margins(); m.Top != DefaultMargin || m.Left != DefaultMargin {
+		t.Fatalf("expected: default margin, got: %+v", m)
+	}
+}
+
+func TestOptionsRenumbered(t *testing.T) {
+	tests := []struct {
+		name string
+		in   Options
+		want bool
+	}{
+		{name: "first part", in: Options{Footer: `<span class="pageNumber"></span>`}},
+		{name: "page offset", in: Options{Footer: `<span class="pageNumber"></span>`, PageOffset: 2}, want: true},
+		{name: "total pages", in: Options{Header: `<span class="totalPages"></span>`, TotalPages: 5}, want: true},
+		{name: "no page numbers", in: Options{Footer: `<span class="title"></span>`, PageOffset: 2, TotalPages: 5}},
+	}
+
+	for _, tc := range tests {
+		if got := tc.in.Renumbered(); got != tc.want {
+			t.Fatalf("%s: expected: %v, got: %v", tc.name, tc.want, got)
+		}
+	}
+}
+
+type namedEngine string
+
+func (e namedEngine) Render(ctx context.Context, r io.Reader, o Options) ([]byte, error) {
+	return []byte(e), nil
+}
+
+func TestEngines(t *testing.T) {
+	engines := NewEngines(EngineWkhtmltopdf)
+	engines.Register(EngineWkhtmltopdf, namedEngine("wk"))
+	engines.Register(EngineBuiltin, namedEngine("go"))
+
+	tests := []struct {
+		name    string
+		engine  string
+		want    string
+		wantErr error
+	}{
+		{name: "fallback", want: "wk"},
+		{name: "named", engine: EngineBuiltin, want: "go"},
+		{name: "not registered", engine: EngineChromium, wantErr: ErrUnknownEngine},
+	}
+
+	for _, tc := range tests {
+		b, err := engines.Render(context.Background(), strings.NewReader(""), Options{Engine: tc.engine})
+		if err != tc.wantErr || string(b) != tc.want {
+			t.Fatalf("%s: expected: %v %v, got: %s %v", tc.name, tc.want, tc.wantErr, b, err)
+		}
+	}
+}
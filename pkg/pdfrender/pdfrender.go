@@ -1,10 +1,15 @@
 package pdfrender
 
 import (
+	"bytes"
+	"context"
 	"fmt"
 	"github.com/SebastiaanKlippert/go-wkhtmltopdf"
 	"io"
-	"log"
+	"math"
+	"os/exec"
+	"strconv"
+	"strings"
 )
 
 type PDFRender struct {
@@ -15,25 +20,88 @@ func NewPDFRenderer() *PDFRender {
 }
 
 func (p PDFRender) HTML(r io.Reader) ([]byte, error) {
+	return p.Render(context.Background(), r, Options{})
+}
+
+// Render converts html to pdf with wkhtmltopdf, the process is killed when
+// ctx is cancelled or its deadline passes. Headers and footers of the
+// options are not printed.
+func (p PDFRender) Render(ctx context.Context, r io.Reader, o Options) ([]byte, error) {
 	pdfg, err := wkhtmltopdf.NewPDFGenerator()
 	if err != nil {
-		log.Fatal(err)
+		return nil, err
+	}
+	pdfg.PageSize.Set(o.PageSizeName())
+	if o.Landscape {
+		pdfg.Orientation.Set(wkhtmltopdf.OrientationLandscape)
+	}
+	m := o.Margins()
+	pdfg.MarginTop.Set(uint(math.Round(m.Top)))
+	pdfg.MarginRight.Set(uint(math.Round(m.Right)))
+	pdfg.MarginBottom.Set(uint(math.Round(m.Bottom)))
+	pdfg.MarginLeft.Set(uint(math.Round(m.Left)))
+	if o.Outline() {
+		pdfg.OutlineDepth.Set(OutlineDepth)
+	} else {
+		pdfg.NoOutline.Set(true)
 	}
 
-	// Create a new input page from an URL
 	page := wkhtmltopdf.NewPageReader(r)
 	page.EnableLocalFileAccess.Set(true)
-
-	// Add to document
+	page.NoBackground.Set(o.OmitBackground)
+	page.EnableForms.Set(o.Forms)
 	pdfg.AddPage(page)
 
-	// Create PDF document in internal buffer
-	err = pdfg.Create()
+	err = pdfg.CreateContext(ctx)
 	if err != nil {
-		fmt.Println(err)
 		return nil, err
 	}
 
-	// Output: Done
 	return pdfg.Bytes(), nil
 }
+
+// RenderImage renders a page with wkhtmltoimage in png or jpeg. It does not
+// paginate, pages are cut from the rendering at the height of the page size.
+func (p PDFRender) RenderImage(ctx context.Context, r io.Reader, o Options, img ImageOptions) ([]byte, error) {
+	var format string
+	switch img.Format {
+	case ImagePNG:
+		format = "png"
+	case ImageJPEG:
+		format = "jpg"
+	default:
+		return nil, ErrFormatUnsupported
+	}
+
+	cssW, cssH := CSSPage(o)
+	width := img.PixelWidth(o)
+	zoom := float64(width) / cssW
+	pageH := int(math.Round(cssH * zoom))
+	args := []string{"--quiet", "--enable-local-file-access",
+		"--format", format,
+		"--width", strconv.Itoa(width),
+		"--zoom", strconv.FormatFloat(zoom, 'f', 4, 64),
+		"--crop-y", strconv.Itoa(img.Page * pageH),
+		"--crop-h", strconv.Itoa(pageH),
+	}
+	if img.Quality > 0 {
+		args = append(args, "--quality", strconv.Itoa(img.Quality))
+	}
+	args = append(args, "-", "-")
+
+	var out, stderr bytes.Buffer
+	cmd := exec.CommandContext(ctx, "wkhtmltoimage", args...)
+	cmd.Stdin = r
+	cmd.Stdout = &out
+	cmd.Stderr = &stderr
+	if err := cmd.Run(); err != nil {
+		if ctx.Err() != nil {
+			return nil, ctx.Err()
+		}
+		return nil, fmt.Errorf("wkhtmltoimage: %w: %s", err, strings.TrimSpace(stderr.String()))
+	}
+	if out.Len() == 0 {
+		return nil, ErrPageOutOfRange
+	}
+	return out.Bytes(), nil
+}
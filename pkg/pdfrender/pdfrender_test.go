@@ -3,10 +3,20 @@ package pdfrender
 import (
 	"bytes"
 	"os"
+	"os/exec"
 	"testing"
 )
 
+// requireWkhtmltopdf skips tests that need the wkhtmltopdf binary, so the
+// package tests pass where it is not installed.
+func requireWkhtmltopdf(t *testing.T) {
+	if _, err := exec.LookPath("wkhtmltopdf"); err != nil {
+		t.Skip("wkhtmltopdf not installed")
+	}
+}
+
 func TestRenderHTML(t *testing.T) {
+	requireWkhtmltopdf(t)
 	r := NewPDFRenderer()
 
 	str := `<!DOCTYPE html>
@@ -42,6 +52,7 @@ func TestRenderHTML(t *testing.T) {
 }
 
 func TestRenderHTMLWithImage(t *testing.T) {
+	requireWkhtmltopdf(t)
 	r := NewPDFRenderer()
 
 	str := `
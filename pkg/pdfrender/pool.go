@@ -0,0 +1,81 @@
+package pdfrender
+
+import (
+	"context"
+	"errors"
+	"io"
+	"time"
+)
+
+var ErrQueueFull = errors.New("render queue is full")
+
+type Engine interface {
+	Render(ctx context.Context, r io.Reader, o Options) ([]byte, error)
+}
+
+// Pool bounds the renders running at the same time. Up to queueDepth
+// requests wait for a free slot, further requests fail right away with
+// ErrQueueFull so load is shed instead of piling up processes.
+type Pool struct {
+	engine  Engine
+	slots   chan struct{}
+	waiting chan struct{}
+	timeout time.Duration
+}
+
+// NewPool returns a pool of maxConcurrency renders, a timeout of zero lets
+// renders run until the request context ends.
+func NewPool(engine Engine, maxConcurrency, queueDepth int, timeout time.Duration) *Pool {
+	if maxConcurrency < 1 {
+		maxConcurrency = 1
+	}
+	if queueDepth < 0 {
+		queueDepth = 0
+	}
+	return &Pool{
+		engine:  engine,
+		slots:   make(chan struct{}, maxConcurrency),
+		waiting: make(chan struct{}, maxConcurrency+queueDepth),
+		timeout: timeout,
+	}
+}
+
+func (p *Pool) Render(ctx context.Context, r io.Reader, o Options) ([]byte, error) {
+	return p.run(ctx, func(ctx context.Context) ([]byte, error) {
+		return p.engine.Render(ctx, r, o)
+	})
+}
+
+// RenderImage renders a page as an image in the same slots as pdfs.
+func (p *Pool) RenderImage(ctx context.Context, r io.Reader, o Options, img ImageOptions) ([]byte, error) {
+	ie, ok := p.engine.(ImageEngine)
+	if !ok {
+		return nil, ErrImageUnsupported
+	}
+	return p.run(ctx, func(ctx context.Context) ([]byte, error) {
+		return ie.RenderImage(ctx, r, o, img)
+	})
+}
+
+func (p *Pool) run(ctx context.Context, render func(ctx context.Context) ([]byte, error)) ([]byte, error) {
+	select {
+	case p.waiting <- struct{}{}:
+	default:
+		return nil, ErrQueueFull
+	}
+	defer func() { <-p.waiting }()
+
+	select {
+	case p.slots <- struct{}{}:
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+	defer func() { <-p.slots }()
+
+	if p.timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, p.timeout)
+		defer cancel()
+	}
+	return render(ctx)
+}
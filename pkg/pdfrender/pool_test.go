@@ -0,0 +1,105 @@
+package pdfrender
+
+import (
+	"context"
+	"errors"
+	"io"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// blockingEngine renders once release is closed or the context ends.
+type blockingEngine struct {
+	started chan struct{}
+	release chan struct{}
+}
+
+func (e blockingEngine) Render(ctx context.Context, r io.Reader, o Options) ([]byte, error) {
+	e.started <- struct{}{}
+	select {
+	case <-e.release:
+		return []byte("%PDF-1.4"), nil
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+}
+
+func TestPoolBackpressure(t *testing.T) {
+	engine := blockingEngine{started: make(chan struct{}, 10), release: make(chan struct{})}
+	pool := NewPool(engine, 2, 1, 0)
+
+	var wg sync.WaitGroup
+	errs := make(chan error, 3)
+	for i := 0; i < 3; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			_, err := pool.Render(context.Background(), strings.NewReader("<p>hi</p>"), Options{})
+			errs <- err
+		}()
+	}
+
+	// two renders run, the third waits in the queue
+	<-engine.started
+	<-engine.started
+	for len(pool.waiting) != 3 {
+		time.Sleep(time.Millisecond)
+	}
+
+	_, err := pool.Render(context.Background(), strings.NewReader("<p>hi</p>"), Options{})
+	if err != ErrQueueFull {
+		t.Fatalf("expected: %v, got: %v", ErrQueueFull, err)
+	}
+
+	close(engine.release)
+	wg.Wait()
+	close(errs)
+	for err := range errs {
+		if err != nil {
+			t.Fatalf("expected: %v, got: %v", nil, err)
+		}
+	}
+	if len(engine.started) != 1 {
+		t.Fatalf("expected queued render to start, got: %v", len(engine.started))
+	}
+}
+
+func TestPoolCancelWhileQueued(t *testing.T) {
+	engine := blockingEngine{started: make(chan struct{}, 10), release: make(chan struct{})}
+	pool := NewPool(engine, 1, 1, 0)
+
+	go pool.Render(context.Background(), strings.NewReader(""), Options{})
+	<-engine.started
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error)
+	go func() {
+		_, err := pool.Render(ctx, strings.NewReader(""), Options{})
+		done <- err
+	}()
+	cancel()
+
+	if err := <-done; !errors.Is(err, context.Canceled) {
+		t.Fatalf("expected: %v, got: %v", context.Canceled, err)
+	}
+	close(engine.release)
+}
+
+func TestPoolTimeout(t *testing.T) {
+	engine := blockingEngine{started: make(chan struct{}, 10), release: make(chan struct{})}
+	pool := NewPool(engine, 1, 0, 10*time.Millisecond)
+
+	_, err := pool.Render(context.Background(), strings.NewReader(""), Options{})
+	if !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("expected: %v, got: %v", context.DeadlineExceeded, err)
+	}
+
+	// the slot is free again after the timeout
+	close(engine.release)
+	_, err = pool.Render(context.Background(), strings.NewReader(""), Options{})
+	if err != nil {
+		t.Fatalf("expected: %v, got: %v", nil, err)
+	}
+}
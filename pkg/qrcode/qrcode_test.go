@@ -0,0 +1,112 @@
+package qrcode
+
+import (
+	"bytes"
+	"testing"
+)
+
+// helloWorld are the data codewords of HELLO WORLD in alphanumeric mode at
+// version 1, the worked example of ISO/IEC 18004 and thonky.com.
+var helloWorld = []byte{32, 91, 11, 120, 209, 114, 220, 77, 67, 64, 236, 17, 236, 17, 236, 17}
+
+func TestErrorCorrectionCodewords(t *testing.T) {
+	tests := []struct {
+		name  string
+		level Level
+		data  []byte
+		want  []byte
+	}{
+		{name: "1-M", level: Medium, data: helloWorld, want: []byte{196, 35, 39, 119, 235, 215, 231, 226, 93, 23}},
+		{name: "1-Q", level: Quartile, data: helloWorld[:13], want: []byte{168, 72, 22, 82, 217, 54, 156, 0, 46, 15, 180, 122, 16}},
+	}
+
+	for _, tc := range tests {
+		got := newCode(1, tc.level).addEccAndInterleave(tc.data)
+		if want := append(append([]byte{}, tc.data...), tc.want...); !bytes.Equal(got, want) {
+			t.Fatalf("%s: expected: %v, got: %v", tc.name, want, got)
+		}
+	}
+}
+
+func TestDataCodewords(t *testing.T) {
+	want := []byte{0x40, 0x56, 0x86, 0x56, 0xC6, 0xC6, 0xF0, 0xEC, 0x11, 0xEC, 0x11, 0xEC, 0x11, 0xEC, 0x11, 0xEC, 0x11, 0xEC, 0x11}
+	if got := dataCodewords([]byte("hello"), 1, Low); !bytes.Equal(got, want) {
+		t.Fatalf("expected: %x, got: %x", want, got)
+	}
+}
+
+// TestFormatInfo checks against the format information table of ISO/IEC
+// 18004 annex C.
+func TestFormatInfo(t *testing.T) {
+	tests := []struct {
+		level Level
+		mask  int
+		want  int
+	}{
+		{level: Low, mask: 0, want: 0b111011111000100},
+		{level: Low, mask: 7, want: 0b110100101110110},
+		{level: Medium, mask: 0, want: 0b101010000010010},
+		{level: Medium, mask: 5, want: 0b100000011001110},
+		{level: Quartile, mask: 0, want: 0b011010101011111},
+		{level: Quartile, mask: 6, want: 0b010111011011010},
+		{level: High, mask: 0, want: 0b001011010001001},
+		{level: High, mask: 3, want: 0b001100111010000},
+	}
+
+	for _, tc := range tests {
+		if got := formatInfo(tc.level, tc.mask); got != tc.want {
+			t.Fatalf("%d/%d: expected: %015b, got: %015b", tc.level, tc.mask, tc.want, got)
+		}
+	}
+}
+
+func TestVersionInfo(t *testing.T) {
+	for version, want := range map[int]int{7: 0x07C94, 21: 0x15683, 40: 0x28C69} {
+		if got := versionInfo(version); got != want {
+			t.Fatalf("%d: expected: %05x, got: %05x", version, want, got)
+		}
+	}
+}
+
+func TestEncodeFormatPlacement(t *testing.T) {
+	c, err := EncodeString("HELLO WORLD", Quartile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if c.Version != 1 || c.Size != 21 {
+		t.Fatalf("expected: %v, got: %v %v", "version 1 of size 21", c.Version, c.Size)
+	}
+
+	// both copies hold the format information, least significant bit first
+	var first, second int
+	for i := 0; i < 15; i++ {
+		var x, y int
+		switch {
+		case i < 6:
+			x, y = 8, i
+		case i < 8:
+			x, y = 8, i+1
+		case i == 8:
+			x, y = 7, 8
+		default:
+			x, y = 14-i, 8
+		}
+		if c.Black(x, y) {
+			first |= 1 << i
+		}
+		if i < 8 {
+			x, y = c.Size-1-i, 8
+		} else {
+			x, y = 8, c.Size-15+i
+		}
+		if c.Black(x, y) {
+			second |= 1 << i
+		}
+	}
+	if want := formatInfo(Quartile, c.Mask); first != want || second != want {
+		t.Fatalf("expected: %015b, got: %015b %015b", want, first, second)
+	}
+	if !c.Black(8, c.Size-8) {
+		t.Fatalf("expected: %v, got: %v", "dark module", "light")
+	}
+}
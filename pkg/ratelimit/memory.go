@@ -0,0 +1,45 @@
+package ratelimit
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+// MemoryStore keeps buckets in process. Every replica has its own buckets,
+// so behind a load balancer a key gets its limit once per replica.
+type MemoryStore struct {
+	mu      sync.Mutex
+	buckets map[string]Bucket
+}
+
+func NewMemoryStore() *MemoryStore {
+	return &MemoryStore{
+		buckets: make(map[string]Bucket),
+	}
+}
+
+func (s *MemoryStore) Take(ctx context.Context, key string, l Limit, now time.Time) (Result, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	b, ok := s.buckets[key]
+	if !ok {
+		b = Bucket{Key: key}
+	}
+	b, res := l.Take(b, now)
+	s.buckets[key] = b
+	return res, nil
+}
+
+func (s *MemoryStore) DeleteIdle(ctx context.Context, before time.Time) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for k, b := range s.buckets {
+		if b.UpdatedAt.Before(before) {
+			delete(s.buckets, k)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,153 @@
+package ratelimit
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"github.com/rengas/pdfgen/pkg/logging"
+	"math"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+var ErrInvalidLimit = errors.New("rate limit must look like 60/1m")
+
+// Limit is a token bucket that holds up to Requests tokens and refills all of
+// them over Per, so bursts of Requests are allowed after an idle period.
+type Limit struct {
+	Requests int
+	Per      time.Duration
+}
+
+// ParseLimit parses limits written as requests/duration, e.g. 60/1m.
+func ParseLimit(s string) (Limit, error) {
+	parts := strings.SplitN(s, "/", 2)
+	if len(parts) != 2 {
+		return Limit{}, ErrInvalidLimit
+	}
+	n, err := strconv.Atoi(parts[0])
+	if err != nil || n < 1 {
+		return Limit{}, ErrInvalidLimit
+	}
+	per, err := time.ParseDuration(parts[1])
+	if err != nil || per <= 0 {
+		return Limit{}, ErrInvalidLimit
+	}
+	return Limit{Requests: n, Per: per}, nil
+}
+
+func (l Limit) String() string {
+	return fmt.Sprintf("%d/%s", l.Requests, l.Per)
+}
+
+// rate is the number of tokens added per second.
+func (l Limit) rate() float64 {
+	return float64(l.Requests) / l.Per.Seconds()
+}
+
+// Bucket is the state of a single key.
+type Bucket struct {
+	Key       string
+	Tokens    float64
+	UpdatedAt time.Time
+}
+
+// Result describes the outcome of taking a token.
+type Result struct {
+	Allowed   bool
+	Limit     int
+	Remaining int
+	// Reset is when the bucket is full again.
+	Reset time.Time
+	// RetryAfter is how long a denied caller has to wait for the next token.
+	RetryAfter time.Duration
+}
+
+// Take refills the bucket up to now and takes one token if there is one. A
+// zero bucket is a new key and starts full.
+func (l Limit) Take(b Bucket, now time.Time) (Bucket, Result) {
+	capacity := float64(l.Requests)
+	if b.UpdatedAt.IsZero() {
+		b.Tokens = capacity
+	} else if elapsed := now.Sub(b.UpdatedAt); elapsed > 0 {
+		b.Tokens = math.Min(capacity, b.Tokens+elapsed.Seconds()*l.rate())
+	}
+	b.UpdatedAt = now
+
+	res := Result{Limit: l.Requests}
+	if b.Tokens >= 1 {
+		b.Tokens--
+		res.Allowed = true
+	} else {
+		res.RetryAfter = l.duration(1 - b.Tokens)
+	}
+	res.Remaining = int(b.Tokens)
+	res.Reset = now.Add(l.duration(capacity - b.Tokens))
+	return b, res
+}
+
+// duration returns how long it takes to refill the given number of tokens.
+func (l Limit) duration(tokens float64) time.Duration {
+	return time.Duration(math.Ceil(tokens / l.rate() * float64(time.Second)))
+}
+
+// Store keeps buckets. Implementations must apply Take atomically per key so
+// concurrent requests can not take the same token.
+type Store interface {
+	Take(ctx context.Context, key string, l Limit, now time.Time) (Result, error)
+	// DeleteIdle deletes the buckets last taken from before the given time.
+	DeleteIdle(ctx context.Context, before time.Time) error
+}
+
+type Limiter struct {
+	store Store
+	clock func() time.Time
+
+	mu       sync.Mutex
+	prunedAt time.Time
+	// idle is the longest Per seen, buckets idle for longer are full again
+	// and the same as a new key.
+	idle time.Duration
+}
+
+func NewLimiter(store Store, clock func() time.Time) *Limiter {
+	if clock == nil {
+		clock = time.Now
+	}
+	return &Limiter{
+		store: store,
+		clock: clock,
+	}
+}
+
+// Allow takes a token from the bucket of key.
+func (l *Limiter) Allow(ctx context.Context, key string, limit Limit) (Result, error) {
+	now := l.clock()
+	l.prune(now, limit.Per)
+	return l.store.Take(ctx, key, limit, now)
+}
+
+// prune deletes full buckets at most once per hour, every client ip would
+// otherwise keep a bucket forever.
+func (l *Limiter) prune(now time.Time, per time.Duration) {
+	l.mu.Lock()
+	if per > l.idle {
+		l.idle = per
+	}
+	if now.Sub(l.prunedAt) < time.Hour {
+		l.mu.Unlock()
+		return
+	}
+	l.prunedAt = now
+	idle := l.idle
+	l.mu.Unlock()
+
+	go func() {
+		err := l.store.DeleteIdle(context.Background(), now.Add(-idle))
+		if err != nil {
+			logging.WithError(err).Error("unable to delete idle rate limit buckets")
+		}
+	}()
+}
@@ -0,0 +1,152 @@
+package ratelimit
+
+import (
+	"context"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestParseLimit(t *testing.T) {
+	tests := []struct {
+		in      string
+		want    Limit
+		wantErr error
+	}{
+		{in: "60/1m", want: Limit{Requests: 60, Per: time.Minute}},
+		{in: "5/30s", want: Limit{Requests: 5, Per: 30 * time.Second}},
+		{in: "60", wantErr: ErrInvalidLimit},
+		{in: "0/1m", wantErr: ErrInvalidLimit},
+		{in: "10/0s", wantErr: ErrInvalidLimit},
+		{in: "ten/1m", wantErr: ErrInvalidLimit},
+	}
+
+	for _, tc := range tests {
+		got, err := ParseLimit(tc.in)
+		if err != tc.wantErr || got != tc.want {
+			t.Fatalf("%s: expected: %v %v, got: %v %v", tc.in, tc.want, tc.wantErr, got, err)
+		}
+	}
+}
+
+func TestLimiterTokenBucket(t *testing.T) {
+	ctx := context.Background()
+	now := time.Date(2022, 9, 1, 10, 0, 0, 0, time.UTC)
+	l := NewLimiter(NewMemoryStore(), func() time.Time { return now })
+	limit := Limit{Requests: 3, Per: 3 * time.Second}
+
+	tests := []struct {
+		name          string
+		advance       time.Duration
+		wantAllowed   bool
+		wantRemaining int
+		wantReset     time.Duration
+		wantRetry     time.Duration
+	}{
+		{name: "new key starts full", wantAllowed: true, wantRemaining: 2, wantReset: time.Second},
+		{name: "second request", wantAllowed: true, wantRemaining: 1, wantReset: 2 * time.Second},
+		{name: "burst used up", wantAllowed: true, wantRemaining: 0, wantReset: 3 * time.Second},
+		{name: "denied while empty", wantAllowed: false, wantRemaining: 0, wantReset: 3 * time.Second, wantRetry: time.Second},
+		{name: "half a token is not enough", advance: 500 * time.Millisecond, wantAllowed: false, wantRemaining: 0, wantReset: 2500 * time.Millisecond, wantRetry: 500 * time.Millisecond},
+		{name: "refilled token", advance: 500 * time.Millisecond, wantAllowed: true, wantRemaining: 0, wantReset: 3 * time.Second},
+		{name: "refill is capped", advance: time.Hour, wantAllowed: true, wantRemaining: 2, wantReset: time.Second},
+	}
+
+	for _, tc := range tests {
+		now = now.Add(tc.advance)
+		res, err := l.Allow(ctx, "user:1", limit)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if res.Allowed != tc.wantAllowed || res.Remaining != tc.wantRemaining || res.Limit != 3 {
+			t.Fatalf("%s: expected: %v/%v, got: %v/%v", tc.name, tc.wantAllowed, tc.wantRemaining, res.Allowed, res.Remaining)
+		}
+		if got := res.Reset.Sub(now); got != tc.wantReset {
+			t.Fatalf("%s: expected reset: %v, got: %v", tc.name, tc.wantReset, got)
+		}
+		if res.RetryAfter != tc.wantRetry {
+			t.Fatalf("%s: expected retry: %v, got: %v", tc.name, tc.wantRetry, res.RetryAfter)
+		}
+	}
+
+	res, err := l.Allow(ctx, "user:2", limit)
+	if err != nil || !res.Allowed || res.Remaining != 2 {
+		t.Fatalf("keys are independent: expected: %v, got: %+v %v", "2 remaining", res, err)
+	}
+}
+
+func TestMemoryStoreConcurrentTake(t *testing.T) {
+	now := time.Date(2022, 9, 1, 10, 0, 0, 0, time.UTC)
+	l := NewLimiter(NewMemoryStore(), func() time.Time { return now })
+	limit := Limit{Requests: 10, Per: time.Hour}
+
+	var wg sync.WaitGroup
+	var mu sync.Mutex
+	allowed := 0
+	for i := 0; i < 50; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			res, err := l.Allow(context.Background(), "ip:10.0.0.1", limit)
+			if err != nil {
+				t.Error(err)
+				return
+			}
+			if res.Allowed {
+				mu.Lock()
+				allowed++
+				mu.Unlock()
+			}
+		}()
+	}
+	wg.Wait()
+
+	if allowed != 10 {
+		t.Fatalf("expected: %v, got: %v", 10, allowed)
+	}
+}
+
+type pruneStore struct {
+	*MemoryStore
+	pruned chan time.Time
+}
+
+func (s pruneStore) DeleteIdle(ctx context.Context, before time.Time) error {
+	err := s.MemoryStore.DeleteIdle(ctx, before)
+	s.pruned <- before
+	return err
+}
+
+func TestLimiterDeletesIdleBuckets(t *testing.T) {
+	ctx := context.Background()
+	start := time.Date(2022, 9, 1, 10, 0, 0, 0, time.UTC)
+	now := start
+	store := pruneStore{MemoryStore: NewMemoryStore(), pruned: make(chan time.Time, 1)}
+	l := NewLimiter(store, func() time.Time { return now })
+
+	if _, err := l.Allow(ctx, "ip:10.0.0.1", Limit{Requests: 3, Per: time.Minute}); err != nil {
+		t.Fatal(err)
+	}
+	<-store.pruned
+
+	now = start.Add(50 * time.Minute)
+	if _, err := l.Allow(ctx, "user:1", Limit{Requests: 3, Per: 15 * time.Minute}); err != nil {
+		t.Fatal(err)
+	}
+
+	now = start.Add(61 * time.Minute)
+	if _, err := l.Allow(ctx, "user:2", Limit{Requests: 3, Per: time.Minute}); err != nil {
+		t.Fatal(err)
+	}
+	if got, want := <-store.pruned, now.Add(-15*time.Minute); !got.Equal(want) {
+		t.Fatalf("expected: %v, got: %v", want, got)
+	}
+
+	store.mu.Lock()
+	defer store.mu.Unlock()
+	for key, want := range map[string]bool{"ip:10.0.0.1": false, "user:1": true, "user:2": true} {
+		if _, ok := store.buckets[key]; ok != want {
+			t.Fatalf("%s: expected: %v, got: %v", key, want, ok)
+		}
+	}
+}
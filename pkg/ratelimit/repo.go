@@ -0,0 +1,60 @@
+package ratelimit
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"time"
+)
+
+// Repository is the Postgres Store, it shares buckets between api replicas.
+type Repository struct {
+	db *sql.DB
+}
+
+func NewRepository(db *sql.DB) *Repository {
+	return &Repository{
+		db: db,
+	}
+}
+
+// Take locks the row of the key while the bucket is refilled and a token is
+// taken, requests of the same key on other replicas wait for each other.
+func (r *Repository) Take(ctx context.Context, key string, l Limit, now time.Time) (Result, error) {
+	tx, err := r.db.BeginTx(ctx, nil)
+	if err != nil {
+		return Result{}, err
+	}
+	defer tx.Rollback()
+
+	_, err = tx.ExecContext(ctx, `INSERT INTO rate_limit(key, tokens, updated_at) values($1, 0, NULL) ON CONFLICT DO NOTHING`, key)
+	if err != nil {
+		return Result{}, err
+	}
+
+	b := Bucket{Key: key}
+	var updatedAt sql.NullTime
+	err = tx.QueryRowContext(ctx, `SELECT tokens, updated_at FROM rate_limit WHERE key = $1 FOR UPDATE`, key).
+		Scan(&b.Tokens, &updatedAt)
+	// an idle row deleted between the insert and the select starts full
+	if err != nil && !errors.Is(err, sql.ErrNoRows) {
+		return Result{}, err
+	}
+	if updatedAt.Valid {
+		b.UpdatedAt = updatedAt.Time
+	}
+
+	b, res := l.Take(b, now)
+	_, err = tx.ExecContext(ctx, `INSERT INTO rate_limit(key, tokens, updated_at) values($1, $2, $3)
+		ON CONFLICT (key) DO UPDATE SET tokens = EXCLUDED.tokens, updated_at = EXCLUDED.updated_at`, key, b.Tokens, b.UpdatedAt)
+	if err != nil {
+		return Result{}, err
+	}
+
+	return res, tx.Commit()
+}
+
+func (r *Repository) DeleteIdle(ctx context.Context, before time.Time) error {
+	_, err := r.db.ExecContext(ctx, `DELETE FROM rate_limit WHERE updated_at < $1`, before)
+	return err
+}
@@ -0,0 +1,39 @@
+package thumbnail
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+)
+
+type Repository struct {
+	db *sql.DB
+}
+
+func NewRepository(db *sql.DB) *Repository {
+	return &Repository{
+		db: db,
+	}
+}
+
+// Save stores the thumbnail unless one of a later save is already stored.
+func (r *Repository) Save(ctx context.Context, t Thumbnail) error {
+	q := `INSERT INTO design_thumbnail(design_id, content_type, image, requested_at) values($1, $2, $3, $4)
+		  ON CONFLICT (design_id) DO UPDATE SET content_type=$2, image=$3, requested_at=$4
+		  WHERE design_thumbnail.requested_at <= $4`
+	_, err := r.db.ExecContext(ctx, q, t.DesignId, t.ContentType, t.Image, t.RequestedAt)
+	return err
+}
+
+func (r *Repository) Get(ctx context.Context, designId string) (Thumbnail, error) {
+	t := Thumbnail{DesignId: designId}
+	q := `SELECT content_type, image, requested_at FROM design_thumbnail WHERE design_id = $1`
+	err := r.db.QueryRowContext(ctx, q, designId).Scan(&t.ContentType, &t.Image, &t.RequestedAt)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return Thumbnail{}, ErrThumbnailNotFound
+		}
+		return Thumbnail{}, err
+	}
+	return t, nil
+}
@@ -0,0 +1,112 @@
+// Package thumbnail keeps a preview image of the first page of every design.
+// Thumbnails are rendered in the background whenever a design is saved.
+package thumbnail
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"github.com/rengas/pdfgen/pkg/design"
+	"github.com/rengas/pdfgen/pkg/logging"
+	"github.com/rengas/pdfgen/pkg/pdfrender"
+	"io"
+	"sync"
+	"time"
+)
+
+// Width of thumbnails in pixels.
+const Width = 320
+
+var ErrThumbnailNotFound = errors.New("thumbnail not found")
+
+type Thumbnail struct {
+	DesignId    string
+	ContentType string
+	Image       []byte
+	// RequestedAt is when the save that triggered the thumbnail happened, a
+	// thumbnail never replaces one of a later save.
+	RequestedAt time.Time
+}
+
+// ETag identifies the image for conditional requests.
+func (t Thumbnail) ETag() string {
+	h := sha256.Sum256(t.Image)
+	return `"` + hex.EncodeToString(h[:16]) + `"`
+}
+
+type Store interface {
+	Save(ctx context.Context, t Thumbnail) error
+}
+
+type Renderer interface {
+	RenderImage(ctx context.Context, r io.Reader, o pdfrender.Options, img pdfrender.ImageOptions) ([]byte, error)
+}
+
+type Generator struct {
+	store    Store
+	renderer Renderer
+	timeout  time.Duration
+	clock    func() time.Time
+	wg       sync.WaitGroup
+}
+
+func NewGenerator(store Store, renderer Renderer, timeout time.Duration, clock func() time.Time) *Generator {
+	return &Generator{
+		store:    store,
+		renderer: renderer,
+		timeout:  timeout,
+		clock:    clock,
+	}
+}
+
+// Generate renders the first page of the design and stores it, drafts are
+// marked like their documents.
+func (g *Generator) Generate(ctx context.Context, d design.Design, requestedAt time.Time) error {
+	html, err := d.HTML()
+	if err != nil {
+		return err
+	}
+
+	img := pdfrender.ImageOptions{Format: pdfrender.ImagePNG, Width: Width}
+	if d.Draft {
+		html = pdfrender.DraftOverlay(html, d.RenderOptions(), img)
+	}
+	b, err := g.renderer.RenderImage(ctx, html, d.RenderOptions(), img)
+	if err != nil {
+		return err
+	}
+
+	return g.store.Save(ctx, Thumbnail{
+		DesignId:    d.Id,
+		ContentType: img.ContentType(),
+		Image:       b,
+		RequestedAt: requestedAt,
+	})
+}
+
+// Refresh generates the thumbnail of the design in the background. When it
+// fails the previous thumbnail stays.
+func (g *Generator) Refresh(d design.Design) {
+	requestedAt := g.clock()
+	g.wg.Add(1)
+	go func() {
+		defer g.wg.Done()
+		ctx, cancel := context.WithTimeout(context.Background(), g.timeout)
+		defer cancel()
+
+		err := g.Generate(ctx, d, requestedAt)
+		if errors.Is(err, pdfrender.ErrImageUnsupported) || errors.Is(err, design.ErrNotHTML) {
+			logging.WithError(err).Debug("no thumbnail for design")
+			return
+		}
+		if err != nil {
+			logging.WithError(err).Error("unable to generate thumbnail")
+		}
+	}()
+}
+
+// Wait blocks until the thumbnails being generated are stored.
+func (g *Generator) Wait() {
+	g.wg.Wait()
+}
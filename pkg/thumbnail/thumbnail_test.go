@@ -0,0 +1,84 @@
+package thumbnail
+
+import (
+	"context"
+	"github.com/rengas/pdfgen/pkg/design"
+	"github.com/rengas/pdfgen/pkg/pdfrender"
+	"io"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+type memoryStore struct {
+	mu    sync.Mutex
+	saved []Thumbnail
+}
+
+func (s *memoryStore) Save(ctx context.Context, t Thumbnail) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.saved = append(s.saved, t)
+	return nil
+}
+
+type fakeRenderer struct {
+	err  error
+	html string
+	img  pdfrender.ImageOptions
+}
+
+func (f *fakeRenderer) RenderImage(ctx context.Context, r io.Reader, o pdfrender.Options, img pdfrender.ImageOptions) ([]byte, error) {
+	if f.err != nil {
+		return nil, f.err
+	}
+	b, _ := io.ReadAll(r)
+	f.html, f.img = string(b), img
+	return []byte("png"), nil
+}
+
+func TestRefresh(t *testing.T) {
+	now := time.Date(2026, 10, 19, 12, 0, 0, 0, time.UTC)
+	clock := func() time.Time { return now }
+	fields := design.Attrs{"name": "Ada"}
+	d := design.Design{Id: "design-1", Name: "invoice", Template: `<p>{{.name}}</p>`, Fields: &fields}
+
+	tests := []struct {
+		name      string
+		draft     bool
+		err       error
+		wantSaved int
+	}{
+		{name: "stores the first page", wantSaved: 1},
+		{name: "draft", draft: true, wantSaved: 1},
+		{name: "engine without images", err: pdfrender.ErrImageUnsupported},
+	}
+
+	for _, tc := range tests {
+		store := &memoryStore{}
+		renderer := &fakeRenderer{err: tc.err}
+		g := NewGenerator(store, renderer, time.Second, clock)
+
+		d.Draft = tc.draft
+		g.Refresh(d)
+		g.Wait()
+
+		if len(store.saved) != tc.wantSaved {
+			t.Fatalf("%s: expected: %v, got: %v", tc.name, tc.wantSaved, len(store.saved))
+		}
+		if tc.wantSaved == 0 {
+			continue
+		}
+		got := store.saved[0]
+		if got.DesignId != d.Id || got.ContentType != "image/png" || string(got.Image) != "png" || !got.RequestedAt.Equal(now) {
+			t.Fatalf("%s: unexpected thumbnail: %+v", tc.name, got)
+		}
+		if !strings.HasPrefix(renderer.html, "<p>Ada</p>") || renderer.img.Width != Width {
+			t.Fatalf("%s: expected: rendered fields at %v px, got: %s at %v px", tc.name, Width, renderer.html, renderer.img.Width)
+		}
+		if strings.Contains(renderer.html, ">DRAFT<") != tc.draft {
+			t.Fatalf("%s: expected: %v, got: %s", tc.name, "DRAFT mark on drafts only", renderer.html)
+		}
+	}
+}
@@ -6,7 +6,20 @@ import (
 	"time"
 )
 
-var ErrorUserIdEmpty = errors.New("userId is empty")
+var (
+	ErrorUserIdEmpty     = errors.New("userId is empty")
+	ErrorInvalidMFAToken = errors.New("invalid mfa token")
+	ErrorInvalidToken    = errors.New("invalid token")
+)
+
+const (
+	claimType         = "typ"
+	claimOrganization = "orgId"
+	typeAccess        = "access"
+	typeRefresh       = "refresh"
+	typeMFA           = "mfa"
+	mfaExpiresIn      = 5 * time.Minute
+)
 
 type JWT struct {
 	accessSecretKey  string
@@ -14,6 +27,8 @@ type JWT struct {
 	refreshSecretKey string
 	refreshExpires   int
 	signingMethod    *jwt.SigningMethodHMAC
+	keys             *KeySet
+	rejectLegacy     bool
 }
 
 // TokenDetails - login response with access/refresh token pair.
@@ -32,22 +47,44 @@ func NewJWT(accessSecretKey, refreshSecretKey string, accessExpires, refreshExpi
 	}
 }
 
+// NewJWTWithKeys signs tokens with the signing key of keys. Tokens are verified
+// by their kid header, tokens without one are still verified with the shared
+// secrets so tokens issued before the switch stay valid until they expire.
+// Pass empty secrets to reject them.
+func NewJWTWithKeys(keys *KeySet, accessSecretKey, refreshSecretKey string, accessExpires, refreshExpires int) *JWT {
+	j := NewJWT(accessSecretKey, refreshSecretKey, accessExpires, refreshExpires)
+	j.keys = keys
+	return j
+}
+
+// RejectLegacy stops accepting tokens issued before tokens had a typ claim
+// and, with a key set, tokens without a kid signed with the shared secrets.
+func (j *JWT) RejectLegacy() {
+	j.rejectLegacy = true
+}
+
+// TokePair issues an access and refresh token for the userId claim. An
+// orgId claim is copied into both tokens and returned by
+// ExtractTokenMetadata.
 func (j JWT) TokePair(claims map[string]interface{}) (TokenDetails, error) {
 
 	id, ok := claims["userId"]
 	if !ok {
 		return TokenDetails{}, ErrorUserIdEmpty
 	}
+	orgId, _ := claims[claimOrganization].(string)
 	td := TokenDetails{}
 
 	aClaims := jwt.MapClaims{}
 
 	aClaims["exp"] = time.Now().Add(time.Minute * time.Duration(j.accessExpires)).Unix()
 	aClaims["sub"] = id
+	aClaims[claimType] = typeAccess
+	if orgId != "" {
+		aClaims[claimOrganization] = orgId
+	}
 
-	aToken := jwt.NewWithClaims(j.signingMethod, aClaims)
-
-	accessToken, err := aToken.SignedString([]byte(j.accessSecretKey))
+	accessToken, err := j.sign(aClaims, j.accessSecretKey)
 	if err != nil {
 		return TokenDetails{}, err
 	}
@@ -57,9 +94,12 @@ func (j JWT) TokePair(claims map[string]interface{}) (TokenDetails, error) {
 
 	rClaims["exp"] = time.Now().Add(time.Hour * time.Duration(j.refreshExpires)).Unix()
 	rClaims["sub"] = id
+	rClaims[claimType] = typeRefresh
+	if orgId != "" {
+		rClaims[claimOrganization] = orgId
+	}
 
-	rToken := jwt.NewWithClaims(j.signingMethod, rClaims)
-	refreshToken, err := rToken.SignedString([]byte(j.refreshSecretKey))
+	refreshToken, err := j.sign(rClaims, j.refreshSecretKey)
 	if err != nil {
 		return TokenDetails{}, err
 	}
@@ -69,34 +109,106 @@ func (j JWT) TokePair(claims map[string]interface{}) (TokenDetails, error) {
 	return td, nil
 }
 
-func (j JWT) verifyToken(tkn string) (*jwt.Token, error) {
-	token, err := jwt.Parse(tkn,
-		func(token *jwt.Token) (interface{}, error) {
-			//TODO what should you do here?
-			return []byte(j.accessSecretKey), nil
-		}, jwt.WithValidMethods([]string{"HS256"}),
-	)
+// MFAChallenge returns a short-lived token proving that the password step of
+// a login succeeded. It cannot be used as an access token.
+func (j JWT) MFAChallenge(userId string) (string, error) {
+	if userId == "" {
+		return "", ErrorUserIdEmpty
+	}
+	claims := jwt.MapClaims{}
+	claims["exp"] = time.Now().Add(mfaExpiresIn).Unix()
+	claims["sub"] = userId
+	claims[claimType] = typeMFA
+
+	return j.sign(claims, j.accessSecretKey)
+}
+
+// VerifyMFAChallenge returns the user id of a valid MFA challenge token.
+func (j JWT) VerifyMFAChallenge(tkn string) (string, error) {
+	t, err := j.verify(tkn, typeMFA, j.accessSecretKey)
 	if err != nil {
-		return nil, err
+		return "", ErrorInvalidMFAToken
+	}
+	claims, ok := t.Claims.(jwt.MapClaims)
+	if !ok {
+		return "", ErrorInvalidMFAToken
+	}
+	sub, ok := claims["sub"].(string)
+	if !ok || sub == "" {
+		return "", ErrorInvalidMFAToken
 	}
+	return sub, nil
+}
 
-	return token, nil
+// JWKS returns the public keys tokens are signed with, it is empty when
+// tokens are signed with shared secrets.
+func (j JWT) JWKS() JWKS {
+	if j.keys == nil {
+		return JWKS{Keys: []JWK{}}
+	}
+	return j.keys.JWKS()
 }
 
-func (j JWT) verifyRefreshToken(tkn string) (*jwt.Token, error) {
+func (j JWT) sign(claims jwt.MapClaims, secret string) (string, error) {
+	if j.keys == nil {
+		return jwt.NewWithClaims(j.signingMethod, claims).SignedString([]byte(secret))
+	}
+
+	k := j.keys.Signing()
+	t := jwt.NewWithClaims(k.method(), claims)
+	t.Header["kid"] = k.Id
+	return t.SignedString(k.Private)
+}
+
+// verify parses tkn and checks its typ claim. Tokens issued before the typ
+// claim existed are accepted as access or refresh tokens when they are
+// signed with the matching shared secret, unless RejectLegacy was called.
+func (j JWT) verify(tkn, typ, secret string) (*jwt.Token, error) {
 	token, err := jwt.Parse(tkn,
 		func(token *jwt.Token) (interface{}, error) {
-			//TODO what should you do here?
-			return []byte(j.refreshSecretKey), nil
-		}, jwt.WithValidMethods([]string{"HS256"}),
+			if kid, ok := token.Header["kid"].(string); ok && j.keys != nil {
+				k, ok := j.keys.Get(kid)
+				if !ok {
+					return nil, ErrUnknownKeyId
+				}
+				if token.Method.Alg() != k.Algorithm {
+					return nil, ErrorInvalidToken
+				}
+				return k.Public, nil
+			}
+
+			if _, ok := token.Method.(*jwt.SigningMethodHMAC); !ok || secret == "" || (j.keys != nil && j.rejectLegacy) {
+				return nil, ErrorInvalidToken
+			}
+			return []byte(secret), nil
+		}, jwt.WithValidMethods([]string{"HS256", AlgRS256, AlgEdDSA}),
 	)
 	if err != nil {
 		return nil, err
 	}
 
+	claims, ok := token.Claims.(jwt.MapClaims)
+	if !ok {
+		return nil, ErrorInvalidToken
+	}
+	switch got, _ := claims[claimType].(string); {
+	case got == typ:
+	case got == "" && typ != typeMFA && token.Method.Alg() == "HS256" && !j.rejectLegacy:
+	default:
+		return nil, ErrorInvalidToken
+	}
+
 	return token, nil
 }
 
+func (j JWT) verifyToken(tkn string) (*jwt.Token, error) {
+	return j.verify(tkn, typeAccess, j.accessSecretKey)
+}
+
+func (j JWT) verifyRefreshToken(tkn string) (*jwt.Token, error) {
+	return j.verify(tkn, typeRefresh, j.refreshSecretKey)
+}
+
 type Claims map[string]interface{}
 
 func (j JWT) ExtractTokenMetadata(tkn string) (Claims, error) {
@@ -110,5 +222,8 @@ func (j JWT) ExtractTokenMetadata(tkn string) (Claims, error) {
 	}
 	c := make(Claims, 0)
 	c["userId"] = claims["sub"].(string)
+	if orgId, ok := claims[claimOrganization].(string); ok && orgId != "" {
+		c["orgId"] = orgId
+	}
 	return c, nil
 }
@@ -0,0 +1,168 @@
+package token
+
+import (
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/pem"
+	"github.com/golang-jwt/jwt/v4"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func writeKeys(t *testing.T) (string, string) {
+	t.Helper()
+	dir := t.TempDir()
+
+	rk, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	rsaFile := filepath.Join(dir, "rsa-2022-09.pem")
+	err = os.WriteFile(rsaFile, pem.EncodeToMemory(&pem.Block{Type: "RSA PRIVATE KEY", Bytes: x509.MarshalPKCS1PrivateKey(rk)}), 0600)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	_, ek, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	b, err := x509.MarshalPKCS8PrivateKey(ek)
+	if err != nil {
+		t.Fatal(err)
+	}
+	edFile := filepath.Join(dir, "ed-2022-10.pem")
+	err = os.WriteFile(edFile, pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: b}), 0600)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return rsaFile, edFile
+}
+
+func TestKeyRotation(t *testing.T) {
+	rsaFile, edFile := writeKeys(t)
+
+	before, err := LoadKeySet("rsa-2022-09", rsaFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	old := NewJWTWithKeys(before, "", "", 30, 2)
+	pair, err := old.TokePair(map[string]interface{}{"userId": "99d15987-e06f-492c-a520-e54185e5b80b"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	after, err := LoadKeySet("ed-2022-10", rsaFile, edFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	rotated := NewJWTWithKeys(after, "", "", 30, 2)
+
+	c, err := rotated.ExtractTokenMetadata(pair.AccessToken)
+	if err != nil {
+		t.Fatalf("token signed before rotation should verify: %v", err)
+	}
+	if c["userId"] != "99d15987-e06f-492c-a520-e54185e5b80b" {
+		t.Fatalf("unexpected userId: %v", c["userId"])
+	}
+
+	pair, err = rotated.TokePair(map[string]interface{}{"userId": "99d15987-e06f-492c-a520-e54185e5b80b"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = old.ExtractTokenMetadata(pair.AccessToken)
+	if err == nil {
+		t.Fatal("token signed with a key unknown to the verifier should not verify")
+	}
+	_, err = rotated.ExtractTokenMetadata(pair.RefreshToken)
+	if err == nil {
+		t.Fatal("refresh token should not be accepted as access token")
+	}
+
+	jwks := rotated.JWKS()
+	if len(jwks.Keys) != 2 {
+		t.Fatalf("expected 2 keys, got: %d", len(jwks.Keys))
+	}
+	if jwks.Keys[0].KeyId != "ed-2022-10" || jwks.Keys[0].KeyType != "OKP" || jwks.Keys[0].X == "" {
+		t.Fatalf("unexpected ed25519 jwk: %+v", jwks.Keys[0])
+	}
+	if jwks.Keys[1].KeyId != "rsa-2022-09" || jwks.Keys[1].KeyType != "RSA" || jwks.Keys[1].E != "AQAB" {
+		t.Fatalf("unexpected rsa jwk: %+v", jwks.Keys[1])
+	}
+}
+
+func TestLegacySecretTokens(t *testing.T) {
+	rsaFile, _ := writeKeys(t)
+	legacy := NewJWT("access-secret", "refresh-secret", 30, 2)
+	pair, err := legacy.TokePair(map[string]interface{}{"userId": "99d15987-e06f-492c-a520-e54185e5b80b"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ks, err := LoadKeySet("rsa-2022-09", rsaFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name    string
+		jwt     *JWT
+		wantErr bool
+	}{
+		{name: "accepted while secret is configured", jwt: NewJWTWithKeys(ks, "access-secret", "refresh-secret", 30, 2)},
+		{name: "rejected once secret is removed", jwt: NewJWTWithKeys(ks, "", "", 30, 2), wantErr: true},
+		{name: "rejected when legacy tokens are disabled", jwt: withoutLegacy(NewJWTWithKeys(ks, "access-secret", "refresh-secret", 30, 2)), wantErr: true},
+	}
+
+	for _, tc := range tests {
+		_, err := tc.jwt.ExtractTokenMetadata(pair.AccessToken)
+		if (err != nil) != tc.wantErr {
+			t.Fatalf("%s: unexpected error: %v", tc.name, err)
+		}
+	}
+
+	challenge, err := legacy.MFAChallenge("99d15987-e06f-492c-a520-e54185e5b80b")
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = legacy.ExtractTokenMetadata(challenge)
+	if err == nil {
+		t.Fatal("mfa challenge should not be accepted as access token")
+	}
+}
+
+func withoutLegacy(j *JWT) *JWT {
+	j.RejectLegacy()
+	return j
+}
+
+func TestRejectUntypedTokens(t *testing.T) {
+	untyped, err := jwt.NewWithClaims(jwt.SigningMethodHS256, jwt.MapClaims{
+		"sub": "99d15987-e06f-492c-a520-e54185e5b80b",
+		"exp": time.Now().Add(time.Minute).Unix(),
+	}).SignedString([]byte("access-secret"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name    string
+		jwt     *JWT
+		wantErr bool
+	}{
+		{name: "accepted by default", jwt: NewJWT("access-secret", "refresh-secret", 30, 2)},
+		{name: "rejected when legacy tokens are disabled", jwt: withoutLegacy(NewJWT("access-secret", "refresh-secret", 30, 2)), wantErr: true},
+	}
+
+	for _, tc := range tests {
+		_, err := tc.jwt.ExtractTokenMetadata(untyped)
+		if (err != nil) != tc.wantErr {
+			t.Fatalf("%s: unexpected error: %v", tc.name, err)
+		}
+	}
+}
@@ -0,0 +1,186 @@
+package token
+
+import (
+	"crypto"
+	"crypto/ed25519"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"github.com/golang-jwt/jwt/v4"
+	"math/big"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+var (
+	ErrNoSigningKey       = errors.New("no signing key")
+	ErrUnknownKeyId       = errors.New("unknown key id")
+	ErrUnsupportedKey     = errors.New("unsupported key type, expected RSA or Ed25519")
+	ErrInvalidPEM         = errors.New("invalid pem file")
+	ErrSigningKeyIsVerify = errors.New("signing key has no private part")
+)
+
+const (
+	AlgRS256 = "RS256"
+	AlgEdDSA = "EdDSA"
+)
+
+// Key is a single asymmetric key. Keys without a private part can only
+// verify, which is how retired keys stay around until their tokens expire.
+type Key struct {
+	Id        string
+	Algorithm string
+	Private   crypto.Signer
+	Public    crypto.PublicKey
+}
+
+func (k Key) method() jwt.SigningMethod {
+	if k.Algorithm == AlgEdDSA {
+		return jwt.SigningMethodEdDSA
+	}
+	return jwt.SigningMethodRS256
+}
+
+// KeySet holds every key that tokens may be verified with and the one new
+// tokens are signed with. Rotating means adding a key and making it the
+// signing key, the previous key keeps verifying existing tokens.
+type KeySet struct {
+	signing string
+	keys    map[string]Key
+}
+
+func NewKeySet(signingKeyId string, keys ...Key) (*KeySet, error) {
+	ks := &KeySet{
+		signing: signingKeyId,
+		keys:    make(map[string]Key, len(keys)),
+	}
+	for _, k := range keys {
+		ks.keys[k.Id] = k
+	}
+
+	k, ok := ks.keys[signingKeyId]
+	if !ok {
+		return nil, ErrNoSigningKey
+	}
+	if k.Private == nil {
+		return nil, ErrSigningKeyIsVerify
+	}
+	return ks, nil
+}
+
+// LoadKeySet reads PEM encoded keys, the key id of each is its file name
+// without extension.
+func LoadKeySet(signingKeyId string, files ...string) (*KeySet, error) {
+	keys := make([]Key, 0, len(files))
+	for _, f := range files {
+		b, err := os.ReadFile(f)
+		if err != nil {
+			return nil, err
+		}
+		id := strings.TrimSuffix(filepath.Base(f), filepath.Ext(f))
+		k, err := ParseKey(id, b)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", f, err)
+		}
+		keys = append(keys, k)
+	}
+	return NewKeySet(signingKeyId, keys...)
+}
+
+// ParseKey parses a PEM encoded RSA or Ed25519 private or public key.
+func ParseKey(id string, b []byte) (Key, error) {
+	block, _ := pem.Decode(b)
+	if block == nil {
+		return Key{}, ErrInvalidPEM
+	}
+
+	var parsed interface{}
+	var err error
+	switch block.Type {
+	case "RSA PRIVATE KEY":
+		parsed, err = x509.ParsePKCS1PrivateKey(block.Bytes)
+	case "PRIVATE KEY":
+		parsed, err = x509.ParsePKCS8PrivateKey(block.Bytes)
+	case "RSA PUBLIC KEY":
+		parsed, err = x509.ParsePKCS1PublicKey(block.Bytes)
+	case "PUBLIC KEY":
+		parsed, err = x509.ParsePKIXPublicKey(block.Bytes)
+	default:
+		return Key{}, ErrInvalidPEM
+	}
+	if err != nil {
+		return Key{}, err
+	}
+
+	k := Key{Id: id}
+	switch v := parsed.(type) {
+	case *rsa.PrivateKey:
+		k.Algorithm, k.Private, k.Public = AlgRS256, v, &v.PublicKey
+	case *rsa.PublicKey:
+		k.Algorithm, k.Public = AlgRS256, v
+	case ed25519.PrivateKey:
+		k.Algorithm, k.Private, k.Public = AlgEdDSA, v, v.Public()
+	case ed25519.PublicKey:
+		k.Algorithm, k.Public = AlgEdDSA, v
+	default:
+		return Key{}, ErrUnsupportedKey
+	}
+	return k, nil
+}
+
+func (ks *KeySet) Signing() Key {
+	return ks.keys[ks.signing]
+}
+
+func (ks *KeySet) Get(id string) (Key, bool) {
+	k, ok := ks.keys[id]
+	return k, ok
+}
+
+// JWK is a public key in RFC 7517 format.
+type JWK struct {
+	KeyType   string `json:"kty"`
+	KeyId     string `json:"kid"`
+	Use       string `json:"use"`
+	Algorithm string `json:"alg"`
+	N         string `json:"n,omitempty"`
+	E         string `json:"e,omitempty"`
+	Curve     string `json:"crv,omitempty"`
+	X         string `json:"x,omitempty"`
+}
+
+type JWKS struct {
+	Keys []JWK `json:"keys"`
+}
+
+// JWKS returns the public part of every key in the set.
+func (ks *KeySet) JWKS() JWKS {
+	ids := make([]string, 0, len(ks.keys))
+	for id := range ks.keys {
+		ids = append(ids, id)
+	}
+	sort.Strings(ids)
+
+	set := JWKS{Keys: make([]JWK, 0, len(ids))}
+	for _, id := range ids {
+		k := ks.keys[id]
+		jwk := JWK{KeyId: k.Id, Use: "sig", Algorithm: k.Algorithm}
+		switch pub := k.Public.(type) {
+		case *rsa.PublicKey:
+			jwk.KeyType = "RSA"
+			jwk.N = base64.RawURLEncoding.EncodeToString(pub.N.Bytes())
+			jwk.E = base64.RawURLEncoding.EncodeToString(big.NewInt(int64(pub.E)).Bytes())
+		case ed25519.PublicKey:
+			jwk.KeyType = "OKP"
+			jwk.Curve = "Ed25519"
+			jwk.X = base64.RawURLEncoding.EncodeToString(pub)
+		}
+		set.Keys = append(set.Keys, jwk)
+	}
+	return set
+}
@@ -0,0 +1,83 @@
+package totp
+
+import (
+	"encoding/base32"
+	"testing"
+	"time"
+)
+
+// RFC 6238 appendix B test vectors for HMAC-SHA1.
+func TestHOTPRFC6238Vectors(t *testing.T) {
+	key := []byte("12345678901234567890")
+
+	tests := []struct {
+		unix int64
+		want string
+	}{
+		{unix: 59, want: "94287082"},
+		{unix: 1111111109, want: "07081804"},
+		{unix: 1111111111, want: "14050471"},
+		{unix: 1234567890, want: "89005924"},
+		{unix: 2000000000, want: "69279037"},
+		{unix: 20000000000, want: "65353130"},
+	}
+
+	for _, tc := range tests {
+		got := HOTP(key, tc.unix/30, 8)
+		if got != tc.want {
+			t.Fatalf("time %d: expected: %v, got: %v", tc.unix, tc.want, got)
+		}
+	}
+}
+
+func TestValidate(t *testing.T) {
+	secret := base32.StdEncoding.EncodeToString([]byte("12345678901234567890"))
+	now := time.Unix(1111111111, 0)
+	tp := NewTOTP("pdfgen", func() time.Time { return now })
+
+	code, err := tp.Code(secret)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if code != "050471" {
+		t.Fatalf("expected: %v, got: %v", "050471", code)
+	}
+
+	tests := []struct {
+		name    string
+		at      time.Time
+		wantErr bool
+	}{
+		{name: "same step", at: now},
+		{name: "previous step within skew", at: now.Add(-30 * time.Second)},
+		{name: "next step within skew", at: now.Add(30 * time.Second)},
+		{name: "outside skew", at: now.Add(-90 * time.Second), wantErr: true},
+	}
+
+	for _, tc := range tests {
+		at := tc.at
+		v := NewTOTP("pdfgen", func() time.Time { return at })
+		step, err := v.Validate(secret, code)
+		if tc.wantErr {
+			if err != ErrInvalidCode {
+				t.Fatalf("%s: expected: %v, got: %v", tc.name, ErrInvalidCode, err)
+			}
+			continue
+		}
+		if err != nil {
+			t.Fatalf("%s: unexpected error: %v", tc.name, err)
+		}
+		if step != now.Unix()/30 {
+			t.Fatalf("%s: expected step: %d, got: %d", tc.name, now.Unix()/30, step)
+		}
+	}
+}
+
+func TestURI(t *testing.T) {
+	tp := NewTOTP("pdfgen", nil)
+	got := tp.URI("john@email.com", "JBSWY3DPEHPK3PXP")
+	want := "otpauth://totp/pdfgen:john@email.com?algorithm=SHA1&digits=6&issuer=pdfgen&period=30&secret=JBSWY3DPEHPK3PXP"
+	if got != want {
+		t.Fatalf("expected: %v, got: %v", want, got)
+	}
+}
@@ -0,0 +1,142 @@
+package usage
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"github.com/lib/pq"
+	"time"
+)
+
+// foreignKeyViolation is the postgres error code of a foreign key violation.
+const foreignKeyViolation = "23503"
+
+var ErrUserNotFound = errors.New("user not found")
+
+type Repository struct {
+	db *sql.DB
+}
+
+func NewRepository(db *sql.DB) *Repository {
+	return &Repository{
+		db: db,
+	}
+}
+
+// GetPlan returns the plan name of the user, users without one are on the free plan.
+func (r *Repository) GetPlan(ctx context.Context, userId string) (string, error) {
+	var plan string
+	err := r.db.QueryRowContext(ctx, `SELECT plan FROM user_plan WHERE user_id = $1`, userId).Scan(&plan)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return PlanFree, nil
+		}
+		return "", err
+	}
+	return plan, nil
+}
+
+func (r *Repository) SetPlan(ctx context.Context, userId, plan string, at time.Time) error {
+	q := `INSERT INTO user_plan(user_id, plan, updated_at) values($1, $2, $3)
+		  ON CONFLICT (user_id) DO UPDATE SET plan=$2, updated_at=$3`
+	_, err := r.db.ExecContext(ctx, q, userId, plan, at)
+	if err != nil {
+		var pqErr *pq.Error
+		if errors.As(err, &pqErr) && pqErr.Code == foreignKeyViolation {
+			return ErrUserNotFound
+		}
+		return err
+	}
+	return nil
+}
+
+func (r *Repository) GetPeriod(ctx context.Context, userId string, start time.Time) (Period, error) {
+	p := Period{UserId: userId, Start: start}
+	q := `SELECT documents, pages, bytes FROM usage_period WHERE user_id = $1 AND period_start = $2`
+	err := r.db.QueryRowContext(ctx, q, userId, start).Scan(&p.Documents, &p.Pages, &p.Bytes)
+	if err != nil && !errors.Is(err, sql.ErrNoRows) {
+		return Period{}, err
+	}
+	return p, nil
+}
+
+// Reserve counts a document against the period if the plan allows it. The
+// period row is locked while checking, concurrent reservations of the same
+// user wait for each other.
+func (r *Repository) Reserve(ctx context.Context, userId string, start time.Time, plan Plan) (Period, error) {
+	tx, err := r.db.BeginTx(ctx, nil)
+	if err != nil {
+		return Period{}, err
+	}
+	defer tx.Rollback()
+
+	_, err = tx.ExecContext(ctx, `INSERT INTO usage_period(user_id, period_start) values($1, $2) ON CONFLICT DO NOTHING`,
+		userId, start)
+	if err != nil {
+		return Period{}, err
+	}
+
+	p := Period{UserId: userId, Start: start}
+	err = tx.QueryRowContext(ctx, `SELECT documents, pages, bytes FROM usage_period WHERE user_id = $1 AND period_start = $2 FOR UPDATE`,
+		userId, start).Scan(&p.Documents, &p.Pages, &p.Bytes)
+	if err != nil {
+		return Period{}, err
+	}
+
+	err = plan.Check(p)
+	if err != nil {
+		return p, err
+	}
+
+	_, err = tx.ExecContext(ctx, `UPDATE usage_period SET documents = documents + 1 WHERE user_id = $1 AND period_start = $2`,
+		userId, start)
+	if err != nil {
+		return Period{}, err
+	}
+	p.Documents++
+
+	return p, tx.Commit()
+}
+
+func (r *Repository) Release(ctx context.Context, userId string, start time.Time) error {
+	_, err := r.db.ExecContext(ctx, `UPDATE usage_period SET documents = documents - 1 WHERE user_id = $1 AND period_start = $2 AND documents > 0`,
+		userId, start)
+	return err
+}
+
+// Record stores a generated document and adds its pages and bytes to the
+// period. The period row is locked while checking the page limit, so
+// concurrent documents of the same user can not overshoot it together.
+func (r *Repository) Record(ctx context.Context, start time.Time, rec Record, plan Plan) error {
+	tx, err := r.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	p := Period{UserId: rec.UserId, Start: start}
+	err = tx.QueryRowContext(ctx, `SELECT documents, pages, bytes FROM usage_period WHERE user_id = $1 AND period_start = $2 FOR UPDATE`,
+		rec.UserId, start).Scan(&p.Documents, &p.Pages, &p.Bytes)
+	if err != nil {
+		return err
+	}
+
+	err = plan.CheckPages(p, rec.Pages)
+	if err != nil {
+		return err
+	}
+
+	_, err = tx.ExecContext(ctx, `INSERT INTO usage_event(id, user_id, design_id, pages, bytes, render_ms, created_at) values($1, $2, $3, $4, $5, $6, $7)`,
+		rec.Id, rec.UserId, rec.DesignId, rec.Pages, rec.Bytes, rec.RenderTime.Milliseconds(), rec.CreatedAt)
+	if err != nil {
+		return err
+	}
+
+	_, err = tx.ExecContext(ctx, `UPDATE usage_period SET pages = pages + $3, bytes = bytes + $4 WHERE user_id = $1 AND period_start = $2`,
+		rec.UserId, start, rec.Pages, rec.Bytes)
+	if err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
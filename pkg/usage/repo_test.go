@@ -0,0 +1,112 @@
+//go:build e2e
+
+package usage
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"github.com/google/uuid"
+	"github.com/ory/dockertest/v3"
+	"github.com/rengas/pdfgen/pkg/testutils"
+	"log"
+	"os"
+	"path"
+	"sync"
+	"testing"
+	"time"
+)
+
+var db *sql.DB
+
+func TestMain(m *testing.M) {
+	pool, err := dockertest.NewPool("")
+	if err != nil {
+		log.Fatalf("failed to connect to docker: %s", err.Error())
+	}
+
+	network, err := pool.CreateNetwork("pdfgen-usage")
+	if err != nil {
+		log.Fatalf("failed to create docker network: %s", err.Error())
+	}
+
+	user, pass, dbName := "pdfgen", "pdfgen", "pdfgen"
+	postgresContainer, err := testutils.CreatePostgres(pool, network, user, pass, dbName)
+	if err != nil {
+		log.Printf("failed to create postgres: %s", err.Error())
+		testutils.Cleanup(1, pool, network, postgresContainer)
+	}
+
+	pwd, err := os.Getwd()
+	if err != nil {
+		log.Fatalf("failed to get working directory: %s", err.Error())
+	}
+	connStr := fmt.Sprintf("postgres://%s:%s@localhost:%s/%s?sslmode=disable", user, pass, postgresContainer.GetPort("5432/tcp"), dbName)
+	err = testutils.MigratePostgres(connStr, dbName, path.Join(pwd, "..", "..", "migrations"))
+	if err != nil {
+		log.Printf("failed to migrate database: %s", err.Error())
+		testutils.Cleanup(1, pool, network, postgresContainer)
+	}
+
+	db, err = testutils.MustOpenPostgres(connStr)
+	if err != nil {
+		log.Printf("failed to open postgres: %s", err.Error())
+		testutils.Cleanup(1, pool, network, postgresContainer)
+	}
+
+	testutils.Cleanup(m.Run(), pool, network, postgresContainer)
+}
+
+func TestRepositoryConcurrentGenerations(t *testing.T) {
+	ctx := context.Background()
+	userId := uuid.NewString()
+	_, err := db.ExecContext(ctx, `INSERT INTO users(id, email, password_hash, role) values($1, $2, 'hash', 'normal')`,
+		userId, userId+"@example.com")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	plans := map[string]Plan{
+		PlanFree: {Name: PlanFree, MonthlyDocuments: 100, MonthlyPages: 10},
+	}
+	m := NewMeter(NewRepository(db), plans, func() time.Time { return time.Now().UTC() })
+
+	var wg sync.WaitGroup
+	var mu sync.Mutex
+	var committed, limited int
+	for i := 0; i < 20; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			res, err := m.Reserve(ctx, userId)
+			if err == nil {
+				err = m.Commit(ctx, res, Record{Pages: 3, Bytes: 100})
+				if errors.Is(err, ErrPageLimit) {
+					if rerr := m.Release(ctx, res); rerr != nil {
+						t.Error(rerr)
+					}
+				}
+			}
+			mu.Lock()
+			defer mu.Unlock()
+			switch {
+			case err == nil:
+				committed++
+			case errors.Is(err, ErrPageLimit):
+				limited++
+			default:
+				t.Error(err)
+			}
+		}()
+	}
+	wg.Wait()
+
+	used, _, err := m.Usage(ctx, userId)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if committed != 3 || limited != 17 || used.Pages != 9 || used.Documents != 3 {
+		t.Fatalf("expected: %v, got: %v committed %v limited %+v", "3 committed 17 limited 9 pages", committed, limited, used)
+	}
+}
@@ -0,0 +1,195 @@
+package usage
+
+import (
+	"context"
+	"errors"
+	"github.com/google/uuid"
+	"github.com/rengas/pdfgen/pkg/pdf"
+	"time"
+)
+
+var (
+	ErrDocumentLimit = errors.New("monthly document limit reached")
+	ErrPageLimit     = errors.New("monthly page limit reached")
+)
+
+const (
+	PlanFree     = "free"
+	PlanStarter  = "starter"
+	PlanBusiness = "business"
+)
+
+// Plan limits the documents and pages a user can generate per calendar
+// month, a zero limit is unlimited.
+type Plan struct {
+	Name             string `json:"name"`
+	MonthlyDocuments int64  `json:"monthlyDocuments"`
+	MonthlyPages     int64  `json:"monthlyPages"`
+}
+
+var Plans = map[string]Plan{
+	PlanFree:     {Name: PlanFree, MonthlyDocuments: 100, MonthlyPages: 1000},
+	PlanStarter:  {Name: PlanStarter, MonthlyDocuments: 5000, MonthlyPages: 50000},
+	PlanBusiness: {Name: PlanBusiness},
+}
+
+// Check reports whether one more document fits into the plan. Pages are only
+// known once a document is rendered, so reserving only checks that pages are
+// left and CheckPages checks the rendered document.
+func (p Plan) Check(used Period) error {
+	if p.MonthlyDocuments > 0 && used.Documents >= p.MonthlyDocuments {
+		return ErrDocumentLimit
+	}
+	if p.MonthlyPages > 0 && used.Pages >= p.MonthlyPages {
+		return ErrPageLimit
+	}
+	return nil
+}
+
+// CheckPages reports whether a rendered document of pages fits into the
+// page limit of the plan.
+func (p Plan) CheckPages(used Period, pages int64) error {
+	if p.MonthlyPages > 0 && used.Pages+pages > p.MonthlyPages {
+		return ErrPageLimit
+	}
+	return nil
+}
+
+// Period is the usage of a user in one calendar month.
+type Period struct {
+	UserId    string    `json:"userId"`
+	Start     time.Time `json:"start"`
+	Documents int64     `json:"documents"`
+	Pages     int64     `json:"pages"`
+	Bytes     int64     `json:"bytes"`
+}
+
+// Record is a single generated document.
+type Record struct {
+	Id         string
+	UserId     string
+	DesignId   string
+	Pages      int64
+	Bytes      int64
+	RenderTime time.Duration
+	CreatedAt  time.Time
+}
+
+// Reservation holds one document of the quota while it is rendered.
+type Reservation struct {
+	UserId string
+	Period time.Time
+	Plan   Plan
+}
+
+type Store interface {
+	GetPlan(ctx context.Context, userId string) (string, error)
+	GetPeriod(ctx context.Context, userId string, start time.Time) (Period, error)
+	Reserve(ctx context.Context, userId string, start time.Time, plan Plan) (Period, error)
+	Release(ctx context.Context, userId string, start time.Time) error
+	// Record adds the document to the period unless its pages exceed the
+	// page limit of the plan, then it returns ErrPageLimit. Records of the
+	// same user are serialised like reservations.
+	Record(ctx context.Context, start time.Time, r Record, plan Plan) error
+}
+
+// Meter enforces plan quotas and records generated documents.
+type Meter struct {
+	store Store
+	plans map[string]Plan
+	clock func() time.Time
+}
+
+func NewMeter(store Store, plans map[string]Plan, clock func() time.Time) *Meter {
+	return &Meter{
+		store: store,
+		plans: plans,
+		clock: clock,
+	}
+}
+
+// PeriodStart returns the first instant of the calendar month of t in UTC.
+func PeriodStart(t time.Time) time.Time {
+	t = t.UTC()
+	return time.Date(t.Year(), t.Month(), 1, 0, 0, 0, 0, time.UTC)
+}
+
+// PeriodEnd returns the first instant of the month after the one of t.
+func PeriodEnd(t time.Time) time.Time {
+	return PeriodStart(t).AddDate(0, 1, 0)
+}
+
+func (m *Meter) plan(ctx context.Context, userId string) (Plan, error) {
+	name, err := m.store.GetPlan(ctx, userId)
+	if err != nil {
+		return Plan{}, err
+	}
+	p, ok := m.plans[name]
+	if !ok {
+		return m.plans[PlanFree], nil
+	}
+	return p, nil
+}
+
+// Reserve takes one document of the quota of the user. Reservations are
+// serialised per user, so concurrent requests can not overshoot the limit.
+// The reservation must be committed or released.
+func (m *Meter) Reserve(ctx context.Context, userId string) (Reservation, error) {
+	p, err := m.plan(ctx, userId)
+	if err != nil {
+		return Reservation{}, err
+	}
+	start := PeriodStart(m.clock())
+	_, err = m.store.Reserve(ctx, userId, start, p)
+	if err != nil {
+		return Reservation{}, err
+	}
+	return Reservation{UserId: userId, Period: start, Plan: p}, nil
+}
+
+// Commit records the rendered document of a reservation. A document whose
+// pages exceed the page limit is not recorded and returns ErrPageLimit, its
+// reservation must be released.
+func (m *Meter) Commit(ctx context.Context, res Reservation, r Record) error {
+	r.Id = uuid.NewString()
+	r.UserId = res.UserId
+	r.CreatedAt = m.clock()
+	return m.store.Record(ctx, res.Period, r, res.Plan)
+}
+
+// Release gives back a reservation whose document was not generated.
+func (m *Meter) Release(ctx context.Context, res Reservation) error {
+	return m.store.Release(ctx, res.UserId, res.Period)
+}
+
+// Usage returns the usage of the current period and the plan of the user.
+func (m *Meter) Usage(ctx context.Context, userId string) (Period, Plan, error) {
+	p, err := m.plan(ctx, userId)
+	if err != nil {
+		return Period{}, Plan{}, err
+	}
+	used, err := m.store.GetPeriod(ctx, userId, PeriodStart(m.clock()))
+	if err != nil {
+		return Period{}, Plan{}, err
+	}
+	return used, p, nil
+}
+
+// ResetsAt returns when the current period ends.
+func (m *Meter) ResetsAt() time.Time {
+	return PeriodEnd(m.clock())
+}
+
+// CountPages counts the pages in the page tree of a PDF, documents that can
+// not be read count as zero pages.
+func CountPages(b []byte) int64 {
+	r, err := pdf.NewReader(b)
+	if err != nil {
+		return 0
+	}
+	pages, err := r.Pages()
+	if err != nil {
+		return 0
+	}
+	return int64(len(pages))
+}
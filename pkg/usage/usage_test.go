@@ -0,0 +1,326 @@
+package usage
+
+import (
+	"context"
+	"errors"
+	"github.com/rengas/pdfgen/pkg/pdf"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestPlanCheck(t *testing.T) {
+	plan := Plan{Name: "test", MonthlyDocuments: 10, MonthlyPages: 100}
+
+	tests := []struct {
+		name string
+		plan Plan
+		used Period
+		want error
+	}{
+		{name: "empty period", plan: plan, want: nil},
+		{name: "below limits", plan: plan, used: Period{Documents: 9, Pages: 99}, want: nil},
+		{name: "document limit", plan: plan, used: Period{Documents: 10, Pages: 20}, want: ErrDocumentLimit},
+		{name: "page limit", plan: plan, used: Period{Documents: 3, Pages: 100}, want: ErrPageLimit},
+		{name: "unlimited", plan: Plans[PlanBusiness], used: Period{Documents: 1e6, Pages: 1e7}, want: nil},
+	}
+
+	for _, tc := range tests {
+		got := tc.plan.Check(tc.used)
+		if got != tc.want {
+			t.Fatalf("%s: expected: %v, got: %v", tc.name, tc.want, got)
+		}
+	}
+}
+
+func TestPlanCheckPages(t *testing.T) {
+	plan := Plan{Name: "test", MonthlyDocuments: 10, MonthlyPages: 100}
+
+	tests := []struct {
+		name  string
+		plan  Plan
+		used  Period
+		pages int64
+		want  error
+	}{
+		{name: "fits", plan: plan, used: Period{Pages: 90}, pages: 10, want: nil},
+		{name: "crosses the limit", plan: plan, used: Period{Pages: 90}, pages: 11, want: ErrPageLimit},
+		{name: "unlimited", plan: Plans[PlanBusiness], used: Period{Pages: 1e7}, pages: 1e3, want: nil},
+	}
+
+	for _, tc := range tests {
+		got := tc.plan.CheckPages(tc.used, tc.pages)
+		if got != tc.want {
+			t.Fatalf("%s: expected: %v, got: %v", tc.name, tc.want, got)
+		}
+	}
+}
+
+func TestPeriod(t *testing.T) {
+	tests := []struct {
+		name      string
+		at        time.Time
+		wantStart time.Time
+		wantEnd   time.Time
+	}{
+		{
+			name:      "mid month",
+			at:        time.Date(2022, 3, 15, 10, 30, 0, 0, time.UTC),
+			wantStart: time.Date(2022, 3, 1, 0, 0, 0, 0, time.UTC),
+			wantEnd:   time.Date(2022, 4, 1, 0, 0, 0, 0, time.UTC),
+		},
+		{
+			name:      "end of year",
+			at:        time.Date(2022, 12, 31, 23, 59, 59, 0, time.UTC),
+			wantStart: time.Date(2022, 12, 1, 0, 0, 0, 0, time.UTC),
+			wantEnd:   time.Date(2023, 1, 1, 0, 0, 0, 0, time.UTC),
+		},
+		{
+			name:      "converted to utc",
+			at:        time.Date(2022, 5, 1, 1, 0, 0, 0, time.FixedZone("CEST", 2*60*60)),
+			wantStart: time.Date(2022, 4, 1, 0, 0, 0, 0, time.UTC),
+			wantEnd:   time.Date(2022, 5, 1, 0, 0, 0, 0, time.UTC),
+		},
+	}
+
+	for _, tc := range tests {
+		if got := PeriodStart(tc.at); !got.Equal(tc.wantStart) {
+			t.Fatalf("%s: expected: %v, got: %v", tc.name, tc.wantStart, got)
+		}
+		if got := PeriodEnd(tc.at); !got.Equal(tc.wantEnd) {
+			t.Fatalf("%s: expected: %v, got: %v", tc.name, tc.wantEnd, got)
+		}
+	}
+}
+
+// pagesPDF writes a document with a nested page tree of n pages. Its content
+// stream and an orphaned page object contain page dictionaries that are not
+// part of the tree.
+func pagesPDF(t *testing.T, n int) []byte {
+	w := pdf.NewWriter()
+	content := w.Add(pdf.Stream{Dict: pdf.Dict{}, Data: []byte("% <</Type /Page>>")})
+	root := w.Reserve()
+	inner := w.Reserve()
+
+	var kids pdf.Array
+	for i := 0; i < n; i++ {
+		kids = append(kids, w.Add(pdf.Dict{"Type": pdf.Name("Page"), "Parent": inner, "Contents": content}))
+	}
+	w.Set(inner, pdf.Dict{"Type": pdf.Name("Pages"), "Parent": root, "Kids": kids, "Count": pdf.Integer(n)})
+	w.Set(root, pdf.Dict{"Type": pdf.Name("Pages"), "Kids": pdf.Array{inner}, "Count": pdf.Integer(n)})
+	w.Add(pdf.Dict{"Type": pdf.Name("Page"), "Parent": inner})
+
+	b, err := w.Bytes("1.4", pdf.Dict{"Root": w.Add(pdf.Dict{"Type": pdf.Name("Catalog"), "Pages": root})})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return b
+}
+
+func TestCountPages(t *testing.T) {
+	tests := []struct {
+		name string
+		pdf  []byte
+		want int64
+	}{
+		{name: "not a pdf", pdf: []byte("<html></html>"), want: 0},
+		{name: "single page", pdf: pagesPDF(t, 1), want: 1},
+		{name: "three pages", pdf: pagesPDF(t, 3), want: 3},
+	}
+
+	for _, tc := range tests {
+		got := CountPages(tc.pdf)
+		if got != tc.want {
+			t.Fatalf("%s: expected: %v, got: %v", tc.name, tc.want, got)
+		}
+	}
+}
+
+// fakeStore keeps periods in memory, a mutex stands in for the row lock.
+type fakeStore struct {
+	mu      sync.Mutex
+	plan    string
+	periods map[time.Time]*Period
+	records []Record
+}
+
+func newFakeStore(plan string) *fakeStore {
+	return &fakeStore{plan: plan, periods: map[time.Time]*Period{}}
+}
+
+func (f *fakeStore) period(userId string, start time.Time) *Period {
+	p, ok := f.periods[start]
+	if !ok {
+		p = &Period{UserId: userId, Start: start}
+		f.periods[start] = p
+	}
+	return p
+}
+
+func (f *fakeStore) GetPlan(ctx context.Context, userId string) (string, error) {
+	return f.plan, nil
+}
+
+func (f *fakeStore) GetPeriod(ctx context.Context, userId string, start time.Time) (Period, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return *f.period(userId, start), nil
+}
+
+func (f *fakeStore) Reserve(ctx context.Context, userId string, start time.Time, plan Plan) (Period, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	p := f.period(userId, start)
+	if err := plan.Check(*p); err != nil {
+		return *p, err
+	}
+	p.Documents++
+	return *p, nil
+}
+
+func (f *fakeStore) Release(ctx context.Context, userId string, start time.Time) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.period(userId, start).Documents--
+	return nil
+}
+
+func (f *fakeStore) Record(ctx context.Context, start time.Time, r Record, plan Plan) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	p := f.period(r.UserId, start)
+	if err := plan.CheckPages(*p, r.Pages); err != nil {
+		return err
+	}
+	p.Pages += r.Pages
+	p.Bytes += r.Bytes
+	f.records = append(f.records, r)
+	return nil
+}
+
+func TestMeter(t *testing.T) {
+	now := time.Date(2022, 3, 15, 10, 0, 0, 0, time.UTC)
+	plans := map[string]Plan{
+		PlanFree: {Name: PlanFree, MonthlyDocuments: 2, MonthlyPages: 5},
+	}
+	store := newFakeStore("unknown")
+	m := NewMeter(store, plans, func() time.Time { return now })
+	ctx := context.Background()
+
+	res, err := m.Reserve(ctx, "user-1")
+	if err != nil {
+		t.Fatalf("reserve: expected: %v, got: %v", nil, err)
+	}
+	err = m.Commit(ctx, res, Record{DesignId: "design-1", Pages: 3, Bytes: 100})
+	if err != nil {
+		t.Fatalf("commit: expected: %v, got: %v", nil, err)
+	}
+
+	res, err = m.Reserve(ctx, "user-1")
+	if err != nil {
+		t.Fatalf("second reserve: expected: %v, got: %v", nil, err)
+	}
+	err = m.Commit(ctx, res, Record{DesignId: "design-1", Pages: 3, Bytes: 100})
+	if err != ErrPageLimit {
+		t.Fatalf("commit over the page limit: expected: %v, got: %v", ErrPageLimit, err)
+	}
+	err = m.Release(ctx, res)
+	if err != nil {
+		t.Fatalf("release: expected: %v, got: %v", nil, err)
+	}
+
+	used, plan, err := m.Usage(ctx, "user-1")
+	if err != nil {
+		t.Fatalf("usage: expected: %v, got: %v", nil, err)
+	}
+	if plan.Name != PlanFree {
+		t.Fatalf("unknown plan: expected: %v, got: %v", PlanFree, plan.Name)
+	}
+	if used.Documents != 1 || used.Pages != 3 || used.Bytes != 100 {
+		t.Fatalf("usage: expected: %v, got: %+v", "1 document, 3 pages, 100 bytes", used)
+	}
+	if r := store.records[0]; r.UserId != "user-1" || r.Id == "" || !r.CreatedAt.Equal(now) {
+		t.Fatalf("record: expected: %v, got: %+v", "user, id and time set", r)
+	}
+	if got := m.ResetsAt(); !got.Equal(time.Date(2022, 4, 1, 0, 0, 0, 0, time.UTC)) {
+		t.Fatalf("resets at: expected: %v, got: %v", "2022-04-01", got)
+	}
+}
+
+func TestMeterConcurrentReservations(t *testing.T) {
+	plans := map[string]Plan{
+		PlanFree: {Name: PlanFree, MonthlyDocuments: 5},
+	}
+	m := NewMeter(newFakeStore(PlanFree), plans, time.Now)
+
+	var wg sync.WaitGroup
+	var mu sync.Mutex
+	var granted, limited int
+	for i := 0; i < 20; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			_, err := m.Reserve(context.Background(), "user-1")
+			mu.Lock()
+			defer mu.Unlock()
+			switch {
+			case err == nil:
+				granted++
+			case errors.Is(err, ErrDocumentLimit):
+				limited++
+			}
+		}()
+	}
+	wg.Wait()
+
+	if granted != 5 || limited != 15 {
+		t.Fatalf("expected: %v, got: %v granted %v limited", "5 granted 15 limited", granted, limited)
+	}
+}
+
+func TestMeterConcurrentCommits(t *testing.T) {
+	plans := map[string]Plan{
+		PlanFree: {Name: PlanFree, MonthlyPages: 10},
+	}
+	store := newFakeStore(PlanFree)
+	m := NewMeter(store, plans, time.Now)
+	ctx := context.Background()
+
+	// all reservations pass while no pages are used yet
+	var reservations []Reservation
+	for i := 0; i < 5; i++ {
+		res, err := m.Reserve(ctx, "user-1")
+		if err != nil {
+			t.Fatal(err)
+		}
+		reservations = append(reservations, res)
+	}
+
+	var wg sync.WaitGroup
+	var mu sync.Mutex
+	var committed, limited int
+	for _, res := range reservations {
+		wg.Add(1)
+		go func(res Reservation) {
+			defer wg.Done()
+			err := m.Commit(ctx, res, Record{Pages: 3})
+			mu.Lock()
+			defer mu.Unlock()
+			switch {
+			case err == nil:
+				committed++
+			case errors.Is(err, ErrPageLimit):
+				limited++
+			}
+		}(res)
+	}
+	wg.Wait()
+
+	used, _, err := m.Usage(ctx, "user-1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if committed != 3 || limited != 2 || used.Pages != 9 {
+		t.Fatalf("expected: %v, got: %v committed %v limited %v pages", "3 committed 2 limited 9 pages", committed, limited, used.Pages)
+	}
+}
@@ -0,0 +1,12 @@
+package user
+
+import "time"
+
+// Identity links an account at an external identity provider to a user.
+type Identity struct {
+	Issuer    string    `json:"issuer"`
+	Subject   string    `json:"subject"`
+	UserId    string    `json:"userId"`
+	Email     string    `json:"email"`
+	CreatedAt time.Time `json:"createdAt"`
+}
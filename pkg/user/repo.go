@@ -133,3 +133,51 @@ func (r *Repository) List(ctx context.Context, limit, page int64) ([]User, pagin
 		Total: count,
 	}, nil
 }
+
+// GetByIdentity returns the user linked to the subject of an identity provider.
+func (r *Repository) GetByIdentity(ctx context.Context, issuer, subject string) (User, error) {
+	var u User
+	q := `SELECT u.id, u.email, u.password_hash, u.first_name, u.last_name, u.role, u.created_at, u.updated_at
+           FROM users u JOIN user_identity i ON i.user_id = u.id
+           WHERE i.issuer = $1 and i.subject = $2 and u.deleted_at is NULL`
+	rw := r.db.QueryRowContext(ctx, q, issuer, subject).
+		Scan(&u.Id, &u.Email, &u.PasswordHash, &u.FirstName, &u.LastName, &u.Role, &u.CreatedAt, &u.UpdatedAt)
+	if rw != nil && rw.Error() != "" {
+		return User{}, ErrUserNotFound
+	}
+
+	return u, nil
+}
+
+func (r *Repository) SaveIdentity(ctx context.Context, i Identity) error {
+	q := `INSERT INTO user_identity(issuer, subject, user_id, email, created_at) values($1, $2, $3, $4, $5)`
+	_, err := r.db.ExecContext(ctx, q, i.Issuer, i.Subject, i.UserId, i.Email, i.CreatedAt)
+	if err != nil {
+		return err
+	}
+
+	return nil
+}
+
+// SaveNewUserWithIdentity creates a user on first single sign-on login.
+func (r *Repository) SaveNewUserWithIdentity(ctx context.Context, u User, i Identity) error {
+	tx, err := r.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	_, err = tx.ExecContext(ctx, "INSERT INTO users(id, email, password_hash, role,first_name, last_name,created_at,updated_at) values($1, $2, $3, $4, $5, $6, $7, $8)",
+		u.Id, u.Email, u.PasswordHash, u.Role, u.FirstName, u.LastName, u.CreatedAt, u.UpdatedAt)
+	if err != nil {
+		return err
+	}
+
+	_, err = tx.ExecContext(ctx, `INSERT INTO user_identity(issuer, subject, user_id, email, created_at) values($1, $2, $3, $4, $5)`,
+		i.Issuer, i.Subject, u.Id, i.Email, i.CreatedAt)
+	if err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}